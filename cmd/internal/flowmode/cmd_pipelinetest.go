@@ -0,0 +1,149 @@
+package flowmode
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/pkg/flow/pipelinetest"
+	"github.com/spf13/cobra"
+)
+
+func testCommand() *cobra.Command {
+	pt := &flowPipelineTest{
+		timeout: 5 * time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "test [flags] config_path test_file...",
+		Short: "Test the pipelines of a River configuration against fixture inputs",
+		Long: `The test subcommand runs the pipelines of a River configuration against the
+fixture inputs of one or more test files and asserts on their outputs.
+
+config_path can be a file or a directory. If config_path is a directory, the
+.river files at its top level are loaded together.
+
+Each test loads the whole configuration, including modules and custom
+components defined with declare blocks. Components which send data out of the
+pipeline, such as loki.write, are replaced by receivers which record what they
+receive, and components which collect data, such as loki.source.file, are
+replaced by components which don't collect anything.
+
+Each test names the component its inputs are sent to. Log entries are sent to
+components exporting a log receiver such as loki.process, samples to
+components exporting an appendable such as prometheus.relabel, and targets to
+components with a targets argument such as discovery.relabel. Inputs sent to a
+component which collects data are forwarded to the receivers in its arguments.
+
+The --run flag can be set to a regular expression to only run the tests with
+a matching name.
+
+test exits with a non-zero exit code if any test fails.`,
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pt.Run(cmd.Context(), args[0], args[1:])
+		},
+	}
+
+	cmd.Flags().StringVar(&pt.run, "run", pt.run, "Only run tests with names matching the regular expression.")
+	cmd.Flags().DurationVar(&pt.timeout, "timeout", pt.timeout, "How long a test waits for the component to start and for its expected outputs.")
+	cmd.Flags().BoolVarP(&pt.verbose, "verbose", "v", pt.verbose, "Print the logs of the components of the configuration.")
+	return cmd
+}
+
+type flowPipelineTest struct {
+	run     string
+	timeout time.Duration
+	verbose bool
+}
+
+func (pt *flowPipelineTest) Run(ctx context.Context, configPath string, testPaths []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var filter *regexp.Regexp
+	if pt.run != "" {
+		var err error
+		if filter, err = regexp.Compile(pt.run); err != nil {
+			return fmt.Errorf("invalid --run expression: %w", err)
+		}
+	}
+
+	sources, err := pipelinetest.ReadSources(configPath)
+	if err != nil {
+		return fmt.Errorf("reading config path %q: %w", configPath, err)
+	}
+
+	logWriter := io.Discard
+	if pt.verbose {
+		logWriter = os.Stderr
+	}
+	logger, err := logging.New(logWriter, logging.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	runner, err := pipelinetest.NewRunner(sources, pipelinetest.Options{
+		Logger:  logger,
+		Timeout: pt.timeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	var ran, failed int
+	for _, testPath := range testPaths {
+		bb, err := os.ReadFile(testPath)
+		if err != nil {
+			return fmt.Errorf("reading test path %q: %w", testPath, err)
+		}
+		f, err := pipelinetest.ParseFile(testPath, bb)
+		if err != nil {
+			return err
+		}
+
+		for _, test := range f.Tests {
+			if filter != nil && !filter.MatchString(test.Name) {
+				continue
+			}
+			ran++
+			if !runPipelineTest(ctx, os.Stdout, runner, test) {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintln(os.Stdout, "FAIL")
+		return fmt.Errorf("%d of %d tests failed", failed, ran)
+	}
+	fmt.Fprintln(os.Stdout, "PASS")
+	return nil
+}
+
+// runPipelineTest runs a single test and writes its result to w. It returns
+// true if the test passed.
+func runPipelineTest(ctx context.Context, w io.Writer, runner *pipelinetest.Runner, test pipelinetest.Test) bool {
+	fmt.Fprintf(w, "=== RUN   %s\n", test.Name)
+
+	start := time.Now()
+	err := runner.Run(ctx, test)
+	elapsed := time.Since(start).Seconds()
+
+	if err != nil {
+		fmt.Fprintf(w, "--- FAIL: %s (%.2fs)\n", test.Name, elapsed)
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		return false
+	}
+	fmt.Fprintf(w, "--- PASS: %s (%.2fs)\n", test.Name, elapsed)
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/signal"
@@ -24,6 +25,7 @@ import (
 	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/pkg/flow/tracing"
+	"github.com/grafana/agent/pkg/supportbundle"
 	"github.com/grafana/agent/pkg/usagestats"
 	"github.com/grafana/agent/service"
 	"github.com/grafana/agent/service/cluster"
@@ -43,6 +45,10 @@ import (
 	_ "github.com/grafana/agent/component/all"
 )
 
+// supportBundleLogLines is the number of recent log lines kept in memory for
+// support bundles.
+const supportBundleLogLines = 1000
+
 func runCommand() *cobra.Command {
 	r := &flowRun{
 		inMemoryAddr:          "agent.internal:12345",
@@ -55,6 +61,7 @@ func runCommand() *cobra.Command {
 		clusterAdvInterfaces:  advertise.DefaultInterfaces,
 		ClusterMaxJoinPeers:   5,
 		clusterRejoinInterval: 60 * time.Second,
+		drainTimeout:          10 * time.Second,
 	}
 
 	cmd := &cobra.Command{
@@ -81,10 +88,18 @@ debugging UI can be changed by providing a different value to
 Additionally, the HTTP server exposes the following debug endpoints:
 
   /debug/pprof   Go performance profiling tools
-
-If reloading the config dir/file-path fails, Grafana Agent Flow will continue running in
-its last valid state. Components which failed may be be listed as unhealthy,
-depending on the nature of the reload error.
+  /-/support     Support bundle with component state, sources, and profiles
+
+When an interrupt is received, components are stopped in reverse dependency
+order: components sending data are stopped before the components they send
+data to. Components holding in-flight data are given up to
+--component.drain-timeout to flush it before they are stopped.
+
+When reloading, the changes between the new config and the last valid config
+(components added, removed, or changed, and references added or removed) are
+logged and returned by /-/reload. If reloading the config dir/file-path fails,
+Grafana Agent Flow rolls back to its last valid config and keeps running. The
+last valid config and the config which failed are shown in the UI.
 `,
 		Args:         cobra.ExactArgs(1),
 		SilenceUsage: true,
@@ -99,6 +114,8 @@ depending on the nature of the reload error.
 	cmd.Flags().StringVar(&r.inMemoryAddr, "server.http.memory-addr", r.inMemoryAddr, "Address to listen for in-memory HTTP traffic on. Change if it collides with a real address")
 	cmd.Flags().StringVar(&r.storagePath, "storage.path", r.storagePath, "Base directory where components can store data")
 	cmd.Flags().StringVar(&r.uiPrefix, "server.http.ui-path-prefix", r.uiPrefix, "Prefix to serve the HTTP UI at")
+	cmd.Flags().
+		DurationVar(&r.drainTimeout, "component.drain-timeout", r.drainTimeout, "Maximum time each component may spend flushing in-flight data before it is stopped. Set to 0 to stop components immediately")
 	cmd.Flags().
 		BoolVar(&r.enablePprof, "server.http.enable-pprof", r.enablePprof, "Enable /debug/pprof profiling endpoints.")
 	cmd.Flags().
@@ -144,6 +161,7 @@ type flowRun struct {
 	clusterName                  string
 	configFormat                 string
 	configBypassConversionErrors bool
+	drainTimeout                 time.Duration
 }
 
 func (fr *flowRun) Run(configPath string) error {
@@ -157,7 +175,11 @@ func (fr *flowRun) Run(configPath string) error {
 		return fmt.Errorf("path argument not provided")
 	}
 
-	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	// Keep recent log lines in memory so they can be included in support
+	// bundles.
+	logBuffer := logging.NewRingBuffer(supportBundleLogLines)
+
+	l, err := logging.New(io.MultiWriter(os.Stderr, logBuffer), logging.DefaultOptions)
 	if err != nil {
 		return fmt.Errorf("building logger: %w", err)
 	}
@@ -198,8 +220,14 @@ func (fr *flowRun) Run(configPath string) error {
 	// To work around this, we lazily create variables for the functions the HTTP
 	// service needs and set them after the Flow controller exists.
 	var (
-		reload func() (*flow.Source, error)
-		ready  func() bool
+		reload     func() (*flow.LoadStatus, error)
+		ready      func() bool
+		loadStatus func() flow.LoadStatus
+
+		// loadedSource holds the most recent source passed to the Flow
+		// controller, used when building support bundles.
+		loadedSourceMut sync.Mutex
+		loadedSource    *flow.Source
 	)
 
 	clusterService, err := buildClusterService(clusterOptions{
@@ -228,7 +256,21 @@ func (fr *flowRun) Run(configPath string) error {
 		Gatherer: prometheus.DefaultGatherer,
 
 		ReadyFunc:  func() bool { return ready() },
-		ReloadFunc: func() (*flow.Source, error) { return reload() },
+		ReloadFunc: func() (*flow.LoadStatus, error) { return reload() },
+
+		SupportBundleFunc: func(ctx context.Context, host service.Host) (*supportbundle.FlowBundle, error) {
+			loadedSourceMut.Lock()
+			source := loadedSource
+			loadedSourceMut.Unlock()
+
+			return supportbundle.ExportFlow(ctx, supportbundle.FlowOptions{
+				Components: host,
+				Gatherer:   prometheus.DefaultGatherer,
+				Sources:    source.RawConfigs(),
+				Peers:      clusterService.Data().(cluster.Cluster).Peers(),
+				Logs:       logBuffer.Bytes(),
+			})
+		},
 
 		HTTPListenAddr:   fr.httpListenAddr,
 		MemoryListenAddr: fr.inMemoryAddr,
@@ -238,6 +280,8 @@ func (fr *flowRun) Run(configPath string) error {
 	uiService := uiservice.New(uiservice.Options{
 		UIPrefix: fr.uiPrefix,
 		Cluster:  clusterService.Data().(cluster.Cluster),
+
+		LoadStatusFunc: func() flow.LoadStatus { return loadStatus() },
 	})
 
 	otelService := otel_service.New(l)
@@ -259,10 +303,12 @@ func (fr *flowRun) Run(configPath string) error {
 			otelService,
 			labelService,
 		},
+		DrainTimeout: fr.drainTimeout,
 	})
 
 	ready = f.Ready
-	reload = func() (*flow.Source, error) {
+	loadStatus = f.LoadStatus
+	reload = func() (*flow.LoadStatus, error) {
 		flowSource, err := loadFlowSource(configPath, fr.configFormat, fr.configBypassConversionErrors)
 		defer instrumentation.InstrumentSHA256(flowSource.SHA256())
 		defer instrumentation.InstrumentLoad(err == nil)
@@ -270,11 +316,17 @@ func (fr *flowRun) Run(configPath string) error {
 		if err != nil {
 			return nil, fmt.Errorf("reading config path %q: %w", configPath, err)
 		}
-		if err := f.LoadSource(flowSource, nil); err != nil {
-			return flowSource, fmt.Errorf("error during the initial grafana/agent load: %w", err)
-		}
 
-		return flowSource, nil
+		loadedSourceMut.Lock()
+		loadedSource = flowSource
+		loadedSourceMut.Unlock()
+
+		err = f.LoadSource(flowSource, nil)
+		status := f.LoadStatus()
+		if err != nil {
+			return &status, fmt.Errorf("error during the initial grafana/agent load: %w", err)
+		}
+		return &status, nil
 	}
 
 	// Flow controller
@@ -303,7 +355,7 @@ func (fr *flowRun) Run(configPath string) error {
 	// Perform the initial reload. This is done after starting the HTTP server so
 	// that /metric and pprof endpoints are available while the Flow controller
 	// is loading.
-	if source, err := reload(); err != nil {
+	if status, err := reload(); err != nil {
 		var diags diag.Diagnostics
 		if errors.As(err, &diags) {
 			p := diag.NewPrinter(diag.PrinterConfig{
@@ -311,7 +363,12 @@ func (fr *flowRun) Run(configPath string) error {
 				ContextLinesBefore: 1,
 				ContextLinesAfter:  1,
 			})
-			_ = p.Fprint(os.Stderr, source.RawConfigs(), diags)
+			// status is nil if the source couldn't be read or parsed.
+			var failed *flow.Source
+			if status != nil {
+				failed = status.Failed
+			}
+			_ = p.Fprint(os.Stderr, failed.RawConfigs(), diags)
 
 			// Print newline after the diagnostics.
 			fmt.Println()
@@ -341,8 +398,8 @@ func (fr *flowRun) Run(configPath string) error {
 		case <-ctx.Done():
 			return nil
 		case <-reloadSignal:
-			if _, err := reload(); err != nil {
-				level.Error(l).Log("msg", "failed to reload config", "err", err)
+			if status, err := reload(); err != nil {
+				level.Error(l).Log("msg", "failed to reload config", "err", err, "rolled_back", status != nil && status.RolledBack)
 			} else {
 				level.Info(l).Log("msg", "config reloaded")
 			}
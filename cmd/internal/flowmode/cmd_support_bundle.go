@@ -0,0 +1,132 @@
+package flowmode
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func supportBundleCommand() *cobra.Command {
+	sb := &flowSupportBundle{
+		addr:     "http://127.0.0.1:12345",
+		duration: 30 * time.Second,
+		output:   "agent-support-bundle.zip",
+	}
+
+	cmd := &cobra.Command{
+		Use:   "support-bundle [flags]",
+		Short: "Download a support bundle from a running Grafana Agent Flow",
+		Long: `The support-bundle subcommand downloads a support bundle from the /-/support
+endpoint of a running Grafana Agent Flow process and writes it to disk as a zip
+file.
+
+The support bundle contains the health, arguments, exports, and debug info of
+all running components, the loaded River sources with likely secrets redacted,
+the list of cluster peers, internal metrics, recent logs, and pprof profiles.
+
+A CPU profile is collected for the duration given by --duration, so the command
+takes at least that long to complete.
+
+If the HTTP server of the running process requires authentication, provide
+credentials of a user with the admin role through --bearer-token-file or
+--basic-auth.username and --basic-auth.password-file.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return sb.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&sb.addr, "server.http.addr", sb.addr, "URL of the HTTP server of the running Grafana Agent Flow process")
+	cmd.Flags().DurationVar(&sb.duration, "duration", sb.duration, "Duration of the CPU profile included in the bundle")
+	cmd.Flags().StringVarP(&sb.output, "output", "o", sb.output, "Path to write the support bundle to")
+	cmd.Flags().StringVar(&sb.bearerTokenFile, "bearer-token-file", sb.bearerTokenFile, "File containing a bearer token used to authenticate")
+	cmd.Flags().StringVar(&sb.username, "basic-auth.username", sb.username, "Username used to authenticate")
+	cmd.Flags().StringVar(&sb.passwordFile, "basic-auth.password-file", sb.passwordFile, "File containing the password used to authenticate")
+	return cmd
+}
+
+type flowSupportBundle struct {
+	addr            string
+	duration        time.Duration
+	output          string
+	bearerTokenFile string
+	username        string
+	passwordFile    string
+}
+
+func (sb *flowSupportBundle) Run() error {
+	if sb.duration < time.Second {
+		return fmt.Errorf("duration must be at least 1s")
+	}
+	if sb.bearerTokenFile != "" && sb.username != "" {
+		return fmt.Errorf("cannot use both --bearer-token-file and --basic-auth.username")
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(sb.addr, "/") + "/-/support")
+	if err != nil {
+		return fmt.Errorf("invalid server address: %w", err)
+	}
+	q := u.Query()
+	q.Set("duration", fmt.Sprintf("%d", int(sb.duration.Seconds())))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case sb.bearerTokenFile != "":
+		token, err := os.ReadFile(sb.bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case sb.username != "":
+		var password []byte
+		if sb.passwordFile != "" {
+			password, err = os.ReadFile(sb.passwordFile)
+			if err != nil {
+				return fmt.Errorf("failed to read password file: %w", err)
+			}
+		}
+		req.SetBasicAuth(sb.username, strings.TrimSpace(string(password)))
+	}
+
+	fmt.Fprintf(os.Stderr, "collecting support bundle from %s for %s...\n", sb.addr, sb.duration)
+
+	// Leave room for the server to gather the rest of the bundle after the
+	// CPU profile completes.
+	cli := &http.Client{Timeout: sb.duration + time.Minute}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request support bundle: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to request support bundle: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	f, err := os.Create(sb.output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("failed to write support bundle: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "support bundle written to %s\n", sb.output)
+	return nil
+}
@@ -3,6 +3,7 @@ package flowmode
 import (
 	"fmt"
 
+	"github.com/grafana/agent/component/loki/write"
 	"github.com/grafana/agent/component/prometheus/remotewrite"
 	"github.com/spf13/cobra"
 )
@@ -15,6 +16,7 @@ func toolsCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(
+		getTools("loki.write", write.InstallTools),
 		getTools("prometheus.remote_write", remotewrite.InstallTools),
 	)
 
@@ -0,0 +1,224 @@
+package flowmode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/grafana/agent/pkg/flow"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/agent/service/cluster"
+	httpservice "github.com/grafana/agent/service/http"
+	"github.com/grafana/agent/service/labelstore"
+	otel_service "github.com/grafana/agent/service/otel"
+	uiservice "github.com/grafana/agent/service/ui"
+	"github.com/grafana/river/diag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+)
+
+func validateCommand() *cobra.Command {
+	v := &flowValidate{
+		format:       "text",
+		configFormat: "flow",
+	}
+
+	cmd := &cobra.Command{
+		Use:   "validate [flags] path",
+		Short: "Validate a River configuration",
+		Long: `The validate subcommand checks a River configuration for errors without
+running it.
+
+validate builds the component graph of the configuration and reports unknown
+components, invalid arguments, references to exports which don't exist,
+reference cycles, and components which depend on missing services. No
+component is started. Content referenced by import blocks is retrieved.
+
+If path is a directory, all *.river files in that directory will be combined
+into a single unit. Subdirectories are not recursively searched for further merging.
+
+The --format flag can be set to "json" to write diagnostics as JSON to stdout.
+Otherwise, diagnostics are written to stderr.
+
+validate exits with a non-zero exit code if the configuration contains errors.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+
+		RunE: func(_ *cobra.Command, args []string) error {
+			return v.Run(args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&v.format, "format", v.format, `Output format of diagnostics. Supported formats: "text", "json".`)
+	cmd.Flags().StringVar(&v.configFormat, "config.format", v.configFormat, fmt.Sprintf("The format of the source file. Supported formats: %s.", supportedFormatsList()))
+	cmd.Flags().BoolVar(&v.configBypassConversionErrors, "config.bypass-conversion-errors", v.configBypassConversionErrors, "Enable bypassing errors when converting")
+	return cmd
+}
+
+type flowValidate struct {
+	format                       string
+	configFormat                 string
+	configBypassConversionErrors bool
+}
+
+func (fv *flowValidate) Run(configPath string) error {
+	if fv.format != "text" && fv.format != "json" {
+		return fmt.Errorf("unsupported format %q", fv.format)
+	}
+
+	diags, sources, err := fv.validate(configPath)
+	if err != nil {
+		return err
+	}
+
+	switch fv.format {
+	case "json":
+		if err := writeValidateJSON(os.Stdout, diags); err != nil {
+			return err
+		}
+	default:
+		if len(diags) > 0 {
+			p := diag.NewPrinter(diag.PrinterConfig{
+				Color:              !color.NoColor,
+				ContextLinesBefore: 1,
+				ContextLinesAfter:  1,
+			})
+			_ = p.Fprint(os.Stderr, sources, diags)
+
+			// Print newline after the diagnostics.
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+
+	if diags.HasErrors() {
+		return fmt.Errorf("configuration contains errors")
+	}
+	return nil
+}
+
+// validate loads and validates the configuration at configPath. Errors
+// loading the configuration which have position information are returned as
+// diagnostics.
+func (fv *flowValidate) validate(configPath string) (diag.Diagnostics, map[string][]byte, error) {
+	source, err := loadFlowSource(configPath, fv.configFormat, fv.configBypassConversionErrors)
+
+	var diags diag.Diagnostics
+	if errors.As(err, &diags) {
+		return diags, readSources(configPath), nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("reading config path %q: %w", configPath, err)
+	}
+
+	l, err := logging.New(io.Discard, logging.DefaultOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("building logger: %w", err)
+	}
+
+	dataPath, err := os.MkdirTemp("", "agent-validate-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dataPath)
+
+	services, err := validateServices(l)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diags = flow.Validate(source, flow.ValidateOptions{
+		Logger:   l,
+		DataPath: dataPath,
+		Services: services,
+	})
+	return diags, source.RawConfigs(), nil
+}
+
+// readSources reads the raw River files at path for printing diagnostics.
+// Files which can't be read are omitted.
+func readSources(path string) map[string][]byte {
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		return nil
+	}
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return map[string][]byte{path: bb}
+}
+
+// validateServices returns the services available to components when running
+// Flow. The services are never run or updated; they only provide the
+// definitions components are checked against.
+func validateServices(l *logging.Logger) ([]service.Service, error) {
+	clusterService, err := cluster.New(cluster.Options{
+		Log:              l,
+		Metrics:          prometheus.NewRegistry(),
+		EnableClustering: false,
+		NodeName:         "validate",
+		AdvertiseAddress: "127.0.0.1:12345",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building cluster service: %w", err)
+	}
+
+	otelService := otel_service.New(l)
+	if otelService == nil {
+		return nil, fmt.Errorf("failed to create otel service")
+	}
+
+	return []service.Service{
+		httpservice.New(httpservice.Options{Logger: l}),
+		uiservice.New(uiservice.Options{Cluster: clusterService.Data().(cluster.Cluster)}),
+		clusterService,
+		otelService,
+		labelstore.New(l),
+	}, nil
+}
+
+type validateDiagnostic struct {
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+}
+
+type validateResult struct {
+	Valid       bool                 `json:"valid"`
+	Diagnostics []validateDiagnostic `json:"diagnostics"`
+}
+
+// writeValidateJSON writes diags to w as a JSON object.
+func writeValidateJSON(w io.Writer, diags diag.Diagnostics) error {
+	res := validateResult{
+		Valid:       !diags.HasErrors(),
+		Diagnostics: make([]validateDiagnostic, 0, len(diags)),
+	}
+	for _, d := range diags {
+		severity := "error"
+		if d.Severity == diag.SeverityLevelWarn {
+			severity = "warning"
+		}
+
+		res.Diagnostics = append(res.Diagnostics, validateDiagnostic{
+			Severity:  severity,
+			Message:   d.Message,
+			File:      d.StartPos.Filename,
+			Line:      d.StartPos.Line,
+			Column:    d.StartPos.Column,
+			EndLine:   d.EndPos.Line,
+			EndColumn: d.EndPos.Column,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
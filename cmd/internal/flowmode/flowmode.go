@@ -27,7 +27,10 @@ func Run() {
 		convertCommand(),
 		fmtCommand(),
 		runCommand(),
+		supportBundleCommand(),
+		testCommand(),
 		toolsCommand(),
+		validateCommand(),
 	)
 
 	if err := cmd.Execute(); err != nil {
@@ -52,6 +52,7 @@ type positions struct {
 	cfg       Config
 	mtx       sync.Mutex
 	positions map[Entry]string
+	files     map[FileEntry]FilePosition
 	quit      chan struct{}
 	done      chan struct{}
 }
@@ -68,9 +69,25 @@ type Entry struct {
 	Labels string `yaml:"labels"`
 }
 
+// FileEntry describes a positions file entry for a file identified by its
+// fingerprint rather than its path, so that its position follows it when it's
+// renamed. The same file may be tailed with different label sets.
+type FileEntry struct {
+	Fingerprint string `yaml:"fingerprint"`
+	Labels      string `yaml:"labels"`
+}
+
+// FilePosition is the position of a file identified by a FileEntry, along
+// with the path it was tailed at.
+type FilePosition struct {
+	Path   string `yaml:"path"`
+	Offset int64  `yaml:"offset"`
+}
+
 // File format for the positions data.
 type File struct {
-	Positions map[Entry]string `yaml:"positions"`
+	Positions map[Entry]string           `yaml:"positions"`
+	Files     map[FileEntry]FilePosition `yaml:"files,omitempty"`
 }
 
 type Positions interface {
@@ -88,8 +105,18 @@ type Positions interface {
 	PutString(path, labels string, pos string)
 	// Put records (asynchronously) how far we've read through a file.
 	Put(path, labels string, pos int64)
-	// Remove removes the position tracking for a filepath
+	// Remove removes the position tracking for a filepath, including the
+	// files tracked by fingerprint at that path.
 	Remove(path, labels string)
+	// GetFiles returns how far we've read through the files tailed at path,
+	// keyed by their fingerprint.
+	GetFiles(path, labels string) map[string]int64
+	// PutFile records (asynchronously) how far we've read through the file
+	// with the given fingerprint, tailed at path.
+	PutFile(fingerprint, path, labels string, pos int64)
+	// RemoveFile removes the position tracking for the file with the given
+	// fingerprint.
+	RemoveFile(fingerprint, labels string)
 	// SyncPeriod returns how often the positions file gets resynced
 	SyncPeriod() time.Duration
 	// Stop the Position tracker.
@@ -98,7 +125,7 @@ type Positions interface {
 
 // New makes a new Positions.
 func New(logger log.Logger, cfg Config) (Positions, error) {
-	positionData, err := readPositionsFile(cfg, logger)
+	positionData, err := readFile(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +133,8 @@ func New(logger log.Logger, cfg Config) (Positions, error) {
 	p := &positions{
 		logger:    logger,
 		cfg:       cfg,
-		positions: positionData,
+		positions: positionData.Positions,
+		files:     positionData.Files,
 		quit:      make(chan struct{}),
 		done:      make(chan struct{}),
 	}
@@ -154,6 +182,35 @@ func (p *positions) Remove(path, labels string) {
 
 func (p *positions) remove(path, labels string) {
 	delete(p.positions, Entry{path, labels})
+	for e, pos := range p.files {
+		if pos.Path == path && e.Labels == labels {
+			delete(p.files, e)
+		}
+	}
+}
+
+func (p *positions) GetFiles(path, labels string) map[string]int64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	res := make(map[string]int64)
+	for e, pos := range p.files {
+		if pos.Path == path && e.Labels == labels {
+			res[e.Fingerprint] = pos.Offset
+		}
+	}
+	return res
+}
+
+func (p *positions) PutFile(fingerprint, path, labels string, pos int64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.files[FileEntry{fingerprint, labels}] = FilePosition{Path: path, Offset: pos}
+}
+
+func (p *positions) RemoveFile(fingerprint, labels string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.files, FileEntry{fingerprint, labels})
 }
 
 func (p *positions) SyncPeriod() time.Duration {
@@ -184,9 +241,15 @@ func (p *positions) save() {
 		return
 	}
 	p.mtx.Lock()
-	positions := make(map[Entry]string, len(p.positions))
+	positions := File{
+		Positions: make(map[Entry]string, len(p.positions)),
+		Files:     make(map[FileEntry]FilePosition, len(p.files)),
+	}
 	for k, v := range p.positions {
-		positions[k] = v
+		positions.Positions[k] = v
+	}
+	for k, v := range p.files {
+		positions.Files[k] = v
 	}
 	p.mtx.Unlock()
 
@@ -226,16 +289,35 @@ func (p *positions) cleanup() {
 	for _, tr := range toRemove {
 		p.remove(tr.Path, tr.Labels)
 	}
+
+	for e, pos := range p.files {
+		if _, err := os.Stat(pos.Path); os.IsNotExist(err) {
+			delete(p.files, e)
+		}
+	}
 }
 
 func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error) {
+	p, err := readFile(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return p.Positions, nil
+}
+
+func readFile(cfg Config, logger log.Logger) (File, error) {
+	empty := File{
+		Positions: map[Entry]string{},
+		Files:     map[FileEntry]FilePosition{},
+	}
+
 	cleanfn := filepath.Clean(cfg.PositionsFile)
 	buf, err := os.ReadFile(cleanfn)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
-		return nil, err
+		return File{}, err
 	}
 
 	var p File
@@ -244,16 +326,19 @@ func readPositionsFile(cfg Config, logger log.Logger) (map[Entry]string, error)
 		// return empty if cfg option enabled
 		if cfg.IgnoreInvalidYaml {
 			level.Debug(logger).Log("msg", "ignoring invalid positions file", "file", cleanfn, "error", err)
-			return map[Entry]string{}, nil
+			return empty, nil
 		}
 
-		return nil, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
+		return File{}, fmt.Errorf("invalid yaml positions file [%s]: %v", cleanfn, err)
 	}
 
 	// p.Positions will be nil if the file exists but is empty
 	if p.Positions == nil {
 		p.Positions = map[Entry]string{}
 	}
+	if p.Files == nil {
+		p.Files = map[FileEntry]FilePosition{}
+	}
 
-	return p.Positions, nil
+	return p, nil
 }
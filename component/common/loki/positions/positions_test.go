@@ -288,3 +288,41 @@ positions:
 		Labels: ``,
 	}])
 }
+
+func TestFiles(t *testing.T) {
+	temp := tempFilename(t)
+	defer func() {
+		_ = os.Remove(temp)
+	}()
+
+	p, err := New(util_log.Logger, Config{
+		SyncPeriod:    20 * time.Second,
+		PositionsFile: temp,
+	})
+	require.NoError(t, err)
+	defer p.Stop()
+
+	p.Put("/tmp/foo.log", `{job="tmp"}`, 10)
+	p.PutFile("1-10-a", "/tmp/foo.log", `{job="tmp"}`, 10)
+	p.PutFile("2-20-b", "/tmp/foo.log", `{job="tmp"}`, 20)
+	p.PutFile("2-20-b", "/tmp/foo.log", `{job="other"}`, 30)
+	p.PutFile("3-30-c", "/tmp/bar.log", `{job="tmp"}`, 40)
+	require.Equal(t, map[string]int64{"1-10-a": 10, "2-20-b": 20}, p.GetFiles("/tmp/foo.log", `{job="tmp"}`))
+
+	p.RemoveFile("1-10-a", `{job="tmp"}`)
+	require.Equal(t, map[string]int64{"2-20-b": 20}, p.GetFiles("/tmp/foo.log", `{job="tmp"}`))
+
+	p.(*positions).save()
+	out, err := readFile(Config{PositionsFile: temp}, log.NewNopLogger())
+	require.NoError(t, err)
+	require.Equal(t, map[FileEntry]FilePosition{
+		{Fingerprint: "2-20-b", Labels: `{job="tmp"}`}:   {Path: "/tmp/foo.log", Offset: 20},
+		{Fingerprint: "2-20-b", Labels: `{job="other"}`}: {Path: "/tmp/foo.log", Offset: 30},
+		{Fingerprint: "3-30-c", Labels: `{job="tmp"}`}:   {Path: "/tmp/bar.log", Offset: 40},
+	}, out.Files)
+
+	// Removing a path removes the files tracked at that path.
+	p.Remove("/tmp/foo.log", `{job="tmp"}`)
+	require.Empty(t, p.GetFiles("/tmp/foo.log", `{job="tmp"}`))
+	require.Equal(t, map[string]int64{"2-20-b": 30}, p.GetFiles("/tmp/foo.log", `{job="other"}`))
+}
@@ -0,0 +1,233 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// tenantLabel is the label holding the tenant of entries, as set by
+// loki.process stages. It mirrors client.ReservedLabelTenantID, which can't
+// be imported here.
+const tenantLabel = "__tenant_id__"
+
+// ReplayOptions configures how streams are pushed to a Loki endpoint.
+type ReplayOptions struct {
+	// URL of the push API of the Loki endpoint.
+	URL string
+	// Headers to add to requests.
+	Headers map[string]string
+	// TenantID is the tenant of the streams without a tenant label.
+	TenantID string
+	// Concurrency is the number of concurrent requests. The entries of a
+	// stream are always sent by the same worker, in order.
+	Concurrency int
+	// BatchSize is the maximum number of entries per request.
+	BatchSize int
+	// Timeout of requests.
+	Timeout time.Duration
+	// MaxRetries is the maximum number of retries of requests failing with
+	// 429 or 5xx status codes.
+	MaxRetries int
+}
+
+// ReplayStats are statistics on replayed entries.
+type ReplayStats struct {
+	Streams        int
+	Entries        int
+	Requests       int
+	FailedEntries  int
+	FailedRequests int
+	// LastError is the last error of failed requests.
+	LastError error
+}
+
+// Replay pushes the entries of streams to a Loki endpoint. Streams with a
+// tenant label are pushed to that tenant, without the label. Requests rejected
+// by the endpoint are counted in the returned stats rather than aborting the
+// replay; an error is only returned when the replay can't proceed.
+func Replay(ctx context.Context, streams []*Stream, opts ReplayOptions) (ReplayStats, error) {
+	stats := ReplayStats{Streams: len(streams)}
+	if opts.Concurrency <= 0 || opts.BatchSize <= 0 {
+		return stats, fmt.Errorf("concurrency and batch size must be greater than 0")
+	}
+
+	var (
+		tenants  []string
+		byTenant = make(map[string][]*Stream)
+	)
+	for _, s := range streams {
+		tenant := opts.TenantID
+		if t, ok := s.Labels[tenantLabel]; ok {
+			tenant = string(t)
+			lbls := s.Labels.Clone()
+			delete(lbls, tenantLabel)
+			s = &Stream{Labels: lbls, Entries: s.Entries}
+		}
+		if _, ok := byTenant[tenant]; !ok {
+			tenants = append(tenants, tenant)
+		}
+		byTenant[tenant] = append(byTenant[tenant], s)
+	}
+
+	client := &http.Client{Timeout: opts.Timeout}
+	for _, tenant := range tenants {
+		var (
+			wg       sync.WaitGroup
+			mut      sync.Mutex
+			firstErr error
+		)
+		for i := 0; i < opts.Concurrency; i++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+
+				r := replayer{client: client, opts: opts, tenant: tenant}
+				err := r.run(ctx, byTenant[tenant], worker)
+
+				mut.Lock()
+				defer mut.Unlock()
+				stats.Entries += r.stats.Entries
+				stats.Requests += r.stats.Requests
+				stats.FailedEntries += r.stats.FailedEntries
+				stats.FailedRequests += r.stats.FailedRequests
+				if r.stats.LastError != nil {
+					stats.LastError = r.stats.LastError
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return stats, firstErr
+		}
+	}
+	return stats, nil
+}
+
+// replayer batches the entries of streams into requests for a tenant.
+type replayer struct {
+	client *http.Client
+	opts   ReplayOptions
+	tenant string
+
+	pending []logproto.Stream
+	entries int
+	stats   ReplayStats
+}
+
+// run sends the streams assigned to the given worker.
+func (r *replayer) run(ctx context.Context, streams []*Stream, worker int) error {
+	for i := worker; i < len(streams); i += r.opts.Concurrency {
+		if err := r.add(ctx, streams[i]); err != nil {
+			return err
+		}
+	}
+	return r.flush(ctx)
+}
+
+func (r *replayer) add(ctx context.Context, s *Stream) error {
+	lbls := s.Labels.String()
+
+	entries := s.Entries
+	for len(entries) > 0 {
+		n := min(len(entries), r.opts.BatchSize-r.entries)
+		r.pending = append(r.pending, logproto.Stream{Labels: lbls, Entries: entries[:n]})
+		r.entries += n
+		entries = entries[n:]
+
+		if r.entries >= r.opts.BatchSize {
+			if err := r.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush sends the pending entries, retrying requests failing with 429 or
+// 5xx status codes.
+func (r *replayer) flush(ctx context.Context) error {
+	if r.entries == 0 {
+		return nil
+	}
+	defer func() {
+		r.pending = r.pending[:0]
+		r.entries = 0
+	}()
+
+	req := logproto.PushRequest{Streams: r.pending}
+	buf, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	compressed := snappy.Encode(nil, buf)
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = r.send(ctx, compressed)
+		if err == nil || !retry || attempt >= r.opts.MaxRetries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+
+	r.stats.Requests++
+	r.stats.Entries += r.entries
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.stats.FailedRequests++
+		r.stats.FailedEntries += r.entries
+		r.stats.LastError = err
+	}
+	return nil
+}
+
+// send sends a request. It returns true if a failed request can be retried.
+func (r *replayer) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range r.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if r.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", r.tenant)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
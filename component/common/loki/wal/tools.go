@@ -0,0 +1,278 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/grafana/loki/pkg/ingester/wal"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/util"
+	walUtils "github.com/grafana/loki/pkg/util/wal"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// Stream holds the entries of a stream within the WAL, sorted by timestamp.
+type Stream struct {
+	Labels  model.LabelSet
+	Entries []logproto.Entry
+}
+
+// StreamStats are statistics on the entries of a stream within the WAL.
+type StreamStats struct {
+	Labels  model.LabelSet
+	From    time.Time
+	To      time.Time
+	Entries int
+	Bytes   int
+}
+
+// Stats are statistics on the whole WAL.
+type Stats struct {
+	// From holds the timestamp of the oldest entry within the WAL.
+	From time.Time
+	// To holds the timestamp of the newest entry within the WAL.
+	To time.Time
+
+	// FirstSegment and LastSegment are the numbers of the oldest and newest
+	// segments of the WAL.
+	FirstSegment int
+	LastSegment  int
+
+	// Streams holds statistics on each stream, sorted by decreasing number of
+	// entries.
+	Streams []StreamStats
+}
+
+// Entries returns the number of entries across all streams.
+func (s Stats) Entries() int {
+	var entries int
+	for _, st := range s.Streams {
+		entries += st.Entries
+	}
+	return entries
+}
+
+// Bytes returns the size of the lines across all streams.
+func (s Stats) Bytes() int {
+	var bytes int
+	for _, st := range s.Streams {
+		bytes += st.Bytes
+	}
+	return bytes
+}
+
+// walIterate calls f for each entry of the WAL in dir.
+func walIterate(dir string, f func(lbls model.LabelSet, e logproto.Entry) error) error {
+	reader, closer, err := walUtils.NewWalReader(dir, -1)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	seenSeries := make(map[uint64]model.LabelSet)
+	for reader.Next() {
+		var rec wal.Record
+		if err := wal.DecodeRecord(reader.Record(), &rec); err != nil {
+			return fmt.Errorf("error decoding wal record: %w", err)
+		}
+
+		for _, series := range rec.Series {
+			if _, ok := seenSeries[uint64(series.Ref)]; !ok {
+				seenSeries[uint64(series.Ref)] = util.MapToModelLabelSet(series.Labels.Map())
+			}
+		}
+
+		for _, entries := range rec.RefEntries {
+			lbls, ok := seenSeries[uint64(entries.Ref)]
+			if !ok {
+				return fmt.Errorf("found entry without matching series")
+			}
+			for _, e := range entries.Entries {
+				if err := f(lbls, e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return reader.Err()
+}
+
+// ReadStreams reads the streams matching the given label selector from the
+// WAL in dir, with their entries between from and to inclusive. Zero times
+// leave the time range unbounded. Streams are sorted by labels.
+func ReadStreams(dir string, selectorStr string, from, to time.Time) ([]*Stream, error) {
+	selector, err := parser.ParseMetricSelector(selectorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]*Stream)
+	err = walIterate(dir, func(lbls model.LabelSet, e logproto.Entry) error {
+		if !matches(selector, lbls) || !inRange(e.Timestamp, from, to) {
+			return nil
+		}
+
+		key := lbls.String()
+		s, ok := streams[key]
+		if !ok {
+			s = &Stream{Labels: lbls}
+			streams[key] = s
+		}
+		s.Entries = append(s.Entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Stream, 0, len(streams))
+	for _, s := range streams {
+		sort.SliceStable(s.Entries, func(i, j int) bool {
+			return s.Entries[i].Timestamp.Before(s.Entries[j].Timestamp)
+		})
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Labels.String() < res[j].Labels.String() })
+	return res, nil
+}
+
+// FindStreams returns statistics on the entries of the streams matching the
+// given label selector in the WAL in dir.
+func FindStreams(dir string, selectorStr string) ([]StreamStats, error) {
+	selector, err := parser.ParseMetricSelector(selectorStr)
+	if err != nil {
+		return nil, err
+	}
+	return collectStreamStats(dir, selector)
+}
+
+// CalculateStats computes statistics on the WAL in dir.
+func CalculateStats(dir string) (Stats, error) {
+	var (
+		stats Stats
+		err   error
+	)
+
+	stats.FirstSegment, stats.LastSegment, err = wlog.Segments(dir)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Streams, err = collectStreamStats(dir, nil)
+	if err != nil {
+		return stats, err
+	}
+	for _, st := range stats.Streams {
+		if stats.From.IsZero() || st.From.Before(stats.From) {
+			stats.From = st.From
+		}
+		if st.To.After(stats.To) {
+			stats.To = st.To
+		}
+	}
+	return stats, nil
+}
+
+func collectStreamStats(dir string, selector []*labels.Matcher) ([]StreamStats, error) {
+	streams := make(map[string]*StreamStats)
+	err := walIterate(dir, func(lbls model.LabelSet, e logproto.Entry) error {
+		if !matches(selector, lbls) {
+			return nil
+		}
+
+		key := lbls.String()
+		st, ok := streams[key]
+		if !ok {
+			st = &StreamStats{Labels: lbls, From: e.Timestamp, To: e.Timestamp}
+			streams[key] = st
+		}
+		if e.Timestamp.Before(st.From) {
+			st.From = e.Timestamp
+		}
+		if e.Timestamp.After(st.To) {
+			st.To = e.Timestamp
+		}
+		st.Entries++
+		st.Bytes += len(e.Line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]StreamStats, 0, len(streams))
+	for _, st := range streams {
+		res = append(res, *st)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Entries != res[j].Entries {
+			return res[i].Entries > res[j].Entries
+		}
+		return res[i].Labels.String() < res[j].Labels.String()
+	})
+	return res, nil
+}
+
+func matches(selector []*labels.Matcher, lbls model.LabelSet) bool {
+	for _, m := range selector {
+		if !m.Matches(string(lbls[model.LabelName(m.Name)])) {
+			return false
+		}
+	}
+	return true
+}
+
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+// exportedEntry is an entry exported as JSON.
+type exportedEntry struct {
+	Labels             string            `json:"labels"`
+	Timestamp          time.Time         `json:"timestamp"`
+	Line               string            `json:"line"`
+	StructuredMetadata map[string]string `json:"structured_metadata,omitempty"`
+}
+
+// WriteJSON writes the entries of streams as JSON objects, one per line.
+func WriteJSON(w io.Writer, streams []*Stream) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for _, s := range streams {
+		lbls := s.Labels.String()
+		for _, e := range s.Entries {
+			exported := exportedEntry{Labels: lbls, Timestamp: e.Timestamp, Line: e.Line}
+			if len(e.StructuredMetadata) > 0 {
+				exported.StructuredMetadata = make(map[string]string, len(e.StructuredMetadata))
+				for _, l := range e.StructuredMetadata {
+					exported.StructuredMetadata[l.Name] = l.Value
+				}
+			}
+			if err := enc.Encode(exported); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteRaw writes the lines of the entries of streams, one per line.
+func WriteRaw(w io.Writer, streams []*Stream) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range streams {
+		for _, e := range s.Entries {
+			if _, err := fmt.Fprintln(bw, e.Line); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
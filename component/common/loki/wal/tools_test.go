@@ -0,0 +1,145 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+var toolsTestStart = time.Unix(1700000000, 0).UTC()
+
+// setupToolsWAL writes a WAL with 3 entries of a "foo" stream and 1 entry of
+// a "bar" stream of tenant "t1".
+func setupToolsWAL(t *testing.T) string {
+	dir := t.TempDir()
+	wl, err := New(Config{Dir: dir, Enabled: true}, log.NewNopLogger(), prometheus.NewRegistry())
+	require.NoError(t, err)
+	defer wl.Close()
+
+	ew := newEntryWriter()
+	write := func(lbls model.LabelSet, offset time.Duration, line string) {
+		require.NoError(t, ew.WriteEntry(loki.Entry{
+			Labels: lbls,
+			Entry:  logproto.Entry{Timestamp: toolsTestStart.Add(offset), Line: line},
+		}, wl, log.NewNopLogger()))
+	}
+	foo := model.LabelSet{"app": "foo"}
+	bar := model.LabelSet{"app": "bar", tenantLabel: "t1"}
+
+	write(foo, 2*time.Second, "foo 2")
+	write(foo, 0, "foo 0")
+	write(bar, time.Second, "bar 1")
+	write(foo, 3*time.Second, "foo 3")
+	require.NoError(t, wl.Sync())
+	return dir
+}
+
+func TestReadStreams(t *testing.T) {
+	dir := setupToolsWAL(t)
+
+	streams, err := ReadStreams(dir, `{app="foo"}`, toolsTestStart, toolsTestStart.Add(2*time.Second))
+	require.NoError(t, err)
+	require.Len(t, streams, 1)
+	require.Equal(t, model.LabelSet{"app": "foo"}, streams[0].Labels)
+	require.Len(t, streams[0].Entries, 2)
+	require.Equal(t, "foo 0", streams[0].Entries[0].Line)
+	require.Equal(t, "foo 2", streams[0].Entries[1].Line)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRaw(&buf, streams))
+	require.Equal(t, "foo 0\nfoo 2\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteJSON(&buf, streams[:1]))
+	require.Equal(t, `{"labels":"{app=\"foo\"}","timestamp":"2023-11-14T22:13:20Z","line":"foo 0"}
+{"labels":"{app=\"foo\"}","timestamp":"2023-11-14T22:13:22Z","line":"foo 2"}
+`, buf.String())
+}
+
+func TestCalculateStats(t *testing.T) {
+	dir := setupToolsWAL(t)
+
+	stats, err := CalculateStats(dir)
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.Entries())
+	require.Equal(t, 20, stats.Bytes())
+	require.True(t, stats.From.Equal(toolsTestStart))
+	require.True(t, stats.To.Equal(toolsTestStart.Add(3*time.Second)))
+	require.Len(t, stats.Streams, 2)
+	require.Equal(t, model.LabelSet{"app": "foo"}, stats.Streams[0].Labels)
+	require.Equal(t, 3, stats.Streams[0].Entries)
+
+	found, err := FindStreams(dir, `{app="bar"}`)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, 1, found[0].Entries)
+}
+
+func TestReplay(t *testing.T) {
+	dir := setupToolsWAL(t)
+	streams, err := ReadStreams(dir, "{}", time.Time{}, time.Time{})
+	require.NoError(t, err)
+
+	var (
+		mut      sync.Mutex
+		received = make(map[string][]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		buf, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		var req logproto.PushRequest
+		require.NoError(t, req.Unmarshal(buf))
+
+		tenant := r.Header.Get("X-Scope-OrgID")
+		mut.Lock()
+		defer mut.Unlock()
+		for _, s := range req.Streams {
+			for _, e := range s.Entries {
+				received[tenant] = append(received[tenant], s.Labels+" "+e.Line)
+			}
+		}
+		if tenant == "" {
+			http.Error(w, "no org id", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	opts := ReplayOptions{
+		URL:         srv.URL,
+		TenantID:    "default",
+		Concurrency: 2,
+		BatchSize:   2,
+		Timeout:     time.Second,
+	}
+	stats, err := Replay(context.Background(), streams, opts)
+	require.NoError(t, err)
+	require.Equal(t, ReplayStats{Streams: 2, Entries: 4, Requests: 3}, stats)
+	require.Equal(t, map[string][]string{
+		"t1":      {`{app="bar"} bar 1`},
+		"default": {`{app="foo"} foo 0`, `{app="foo"} foo 2`, `{app="foo"} foo 3`},
+	}, received)
+
+	// Rejected requests are reported without aborting the replay.
+	opts.TenantID = ""
+	stats, err = Replay(context.Background(), streams[1:], opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.FailedRequests)
+	require.Equal(t, 3, stats.FailedEntries)
+	require.ErrorContains(t, stats.LastError, "no org id")
+}
@@ -113,3 +113,24 @@ type DebugComponent interface {
 	// DebugInfo must be safe for calling concurrently.
 	DebugInfo() interface{}
 }
+
+// Drainer is an extension interface for components which hold in-flight data
+// that would be lost if the component exited immediately, such as buffered
+// batches which are not yet sent.
+//
+// When the component controller shuts down, components are stopped in
+// reverse dependency order: components which send data to other components
+// are stopped before the components they send data to. Before a component is
+// stopped, Drain is called to flush its in-flight data to downstream
+// components or external systems, which are still running.
+type Drainer interface {
+	Component
+
+	// Drain flushes the in-flight data of the component, blocking until all
+	// data has been flushed or ctx is canceled. Drain is called while Run is
+	// still running, and Run is canceled once Drain returns.
+	//
+	// Data received after Drain returns may be dropped. Drain must return
+	// ctx.Err() if ctx is canceled before all data was flushed.
+	Drain(ctx context.Context) error
+}
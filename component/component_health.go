@@ -59,6 +59,10 @@ const (
 
 	// HealthTypeExited represents a component which has stopped running.
 	HealthTypeExited
+
+	// HealthTypeStandby represents a component which is idle because another
+	// agent in the cluster is running it.
+	HealthTypeStandby
 )
 
 // String returns the string representation of ht.
@@ -70,6 +74,8 @@ func (ht HealthType) String() string {
 		return "unhealthy"
 	case HealthTypeExited:
 		return "exited"
+	case HealthTypeStandby:
+		return "standby"
 	default:
 		return "unknown"
 	}
@@ -91,6 +97,8 @@ func (ht *HealthType) UnmarshalText(text []byte) error {
 		*ht = HealthTypeUnknown
 	case "exited":
 		*ht = HealthTypeExited
+	case "standby":
+		*ht = HealthTypeStandby
 	default:
 		return fmt.Errorf("invalid health type %q", string(text))
 	}
@@ -101,7 +109,8 @@ func (ht *HealthType) UnmarshalText(text []byte) error {
 // considered to be the least healthy.
 //
 // Health types are first prioritized by [HealthTypeExited], followed by
-// [HealthTypeUnhealthy], [HealthTypeUnknown], and [HealthTypeHealthy].
+// [HealthTypeUnhealthy], [HealthTypeUnknown], [HealthTypeStandby], and
+// [HealthTypeHealthy].
 //
 // If multiple arguments have the same Health type, the Health with the most
 // recent timestamp is returned.
@@ -135,7 +144,8 @@ func LeastHealthy(h Health, hh ...Health) Health {
 // healthy."
 var healthPriority = [...]int{
 	HealthTypeHealthy:   0,
-	HealthTypeUnknown:   1,
-	HealthTypeUnhealthy: 2,
-	HealthTypeExited:    3,
+	HealthTypeStandby:   1,
+	HealthTypeUnknown:   2,
+	HealthTypeUnhealthy: 3,
+	HealthTypeExited:    4,
 }
@@ -62,6 +62,28 @@ func TestMergeHealth(t *testing.T) {
 			}},
 			expectIndex: 1,
 		},
+		{
+			name: "standby > healthy",
+			healths: []component.Health{{
+				Health:     component.HealthTypeHealthy,
+				UpdateTime: jan1,
+			}, {
+				Health:     component.HealthTypeStandby,
+				UpdateTime: jan1,
+			}},
+			expectIndex: 1,
+		},
+		{
+			name: "unknown > standby",
+			healths: []component.Health{{
+				Health:     component.HealthTypeUnknown,
+				UpdateTime: jan1,
+			}, {
+				Health:     component.HealthTypeStandby,
+				UpdateTime: jan1,
+			}},
+			expectIndex: 0,
+		},
 		{
 			name: "newer timestamp",
 			healths: []component.Health{{
@@ -63,6 +63,7 @@ type InfoOptions struct {
 	GetArguments bool // When true, sets the Arguments field of returned components.
 	GetExports   bool // When true, sets the Exports field of returned components.
 	GetDebugInfo bool // When true, sets the DebugInfo field of returned components.
+	GetStats     bool // When true, sets the Stats field of returned components.
 }
 
 // String returns the "<ModuleID>/<LocalID>" string representation of the id.
@@ -99,6 +100,27 @@ type Info struct {
 	Arguments Arguments   // Current arguments value of the component.
 	Exports   Exports     // Current exports value of the component.
 	DebugInfo interface{} // Current debug info of the component.
+	Stats     *Stats      // Current resource usage of the component.
+}
+
+// Stats holds resource usage statistics of a running component.
+//
+// Allocated bytes aren't part of Stats: the Go runtime doesn't record
+// profiler labels in heap profiles, so allocations can't be attributed to
+// components.
+type Stats struct {
+	// Goroutines is the number of goroutines started on behalf of the
+	// component, identified by their profiler labels. The count is sampled
+	// periodically and may be slightly out of date.
+	Goroutines int
+
+	// ItemsReceived is the number of items received through the receivers
+	// exported by the component.
+	ItemsReceived uint64
+
+	// ItemsSent is the number of items the component sent to the receivers
+	// in its arguments.
+	ItemsSent uint64
 }
 
 // MarshalJSON returns a JSON representation of cd. The format of the
@@ -111,6 +133,12 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 			UpdatedTime time.Time `json:"updatedTime"`
 		}
 
+		componentStatsJSON struct {
+			Goroutines    int    `json:"goroutines"`
+			ItemsReceived uint64 `json:"itemsReceived"`
+			ItemsSent     uint64 `json:"itemsSent"`
+		}
+
 		componentDetailJSON struct {
 			Name             string               `json:"name"`
 			Type             string               `json:"type,omitempty"`
@@ -124,6 +152,7 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 			Arguments        json.RawMessage      `json:"arguments,omitempty"`
 			Exports          json.RawMessage      `json:"exports,omitempty"`
 			DebugInfo        json.RawMessage      `json:"debugInfo,omitempty"`
+			Stats            *componentStatsJSON  `json:"stats,omitempty"`
 			CreatedModuleIDs []string             `json:"createdModuleIDs,omitempty"`
 		}
 	)
@@ -133,6 +162,7 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 		referencedBy = info.ReferencedBy
 
 		arguments, exports, debugInfo json.RawMessage
+		stats                         *componentStatsJSON
 		err                           error
 	)
 
@@ -156,6 +186,14 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	if info.Stats != nil {
+		stats = &componentStatsJSON{
+			Goroutines:    info.Stats.Goroutines,
+			ItemsReceived: info.Stats.ItemsReceived,
+			ItemsSent:     info.Stats.ItemsSent,
+		}
+	}
+
 	return json.Marshal(&componentDetailJSON{
 		Name:         info.Registration.Name,
 		Type:         "block",
@@ -172,6 +210,7 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 		Arguments:        arguments,
 		Exports:          exports,
 		DebugInfo:        debugInfo,
+		Stats:            stats,
 		CreatedModuleIDs: info.ModuleIDs,
 	})
 }
@@ -9,7 +9,7 @@ import (
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/service/cluster"
-	"github.com/grafana/ckit/shard"
+	"github.com/grafana/ckit/peer"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
@@ -23,15 +23,15 @@ type Target map[string]string
 // DistributedTargets uses the node's Lookup method to distribute discovery
 // targets when a Flow component runs in a cluster.
 type DistributedTargets struct {
-	useClustering bool
-	cluster       cluster.Cluster
-	targets       []Target
+	clustering cluster.ComponentBlock
+	cluster    cluster.Cluster
+	targets    []Target
 }
 
 // NewDistributedTargets creates the abstraction that allows components to
 // dynamically shard targets between components.
-func NewDistributedTargets(e bool, n cluster.Cluster, t []Target) DistributedTargets {
-	return DistributedTargets{e, n, t}
+func NewDistributedTargets(c cluster.ComponentBlock, n cluster.Cluster, t []Target) DistributedTargets {
+	return DistributedTargets{c, n, t}
 }
 
 // Get distributes discovery targets a clustered environment.
@@ -39,28 +39,37 @@ func NewDistributedTargets(e bool, n cluster.Cluster, t []Target) DistributedTar
 // If a cluster size is 1, then all targets will be returned.
 func (t *DistributedTargets) Get() []Target {
 	// TODO(@tpaschalis): Make this into a single code-path to simplify logic.
-	if !t.useClustering || t.cluster == nil {
+	if !t.clustering.Enabled || t.cluster == nil {
 		return t.targets
 	}
 
 	res := make([]Target, 0, (len(t.targets)+1)/len(t.cluster.Peers()))
 
 	for _, tgt := range t.targets {
-		peers, err := t.cluster.Lookup(shard.StringKey(tgt.NonMetaLabels().String()), 1, shard.OpReadWrite)
+		peers, err := t.Owners(tgt)
 		if err != nil {
 			// This can only fail in case we ask for more owners than the
 			// available peers. This will never happen, but in any case we fall
 			// back to owning the target ourselves.
 			res = append(res, tgt)
+			continue
 		}
-		if peers[0].Self {
-			res = append(res, tgt)
+		for _, p := range peers {
+			if p.Self {
+				res = append(res, tgt)
+				break
+			}
 		}
 	}
 
 	return res
 }
 
+// Owners returns the peers owning tgt.
+func (t *DistributedTargets) Owners(tgt Target) ([]peer.Peer, error) {
+	return t.clustering.Owners(t.cluster, tgt.ShardKey())
+}
+
 // Labels converts Target into a set of sorted labels.
 func (t Target) Labels() labels.Labels {
 	var lset labels.Labels
@@ -71,6 +80,12 @@ func (t Target) Labels() labels.Labels {
 	return lset
 }
 
+// ShardKey returns the key used to distribute t between the peers of a
+// cluster.
+func (t Target) ShardKey() string {
+	return t.NonMetaLabels().String()
+}
+
 func (t Target) NonMetaLabels() labels.Labels {
 	var lset labels.Labels
 	for k, v := range t {
@@ -0,0 +1,247 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:    "loki.archive",
+		Args:    Arguments{},
+		Exports: Exports{},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+	_ component.Drainer   = (*Component)(nil)
+)
+
+// rotateInterval is the interval at which batches are checked for their age
+// and flushed to disk.
+var rotateInterval = time.Second
+
+// Component implements the loki.archive component.
+type Component struct {
+	opts     component.Options
+	metrics  *metrics
+	receiver loki.LogsReceiver
+
+	mut      sync.RWMutex
+	args     Arguments
+	storage  storage
+	archiver *archiver
+}
+
+// New creates a new loki.archive component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	m, err := newMetrics(o.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := newArchiver(o.Logger, m, o.DataPath)
+	if err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	c := &Component{
+		opts:     o,
+		metrics:  m,
+		receiver: loki.NewLogsReceiver(),
+		archiver: a,
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	if err := a.recover(); err != nil {
+		return nil, err
+	}
+
+	// Export the receiver which remains the same for the component's
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+
+		// The remaining batches are uploaded on the next start.
+		c.mut.Lock()
+		defer c.mut.Unlock()
+		if err := c.archiver.finalizeAll(); err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to finalize batches", "err", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.uploadLoop(ctx)
+	}()
+
+	ticker := time.NewTicker(rotateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.receiver.Chan():
+			c.mut.Lock()
+			if err := c.archiver.append(entry, time.Now()); err != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to write entry to batch", "err", err)
+				c.metrics.droppedEntries.Inc()
+			}
+			c.mut.Unlock()
+		case <-ticker.C:
+			c.mut.Lock()
+			if err := c.archiver.rotate(time.Now()); err != nil {
+				level.Error(c.opts.Logger).Log("msg", "failed to rotate batches", "err", err)
+			}
+			c.mut.Unlock()
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	s, err := newStorage(newArgs)
+	if err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.args = newArgs
+	c.storage = s
+
+	// Wake up the upload loop, which may be waiting to retry with the
+	// previous storage.
+	select {
+	case c.archiver.notify <- struct{}{}:
+	default:
+	}
+
+	return c.archiver.configure(newArgs)
+}
+
+// Drain implements component.Drainer. It finalizes the batches and waits for
+// all the objects to be uploaded.
+func (c *Component) Drain(ctx context.Context) error {
+	c.mut.Lock()
+	err := c.archiver.finalizeAll()
+	c.mut.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		objects, err := c.archiver.queued()
+		if err != nil {
+			return err
+		} else if len(objects) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// uploadLoop uploads the queued objects until ctx is canceled.
+func (c *Component) uploadLoop(ctx context.Context) {
+	for {
+		c.uploadQueue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.archiver.notify:
+		}
+	}
+}
+
+// uploadQueue uploads the queued objects, oldest first, until the queue is
+// empty or ctx is canceled. Failed uploads are retried with a backoff.
+func (c *Component) uploadQueue(ctx context.Context) {
+	c.mut.RLock()
+	bo := backoff.New(ctx, backoff.Config{
+		MinBackoff: c.args.MinBackoff,
+		MaxBackoff: c.args.MaxBackoff,
+	})
+	c.mut.RUnlock()
+
+	for ctx.Err() == nil {
+		objects, err := c.archiver.queued()
+		if err != nil {
+			level.Error(c.opts.Logger).Log("msg", "failed to list queued objects", "err", err)
+			bo.Wait()
+			continue
+		}
+
+		var size int64
+		for _, o := range objects {
+			size += o.size
+		}
+		c.metrics.queueLength.Set(float64(len(objects)))
+		c.metrics.queueBytes.Set(float64(size))
+		if len(objects) == 0 {
+			return
+		}
+
+		c.mut.RLock()
+		s := c.storage
+		c.mut.RUnlock()
+
+		for _, o := range objects {
+			if err := c.upload(ctx, s, o); err != nil {
+				level.Warn(c.opts.Logger).Log("msg", "failed to upload object, retrying", "key", o.key, "err", err, "num_retries", bo.NumRetries())
+				c.metrics.uploadFailures.Inc()
+				bo.Wait()
+				break
+			}
+			bo.Reset()
+		}
+	}
+}
+
+func (c *Component) upload(ctx context.Context, s storage, o queuedObject) error {
+	if err := s.upload(ctx, o.key, o.filename); err != nil {
+		return err
+	}
+	if err := os.Remove(o.filename); err != nil {
+		return err
+	}
+
+	level.Debug(c.opts.Logger).Log("msg", "uploaded object", "key", o.key, "size", o.size)
+	c.metrics.uploads.Inc()
+	c.metrics.uploadedBytes.Add(float64(o.size))
+	c.metrics.lastUploadTime.SetToCurrentTime()
+	return nil
+}
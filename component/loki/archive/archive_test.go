@@ -0,0 +1,332 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/remote/s3"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/river"
+	"github.com/grafana/river/rivertypes"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+var entryTime = time.Date(2023, time.November, 20, 10, 30, 0, 0, time.UTC)
+
+func newEntry(job, line string) loki.Entry {
+	return loki.Entry{
+		Labels: model.LabelSet{"job": model.LabelValue(job)},
+		Entry:  logproto.Entry{Timestamp: entryTime, Line: line},
+	}
+}
+
+func newComponent(t *testing.T, dataPath string, args Arguments) (*Component, func()) {
+	t.Helper()
+
+	c, err := New(component.Options{
+		ID:            "loki.archive.test",
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		DataPath:      dataPath,
+		OnStateChange: func(component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	return c, func() {
+		cancel()
+		<-done
+	}
+}
+
+func readRecords(t *testing.T, r io.Reader, compression string) []record {
+	t.Helper()
+
+	var dr io.Reader
+	switch compression {
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		dr = zr
+	default:
+		gr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		defer gr.Close()
+		dr = gr
+	}
+
+	var records []record
+	scanner := bufio.NewScanner(dr)
+	for scanner.Scan() {
+		var rec record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+// listObjects returns the keys of the objects in dir.
+func listObjects(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var keys []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		keys = append(keys, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(t, err)
+	sort.Strings(keys)
+	return keys
+}
+
+func TestLocal(t *testing.T) {
+	defer func(interval time.Duration) { rotateInterval = interval }(rotateInterval)
+	rotateInterval = 10 * time.Millisecond
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			args := DefaultArguments
+			args.Compression = compression
+			args.PartitionBy = []string{"job"}
+			args.MaxObjectAge = 50 * time.Millisecond
+			args.Local = &LocalArguments{Directory: dir}
+
+			c, stop := newComponent(t, t.TempDir(), args)
+			defer stop()
+
+			c.receiver.Chan() <- newEntry("app", "first")
+			c.receiver.Chan() <- newEntry("app", "second")
+			e := newEntry("db/primary", "third")
+			e.StructuredMetadata = []logproto.LabelAdapter{{Name: "trace_id", Value: "abc"}}
+			c.receiver.Chan() <- e
+
+			require.Eventually(t, func() bool {
+				return len(listObjects(t, dir)) == 2
+			}, 5*time.Second, 10*time.Millisecond)
+
+			ext := ".ndjson" + compressionExtension(compression)
+			keys := listObjects(t, dir)
+			require.True(t, strings.HasPrefix(keys[0], "job=app/year=2023/month=11/day=20/hour=10/"), keys[0])
+			require.True(t, strings.HasSuffix(keys[0], ext), keys[0])
+			require.True(t, strings.HasPrefix(keys[1], "job=db%2Fprimary/year=2023/month=11/day=20/hour=10/"), keys[1])
+
+			f, err := os.Open(filepath.Join(dir, keys[0]))
+			require.NoError(t, err)
+			defer f.Close()
+			require.Equal(t, []record{
+				{Timestamp: entryTime, Labels: model.LabelSet{"job": "app"}, Line: "first"},
+				{Timestamp: entryTime, Labels: model.LabelSet{"job": "app"}, Line: "second"},
+			}, readRecords(t, f, compression))
+
+			f2, err := os.Open(filepath.Join(dir, keys[1]))
+			require.NoError(t, err)
+			defer f2.Close()
+			require.Equal(t, []record{
+				{Timestamp: entryTime, Labels: model.LabelSet{"job": "db/primary"}, Line: "third", StructuredMetadata: map[string]string{"trace_id": "abc"}},
+			}, readRecords(t, f2, compression))
+		})
+	}
+}
+
+func TestMaxObjectSize(t *testing.T) {
+	dir := t.TempDir()
+	args := DefaultArguments
+	args.MaxObjectSize = 1
+	args.Local = &LocalArguments{Directory: dir}
+
+	c, stop := newComponent(t, t.TempDir(), args)
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		c.receiver.Chan() <- newEntry("app", "line")
+	}
+	require.Eventually(t, func() bool {
+		return len(listObjects(t, dir)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// fakeS3 is an S3-compatible server storing the objects put in a bucket. It
+// fails requests while failing is set.
+type fakeS3 struct {
+	failing atomic.Bool
+
+	mut     sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.failing.Load() {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	bb, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.objects[r.URL.Path] = bb
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func (s *fakeS3) keys() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var keys []string
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	fake.failing.Store(true)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	args := DefaultArguments
+	args.MinBackoff = 10 * time.Millisecond
+	args.MaxBackoff = 10 * time.Millisecond
+	args.S3 = &S3Arguments{
+		Bucket: "logs",
+		Prefix: "archive",
+		Client: s3.Client{
+			AccessKey:    "key",
+			Secret:       rivertypes.Secret("secret"),
+			Endpoint:     srv.URL,
+			UsePathStyle: true,
+			Region:       "us-east-1",
+		},
+	}
+
+	c, stop := newComponent(t, t.TempDir(), args)
+	defer stop()
+
+	c.receiver.Chan() <- newEntry("app", "first")
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(c.metrics.entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Objects stay in the queue while uploads fail.
+	drainCtx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Drain(drainCtx), context.DeadlineExceeded)
+	objects, err := c.archiver.queued()
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+
+	fake.failing.Store(false)
+	require.NoError(t, c.Drain(context.Background()))
+
+	keys := fake.keys()
+	require.Len(t, keys, 1)
+	require.True(t, strings.HasPrefix(keys[0], "/logs/archive/year=2023/month=11/day=20/hour=10/"), keys[0])
+
+	fake.mut.Lock()
+	records := readRecords(t, strings.NewReader(string(fake.objects[keys[0]])), CompressionGzip)
+	fake.mut.Unlock()
+	require.Equal(t, []record{
+		{Timestamp: entryTime, Labels: model.LabelSet{"job": "app"}, Line: "first"},
+	}, records)
+}
+
+func TestRecover(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		dataPath = t.TempDir()
+		args     = DefaultArguments
+	)
+	args.Local = &LocalArguments{Directory: dir}
+
+	// A crash left over a batch with an incomplete line.
+	require.NoError(t, os.MkdirAll(filepath.Join(dataPath, batchesDir), 0o750))
+	rec, err := json.Marshal(record{Timestamp: entryTime, Labels: model.LabelSet{"job": "app"}, Line: "first"})
+	require.NoError(t, err)
+	batch := string(rec) + "\n" + `{"timestamp":"2023-11`
+	require.NoError(t, os.WriteFile(filepath.Join(dataPath, batchesDir, "year=2023%2Fhour=10%2F1-1.ndjson"), []byte(batch), 0o600))
+
+	c, stop := newComponent(t, dataPath, args)
+	defer stop()
+	require.NoError(t, c.Drain(context.Background()))
+
+	require.Equal(t, []string{"year=2023/hour=10/1-1.ndjson.gz"}, listObjects(t, dir))
+	f, err := os.Open(filepath.Join(dir, "year=2023/hour=10/1-1.ndjson.gz"))
+	require.NoError(t, err)
+	defer f.Close()
+	require.Equal(t, []record{
+		{Timestamp: entryTime, Labels: model.LabelSet{"job": "app"}, Line: "first"},
+	}, readRecords(t, f, CompressionGzip))
+}
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		compression     = "zstd"
+		partition_by    = ["namespace"]
+		max_object_size = "1MiB"
+
+		s3 {
+			bucket = "logs"
+		}
+	`), &args))
+	require.Equal(t, CompressionZstd, args.Compression)
+	require.EqualValues(t, 1<<20, args.MaxObjectSize)
+	require.Equal(t, DefaultArguments.MaxObjectAge, args.MaxObjectAge)
+
+	for cfg, expectErr := range map[string]string{
+		``: "one of the local or s3 blocks must be set",
+		`local { directory = "/tmp" }
+		 s3 { bucket = "logs" }`: "only one of the local or s3 blocks can be set",
+		`compression = "lz4"
+		 local { directory = "/tmp" }`: `compression must be "gzip" or "zstd"`,
+		`partition_by = ["not-valid"]
+		 local { directory = "/tmp" }`: "invalid partition_by label name",
+		`max_object_age = "0s"
+		 local { directory = "/tmp" }`: "max_object_age must be greater than 0",
+	} {
+		require.ErrorContains(t, river.Unmarshal([]byte(cfg), &args), expectErr)
+	}
+}
@@ -0,0 +1,401 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	batchesDir     = "batches"
+	queueDir       = "queue"
+	batchExtension = ".ndjson"
+	tmpExtension   = ".tmp"
+)
+
+// record is the JSON representation of an entry in objects.
+type record struct {
+	Timestamp          time.Time         `json:"timestamp"`
+	Labels             model.LabelSet    `json:"labels"`
+	Line               string            `json:"line"`
+	StructuredMetadata map[string]string `json:"structured_metadata,omitempty"`
+}
+
+// batch is an uncompressed object being written. Batches are written to disk
+// uncompressed so that they can be recovered after a crash.
+type batch struct {
+	key     string
+	file    *os.File
+	w       *bufio.Writer
+	size    int64
+	created time.Time
+}
+
+// queuedObject is a compressed object waiting to be uploaded.
+type queuedObject struct {
+	key      string
+	filename string
+	size     int64
+}
+
+// archiver writes entries to batches, which are compressed and queued for
+// upload once they're rotated.
+type archiver struct {
+	logger  log.Logger
+	metrics *metrics
+	dir     string
+	// notify is signaled when objects are queued.
+	notify chan struct{}
+
+	compression string
+	partitionBy []string
+	maxSize     int64
+	maxAge      time.Duration
+
+	// batches are indexed by the prefix of their keys.
+	batches map[string]*batch
+	seq     uint64
+}
+
+func newArchiver(logger log.Logger, metrics *metrics, dir string) (*archiver, error) {
+	for _, d := range []string{batchesDir, queueDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o750); err != nil {
+			return nil, err
+		}
+	}
+
+	return &archiver{
+		logger:  logger,
+		metrics: metrics,
+		dir:     dir,
+		notify:  make(chan struct{}, 1),
+		batches: make(map[string]*batch),
+	}, nil
+}
+
+// configure sets the arguments of the archiver. Batches are finalized if the
+// compression or the partitioning changed.
+func (a *archiver) configure(args Arguments) error {
+	var err error
+	if a.compression != args.Compression || !equalStrings(a.partitionBy, args.PartitionBy) {
+		err = a.finalizeAll()
+	}
+
+	a.compression = args.Compression
+	a.partitionBy = args.PartitionBy
+	a.maxSize = int64(args.MaxObjectSize)
+	a.maxAge = args.MaxObjectAge
+	return err
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keyPrefix returns the prefix of the keys of the objects entry is written
+// to. Objects are partitioned by the partition_by labels, and by the hour of
+// entries.
+func (a *archiver) keyPrefix(entry loki.Entry) string {
+	parts := make([]string, 0, len(a.partitionBy)+4)
+	for _, name := range a.partitionBy {
+		value := string(entry.Labels[model.LabelName(name)])
+		parts = append(parts, name+"="+url.PathEscape(value))
+	}
+
+	ts := entry.Timestamp.UTC()
+	parts = append(parts,
+		fmt.Sprintf("year=%04d", ts.Year()),
+		fmt.Sprintf("month=%02d", ts.Month()),
+		fmt.Sprintf("day=%02d", ts.Day()),
+		fmt.Sprintf("hour=%02d", ts.Hour()),
+	)
+	return path.Join(parts...)
+}
+
+// append writes entry to its batch, which is finalized once it reaches the
+// maximum size.
+func (a *archiver) append(entry loki.Entry, now time.Time) error {
+	prefix := a.keyPrefix(entry)
+	b, ok := a.batches[prefix]
+	if !ok {
+		var err error
+		if b, err = a.open(prefix, now); err != nil {
+			return err
+		}
+		a.batches[prefix] = b
+		a.metrics.openBatches.Set(float64(len(a.batches)))
+	}
+
+	rec := record{
+		Timestamp: entry.Timestamp,
+		Labels:    entry.Labels,
+		Line:      entry.Line,
+	}
+	if len(entry.StructuredMetadata) > 0 {
+		rec.StructuredMetadata = make(map[string]string, len(entry.StructuredMetadata))
+		for _, l := range entry.StructuredMetadata {
+			rec.StructuredMetadata[l.Name] = l.Value
+		}
+	}
+	bb, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	bb = append(bb, '\n')
+
+	n, err := b.w.Write(bb)
+	b.size += int64(n)
+	if err != nil {
+		return err
+	}
+	a.metrics.entries.Inc()
+
+	if b.size >= a.maxSize {
+		return a.finalize(prefix)
+	}
+	return nil
+}
+
+func (a *archiver) open(prefix string, now time.Time) (*batch, error) {
+	a.seq++
+	key := path.Join(prefix, fmt.Sprintf("%d-%d", now.UnixMilli(), a.seq))
+
+	f, err := os.Create(a.batchFilename(key))
+	if err != nil {
+		return nil, fmt.Errorf("creating batch: %w", err)
+	}
+	return &batch{
+		key:     key,
+		file:    f,
+		w:       bufio.NewWriter(f),
+		created: now,
+	}, nil
+}
+
+func (a *archiver) batchFilename(key string) string {
+	return filepath.Join(a.dir, batchesDir, url.PathEscape(key)+batchExtension)
+}
+
+// rotate finalizes the batches older than the maximum age, and flushes the
+// others to disk.
+func (a *archiver) rotate(now time.Time) error {
+	var firstErr error
+	for prefix, b := range a.batches {
+		var err error
+		if now.Sub(b.created) >= a.maxAge {
+			err = a.finalize(prefix)
+		} else {
+			err = b.w.Flush()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// finalizeAll finalizes all the batches.
+func (a *archiver) finalizeAll() error {
+	var firstErr error
+	for prefix := range a.batches {
+		if err := a.finalize(prefix); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// finalize closes the batch with the given prefix and queues it for upload.
+func (a *archiver) finalize(prefix string) error {
+	b := a.batches[prefix]
+	delete(a.batches, prefix)
+	a.metrics.openBatches.Set(float64(len(a.batches)))
+
+	err := b.w.Flush()
+	if closeErr := b.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("closing batch %s: %w", b.key, err)
+	}
+	return a.queue(b.key, b.file.Name())
+}
+
+// queue compresses the batch file into the queue, and removes it.
+func (a *archiver) queue(key, batchFilename string) error {
+	src, err := os.Open(batchFilename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	key += batchExtension + compressionExtension(a.compression)
+	dst := filepath.Join(a.dir, queueDir, url.PathEscape(key))
+	if err := compressFile(dst+tmpExtension, src, a.compression); err != nil {
+		return fmt.Errorf("compressing batch %s: %w", key, err)
+	}
+	if err := os.Rename(dst+tmpExtension, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(batchFilename); err != nil {
+		return err
+	}
+
+	a.metrics.objects.Inc()
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func compressionExtension(compression string) string {
+	if compression == CompressionZstd {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+func compressFile(filename string, src io.Reader, compression string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.WriteCloser
+	switch compression {
+	case CompressionZstd:
+		if w, err = zstd.NewWriter(f); err != nil {
+			return err
+		}
+	default:
+		w = gzip.NewWriter(f)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// recover queues the batches left over by a previous run. Their last line is
+// dropped if it's incomplete.
+func (a *archiver) recover() error {
+	// Objects which weren't fully compressed are compressed again from their
+	// batch.
+	tmpFiles, err := filepath.Glob(filepath.Join(a.dir, queueDir, "*"+tmpExtension))
+	if err != nil {
+		return err
+	}
+	for _, f := range tmpFiles {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(a.dir, batchesDir))
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), batchExtension) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(e.Name(), batchExtension))
+		if err != nil {
+			level.Warn(a.logger).Log("msg", "ignoring invalid batch file", "file", e.Name(), "err", err)
+			continue
+		}
+
+		filename := filepath.Join(a.dir, batchesDir, e.Name())
+		if err := truncateIncompleteLine(filename); err != nil {
+			return fmt.Errorf("recovering batch %s: %w", key, err)
+		}
+		if err := a.queue(key, filename); err != nil {
+			return fmt.Errorf("recovering batch %s: %w", key, err)
+		}
+		level.Info(a.logger).Log("msg", "recovered batch", "key", key)
+	}
+	return nil
+}
+
+func truncateIncompleteLine(filename string) error {
+	bb, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if len(bb) == 0 || bb[len(bb)-1] == '\n' {
+		return nil
+	}
+	return os.Truncate(filename, int64(bytes.LastIndexByte(bb, '\n')+1))
+}
+
+// queued returns the objects waiting to be uploaded, oldest first.
+func (a *archiver) queued() ([]queuedObject, error) {
+	entries, err := os.ReadDir(filepath.Join(a.dir, queueDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		objects  []queuedObject
+		modTimes = make(map[string]time.Time, len(entries))
+	)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), tmpExtension) {
+			continue
+		}
+		key, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		objects = append(objects, queuedObject{
+			key:      key,
+			filename: filepath.Join(a.dir, queueDir, e.Name()),
+			size:     fi.Size(),
+		})
+		modTimes[key] = fi.ModTime()
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return modTimes[objects[i].key].Before(modTimes[objects[j].key])
+	})
+	return objects, nil
+}
@@ -0,0 +1,79 @@
+package archive
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type metrics struct {
+	entries        prometheus.Counter
+	droppedEntries prometheus.Counter
+	openBatches    prometheus.Gauge
+	objects        prometheus.Counter
+	uploads        prometheus.Counter
+	uploadedBytes  prometheus.Counter
+	uploadFailures prometheus.Counter
+	queueLength    prometheus.Gauge
+	queueBytes     prometheus.Gauge
+	lastUploadTime prometheus.Gauge
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	var m metrics
+
+	m.entries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_entries_total",
+		Help: "Total number of entries written to batches.",
+	})
+	m.droppedEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_dropped_entries_total",
+		Help: "Total number of entries dropped because they couldn't be written to batches.",
+	})
+	m.openBatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_archive_open_batches",
+		Help: "Number of batches being written.",
+	})
+	m.objects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_objects_total",
+		Help: "Total number of objects compressed and queued for upload.",
+	})
+	m.uploads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_uploads_total",
+		Help: "Total number of objects uploaded to the storage.",
+	})
+	m.uploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_uploaded_bytes_total",
+		Help: "Total number of compressed bytes uploaded to the storage.",
+	})
+	m.uploadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_archive_upload_failures_total",
+		Help: "Total number of failed uploads, which are retried.",
+	})
+	m.queueLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_archive_queue_length",
+		Help: "Number of objects waiting to be uploaded.",
+	})
+	m.queueBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_archive_queue_bytes",
+		Help: "Size in bytes of the objects waiting to be uploaded.",
+	})
+	m.lastUploadTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loki_archive_last_upload_timestamp_seconds",
+		Help: "Timestamp of the last successful upload.",
+	})
+
+	for _, c := range []prometheus.Collector{
+		m.entries,
+		m.droppedEntries,
+		m.openBatches,
+		m.objects,
+		m.uploads,
+		m.uploadedBytes,
+		m.uploadFailures,
+		m.queueLength,
+		m.queueBytes,
+		m.lastUploadTime,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
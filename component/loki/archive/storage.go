@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_s3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/grafana/agent/component/remote/s3"
+)
+
+// storage is where objects are uploaded.
+type storage interface {
+	// upload uploads the file at filename as the object with the given key.
+	upload(ctx context.Context, key string, filename string) error
+}
+
+// newStorage creates the storage configured in args.
+func newStorage(args Arguments) (storage, error) {
+	if args.S3 != nil {
+		client, err := s3.NewS3Client(args.S3.Client)
+		if err != nil {
+			return nil, fmt.Errorf("creating s3 client: %w", err)
+		}
+		return &s3Storage{client: client, bucket: args.S3.Bucket, prefix: args.S3.Prefix}, nil
+	}
+	return &localStorage{dir: args.Local.Directory}, nil
+}
+
+// localStorage stores objects in a local directory.
+type localStorage struct {
+	dir string
+}
+
+func (s *localStorage) upload(_ context.Context, key string, filename string) error {
+	dst := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Objects are copied to a temporary file first, so that readers of the
+	// directory never see partial objects.
+	tmp := dst + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// s3Storage stores objects in an S3-compatible bucket.
+type s3Storage struct {
+	client *aws_s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Storage) upload(ctx context.Context, key string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, &aws_s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(path.Join(s.prefix, key)),
+		Body:          f,
+		ContentLength: fi.Size(),
+		ContentType:   aws.String("application/x-ndjson"),
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/remote/s3"
+	"github.com/prometheus/common/model"
+)
+
+// Compression formats of objects.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Arguments holds values which are used to configure the loki.archive
+// component.
+type Arguments struct {
+	Compression   string           `river:"compression,attr,optional"`
+	PartitionBy   []string         `river:"partition_by,attr,optional"`
+	MaxObjectSize units.Base2Bytes `river:"max_object_size,attr,optional"`
+	MaxObjectAge  time.Duration    `river:"max_object_age,attr,optional"`
+	MinBackoff    time.Duration    `river:"min_backoff_period,attr,optional"`
+	MaxBackoff    time.Duration    `river:"max_backoff_period,attr,optional"`
+
+	Local *LocalArguments `river:"local,block,optional"`
+	S3    *S3Arguments    `river:"s3,block,optional"`
+}
+
+// LocalArguments configures the storage of objects in a local directory.
+type LocalArguments struct {
+	Directory string `river:"directory,attr"`
+}
+
+// S3Arguments configures the storage of objects in an S3-compatible bucket.
+type S3Arguments struct {
+	Bucket string    `river:"bucket,attr"`
+	Prefix string    `river:"prefix,attr,optional"`
+	Client s3.Client `river:"client,block,optional"`
+}
+
+// DefaultArguments provides the default arguments for the loki.archive
+// component.
+var DefaultArguments = Arguments{
+	Compression:   CompressionGzip,
+	MaxObjectSize: 64 * units.MiB,
+	MaxObjectAge:  15 * time.Minute,
+	MinBackoff:    500 * time.Millisecond,
+	MaxBackoff:    5 * time.Minute,
+}
+
+// SetToDefault implements river.Defaulter.
+func (a *Arguments) SetToDefault() {
+	*a = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	switch a.Compression {
+	case CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("compression must be %q or %q, got %q", CompressionGzip, CompressionZstd, a.Compression)
+	}
+
+	for _, name := range a.PartitionBy {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid partition_by label name %q", name)
+		}
+	}
+
+	switch {
+	case a.MaxObjectSize <= 0:
+		return fmt.Errorf("max_object_size must be greater than 0")
+	case a.MaxObjectAge <= 0:
+		return fmt.Errorf("max_object_age must be greater than 0")
+	case a.MinBackoff <= 0 || a.MaxBackoff < a.MinBackoff:
+		return fmt.Errorf("min_backoff_period must be greater than 0 and lower than max_backoff_period")
+	}
+
+	switch {
+	case a.Local == nil && a.S3 == nil:
+		return fmt.Errorf("one of the local or s3 blocks must be set")
+	case a.Local != nil && a.S3 != nil:
+		return fmt.Errorf("only one of the local or s3 blocks can be set")
+	case a.Local != nil && a.Local.Directory == "":
+		return fmt.Errorf("local directory must not be empty")
+	case a.S3 != nil && a.S3.Bucket == "":
+		return fmt.Errorf("s3 bucket must not be empty")
+	}
+	return nil
+}
+
+// Exports holds the receiver that is used to send log entries to the
+// loki.archive component.
+type Exports struct {
+	Receiver loki.LogsReceiver `river:"receiver,attr"`
+}
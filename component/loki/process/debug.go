@@ -0,0 +1,56 @@
+package process
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/agent/component/loki/process/stages"
+)
+
+// defaultTopPatterns is the number of patterns of each patterns stage
+// reported in the debug info.
+const defaultTopPatterns = 10
+
+// DebugInfo holds the patterns mined by the patterns stages.
+type DebugInfo struct {
+	Patterns []stages.PatternsInfo `river:"patterns,block,optional" json:"patterns"`
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	return c.debugInfo(defaultTopPatterns)
+}
+
+func (c *Component) debugInfo(n int) DebugInfo {
+	c.mut.RLock()
+	pipeline := c.stagesPipe
+	c.mut.RUnlock()
+
+	return DebugInfo{Patterns: pipeline.Patterns(n)}
+}
+
+// Handler implements http_service.Component. It serves the patterns matching
+// the most lines of each patterns stage as JSON from /patterns. The number of
+// patterns can be changed with the n query parameter.
+func (c *Component) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Trim(r.URL.Path, "/") != "patterns" {
+			http.NotFound(w, r)
+			return
+		}
+
+		n := defaultTopPatterns
+		if param := r.URL.Query().Get("n"); param != "" {
+			var err error
+			if n, err = strconv.Atoi(param); err != nil || n < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.debugInfo(n))
+	})
+}
@@ -11,8 +11,14 @@ import (
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/loki/process/stages"
+	http_service "github.com/grafana/agent/service/http"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// shutdownDropReason is the reason of entries dropped because they were
+// received after the component was drained.
+const shutdownDropReason = "shutdown"
+
 // TODO(thampiotr): We should reconsider which parts of this component should be exported and which should
 //                  be internal before 1.0, specifically the metrics and stages configuration structures.
 //					To keep the `stages` package internal, we may need to move the `converter` logic into
@@ -43,7 +49,10 @@ type Exports struct {
 }
 
 var (
-	_ component.Component = (*Component)(nil)
+	_ component.Component      = (*Component)(nil)
+	_ component.Drainer        = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+	_ http_service.Component   = (*Component)(nil)
 )
 
 // Component implements the loki.process component.
@@ -55,7 +64,15 @@ type Component struct {
 	processIn    chan<- loki.Entry
 	processOut   chan loki.Entry
 	entryHandler loki.EntryHandler
+	pipeline     loki.EntryHandler // Wraps entryHandler with the processing stages.
+	stagesPipe   *stages.Pipeline  // Pipeline of the stages, reporting their patterns.
 	stages       []stages.StageConfig
+	drained      bool // Set once Drain stopped the pipeline.
+	droppedLines *prometheus.CounterVec
+
+	// flush receives channels which handleOut closes once every entry it
+	// received was forwarded.
+	flush chan chan struct{}
 
 	fanoutMut sync.RWMutex
 	fanout    []loki.LogsReceiver
@@ -64,7 +81,9 @@ type Component struct {
 // New creates a new loki.process component.
 func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
-		opts: o,
+		opts:         o,
+		droppedLines: stages.DropCountMetric(o.Registerer),
+		flush:        make(chan chan struct{}),
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -88,7 +107,9 @@ func (c *Component) Run(ctx context.Context) error {
 		if c.entryHandler != nil {
 			c.entryHandler.Stop()
 		}
-		close(c.processIn)
+		if !c.drained {
+			close(c.processIn)
+		}
 		c.mut.RUnlock()
 	}()
 	wg := &sync.WaitGroup{}
@@ -125,8 +146,12 @@ func (c *Component) Update(args component.Arguments) error {
 		if err != nil {
 			return err
 		}
+		// Keep the patterns mined so far, so that their IDs don't change.
+		pipeline.InheritPatterns(c.stagesPipe)
 		c.entryHandler = loki.NewEntryHandler(c.processOut, func() {})
-		c.processIn = pipeline.Wrap(c.entryHandler).Chan()
+		c.pipeline = pipeline.Wrap(c.entryHandler)
+		c.stagesPipe = pipeline
+		c.processIn = c.pipeline.Chan()
 		c.stages = newArgs.Stages
 	}
 
@@ -141,6 +166,12 @@ func (c *Component) handleIn(ctx context.Context, wg *sync.WaitGroup) {
 			return
 		case entry := <-c.receiver.Chan():
 			c.mut.RLock()
+			if c.drained {
+				// The pipeline is stopped once drained.
+				c.droppedLines.WithLabelValues(shutdownDropReason).Inc()
+				c.mut.RUnlock()
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -162,6 +193,8 @@ func (c *Component) handleOut(ctx context.Context, wg *sync.WaitGroup) {
 		select {
 		case <-ctx.Done():
 			return
+		case flushed := <-c.flush:
+			close(flushed)
 		case entry := <-c.processOut:
 			c.fanoutMut.RLock()
 			fanout := c.fanout
@@ -178,6 +211,49 @@ func (c *Component) handleOut(ctx context.Context, wg *sync.WaitGroup) {
 	}
 }
 
+// Drain implements component.Drainer. It stops the pipeline, waiting for the
+// entries it's processing to be forwarded. Entries received after Drain was
+// called are dropped.
+func (c *Component) Drain(ctx context.Context) error {
+	c.mut.Lock()
+	if c.drained {
+		c.mut.Unlock()
+		return nil
+	}
+	c.drained = true
+	pipeline := c.pipeline
+	c.mut.Unlock()
+
+	// Stopping the pipeline returns once all entries it was processing were
+	// sent to processOut.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		pipeline.Stop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// handleOut processes requests in order, so all entries were forwarded
+	// once it handled the flush request.
+	flushed := make(chan struct{})
+	select {
+	case c.flush <- flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func stagesChanged(prev, next []stages.StageConfig) bool {
 	if len(prev) != len(next) {
 		return true
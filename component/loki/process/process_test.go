@@ -4,6 +4,9 @@ package process
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -18,6 +21,7 @@ import (
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/grafana/river"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
@@ -486,3 +490,125 @@ func TestDeadlockWithFrequentUpdates(t *testing.T) {
 	time.Sleep(1 * time.Second)
 	require.WithinDuration(t, time.Now(), lastSend.Load().(time.Time), 300*time.Millisecond)
 }
+
+func TestDrain(t *testing.T) {
+	stg := `
+stage.static_labels {
+    values = { "drained" = "true" }
+}`
+	type cfg struct {
+		Stages []stages.StageConfig `river:"stage,enum"`
+	}
+	var stagesCfg cfg
+	require.NoError(t, river.Unmarshal([]byte(stg), &stagesCfg))
+
+	const entries = 10
+	out := loki.NewLogsReceiverWithChannel(make(chan loki.Entry, entries))
+
+	opts := component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		OnStateChange: func(e component.Exports) {},
+	}
+	c, err := New(opts, Arguments{
+		ForwardTo: []loki.LogsReceiver{out},
+		Stages:    stagesCfg.Stages,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for i := 0; i < entries; i++ {
+		c.receiver.Chan() <- loki.Entry{
+			Labels: model.LabelSet{"job": "test"},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: "line"},
+		}
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	require.NoError(t, c.Drain(drainCtx))
+
+	// Every entry accepted before Drain was called must have been forwarded.
+	require.Len(t, out.Chan(), entries)
+	for i := 0; i < entries; i++ {
+		entry := <-out.Chan()
+		require.Equal(t, model.LabelSet{"job": "test", "drained": "true"}, entry.Labels)
+	}
+
+	// Entries received after the component was drained are dropped.
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"job": "test"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "late"},
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(c.droppedLines.WithLabelValues(shutdownDropReason)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, out.Chan(), 0)
+}
+
+func TestPatternsHandler(t *testing.T) {
+	stg := `
+stage.patterns { }`
+	type cfg struct {
+		Stages []stages.StageConfig `river:"stage,enum"`
+	}
+	var stagesCfg cfg
+	require.NoError(t, river.Unmarshal([]byte(stg), &stagesCfg))
+
+	out := loki.NewLogsReceiverWithChannel(make(chan loki.Entry, 3))
+	opts := component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		OnStateChange: func(e component.Exports) {},
+	}
+	c, err := New(opts, Arguments{
+		ForwardTo: []loki.LogsReceiver{out},
+		Stages:    stagesCfg.Stages,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, line := range []string{"request took 1ms", "request took 2ms", "worker started"} {
+		c.receiver.Chan() <- loki.Entry{
+			Labels: model.LabelSet{"job": "test"},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: line},
+		}
+	}
+	require.Eventually(t, func() bool { return len(out.Chan()) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	info := c.DebugInfo().(DebugInfo)
+	require.Len(t, info.Patterns, 1)
+	require.Equal(t, 2, info.Patterns[0].Patterns)
+	require.Equal(t, "request took <*>", info.Patterns[0].Top[0].Template)
+	require.EqualValues(t, 2, info.Patterns[0].Top[0].Count)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/patterns?n=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	require.Len(t, info.Patterns[0].Top, 1)
+
+	rec = httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/patterns?n=-1", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,250 @@
+package stages
+
+// This file implements an online log template clustering algorithm based on
+// Drain (He et al., "Drain: An Online Log Parsing Approach with Fixed Depth
+// Tree", ICWS 2017).
+//
+// Lines are split into tokens, and routed through a tree of fixed depth by
+// their number of tokens and their first tokens to a small set of clusters.
+// A line joins the most similar cluster of its leaf if they share enough
+// tokens, and the tokens of the cluster's template which differ from the line
+// are replaced with a wildcard. Otherwise, the line starts a new cluster.
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// patternWildcard replaces the variable tokens of templates.
+const patternWildcard = "<*>"
+
+type drainConfig struct {
+	prefix      int     // Number of first tokens routing lines.
+	maxChildren int     // Maximum number of children of tree nodes.
+	similarity  float64 // Minimum ratio of tokens shared with a cluster to join it.
+	maxClusters int     // Maximum number of clusters, least recently seen ones are evicted.
+	maxSamples  int     // Number of most recent lines kept per cluster.
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+type drainCluster struct {
+	id      string
+	tokens  []string
+	count   uint64
+	samples []string
+
+	leaf *drainNode
+	elem *list.Element // Element of the cluster in the LRU list of drain.
+}
+
+func (c *drainCluster) template() string {
+	return strings.Join(c.tokens, " ")
+}
+
+func (c *drainCluster) addSample(line string, max int) {
+	if max <= 0 {
+		return
+	}
+	if len(c.samples) == max {
+		copy(c.samples, c.samples[1:])
+		c.samples = c.samples[:max-1]
+	}
+	c.samples = append(c.samples, line)
+}
+
+// drain clusters lines into templates. It's not safe for concurrent use.
+type drain struct {
+	cfg      drainConfig
+	root     *drainNode
+	clusters map[string]*drainCluster
+	// lru holds the clusters from the most to the least recently seen.
+	lru *list.List
+}
+
+func newDrain(cfg drainConfig) *drain {
+	return &drain{
+		cfg:      cfg,
+		root:     &drainNode{children: map[string]*drainNode{}},
+		clusters: map[string]*drainCluster{},
+		lru:      list.New(),
+	}
+}
+
+// train adds line to the most similar cluster, or to a new cluster, and
+// returns it.
+func (d *drain) train(line string) *drainCluster {
+	tokens := tokenize(line)
+	leaf := d.leaf(tokens)
+
+	c := d.match(leaf, tokens)
+	if c == nil {
+		c = d.newCluster(leaf, tokens)
+	} else {
+		for i, tok := range tokens {
+			if c.tokens[i] != tok {
+				c.tokens[i] = patternWildcard
+			}
+		}
+	}
+
+	c.count++
+	d.lru.MoveToFront(c.elem)
+	c.addSample(line, d.cfg.maxSamples)
+	return c
+}
+
+// leaf returns the leaf node routing tokens, creating nodes as needed. The
+// first level routes on the number of tokens, the next ones on the first
+// tokens. Tokens which don't fit anymore when a node has too many children
+// are routed to the wildcard node.
+func (d *drain) leaf(tokens []string) *drainNode {
+	node := d.child(d.root, fmt.Sprint(len(tokens)), false)
+	for i := 0; i < d.cfg.prefix && i < len(tokens); i++ {
+		node = d.child(node, tokens[i], true)
+	}
+	return node
+}
+
+func (d *drain) child(node *drainNode, key string, limited bool) *drainNode {
+	if child, ok := node.children[key]; ok {
+		return child
+	}
+	if limited && key != patternWildcard && len(node.children) >= d.cfg.maxChildren-1 {
+		key = patternWildcard
+		if child, ok := node.children[key]; ok {
+			return child
+		}
+	}
+	child := &drainNode{children: map[string]*drainNode{}}
+	node.children[key] = child
+	return child
+}
+
+// match returns the cluster of leaf most similar to tokens, if similar enough.
+func (d *drain) match(leaf *drainNode, tokens []string) *drainCluster {
+	var (
+		best      *drainCluster
+		bestSim   = -1.0
+		bestWilds = -1
+	)
+	for _, c := range leaf.clusters {
+		sim, wilds := similarity(c.tokens, tokens)
+		if sim > bestSim || (sim == bestSim && wilds > bestWilds) {
+			best, bestSim, bestWilds = c, sim, wilds
+		}
+	}
+	if best == nil || bestSim < d.cfg.similarity {
+		return nil
+	}
+	return best
+}
+
+func (d *drain) newCluster(leaf *drainNode, tokens []string) *drainCluster {
+	if d.cfg.maxClusters > 0 && len(d.clusters) >= d.cfg.maxClusters {
+		d.evict()
+	}
+
+	c := &drainCluster{
+		id:     patternID(tokens),
+		tokens: append([]string(nil), tokens...),
+		leaf:   leaf,
+	}
+	// Lines of different clusters may start the same, keep IDs unique.
+	for i := 1; d.clusters[c.id] != nil; i++ {
+		c.id = patternID(append(tokens[:len(tokens):len(tokens)], fmt.Sprint(i)))
+	}
+	c.elem = d.lru.PushFront(c)
+	leaf.clusters = append(leaf.clusters, c)
+	d.clusters[c.id] = c
+	return c
+}
+
+// evict removes the least recently seen cluster.
+func (d *drain) evict() {
+	back := d.lru.Back()
+	if back == nil {
+		return
+	}
+	oldest := d.lru.Remove(back).(*drainCluster)
+
+	delete(d.clusters, oldest.id)
+	leaf := oldest.leaf
+	for i, c := range leaf.clusters {
+		if c == oldest {
+			leaf.clusters = append(leaf.clusters[:i], leaf.clusters[i+1:]...)
+			break
+		}
+	}
+}
+
+// top returns the n clusters with the most lines, or all clusters if n is
+// negative.
+func (d *drain) top(n int) []*drainCluster {
+	res := make([]*drainCluster, 0, len(d.clusters))
+	for _, c := range d.clusters {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].count != res[j].count {
+			return res[i].count > res[j].count
+		}
+		return res[i].id < res[j].id
+	})
+	if n >= 0 && n < len(res) {
+		res = res[:n]
+	}
+	return res
+}
+
+// similarity returns the ratio of tokens of template equal to tokens, and the
+// number of wildcards of template.
+func similarity(template, tokens []string) (float64, int) {
+	if len(template) == 0 {
+		return 1, 0
+	}
+	var equal, wilds int
+	for i, tok := range template {
+		if tok == patternWildcard {
+			wilds++
+			continue
+		}
+		if tok == tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(template)), wilds
+}
+
+// tokenize splits line on whitespace. Tokens containing digits are replaced
+// with wildcards, as they're most often variables such as IDs, durations or
+// addresses, which also makes templates and their IDs converge faster.
+func tokenize(line string) []string {
+	tokens := strings.Fields(line)
+	for i, tok := range tokens {
+		if hasDigit(tok) {
+			tokens[i] = patternWildcard
+		}
+	}
+	return tokens
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
+
+// patternID returns the ID of a cluster created from tokens. IDs only depend
+// on the line which created the cluster, so that they don't change as the
+// template of the cluster gets more general, and are the same across restarts
+// as long as the same line creates the cluster.
+func patternID(tokens []string) string {
+	return fmt.Sprintf("%016x", xxhash.Sum64String(strings.Join(tokens, " ")))
+}
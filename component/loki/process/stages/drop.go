@@ -88,7 +88,7 @@ func newDropStage(logger log.Logger, config DropConfig, registerer prometheus.Re
 	return &dropStage{
 		logger:    log.With(logger, "component", "stage", "type", "drop"),
 		cfg:       &config,
-		dropCount: getDropCountMetric(registerer),
+		dropCount: DropCountMetric(registerer),
 	}, nil
 }
 
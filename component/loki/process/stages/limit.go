@@ -49,7 +49,7 @@ func newLimitStage(logger log.Logger, cfg LimitConfig, registerer prometheus.Reg
 	r := &limitStage{
 		logger:    logger,
 		cfg:       cfg,
-		dropCount: getDropCountMetric(registerer),
+		dropCount: DropCountMetric(registerer),
 	}
 
 	if cfg.ByLabelName != "" {
@@ -95,7 +95,7 @@ func newMatcherStage(logger log.Logger, jobName *string, config MatchConfig, reg
 
 	return &matcherStage{
 		dropReason: dropReason,
-		dropCount:  getDropCountMetric(registerer),
+		dropCount:  DropCountMetric(registerer),
 		matchers:   selector.Matchers(),
 		stage:      pl,
 		action:     config.Action,
@@ -103,7 +103,9 @@ func newMatcherStage(logger log.Logger, jobName *string, config MatchConfig, reg
 	}, nil
 }
 
-func getDropCountMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
+// DropCountMetric returns the counter of log lines dropped by the stages of
+// a pipeline, registering it with registerer if it isn't registered yet.
+func DropCountMetric(registerer prometheus.Registerer) *prometheus.CounterVec {
 	dropCount := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "loki_process_dropped_lines_total",
 		Help: "A count of all log lines dropped as a result of a pipeline stage",
@@ -130,6 +132,13 @@ type matcherStage struct {
 	action     string
 }
 
+func (m *matcherStage) patternsStages() []*patternsStage {
+	if c, ok := m.stage.(patternsContainer); ok {
+		return c.patternsStages()
+	}
+	return nil
+}
+
 func (m *matcherStage) Run(in chan Entry) chan Entry {
 	switch m.action {
 	case MatchActionDrop:
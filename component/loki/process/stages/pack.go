@@ -120,7 +120,7 @@ func newPackStage(logger log.Logger, config PackConfig, registerer prometheus.Re
 	return &packStage{
 		logger:    log.With(logger, "component", "stage", "type", "pack"),
 		cfg:       &config,
-		dropCount: getDropCountMetric(registerer),
+		dropCount: DropCountMetric(registerer),
 	}
 }
 
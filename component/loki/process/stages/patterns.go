@@ -0,0 +1,202 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// Configuration errors.
+var (
+	ErrPatternsInvalidSimilarity = errors.New("patterns stage similarity_threshold must be between 0 and 1")
+	ErrPatternsInvalidDepth      = errors.New("patterns stage max_depth must be at least 3")
+	ErrPatternsInvalidChildren   = errors.New("patterns stage max_children must be at least 2")
+	ErrPatternsEmptyIDKey        = errors.New("patterns stage pattern_id_key must not be empty")
+)
+
+// PatternsConfig contains the configuration for a patternsStage.
+type PatternsConfig struct {
+	Source              *string `river:"source,attr,optional"`
+	PatternIDKey        string  `river:"pattern_id_key,attr,optional"`
+	TemplateKey         string  `river:"template_key,attr,optional"`
+	StructuredMetadata  bool    `river:"structured_metadata,attr,optional"`
+	SimilarityThreshold float64 `river:"similarity_threshold,attr,optional"`
+	MaxDepth            int     `river:"max_depth,attr,optional"`
+	MaxChildren         int     `river:"max_children,attr,optional"`
+	MaxPatterns         int     `river:"max_patterns,attr,optional"`
+	MaxSamples          int     `river:"max_samples,attr,optional"`
+}
+
+// DefaultPatternsConfig holds the default configuration of a patternsStage.
+var DefaultPatternsConfig = PatternsConfig{
+	PatternIDKey:        "pattern_id",
+	SimilarityThreshold: 0.4,
+	MaxDepth:            4,
+	MaxChildren:         100,
+	MaxPatterns:         1000,
+	MaxSamples:          3,
+}
+
+// SetToDefault implements river.Defaulter.
+func (c *PatternsConfig) SetToDefault() {
+	*c = DefaultPatternsConfig
+}
+
+// Validate implements river.Validator.
+func (c *PatternsConfig) Validate() error {
+	switch {
+	case c.SimilarityThreshold < 0 || c.SimilarityThreshold > 1:
+		return ErrPatternsInvalidSimilarity
+	case c.MaxDepth < 3:
+		return ErrPatternsInvalidDepth
+	case c.MaxChildren < 2:
+		return ErrPatternsInvalidChildren
+	case c.PatternIDKey == "":
+		return ErrPatternsEmptyIDKey
+	}
+	return nil
+}
+
+// PatternsInfo holds the patterns mined by a patterns stage.
+type PatternsInfo struct {
+	Source   string        `river:"source,attr" json:"source"`
+	Patterns int           `river:"patterns,attr" json:"patterns"`
+	Top      []PatternInfo `river:"top,block,optional" json:"top"`
+}
+
+// PatternInfo holds a pattern and the number of lines which matched it.
+type PatternInfo struct {
+	ID       string   `river:"id,attr" json:"id"`
+	Template string   `river:"template,attr" json:"template"`
+	Count    uint64   `river:"count,attr" json:"count"`
+	Samples  []string `river:"samples,attr,optional" json:"samples"`
+}
+
+// patternsContainer is implemented by stages which mine patterns, or which
+// contain such stages.
+type patternsContainer interface {
+	// patternsStages returns the patterns stages, in order.
+	patternsStages() []*patternsStage
+}
+
+// newPatternsStage creates a patternsStage from config.
+func newPatternsStage(logger log.Logger, cfg PatternsConfig) (Stage, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &patternsStage{
+		logger: log.With(logger, "component", "stage", "type", "patterns"),
+		cfg:    cfg,
+		state: &patternsState{drain: newDrain(drainConfig{
+			// The tree has a root, a level for the number of tokens, and
+			// leaves holding the clusters.
+			prefix:      cfg.MaxDepth - 3,
+			maxChildren: cfg.MaxChildren,
+			similarity:  cfg.SimilarityThreshold,
+			maxClusters: cfg.MaxPatterns,
+			maxSamples:  cfg.MaxSamples,
+		})},
+	}, nil
+}
+
+// patternsStage clusters log lines into templates, and attaches the ID of
+// the template of each line to it.
+type patternsStage struct {
+	logger log.Logger
+	cfg    PatternsConfig
+	state  *patternsState
+}
+
+// patternsState holds the patterns mined by a patternsStage. It's shared
+// with the stage replacing it when a pipeline is recreated, see
+// Pipeline.InheritPatterns.
+type patternsState struct {
+	mut   sync.Mutex
+	drain *drain
+}
+
+// Run implements Stage.
+func (s *patternsStage) Run(in chan Entry) chan Entry {
+	return RunWith(in, func(e Entry) Entry {
+		line, ok := s.source(e)
+		if !ok {
+			return e
+		}
+
+		s.state.mut.Lock()
+		c := s.state.drain.train(line)
+		id, template := c.id, c.template()
+		s.state.mut.Unlock()
+
+		e.Extracted[s.cfg.PatternIDKey] = id
+		if s.cfg.TemplateKey != "" {
+			e.Extracted[s.cfg.TemplateKey] = template
+		}
+		if s.cfg.StructuredMetadata {
+			e.StructuredMetadata = append(e.StructuredMetadata, logproto.LabelAdapter{Name: s.cfg.PatternIDKey, Value: id})
+			if s.cfg.TemplateKey != "" {
+				e.StructuredMetadata = append(e.StructuredMetadata, logproto.LabelAdapter{Name: s.cfg.TemplateKey, Value: template})
+			}
+		}
+		return e
+	})
+}
+
+// source returns the text to cluster, the log line unless a source is
+// configured.
+func (s *patternsStage) source(e Entry) (string, bool) {
+	if s.cfg.Source == nil {
+		return e.Line, true
+	}
+
+	v, ok := e.Extracted[*s.cfg.Source]
+	if !ok {
+		level.Debug(s.logger).Log("msg", "source does not exist in the set of extracted values", "source", *s.cfg.Source)
+		return "", false
+	}
+	text, err := getString(v)
+	if err != nil {
+		level.Debug(s.logger).Log("msg", "failed to convert source value to string", "source", *s.cfg.Source, "err", err, "type", fmt.Sprintf("%T", v))
+		return "", false
+	}
+	return text, true
+}
+
+// Name implements Stage.
+func (s *patternsStage) Name() string {
+	return StageTypePatterns
+}
+
+func (s *patternsStage) patternsStages() []*patternsStage {
+	return []*patternsStage{s}
+}
+
+// inherits reports whether s can continue from the patterns mined by prev.
+func (s *patternsStage) inherits(prev *patternsStage) bool {
+	sameSource := (s.cfg.Source == nil && prev.cfg.Source == nil) ||
+		(s.cfg.Source != nil && prev.cfg.Source != nil && *s.cfg.Source == *prev.cfg.Source)
+	return sameSource && s.state.drain.cfg == prev.state.drain.cfg
+}
+
+func (s *patternsStage) patterns(n int) PatternsInfo {
+	s.state.mut.Lock()
+	defer s.state.mut.Unlock()
+
+	info := PatternsInfo{Source: "line", Patterns: len(s.state.drain.clusters)}
+	if s.cfg.Source != nil {
+		info.Source = *s.cfg.Source
+	}
+	for _, c := range s.state.drain.top(n) {
+		info.Top = append(info.Top, PatternInfo{
+			ID:       c.id,
+			Template: c.template(),
+			Count:    c.count,
+			Samples:  append([]string(nil), c.samples...),
+		})
+	}
+	return info
+}
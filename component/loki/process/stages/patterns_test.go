@@ -0,0 +1,157 @@
+package stages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	util_log "github.com/grafana/loki/pkg/util/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+var testPatternsRiver = `
+stage.patterns {
+  template_key        = "template"
+  structured_metadata = true
+  max_samples         = 2
+}
+`
+
+var testPatternsLines = []string{
+	"user alice logged in from 10.0.0.1",
+	"user bob logged in from 10.0.0.2",
+	"connection closed after 12ms",
+	"user carol logged in from 10.0.0.3",
+	"connection closed after 3ms",
+}
+
+func TestPatternsPipeline(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(testPatternsRiver), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	var entries []Entry
+	for _, line := range testPatternsLines {
+		entries = append(entries, newEntry(nil, nil, line, time.Now()))
+	}
+	out := processEntries(pl, entries...)
+	require.Len(t, out, len(testPatternsLines))
+
+	login, closed := out[0].Extracted["pattern_id"], out[2].Extracted["pattern_id"]
+	require.NotEqual(t, login, closed)
+	for i, e := range out {
+		switch i {
+		case 0, 1, 3:
+			require.Equal(t, login, e.Extracted["pattern_id"])
+		default:
+			require.Equal(t, closed, e.Extracted["pattern_id"])
+		}
+	}
+	require.Equal(t, "connection closed after <*>", out[4].Extracted["template"])
+	require.Contains(t, out[4].StructuredMetadata, logproto.LabelAdapter{Name: "pattern_id", Value: closed.(string)})
+
+	patterns := pl.Patterns(-1)
+	require.Len(t, patterns, 1)
+	require.Equal(t, PatternsInfo{
+		Source:   "line",
+		Patterns: 2,
+		Top: []PatternInfo{
+			{
+				ID:       login.(string),
+				Template: "user <*> logged in from <*>",
+				Count:    3,
+				Samples:  []string{"user bob logged in from 10.0.0.2", "user carol logged in from 10.0.0.3"},
+			},
+			{
+				ID:       closed.(string),
+				Template: "connection closed after <*>",
+				Count:    2,
+				Samples:  []string{"connection closed after 12ms", "connection closed after 3ms"},
+			},
+		},
+	}, patterns[0])
+	require.Len(t, pl.Patterns(1)[0].Top, 1)
+}
+
+func TestPatternsNestedInMatch(t *testing.T) {
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.match {
+  selector = "{app=\"foo\"}"
+  stage.patterns { }
+}
+stage.match {
+  selector = "{app=\"bar\"}"
+  action   = "drop"
+}
+`), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+	require.Len(t, pl.Patterns(-1), 1)
+}
+
+func TestInheritPatterns(t *testing.T) {
+	prev, err := NewPipeline(util_log.Logger, loadConfig(testPatternsRiver), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+	out := processEntries(prev, newEntry(nil, nil, testPatternsLines[0], time.Now()))
+	id := out[0].Extracted["pattern_id"]
+
+	// A patterns stage with the same settings continues from the patterns of
+	// the previous pipeline, even if other stages changed.
+	pl, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.static_labels {
+  values = { foo = "bar" }
+}
+`+testPatternsRiver), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+	pl.InheritPatterns(prev)
+	out = processEntries(pl, newEntry(nil, nil, testPatternsLines[1], time.Now()))
+	require.Equal(t, id, out[0].Extracted["pattern_id"])
+	require.Equal(t, uint64(2), pl.Patterns(-1)[0].Top[0].Count)
+
+	// A patterns stage with different settings starts from scratch.
+	other, err := NewPipeline(util_log.Logger, loadConfig(`
+stage.patterns {
+  max_patterns = 10
+}
+`), &plName, prometheus.NewRegistry())
+	require.NoError(t, err)
+	other.InheritPatterns(pl)
+	require.Equal(t, 0, other.Patterns(-1)[0].Patterns)
+}
+
+func TestDrain(t *testing.T) {
+	d := newDrain(drainConfig{prefix: 1, maxChildren: 100, similarity: 0.4, maxClusters: 2})
+
+	a := d.train("GET /index.html status ok")
+	require.Same(t, a, d.train("GET /about.html status ok"))
+	require.Equal(t, "GET <*> status ok", a.template())
+
+	// Lines with a different number of tokens never share a cluster.
+	b := d.train("GET /index.html status not ok")
+	require.NotSame(t, a, b)
+
+	// The least recently seen cluster is evicted, even if it was created
+	// last.
+	require.Same(t, a, d.train("GET /contact.html status ok"))
+	c := d.train("worker stopped")
+	require.Len(t, d.clusters, 2)
+	require.Equal(t, 2, d.lru.Len())
+	require.Contains(t, d.clusters, a.id)
+	require.NotContains(t, d.clusters, b.id)
+	require.Contains(t, d.clusters, c.id)
+
+	// IDs depend on the line which created the cluster, not on its template.
+	require.Equal(t, "GET <*> status ok", a.template())
+	require.Equal(t, a.id, newDrain(d.cfg).train("GET /index.html status ok").id)
+}
+
+func TestPatternsConfig_Validate(t *testing.T) {
+	cfg := DefaultPatternsConfig
+	require.NoError(t, cfg.Validate())
+
+	cfg.SimilarityThreshold = 2
+	require.ErrorIs(t, cfg.Validate(), ErrPatternsInvalidSimilarity)
+
+	cfg = DefaultPatternsConfig
+	cfg.MaxDepth = 2
+	require.ErrorIs(t, cfg.Validate(), ErrPatternsInvalidDepth)
+}
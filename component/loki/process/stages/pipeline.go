@@ -33,6 +33,7 @@ type StageConfig struct {
 	MultilineConfig       *MultilineConfig       `river:"multiline,block,optional"`
 	OutputConfig          *OutputConfig          `river:"output,block,optional"`
 	PackConfig            *PackConfig            `river:"pack,block,optional"`
+	PatternsConfig        *PatternsConfig        `river:"patterns,block,optional"`
 	RegexConfig           *RegexConfig           `river:"regex,block,optional"`
 	ReplaceConfig         *ReplaceConfig         `river:"replace,block,optional"`
 	StaticLabelsConfig    *StaticLabelsConfig    `river:"static_labels,block,optional"`
@@ -69,7 +70,7 @@ func NewPipeline(logger log.Logger, stages []StageConfig, jobName *string, regis
 		logger:    log.With(logger, "component", "pipeline"),
 		stages:    st,
 		jobName:   jobName,
-		dropCount: getDropCountMetric(registerer),
+		dropCount: DropCountMetric(registerer),
 	}, nil
 }
 
@@ -183,6 +184,48 @@ func (p *Pipeline) Wrap(next loki.EntryHandler) loki.EntryHandler {
 	})
 }
 
+// Patterns returns the n patterns matching the most lines of each patterns
+// stage of the pipeline, in order, or all patterns if n is negative.
+func (p *Pipeline) Patterns(n int) []PatternsInfo {
+	var res []PatternsInfo
+	for _, s := range p.patternsStages() {
+		res = append(res, s.patterns(n))
+	}
+	return res
+}
+
+// InheritPatterns makes the patterns stages of p continue from the patterns
+// mined by the patterns stages of prev with the same source and settings, in
+// order, so that the IDs of patterns are kept when a pipeline is recreated.
+// It must be called before p runs. prev may be nil.
+func (p *Pipeline) InheritPatterns(prev *Pipeline) {
+	prevStages := prev.patternsStages()
+	for _, s := range p.patternsStages() {
+		for i, ps := range prevStages {
+			if s.inherits(ps) {
+				s.state = ps.state
+				prevStages = prevStages[i+1:]
+				break
+			}
+		}
+	}
+}
+
+func (p *Pipeline) patternsStages() []*patternsStage {
+	// The pipeline of match stages dropping entries is nil.
+	if p == nil {
+		return nil
+	}
+
+	var res []*patternsStage
+	for _, s := range p.stages {
+		if c, ok := s.(patternsContainer); ok {
+			res = append(res, c.patternsStages()...)
+		}
+	}
+	return res
+}
+
 // Size gets the current number of stages in the pipeline
 func (p *Pipeline) Size() int {
 	return len(p.stages)
@@ -50,7 +50,7 @@ func newSamplingStage(logger log.Logger, cfg SamplingConfig, registerer promethe
 	return &samplingStage{
 		logger:           log.With(logger, "component", "stage", "type", "sampling"),
 		cfg:              cfg,
-		dropCount:        getDropCountMetric(registerer),
+		dropCount:        DropCountMetric(registerer),
 		samplingBoundary: samplingBoundary,
 		source:           source,
 	}
@@ -33,6 +33,7 @@ const (
 	StageTypeMultiline          = "multiline"
 	StageTypeOutput             = "output"
 	StageTypePack               = "pack"
+	StageTypePatterns           = "patterns"
 	StageTypePipeline           = "pipeline"
 	StageTypeRegex              = "regex"
 	StageTypeReplace            = "replace"
@@ -230,6 +231,11 @@ func New(logger log.Logger, jobName *string, cfg StageConfig, registerer prometh
 		}
 	case cfg.SamplingConfig != nil:
 		s = newSamplingStage(logger, *cfg.SamplingConfig, registerer)
+	case cfg.PatternsConfig != nil:
+		s, err = newPatternsStage(logger, *cfg.PatternsConfig)
+		if err != nil {
+			return nil, err
+		}
 	case cfg.EventLogMessageConfig != nil:
 		s = newEventLogMessageStage(logger, cfg.EventLogMessageConfig)
 	default:
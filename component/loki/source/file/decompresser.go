@@ -317,3 +317,13 @@ func (d *decompressor) cleanupMetrics() {
 func (d *decompressor) Path() string {
 	return d.path
 }
+
+// Fingerprint returns an empty string, compressed files are identified by
+// path.
+func (d *decompressor) Fingerprint() string {
+	return ""
+}
+
+func (d *decompressor) Rotations() []rotation {
+	return nil
+}
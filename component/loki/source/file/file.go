@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/common/loki/positions"
@@ -42,6 +43,7 @@ type Arguments struct {
 	Encoding            string              `river:"encoding,attr,optional"`
 	DecompressionConfig DecompressionConfig `river:"decompression,block,optional"`
 	FileWatch           FileWatch           `river:"file_watch,block,optional"`
+	Fingerprint         Fingerprint         `river:"fingerprint,block,optional"`
 	TailFromEnd         bool                `river:"tail_from_end,attr,optional"`
 }
 
@@ -50,11 +52,22 @@ type FileWatch struct {
 	MaxPollFrequency time.Duration `river:"max_poll_frequency,attr,optional"`
 }
 
+// Fingerprint configures the identification of files by their inode and the
+// hash of their first bytes rather than by their path.
+type Fingerprint struct {
+	Enabled bool             `river:"enabled,attr,optional"`
+	Size    units.Base2Bytes `river:"size,attr,optional"`
+}
+
 var DefaultArguments = Arguments{
 	FileWatch: FileWatch{
 		MinPollFrequency: 250 * time.Millisecond,
 		MaxPollFrequency: 250 * time.Millisecond,
 	},
+	Fingerprint: Fingerprint{
+		Enabled: false,
+		Size:    units.KiB,
+	},
 }
 
 // SetToDefault implements river.Defaulter.
@@ -62,6 +75,14 @@ func (a *Arguments) SetToDefault() {
 	*a = DefaultArguments
 }
 
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	if a.Fingerprint.Enabled && a.Fingerprint.Size <= 0 {
+		return fmt.Errorf("fingerprint size must be greater than 0")
+	}
+	return nil
+}
+
 type DecompressionConfig struct {
 	Enabled      bool              `river:"enabled,attr"`
 	InitialDelay time.Duration     `river:"initial_delay,attr,optional"`
@@ -268,10 +289,12 @@ func (c *Component) DebugInfo() interface{} {
 	for e, reader := range c.readers {
 		offset, _ := c.posFile.Get(e.Path, e.Labels)
 		res.TargetsInfo = append(res.TargetsInfo, targetInfo{
-			Path:       e.Path,
-			Labels:     e.Labels,
-			IsRunning:  reader.IsRunning(),
-			ReadOffset: offset,
+			Path:        e.Path,
+			Labels:      e.Labels,
+			IsRunning:   reader.IsRunning(),
+			ReadOffset:  offset,
+			Fingerprint: reader.Fingerprint(),
+			Rotations:   reader.Rotations(),
 		})
 	}
 	return res
@@ -282,10 +305,12 @@ type readerDebugInfo struct {
 }
 
 type targetInfo struct {
-	Path       string `river:"path,attr"`
-	Labels     string `river:"labels,attr"`
-	IsRunning  bool   `river:"is_running,attr"`
-	ReadOffset int64  `river:"read_offset,attr"`
+	Path        string     `river:"path,attr"`
+	Labels      string     `river:"labels,attr"`
+	IsRunning   bool       `river:"is_running,attr"`
+	ReadOffset  int64      `river:"read_offset,attr"`
+	Fingerprint string     `river:"fingerprint,attr,optional"`
+	Rotations   []rotation `river:"rotation,block,optional"`
 }
 
 // Returns the elements from set b which are missing from set a
@@ -340,6 +365,10 @@ func (c *Component) startTailing(path string, labels model.LabelSet, handler lok
 			MinPollFrequency: c.args.FileWatch.MinPollFrequency,
 			MaxPollFrequency: c.args.FileWatch.MaxPollFrequency,
 		}
+		var fingerprintSize int64
+		if c.args.Fingerprint.Enabled {
+			fingerprintSize = int64(c.args.Fingerprint.Size)
+		}
 		tailer, err := newTailer(
 			c.metrics,
 			c.opts.Logger,
@@ -350,6 +379,7 @@ func (c *Component) startTailing(path string, labels model.LabelSet, handler lok
 			c.args.Encoding,
 			pollOptions,
 			c.args.TailFromEnd,
+			fingerprintSize,
 		)
 		if err != nil {
 			level.Error(c.opts.Logger).Log("msg", "failed to start tailer", "error", err, "filename", path)
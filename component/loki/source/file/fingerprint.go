@@ -0,0 +1,101 @@
+package file
+
+// fingerprint identifies files by their content rather than by their path, so
+// that a tailed file can be recognized once it's been renamed, and told apart
+// from a new file reusing its path or its inode.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// fingerprint is the identity of a file: its inode and a hash of its first
+// bytes. Files shorter than the configured fingerprint size are hashed in
+// full, and their fingerprint grows along with them.
+type fingerprint struct {
+	inode uint64
+	size  int64 // Number of hashed bytes.
+	hash  uint64
+}
+
+// String returns the representation of f used as positions file key.
+func (f fingerprint) String() string {
+	return fmt.Sprintf("%d-%d-%x", f.inode, f.size, f.hash)
+}
+
+func parseFingerprint(s string) (fingerprint, error) {
+	var f fingerprint
+	if _, err := fmt.Sscanf(s, "%d-%d-%x", &f.inode, &f.size, &f.hash); err != nil {
+		return fingerprint{}, fmt.Errorf("invalid fingerprint %q: %w", s, err)
+	}
+	return f, nil
+}
+
+// computeFingerprint returns the fingerprint of the file at path, hashing up
+// to its first size bytes.
+func computeFingerprint(path string, size int64) (fingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fingerprint{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fingerprint{}, err
+	}
+
+	h := xxhash.New()
+	n, err := io.Copy(h, io.LimitReader(f, size))
+	if err != nil {
+		return fingerprint{}, err
+	}
+	return fingerprint{inode: inode(fi), size: n, hash: h.Sum64()}, nil
+}
+
+// matches reports whether the file at path is the file identified by f, that
+// is whether it has the same inode and the same first f.size bytes. A file
+// which has been truncated below f.size bytes doesn't match.
+func (f fingerprint) matches(path string) (bool, error) {
+	other, err := computeFingerprint(path, f.size)
+	if err != nil {
+		return false, err
+	}
+	return other == f, nil
+}
+
+// findRenamed looks for the file identified by f among the files of dir, where
+// rotation tools such as logrotate rename the files they rotate. It returns
+// the path of the file if found.
+//
+// Files are looked up by inode, so findRenamed never finds files on platforms
+// which don't expose inodes.
+func findRenamed(dir string, f fingerprint) (string, bool) {
+	if f.inode == 0 {
+		return "", false
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || inode(fi) != f.inode {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		if ok, _ := f.matches(path); ok {
+			return path, true
+		}
+	}
+	return "", false
+}
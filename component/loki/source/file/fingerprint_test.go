@@ -0,0 +1,143 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/common/loki/positions"
+	"github.com/grafana/tail/watch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0644))
+
+	fp, err := computeFingerprint(path, 8)
+	require.NoError(t, err)
+	require.EqualValues(t, 6, fp.size)
+
+	parsed, err := parseFingerprint(fp.String())
+	require.NoError(t, err)
+	require.Equal(t, fp, parsed)
+
+	// The fingerprint of a file shorter than the fingerprint size still
+	// matches once it grew.
+	appendFile(t, path, "world\n")
+	ok, err := fp.matches(path)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	grown, err := computeFingerprint(path, 8)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, grown.size)
+
+	// A file which was rewritten doesn't match anymore.
+	require.NoError(t, os.WriteFile(path, []byte("HELLO WORLD\n"), 0644))
+	ok, err = grown.matches(path)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Renamed files are found by fingerprint.
+	cur, err := computeFingerprint(path, 8)
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("HELLO WORLD\n"), 0644))
+	if cur.inode == 0 {
+		t.Skip("inodes aren't supported")
+	}
+	target, ok := findRenamed(dir, cur)
+	require.True(t, ok)
+	require.Equal(t, path+".1", target)
+}
+
+func TestTailerFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	require.NoError(t, os.WriteFile(path, []byte("line 1\n"), 0644))
+
+	ps, err := positions.New(log.NewNopLogger(), positions.Config{
+		SyncPeriod:    10 * time.Second,
+		PositionsFile: filepath.Join(dir, "positions.yml"),
+	})
+	require.NoError(t, err)
+	defer ps.Stop()
+
+	ch := make(chan loki.Entry, 10)
+	startTailer := func() *tailer {
+		handler := loki.NewEntryHandler(ch, func() {})
+		tailer, err := newTailer(newMetrics(nil), log.NewNopLogger(), handler, ps, path, "{}", "", watch.PollingFileWatcherOptions{
+			MinPollFrequency: 10 * time.Millisecond,
+			MaxPollFrequency: 10 * time.Millisecond,
+		}, false, 1024)
+		require.NoError(t, err)
+		return tailer
+	}
+
+	tailer := startTailer()
+	requireLines(t, ch, "line 1")
+	tailer.Stop()
+
+	t.Run("renamed", func(t *testing.T) {
+		if fp, _ := computeFingerprint(path, 1024); fp.inode == 0 {
+			t.Skip("inodes aren't supported")
+		}
+
+		// The file is rotated and written to while the tailer is stopped.
+		appendFile(t, path, "line 2\n")
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendFile(t, path+".1", "line 3\n")
+		require.NoError(t, os.WriteFile(path, []byte("new line 1\n"), 0644))
+
+		tailer := startTailer()
+		requireLines(t, ch, "line 2", "line 3", "new line 1")
+		require.Eventually(t, func() bool {
+			return len(ps.GetFiles(path, "{}")) == 0
+		}, 5*time.Second, 10*time.Millisecond, "expected renamed file to be finished")
+		require.Len(t, tailer.Rotations(), 1)
+		require.Equal(t, rotationRenamed, tailer.Rotations()[0].Kind)
+		require.Equal(t, path+".1", tailer.Rotations()[0].RenamedTo)
+		tailer.Stop()
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		// The file is truncated and rewritten past its previous size while
+		// the tailer is stopped.
+		require.NoError(t, os.WriteFile(path, []byte("truncated line 1\n"), 0644))
+
+		tailer := startTailer()
+		requireLines(t, ch, "truncated line 1")
+		require.Equal(t, rotationTruncated, tailer.Rotations()[0].Kind)
+		tailer.Stop()
+	})
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(text)
+	require.NoError(t, err)
+}
+
+// requireLines requires lines to be read in any order, as renamed files are
+// read concurrently with the tailed file.
+func requireLines(t *testing.T, ch chan loki.Entry, lines ...string) {
+	t.Helper()
+	var got []string
+	for range lines {
+		select {
+		case e := <-ch:
+			got = append(got, e.Line)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "failed waiting for log lines", "got %v, want %v", got, lines)
+		}
+	}
+	require.ElementsMatch(t, lines, got)
+}
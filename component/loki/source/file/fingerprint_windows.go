@@ -0,0 +1,11 @@
+//go:build windows
+
+package file
+
+import "os"
+
+// inode returns 0 on Windows, where os.FileInfo doesn't expose file indexes.
+// Files are then identified by their content only.
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
@@ -9,4 +9,6 @@ type reader interface {
 	IsRunning() bool
 	Path() string
 	MarkPositionAndSize() error
+	Fingerprint() string
+	Rotations() []rotation
 }
@@ -4,10 +4,13 @@ package file
 // tailer implements the reader interface by using the github.com/grafana/tail package to tail files.
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,13 +35,26 @@ type tailer struct {
 	handler   loki.EntryHandler
 	positions positions.Positions
 
-	path   string
-	labels string
-	tail   *tail.Tail
+	path        string
+	labels      string
+	pollOptions watch.PollingFileWatcherOptions
+
+	// The fields below are guarded by posAndSizeMtx.
+	tail        *tail.Tail
+	stopping    bool
+	fingerprint fingerprint
+	rotations   []rotation
+	lastPos     int64
 
 	posAndSizeMtx sync.Mutex
 	stopOnce      sync.Once
 
+	// fingerprintSize is the number of bytes hashed to identify files. Files
+	// are identified by path only when it's 0.
+	fingerprintSize int64
+	finishWg        sync.WaitGroup
+	finishQuit      chan struct{}
+
 	running *atomic.Bool
 	posquit chan struct{}
 	posdone chan struct{}
@@ -47,10 +63,33 @@ type tailer struct {
 	decoder *encoding.Decoder
 }
 
+// maxRotations is the number of rotations kept in the debug info of tailers.
+const maxRotations = 10
+
+// rotation records a change of the file tailed at a path.
+type rotation struct {
+	Time        time.Time `river:"time,attr"`
+	Kind        string    `river:"kind,attr"`
+	Fingerprint string    `river:"fingerprint,attr"`
+	RenamedTo   string    `river:"renamed_to,attr,optional"`
+}
+
+// Kinds of rotations.
+const (
+	rotationRenamed   = "renamed"
+	rotationTruncated = "truncated"
+)
+
+// renamedFile is a file which used to be tailed at a path and has been
+// renamed, and whose remaining lines must be read.
+type renamedFile struct {
+	fingerprint fingerprint
+	path        string
+	offset      int64
+}
+
 func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, positions positions.Positions, path string,
-	labels string, encoding string, pollOptions watch.PollingFileWatcherOptions, tailFromEnd bool) (*tailer, error) {
-	// Simple check to make sure the file we are tailing doesn't
-	// have a position already saved which is past the end of the file.
+	labels string, encoding string, pollOptions watch.PollingFileWatcherOptions, tailFromEnd bool, fingerprintSize int64) (*tailer, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -60,6 +99,25 @@ func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, p
 		return nil, err
 	}
 
+	var (
+		fp        fingerprint
+		renamed   []renamedFile
+		rotations []rotation
+	)
+	if fingerprintSize > 0 {
+		var found bool
+		fp, err = computeFingerprint(path, fingerprintSize)
+		if err != nil {
+			return nil, err
+		}
+		pos, found, renamed, rotations = resolvePosition(positions, path, labels, fp)
+		if found {
+			level.Debug(logger).Log("msg", "resumed file by fingerprint", "path", path, "fingerprint", fp, "position", pos)
+		}
+	}
+
+	// Simple check to make sure the file we are tailing doesn't
+	// have a position already saved which is past the end of the file.
 	if fi.Size() < pos {
 		positions.Remove(path, labels)
 	}
@@ -75,35 +133,30 @@ func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, p
 		}
 	}
 
-	tail, err := tail.TailFile(path, tail.Config{
-		Follow:    true,
-		Poll:      true,
-		ReOpen:    true,
-		MustExist: true,
-		Location: &tail.SeekInfo{
-			Offset: pos,
-			Whence: 0,
-		},
-		Logger:      util.NewLogAdapter(logger),
-		PollOptions: pollOptions,
-	})
+	tail, err := openTail(logger, path, pos, pollOptions)
 	if err != nil {
 		return nil, err
 	}
 
 	logger = log.With(logger, "component", "tailer")
 	tailer := &tailer{
-		metrics:   metrics,
-		logger:    logger,
-		handler:   loki.AddLabelsMiddleware(model.LabelSet{filenameLabel: model.LabelValue(path)}).Wrap(handler),
-		positions: positions,
-		path:      path,
-		labels:    labels,
-		tail:      tail,
-		running:   atomic.NewBool(false),
-		posquit:   make(chan struct{}),
-		posdone:   make(chan struct{}),
-		done:      make(chan struct{}),
+		metrics:         metrics,
+		logger:          logger,
+		handler:         loki.AddLabelsMiddleware(model.LabelSet{filenameLabel: model.LabelValue(path)}).Wrap(handler),
+		positions:       positions,
+		path:            path,
+		labels:          labels,
+		pollOptions:     pollOptions,
+		tail:            tail,
+		fingerprint:     fp,
+		rotations:       rotations,
+		lastPos:         pos,
+		fingerprintSize: fingerprintSize,
+		finishQuit:      make(chan struct{}),
+		running:         atomic.NewBool(false),
+		posquit:         make(chan struct{}),
+		posdone:         make(chan struct{}),
+		done:            make(chan struct{}),
 	}
 
 	if encoding != "" {
@@ -116,12 +169,143 @@ func newTailer(metrics *metrics, logger log.Logger, handler loki.EntryHandler, p
 		tailer.decoder = decoder
 	}
 
+	for _, rf := range renamed {
+		tailer.finishWg.Add(1)
+		go tailer.finishRenamed(rf)
+	}
 	go tailer.readLines()
 	go tailer.updatePosition()
 	metrics.filesActive.Add(1.)
 	return tailer, nil
 }
 
+func openTail(logger log.Logger, path string, pos int64, pollOptions watch.PollingFileWatcherOptions) (*tail.Tail, error) {
+	return tail.TailFile(path, tail.Config{
+		Follow:    true,
+		Poll:      true,
+		ReOpen:    true,
+		MustExist: true,
+		Location: &tail.SeekInfo{
+			Offset: pos,
+			Whence: 0,
+		},
+		Logger:      util.NewLogAdapter(logger),
+		PollOptions: pollOptions,
+	})
+}
+
+// resolvePosition looks up the files tracked by fingerprint at path, and
+// returns the position to read the file identified by fp from, and whether it
+// was found. If other files were tracked at path, then the file at path is a
+// new file which is read from the start, the tracked files which were
+// renamed are returned so that their remaining lines are read, and the others
+// are forgotten.
+//
+// The path position is returned when no file is tracked at path, for
+// positions files written before files were tracked by fingerprint.
+func resolvePosition(positions positions.Positions, path, labels string, fp fingerprint) (pos int64, found bool, renamed []renamedFile, rotations []rotation) {
+	files := positions.GetFiles(path, labels)
+	if len(files) == 0 {
+		pos, _ = positions.Get(path, labels)
+		return pos, false, nil, nil
+	}
+
+	for key, offset := range files {
+		tracked, err := parseFingerprint(key)
+		if err != nil {
+			positions.RemoveFile(key, labels)
+			continue
+		}
+
+		if ok, _ := tracked.matches(path); ok {
+			// fp may have grown past tracked, in which case the file is
+			// tracked under fp from now on.
+			if tracked != fp {
+				positions.RemoveFile(key, labels)
+			}
+			pos, found = offset, true
+			continue
+		}
+
+		positions.RemoveFile(key, labels)
+		if tracked.inode == fp.inode {
+			// The inode was kept, but not the first bytes: the file was
+			// truncated or the inode was reused.
+			rotations = append(rotations, rotation{Time: time.Now(), Kind: rotationTruncated, Fingerprint: key})
+			continue
+		}
+		if target, ok := findRenamed(filepath.Dir(path), tracked); ok {
+			renamed = append(renamed, renamedFile{fingerprint: tracked, path: target, offset: offset})
+			rotations = append(rotations, rotation{Time: time.Now(), Kind: rotationRenamed, Fingerprint: key, RenamedTo: target})
+		}
+	}
+
+	// The file may have been truncated while keeping its first bytes.
+	if fi, err := os.Stat(path); found && err == nil && fi.Size() < pos {
+		pos = 0
+	}
+	return pos, found, renamed, rotations
+}
+
+// finishRenamed reads the remaining lines of a file which was renamed before
+// the tailer noticed, then stops tracking it. Its position is kept if the
+// tailer is stopped before it's done, so that it's finished the next time the
+// path is tailed.
+func (t *tailer) finishRenamed(rf renamedFile) {
+	defer t.finishWg.Done()
+
+	key := rf.fingerprint.String()
+	level.Info(t.logger).Log("msg", "reading remaining lines of renamed file", "path", t.path, "renamed_to", rf.path, "position", rf.offset)
+
+	f, err := os.Open(rf.path)
+	if err != nil {
+		level.Error(t.logger).Log("msg", "failed to open renamed file", "path", t.path, "renamed_to", rf.path, "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(rf.offset, io.SeekStart); err != nil {
+		level.Error(t.logger).Log("msg", "failed to seek renamed file", "path", t.path, "renamed_to", rf.path, "error", err)
+		return
+	}
+
+	var (
+		entries = t.handler.Chan()
+		r       = bufio.NewReader(f)
+		pos     = rf.offset
+	)
+	for {
+		select {
+		case <-t.finishQuit:
+			t.positions.PutFile(key, t.path, t.labels, pos)
+			return
+		default:
+		}
+
+		line, err := r.ReadString('\n')
+		if line != "" {
+			pos += int64(len(line))
+			t.metrics.readLines.WithLabelValues(t.path).Inc()
+			entries <- loki.Entry{
+				Labels: model.LabelSet{},
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      t.decode(strings.TrimRight(line, "\r\n")),
+				},
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			level.Error(t.logger).Log("msg", "error reading renamed file", "path", t.path, "renamed_to", rf.path, "error", err)
+			t.positions.PutFile(key, t.path, t.labels, pos)
+			return
+		}
+	}
+
+	t.positions.RemoveFile(key, t.labels)
+	level.Info(t.logger).Log("msg", "finished reading renamed file", "path", t.path, "renamed_to", rf.path)
+}
+
 // getLastLinePosition returns the offset of the start of the last line in the file at the given path.
 // It will read chunks of bytes starting from the end of the file to return the position of the last '\n' + 1.
 // If it cannot find any '\n' it will return 0.
@@ -197,10 +381,13 @@ func (t *tailer) updatePosition() {
 	for {
 		select {
 		case <-positionWait.C:
+			if t.fingerprintSize > 0 {
+				t.checkFingerprint()
+			}
 			err := t.MarkPositionAndSize()
 			if err != nil {
 				level.Error(t.logger).Log("msg", "position timer: error getting tail position and/or size, stopping tailer", "path", t.path, "error", err)
-				err := t.tail.Stop()
+				err := t.currentTail().Stop()
 				if err != nil {
 					level.Error(t.logger).Log("msg", "position timer: error stopping tailer", "path", t.path, "error", err)
 				}
@@ -233,10 +420,16 @@ func (t *tailer) readLines() {
 		close(t.posquit)
 	}()
 	entries := t.handler.Chan()
+	tl := t.currentTail()
 	for {
-		line, ok := <-t.tail.Lines
+		line, ok := <-tl.Lines
 		if !ok {
-			level.Info(t.logger).Log("msg", "tail routine: tail channel closed, stopping tailer", "path", t.path, "reason", t.tail.Tomb.Err())
+			// The underlying tailer is replaced when the file is reopened.
+			if next := t.currentTail(); next != tl {
+				tl = next
+				continue
+			}
+			level.Info(t.logger).Log("msg", "tail routine: tail channel closed, stopping tailer", "path", t.path, "reason", tl.Tomb.Err())
 			return
 		}
 
@@ -246,30 +439,103 @@ func (t *tailer) readLines() {
 			continue
 		}
 
-		var text string
-		if t.decoder != nil {
-			var err error
-			text, err = t.convertToUTF8(line.Text)
-			if err != nil {
-				level.Debug(t.logger).Log("msg", "failed to convert encoding", "error", err)
-				t.metrics.encodingFailures.WithLabelValues(t.path).Inc()
-				text = fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent Flow: %s", err.Error())
-			}
-		} else {
-			text = line.Text
-		}
-
 		t.metrics.readLines.WithLabelValues(t.path).Inc()
 		entries <- loki.Entry{
 			Labels: model.LabelSet{},
 			Entry: logproto.Entry{
 				Timestamp: line.Time,
-				Line:      text,
+				Line:      t.decode(line.Text),
 			},
 		}
 	}
 }
 
+// decode converts text to UTF-8 if an encoding was configured.
+func (t *tailer) decode(text string) string {
+	if t.decoder == nil {
+		return text
+	}
+	res, err := t.convertToUTF8(text)
+	if err != nil {
+		level.Debug(t.logger).Log("msg", "failed to convert encoding", "error", err)
+		t.metrics.encodingFailures.WithLabelValues(t.path).Inc()
+		return fmt.Sprintf("the requested encoding conversion for this line failed in Grafana Agent Flow: %s", err.Error())
+	}
+	return res
+}
+
+func (t *tailer) currentTail() *tail.Tail {
+	t.posAndSizeMtx.Lock()
+	defer t.posAndSizeMtx.Unlock()
+	return t.tail
+}
+
+// checkFingerprint compares the file at the tailed path with the tailed file.
+//
+// Renamed files are read until their end and reopened by the underlying
+// tailer, which also reopens files it sees shrinking. A file truncated and
+// rewritten past its previous size between two polls isn't seen shrinking,
+// its first bytes changed though, and checkFingerprint reopens it from the
+// start.
+func (t *tailer) checkFingerprint() {
+	cur, err := computeFingerprint(t.path, t.fingerprintSize)
+	if err != nil {
+		// The file was renamed and not recreated yet.
+		return
+	}
+
+	var old *tail.Tail
+	defer func() {
+		if old == nil {
+			return
+		}
+		if err := old.Stop(); err != nil {
+			level.Error(t.logger).Log("msg", "error stopping tailer of truncated file", "path", t.path, "error", err)
+		}
+	}()
+
+	t.posAndSizeMtx.Lock()
+	defer t.posAndSizeMtx.Unlock()
+
+	prev := t.fingerprint
+	if cur == prev {
+		return
+	}
+
+	switch ok, _ := prev.matches(t.path); {
+	case ok:
+		// The file grew, the fingerprint covers more of it.
+	case cur.inode != prev.inode:
+		target, _ := findRenamed(filepath.Dir(t.path), prev)
+		level.Info(t.logger).Log("msg", "file was renamed", "path", t.path, "renamed_to", target)
+		t.recordRotation(rotation{Time: time.Now(), Kind: rotationRenamed, Fingerprint: prev.String(), RenamedTo: target})
+	default:
+		level.Info(t.logger).Log("msg", "file was truncated", "path", t.path)
+		t.recordRotation(rotation{Time: time.Now(), Kind: rotationTruncated, Fingerprint: prev.String()})
+
+		// The underlying tailer reopened the file if it's behind the last
+		// recorded position, otherwise it missed the truncation.
+		if pos, err := t.tail.Tell(); err == nil && pos >= t.lastPos && !t.stopping {
+			tl, err := openTail(t.logger, t.path, 0, t.pollOptions)
+			if err != nil {
+				level.Error(t.logger).Log("msg", "failed to reopen truncated file", "path", t.path, "error", err)
+			} else {
+				old, t.tail = t.tail, tl
+			}
+		}
+	}
+
+	t.positions.RemoveFile(prev.String(), t.labels)
+	t.fingerprint = cur
+}
+
+func (t *tailer) recordRotation(r rotation) {
+	t.rotations = append(t.rotations, r)
+	if len(t.rotations) > maxRotations {
+		t.rotations = t.rotations[len(t.rotations)-maxRotations:]
+	}
+}
+
 func (t *tailer) MarkPositionAndSize() error {
 	// Lock this update as there are 2 timers calling this routine, the sync in filetarget and the positions sync in this file.
 	t.posAndSizeMtx.Lock()
@@ -294,6 +560,10 @@ func (t *tailer) MarkPositionAndSize() error {
 	t.metrics.totalBytes.WithLabelValues(t.path).Set(float64(size))
 	t.metrics.readBytes.WithLabelValues(t.path).Set(float64(pos))
 	t.positions.Put(t.path, t.labels, pos)
+	if t.fingerprintSize > 0 {
+		t.positions.PutFile(t.fingerprint.String(), t.path, t.labels, pos)
+	}
+	t.lastPos = pos
 
 	return nil
 }
@@ -308,8 +578,12 @@ func (t *tailer) Stop() {
 			level.Error(t.logger).Log("msg", "error marking file position when stopping tailer", "path", t.path, "error", err)
 		}
 
-		// Stop the underlying tailer
-		err = t.tail.Stop()
+		// Stop the underlying tailer, making sure it's not replaced anymore.
+		t.posAndSizeMtx.Lock()
+		t.stopping = true
+		tl := t.tail
+		t.posAndSizeMtx.Unlock()
+		err = tl.Stop()
 		if err != nil {
 			level.Error(t.logger).Log("msg", "error stopping tailer", "path", t.path, "error", err)
 		}
@@ -317,6 +591,9 @@ func (t *tailer) Stop() {
 		<-t.done
 		// Wait for the position marker thread to exit
 		<-t.posdone
+		// Wait for renamed files to be read or their positions to be saved
+		close(t.finishQuit)
+		t.finishWg.Wait()
 		level.Info(t.logger).Log("msg", "stopped tailing file", "path", t.path)
 		t.handler.Stop()
 	})
@@ -347,3 +624,18 @@ func (t *tailer) cleanupMetrics() {
 func (t *tailer) Path() string {
 	return t.path
 }
+
+func (t *tailer) Fingerprint() string {
+	if t.fingerprintSize == 0 {
+		return ""
+	}
+	t.posAndSizeMtx.Lock()
+	defer t.posAndSizeMtx.Unlock()
+	return t.fingerprint.String()
+}
+
+func (t *tailer) Rotations() []rotation {
+	t.posAndSizeMtx.Lock()
+	defer t.posAndSizeMtx.Unlock()
+	return append([]rotation(nil), t.rotations...)
+}
@@ -0,0 +1,228 @@
+package fluentforward
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/alecthomas/units"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	ft "github.com/grafana/agent/component/loki/source/fluentforward/internal/fluentforwardtarget"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/river/rivertypes"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name: "loki.source.fluentforward",
+		Args: Arguments{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Arguments holds values which are used to configure the
+// loki.source.fluentforward component.
+type Arguments struct {
+	ListenAddress        string              `river:"listen_address,attr,optional"`
+	Labels               map[string]string   `river:"labels,attr,optional"`
+	UseIncomingTimestamp bool                `river:"use_incoming_timestamp,attr,optional"`
+	MessageKey           string              `river:"message_key,attr,optional"`
+	StructuredMetadata   []string            `river:"structured_metadata,attr,optional"`
+	MaxMessageSize       units.Base2Bytes    `river:"max_message_size,attr,optional"`
+	TLSConfig            *config.TLSConfig   `river:"tls_config,block,optional"`
+	Security             *SecurityConfig     `river:"security,block,optional"`
+	ForwardTo            []loki.LogsReceiver `river:"forward_to,attr"`
+	RelabelRules         flow_relabel.Rules  `river:"relabel_rules,attr,optional"`
+}
+
+// SecurityConfig configures the shared key authentication of clients.
+type SecurityConfig struct {
+	SharedKey    rivertypes.Secret `river:"shared_key,attr"`
+	SelfHostname string            `river:"self_hostname,attr,optional"`
+}
+
+// DefaultArguments provides the default arguments for the
+// loki.source.fluentforward component.
+var DefaultArguments = Arguments{
+	ListenAddress:  "0.0.0.0:24224",
+	MessageKey:     "log",
+	MaxMessageSize: ft.DefaultMaxMessageSize,
+}
+
+// SetToDefault implements river.Defaulter.
+func (a *Arguments) SetToDefault() {
+	*a = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	if a.ListenAddress == "" {
+		return fmt.Errorf("listen_address must not be empty")
+	}
+	if a.MaxMessageSize <= 0 {
+		return fmt.Errorf("max_message_size must be greater than 0")
+	}
+	if a.Security != nil && a.Security.SharedKey == "" {
+		return fmt.Errorf("security shared_key must not be empty")
+	}
+	return nil
+}
+
+// convert is used to bridge between the River and the target types.
+func (a *Arguments) convert() *ft.Config {
+	lbls := make(model.LabelSet, len(a.Labels))
+	for k, v := range a.Labels {
+		lbls[model.LabelName(k)] = model.LabelValue(v)
+	}
+
+	cfg := &ft.Config{
+		ListenAddress:        a.ListenAddress,
+		Labels:               lbls,
+		UseIncomingTimestamp: a.UseIncomingTimestamp,
+		MessageKey:           a.MessageKey,
+		StructuredMetadata:   a.StructuredMetadata,
+		TLSConfig:            a.TLSConfig.Convert(),
+		MaxMessageSize:       int(a.MaxMessageSize),
+	}
+	if a.Security != nil {
+		cfg.SharedKey = string(a.Security.SharedKey)
+		cfg.SelfHostname = a.Security.SelfHostname
+		if cfg.SelfHostname == "" {
+			cfg.SelfHostname, _ = os.Hostname()
+		}
+	}
+	return cfg
+}
+
+// Component implements the loki.source.fluentforward component.
+type Component struct {
+	opts    component.Options
+	metrics *ft.Metrics
+
+	mut    sync.RWMutex
+	args   Arguments
+	fanout []loki.LogsReceiver
+	target *ft.Target
+
+	handler loki.LogsReceiver
+}
+
+// New creates a new loki.source.fluentforward component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	c := &Component{
+		opts:    o,
+		metrics: ft.NewMetrics(o.Registerer),
+		handler: loki.NewLogsReceiver(),
+		fanout:  args.ForwardTo,
+	}
+
+	// Call to Update() to start the listener and set receivers once at the
+	// start.
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		level.Info(c.opts.Logger).Log("msg", "loki.source.fluentforward component shutting down, stopping listener")
+		c.mut.Lock()
+		defer c.mut.Unlock()
+		c.stopTarget()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry := <-c.handler.Chan():
+			c.mut.RLock()
+			for _, receiver := range c.fanout {
+				receiver.Chan() <- entry
+			}
+			c.mut.RUnlock()
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.fanout = newArgs.ForwardTo
+
+	if c.target != nil && reflect.DeepEqual(c.args.convert(), newArgs.convert()) &&
+		reflect.DeepEqual(c.args.RelabelRules, newArgs.RelabelRules) {
+		c.args = newArgs
+		return nil
+	}
+	c.stopTarget()
+
+	var rcs []*relabel.Config
+	if len(newArgs.RelabelRules) > 0 {
+		rcs = flow_relabel.ComponentToPromRelabelConfigs(newArgs.RelabelRules)
+	}
+
+	entryHandler := loki.NewEntryHandler(c.handler.Chan(), func() {})
+	t, err := ft.NewTarget(c.metrics, c.opts.Logger, entryHandler, rcs, newArgs.convert())
+	if err != nil {
+		return err
+	}
+	c.target = t
+	c.args = newArgs
+
+	return nil
+}
+
+// stopTarget stops the current target, if any. It must be called with mut
+// held.
+func (c *Component) stopTarget() {
+	if c.target == nil {
+		return
+	}
+	if err := c.target.Stop(); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "error while stopping fluent forward listener", "err", err)
+	}
+	c.target = nil
+}
+
+// DebugInfo returns information about the status of the listener.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res listenerInfo
+	if c.target != nil {
+		res = listenerInfo{
+			Ready:         c.target.Ready(),
+			ListenAddress: c.target.ListenAddress().String(),
+			Labels:        c.target.Labels().String(),
+			TLS:           c.args.TLSConfig != nil,
+			SharedKey:     c.args.Security != nil,
+		}
+	}
+	return res
+}
+
+type listenerInfo struct {
+	Ready         bool   `river:"ready,attr"`
+	ListenAddress string `river:"listen_address,attr"`
+	Labels        string `river:"labels,attr"`
+	TLS           bool   `river:"tls,attr"`
+	SharedKey     bool   `river:"shared_key,attr"`
+}
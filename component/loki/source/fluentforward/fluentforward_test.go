@@ -0,0 +1,98 @@
+package fluentforward
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/river"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/phayes/freeport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFluentForward(t *testing.T) {
+	opts := component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		OnStateChange: func(e component.Exports) {},
+	}
+
+	ch1, ch2 := loki.NewLogsReceiver(), loki.NewLogsReceiver()
+	args := DefaultArguments
+	args.ListenAddress = getFreeAddr(t)
+	args.Labels = map[string]string{"job": "fluent"}
+	args.ForwardTo = []loki.LogsReceiver{ch1, ch2}
+	rule := flow_relabel.DefaultRelabelConfig
+	rule.SourceLabels = []string{"__fluentforward_tag"}
+	rule.TargetLabel = "tag"
+	args.RelabelRules = flow_relabel.Rules{&rule}
+
+	c, err := New(opts, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go c.Run(ctx)
+
+	conn, err := net.Dial("tcp", args.ListenAddress)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	msg := []interface{}{"docker.app", time.Now().Unix(), map[string]interface{}{"log": "hello"}}
+	require.NoError(t, codec.NewEncoder(conn, &codec.MsgpackHandle{}).Encode(msg))
+
+	for _, ch := range []loki.LogsReceiver{ch1, ch2} {
+		select {
+		case <-ctx.Done():
+			require.FailNow(t, "timed out waiting for entry")
+		case e := <-ch.Chan():
+			require.Equal(t, "hello", e.Line)
+			require.Equal(t, model.LabelSet{"job": "fluent", "tag": "docker.app"}, e.Labels)
+		}
+	}
+
+	info := c.DebugInfo().(listenerInfo)
+	require.True(t, info.Ready)
+	require.Equal(t, args.ListenAddress, info.ListenAddress)
+}
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		forward_to = []
+		security {
+			shared_key = "secret"
+		}
+	`), &args))
+	require.Equal(t, "0.0.0.0:24224", args.ListenAddress)
+	require.Equal(t, "log", args.MessageKey)
+
+	cfg := args.convert()
+	require.Equal(t, "secret", cfg.SharedKey)
+	require.NotEmpty(t, cfg.SelfHostname)
+
+	require.ErrorContains(t, river.Unmarshal([]byte(`
+		forward_to = []
+		security {
+			shared_key = ""
+		}
+	`), &args), "shared_key must not be empty")
+}
+
+func getFreeAddr(t *testing.T) string {
+	t.Helper()
+
+	portNumber, err := freeport.GetFreePort()
+	require.NoError(t, err)
+
+	return fmt.Sprintf("127.0.0.1:%d", portNumber)
+}
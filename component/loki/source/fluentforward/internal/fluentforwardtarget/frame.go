@@ -0,0 +1,196 @@
+package fluentforwardtarget
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/go-msgpack/codec"
+)
+
+// maxFrameDepth is the maximum nesting of msgpack containers in a message.
+// The decoder recurses into containers.
+const maxFrameDepth = 64
+
+// errFrameTooLarge is returned for messages larger than the maximum message
+// size.
+var errFrameTooLarge = errors.New("message exceeds the maximum message size")
+
+// frameReader reads msgpack objects from a stream without trusting the
+// lengths they declare: an object is only decoded once all its bytes, up to
+// a maximum size, were read. The decoder allocates containers and strings
+// with the lengths declared by the stream, so decoding straight from the
+// stream lets a client exhaust memory with a few bytes.
+type frameReader struct {
+	r   *bufio.Reader
+	max int
+	buf bytes.Buffer
+}
+
+func newFrameReader(r io.Reader, max int) *frameReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &frameReader{r: br, max: max}
+}
+
+// Decode reads the next msgpack object of the stream into v. It returns
+// io.EOF if the stream ended before the object.
+func (f *frameReader) Decode(v interface{}) error {
+	frame, err := f.next()
+	if err != nil {
+		return err
+	}
+	return codec.NewDecoderBytes(frame, decodeHandle).Decode(v)
+}
+
+// next returns the bytes of the next msgpack object.
+func (f *frameReader) next() ([]byte, error) {
+	// Decoded values may share memory with the frame, it can't be reused.
+	f.buf = bytes.Buffer{}
+
+	// pending holds the number of objects left to read at each nesting level.
+	pending := []int{1}
+	for len(pending) > 0 {
+		if pending[len(pending)-1] == 0 {
+			pending = pending[:len(pending)-1]
+			continue
+		}
+		pending[len(pending)-1]--
+
+		b, err := f.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && f.buf.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if err := f.write([]byte{b}); err != nil {
+			return nil, err
+		}
+
+		elems, payload, err := f.header(b)
+		if err != nil {
+			return nil, err
+		}
+		if payload > 0 {
+			if payload > int64(f.max-f.buf.Len()) {
+				return nil, errFrameTooLarge
+			}
+			if _, err := io.CopyN(&f.buf, f.r, payload); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+		}
+		if elems > 0 {
+			// Every object is at least one byte long.
+			if elems > int64(f.max-f.buf.Len()) {
+				return nil, errFrameTooLarge
+			}
+			if len(pending) == maxFrameDepth {
+				return nil, fmt.Errorf("message exceeds the maximum nesting of %d", maxFrameDepth)
+			}
+			pending = append(pending, int(elems))
+		}
+	}
+	return f.buf.Bytes(), nil
+}
+
+// header reads the rest of the header of the object starting with b, and
+// returns the number of objects it contains and the length of its payload.
+func (f *frameReader) header(b byte) (elems int64, payload int64, err error) {
+	switch {
+	case b <= 0x7f, b >= 0xe0, b == 0xc0, b == 0xc2, b == 0xc3:
+		// Fixed integers, nil and booleans.
+		return 0, 0, nil
+	case b >= 0x80 && b <= 0x8f:
+		return 2 * int64(b&0x0f), 0, nil
+	case b >= 0x90 && b <= 0x9f:
+		return int64(b & 0x0f), 0, nil
+	case b >= 0xa0 && b <= 0xbf:
+		return 0, int64(b & 0x1f), nil
+	}
+
+	switch b {
+	case 0xc4, 0xd9: // bin8, str8
+		n, err := f.uint(1)
+		return 0, n, err
+	case 0xc5, 0xda: // bin16, str16
+		n, err := f.uint(2)
+		return 0, n, err
+	case 0xc6, 0xdb: // bin32, str32
+		n, err := f.uint(4)
+		return 0, n, err
+	case 0xc7: // ext8
+		n, err := f.uint(1)
+		return 0, n + 1, err
+	case 0xc8: // ext16
+		n, err := f.uint(2)
+		return 0, n + 1, err
+	case 0xc9: // ext32
+		n, err := f.uint(4)
+		return 0, n + 1, err
+	case 0xcc, 0xd0: // uint8, int8
+		return 0, 1, nil
+	case 0xcd, 0xd1: // uint16, int16
+		return 0, 2, nil
+	case 0xca, 0xce, 0xd2: // float32, uint32, int32
+		return 0, 4, nil
+	case 0xcb, 0xcf, 0xd3: // float64, uint64, int64
+		return 0, 8, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext1 to fixext16
+		return 0, 1 + 1<<(b-0xd4), nil
+	case 0xdc: // array16
+		n, err := f.uint(2)
+		return n, 0, err
+	case 0xdd: // array32
+		n, err := f.uint(4)
+		return n, 0, err
+	case 0xde: // map16
+		n, err := f.uint(2)
+		return 2 * n, 0, err
+	case 0xdf: // map32
+		n, err := f.uint(4)
+		return 2 * n, 0, err
+	default:
+		return 0, 0, fmt.Errorf("invalid msgpack type 0x%x", b)
+	}
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (f *frameReader) uint(size int) (int64, error) {
+	var bb [4]byte
+	if _, err := io.ReadFull(f.r, bb[:size]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if err := f.write(bb[:size]); err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return int64(bb[0]), nil
+	case 2:
+		return int64(binary.BigEndian.Uint16(bb[:2])), nil
+	default:
+		return int64(binary.BigEndian.Uint32(bb[:4])), nil
+	}
+}
+
+func (f *frameReader) write(b []byte) error {
+	if f.buf.Len()+len(b) > f.max {
+		return errFrameTooLarge
+	}
+	f.buf.Write(b)
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
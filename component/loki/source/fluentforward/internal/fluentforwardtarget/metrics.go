@@ -0,0 +1,54 @@
+package fluentforwardtarget
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics holds a set of Fluent Forward metrics.
+type Metrics struct {
+	reg prometheus.Registerer
+
+	connections       prometheus.Counter
+	entries           prometheus.Counter
+	parsingErrors     prometheus.Counter
+	acks              prometheus.Counter
+	handshakeFailures prometheus.Counter
+}
+
+// NewMetrics creates a new set of Fluent Forward metrics. If reg is non-nil,
+// the metrics will be registered.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	var m Metrics
+	m.reg = reg
+
+	m.connections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_fluentforward_connections_total",
+		Help: "Total number of connections accepted by the Fluent Forward listener",
+	})
+	m.entries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_fluentforward_entries_total",
+		Help: "Total number of successful entries sent to the Fluent Forward listener",
+	})
+	m.parsingErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_fluentforward_parsing_errors_total",
+		Help: "Total number of parsing errors while receiving Fluent Forward messages",
+	})
+	m.acks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_fluentforward_acks_total",
+		Help: "Total number of chunks acknowledged to Fluent Forward clients",
+	})
+	m.handshakeFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "loki_source_fluentforward_handshake_failures_total",
+		Help: "Total number of failed Fluent Forward handshakes",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.connections,
+			m.entries,
+			m.parsingErrors,
+			m.acks,
+			m.handshakeFailures,
+		)
+	}
+
+	return &m
+}
@@ -0,0 +1,317 @@
+package fluentforwardtarget
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/hashicorp/go-msgpack/codec"
+)
+
+// The Forward protocol is described in
+// https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1.
+
+var (
+	// decodeHandle decodes msgpack strings as Go strings, and binaries as
+	// byte slices.
+	decodeHandle = &codec.MsgpackHandle{RawToString: true}
+	// encodeHandle encodes byte slices as msgpack binaries, which is required
+	// by some clients for the handshake.
+	encodeHandle = &codec.MsgpackHandle{WriteExt: true}
+)
+
+// eventTimeExtType is the msgpack extension type of EventTime, which holds
+// timestamps with a nanosecond precision.
+const eventTimeExtType = 0
+
+// event is a single Fluent event.
+type event struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// message is a Forward protocol message, with its events and the chunk to
+// acknowledge, if any.
+type message struct {
+	events []event
+	chunk  string
+}
+
+// decodeMessage decodes a message in the Message, Forward, PackedForward or
+// CompressedPackedForward mode.
+// Packed entries larger than maxSize are rejected.
+func decodeMessage(arr []interface{}, maxSize int) (*message, error) {
+	if len(arr) < 2 {
+		return nil, fmt.Errorf("invalid message with %d elements", len(arr))
+	}
+	tag, ok := toString(arr[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid tag of type %T", arr[0])
+	}
+
+	var (
+		msg     message
+		options interface{}
+	)
+	switch entries := arr[1].(type) {
+	case []interface{}:
+		// Forward mode: [tag, [[time, record], ...], option]
+		if len(arr) > 2 {
+			options = arr[2]
+		}
+		for _, entry := range entries {
+			ev, err := decodeEntry(tag, entry)
+			if err != nil {
+				return nil, err
+			}
+			msg.events = append(msg.events, ev)
+		}
+
+	case string, []byte:
+		// PackedForward mode: [tag, msgpack-encoded entries, option]
+		if len(arr) > 2 {
+			options = arr[2]
+		}
+		events, err := decodePackedEntries(tag, entries, options, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		msg.events = events
+
+	default:
+		// Message mode: [tag, time, record, option]
+		if len(arr) < 3 {
+			return nil, fmt.Errorf("invalid message with %d elements", len(arr))
+		}
+		if len(arr) > 3 {
+			options = arr[3]
+		}
+		ev, err := decodeEntry(tag, []interface{}{arr[1], arr[2]})
+		if err != nil {
+			return nil, err
+		}
+		msg.events = []event{ev}
+	}
+
+	if options, ok := normalize(options).(map[string]interface{}); ok {
+		if chunk, ok := toString(options["chunk"]); ok {
+			msg.chunk = chunk
+		}
+	}
+	return &msg, nil
+}
+
+// decodePackedEntries decodes the entries of a PackedForward message, which
+// are compressed with gzip in the CompressedPackedForward mode. Entries
+// larger than maxSize are rejected.
+func decodePackedEntries(tag string, entries interface{}, options interface{}, maxSize int) ([]event, error) {
+	data, _ := toBytes(entries)
+
+	var r io.Reader = bytes.NewReader(data)
+	if options, ok := normalize(options).(map[string]interface{}); ok {
+		switch compressed, _ := toString(options["compressed"]); compressed {
+		case "", "text":
+		case "gzip":
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("decompressing entries: %w", err)
+			}
+			defer gr.Close()
+
+			// The decompressed entries are bounded like messages, one more
+			// byte is read to detect larger ones.
+			data, err := io.ReadAll(io.LimitReader(gr, int64(maxSize)+1))
+			if err != nil {
+				return nil, fmt.Errorf("decompressing entries: %w", err)
+			}
+			if len(data) > maxSize {
+				return nil, fmt.Errorf("decompressing entries: %w", errFrameTooLarge)
+			}
+			r = bytes.NewReader(data)
+		default:
+			return nil, fmt.Errorf("unsupported compression %q", compressed)
+		}
+	}
+
+	var (
+		events []event
+		dec    = newFrameReader(r, maxSize)
+	)
+	for {
+		var entry interface{}
+		if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+			return events, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding packed entries: %w", err)
+		}
+
+		ev, err := decodeEntry(tag, entry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// decodeEntry decodes a [time, record] entry.
+func decodeEntry(tag string, entry interface{}) (event, error) {
+	arr, ok := entry.([]interface{})
+	if !ok || len(arr) != 2 {
+		return event{}, fmt.Errorf("invalid entry of type %T", entry)
+	}
+
+	ts, err := decodeTime(arr[0])
+	if err != nil {
+		return event{}, err
+	}
+	record, ok := normalize(arr[1]).(map[string]interface{})
+	if !ok {
+		return event{}, fmt.Errorf("invalid record of type %T", arr[1])
+	}
+
+	return event{tag: tag, time: ts, record: record}, nil
+}
+
+// decodeTime decodes an event time, which is either an EventTime or a number
+// of seconds.
+func decodeTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case int64:
+		return time.Unix(v, 0), nil
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	case codec.RawExt:
+		if v.Tag != eventTimeExtType || len(v.Data) != 8 {
+			return time.Time{}, fmt.Errorf("invalid time extension %d of %d bytes", v.Tag, len(v.Data))
+		}
+		sec := binary.BigEndian.Uint32(v.Data[:4])
+		nsec := binary.BigEndian.Uint32(v.Data[4:])
+		return time.Unix(int64(sec), int64(nsec)), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid time of type %T", v)
+	}
+}
+
+// normalize converts the maps decoded by msgpack to maps with string keys,
+// and byte slices to strings, so that records can be encoded to JSON.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, v := range v {
+			key, ok := toString(k)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			res[key] = normalize(v)
+		}
+		return res
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalize(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalize(val)
+		}
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+func toString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	default:
+		return "", false
+	}
+}
+
+func toBytes(v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// handshake authenticates a client with a shared key. It sends a HELO
+// message, checks the digest of the PING message of the client, and answers
+// with a PONG message.
+func handshake(dec *frameReader, enc *codec.Encoder, selfHostname, sharedKey string) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generating nonce: %w", err)
+	}
+
+	helo := []interface{}{"HELO", map[string]interface{}{
+		"nonce": nonce,
+		// User authentication isn't supported, which is signaled by an empty
+		// salt.
+		"auth":      []byte{},
+		"keepalive": true,
+	}}
+	if err := enc.Encode(helo); err != nil {
+		return fmt.Errorf("sending HELO: %w", err)
+	}
+
+	// PING: ["PING", hostname, shared key salt, shared key digest, username, password digest]
+	var ping []interface{}
+	if err := dec.Decode(&ping); err != nil {
+		return fmt.Errorf("reading PING: %w", err)
+	}
+	if len(ping) < 4 {
+		return fmt.Errorf("invalid PING with %d elements", len(ping))
+	}
+	if kind, _ := toString(ping[0]); kind != "PING" {
+		return fmt.Errorf("expected PING, got %q", kind)
+	}
+	hostname, _ := toString(ping[1])
+	salt, _ := toBytes(ping[2])
+	digest, _ := toString(ping[3])
+
+	expected := sharedKeyDigest(salt, hostname, nonce, sharedKey)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) != 1 {
+		pong := []interface{}{"PONG", false, "shared key mismatch", selfHostname, ""}
+		_ = enc.Encode(pong)
+		return fmt.Errorf("shared key mismatch for client %q", hostname)
+	}
+
+	pong := []interface{}{"PONG", true, "", selfHostname, sharedKeyDigest(salt, selfHostname, nonce, sharedKey)}
+	if err := enc.Encode(pong); err != nil {
+		return fmt.Errorf("sending PONG: %w", err)
+	}
+	return nil
+}
+
+func sharedKeyDigest(salt []byte, hostname string, nonce []byte, sharedKey string) string {
+	h := sha512.New()
+	h.Write(salt)
+	h.Write([]byte(hostname))
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,394 @@
+package fluentforwardtarget
+
+// The fluentforwardtarget package is used to configure and run the targets
+// that can read Fluent Forward messages and forward them to other loki
+// components.
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+)
+
+// Config configures a Target.
+type Config struct {
+	ListenAddress        string
+	Labels               model.LabelSet
+	UseIncomingTimestamp bool
+	// MessageKey is the record field used as log line. The whole record is
+	// encoded to JSON if it's empty or if the record doesn't have it.
+	MessageKey string
+	// StructuredMetadata are the record fields attached to entries as
+	// structured metadata.
+	StructuredMetadata []string
+	// TLSConfig enables TLS if it's non-nil.
+	TLSConfig *config.TLSConfig
+	// SharedKey enables the shared key authentication if it's non-empty.
+	SharedKey    string
+	SelfHostname string
+	// MaxMessageSize is the maximum size of a message in bytes, and of the
+	// decompressed entries of a message.
+	MaxMessageSize int
+}
+
+// DefaultMaxMessageSize is the default maximum size of a message.
+const DefaultMaxMessageSize = 8 << 20
+
+// maxPingSize is the maximum size of the PING message of the handshake, which
+// is read before clients are authenticated.
+const maxPingSize = 4 << 10
+
+// Target listens to Fluent Forward messages over TCP.
+type Target struct {
+	metrics       *Metrics
+	logger        log.Logger
+	handler       loki.EntryHandler
+	config        *Config
+	relabelConfig []*relabel.Config
+
+	listener        net.Listener
+	openConnections sync.WaitGroup
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+}
+
+// NewTarget configures a new Target and starts listening.
+func NewTarget(
+	metrics *Metrics,
+	logger log.Logger,
+	handler loki.EntryHandler,
+	relabel []*relabel.Config,
+	config *Config,
+) (*Target, error) {
+
+	l, err := net.Listen("tcp", config.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up fluent forward target: %w", err)
+	}
+
+	if config.TLSConfig != nil {
+		tlsConfig, err := newTLSConfig(*config.TLSConfig)
+		if err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("error setting up fluent forward target: %w", err)
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Target{
+		metrics:       metrics,
+		logger:        logger,
+		handler:       handler,
+		config:        config,
+		relabelConfig: relabel,
+		listener:      l,
+		ctx:           ctx,
+		ctxCancel:     cancel,
+	}
+	level.Info(logger).Log("msg", "fluent forward listening on address", "address", l.Addr().String(), "tls", config.TLSConfig != nil)
+
+	t.openConnections.Add(1)
+	go t.acceptConnections()
+
+	return t, nil
+}
+
+// newTLSConfig creates TLS server settings from a [config.TLSConfig].
+func newTLSConfig(config config.TLSConfig) (*tls.Config, error) {
+	var (
+		configuredCert = len(config.Cert) > 0 || len(config.CertFile) > 0
+		configuredKey  = len(config.Key) > 0 || len(config.KeyFile) > 0
+	)
+
+	if !configuredCert || !configuredKey {
+		return nil, fmt.Errorf("certificate and key must be configured")
+	}
+
+	certBytes := []byte(config.Cert)
+	if len(config.CertFile) > 0 {
+		bb, err := os.ReadFile(config.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load server certificate: %w", err)
+		}
+		certBytes = bb
+	}
+
+	keyBytes := []byte(config.Key)
+	if len(config.KeyFile) > 0 {
+		bb, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load server key: %w", err)
+		}
+		keyBytes = bb
+	}
+
+	certs, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate or key: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certs},
+		MinVersion:   uint16(config.MinVersion),
+	}
+
+	caBytes := []byte(config.CA)
+	if len(config.CAFile) > 0 {
+		bb, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client CA certificate: %w", err)
+		}
+		caBytes = bb
+	}
+
+	if len(caBytes) > 0 {
+		caCertPool := x509.NewCertPool()
+		if ok := caCertPool.AppendCertsFromPEM(caBytes); !ok {
+			return nil, fmt.Errorf("unable to parse client CA certificate")
+		}
+
+		tlsConfig.ClientCAs = caCertPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func (t *Target) acceptConnections() {
+	defer t.openConnections.Done()
+
+	l := log.With(t.logger, "address", t.listener.Addr().String())
+
+	backoff := backoff.New(t.ctx, backoff.Config{
+		MinBackoff: 5 * time.Millisecond,
+		MaxBackoff: 1 * time.Second,
+	})
+
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			if !t.Ready() {
+				level.Info(l).Log("msg", "fluent forward server shutting down", "err", t.ctx.Err())
+				return
+			}
+
+			if _, ok := err.(net.Error); ok {
+				level.Warn(l).Log("msg", "failed to accept fluent forward connection", "err", err, "num_retries", backoff.NumRetries())
+				backoff.Wait()
+				continue
+			}
+
+			level.Error(l).Log("msg", "failed to accept fluent forward connection. quiting", "err", err)
+			return
+		}
+		backoff.Reset()
+		t.metrics.connections.Inc()
+
+		t.openConnections.Add(1)
+		go t.handleConnection(c)
+	}
+}
+
+func (t *Target) handleConnection(c net.Conn) {
+	defer t.openConnections.Done()
+
+	handlerCtx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	go func() {
+		<-handlerCtx.Done()
+		_ = c.Close()
+	}()
+
+	var (
+		l   = log.With(t.logger, "remote_addr", c.RemoteAddr().String())
+		r   = bufio.NewReader(c)
+		dec = newFrameReader(r, t.config.MaxMessageSize)
+		enc = codec.NewEncoder(c, encodeHandle)
+	)
+
+	if t.config.SharedKey != "" {
+		if err := handshake(newFrameReader(r, maxPingSize), enc, t.config.SelfHostname, t.config.SharedKey); err != nil {
+			level.Warn(l).Log("msg", "fluent forward handshake failed", "err", err)
+			t.metrics.handshakeFailures.Inc()
+			return
+		}
+	}
+
+	for {
+		var arr []interface{}
+		if err := dec.Decode(&arr); err != nil {
+			// The stream can't be resynchronized after invalid msgpack data.
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				level.Warn(l).Log("msg", "error reading fluent forward stream", "err", err)
+				t.metrics.parsingErrors.Inc()
+			}
+			return
+		}
+
+		msg, err := decodeMessage(arr, t.config.MaxMessageSize)
+		if err != nil {
+			level.Warn(l).Log("msg", "error parsing fluent forward message", "err", err)
+			t.metrics.parsingErrors.Inc()
+			continue
+		}
+
+		for _, ev := range msg.events {
+			if !t.handleEvent(handlerCtx, ev) {
+				return
+			}
+		}
+
+		// Chunks are only acknowledged once their events have been handed
+		// over, so that clients resend them otherwise.
+		if msg.chunk != "" {
+			if err := enc.Encode(map[string]interface{}{"ack": msg.chunk}); err != nil {
+				level.Warn(l).Log("msg", "error acknowledging fluent forward chunk", "err", err)
+				return
+			}
+			t.metrics.acks.Inc()
+		}
+	}
+}
+
+// handleEvent sends an event to the handler. It returns false if the target
+// is stopping.
+func (t *Target) handleEvent(ctx context.Context, ev event) bool {
+	lb := labels.NewBuilder(nil)
+	for k, v := range t.config.Labels {
+		lb.Set(string(k), string(v))
+	}
+	lb.Set("__fluentforward_tag", ev.tag)
+	for k, v := range ev.record {
+		if k == t.config.MessageKey {
+			continue
+		}
+		if value, ok := scalarString(v); ok {
+			lb.Set("__fluentforward_record_"+sanitizeLabelName(k), value)
+		}
+	}
+
+	processed, keep := relabel.Process(lb.Labels(), t.relabelConfig...)
+	if !keep {
+		return true
+	}
+
+	filtered := make(model.LabelSet)
+	for _, lbl := range processed {
+		if strings.HasPrefix(lbl.Name, "__") {
+			continue
+		}
+		filtered[model.LabelName(lbl.Name)] = model.LabelValue(lbl.Value)
+	}
+
+	timestamp := time.Now()
+	if t.config.UseIncomingTimestamp {
+		timestamp = ev.time
+	}
+
+	line, ok := toString(ev.record[t.config.MessageKey])
+	if t.config.MessageKey == "" || !ok {
+		bb, err := json.Marshal(ev.record)
+		if err != nil {
+			level.Warn(t.logger).Log("msg", "failed to encode fluent forward record", "err", err)
+			t.metrics.parsingErrors.Inc()
+			return true
+		}
+		line = string(bb)
+	}
+
+	var metadata []logproto.LabelAdapter
+	for _, name := range t.config.StructuredMetadata {
+		if value, ok := scalarString(ev.record[name]); ok {
+			metadata = append(metadata, logproto.LabelAdapter{Name: sanitizeLabelName(name), Value: value})
+		}
+	}
+	sort.Slice(metadata, func(i, j int) bool { return metadata[i].Name < metadata[j].Name })
+
+	entry := loki.Entry{
+		Labels: filtered,
+		Entry: logproto.Entry{
+			Timestamp:          timestamp,
+			Line:               line,
+			StructuredMetadata: metadata,
+		},
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case t.handler.Chan() <- entry:
+		t.metrics.entries.Inc()
+		return true
+	}
+}
+
+// scalarString formats a scalar record value. Maps and arrays aren't
+// scalars.
+func scalarString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool, int64, uint64, float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+// sanitizeLabelName replaces the characters which aren't valid in label names
+// with underscores.
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Ready indicates whether the target is ready to be read from.
+func (t *Target) Ready() bool {
+	return t.ctx.Err() == nil
+}
+
+// ListenAddress returns the address the target listens to.
+func (t *Target) ListenAddress() net.Addr {
+	return t.listener.Addr()
+}
+
+// Labels returns the set of labels that statically apply to all log entries
+// produced by the target.
+func (t *Target) Labels() model.LabelSet {
+	return t.config.Labels
+}
+
+// Stop shuts down the target, closing its connections.
+func (t *Target) Stop() error {
+	t.ctxCancel()
+	err := t.listener.Close()
+	t.openConnections.Wait()
+	return err
+}
@@ -0,0 +1,318 @@
+package fluentforwardtarget
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component/common/loki/client/fake"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func eventTime(ts time.Time) codec.RawExt {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[:4], uint32(ts.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(ts.Nanosecond()))
+	return codec.RawExt{Tag: eventTimeExtType, Data: data}
+}
+
+func packEntries(t *testing.T, entries ...[]interface{}) []byte {
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf, encodeHandle)
+	for _, entry := range entries {
+		require.NoError(t, enc.Encode(entry))
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func relabelConfig(t *testing.T) []*relabel.Config {
+	relabelCfg := `
+- source_labels: ['__fluentforward_tag']
+  target_label: 'tag'
+- source_labels: ['__fluentforward_record_container_name']
+  target_label: 'container_name'
+`
+
+	var relabels []*relabel.Config
+	err := yaml.Unmarshal([]byte(relabelCfg), &relabels)
+	require.NoError(t, err)
+
+	return relabels
+}
+
+func TestTarget(t *testing.T) {
+	ts := time.Date(2023, time.November, 20, 10, 0, 0, 123456789, time.UTC)
+	record := map[string]interface{}{
+		"log":            "hello",
+		"container_name": "/app",
+		"container_id":   "abc",
+	}
+	entry := []interface{}{eventTime(ts), record}
+
+	for _, tt := range []struct {
+		name    string
+		message []interface{}
+		entries int
+	}{
+		{"message", []interface{}{"docker.app", eventTime(ts), record, map[string]interface{}{"chunk": "c1"}}, 1},
+		{"message with integer time", []interface{}{"docker.app", ts.Unix(), record, map[string]interface{}{"chunk": "c1"}}, 1},
+		{"forward", []interface{}{"docker.app", []interface{}{entry, entry}, map[string]interface{}{"chunk": "c1"}}, 2},
+		{"packed forward", []interface{}{"docker.app", packEntries(t, entry, entry), map[string]interface{}{"chunk": "c1", "size": 2}}, 2},
+		{"compressed packed forward", []interface{}{"docker.app", gzipBytes(t, packEntries(t, entry, entry)), map[string]interface{}{"chunk": "c1", "size": 2, "compressed": "gzip"}}, 2},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClient(func() {})
+			defer client.Stop()
+
+			tgt, err := NewTarget(NewMetrics(nil), log.NewNopLogger(), client, relabelConfig(t), &Config{
+				ListenAddress:        "127.0.0.1:0",
+				Labels:               model.LabelSet{"job": "fluentforward"},
+				UseIncomingTimestamp: true,
+				MessageKey:           "log",
+				StructuredMetadata:   []string{"container_id"},
+				MaxMessageSize:       DefaultMaxMessageSize,
+			})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tgt.Stop()) }()
+
+			c, err := net.Dial("tcp", tgt.ListenAddress().String())
+			require.NoError(t, err)
+			defer c.Close()
+
+			require.NoError(t, codec.NewEncoder(c, encodeHandle).Encode(tt.message))
+
+			var ack map[string]interface{}
+			require.NoError(t, codec.NewDecoder(bufio.NewReader(c), decodeHandle).Decode(&ack))
+			require.Equal(t, map[string]interface{}{"ack": "c1"}, normalize(ack))
+
+			received := client.Received()
+			require.Len(t, received, tt.entries)
+			for _, e := range received {
+				require.Equal(t, model.LabelSet{
+					"job":            "fluentforward",
+					"tag":            "docker.app",
+					"container_name": "/app",
+				}, e.Labels)
+				require.Equal(t, "hello", e.Line)
+				require.Equal(t, []logproto.LabelAdapter{{Name: "container_id", Value: "abc"}}, []logproto.LabelAdapter(e.StructuredMetadata))
+				if _, ok := tt.message[1].(int64); ok {
+					require.True(t, e.Timestamp.Equal(ts.Truncate(time.Second)))
+				} else {
+					require.True(t, e.Timestamp.Equal(ts))
+				}
+			}
+		})
+	}
+}
+
+func TestTarget_RecordAsJSON(t *testing.T) {
+	client := fake.NewClient(func() {})
+	defer client.Stop()
+
+	tgt, err := NewTarget(NewMetrics(nil), log.NewNopLogger(), client, nil, &Config{
+		ListenAddress:  "127.0.0.1:0",
+		MessageKey:     "log",
+		MaxMessageSize: DefaultMaxMessageSize,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tgt.Stop()) }()
+
+	c, err := net.Dial("tcp", tgt.ListenAddress().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	record := map[string]interface{}{
+		"message": "hello",
+		"nested":  map[string]interface{}{"level": "info"},
+	}
+	require.NoError(t, codec.NewEncoder(c, encodeHandle).Encode([]interface{}{"app", time.Now().Unix(), record}))
+
+	require.Eventually(t, func() bool {
+		return len(client.Received()) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.JSONEq(t, `{"message":"hello","nested":{"level":"info"}}`, client.Received()[0].Line)
+}
+
+func TestTarget_SharedKey(t *testing.T) {
+	client := fake.NewClient(func() {})
+	defer client.Stop()
+
+	metrics := NewMetrics(nil)
+	tgt, err := NewTarget(metrics, log.NewNopLogger(), client, nil, &Config{
+		ListenAddress:  "127.0.0.1:0",
+		MessageKey:     "log",
+		SharedKey:      "secret",
+		SelfHostname:   "agent",
+		MaxMessageSize: DefaultMaxMessageSize,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tgt.Stop()) }()
+
+	connect := func(sharedKey string) (*codec.Encoder, []interface{}) {
+		c, err := net.Dial("tcp", tgt.ListenAddress().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		var (
+			dec = codec.NewDecoder(bufio.NewReader(c), decodeHandle)
+			enc = codec.NewEncoder(c, encodeHandle)
+		)
+
+		var helo []interface{}
+		require.NoError(t, dec.Decode(&helo))
+		require.Equal(t, "HELO", helo[0])
+		nonce, _ := toBytes(normalize(helo[1]).(map[string]interface{})["nonce"])
+		require.Len(t, nonce, 16)
+
+		salt := []byte("salt")
+		require.NoError(t, enc.Encode([]interface{}{"PING", "client", salt, sharedKeyDigest(salt, "client", nonce, sharedKey), "", ""}))
+
+		var pong []interface{}
+		require.NoError(t, dec.Decode(&pong))
+		if pong[1] == true {
+			require.Equal(t, sharedKeyDigest(salt, "agent", nonce, "secret"), pong[4])
+		}
+		return enc, pong
+	}
+
+	_, pong := connect("wrong")
+	require.Equal(t, []interface{}{"PONG", false, "shared key mismatch", "agent", ""}, pong)
+
+	enc, pong := connect("secret")
+	require.Equal(t, true, pong[1])
+	require.NoError(t, enc.Encode([]interface{}{"app", time.Now().Unix(), map[string]interface{}{"log": "hello"}}))
+	require.Eventually(t, func() bool {
+		return len(client.Received()) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "hello", client.Received()[0].Line)
+}
+
+func TestDecodeMessage_Invalid(t *testing.T) {
+	for _, arr := range [][]interface{}{
+		{"tag"},
+		{1, int64(0), map[string]interface{}{}},
+		{"tag", int64(0)},
+		{"tag", "not a record", map[string]interface{}{}},
+		{"tag", []interface{}{[]interface{}{int64(0)}}},
+		{"tag", []byte{}, map[string]interface{}{"compressed": "zstd"}},
+	} {
+		_, err := decodeMessage(arr, DefaultMaxMessageSize)
+		require.Error(t, err, "%v", arr)
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf, encodeHandle)
+	messages := []interface{}{
+		[]interface{}{"app", int64(-1), 3.5, true, nil, []byte("raw"), eventTime(time.Unix(1, 2))},
+		map[string]interface{}{"log": string(make([]byte, 300)), "n": uint64(1 << 40)},
+		[]interface{}{make([]interface{}, 20)},
+	}
+	for _, msg := range messages {
+		require.NoError(t, enc.Encode(msg))
+	}
+
+	fr := newFrameReader(&buf, 1024)
+	for range messages {
+		var v interface{}
+		require.NoError(t, fr.Decode(&v))
+	}
+	var v interface{}
+	require.ErrorIs(t, fr.Decode(&v), io.EOF)
+}
+
+func TestFrameReader_Invalid(t *testing.T) {
+	for name, tt := range map[string]struct {
+		data []byte
+		err  error
+	}{
+		"array32 larger than the message": {[]byte{0xdd, 0x7f, 0xff, 0xff, 0xff}, errFrameTooLarge},
+		"map32 larger than the message":   {[]byte{0xdf, 0x7f, 0xff, 0xff, 0xff}, errFrameTooLarge},
+		"str32 larger than the message":   {[]byte{0xdb, 0x7f, 0xff, 0xff, 0xff}, errFrameTooLarge},
+		"bin32 larger than the message":   {[]byte{0xc6, 0x7f, 0xff, 0xff, 0xff}, errFrameTooLarge},
+		"truncated message":               {[]byte{0x92, 0x01}, io.ErrUnexpectedEOF},
+		"too deeply nested":               {bytes.Repeat([]byte{0x91}, 100), nil},
+		"invalid type":                    {[]byte{0xc1}, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var v interface{}
+			err := newFrameReader(bytes.NewReader(tt.data), 1024).Decode(&v)
+			require.Error(t, err)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTarget_MaxMessageSize(t *testing.T) {
+	client := fake.NewClient(func() {})
+	defer client.Stop()
+
+	metrics := NewMetrics(nil)
+	tgt, err := NewTarget(metrics, log.NewNopLogger(), client, nil, &Config{
+		ListenAddress:  "127.0.0.1:0",
+		MessageKey:     "log",
+		SharedKey:      "secret",
+		SelfHostname:   "agent",
+		MaxMessageSize: DefaultMaxMessageSize,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tgt.Stop()) }()
+
+	c, err := net.Dial("tcp", tgt.ListenAddress().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	var helo []interface{}
+	require.NoError(t, codec.NewDecoder(bufio.NewReader(c), decodeHandle).Decode(&helo))
+
+	// The PING is read before the client is authenticated, the connection is
+	// closed without allocating the declared array.
+	_, err = c.Write([]byte{0xdd, 0x7f, 0xff, 0xff, 0xff})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.handshakeFailures) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDecodeMessage_MaxMessageSize(t *testing.T) {
+	entries := packEntries(t, []interface{}{int64(0), map[string]interface{}{"log": "hello"}})
+	_, err := decodeMessage([]interface{}{"tag", entries}, len(entries))
+	require.NoError(t, err)
+
+	_, err = decodeMessage([]interface{}{"tag", entries}, len(entries)-1)
+	require.ErrorIs(t, err, errFrameTooLarge)
+
+	_, err = decodeMessage([]interface{}{"tag", []byte{0xdd, 0x7f, 0xff, 0xff, 0xff}}, DefaultMaxMessageSize)
+	require.ErrorIs(t, err, errFrameTooLarge)
+}
+
+func TestDecodeMessage_CompressedMaxMessageSize(t *testing.T) {
+	entries := gzipBytes(t, make([]byte, 1<<20))
+	_, err := decodeMessage([]interface{}{"tag", entries, map[string]interface{}{"compressed": "gzip"}}, 1<<10)
+	require.ErrorIs(t, err, errFrameTooLarge)
+}
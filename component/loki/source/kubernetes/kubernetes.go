@@ -186,7 +186,7 @@ func (c *Component) Update(args component.Arguments) error {
 }
 
 func (c *Component) resyncTargets(targets []discovery.Target) {
-	distTargets := discovery.NewDistributedTargets(c.args.Clustering.Enabled, c.cluster, targets)
+	distTargets := discovery.NewDistributedTargets(c.args.Clustering, c.cluster, targets)
 	targets = distTargets.Get()
 
 	tailTargets := make([]*kubetail.Target, 0, len(targets))
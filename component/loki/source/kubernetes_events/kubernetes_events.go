@@ -18,6 +18,7 @@ import (
 	"github.com/grafana/agent/component/common/loki/positions"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/pkg/runner"
+	"github.com/grafana/agent/service/cluster"
 	"github.com/oklog/run"
 	"k8s.io/client-go/rest"
 )
@@ -27,8 +28,9 @@ const informerSyncTimeout = 10 * time.Second
 
 func init() {
 	component.Register(component.Registration{
-		Name: "loki.source.kubernetes_events",
-		Args: Arguments{},
+		Name:          "loki.source.kubernetes_events",
+		Args:          Arguments{},
+		NeedsServices: []string{cluster.ServiceName},
 
 		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
 			return New(opts, args.(Arguments))
@@ -47,6 +49,8 @@ type Arguments struct {
 
 	// Client settings to connect to Kubernetes.
 	Client kubernetes.ClientArguments `river:"client,block,optional"`
+
+	Clustering cluster.SingletonBlock `river:"clustering,block,optional"`
 }
 
 // DefaultArguments holds default settings for loki.source.kubernetes_events.
@@ -54,7 +58,8 @@ var DefaultArguments = Arguments{
 	JobName:   "loki.source.kubernetes_events",
 	LogFormat: logFormatFmt,
 
-	Client: kubernetes.DefaultClientArguments,
+	Client:     kubernetes.DefaultClientArguments,
+	Clustering: cluster.DefaultSingletonBlock,
 }
 
 // SetToDefault implements river.Defaulter.
@@ -83,6 +88,7 @@ type Component struct {
 	handler    loki.LogsReceiver
 	runner     *runner.Runner[eventControllerTask]
 	newTasksCh chan struct{}
+	singleton  *cluster.Singleton
 
 	mut        sync.Mutex
 	args       Arguments
@@ -96,8 +102,10 @@ type Component struct {
 }
 
 var (
-	_ component.Component      = (*Component)(nil)
-	_ component.DebugComponent = (*Component)(nil)
+	_ component.Component       = (*Component)(nil)
+	_ component.DebugComponent  = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+	_ cluster.Component         = (*Component)(nil)
 )
 
 // New creates a new loki.source.kubernetes_events component.
@@ -114,6 +122,11 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		return nil, err
 	}
 
+	data, err := o.GetServiceData(cluster.ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get information about cluster: %w", err)
+	}
+
 	c := &Component{
 		log:       o.Logger,
 		opts:      o,
@@ -123,6 +136,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 			return newEventController(t)
 		}),
 		newTasksCh: make(chan struct{}, 1),
+		singleton:  cluster.NewSingleton(o.ID, o.Logger, data.(cluster.Cluster)),
 	}
 	if err := c.Update(args); err != nil {
 		return nil, err
@@ -140,20 +154,34 @@ func (c *Component) Run(ctx context.Context) error {
 
 	var rg run.Group
 
+	// Runner to elect the agent watching events when running in the singleton
+	// clustering mode.
+	rg.Add(func() error {
+		c.singleton.Run(ctx)
+		return nil
+	}, func(_ error) {
+		cancel()
+	})
+
 	// Runner to apply tasks.
 	rg.Add(func() error {
 		for {
 			select {
 			case <-ctx.Done():
 				return nil
+			case <-c.singleton.Changes():
 			case <-c.newTasksCh:
+			}
+
+			var tasks []eventControllerTask
+			if c.singleton.Active() {
 				c.tasksMut.RLock()
-				tasks := c.tasks
+				tasks = c.tasks
 				c.tasksMut.RUnlock()
+			}
 
-				if err := c.runner.ApplyTasks(ctx, tasks); err != nil {
-					level.Error(c.log).Log("msg", "failed to apply event watchers", "err", err)
-				}
+			if err := c.runner.ApplyTasks(ctx, tasks); err != nil {
+				level.Error(c.log).Log("msg", "failed to apply event watchers", "err", err)
 			}
 		}
 	}, func(_ error) {
@@ -224,6 +252,8 @@ func (c *Component) Update(args component.Arguments) error {
 	c.tasks = newTasks
 	c.tasksMut.Unlock()
 
+	c.singleton.SetBlock(newArgs.Clustering)
+
 	select {
 	case c.newTasksCh <- struct{}{}:
 	default:
@@ -234,6 +264,20 @@ func (c *Component) Update(args component.Arguments) error {
 	return nil
 }
 
+// NotifyClusterChange implements cluster.Component.
+func (c *Component) NotifyClusterChange() {
+	c.singleton.Notify()
+}
+
+// CurrentHealth implements component.HealthComponent. The component is on
+// standby when another agent of the cluster watches events.
+func (c *Component) CurrentHealth() component.Health {
+	if health, ok := c.singleton.Health(); ok {
+		return health
+	}
+	return component.Health{Health: component.HealthTypeHealthy}
+}
+
 // getNamespaces gets a list of namespaces to watch from the arguments. If the
 // list of namespaces is empty, returns a slice to watch all namespaces.
 func getNamespaces(args Arguments) []string {
@@ -275,7 +275,7 @@ func (c *Component) updateReconciler(args Arguments) error {
 	}
 
 	c.reconciler.UpdateSelectors(sel, nsSel)
-	c.reconciler.SetDistribute(args.Clustering.Enabled)
+	c.reconciler.SetDistribute(args.Clustering)
 
 	// Request a reconcile so the new selectors get applied.
 	c.controller.RequestReconcile()
@@ -13,7 +13,6 @@ import (
 	monitoringv1alpha2 "github.com/grafana/agent/component/loki/source/podlogs/internal/apis/monitoring/v1alpha2"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/service/cluster"
-	"github.com/grafana/ckit/shard"
 	"github.com/prometheus/common/model"
 	promlabels "github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
@@ -34,7 +33,7 @@ type reconciler struct {
 	reconcileMut             sync.RWMutex
 	podLogsSelector          labels.Selector
 	podLogsNamespaceSelector labels.Selector
-	shouldDistribute         bool
+	clustering               cluster.ComponentBlock
 
 	debugMut  sync.RWMutex
 	debugInfo []DiscoveredPodLogs
@@ -62,19 +61,20 @@ func (r *reconciler) UpdateSelectors(podLogs, namespace labels.Selector) {
 	r.podLogsNamespaceSelector = namespace
 }
 
-// SetDistribute configures whether targets are distributed amongst the cluster.
-func (r *reconciler) SetDistribute(distribute bool) {
+// SetDistribute configures how targets are distributed amongst the cluster.
+// Targets are only distributed when clustering is enabled.
+func (r *reconciler) SetDistribute(clustering cluster.ComponentBlock) {
 	r.reconcileMut.Lock()
 	defer r.reconcileMut.Unlock()
 
-	r.shouldDistribute = distribute
+	r.clustering = clustering
 }
 
-func (r *reconciler) getShouldDistribute() bool {
+func (r *reconciler) getClustering() cluster.ComponentBlock {
 	r.reconcileMut.RLock()
 	defer r.reconcileMut.RUnlock()
 
-	return r.shouldDistribute
+	return r.clustering
 }
 
 // Reconcile synchronizes the set of running kubetail targets with the set of
@@ -111,8 +111,8 @@ func (r *reconciler) Reconcile(ctx context.Context, cli client.Client) error {
 	}
 
 	// Distribute targets if clustering is enabled.
-	if r.getShouldDistribute() {
-		newTasks = distributeTargets(r.cluster, newTasks)
+	if clustering := r.getClustering(); clustering.Enabled {
+		newTasks = distributeTargets(r.cluster, clustering, newTasks)
 	}
 
 	if err := r.tailer.SyncTargets(ctx, newTasks); err != nil {
@@ -126,7 +126,7 @@ func (r *reconciler) Reconcile(ctx context.Context, cli client.Client) error {
 	return nil
 }
 
-func distributeTargets(c cluster.Cluster, targets []*kubetail.Target) []*kubetail.Target {
+func distributeTargets(c cluster.Cluster, clustering cluster.ComponentBlock, targets []*kubetail.Target) []*kubetail.Target {
 	if c == nil {
 		return targets
 	}
@@ -134,15 +134,19 @@ func distributeTargets(c cluster.Cluster, targets []*kubetail.Target) []*kubetai
 	res := make([]*kubetail.Target, 0, (len(targets)+1)/len(c.Peers()))
 
 	for _, target := range targets {
-		peers, err := c.Lookup(shard.StringKey(target.Labels().String()), 1, shard.OpReadWrite)
+		peers, err := clustering.Owners(c, target.Labels().String())
 		if err != nil {
 			// This can only fail in case we ask for more owners than the
 			// available peers. This will never happen, but in any case we fall
 			// back to owning the target ourselves.
 			res = append(res, target)
+			continue
 		}
-		if peers[0].Self {
-			res = append(res, target)
+		for _, p := range peers {
+			if p.Self {
+				res = append(res, target)
+				break
+			}
 		}
 	}
 
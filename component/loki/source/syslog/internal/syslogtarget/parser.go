@@ -0,0 +1,234 @@
+package syslogtarget
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/grafana/loki/clients/pkg/promtail/targets/syslog/syslogparser"
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
+)
+
+// SyslogFormat is the format of the syslog messages accepted by a
+// SyslogTarget.
+type SyslogFormat string
+
+// Supported syslog formats.
+const (
+	// SyslogFormatRFC5424 only accepts RFC5424 messages.
+	SyslogFormatRFC5424 SyslogFormat = "rfc5424"
+	// SyslogFormatRFC3164 only accepts RFC3164 (BSD) messages.
+	SyslogFormatRFC3164 SyslogFormat = "rfc3164"
+	// SyslogFormatAuto detects the format of each message.
+	SyslogFormatAuto SyslogFormat = "auto"
+)
+
+// FormatConfig configures how a SyslogTarget parses messages.
+type FormatConfig struct {
+	// Format of messages. RFC5424 is used if it's empty.
+	Format SyslogFormat
+	// RFC3164Year is the year of the timestamps of RFC3164 messages, which
+	// don't include it. It's inferred from the current time if it's 0.
+	RFC3164Year int
+	// RFC3164Location is the time zone of the timestamps of RFC3164
+	// messages, which don't include it. The local time zone is used if it's
+	// nil.
+	RFC3164Location *time.Location
+}
+
+// parseStream parses a syslog stream from r in the given format, calling
+// callback with the parsed messages. Like syslogparser.ParseStream, it
+// detects octet counting and non-transparent framing.
+func parseStream(r io.Reader, callback func(res *syslog.Result), maxMessageLength int, format FormatConfig) error {
+	switch format.Format {
+	case "", SyslogFormatRFC5424:
+		return syslogparser.ParseStream(r, callback, maxMessageLength)
+	}
+
+	var (
+		parser = newMessageParser(format)
+		buf    = bufio.NewReaderSize(r, 1<<10)
+	)
+	b, err := buf.ReadByte()
+	if err != nil {
+		return err
+	}
+	_ = buf.UnreadByte()
+
+	if b == '<' {
+		parseNonTransparent(buf, callback, maxMessageLength, parser)
+	} else if b >= '0' && b <= '9' {
+		parseOctetCounting(buf, callback, maxMessageLength, parser)
+	} else {
+		return fmt.Errorf("invalid or unsupported framing. first byte: '%s'", string(b))
+	}
+
+	return nil
+}
+
+// parseNonTransparent parses messages delimited by line feeds.
+func parseNonTransparent(r io.Reader, callback func(res *syslog.Result), maxMessageLength int, parser *messageParser) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<10), maxMessageLength)
+
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			msg, err := parser.parse(line)
+			callback(&syslog.Result{Message: msg, Error: err})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		callback(&syslog.Result{Error: err})
+	}
+}
+
+// parseOctetCounting parses messages prefixed by their length, as described
+// in RFC6587.
+func parseOctetCounting(r *bufio.Reader, callback func(res *syslog.Result), maxMessageLength int, parser *messageParser) {
+	// The length prefix can't have more digits than the maximum length, so
+	// that a client can't make us buffer an unbounded prefix.
+	maxDigits := len(strconv.Itoa(maxMessageLength))
+
+	for {
+		length, err := readMessageLength(r, maxDigits)
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			callback(&syslog.Result{Error: err})
+			return
+		} else if length > maxMessageLength {
+			callback(&syslog.Result{Error: fmt.Errorf("message length %d is greater than the maximum of %d", length, maxMessageLength)})
+			return
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			callback(&syslog.Result{Error: fmt.Errorf("reading message: %w", err)})
+			return
+		}
+		msg, err := parser.parse(frame)
+		callback(&syslog.Result{Message: msg, Error: err})
+	}
+}
+
+// readMessageLength reads the length prefix of an octet counted message, up
+// to the space following it. It returns io.EOF if r ends before the prefix.
+func readMessageLength(r *bufio.Reader, maxDigits int) (int, error) {
+	var digits []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && len(digits) == 0 {
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, fmt.Errorf("reading message length: %w", err)
+		}
+
+		if b == ' ' {
+			break
+		} else if b < '0' || b > '9' || len(digits) == maxDigits {
+			return 0, fmt.Errorf("invalid message length %q", append(digits, b))
+		}
+		digits = append(digits, b)
+	}
+
+	length, err := strconv.Atoi(string(digits))
+	if err != nil || length <= 0 {
+		return 0, fmt.Errorf("invalid message length %q", digits)
+	}
+	return length, nil
+}
+
+// messageParser parses RFC3164 messages, and RFC5424 messages when the
+// format is detected.
+type messageParser struct {
+	format   FormatConfig
+	location *time.Location
+	rfc3164  syslog.Machine
+	rfc5424  syslog.Machine
+
+	// now returns the current time, to infer the year of RFC3164 timestamps.
+	now func() time.Time
+}
+
+func newMessageParser(format FormatConfig) *messageParser {
+	location := format.RFC3164Location
+	if location == nil {
+		location = time.Local
+	}
+
+	return &messageParser{
+		format:   format,
+		location: location,
+		rfc3164: rfc3164.NewMachine(
+			rfc3164.WithBestEffort(),
+			rfc3164.WithRFC3339(),
+			rfc3164.WithLocaleTimezone(location),
+		),
+		rfc5424: rfc5424.NewMachine(rfc5424.WithBestEffort()),
+		now:     time.Now,
+	}
+}
+
+// parse parses a single message.
+func (p *messageParser) parse(input []byte) (syslog.Message, error) {
+	if p.format.Format == SyslogFormatAuto && isRFC5424(input) {
+		return p.rfc5424.Parse(input)
+	}
+
+	msg, err := p.rfc3164.Parse(input)
+	if msg, ok := msg.(*rfc3164.SyslogMessage); ok && msg.Timestamp != nil {
+		// RFC3164 timestamps are parsed in year 0, unless they're RFC3339
+		// timestamps.
+		if ts := *msg.Timestamp; ts.Year() == 0 {
+			ts = p.withYear(ts)
+			msg.Timestamp = &ts
+		}
+	}
+	return msg, err
+}
+
+// withYear returns ts, which has no year, in the configured year. Otherwise,
+// ts is in the current year, or in the previous year if it would be more
+// than a day in the future, like for messages sent before a new year.
+func (p *messageParser) withYear(ts time.Time) time.Time {
+	if p.format.RFC3164Year != 0 {
+		return ts.AddDate(p.format.RFC3164Year, 0, 0)
+	}
+
+	now := p.now().In(p.location)
+	res := ts.AddDate(now.Year(), 0, 0)
+	if res.After(now.Add(24 * time.Hour)) {
+		res = ts.AddDate(now.Year()-1, 0, 0)
+	}
+	return res
+}
+
+// isRFC5424 returns whether input looks like a RFC5424 message, which has a
+// version after its priority, unlike RFC3164 messages.
+func isRFC5424(input []byte) bool {
+	if len(input) == 0 || input[0] != '<' {
+		return false
+	}
+
+	i := 1
+	for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+		i++
+	}
+	if i == 1 || i >= len(input) || input[i] != '>' {
+		return false
+	}
+	i++
+
+	// The version is a non-zero number of at most 2 digits followed by a
+	// space.
+	start := i
+	for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+		i++
+	}
+	digits := i - start
+	return digits >= 1 && digits <= 2 && input[start] != '0' && i < len(input) && input[i] == ' '
+}
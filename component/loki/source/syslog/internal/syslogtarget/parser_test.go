@@ -0,0 +1,113 @@
+package syslogtarget
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRFC5424(t *testing.T) {
+	for input, expect := range map[string]bool{
+		`<165>1 2018-10-11T22:14:15.003Z host5 e - id1 - message`: true,
+		`<165>12 - - - - - message`:                               true,
+		`<34>Oct 11 22:14:15 host5 su: message`:                   false,
+		`<34>2018-10-11T22:14:15Z host5 su: message`:              false,
+		`<34>0 - - - - - message`:                                 false,
+		`<34>`:                                                    false,
+		`34>1 message`:                                            false,
+		``:                                                        false,
+	} {
+		require.Equal(t, expect, isRFC5424([]byte(input)), input)
+	}
+}
+
+func TestMessageParser_Year(t *testing.T) {
+	parser := newMessageParser(FormatConfig{
+		Format:          SyslogFormatRFC3164,
+		RFC3164Location: time.UTC,
+	})
+	parser.now = func() time.Time {
+		return time.Date(2023, time.January, 1, 0, 30, 0, 0, time.UTC)
+	}
+
+	for input, expect := range map[string]time.Time{
+		// Messages in the past are in the current year.
+		`<34>Jan  1 00:10:00 host5 su: message`: time.Date(2023, time.January, 1, 0, 10, 0, 0, time.UTC),
+		// Messages in the near future are in the current year too, to allow
+		// for clock skew.
+		`<34>Jan  1 08:00:00 host5 su: message`: time.Date(2023, time.January, 1, 8, 0, 0, 0, time.UTC),
+		// Messages in the far future were sent before the new year.
+		`<34>Dec 31 23:50:00 host5 su: message`: time.Date(2022, time.December, 31, 23, 50, 0, 0, time.UTC),
+		// RFC3339 timestamps already have a year.
+		`<34>2020-05-01T10:00:00Z host5 su: message`: time.Date(2020, time.May, 1, 10, 0, 0, 0, time.UTC),
+	} {
+		msg, err := parser.parse([]byte(input))
+		require.NoError(t, err, input)
+		require.True(t, timestampOf(t, msg).Equal(expect), "%s: got %s", input, timestampOf(t, msg))
+	}
+
+	parser.format.RFC3164Year = 2019
+	msg, err := parser.parse([]byte(`<34>Dec 31 23:50:00 host5 su: message`))
+	require.NoError(t, err)
+	require.True(t, timestampOf(t, msg).Equal(time.Date(2019, time.December, 31, 23, 50, 0, 0, time.UTC)))
+}
+
+func TestMessageParser_Timezone(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	parser := newMessageParser(FormatConfig{
+		Format:          SyslogFormatRFC3164,
+		RFC3164Year:     2023,
+		RFC3164Location: location,
+	})
+	msg, err := parser.parse([]byte(`<34>Jun  1 12:00:00 host5 su: message`))
+	require.NoError(t, err)
+	require.True(t, timestampOf(t, msg).Equal(time.Date(2023, time.June, 1, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestParseOctetCounting(t *testing.T) {
+	parser := newMessageParser(FormatConfig{Format: SyslogFormatRFC3164, RFC3164Year: 2023})
+	parse := func(input string) []*syslog.Result {
+		var res []*syslog.Result
+		parseOctetCounting(bufio.NewReader(strings.NewReader(input)), func(r *syslog.Result) {
+			res = append(res, r)
+		}, 100, parser)
+		return res
+	}
+
+	msg := `<34>Oct 11 22:14:15 host5 su: message`
+	res := parse(fmt.Sprintf("%d %s%d %s", len(msg), msg, len(msg), msg))
+	require.Len(t, res, 2)
+	for _, r := range res {
+		require.NoError(t, r.Error)
+	}
+
+	for input, expect := range map[string]string{
+		"101 " + msg:               "message length 101 is greater than the maximum of 100",
+		"0 ":                       `invalid message length "0"`,
+		"1a ":                      `invalid message length "1a"`,
+		strings.Repeat("0", 1<<20): `invalid message length "0000"`,
+		"12":                       "reading message length: EOF",
+		"12 " + msg[:5]:            "reading message: unexpected EOF",
+	} {
+		res := parse(input)
+		require.Len(t, res, 1, input)
+		require.EqualError(t, res[0].Error, expect, input)
+	}
+}
+
+func timestampOf(t *testing.T, msg syslog.Message) time.Time {
+	t.Helper()
+
+	rfc3164Msg, ok := msg.(*rfc3164.SyslogMessage)
+	require.True(t, ok)
+	require.NotNil(t, rfc3164Msg.Timestamp)
+	return *rfc3164Msg.Timestamp
+}
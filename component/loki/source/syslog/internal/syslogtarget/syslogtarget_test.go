@@ -314,7 +314,7 @@ func Benchmark_SyslogTarget(b *testing.B) {
 			client := fake.NewClient(func() {})
 
 			metrics := NewMetrics(nil)
-			tgt, _ := NewSyslogTarget(metrics, log.NewNopLogger(), client, []*relabel.Config{}, &scrapeconfig.SyslogTargetConfig{
+			tgt, _ := NewSyslogTarget(metrics, log.NewNopLogger(), client, []*relabel.Config{}, FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 				ListenAddress:       "127.0.0.1:0",
 				ListenProtocol:      tt.protocol,
 				LabelStructuredData: true,
@@ -376,7 +376,7 @@ func TestSyslogTarget(t *testing.T) {
 			client := fake.NewClient(func() {})
 
 			metrics := NewMetrics(nil)
-			tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+			tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 				MaxMessageLength:    1 << 12, // explicitly not use default value
 				ListenAddress:       "127.0.0.1:0",
 				ListenProtocol:      tt.protocol,
@@ -491,7 +491,7 @@ func TestSyslogTarget_RFC5424Messages(t *testing.T) {
 			client := fake.NewClient(func() {})
 
 			metrics := NewMetrics(nil)
-			tgt, err := NewSyslogTarget(metrics, logger, client, []*relabel.Config{}, &scrapeconfig.SyslogTargetConfig{
+			tgt, err := NewSyslogTarget(metrics, logger, client, []*relabel.Config{}, FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 				ListenAddress:       "127.0.0.1:0",
 				ListenProtocol:      tt.protocol,
 				LabelStructuredData: true,
@@ -535,13 +535,100 @@ func TestSyslogTarget_RFC5424Messages(t *testing.T) {
 	}
 }
 
+func TestSyslogTarget_RFC3164Messages(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		protocol string
+		format   SyslogFormat
+		fmtFunc  formatFunc
+	}{
+		{"tcp newline separated", protocolTCP, SyslogFormatRFC3164, fmtNewline},
+		{"tcp octetcounting", protocolTCP, SyslogFormatRFC3164, fmtOctetCounting},
+		{"udp newline separated", protocolUDP, SyslogFormatRFC3164, fmtNewline},
+		{"udp octetcounting", protocolUDP, SyslogFormatRFC3164, fmtOctetCounting},
+		{"tcp auto", protocolTCP, SyslogFormatAuto, fmtNewline},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := log.NewSyncWriter(os.Stderr)
+			logger := log.NewLogfmtLogger(w)
+			client := fake.NewClient(func() {})
+
+			metrics := NewMetrics(nil)
+			tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{
+				Format:          tt.format,
+				RFC3164Year:     2018,
+				RFC3164Location: time.UTC,
+			}, &scrapeconfig.SyslogTargetConfig{
+				ListenAddress:        "127.0.0.1:0",
+				ListenProtocol:       tt.protocol,
+				UseIncomingTimestamp: true,
+				Labels: model.LabelSet{
+					"test": "syslog_target",
+				},
+			})
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, tgt.Stop())
+			}()
+
+			require.Eventually(t, tgt.Ready, time.Second, 10*time.Millisecond)
+
+			addr := tgt.ListenAddress().String()
+			c, err := net.Dial(tt.protocol, addr)
+			require.NoError(t, err)
+
+			messages := []string{
+				`<34>Oct 11 22:14:15 host5 su[123]: 'su root' failed for lonvick on /dev/pts/8`,
+			}
+			if tt.format == SyslogFormatAuto {
+				messages = append(messages, `<165>1 2018-10-11T22:14:16.003Z host6 e - id1 - An application event log entry...`)
+			}
+
+			err = writeMessagesToStream(c, messages, tt.fmtFunc)
+			require.NoError(t, err)
+			require.NoError(t, c.Close())
+
+			require.Eventuallyf(t, func() bool {
+				return len(client.Received()) == len(messages)
+			}, time.Second, 10*time.Millisecond, "Expected to receive %d messages.", len(messages))
+
+			received := client.Received()
+			require.Equal(t, model.LabelSet{
+				"test": "syslog_target",
+
+				"severity": "critical",
+				"facility": "auth",
+				"hostname": "host5",
+				"app_name": "su",
+				"proc_id":  "123",
+			}, received[0].Labels)
+			require.Equal(t, "'su root' failed for lonvick on /dev/pts/8", received[0].Line)
+			require.Equal(t, time.Date(2018, time.October, 11, 22, 14, 15, 0, time.UTC), received[0].Timestamp.UTC())
+
+			if tt.format == SyslogFormatAuto {
+				require.Equal(t, model.LabelSet{
+					"test": "syslog_target",
+
+					"severity": "notice",
+					"facility": "local4",
+					"hostname": "host6",
+					"app_name": "e",
+					"msg_id":   "id1",
+				}, received[1].Labels)
+				require.Equal(t, "An application event log entry...", received[1].Line)
+			}
+		})
+	}
+}
+
 func TestSyslogTarget_TLSConfigWithoutServerCertificate(t *testing.T) {
 	w := log.NewSyncWriter(os.Stderr)
 	logger := log.NewLogfmtLogger(w)
 	client := fake.NewClient(func() {})
 
 	metrics := NewMetrics(nil)
-	_, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	_, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress: "127.0.0.1:0",
 		TLSConfig: promconfig.TLSConfig{
 			KeyFile: "foo",
@@ -556,7 +643,7 @@ func TestSyslogTarget_TLSConfigWithoutServerKey(t *testing.T) {
 	client := fake.NewClient(func() {})
 
 	metrics := NewMetrics(nil)
-	_, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	_, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress: "127.0.0.1:0",
 		TLSConfig: promconfig.TLSConfig{
 			CertFile: "foo",
@@ -595,7 +682,7 @@ func testSyslogTargetWithTLS(t *testing.T, fmtFunc formatFunc) {
 	client := fake.NewClient(func() {})
 
 	metrics := NewMetrics(nil)
-	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress:       "127.0.0.1:0",
 		LabelStructuredData: true,
 		Labels: model.LabelSet{
@@ -727,7 +814,7 @@ func testSyslogTargetWithTLSVerifyClientCertificate(t *testing.T, fmtFunc format
 	client := fake.NewClient(func() {})
 
 	metrics := NewMetrics(nil)
-	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress:       "127.0.0.1:0",
 		LabelStructuredData: true,
 		Labels: model.LabelSet{
@@ -805,7 +892,7 @@ func TestSyslogTarget_InvalidData(t *testing.T) {
 	client := fake.NewClient(func() {})
 	metrics := NewMetrics(nil)
 
-	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress: "127.0.0.1:0",
 	})
 	require.NoError(t, err)
@@ -836,7 +923,7 @@ func TestSyslogTarget_NonUTF8Message(t *testing.T) {
 	client := fake.NewClient(func() {})
 	metrics := NewMetrics(nil)
 
-	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress: "127.0.0.1:0",
 	})
 	require.NoError(t, err)
@@ -874,7 +961,7 @@ func TestSyslogTarget_IdleTimeout(t *testing.T) {
 	client := fake.NewClient(func() {})
 	metrics := NewMetrics(nil)
 
-	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), &scrapeconfig.SyslogTargetConfig{
+	tgt, err := NewSyslogTarget(metrics, logger, client, relabelConfig(t), FormatConfig{}, &scrapeconfig.SyslogTargetConfig{
 		ListenAddress: "127.0.0.1:0",
 		IdleTimeout:   time.Millisecond,
 	})
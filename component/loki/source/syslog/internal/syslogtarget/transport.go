@@ -27,7 +27,6 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 
 	"github.com/grafana/loki/clients/pkg/promtail/scrapeconfig"
-	"github.com/grafana/loki/clients/pkg/promtail/targets/syslog/syslogparser"
 )
 
 var (
@@ -48,6 +47,7 @@ type handleMessageError func(error)
 
 type baseTransport struct {
 	config *scrapeconfig.SyslogTargetConfig
+	format FormatConfig
 	logger log.Logger
 
 	openConnections *sync.WaitGroup
@@ -108,10 +108,11 @@ func lookupAddr(addr string) string {
 	return strings.Join(names, ",")
 }
 
-func newBaseTransport(config *scrapeconfig.SyslogTargetConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) *baseTransport {
+func newBaseTransport(config *scrapeconfig.SyslogTargetConfig, format FormatConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) *baseTransport {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &baseTransport{
 		config:             config,
+		format:             format,
 		logger:             logger,
 		openConnections:    new(sync.WaitGroup),
 		handleMessage:      handleMessage,
@@ -164,9 +165,9 @@ type TCPTransport struct {
 	listener net.Listener
 }
 
-func NewSyslogTCPTransport(config *scrapeconfig.SyslogTargetConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) Transport {
+func NewSyslogTCPTransport(config *scrapeconfig.SyslogTargetConfig, format FormatConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) Transport {
 	return &TCPTransport{
-		baseTransport: newBaseTransport(config, handleMessage, handleError, logger),
+		baseTransport: newBaseTransport(config, format, handleMessage, handleError, logger),
 	}
 }
 
@@ -322,13 +323,13 @@ func (t *TCPTransport) handleConnection(cn net.Conn) {
 
 	lbs := t.connectionLabels(ipFromConn(c).String())
 
-	err := syslogparser.ParseStream(c, func(result *syslog.Result) {
+	err := parseStream(c, func(result *syslog.Result) {
 		if err := result.Error; err != nil {
 			t.handleMessageError(err)
 			return
 		}
 		t.handleMessage(lbs.Copy(), result.Message)
-	}, t.maxMessageLength())
+	}, t.maxMessageLength(), t.format)
 
 	if err != nil {
 		level.Warn(t.logger).Log("msg", "error initializing syslog stream", "err", err)
@@ -356,9 +357,9 @@ type UDPTransport struct {
 	udpConn *net.UDPConn
 }
 
-func NewSyslogUDPTransport(config *scrapeconfig.SyslogTargetConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) Transport {
+func NewSyslogUDPTransport(config *scrapeconfig.SyslogTargetConfig, format FormatConfig, handleMessage handleMessage, handleError handleMessageError, logger log.Logger) Transport {
 	return &UDPTransport{
-		baseTransport: newBaseTransport(config, handleMessage, handleError, logger),
+		baseTransport: newBaseTransport(config, format, handleMessage, handleError, logger),
 	}
 }
 
@@ -446,13 +447,13 @@ func (t *UDPTransport) handleRcv(c *ConnPipe) {
 
 		r := bytes.NewReader(datagram[:n])
 
-		err = syslogparser.ParseStream(r, func(result *syslog.Result) {
+		err = parseStream(r, func(result *syslog.Result) {
 			if err := result.Error; err != nil {
 				t.handleMessageError(err)
 			} else {
 				t.handleMessage(lbs.Copy(), result.Message)
 			}
-		}, t.maxMessageLength())
+		}, t.maxMessageLength(), t.format)
 
 		if err != nil {
 			level.Warn(t.logger).Log("msg", "error parsing syslog stream", "err", err)
@@ -20,6 +20,9 @@ type ListenerConfig struct {
 	UseIncomingTimestamp bool              `river:"use_incoming_timestamp,attr,optional"`
 	UseRFC5424Message    bool              `river:"use_rfc5424_message,attr,optional"`
 	MaxMessageLength     int               `river:"max_message_length,attr,optional"`
+	SyslogFormat         string            `river:"syslog_format,attr,optional"`
+	RFC3164Year          int               `river:"rfc3164_year,attr,optional"`
+	RFC3164Timezone      string            `river:"rfc3164_timezone,attr,optional"`
 	TLSConfig            config.TLSConfig  `river:"tls_config,block,optional"`
 }
 
@@ -28,6 +31,7 @@ var DefaultListenerConfig = ListenerConfig{
 	ListenProtocol:   st.DefaultProtocol,
 	IdleTimeout:      st.DefaultIdleTimeout,
 	MaxMessageLength: st.DefaultMaxMessageLength,
+	SyslogFormat:     string(st.SyslogFormatRFC5424),
 }
 
 // SetToDefault implements river.Defaulter.
@@ -41,6 +45,19 @@ func (sc *ListenerConfig) Validate() error {
 		return fmt.Errorf("syslog listener protocol should be either 'tcp' or 'udp', got %s", sc.ListenProtocol)
 	}
 
+	switch st.SyslogFormat(sc.SyslogFormat) {
+	case st.SyslogFormatRFC5424, st.SyslogFormatRFC3164, st.SyslogFormatAuto:
+	default:
+		return fmt.Errorf("syslog listener format should be one of 'rfc5424', 'rfc3164' or 'auto', got %s", sc.SyslogFormat)
+	}
+
+	if sc.RFC3164Year < 0 {
+		return fmt.Errorf("rfc3164_year must not be negative, got %d", sc.RFC3164Year)
+	}
+	if _, err := time.LoadLocation(sc.RFC3164Timezone); err != nil {
+		return fmt.Errorf("invalid rfc3164_timezone: %w", err)
+	}
+
 	return nil
 }
 
@@ -63,3 +80,19 @@ func (sc ListenerConfig) Convert() *scrapeconfig.SyslogTargetConfig {
 		TLSConfig:            *sc.TLSConfig.Convert(),
 	}
 }
+
+// FormatConfig returns how the syslog listener parses messages.
+func (sc ListenerConfig) FormatConfig() st.FormatConfig {
+	// The time zone is checked by Validate, and time.LoadLocation returns
+	// UTC for an empty name.
+	location := time.Local
+	if sc.RFC3164Timezone != "" {
+		location, _ = time.LoadLocation(sc.RFC3164Timezone)
+	}
+
+	return st.FormatConfig{
+		Format:          st.SyslogFormat(sc.SyslogFormat),
+		RFC3164Year:     sc.RFC3164Year,
+		RFC3164Location: location,
+	}
+}
@@ -0,0 +1,306 @@
+package write
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki/wal"
+	"github.com/grafana/agent/pkg/agentctl/waltools"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// InstallTools installs command line utilities as subcommands of the provided
+// cmd.
+func InstallTools(cmd *cobra.Command) {
+	cmd.AddCommand(
+		entryStatsCmd(),
+		walStatsCmd(),
+		walExportCmd(),
+		walReplayCmd(),
+	)
+}
+
+func entryStatsCmd() *cobra.Command {
+	var selector string
+
+	cmd := &cobra.Command{
+		Use:   "entry-stats [WAL directory]",
+		Short: "Discover entry statistics for streams matching a label selector",
+		Long: `entry-stats reads a WAL directory and collects information on the streams and
+entries within it. A label selector can be used to filter the streams that should be targeted.
+
+Examples:
+
+Show entry stats for all streams in the WAL:
+
+entry-stats /tmp/wal
+
+
+Show entry stats for all streams within 'job=a':
+
+entry-stats -s '{job="a"}' /tmp/wal
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			directory := walDirectory(args[0])
+
+			stats, err := wal.FindStreams(directory, selector)
+			if err != nil {
+				fmt.Printf("failed to get entry stats: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, stream := range stats {
+				fmt.Print(stream.Labels.String(), "\n")
+				fmt.Printf("  Oldest Entry:       %s\n", stream.From)
+				fmt.Printf("  Newest Entry:       %s\n", stream.To)
+				fmt.Printf("  Total Entries:      %d\n", stream.Entries)
+				fmt.Printf("  Total Bytes:        %d\n", stream.Bytes)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "s", "{}", "label selector to search for")
+	return cmd
+}
+
+func walStatsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "wal-stats [WAL directory]",
+		Short: "Collect stats on the WAL",
+		Long: `wal-stats reads a WAL directory and collects information on the streams and
+entries within it.`,
+		Args: cobra.ExactArgs(1),
+
+		Run: func(_ *cobra.Command, args []string) {
+			directory := walDirectory(args[0])
+
+			stats, err := wal.CalculateStats(directory)
+			if err != nil {
+				fmt.Printf("failed to get WAL stats: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Oldest Entry:       %s\n", stats.From)
+			fmt.Printf("Newest Entry:       %s\n", stats.To)
+			fmt.Printf("Total Streams:      %d\n", len(stats.Streams))
+			fmt.Printf("Total Entries:      %d\n", stats.Entries())
+			fmt.Printf("Total Bytes:        %d\n", stats.Bytes())
+			fmt.Printf("First Segment:      %d\n", stats.FirstSegment)
+			fmt.Printf("Latest Segment:     %d\n", stats.LastSegment)
+
+			fmt.Printf("\nPer-stream stats:\n")
+
+			table := tablewriter.NewWriter(os.Stdout)
+			defer table.Render()
+
+			table.SetHeader([]string{"Stream", "Entries", "Bytes"})
+
+			for _, s := range stats.Streams {
+				table.Append([]string{s.Labels.String(), fmt.Sprintf("%d", s.Entries), fmt.Sprintf("%d", s.Bytes)})
+			}
+		},
+	}
+}
+
+func walExportCmd() *cobra.Command {
+	var (
+		selector string
+		from, to string
+		format   string
+		output   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "wal-export [WAL directory]",
+		Short: "Export streams and entries from the WAL",
+		Long: `wal-export reads a WAL directory and exports the entries of the streams
+matching a label selector within a time range, to recover data which couldn't
+be sent to the Loki endpoint.
+
+Entries are exported as JSON objects, one per line, with their stream labels,
+timestamp, line and structured metadata, or as raw log lines.
+
+Examples:
+
+Export all entries as JSON on stdout:
+
+wal-export /tmp/wal
+
+
+Export the lines of 'job=a' in a time range to a file:
+
+wal-export -s '{job="a"}' --from 2023-11-20T08:00:00Z --to 2023-11-20T12:00:00Z \
+  --format raw -o /tmp/a.log /tmp/wal
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			directory := walDirectory(args[0])
+
+			fromTime, toTime, err := parseTimeRange(from, to)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			var write func(*os.File, []*wal.Stream) error
+			switch format {
+			case "json":
+				write = func(f *os.File, streams []*wal.Stream) error { return wal.WriteJSON(f, streams) }
+			case "raw":
+				write = func(f *os.File, streams []*wal.Stream) error { return wal.WriteRaw(f, streams) }
+			default:
+				fmt.Fprintf(os.Stderr, "unsupported format %q, must be json or raw\n", format)
+				os.Exit(1)
+			}
+
+			streams, err := wal.ReadStreams(directory, selector, fromTime, toTime)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read streams: %v\n", err)
+				os.Exit(1)
+			}
+
+			out := os.Stdout
+			if output != "" && output != "-" {
+				out, err = os.Create(output)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to create output file: %v\n", err)
+					os.Exit(1)
+				}
+				defer out.Close()
+			}
+			if err := write(out, streams); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to write entries: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "s", "{}", "label selector of the streams to export")
+	cmd.Flags().StringVar(&from, "from", "", "start of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVar(&to, "to", "", "end of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVarP(&format, "format", "f", "json", "output format, json or raw")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default stdout)")
+	return cmd
+}
+
+func walReplayCmd() *cobra.Command {
+	var (
+		selector string
+		from, to string
+		headers  map[string]string
+		opts     = wal.ReplayOptions{}
+	)
+
+	cmd := &cobra.Command{
+		Use:   "wal-replay [WAL directory] [push URL]",
+		Short: "Push the entries of the WAL to a Loki endpoint",
+		Long: `wal-replay reads a WAL directory and pushes the entries of the streams
+matching a label selector within a time range to a Loki endpoint, to recover
+data which the endpoint rejected.
+
+Streams with a __tenant_id__ label are pushed to that tenant, and other
+streams to the tenant set with --tenant-id. The entries of a stream are always
+sent in order by the same worker. Requests failing with 429 or 5xx status
+codes are retried; other rejected requests are reported at the end of the
+replay.
+
+Examples:
+
+Push the entries of 'job=a' in a time range to Loki:
+
+wal-replay -s '{job="a"}' --from 2023-11-20T08:00:00Z --to 2023-11-20T12:00:00Z \
+  --tenant-id tenant /tmp/wal http://loki:3100/loki/api/v1/push
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(_ *cobra.Command, args []string) {
+			directory := walDirectory(args[0])
+
+			fromTime, toTime, err := parseTimeRange(from, to)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			streams, err := wal.ReadStreams(directory, selector, fromTime, toTime)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read streams: %v\n", err)
+				os.Exit(1)
+			}
+
+			opts.URL = args[1]
+			opts.Headers = headers
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			stats, err := wal.Replay(ctx, streams, opts)
+			fmt.Printf("Streams:         %d\n", stats.Streams)
+			fmt.Printf("Entries:         %d\n", stats.Entries)
+			fmt.Printf("Requests:        %d\n", stats.Requests)
+			fmt.Printf("Failed Entries:  %d\n", stats.FailedEntries)
+			fmt.Printf("Failed Requests: %d\n", stats.FailedRequests)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to replay WAL: %v\n", err)
+				os.Exit(1)
+			}
+			if stats.LastError != nil {
+				fmt.Fprintf(os.Stderr, "last error: %v\n", stats.LastError)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "s", "{}", "label selector of the streams to replay")
+	cmd.Flags().StringVar(&from, "from", "", "start of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVar(&to, "to", "", "end of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringToStringVarP(&headers, "header", "H", nil, "header to add to requests, as name=value")
+	cmd.Flags().StringVar(&opts.TenantID, "tenant-id", "", "tenant of the streams without a __tenant_id__ label")
+	cmd.Flags().IntVarP(&opts.Concurrency, "concurrency", "c", 4, "number of concurrent requests")
+	cmd.Flags().IntVar(&opts.BatchSize, "batch-size", 1000, "maximum number of entries per request")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 30*time.Second, "timeout of requests")
+	cmd.Flags().IntVar(&opts.MaxRetries, "max-retries", 10, "maximum number of retries of requests failing with 429 or 5xx status codes")
+	return cmd
+}
+
+// walDirectory checks that directory exists, and returns its wal
+// subdirectory if it has one. It exits if directory can't be used.
+func walDirectory(directory string) string {
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		fmt.Printf("%s does not exist\n", directory)
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Printf("error getting wal: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Check if ./wal is a subdirectory, use that instead.
+	if _, err := os.Stat(filepath.Join(directory, "wal")); err == nil {
+		directory = filepath.Join(directory, "wal")
+	}
+	return directory
+}
+
+// parseTimeRange parses the bounds of a time range, returning zero times for
+// unbounded ones.
+func parseTimeRange(from, to string) (time.Time, time.Time, error) {
+	mint, maxt, err := waltools.ParseTimeRange(from, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	var fromTime, toTime time.Time
+	if mint != math.MinInt64 {
+		fromTime = time.UnixMilli(mint)
+	}
+	if maxt != math.MaxInt64 {
+		toTime = time.UnixMilli(maxt)
+	}
+	return fromTime, toTime, nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/grafana/agent/component/common/loki/client"
 	"github.com/grafana/agent/component/common/loki/limit"
 	"github.com/grafana/agent/component/common/loki/wal"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func init() {
@@ -69,12 +70,16 @@ type Exports struct {
 
 var (
 	_ component.Component = (*Component)(nil)
+	_ component.Drainer   = (*Component)(nil)
 )
 
 // Component implements the loki.write component.
 type Component struct {
 	opts    component.Options
 	metrics *client.Metrics
+	// shutdownDropped counts the entries received after the component was
+	// drained, which have nowhere left to be written to.
+	shutdownDropped prometheus.Counter
 
 	mut      sync.RWMutex
 	args     Arguments
@@ -83,6 +88,7 @@ type Component struct {
 	// remote write components
 	clientManger client.Client
 	walWriter    *wal.Writer
+	drained      bool // Set once Drain stopped the remote write components.
 
 	// sink is the place where log entries received by this component should be written to. If WAL
 	// is enabled, this will be the WAL Writer, otherwise, the client manager
@@ -94,6 +100,13 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	c := &Component{
 		opts:    o,
 		metrics: client.NewMetrics(o.Registerer),
+		shutdownDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "loki_write_shutdown_dropped_entries_total",
+			Help: "Number of log entries dropped because they were received after the component was drained.",
+		}),
+	}
+	if err := o.Registerer.Register(c.shutdownDropped); err != nil {
+		return nil, err
 	}
 
 	// Create and immediately export the receiver which remains the same for
@@ -116,7 +129,15 @@ func (c *Component) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case entry := <-c.receiver.Chan():
-			c.mut.RLock()
+			if !c.rlock(ctx) {
+				return nil
+			}
+			if c.drained {
+				// There's nowhere left to write entries to once drained.
+				c.mut.RUnlock()
+				c.shutdownDropped.Inc()
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				c.mut.RUnlock()
@@ -128,6 +149,70 @@ func (c *Component) Run(ctx context.Context) error {
 	}
 }
 
+// rlock acquires a read lock on mut. It returns false without holding the
+// lock if ctx is canceled while it waits, so that Run can exit while Update
+// stops the previous clients.
+func (c *Component) rlock(ctx context.Context) bool {
+	if c.mut.TryRLock() {
+		return true
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		c.mut.RLock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return true
+	case <-ctx.Done():
+		// Release the lock once it's acquired.
+		go func() {
+			<-locked
+			c.mut.RUnlock()
+		}()
+		return false
+	}
+}
+
+// Drain implements component.Drainer. It stops the WAL writer and the
+// clients, which sends the batches still buffered in memory. They're stopped
+// without holding mut, so that Run keeps counting the entries it drops.
+//
+// If ctx is canceled first, Drain returns while the clients keep retrying to
+// send the remaining batches in the background.
+func (c *Component) Drain(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		c.mut.Lock()
+		if c.drained {
+			c.mut.Unlock()
+			return
+		}
+		// Once drained, Run stops sending entries to the sink and Update
+		// doesn't replace the clients anymore, so they can be stopped after
+		// releasing mut.
+		c.drained = true
+		walWriter, clientManager := c.walWriter, c.clientManger
+		c.mut.Unlock()
+
+		if walWriter != nil {
+			walWriter.Stop()
+		}
+		clientManager.Stop()
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Update implements component.Component.
 func (c *Component) Update(args component.Arguments) error {
 	newArgs := args.(Arguments)
@@ -135,6 +220,10 @@ func (c *Component) Update(args component.Arguments) error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 	c.args = newArgs
+	if c.drained {
+		// The clients were stopped by Drain and mustn't be recreated.
+		return nil
+	}
 
 	if c.walWriter != nil {
 		c.walWriter.Stop()
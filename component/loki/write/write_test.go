@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/common/loki"
 	"github.com/grafana/agent/component/common/loki/wal"
 	"github.com/grafana/agent/component/discovery"
@@ -17,6 +18,8 @@ import (
 	"github.com/grafana/agent/pkg/flow/componenttest"
 	"github.com/grafana/agent/pkg/util"
 	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
@@ -400,3 +403,133 @@ func benchSingleEndpoint(b *testing.B, tc testCase, alterConfig func(arguments *
 		}, time.Minute, time.Second, "haven't seen expected number of lines")
 	}
 }
+
+func TestDrain(t *testing.T) {
+	ch := make(chan logproto.PushRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pushReq logproto.PushRequest
+		err := loki_util.ParseProtoReader(context.Background(), r.Body, int(r.ContentLength), math.MaxInt32, &pushReq, loki_util.RawSnappy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ch <- pushReq
+	}))
+	defer srv.Close()
+
+	// The batch is only sent when the component is drained, since it's never
+	// old enough to be sent otherwise.
+	cfg := fmt.Sprintf(`
+		endpoint {
+			url        = "%s"
+			batch_wait = "1h"
+		}
+	`, srv.URL)
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	c, err := New(component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "buffered log"},
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	require.NoError(t, c.Drain(drainCtx))
+
+	select {
+	case req := <-ch:
+		require.Len(t, req.Streams, 1)
+		require.Equal(t, "buffered log", req.Streams[0].Entries[0].Line)
+	default:
+		require.FailNow(t, "buffered batch wasn't sent when draining")
+	}
+
+	// Entries received after the component was drained are dropped.
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "late log"},
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(c.shutdownDropped) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDrain_Timeout(t *testing.T) {
+	// The endpoint never answers until the test ends, so stopping the clients
+	// blocks.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := fmt.Sprintf(`
+		endpoint {
+			url        = "%s"
+			batch_wait = "1h"
+		}
+	`, srv.URL)
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	c, err := New(component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(e component.Exports) {},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "buffered log"},
+	}
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer drainCancel()
+	require.ErrorIs(t, c.Drain(drainCtx), context.DeadlineExceeded)
+
+	// Run isn't blocked by the clients being stopped.
+	c.receiver.Chan() <- loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "late log"},
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(c.shutdownDropped) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Run didn't exit after being canceled")
+	}
+}
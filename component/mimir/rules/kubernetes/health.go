@@ -26,6 +26,10 @@ func (c *Component) reportHealthy() {
 }
 
 func (c *Component) CurrentHealth() component.Health {
+	if health, ok := c.singleton.Health(); ok {
+		return health
+	}
+
 	c.healthMut.RLock()
 	defer c.healthMut.RUnlock()
 	return c.health
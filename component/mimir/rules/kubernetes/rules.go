@@ -10,6 +10,7 @@ import (
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	mimirClient "github.com/grafana/agent/pkg/mimir/client"
+	"github.com/grafana/agent/service/cluster"
 	"github.com/grafana/dskit/instrument"
 	promListers "github.com/prometheus-operator/prometheus-operator/pkg/client/listers/monitoring/v1"
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,9 +30,10 @@ import (
 
 func init() {
 	component.Register(component.Registration{
-		Name:    "mimir.rules.kubernetes",
-		Args:    Arguments{},
-		Exports: nil,
+		Name:          "mimir.rules.kubernetes",
+		Args:          Arguments{},
+		Exports:       nil,
+		NeedsServices: []string{cluster.ServiceName},
 		Build: func(o component.Options, c component.Arguments) (component.Component, error) {
 			return New(o, c.(Arguments))
 		},
@@ -65,6 +67,8 @@ type Component struct {
 	metrics   *metrics
 	healthMut sync.RWMutex
 	health    component.Health
+
+	singleton *cluster.Singleton
 }
 
 type metrics struct {
@@ -127,6 +131,7 @@ type ConfigUpdate struct {
 var _ component.Component = (*Component)(nil)
 var _ component.DebugComponent = (*Component)(nil)
 var _ component.HealthComponent = (*Component)(nil)
+var _ cluster.Component = (*Component)(nil)
 
 func New(o component.Options, args Arguments) (*Component, error) {
 	metrics := newMetrics()
@@ -135,6 +140,11 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		return nil, fmt.Errorf("registering metrics failed: %w", err)
 	}
 
+	data, err := o.GetServiceData(cluster.ServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get information about cluster: %w", err)
+	}
+
 	c := &Component{
 		log:           o.Logger,
 		opts:          o,
@@ -142,7 +152,9 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		configUpdates: make(chan ConfigUpdate),
 		ticker:        time.NewTicker(args.SyncInterval),
 		metrics:       metrics,
+		singleton:     cluster.NewSingleton(o.ID, o.Logger, data.(cluster.Cluster)),
 	}
+	c.singleton.SetBlock(args.Clustering)
 
 	err = c.init()
 	if err != nil {
@@ -153,19 +165,30 @@ func New(o component.Options, args Arguments) (*Component, error) {
 }
 
 func (c *Component) Run(ctx context.Context) error {
-	err := c.startup(ctx)
-	if err != nil {
-		level.Error(c.log).Log("msg", "starting up component failed", "err", err)
-		c.reportUnhealthy(err)
+	go c.singleton.Run(ctx)
+
+	// Rules are only synced while the singleton is active, which is always
+	// the case unless the component runs in the singleton clustering mode.
+	running := c.singleton.Active()
+	if running {
+		err := c.startup(ctx)
+		if err != nil {
+			level.Error(c.log).Log("msg", "starting up component failed", "err", err)
+			c.reportUnhealthy(err)
+		}
 	}
 
 	for {
 		select {
 		case update := <-c.configUpdates:
 			c.metrics.configUpdatesTotal.Inc()
-			c.shutdown()
+			if running {
+				c.shutdown()
+				running = false
+			}
 
 			c.args = update.args
+			c.singleton.SetBlock(c.args.Clustering)
 			err := c.init()
 			if err != nil {
 				level.Error(c.log).Log("msg", "updating configuration failed", "err", err)
@@ -174,26 +197,53 @@ func (c *Component) Run(ctx context.Context) error {
 				continue
 			}
 
-			err = c.startup(ctx)
-			if err != nil {
-				level.Error(c.log).Log("msg", "updating configuration failed", "err", err)
-				c.reportUnhealthy(err)
-				update.err <- err
-				continue
+			if c.singleton.Active() {
+				running = true
+				err = c.startup(ctx)
+				if err != nil {
+					level.Error(c.log).Log("msg", "updating configuration failed", "err", err)
+					c.reportUnhealthy(err)
+					update.err <- err
+					continue
+				}
 			}
 
 			update.err <- nil
+		case <-c.singleton.Changes():
+			active := c.singleton.Active()
+			if active == running {
+				continue
+			}
+			running = active
+
+			if !active {
+				c.shutdown()
+				continue
+			}
+			if err := c.startup(ctx); err != nil {
+				level.Error(c.log).Log("msg", "starting up component failed", "err", err)
+				c.reportUnhealthy(err)
+			}
 		case <-ctx.Done():
-			c.shutdown()
+			if running {
+				c.shutdown()
+			}
 			return nil
 		case <-c.ticker.C:
-			c.queue.Add(event{
-				typ: eventTypeSyncMimir,
-			})
+			if running {
+				c.queue.Add(event{
+					typ: eventTypeSyncMimir,
+				})
+			}
 		}
 	}
 }
 
+// NotifyClusterChange implements cluster.Component.
+func (c *Component) NotifyClusterChange() {
+	c.singleton.Notify()
+}
+
 // startup launches the informers and starts the event loop.
 func (c *Component) startup(ctx context.Context) error {
 	c.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "mimir.rules.kubernetes")
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/grafana/agent/component/common/config"
+	"github.com/grafana/agent/service/cluster"
 )
 
 type Arguments struct {
@@ -17,12 +18,15 @@ type Arguments struct {
 
 	RuleSelector          LabelSelector `river:"rule_selector,block,optional"`
 	RuleNamespaceSelector LabelSelector `river:"rule_namespace_selector,block,optional"`
+
+	Clustering cluster.SingletonBlock `river:"clustering,block,optional"`
 }
 
 var DefaultArguments = Arguments{
 	SyncInterval:         30 * time.Second,
 	MimirNameSpacePrefix: "agent",
 	HTTPClientConfig:     config.DefaultHTTPClientConfig,
+	Clustering:           cluster.DefaultSingletonBlock,
 }
 
 // SetToDefault implements river.Defaulter.
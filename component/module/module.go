@@ -20,6 +20,10 @@ type ModuleComponent struct {
 	health        component.Health
 	latestContent string
 	latestArgs    map[string]any
+
+	// failed is set when loading the content failed, leaving the module in an
+	// unknown state. The content is then reloaded even if it's unchanged.
+	failed bool
 }
 
 // Exports holds values which are exported from the run module.
@@ -42,13 +46,14 @@ func NewModuleComponent(o component.Options) (*ModuleComponent, error) {
 
 // LoadFlowSource loads the flow controller with the current component source.
 // It will set the component health in addition to return the error so that the consumer can rely on either or both.
-// If the content is the same as the last time it was successfully loaded, it will not be reloaded.
+// If the content is the same as the last time it was successfully loaded, and no load failed since, it will not be reloaded.
 func (c *ModuleComponent) LoadFlowSource(args map[string]any, contentValue string) error {
-	if reflect.DeepEqual(args, c.getLatestArgs()) && contentValue == c.getLatestContent() {
+	if !c.getFailed() && reflect.DeepEqual(args, c.getLatestArgs()) && contentValue == c.getLatestContent() {
 		return nil
 	}
 
 	err := c.mod.LoadConfig([]byte(contentValue), args)
+	c.setFailed(err != nil)
 	if err != nil {
 		c.setHealth(component.Health{
 			Health:     component.HealthTypeUnhealthy,
@@ -119,3 +124,15 @@ func (c *ModuleComponent) getLatestArgs() map[string]any {
 	defer c.mut.RUnlock()
 	return c.latestArgs
 }
+
+func (c *ModuleComponent) setFailed(failed bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.failed = failed
+}
+
+func (c *ModuleComponent) getFailed() bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.failed
+}
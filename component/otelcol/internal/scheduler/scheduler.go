@@ -39,6 +39,14 @@ type Scheduler struct {
 
 	// newComponentsCh is written to when schedComponents gets updated.
 	newComponentsCh chan struct{}
+	// shutdownCh is written to by Shutdown, with a channel closed once the
+	// running components stopped.
+	shutdownCh chan shutdownRequest
+}
+
+type shutdownRequest struct {
+	ctx  context.Context
+	done chan struct{}
 }
 
 // New creates a new unstarted Scheduler. Call Run to start it, and call
@@ -47,6 +55,7 @@ func New(l log.Logger) *Scheduler {
 	return &Scheduler{
 		log:             l,
 		newComponentsCh: make(chan struct{}, 1),
+		shutdownCh:      make(chan shutdownRequest),
 	}
 }
 
@@ -72,10 +81,33 @@ func (cs *Scheduler) Schedule(h otelcomponent.Host, cc ...otelcomponent.Componen
 	}
 }
 
+// Shutdown stops the running components, which flush the data they hold.
+// Components scheduled afterwards aren't started. Shutdown blocks until the
+// components stopped or ctx is canceled, and must be called while the
+// Scheduler is running.
+func (cs *Scheduler) Shutdown(ctx context.Context) error {
+	req := shutdownRequest{ctx: ctx, done: make(chan struct{})}
+	select {
+	case cs.shutdownCh <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-req.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Run starts the Scheduler. Run will watch for schedule components to appear
 // and run them, terminating previously running components if they exist.
 func (cs *Scheduler) Run(ctx context.Context) error {
-	var components []otelcomponent.Component
+	var (
+		components []otelcomponent.Component
+		shutdown   bool
+	)
 
 	// Make sure we terminate all of our running components on shutdown.
 	defer func() {
@@ -89,7 +121,16 @@ func (cs *Scheduler) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return nil
+		case req := <-cs.shutdownCh:
+			cs.stopComponents(req.ctx, components...)
+			components = nil
+			shutdown = true
+			close(req.done)
 		case <-cs.newComponentsCh:
+			if shutdown {
+				continue
+			}
+
 			// Stop the old components before running new scheduled ones.
 			cs.stopComponents(ctx, components...)
 
@@ -2,6 +2,7 @@
 package batch
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -23,11 +24,29 @@ func init() {
 
 		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
 			fact := batchprocessor.NewFactory()
-			return processor.New(opts, fact, args.(Arguments))
+			p, err := processor.New(opts, fact, args.(Arguments))
+			if err != nil {
+				return nil, err
+			}
+			return &Component{Processor: p}, nil
 		},
 	})
 }
 
+// Component is the otelcol.processor.batch component.
+type Component struct {
+	*processor.Processor
+}
+
+var _ component.Drainer = (*Component)(nil)
+
+// Drain implements component.Drainer. It stops the batch processor, which
+// sends the batches it holds to the next consumers. Data sent to the
+// component afterwards is rejected.
+func (c *Component) Drain(ctx context.Context) error {
+	return c.Shutdown(ctx)
+}
+
 // Arguments configures the otelcol.processor.batch component.
 type Arguments struct {
 	Timeout                  time.Duration `river:"timeout,attr,optional"`
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/component/otelcol"
 	"github.com/grafana/agent/component/otelcol/internal/fakeconsumer"
 	"github.com/grafana/agent/component/otelcol/processor/batch"
@@ -13,9 +14,11 @@ import (
 	"github.com/grafana/agent/pkg/util"
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/processor/batchprocessor"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Test performs a basic integration test which runs the
@@ -78,6 +81,73 @@ func Test(t *testing.T) {
 	}
 }
 
+func TestDrain(t *testing.T) {
+	// The batch is only sent when the component is drained, since it's never
+	// old or large enough to be sent otherwise.
+	cfg := `
+		timeout         = "1h"
+		send_batch_size = 1000
+
+		output {
+			// no-op: will be overridden by test code.
+		}
+	`
+	var args batch.Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	traceCh := make(chan ptrace.Traces, 1)
+	args.Output = makeTracesOutput(traceCh)
+
+	var exports otelcol.ConsumerExports
+	reg, ok := component.Get("otelcol.processor.batch")
+	require.True(t, ok)
+	c, err := reg.Build(component.Options{
+		ID:     "otelcol.processor.batch.test",
+		Logger: util.TestFlowLogger(t),
+		Tracer: trace.NewNoopTracerProvider(),
+		OnStateChange: func(e component.Exports) {
+			exports = e.(otelcol.ConsumerExports)
+		},
+		Registerer: prometheus.NewRegistry(),
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	drainer, ok := c.(component.Drainer)
+	require.True(t, ok)
+
+	// Wait for the batch processor to be started.
+	require.Eventually(t, func() bool {
+		return c.(component.HealthComponent).CurrentHealth().Health == component.HealthTypeHealthy
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, exports.Input.ConsumeTraces(ctx, createTestTraces()))
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	require.NoError(t, drainer.Drain(drainCtx))
+
+	select {
+	case tr := <-traceCh:
+		require.Equal(t, 1, tr.SpanCount())
+	default:
+		require.FailNow(t, "buffered batch wasn't sent when draining")
+	}
+
+	// Data sent after the component was drained is rejected.
+	require.Error(t, exports.Input.ConsumeTraces(ctx, createTestTraces()))
+}
+
 // makeTracesOutput returns ConsumerArguments which will forward traces to the
 // provided channel.
 func makeTracesOutput(ch chan ptrace.Traces) *otelcol.ConsumerArguments {
@@ -109,6 +109,16 @@ func (p *Processor) Run(ctx context.Context) error {
 	return p.sched.Run(ctx)
 }
 
+// Shutdown stops the OpenTelemetry Collector processors, which flush the
+// data they hold to the next consumers. Data sent to the Processor afterwards
+// is rejected. Shutdown blocks until the processors stopped or ctx is
+// canceled.
+func (p *Processor) Shutdown(ctx context.Context) error {
+	// Canceling the context of the consumer rejects new data.
+	p.cancel()
+	return p.sched.Shutdown(ctx)
+}
+
 // Update implements component.Component. It will convert the Arguments into
 // configuration for OpenTelemetry Collector processor configuration and manage
 // the underlying OpenTelemetry Collector processor.
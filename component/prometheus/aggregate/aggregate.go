@@ -0,0 +1,340 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/service/labelstore"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/storage"
+	"go.uber.org/atomic"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.aggregate",
+		Args:          Arguments{},
+		Exports:       Exports{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Operations supported by aggregation rules.
+const (
+	OperationSum   = "sum"
+	OperationCount = "count"
+	OperationMin   = "min"
+	OperationMax   = "max"
+	OperationAvg   = "avg"
+)
+
+// Types of the series aggregated by rules.
+const (
+	TypeAuto    = "auto"
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// Arguments holds values which are used to configure the prometheus.aggregate
+// component.
+type Arguments struct {
+	// Where the aggregated metrics should be forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	// How often aggregated samples are forwarded.
+	Interval time.Duration `river:"interval,attr,optional"`
+
+	// The aggregation rules. Series are aggregated by the first rule matching
+	// their metric name.
+	Rules []Rule `river:"rule,block,optional"`
+}
+
+// DefaultArguments holds the default settings of prometheus.aggregate.
+var DefaultArguments = Arguments{
+	Interval: time.Minute,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.Interval <= 0 {
+		return fmt.Errorf("interval must be greater than 0")
+	}
+	for i, r := range args.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("invalid rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Rule configures how the series of matching metrics are aggregated.
+type Rule struct {
+	Match     flow_relabel.Regexp `river:"match,attr"`
+	Operation string              `river:"operation,attr,optional"`
+	By        []string            `river:"by,attr,optional"`
+	Without   []string            `river:"without,attr,optional"`
+	Type      string              `river:"type,attr,optional"`
+	Suffix    string              `river:"suffix,attr,optional"`
+}
+
+// DefaultRule holds the default settings of an aggregation rule.
+var DefaultRule = Rule{
+	Operation: OperationSum,
+	Type:      TypeAuto,
+}
+
+// SetToDefault implements river.Defaulter.
+func (r *Rule) SetToDefault() {
+	*r = DefaultRule
+}
+
+func (r *Rule) validate() error {
+	switch r.Operation {
+	case OperationSum, OperationCount, OperationMin, OperationMax, OperationAvg:
+	default:
+		return fmt.Errorf("unsupported operation %q", r.Operation)
+	}
+	switch r.Type {
+	case TypeAuto, TypeCounter, TypeGauge:
+	default:
+		return fmt.Errorf("unsupported type %q", r.Type)
+	}
+	if len(r.By) > 0 && len(r.Without) > 0 {
+		return fmt.Errorf("by and without can't be used together")
+	}
+	return nil
+}
+
+// equal returns true if r and o aggregate series the same way.
+func (r Rule) equal(o Rule) bool {
+	if r.Match.String() != o.Match.String() || r.Operation != o.Operation ||
+		r.Type != o.Type || r.Suffix != o.Suffix {
+		return false
+	}
+	return equalStrings(r.By, o.By) && equalStrings(r.Without, o.Without)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalRules(a, b []Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Exports holds values which are exported by the prometheus.aggregate
+// component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.aggregate component.
+type Component struct {
+	opts       component.Options
+	aggregator *Aggregator
+	receiver   *prometheus.Interceptor
+	fanout     *prometheus.Fanout
+	exited     atomic.Bool
+
+	flushFailures prometheus_client.Counter
+
+	onUpdate chan struct{}
+
+	mut  sync.RWMutex
+	args Arguments
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+)
+
+// New creates a new prometheus.aggregate component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ls := data.(labelstore.LabelStore)
+
+	dropped := prometheus_client.NewCounterVec(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_aggregate_samples_dropped_total",
+		Help: "Total number of samples of aggregated series which were dropped.",
+	}, []string{"reason"})
+
+	c := &Component{
+		opts:       o,
+		aggregator: NewAggregator(ls, dropped),
+		onUpdate:   make(chan struct{}, 1),
+	}
+
+	c.flushFailures = prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_aggregate_flush_failures_total",
+		Help: "Total number of aggregated samples which couldn't be forwarded.",
+	})
+	inputSeries := prometheus_client.NewGaugeFunc(prometheus_client.GaugeOpts{
+		Name: "agent_prometheus_aggregate_input_series",
+		Help: "Number of series being aggregated.",
+	}, func() float64 { return float64(c.aggregator.NumSeries()) })
+	outputSeries := prometheus_client.NewGaugeFunc(prometheus_client.GaugeOpts{
+		Name: "agent_prometheus_aggregate_output_series",
+		Help: "Number of aggregated series.",
+	}, func() float64 { return float64(c.aggregator.NumGroups()) })
+
+	for _, metric := range []prometheus_client.Collector{dropped, c.flushFailures, inputSeries, outputSeries} {
+		if err := o.Registerer.Register(metric); err != nil {
+			return nil, err
+		}
+	}
+
+	c.fanout = prometheus.NewFanout(args.ForwardTo, o.ID, o.Registerer, ls)
+	c.receiver = prometheus.NewInterceptor(
+		c.fanout,
+		ls,
+		prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, t int64, v float64, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			if c.aggregator.AppendFloat(l, v, time.Now()) {
+				return ref, nil
+			}
+			return next.Append(ref, l, t, v)
+		}),
+		prometheus.WithHistogramHook(func(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			if c.aggregator.AppendHistogram(l, h, fh, time.Now()) {
+				return ref, nil
+			}
+			return next.AppendHistogram(ref, l, t, h, fh)
+		}),
+		prometheus.WithExemplarHook(func(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			// Exemplars of aggregated series are dropped.
+			if c.aggregator.Matches(l) {
+				return ref, nil
+			}
+			return next.AppendExemplar(ref, l, e)
+		}),
+		prometheus.WithMetadataHook(func(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			if c.aggregator.Matches(l) {
+				return ref, nil
+			}
+			return next.UpdateMetadata(ref, l, m)
+		}),
+	)
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer c.exited.Store(true)
+
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.onUpdate:
+			ticker.Reset(c.interval())
+		case <-ticker.C:
+			c.flush(ctx, time.Now())
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	// The state of the aggregated series is only discarded when the rules
+	// change.
+	if !equalRules(c.args.Rules, newArgs.Rules) {
+		c.aggregator.SetRules(newArgs.Rules)
+	}
+	c.args = newArgs
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+	c.mut.Unlock()
+
+	select {
+	case c.onUpdate <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *Component) interval() time.Duration {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.args.Interval
+}
+
+// flush forwards the aggregated samples at now.
+func (c *Component) flush(ctx context.Context, now time.Time) {
+	samples := c.aggregator.Flush(now)
+	if len(samples) == 0 {
+		return
+	}
+
+	app := c.fanout.Appender(ctx)
+	failed, lastErr := AppendSamples(app, samples)
+	if err := app.Commit(); err != nil {
+		failed = len(samples)
+		lastErr = err
+	}
+
+	if failed > 0 {
+		level.Warn(c.opts.Logger).Log("msg", "failed to forward aggregated samples", "failed", failed, "err", lastErr)
+		c.flushFailures.Add(float64(failed))
+	}
+}
@@ -0,0 +1,301 @@
+package aggregate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator_Counters(t *testing.T) {
+	a := newTestAggregator(t, `
+		rule {
+			match = "http_requests_total"
+			by    = ["job"]
+		}
+	`)
+	now := time.Now()
+
+	a.AppendFloat(labels.FromStrings("__name__", "http_requests_total", "job", "app", "instance", "a"), 10, now)
+	a.AppendFloat(labels.FromStrings("__name__", "http_requests_total", "job", "app", "instance", "b"), 5, now)
+	requireSamples(t, map[string]float64{
+		`{__name__="http_requests_total", job="app"}`: 15,
+	}, a.Flush(now))
+
+	// The total keeps increasing when a counter is reset.
+	a.AppendFloat(labels.FromStrings("__name__", "http_requests_total", "job", "app", "instance", "a"), 12, now)
+	a.AppendFloat(labels.FromStrings("__name__", "http_requests_total", "job", "app", "instance", "b"), 3, now)
+	requireSamples(t, map[string]float64{
+		`{__name__="http_requests_total", job="app"}`: 20,
+	}, a.Flush(now))
+}
+
+func TestAggregator_Gauges(t *testing.T) {
+	a := newTestAggregator(t, `
+		rule {
+			match     = "temperature"
+			operation = "avg"
+			without   = ["instance"]
+		}
+		rule {
+			match     = "memory_bytes"
+			operation = "max"
+			by        = ["job"]
+			suffix    = ":max"
+		}
+		rule {
+			match     = "up"
+			operation = "count"
+		}
+	`)
+	now := time.Now()
+
+	for i, v := range []float64{10, 20, 30} {
+		instance := string(rune('a' + i))
+		a.AppendFloat(labels.FromStrings("__name__", "temperature", "room", "kitchen", "instance", instance), v, now)
+		a.AppendFloat(labels.FromStrings("__name__", "memory_bytes", "job", "app", "instance", instance), v*2, now)
+		a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", instance), 1, now)
+	}
+	// Gauges are aggregated from their most recent value.
+	a.AppendFloat(labels.FromStrings("__name__", "temperature", "room", "kitchen", "instance", "a"), 40, now)
+
+	requireSamples(t, map[string]float64{
+		`{__name__="temperature", room="kitchen"}`: 30,
+		`{__name__="memory_bytes:max", job="app"}`: 60,
+		`{__name__="up"}`:                          3,
+	}, a.Flush(now))
+}
+
+func TestAggregator_Staleness(t *testing.T) {
+	ls := labelstore.New(nil)
+	a := NewAggregator(ls, newDroppedCounter())
+	a.SetRules(parseRules(t, `
+		rule {
+			match = "up"
+			by    = ["job"]
+		}
+	`))
+	now := time.Now()
+
+	a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", "a"), 1, now)
+	a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", "b"), 1, now)
+	require.Len(t, a.Flush(now), 1)
+
+	// The output series is only stale once all its input series are.
+	stale := math.Float64frombits(value.StaleNaN)
+	a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", "a"), stale, now)
+	requireSamples(t, map[string]float64{`{__name__="up", job="app"}`: 1}, a.Flush(now))
+
+	a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", "b"), stale, now)
+	samples := a.Flush(now)
+	require.Len(t, samples, 1)
+	require.True(t, value.IsStaleNaN(samples[0].V))
+	require.Equal(t, 0, a.NumGroups())
+	require.Empty(t, a.Flush(now))
+
+	// Input series without samples for too long are removed.
+	a.AppendFloat(labels.FromStrings("__name__", "up", "job", "app", "instance", "a"), 1, now)
+	samples = a.Flush(now.Add(seriesTimeout + time.Second))
+	require.Len(t, samples, 1)
+	require.True(t, value.IsStaleNaN(samples[0].V))
+	require.Equal(t, 0, a.NumSeries())
+}
+
+func TestAggregator_NativeHistograms(t *testing.T) {
+	a := newTestAggregator(t, `
+		rule {
+			match = "request_duration_seconds"
+			by    = ["job"]
+		}
+	`)
+	now := time.Now()
+
+	a.AppendHistogram(labels.FromStrings("__name__", "request_duration_seconds", "job", "app", "instance", "a"), testHistogram(10), nil, now)
+	a.AppendHistogram(labels.FromStrings("__name__", "request_duration_seconds", "job", "app", "instance", "b"), nil, testHistogram(5).ToFloat(), now)
+	samples := a.Flush(now)
+	require.Len(t, samples, 1)
+	require.Equal(t, float64(15), samples[0].H.Count)
+
+	// Instance b was reset.
+	a.AppendHistogram(labels.FromStrings("__name__", "request_duration_seconds", "job", "app", "instance", "a"), testHistogram(12), nil, now)
+	a.AppendHistogram(labels.FromStrings("__name__", "request_duration_seconds", "job", "app", "instance", "b"), testHistogram(2), nil, now)
+	samples = a.Flush(now)
+	require.Len(t, samples, 1)
+	require.Equal(t, float64(19), samples[0].H.Count)
+	require.Equal(t, []float64{19}, samples[0].H.PositiveBuckets)
+
+	// Float samples of the histogram series are dropped.
+	require.True(t, a.AppendFloat(labels.FromStrings("__name__", "request_duration_seconds", "job", "app", "instance", "a"), 1, now))
+}
+
+func TestComponent(t *testing.T) {
+	var (
+		ls       = labelstore.New(nil)
+		received = newSampleRecorder(ls)
+	)
+
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		forward_to = []
+		rule {
+			match = "http_requests_total"
+			by    = ["job"]
+		}
+	`), &args))
+	args.ForwardTo = []storage.Appendable{received.appendable}
+
+	c, err := New(component.Options{
+		ID:            "prometheus.aggregate.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, args)
+	require.NoError(t, err)
+
+	app := c.receiver.Appender(context.Background())
+	for _, instance := range []string{"a", "b"} {
+		_, err := app.Append(0, labels.FromStrings("__name__", "http_requests_total", "job", "app", "instance", instance), 0, 2)
+		require.NoError(t, err)
+		_, err = app.Append(0, labels.FromStrings("__name__", "up", "job", "app", "instance", instance), 0, 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	// Series which aren't aggregated are forwarded immediately.
+	require.Equal(t, map[string]float64{
+		`{__name__="up", instance="a", job="app"}`: 1,
+		`{__name__="up", instance="b", job="app"}`: 1,
+	}, received.Samples())
+
+	c.flush(context.Background(), time.Now())
+	require.Equal(t, float64(4), received.Samples()[`{__name__="http_requests_total", job="app"}`])
+
+	// Changing the rules removes the previous output series.
+	newArgs := args
+	newArgs.Rules = []Rule{args.Rules[0]}
+	newArgs.Rules[0].By = []string{"instance"}
+	require.NoError(t, c.Update(newArgs))
+	c.flush(context.Background(), time.Now())
+	require.True(t, value.IsStaleNaN(received.Samples()[`{__name__="http_requests_total", job="app"}`]))
+}
+
+func TestArguments_Validate(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		forward_to = []
+		rule {
+			match     = "up"
+			operation = "median"
+		}
+	`), &args)
+	require.ErrorContains(t, err, `invalid rule 1: unsupported operation "median"`)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		rule {
+			match   = "up"
+			by      = ["job"]
+			without = ["instance"]
+		}
+	`), &args)
+	require.ErrorContains(t, err, "by and without can't be used together")
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		rule {
+			match = "up"
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, args.Interval)
+	require.Equal(t, OperationSum, args.Rules[0].Operation)
+	require.Equal(t, TypeAuto, args.Rules[0].Type)
+}
+
+func newTestAggregator(t *testing.T, rules string) *Aggregator {
+	a := NewAggregator(labelstore.New(nil), newDroppedCounter())
+	a.SetRules(parseRules(t, rules))
+	return a
+}
+
+func parseRules(t *testing.T, rules string) []Rule {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte("forward_to = []\n"+rules), &args))
+	return args.Rules
+}
+
+func newDroppedCounter() *prom.CounterVec {
+	return prom.NewCounterVec(prom.CounterOpts{Name: "dropped"}, []string{"reason"})
+}
+
+// requireSamples checks the values of float samples by the string of their
+// labels.
+func requireSamples(t *testing.T, expect map[string]float64, samples []Sample) {
+	t.Helper()
+
+	actual := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		actual[s.Labels.String()] = s.V
+	}
+	require.Equal(t, expect, actual)
+}
+
+// testHistogram returns a native histogram with count observations in a
+// single bucket.
+func testHistogram(count uint64) *histogram.Histogram {
+	return &histogram.Histogram{
+		Count:           count,
+		Sum:             float64(count),
+		Schema:          0,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 1}},
+		PositiveBuckets: []int64{int64(count)},
+	}
+}
+
+// sampleRecorder records the most recent value of each series appended to
+// its appendable.
+type sampleRecorder struct {
+	appendable storage.Appendable
+
+	mut     sync.Mutex
+	samples map[string]float64
+}
+
+func newSampleRecorder(ls labelstore.LabelStore) *sampleRecorder {
+	r := &sampleRecorder{samples: make(map[string]float64)}
+	r.appendable = prometheus.NewInterceptor(nil, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		r.mut.Lock()
+		defer r.mut.Unlock()
+		r.samples[l.String()] = v
+		return ref, nil
+	}))
+	return r
+}
+
+// Samples returns a copy of the recorded samples.
+func (r *sampleRecorder) Samples() map[string]float64 {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	res := make(map[string]float64, len(r.samples))
+	for k, v := range r.samples {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,438 @@
+package aggregate
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/service/labelstore"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// seriesTimeout is how long an input series is aggregated after its last
+// sample if it never receives a staleness marker.
+const seriesTimeout = 5 * time.Minute
+
+// Reasons for dropping samples of aggregated series.
+const (
+	dropUnsupportedHistogram = "unsupported_histogram"
+	dropTypeMismatch         = "type_mismatch"
+)
+
+// counterSuffixes are the metric name suffixes of series which are treated as
+// counters by rules of type "auto".
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// Aggregator holds the state of the aggregated series. Samples update the
+// state as they're appended, and Flush returns the aggregated samples. It's
+// also used by other components to aggregate series.
+//
+// Aggregation doesn't follow the transactions of appenders: samples of
+// appenders which are rolled back are still aggregated.
+type Aggregator struct {
+	ls      labelstore.LabelStore
+	dropped *prometheus_client.CounterVec
+
+	mut     sync.Mutex
+	rules   []Rule
+	series  map[uint64]*inputSeries // Input series by global ref ID.
+	groups  map[uint64]*group       // Output series by global ref ID.
+	removed []*group                // Groups to send staleness markers for.
+}
+
+// group is an output series aggregating input series.
+type group struct {
+	ref       uint64
+	labels    labels.Labels
+	rule      *Rule
+	histogram bool // Whether the group aggregates native histograms.
+	counter   bool // Whether input series are counters.
+	members   map[uint64]*inputSeries
+
+	// Running totals of the increases of counters, used by sum.
+	total     float64
+	totalHist *histogram.FloatHistogram
+}
+
+// inputSeries is the most recent state of a series being aggregated.
+type inputSeries struct {
+	group    *group
+	lastSeen time.Time
+	value    float64
+	hist     *histogram.FloatHistogram
+}
+
+// Sample is an aggregated sample to forward.
+type Sample struct {
+	Ref    uint64 // Global ref ID of the labels.
+	Labels labels.Labels
+	T      int64
+	V      float64
+	H      *histogram.FloatHistogram // Set for native histograms.
+}
+
+// NewAggregator creates an Aggregator without rules. Samples dropped by the
+// Aggregator are counted by dropped, by reason.
+func NewAggregator(ls labelstore.LabelStore, dropped *prometheus_client.CounterVec) *Aggregator {
+	return &Aggregator{
+		ls:      ls,
+		dropped: dropped,
+		series:  make(map[uint64]*inputSeries),
+		groups:  make(map[uint64]*group),
+	}
+}
+
+// SetRules replaces the aggregation rules. The state of the current output
+// series is discarded, and staleness markers are sent for them on the next
+// flush.
+func (a *Aggregator) SetRules(rules []Rule) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	a.rules = rules
+	for _, g := range a.groups {
+		a.removed = append(a.removed, g)
+	}
+	a.series = make(map[uint64]*inputSeries)
+	a.groups = make(map[uint64]*group)
+}
+
+// Matches returns true if series with the labels l are aggregated.
+func (a *Aggregator) Matches(l labels.Labels) bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return a.match(l) != nil
+}
+
+// AppendFloat aggregates a float sample. It returns false if the series isn't
+// aggregated and the sample must be forwarded.
+func (a *Aggregator) AppendFloat(l labels.Labels, v float64, now time.Time) bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	rule := a.match(l)
+	if rule == nil {
+		return false
+	}
+
+	ref := a.ls.GetOrAddGlobalRefID(l)
+	if value.IsStaleNaN(v) {
+		if s, ok := a.series[ref]; ok {
+			a.removeSeries(ref, s)
+		}
+		return true
+	}
+
+	s := a.getOrCreateSeries(ref, rule, l, false, rule.isCounter(l.Get(labels.MetricName)))
+	if s == nil {
+		a.dropped.WithLabelValues(dropTypeMismatch).Inc()
+		return true
+	}
+	s.lastSeen = now
+
+	g := s.group
+	if g.counter && g.rule.Operation == OperationSum {
+		// NaN samples would make the total NaN forever.
+		if math.IsNaN(v) {
+			return true
+		}
+		g.total += increase(s, v)
+	}
+	s.value = v
+	return true
+}
+
+// increase returns the increase of the counter s from its previous value to v.
+// The full value of a counter is its increase the first time it's seen or
+// after it's reset.
+func increase(s *inputSeries, v float64) float64 {
+	if math.IsNaN(s.value) || v < s.value {
+		return v
+	}
+	return v - s.value
+}
+
+// AppendHistogram aggregates a native histogram sample. It returns false if
+// the series isn't aggregated and the sample must be forwarded.
+func (a *Aggregator) AppendHistogram(l labels.Labels, h *histogram.Histogram, fh *histogram.FloatHistogram, now time.Time) bool {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	rule := a.match(l)
+	if rule == nil {
+		return false
+	}
+	if rule.Operation != OperationSum && rule.Operation != OperationCount {
+		a.dropped.WithLabelValues(dropUnsupportedHistogram).Inc()
+		return true
+	}
+
+	if fh == nil {
+		fh = h.ToFloat()
+	} else {
+		fh = fh.Copy()
+	}
+
+	ref := a.ls.GetOrAddGlobalRefID(l)
+	s := a.getOrCreateSeries(ref, rule, l, true, rule.isHistogramCounter(fh))
+	if s == nil {
+		a.dropped.WithLabelValues(dropTypeMismatch).Inc()
+		return true
+	}
+	s.lastSeen = now
+
+	g := s.group
+	if g.counter && g.rule.Operation == OperationSum {
+		delta := fh
+		if s.hist != nil && !fh.DetectReset(s.hist) {
+			delta = fh.Copy().Sub(s.hist)
+		}
+		g.addHistogram(delta)
+	}
+	s.hist = fh
+	return true
+}
+
+// addHistogram adds delta to the total of the group.
+func (g *group) addHistogram(delta *histogram.FloatHistogram) {
+	if g.totalHist == nil {
+		g.totalHist = delta.Copy()
+		g.totalHist.CounterResetHint = histogram.UnknownCounterReset
+		return
+	}
+	// The schema of the total must not be higher than the schema of the
+	// histograms added to it.
+	if delta.Schema < g.totalHist.Schema {
+		g.totalHist = g.totalHist.CopyToSchema(delta.Schema)
+	}
+	g.totalHist.Add(delta)
+}
+
+// match returns the first rule matching the metric name of l, or nil.
+func (a *Aggregator) match(l labels.Labels) *Rule {
+	name := l.Get(labels.MetricName)
+	for i := range a.rules {
+		if a.rules[i].Match.MatchString(name) {
+			return &a.rules[i]
+		}
+	}
+	return nil
+}
+
+// getOrCreateSeries returns the state of the input series ref, creating it
+// and its group if needed. It returns nil if the group aggregates samples of
+// another type. counter tells whether a new group aggregates counters.
+func (a *Aggregator) getOrCreateSeries(ref uint64, rule *Rule, l labels.Labels, isHistogram, counter bool) *inputSeries {
+	if s, ok := a.series[ref]; ok {
+		if s.group.histogram != isHistogram {
+			return nil
+		}
+		return s
+	}
+
+	out := rule.outputLabels(l)
+	gref := a.ls.GetOrAddGlobalRefID(out)
+	g, ok := a.groups[gref]
+	if !ok {
+		g = &group{
+			ref:       gref,
+			labels:    out,
+			rule:      rule,
+			histogram: isHistogram,
+			counter:   counter,
+			members:   make(map[uint64]*inputSeries),
+		}
+		a.groups[gref] = g
+		// The output series may have been removed previously.
+		a.ls.RemoveStaleMarker(gref)
+	}
+	if g.histogram != isHistogram {
+		return nil
+	}
+
+	s := &inputSeries{group: g, value: math.NaN()}
+	a.series[ref] = s
+	g.members[ref] = s
+	return s
+}
+
+// removeSeries stops aggregating the input series ref. Its group is removed
+// once it has no input series left.
+func (a *Aggregator) removeSeries(ref uint64, s *inputSeries) {
+	delete(a.series, ref)
+
+	g := s.group
+	delete(g.members, ref)
+	if len(g.members) == 0 {
+		delete(a.groups, g.ref)
+		a.removed = append(a.removed, g)
+	}
+}
+
+// Flush returns the aggregated samples of the output series at now, and
+// staleness markers for the output series which were removed since the
+// previous flush.
+func (a *Aggregator) Flush(now time.Time) []Sample {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	for ref, s := range a.series {
+		if now.Sub(s.lastSeen) > seriesTimeout {
+			a.removeSeries(ref, s)
+		}
+	}
+
+	var (
+		t   = now.UnixMilli()
+		out = make([]Sample, 0, len(a.groups)+len(a.removed))
+	)
+	for _, g := range a.removed {
+		// The group may have been created again since it was removed.
+		if _, ok := a.groups[g.ref]; ok {
+			continue
+		}
+		out = append(out, Sample{Ref: g.ref, Labels: g.labels, T: t, V: math.Float64frombits(value.StaleNaN)})
+		a.ls.AddStaleMarker(g.ref, g.labels)
+	}
+	a.removed = nil
+
+	for _, g := range a.groups {
+		s := g.sample()
+		s.T = t
+		out = append(out, s)
+	}
+	return out
+}
+
+// AppendSamples appends samples to app. It returns the number of samples
+// which couldn't be appended, and the last error.
+func AppendSamples(app storage.Appender, samples []Sample) (failed int, err error) {
+	for _, s := range samples {
+		var appendErr error
+		if s.H != nil {
+			_, appendErr = app.AppendHistogram(storage.SeriesRef(s.Ref), s.Labels, s.T, nil, s.H)
+		} else {
+			_, appendErr = app.Append(storage.SeriesRef(s.Ref), s.Labels, s.T, s.V)
+		}
+		if appendErr != nil {
+			failed++
+			err = appendErr
+		}
+	}
+	return failed, err
+}
+
+// NumSeries returns the number of input series being aggregated.
+func (a *Aggregator) NumSeries() int {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return len(a.series)
+}
+
+// NumGroups returns the number of output series.
+func (a *Aggregator) NumGroups() int {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return len(a.groups)
+}
+
+// sample returns the current aggregated value of the group.
+func (g *group) sample() Sample {
+	s := Sample{Ref: g.ref, Labels: g.labels}
+
+	op := g.rule.Operation
+	switch {
+	case op == OperationCount:
+		s.V = float64(len(g.members))
+	case g.histogram && g.counter:
+		s.H = g.totalHist.Copy().Compact(0)
+	case g.histogram:
+		for _, m := range g.members {
+			if s.H == nil {
+				s.H = m.hist.Copy()
+				continue
+			}
+			if m.hist.Schema < s.H.Schema {
+				s.H = s.H.CopyToSchema(m.hist.Schema)
+			}
+			s.H.Add(m.hist)
+		}
+		s.H.CounterResetHint = histogram.GaugeType
+		s.H.Compact(0)
+	case op == OperationSum && g.counter:
+		s.V = g.total
+	default:
+		s.V = g.aggregateValues(op)
+	}
+	return s
+}
+
+// aggregateValues applies op to the most recent values of the input series.
+func (g *group) aggregateValues(op string) float64 {
+	var (
+		sum      float64
+		min, max = math.Inf(1), math.Inf(-1)
+	)
+	for _, m := range g.members {
+		sum += m.value
+		min = math.Min(min, m.value)
+		max = math.Max(max, m.value)
+	}
+
+	switch op {
+	case OperationMin:
+		return min
+	case OperationMax:
+		return max
+	case OperationAvg:
+		return sum / float64(len(g.members))
+	default:
+		return sum
+	}
+}
+
+// outputLabels returns the labels of the output series aggregating the series
+// with the labels l.
+func (r *Rule) outputLabels(l labels.Labels) labels.Labels {
+	name := l.Get(labels.MetricName) + r.Suffix
+
+	var b *labels.Builder
+	if len(r.By) > 0 || len(r.Without) == 0 {
+		b = labels.NewBuilder(l).Keep(r.By...)
+	} else {
+		b = labels.NewBuilder(l).Del(r.Without...)
+	}
+	return b.Set(labels.MetricName, name).Labels()
+}
+
+// isCounter returns true if the series of the metric name are counters.
+func (r *Rule) isCounter(name string) bool {
+	switch r.Type {
+	case TypeCounter:
+		return true
+	case TypeGauge:
+		return false
+	}
+	for _, suffix := range counterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHistogramCounter returns true if the native histogram h is a counter.
+func (r *Rule) isHistogramCounter(h *histogram.FloatHistogram) bool {
+	switch r.Type {
+	case TypeCounter:
+		return true
+	case TypeGauge:
+		return false
+	}
+	return h.CounterResetHint != histogram.GaugeType
+}
@@ -0,0 +1,456 @@
+package cardinality_limit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/component/prometheus/aggregate"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	http_service "github.com/grafana/agent/service/http"
+	"github.com/grafana/agent/service/labelstore"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"go.uber.org/atomic"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.cardinality_limit",
+		Args:          Arguments{},
+		Exports:       Exports{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Actions applied to the series over the budget of a limit.
+const (
+	ActionDrop      = "drop"
+	ActionAggregate = "aggregate"
+)
+
+// expireInterval is how often series without recent samples are forgotten.
+const expireInterval = time.Minute
+
+// Arguments holds values which are used to configure the
+// prometheus.cardinality_limit component.
+type Arguments struct {
+	// Where the metrics within the limits should be forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	// How long series are tracked after their last sample.
+	SeriesTTL time.Duration `river:"series_ttl,attr,optional"`
+
+	// Number of groups with the most series reported for each limit.
+	TopN int `river:"top_n,attr,optional"`
+
+	// How often the series aggregated by limits are forwarded.
+	AggregationInterval time.Duration `river:"aggregation_interval,attr,optional"`
+
+	Limits []Limit `river:"limit,block,optional"`
+}
+
+// DefaultArguments holds the default settings of
+// prometheus.cardinality_limit. The default series TTL matches how long the
+// label store keeps stale series.
+var DefaultArguments = Arguments{
+	SeriesTTL:           10 * time.Minute,
+	TopN:                10,
+	AggregationInterval: time.Minute,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.SeriesTTL <= 0 {
+		return fmt.Errorf("series_ttl must be greater than 0")
+	}
+	if args.TopN < 0 {
+		return fmt.Errorf("top_n must not be negative")
+	}
+	if args.AggregationInterval <= 0 {
+		return fmt.Errorf("aggregation_interval must be greater than 0")
+	}
+
+	seen := make(map[string]struct{}, len(args.Limits))
+	for i, l := range args.Limits {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("invalid limit %d: %w", i+1, err)
+		}
+		name := limitName(l.By)
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate limit by %q", name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+// Limit is a budget of active series for each group of series with the same
+// values of the labels of By.
+type Limit struct {
+	By        []string `river:"by,attr"`
+	MaxSeries int      `river:"max_series,attr,optional"`
+	Action    string   `river:"action,attr,optional"`
+}
+
+// DefaultLimit holds the default settings of a limit.
+var DefaultLimit = Limit{
+	Action: ActionDrop,
+}
+
+// SetToDefault implements river.Defaulter.
+func (l *Limit) SetToDefault() {
+	*l = DefaultLimit
+}
+
+func (l *Limit) validate() error {
+	if len(l.By) == 0 {
+		return fmt.Errorf("by must not be empty")
+	}
+	if l.MaxSeries < 0 {
+		return fmt.Errorf("max_series must not be negative")
+	}
+	switch l.Action {
+	case ActionDrop, ActionAggregate:
+	default:
+		return fmt.Errorf("unsupported action %q", l.Action)
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the prometheus.cardinality_limit
+// component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.cardinality_limit component.
+type Component struct {
+	opts     component.Options
+	ls       labelstore.LabelStore
+	tracker  *tracker
+	receiver *prometheus.Interceptor
+	fanout   *prometheus.Fanout
+	exited   atomic.Bool
+
+	samplesRejected   *prometheus_client.CounterVec
+	aggregatorDropped *prometheus_client.CounterVec
+
+	onUpdate chan struct{}
+
+	mut     sync.RWMutex
+	args    Arguments
+	limits  []*limitState
+	retired []*aggregate.Aggregator // Aggregators of previous limits to flush.
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+	_ http_service.Component   = (*Component)(nil)
+)
+
+// New creates a new prometheus.cardinality_limit component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:     o,
+		ls:       data.(labelstore.LabelStore),
+		tracker:  newTracker(),
+		onUpdate: make(chan struct{}, 1),
+	}
+
+	c.samplesRejected = prometheus_client.NewCounterVec(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_cardinality_limit_samples_rejected_total",
+		Help: "Total number of samples of series over the budget of a limit.",
+	}, []string{"limit", "action"})
+	c.aggregatorDropped = prometheus_client.NewCounterVec(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_cardinality_limit_aggregation_samples_dropped_total",
+		Help: "Total number of samples of series over a budget which couldn't be aggregated.",
+	}, []string{"reason"})
+	series := prometheus_client.NewGaugeFunc(prometheus_client.GaugeOpts{
+		Name: "agent_prometheus_cardinality_limit_series",
+		Help: "Number of series tracked by the component.",
+	}, func() float64 { return float64(c.tracker.NumSeries()) })
+
+	for _, metric := range []prometheus_client.Collector{c.samplesRejected, c.aggregatorDropped, series, &topCollector{c: c}} {
+		if err := o.Registerer.Register(metric); err != nil {
+			return nil, err
+		}
+	}
+
+	c.fanout = prometheus.NewFanout(args.ForwardTo, o.ID, o.Registerer, c.ls)
+	c.receiver = prometheus.NewInterceptor(
+		c.fanout,
+		c.ls,
+		prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, t int64, v float64, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+
+			now := time.Now()
+			switch d, limit := c.observe(l, value.IsStaleNaN(v), now); d {
+			case decisionDrop:
+				c.samplesRejected.WithLabelValues(limit.name, limit.Action).Inc()
+				return ref, nil
+			case decisionAggregate:
+				c.samplesRejected.WithLabelValues(limit.name, limit.Action).Inc()
+				limit.aggregator.AppendFloat(l, v, now)
+				return ref, nil
+			}
+			return next.Append(ref, l, t, v)
+		}),
+		prometheus.WithHistogramHook(func(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+
+			now := time.Now()
+			switch d, limit := c.observe(l, false, now); d {
+			case decisionDrop:
+				c.samplesRejected.WithLabelValues(limit.name, limit.Action).Inc()
+				return ref, nil
+			case decisionAggregate:
+				c.samplesRejected.WithLabelValues(limit.name, limit.Action).Inc()
+				limit.aggregator.AppendHistogram(l, h, fh, now)
+				return ref, nil
+			}
+			return next.AppendHistogram(ref, l, t, h, fh)
+		}),
+		prometheus.WithExemplarHook(func(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			if !c.tracker.Admitted(c.ls.GetOrAddGlobalRefID(l)) {
+				return ref, nil
+			}
+			return next.AppendExemplar(ref, l, e)
+		}),
+		prometheus.WithMetadataHook(func(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata, next storage.Appender) (storage.SeriesRef, error) {
+			if c.exited.Load() {
+				return 0, fmt.Errorf("%s has exited", o.ID)
+			}
+			if !c.tracker.Admitted(c.ls.GetOrAddGlobalRefID(l)) {
+				return ref, nil
+			}
+			return next.UpdateMetadata(ref, l, m)
+		}),
+	)
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: c.receiver})
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// observe returns what happens to a sample of the series with labels l.
+func (c *Component) observe(l labels.Labels, stale bool, now time.Time) (decision, *limitState) {
+	return c.tracker.Observe(c.ls.GetOrAddGlobalRefID(l), l, stale, now)
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer c.exited.Store(true)
+
+	expireTicker := time.NewTicker(expireInterval)
+	defer expireTicker.Stop()
+
+	c.mut.RLock()
+	flushTicker := time.NewTicker(c.args.AggregationInterval)
+	c.mut.RUnlock()
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.onUpdate:
+			c.mut.RLock()
+			flushTicker.Reset(c.args.AggregationInterval)
+			c.mut.RUnlock()
+		case now := <-expireTicker.C:
+			c.mut.RLock()
+			ttl := c.args.SeriesTTL
+			c.mut.RUnlock()
+			c.tracker.Expire(now.Add(-ttl))
+		case now := <-flushTicker.C:
+			c.flush(ctx, now)
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	// Series are only checked again against the limits when they change.
+	if !equalLimits(c.args.Limits, newArgs.Limits) {
+		for _, limit := range c.limits {
+			if limit.aggregator != nil {
+				limit.aggregator.SetRules(nil)
+				c.retired = append(c.retired, limit.aggregator)
+			}
+		}
+
+		limits := make([]*limitState, 0, len(newArgs.Limits))
+		for _, l := range newArgs.Limits {
+			state, err := c.newLimitState(l)
+			if err != nil {
+				c.mut.Unlock()
+				return err
+			}
+			limits = append(limits, state)
+		}
+		c.limits = limits
+		c.tracker.SetLimits(limits)
+	}
+	c.args = newArgs
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+	c.mut.Unlock()
+
+	select {
+	case c.onUpdate <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// newLimitState creates the state of a limit. Series over the budget of a
+// limit with the aggregate action are summed by the labels of the limit, and
+// by the le and quantile labels so that the buckets of classic histograms and
+// the quantiles of summaries are kept apart.
+func (c *Component) newLimitState(l Limit) (*limitState, error) {
+	state := &limitState{
+		Limit:  l,
+		name:   limitName(l.By),
+		groups: make(map[string]*groupState),
+	}
+	if l.Action != ActionAggregate {
+		return state, nil
+	}
+
+	var matchAll flow_relabel.Regexp
+	if err := matchAll.UnmarshalText([]byte(".*")); err != nil {
+		return nil, err
+	}
+	state.aggregator = aggregate.NewAggregator(c.ls, c.aggregatorDropped)
+	state.aggregator.SetRules([]aggregate.Rule{{
+		Match:     matchAll,
+		Operation: aggregate.OperationSum,
+		By:        append([]string{labels.BucketLabel, quantileLabel}, l.By...),
+		Type:      aggregate.TypeAuto,
+	}})
+	return state, nil
+}
+
+// flush forwards the series aggregated by limits.
+func (c *Component) flush(ctx context.Context, now time.Time) {
+	c.mut.Lock()
+	aggregators := c.retired
+	c.retired = nil
+	for _, limit := range c.limits {
+		if limit.aggregator != nil {
+			aggregators = append(aggregators, limit.aggregator)
+		}
+	}
+	c.mut.Unlock()
+
+	var samples []aggregate.Sample
+	for _, a := range aggregators {
+		samples = append(samples, a.Flush(now)...)
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	app := c.fanout.Appender(ctx)
+	failed, err := aggregate.AppendSamples(app, samples)
+	if commitErr := app.Commit(); commitErr != nil {
+		failed, err = len(samples), commitErr
+	}
+	if failed > 0 {
+		level.Warn(c.opts.Logger).Log("msg", "failed to forward aggregated samples", "failed", failed, "err", err)
+	}
+}
+
+func equalLimits(a, b []Limit) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if limitName(a[i].By) != limitName(b[i].By) || a[i].MaxSeries != b[i].MaxSeries || a[i].Action != b[i].Action {
+			return false
+		}
+	}
+	return true
+}
+
+// topN returns the number of groups reported for each limit.
+func (c *Component) topN() int {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.args.TopN
+}
+
+// topCollector reports the series of the groups with the most series of each
+// limit. Only the top groups are reported so the metrics of the component
+// don't have the cardinality they're limiting.
+type topCollector struct {
+	c *Component
+}
+
+var (
+	groupSeriesDesc = prometheus_client.NewDesc(
+		"agent_prometheus_cardinality_limit_group_series",
+		"Number of series within the budget of the groups of a limit with the most series.",
+		[]string{"limit", "group"}, nil,
+	)
+	groupRejectedSeriesDesc = prometheus_client.NewDesc(
+		"agent_prometheus_cardinality_limit_group_rejected_series",
+		"Number of series over the budget of the groups of a limit with the most series.",
+		[]string{"limit", "group"}, nil,
+	)
+)
+
+// Describe implements prometheus.Collector.
+func (tc *topCollector) Describe(ch chan<- *prometheus_client.Desc) {
+	ch <- groupSeriesDesc
+	ch <- groupRejectedSeriesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (tc *topCollector) Collect(ch chan<- prometheus_client.Metric) {
+	for _, limit := range tc.c.tracker.Top(tc.c.topN()) {
+		name := limitName(limit.By)
+		for _, g := range limit.Top {
+			ch <- prometheus_client.MustNewConstMetric(groupSeriesDesc, prometheus_client.GaugeValue, float64(g.ActiveSeries), name, g.Labels)
+			ch <- prometheus_client.MustNewConstMetric(groupRejectedSeriesDesc, prometheus_client.GaugeValue, float64(g.RejectedSeries), name, g.Labels)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package cardinality_limit
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCardinalityLimit_Drop(t *testing.T) {
+	c, received := newTestComponent(t, `
+		forward_to = []
+		limit {
+			by         = ["team"]
+			max_series = 2
+		}
+	`)
+
+	appendSamples(t, c,
+		labels.FromStrings("__name__", "requests_total", "team", "a", "user", "1"),
+		labels.FromStrings("__name__", "requests_total", "team", "a", "user", "2"),
+		labels.FromStrings("__name__", "requests_total", "team", "a", "user", "3"),
+		labels.FromStrings("__name__", "requests_total", "team", "b", "user", "1"),
+	)
+	require.Equal(t, []string{
+		`{__name__="requests_total", team="a", user="1"}`,
+		`{__name__="requests_total", team="a", user="2"}`,
+		`{__name__="requests_total", team="b", user="1"}`,
+	}, received.Series())
+
+	// Series within the budget keep being forwarded.
+	appendSamples(t, c, labels.FromStrings("__name__", "requests_total", "team", "a", "user", "1"))
+	require.Equal(t, 2, received.Count(`{__name__="requests_total", team="a", user="1"}`))
+
+	info := c.DebugInfo().(DebugInfo)
+	require.Equal(t, 4, info.Series)
+	require.Equal(t, []DebugGroup{
+		{Labels: `{team="a"}`, ActiveSeries: 2, RejectedSeries: 1},
+		{Labels: `{team="b"}`, ActiveSeries: 1},
+	}, info.Limits[0].Top)
+
+	// Stale series free their budget.
+	stale := math.Float64frombits(value.StaleNaN)
+	app := c.receiver.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings("__name__", "requests_total", "team", "a", "user", "1"), 0, stale)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	appendSamples(t, c, labels.FromStrings("__name__", "requests_total", "team", "a", "user", "4"))
+	require.Equal(t, 1, received.Count(`{__name__="requests_total", team="a", user="4"}`))
+}
+
+func TestCardinalityLimit_Aggregate(t *testing.T) {
+	c, received := newTestComponent(t, `
+		forward_to = []
+		limit {
+			by         = ["__name__"]
+			max_series = 1
+			action     = "aggregate"
+		}
+	`)
+
+	appendSamples(t, c,
+		labels.FromStrings("__name__", "requests_total", "user", "1"),
+		labels.FromStrings("__name__", "requests_total", "user", "2"),
+		labels.FromStrings("__name__", "requests_total", "user", "3"),
+	)
+	c.flush(context.Background(), time.Now())
+
+	// Series over the budget are summed by the labels of the limit.
+	require.Equal(t, []string{
+		`{__name__="requests_total", user="1"}`,
+		`{__name__="requests_total"}`,
+	}, received.Series())
+	require.Equal(t, float64(2), received.Value(`{__name__="requests_total"}`))
+}
+
+// histogramSeries returns the series of a classic histogram of a pod.
+func histogramSeries(pod string) []labels.Labels {
+	return []labels.Labels{
+		labels.FromStrings("__name__", "lat_bucket", "le", "0.5", "pod", pod),
+		labels.FromStrings("__name__", "lat_bucket", "le", "1", "pod", pod),
+		labels.FromStrings("__name__", "lat_bucket", "le", "+Inf", "pod", pod),
+		labels.FromStrings("__name__", "lat_sum", "pod", pod),
+		labels.FromStrings("__name__", "lat_count", "pod", pod),
+	}
+}
+
+func TestCardinalityLimit_ClassicHistogram(t *testing.T) {
+	within := []string{
+		`{__name__="lat_bucket", le="0.5", pod="1"}`,
+		`{__name__="lat_bucket", le="1", pod="1"}`,
+		`{__name__="lat_bucket", le="+Inf", pod="1"}`,
+		`{__name__="lat_sum", pod="1"}`,
+		`{__name__="lat_count", pod="1"}`,
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		c, received := newTestComponent(t, `
+			forward_to = []
+			limit {
+				by         = ["__name__"]
+				max_series = 1
+			}
+		`)
+
+		for _, pod := range []string{"1", "2", "3"} {
+			appendSamples(t, c, histogramSeries(pod)...)
+		}
+
+		// The series of a histogram are counted as a single series, and are
+		// forwarded or dropped together.
+		require.Equal(t, within, received.Series())
+		require.Equal(t, []DebugGroup{
+			{Labels: `{__name__="lat"}`, ActiveSeries: 1, RejectedSeries: 2},
+		}, c.DebugInfo().(DebugInfo).Limits[0].Top)
+	})
+
+	t.Run("aggregate", func(t *testing.T) {
+		c, received := newTestComponent(t, `
+			forward_to = []
+			limit {
+				by         = ["__name__"]
+				max_series = 1
+				action     = "aggregate"
+			}
+		`)
+
+		for _, pod := range []string{"1", "2", "3"} {
+			appendSamples(t, c, histogramSeries(pod)...)
+		}
+		c.flush(context.Background(), time.Now())
+
+		// Histograms over the budget are summed bucket by bucket.
+		aggregated := []string{
+			`{__name__="lat_bucket", le="0.5"}`,
+			`{__name__="lat_bucket", le="1"}`,
+			`{__name__="lat_bucket", le="+Inf"}`,
+			`{__name__="lat_sum"}`,
+			`{__name__="lat_count"}`,
+		}
+		require.ElementsMatch(t, append(within, aggregated...), received.Series())
+		for _, series := range aggregated {
+			require.Equal(t, float64(2), received.Value(series), series)
+		}
+	})
+}
+
+func TestCardinalityLimit_Handler(t *testing.T) {
+	c, _ := newTestComponent(t, `
+		forward_to = []
+		top_n      = 1
+		limit {
+			by = ["__name__"]
+		}
+	`)
+
+	appendSamples(t, c,
+		labels.FromStrings("__name__", "a", "user", "1"),
+		labels.FromStrings("__name__", "b", "user", "1"),
+		labels.FromStrings("__name__", "b", "user", "2"),
+	)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var info DebugInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	require.Equal(t, []DebugGroup{{Labels: `{__name__="b"}`, ActiveSeries: 2}}, info.Limits[0].Top)
+
+	rec = httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/top?n=5", nil))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	require.Len(t, info.Limits[0].Top, 2)
+}
+
+func TestTracker_Expire(t *testing.T) {
+	tr := newTracker()
+	tr.SetLimits([]*limitState{{
+		Limit:  Limit{By: []string{"__name__"}, MaxSeries: 1, Action: ActionDrop},
+		groups: make(map[string]*groupState),
+	}})
+
+	now := time.Now()
+	d, _ := tr.Observe(1, labels.FromStrings("__name__", "up", "instance", "a"), false, now)
+	require.Equal(t, decisionForward, d)
+	d, _ = tr.Observe(2, labels.FromStrings("__name__", "up", "instance", "b"), false, now.Add(time.Minute))
+	require.Equal(t, decisionDrop, d)
+
+	tr.Expire(now.Add(time.Second))
+	require.Equal(t, 1, tr.NumSeries())
+	require.True(t, tr.Admitted(3))
+	require.False(t, tr.Admitted(2))
+}
+
+func TestArguments_Validate(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		forward_to = []
+		limit {
+			by     = ["team"]
+			action = "block"
+		}
+	`), &args)
+	require.ErrorContains(t, err, `invalid limit 1: unsupported action "block"`)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		limit {
+			by = ["team"]
+		}
+		limit {
+			by = ["team"]
+		}
+	`), &args)
+	require.ErrorContains(t, err, `duplicate limit by "team"`)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		limit {
+			by = ["team"]
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Minute, args.SeriesTTL)
+	require.Equal(t, 10, args.TopN)
+	require.Equal(t, ActionDrop, args.Limits[0].Action)
+}
+
+func newTestComponent(t *testing.T, config string) (*Component, *sampleRecorder) {
+	t.Helper()
+
+	var (
+		ls       = labelstore.New(nil)
+		received = newSampleRecorder(ls)
+		args     Arguments
+	)
+	require.NoError(t, river.Unmarshal([]byte(config), &args))
+	args.ForwardTo = []storage.Appendable{received.appendable}
+
+	c, err := New(component.Options{
+		ID:            "prometheus.cardinality_limit.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, args)
+	require.NoError(t, err)
+	return c, received
+}
+
+// appendSamples appends a sample with value 1 for each series.
+func appendSamples(t *testing.T, c *Component, series ...labels.Labels) {
+	t.Helper()
+
+	app := c.receiver.Appender(context.Background())
+	for _, l := range series {
+		_, err := app.Append(0, l, time.Now().UnixMilli(), 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+}
+
+// sampleRecorder records the samples appended to its appendable.
+type sampleRecorder struct {
+	appendable storage.Appendable
+
+	mut    sync.Mutex
+	series []string
+	counts map[string]int
+	values map[string]float64
+}
+
+func newSampleRecorder(ls labelstore.LabelStore) *sampleRecorder {
+	r := &sampleRecorder{counts: make(map[string]int), values: make(map[string]float64)}
+	r.appendable = prometheus.NewInterceptor(nil, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		r.mut.Lock()
+		defer r.mut.Unlock()
+
+		key := l.String()
+		if r.counts[key] == 0 {
+			r.series = append(r.series, key)
+		}
+		r.counts[key]++
+		r.values[key] = v
+		return ref, nil
+	}))
+	return r
+}
+
+// Series returns the series which received samples, in order.
+func (r *sampleRecorder) Series() []string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]string(nil), r.series...)
+}
+
+// Count returns the number of samples received by a series.
+func (r *sampleRecorder) Count(series string) int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.counts[series]
+}
+
+// Value returns the most recent value of a series.
+func (r *sampleRecorder) Value(series string) float64 {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.values[series]
+}
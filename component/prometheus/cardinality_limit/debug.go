@@ -0,0 +1,66 @@
+package cardinality_limit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DebugInfo holds the active series of the groups of each limit.
+type DebugInfo struct {
+	Series int          `river:"series,attr" json:"series"`
+	Limits []DebugLimit `river:"limit,block,optional" json:"limits"`
+}
+
+// DebugLimit holds the state of a limit and its groups with the most series.
+type DebugLimit struct {
+	By        []string     `river:"by,attr" json:"by"`
+	MaxSeries int          `river:"max_series,attr" json:"maxSeries"`
+	Action    string       `river:"action,attr" json:"action"`
+	Groups    int          `river:"groups,attr" json:"groups"`
+	Top       []DebugGroup `river:"top,block,optional" json:"top"`
+}
+
+// DebugGroup holds the series of a group of a limit.
+type DebugGroup struct {
+	Labels         string `river:"labels,attr" json:"labels"`
+	ActiveSeries   int    `river:"active_series,attr" json:"activeSeries"`
+	RejectedSeries int    `river:"rejected_series,attr" json:"rejectedSeries"`
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	return c.debugInfo(c.topN())
+}
+
+func (c *Component) debugInfo(n int) DebugInfo {
+	return DebugInfo{
+		Series: c.tracker.NumSeries(),
+		Limits: c.tracker.Top(n),
+	}
+}
+
+// Handler implements http_service.Component. It serves the groups with the
+// most series of each limit as JSON from /top. The number of groups can be
+// changed with the n query parameter.
+func (c *Component) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Trim(r.URL.Path, "/") != "top" {
+			http.NotFound(w, r)
+			return
+		}
+
+		n := c.topN()
+		if param := r.URL.Query().Get("n"); param != "" {
+			var err error
+			if n, err = strconv.Atoi(param); err != nil || n < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.debugInfo(n))
+	})
+}
@@ -0,0 +1,286 @@
+package cardinality_limit
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component/prometheus/aggregate"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// decision is what happens to the samples of a series.
+type decision int
+
+const (
+	decisionForward   decision = iota // Forward the sample.
+	decisionDrop                      // Drop the sample.
+	decisionAggregate                 // Aggregate the sample.
+)
+
+// tracker counts the active series of the groups of each limit, and decides
+// whether new series are within the budgets of the limits.
+//
+// The series of a classic histogram or summary, such as its _bucket, _sum and
+// _count series, are counted as a single series: they're admitted or
+// rejected together so that histograms aren't split.
+type tracker struct {
+	mut      sync.Mutex
+	limits   []*limitState
+	series   map[uint64]*trackedSeries // Tracked series by global ref ID.
+	families map[string]*family        // Tracked families by their key.
+}
+
+// limitState holds the groups of a limit.
+type limitState struct {
+	Limit
+	name       string
+	groups     map[string]*groupState // Groups by the string of their labels.
+	aggregator *aggregate.Aggregator  // Set when the action is aggregate.
+}
+
+// groupState counts the series of a group of a limit.
+type groupState struct {
+	active   int // Series within the budget.
+	rejected int // Series over the budget.
+}
+
+// trackedSeries is a series seen by the tracker.
+type trackedSeries struct {
+	lastSeen time.Time
+	family   *family
+}
+
+// family is a set of series counted as a single series by the limits, such
+// as the series of a classic histogram.
+type family struct {
+	key    string
+	series int      // Number of tracked series of the family.
+	keys   []string // Group key for each limit counting the family.
+	over   int      // Index of the limit the family is over, or -1.
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		series:   make(map[uint64]*trackedSeries),
+		families: make(map[string]*family),
+	}
+}
+
+// SetLimits replaces the limits. Tracked series are forgotten, and are
+// checked against the new limits when they receive their next sample.
+func (t *tracker) SetLimits(limits []*limitState) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.limits = limits
+	t.series = make(map[uint64]*trackedSeries)
+	t.families = make(map[string]*family)
+}
+
+// Observe returns what happens to a sample of the series ref with labels l.
+// The returned limit is the limit the series is over, if any. Stale samples
+// stop tracking the series.
+func (t *tracker) Observe(ref uint64, l labels.Labels, stale bool, now time.Time) (decision, *limitState) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	s, ok := t.series[ref]
+	if !ok {
+		if stale || len(t.limits) == 0 {
+			return decisionForward, nil
+		}
+		s = &trackedSeries{family: t.familyOf(l)}
+		s.family.series++
+		t.series[ref] = s
+	}
+	s.lastSeen = now
+
+	d, limit := t.decision(s.family)
+	if stale {
+		t.remove(ref, s)
+	}
+	return d, limit
+}
+
+// Admitted returns true if the samples of the series ref are forwarded.
+func (t *tracker) Admitted(ref uint64) bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	s, ok := t.series[ref]
+	return !ok || s.family.over < 0
+}
+
+// familyOf returns the family of the series with labels l, admitting it if
+// it isn't tracked yet.
+func (t *tracker) familyOf(l labels.Labels) *family {
+	fl := familyLabels(l)
+	key := fl.String()
+	if f, ok := t.families[key]; ok {
+		return f
+	}
+
+	f := t.admit(fl)
+	f.key = key
+	t.families[key] = f
+	return f
+}
+
+// quantileLabel is the label of the quantiles of summaries.
+const quantileLabel = "quantile"
+
+// familyLabels returns the labels identifying the family of the series with
+// labels l. Series with a le or quantile label and series with a _bucket,
+// _sum or _count suffix belong to the family of the histogram or summary
+// named without the suffix and without these labels. Other series are their
+// own family.
+func familyLabels(l labels.Labels) labels.Labels {
+	name := l.Get(labels.MetricName)
+	base := name
+	switch {
+	case strings.HasSuffix(name, "_bucket") && l.Has(labels.BucketLabel):
+		base = strings.TrimSuffix(name, "_bucket")
+	case strings.HasSuffix(name, "_sum"):
+		base = strings.TrimSuffix(name, "_sum")
+	case strings.HasSuffix(name, "_count"):
+		base = strings.TrimSuffix(name, "_count")
+	}
+	if base == name && !l.Has(labels.BucketLabel) && !l.Has(quantileLabel) {
+		return l
+	}
+
+	b := labels.NewBuilder(l).Del(labels.BucketLabel, quantileLabel)
+	if base != "" {
+		b.Set(labels.MetricName, base)
+	}
+	return b.Labels()
+}
+
+// admit starts tracking the family with labels l. It's admitted if it's
+// within the budgets of all the limits.
+func (t *tracker) admit(l labels.Labels) *family {
+	keys := make([]string, len(t.limits))
+	for i, limit := range t.limits {
+		keys[i] = labels.NewBuilder(l).Keep(limit.By...).Labels().String()
+
+		g := limit.groups[keys[i]]
+		if g != nil && limit.MaxSeries > 0 && g.active >= limit.MaxSeries {
+			g.rejected++
+			return &family{keys: []string{keys[i]}, over: i}
+		}
+	}
+
+	for i, limit := range t.limits {
+		g, ok := limit.groups[keys[i]]
+		if !ok {
+			g = &groupState{}
+			limit.groups[keys[i]] = g
+		}
+		g.active++
+	}
+	return &family{keys: keys, over: -1}
+}
+
+func (t *tracker) decision(f *family) (decision, *limitState) {
+	if f.over < 0 {
+		return decisionForward, nil
+	}
+	limit := t.limits[f.over]
+	if limit.Action == ActionAggregate {
+		return decisionAggregate, limit
+	}
+	return decisionDrop, limit
+}
+
+// remove stops tracking the series ref. Its family stops being counted once
+// none of its series are tracked.
+func (t *tracker) remove(ref uint64, s *trackedSeries) {
+	delete(t.series, ref)
+
+	f := s.family
+	if f.series--; f.series > 0 {
+		return
+	}
+	delete(t.families, f.key)
+
+	if f.over >= 0 {
+		groups := t.limits[f.over].groups
+		g := groups[f.keys[0]]
+		g.rejected--
+		if g.active == 0 && g.rejected == 0 {
+			delete(groups, f.keys[0])
+		}
+		return
+	}
+
+	for i, limit := range t.limits {
+		g := limit.groups[f.keys[i]]
+		g.active--
+		if g.active == 0 && g.rejected == 0 {
+			delete(limit.groups, f.keys[i])
+		}
+	}
+}
+
+// Expire stops tracking the series which didn't receive samples since
+// before.
+func (t *tracker) Expire(before time.Time) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	for ref, s := range t.series {
+		if s.lastSeen.Before(before) {
+			t.remove(ref, s)
+		}
+	}
+}
+
+// NumSeries returns the number of tracked series.
+func (t *tracker) NumSeries() int {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return len(t.series)
+}
+
+// Top returns the state of the limits, with their n groups with the most
+// series.
+func (t *tracker) Top(n int) []DebugLimit {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	res := make([]DebugLimit, 0, len(t.limits))
+	for _, limit := range t.limits {
+		dl := DebugLimit{
+			By:        limit.By,
+			MaxSeries: limit.MaxSeries,
+			Action:    limit.Action,
+			Groups:    len(limit.groups),
+		}
+		for key, g := range limit.groups {
+			dl.Top = append(dl.Top, DebugGroup{
+				Labels:         key,
+				ActiveSeries:   g.active,
+				RejectedSeries: g.rejected,
+			})
+		}
+		sort.Slice(dl.Top, func(i, j int) bool {
+			a, b := dl.Top[i], dl.Top[j]
+			if a.ActiveSeries+a.RejectedSeries != b.ActiveSeries+b.RejectedSeries {
+				return a.ActiveSeries+a.RejectedSeries > b.ActiveSeries+b.RejectedSeries
+			}
+			return a.Labels < b.Labels
+		})
+		if len(dl.Top) > n {
+			dl.Top = dl.Top[:n]
+		}
+		res = append(res, dl)
+	}
+	return res
+}
+
+// limitName identifies a limit in metrics.
+func limitName(by []string) string {
+	return strings.Join(by, ",")
+}
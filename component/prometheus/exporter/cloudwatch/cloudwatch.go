@@ -7,6 +7,7 @@ import (
 	"github.com/grafana/agent/component/prometheus/exporter"
 	"github.com/grafana/agent/pkg/integrations"
 	"github.com/grafana/agent/pkg/integrations/cloudwatch_exporter"
+	"github.com/grafana/agent/service/cluster"
 )
 
 func init() {
@@ -14,7 +15,7 @@ func init() {
 		Name:          "prometheus.exporter.cloudwatch",
 		Args:          Arguments{},
 		Exports:       exporter.Exports{},
-		NeedsServices: exporter.RequiredServices(),
+		NeedsServices: exporter.RequiredServices(cluster.ServiceName),
 		Build:         exporter.New(createExporter, "cloudwatch"),
 	})
 }
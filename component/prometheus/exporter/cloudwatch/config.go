@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/grafana/agent/pkg/integrations/cloudwatch_exporter"
+	"github.com/grafana/agent/service/cluster"
 	"github.com/grafana/river"
 	yaceConf "github.com/nerdswords/yet-another-cloudwatch-exporter/pkg/config"
 	yaceModel "github.com/nerdswords/yet-another-cloudwatch-exporter/pkg/model"
@@ -26,17 +27,19 @@ var defaults = Arguments{
 		Enabled:        false,
 		ScrapeInterval: 5 * time.Minute,
 	},
+	Clustering: cluster.DefaultSingletonBlock,
 }
 
 // Arguments are the river based options to configure the embedded CloudWatch exporter.
 type Arguments struct {
-	STSRegion             string                `river:"sts_region,attr"`
-	FIPSDisabled          bool                  `river:"fips_disabled,attr,optional"`
-	Debug                 bool                  `river:"debug,attr,optional"`
-	DiscoveryExportedTags TagsPerNamespace      `river:"discovery_exported_tags,attr,optional"`
-	Discovery             []DiscoveryJob        `river:"discovery,block,optional"`
-	Static                []StaticJob           `river:"static,block,optional"`
-	DecoupledScrape       DecoupledScrapeConfig `river:"decoupled_scraping,block,optional"`
+	STSRegion             string                 `river:"sts_region,attr"`
+	FIPSDisabled          bool                   `river:"fips_disabled,attr,optional"`
+	Debug                 bool                   `river:"debug,attr,optional"`
+	DiscoveryExportedTags TagsPerNamespace       `river:"discovery_exported_tags,attr,optional"`
+	Discovery             []DiscoveryJob         `river:"discovery,block,optional"`
+	Static                []StaticJob            `river:"static,block,optional"`
+	DecoupledScrape       DecoupledScrapeConfig  `river:"decoupled_scraping,block,optional"`
+	Clustering            cluster.SingletonBlock `river:"clustering,block,optional"`
 }
 
 // DecoupledScrapeConfig is the configuration for decoupled scraping feature.
@@ -103,6 +106,11 @@ func (a *Arguments) SetToDefault() {
 	*a = defaults
 }
 
+// SingletonClustering implements exporter.SingletonArguments.
+func (a Arguments) SingletonClustering() cluster.SingletonBlock {
+	return a.Clustering
+}
+
 // ConvertToYACE converts the river config into YACE config model. Note that the conversion is
 // not direct, some values have been opinionated to simplify the config model the agent exposes
 // for this integration.
@@ -13,6 +13,7 @@ import (
 	"github.com/grafana/agent/component/discovery"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/pkg/integrations"
+	"github.com/grafana/agent/service/cluster"
 	http_service "github.com/grafana/agent/service/http"
 	"github.com/prometheus/common/model"
 )
@@ -20,6 +21,12 @@ import (
 // Creator is a function provided by an implementation to create a concrete exporter instance.
 type Creator func(component.Options, component.Arguments, string) (integrations.Integration, string, error)
 
+// SingletonArguments is implemented by the arguments of exporters which can
+// run on a single agent of a cluster.
+type SingletonArguments interface {
+	SingletonClustering() cluster.SingletonBlock
+}
+
 // Exports are simply a list of targets for a scraper to consume.
 type Exports struct {
 	Targets []discovery.Target `river:"targets,attr"`
@@ -38,8 +45,18 @@ type Component struct {
 
 	exporter       integrations.Integration
 	metricsHandler http.Handler
+	targets        []discovery.Target
+
+	// singleton is set when the exporter supports the singleton clustering
+	// mode.
+	singleton *cluster.Singleton
 }
 
+var (
+	_ component.HealthComponent = (*Component)(nil)
+	_ cluster.Component         = (*Component)(nil)
+)
+
 // New creates a new exporter component.
 func New(creator Creator, name string) func(component.Options, component.Arguments) (component.Component, error) {
 	return newExporter(creator, name, nil)
@@ -53,36 +70,76 @@ func NewWithTargetBuilder(creator Creator, name string, targetBuilderFunc func(d
 
 // Run implements component.Component.
 func (c *Component) Run(ctx context.Context) error {
+	var singletonChanges <-chan struct{}
+	if c.singleton != nil {
+		go c.singleton.Run(ctx)
+		singletonChanges = c.singleton.Changes()
+	}
+
 	var cancel context.CancelFunc
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-c.reload:
-			// cancel any previously running exporter
-			if cancel != nil {
-				cancel()
-			}
-			// create new context so we can cancel it if we get any future updates
-			// since it is derived from the main run context, it only needs to be
-			// canceled directly if we receive new updates
-			newCtx, cancelFunc := context.WithCancel(ctx)
-			cancel = cancelFunc
-
-			// finally create and run new exporter
+		case <-singletonChanges:
 			c.mut.Lock()
-			exporter := c.exporter
-			c.metricsHandler = c.getHttpHandler(exporter)
+			c.opts.OnStateChange(Exports{Targets: c.exportedTargets()})
 			c.mut.Unlock()
-			go func() {
-				if err := exporter.Run(newCtx); err != nil {
-					level.Error(c.opts.Logger).Log("msg", "error running exporter", "err", err)
-				}
-			}()
+		case <-c.reload:
+		}
+
+		// cancel any previously running exporter
+		if cancel != nil {
+			cancel()
+			cancel = nil
+		}
+		if !c.active() {
+			// Another agent of the cluster runs the exporter.
+			continue
 		}
+
+		// create new context so we can cancel it if we get any future updates
+		// since it is derived from the main run context, it only needs to be
+		// canceled directly if we receive new updates
+		newCtx, cancelFunc := context.WithCancel(ctx)
+		cancel = cancelFunc
+
+		// finally create and run new exporter
+		c.mut.Lock()
+		exporter := c.exporter
+		c.metricsHandler = c.getHttpHandler(exporter)
+		c.mut.Unlock()
+		go func() {
+			if err := exporter.Run(newCtx); err != nil {
+				level.Error(c.opts.Logger).Log("msg", "error running exporter", "err", err)
+			}
+		}()
+	}
+}
+
+// reloadExporter schedules a restart of the exporter.
+func (c *Component) reloadExporter() {
+	select {
+	case c.reload <- struct{}{}:
+	default:
 	}
 }
 
+// active returns true if the exporter runs on this agent.
+func (c *Component) active() bool {
+	return c.singleton == nil || c.singleton.Active()
+}
+
+// exportedTargets returns the targets to export. No targets are exported when
+// another agent of the cluster runs the exporter, so that it's only scraped
+// once. It must be called with c.mut held.
+func (c *Component) exportedTargets() []discovery.Target {
+	if !c.active() {
+		return []discovery.Target{}
+	}
+	return c.targets
+}
+
 // Update implements component.Component.
 func (c *Component) Update(args component.Arguments) error {
 	exporter, instanceKey, err := c.creator(c.opts, args, defaultInstance())
@@ -102,24 +159,49 @@ func (c *Component) Update(args component.Arguments) error {
 		targets = c.targetBuilderFunc(c.baseTarget, args)
 	}
 
+	c.targets = targets
+
+	if sa, ok := args.(SingletonArguments); ok && c.singleton != nil {
+		c.singleton.SetBlock(sa.SingletonClustering())
+	}
+
 	c.opts.OnStateChange(Exports{
-		Targets: targets,
+		Targets: c.exportedTargets(),
 	})
 	c.mut.Unlock()
-	select {
-	case c.reload <- struct{}{}:
-	default:
-	}
+	c.reloadExporter()
 	return err
 }
 
 // Handler serves metrics endpoint from the integration implementation.
 func (c *Component) Handler() http.Handler {
+	if !c.active() {
+		return nil
+	}
+
 	c.mut.Lock()
 	defer c.mut.Unlock()
 	return c.metricsHandler
 }
 
+// NotifyClusterChange implements cluster.Component.
+func (c *Component) NotifyClusterChange() {
+	if c.singleton != nil {
+		c.singleton.Notify()
+	}
+}
+
+// CurrentHealth implements component.HealthComponent. The exporter is on
+// standby when another agent of the cluster runs it.
+func (c *Component) CurrentHealth() component.Health {
+	if c.singleton != nil {
+		if health, ok := c.singleton.Health(); ok {
+			return health
+		}
+	}
+	return component.Health{Health: component.HealthTypeHealthy}
+}
+
 func newExporter(creator Creator, name string, targetBuilderFunc func(discovery.Target, component.Arguments) []discovery.Target) func(component.Options, component.Arguments) (component.Component, error) {
 	return func(opts component.Options, args component.Arguments) (component.Component, error) {
 		c := &Component{
@@ -137,6 +219,14 @@ func newExporter(creator Creator, name string, targetBuilderFunc func(discovery.
 		}
 		httpData := data.(http_service.Data)
 
+		if _, ok := args.(SingletonArguments); ok {
+			data, err := opts.GetServiceData(cluster.ServiceName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get information about cluster: %w", err)
+			}
+			c.singleton = cluster.NewSingleton(opts.ID, opts.Logger, data.(cluster.Cluster))
+		}
+
 		componentName := opts.ID[:strings.LastIndex(opts.ID, ".")]
 		if opts.ID == "prometheus.exporter.unix" {
 			componentName = opts.ID
@@ -5,6 +5,7 @@ import (
 	"github.com/grafana/agent/component/prometheus/exporter"
 	"github.com/grafana/agent/pkg/integrations"
 	"github.com/grafana/agent/pkg/integrations/github_exporter"
+	"github.com/grafana/agent/service/cluster"
 	"github.com/grafana/river/rivertypes"
 	config_util "github.com/prometheus/common/config"
 )
@@ -14,7 +15,7 @@ func init() {
 		Name:          "prometheus.exporter.github",
 		Args:          Arguments{},
 		Exports:       exporter.Exports{},
-		NeedsServices: exporter.RequiredServices(),
+		NeedsServices: exporter.RequiredServices(cluster.ServiceName),
 		Build:         exporter.New(createExporter, "github"),
 	})
 }
@@ -27,7 +28,8 @@ func createExporter(opts component.Options, args component.Arguments, defaultIns
 // DefaultArguments holds non-zero default options for Arguments when it is
 // unmarshaled from river.
 var DefaultArguments = Arguments{
-	APIURL: github_exporter.DefaultConfig.APIURL,
+	APIURL:     github_exporter.DefaultConfig.APIURL,
+	Clustering: cluster.DefaultSingletonBlock,
 }
 
 type Arguments struct {
@@ -37,6 +39,8 @@ type Arguments struct {
 	Users         []string          `river:"users,attr,optional"`
 	APIToken      rivertypes.Secret `river:"api_token,attr,optional"`
 	APITokenFile  string            `river:"api_token_file,attr,optional"`
+
+	Clustering cluster.SingletonBlock `river:"clustering,block,optional"`
 }
 
 // SetToDefault implements river.Defaulter.
@@ -44,6 +48,11 @@ func (a *Arguments) SetToDefault() {
 	*a = DefaultArguments
 }
 
+// SingletonClustering implements exporter.SingletonArguments.
+func (a Arguments) SingletonClustering() cluster.SingletonBlock {
+	return a.Clustering
+}
+
 func (a *Arguments) Convert() *github_exporter.Config {
 	return &github_exporter.Config{
 		APIURL:        a.APIURL,
@@ -0,0 +1,384 @@
+package histogram_convert
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// Suffixes of the series of classic histograms.
+const (
+	bucketSuffix = "_bucket"
+	sumSuffix    = "_sum"
+	countSuffix  = "_count"
+)
+
+// groupKey identifies the series of a classic histogram.
+type groupKey struct {
+	name string
+	hash uint64
+}
+
+// group buffers the samples of a classic histogram at a timestamp until they
+// are converted when the appender is committed.
+type group struct {
+	// Labels of the native histogram, which are the labels of the series of
+	// the classic histogram without their suffix and le label.
+	labels labels.Labels
+	t      int64
+
+	buckets  []classicBucket
+	count    float64
+	hasCount bool
+	sum      float64
+	stale    bool
+
+	// exemplars of the _bucket series, which are attached to the native
+	// histogram.
+	exemplars []exemplar.Exemplar
+
+	// passthrough replays the original calls for the series of the group when
+	// they can't be converted.
+	passthrough []func(next storage.Appender) error
+}
+
+// appender converts histograms before appending them to the next appender.
+//
+// Classic histograms are converted when the appender is committed, since
+// their series are appended separately, and all the series of a scrape are
+// appended before it's committed. Native histograms are converted
+// immediately.
+type appender struct {
+	c    *Component
+	args Arguments
+	next storage.Appender
+
+	groups map[groupKey][]*group
+	order  []*group
+
+	// nativeRefs holds the native histograms converted to classic ones, whose
+	// exemplars are attached to a bucket.
+	nativeRefs map[storage.SeriesRef]labels.Labels
+
+	buf []byte
+}
+
+var _ storage.Appender = (*appender)(nil)
+
+// Append implements storage.Appender.
+func (a *appender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	if a.c.exited.Load() {
+		return 0, fmt.Errorf("%s has exited", a.c.opts.ID)
+	}
+	if ref == 0 {
+		ref = storage.SeriesRef(a.c.ls.GetOrAddGlobalRefID(l))
+	}
+
+	g, suffix := a.groupFor(l, t, true)
+	if g == nil {
+		return a.next.Append(ref, l, t, v)
+	}
+
+	g.passthrough = append(g.passthrough, func(next storage.Appender) error {
+		_, err := next.Append(ref, l, t, v)
+		return err
+	})
+	if value.IsStaleNaN(v) {
+		g.stale = true
+		return ref, nil
+	}
+
+	switch suffix {
+	case bucketSuffix:
+		le, err := strconv.ParseFloat(l.Get(labels.BucketLabel), 64)
+		if err != nil {
+			le = math.NaN()
+		}
+		g.buckets = append(g.buckets, classicBucket{le: le, count: v})
+	case sumSuffix:
+		g.sum = v
+	case countSuffix:
+		g.count, g.hasCount = v, true
+	}
+	return ref, nil
+}
+
+// AppendExemplar implements storage.Appender.
+func (a *appender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if a.c.exited.Load() {
+		return 0, fmt.Errorf("%s has exited", a.c.opts.ID)
+	}
+	if ref == 0 {
+		ref = storage.SeriesRef(a.c.ls.GetOrAddGlobalRefID(l))
+	}
+
+	if nl, ok := a.nativeRefs[ref]; ok {
+		_, err := a.next.AppendExemplar(0, a.bucketLabels(nl, a.exemplarBucket(e.Value)), e)
+		return ref, err
+	}
+
+	g, suffix := a.groupFor(l, e.Ts, false)
+	if g == nil {
+		return a.next.AppendExemplar(ref, l, e)
+	}
+
+	g.passthrough = append(g.passthrough, func(next storage.Appender) error {
+		_, err := next.AppendExemplar(ref, l, e)
+		return err
+	})
+	if suffix == bucketSuffix {
+		g.exemplars = append(g.exemplars, e)
+	}
+	return ref, nil
+}
+
+// AppendHistogram implements storage.Appender.
+func (a *appender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	if a.c.exited.Load() {
+		return 0, fmt.Errorf("%s has exited", a.c.opts.ID)
+	}
+	if ref == 0 {
+		ref = storage.SeriesRef(a.c.ls.GetOrAddGlobalRefID(l))
+	}
+
+	if a.args.Direction != DirectionNativeToClassic || !a.args.Match.MatchString(l.Get(labels.MetricName)) {
+		return a.next.AppendHistogram(ref, l, t, h, fh)
+	}
+
+	if fh == nil {
+		fh = h.ToFloat()
+	}
+	if err := a.appendClassic(l, t, fh); err != nil {
+		return 0, err
+	}
+
+	if a.nativeRefs == nil {
+		a.nativeRefs = make(map[storage.SeriesRef]labels.Labels)
+	}
+	a.nativeRefs[ref] = l
+	a.c.metrics.converted.Inc()
+	return ref, nil
+}
+
+// UpdateMetadata implements storage.Appender.
+func (a *appender) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
+	if a.c.exited.Load() {
+		return 0, fmt.Errorf("%s has exited", a.c.opts.ID)
+	}
+	if ref == 0 {
+		ref = storage.SeriesRef(a.c.ls.GetOrAddGlobalRefID(l))
+	}
+
+	// The metadata of converted classic histograms is dropped, but kept for
+	// the series which aren't converted.
+	g, _ := a.groupFor(l, 0, false)
+	if g == nil {
+		return a.next.UpdateMetadata(ref, l, m)
+	}
+	g.passthrough = append(g.passthrough, func(next storage.Appender) error {
+		_, err := next.UpdateMetadata(ref, l, m)
+		return err
+	})
+	return ref, nil
+}
+
+// Commit implements storage.Appender.
+func (a *appender) Commit() error {
+	var multiErr error
+	for _, g := range a.order {
+		if err := a.appendNative(g); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	a.groups, a.order = nil, nil
+
+	if err := a.next.Commit(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+	return multiErr
+}
+
+// Rollback implements storage.Appender.
+func (a *appender) Rollback() error {
+	a.groups, a.order = nil, nil
+	return a.next.Rollback()
+}
+
+// groupFor returns the group buffering the series of a classic histogram with
+// labels l, and the suffix of the series. It returns a nil group if the
+// series isn't converted.
+//
+// A new group is created for samples when there is no group at timestamp t.
+// Exemplars and metadata are added to the most recent group of the series.
+func (a *appender) groupFor(l labels.Labels, t int64, sample bool) (*group, string) {
+	if a.args.Direction != DirectionClassicToNative {
+		return nil, ""
+	}
+
+	var (
+		name   = l.Get(labels.MetricName)
+		suffix string
+	)
+	switch {
+	case strings.HasSuffix(name, bucketSuffix) && l.Has(labels.BucketLabel):
+		suffix = bucketSuffix
+	case strings.HasSuffix(name, sumSuffix):
+		suffix = sumSuffix
+	case strings.HasSuffix(name, countSuffix):
+		suffix = countSuffix
+	default:
+		return nil, ""
+	}
+	name = strings.TrimSuffix(name, suffix)
+	if !a.args.Match.MatchString(name) {
+		return nil, ""
+	}
+
+	var hash uint64
+	hash, a.buf = l.HashWithoutLabels(a.buf, labels.MetricName, labels.BucketLabel)
+	key := groupKey{name: name, hash: hash}
+
+	groups := a.groups[key]
+	if !sample {
+		if len(groups) == 0 {
+			return nil, ""
+		}
+		return groups[len(groups)-1], suffix
+	}
+	for _, g := range groups {
+		if g.t == t {
+			return g, suffix
+		}
+	}
+
+	lb := labels.NewBuilder(l)
+	lb.Del(labels.BucketLabel)
+	lb.Set(labels.MetricName, name)
+	g := &group{labels: lb.Labels(), t: t}
+
+	if a.groups == nil {
+		a.groups = make(map[groupKey][]*group)
+	}
+	a.groups[key] = append(groups, g)
+	a.order = append(a.order, g)
+	return g, suffix
+}
+
+// appendNative appends the native histogram converted from the classic
+// histogram buffered in g. The series of g are appended unchanged when it
+// can't be converted.
+func (a *appender) appendNative(g *group) error {
+	if g.stale {
+		// Native histograms are marked stale by a sum set to the stale marker.
+		staleHistogram := &histogram.Histogram{Sum: math.Float64frombits(value.StaleNaN)}
+		_, err := a.next.AppendHistogram(0, g.labels, g.t, staleHistogram, nil)
+		return err
+	}
+
+	if len(g.buckets) == 0 {
+		// Series with the suffixes of classic histograms, but without buckets,
+		// like the ones of summaries.
+		return a.passthrough(g)
+	}
+
+	h, fh, err := toNative(g.buckets, g.count, g.hasCount, g.sum, int32(a.args.Schema), a.args.ZeroThreshold)
+	if err != nil {
+		level.Debug(a.c.opts.Logger).Log("msg", "failed to convert classic histogram", "series", g.labels, "err", err)
+		a.c.metrics.invalid.Inc()
+		return a.passthrough(g)
+	}
+
+	ref, err := a.next.AppendHistogram(0, g.labels, g.t, h, fh)
+	if err != nil {
+		return err
+	}
+	a.c.metrics.converted.Inc()
+
+	var multiErr error
+	for _, e := range g.exemplars {
+		if _, err := a.next.AppendExemplar(ref, g.labels, e); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
+// passthrough appends the series of g unchanged.
+func (a *appender) passthrough(g *group) error {
+	var multiErr error
+	for _, f := range g.passthrough {
+		if err := f(a.next); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
+// appendClassic appends the series of the classic histogram converted from
+// the native histogram fh with labels l.
+func (a *appender) appendClassic(l labels.Labels, t int64, fh *histogram.FloatHistogram) error {
+	var (
+		name   = l.Get(labels.MetricName)
+		stale  = value.IsStaleNaN(fh.Sum)
+		counts = toClassic(fh, a.args.Buckets)
+	)
+	sampleValue := func(v float64) float64 {
+		if stale {
+			return math.Float64frombits(value.StaleNaN)
+		}
+		return v
+	}
+
+	for i, le := range a.args.Buckets {
+		if _, err := a.next.Append(0, a.bucketLabels(l, formatBound(le)), t, sampleValue(counts[i])); err != nil {
+			return err
+		}
+	}
+	if _, err := a.next.Append(0, a.bucketLabels(l, "+Inf"), t, sampleValue(fh.Count)); err != nil {
+		return err
+	}
+
+	lb := labels.NewBuilder(l)
+	lb.Set(labels.MetricName, name+sumSuffix)
+	if _, err := a.next.Append(0, lb.Labels(), t, sampleValue(fh.Sum)); err != nil {
+		return err
+	}
+	lb.Set(labels.MetricName, name+countSuffix)
+	_, err := a.next.Append(0, lb.Labels(), t, sampleValue(fh.Count))
+	return err
+}
+
+// bucketLabels returns the labels of the bucket with upper bound le of the
+// classic histogram converted from the native histogram with labels l.
+func (a *appender) bucketLabels(l labels.Labels, le string) labels.Labels {
+	lb := labels.NewBuilder(l)
+	lb.Set(labels.MetricName, l.Get(labels.MetricName)+bucketSuffix)
+	lb.Set(labels.BucketLabel, le)
+	return lb.Labels()
+}
+
+// exemplarBucket returns the upper bound of the classic bucket containing an
+// exemplar with value v.
+func (a *appender) exemplarBucket(v float64) string {
+	if i := sort.SearchFloat64s(a.args.Buckets, v); i < len(a.args.Buckets) {
+		return formatBound(a.args.Buckets[i])
+	}
+	return "+Inf"
+}
+
+// formatBound formats the upper bound of a classic bucket like the Prometheus
+// client libraries.
+func formatBound(le float64) string {
+	return strconv.FormatFloat(le, 'g', -1, 64)
+}
@@ -0,0 +1,221 @@
+package histogram_convert
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/histogram"
+)
+
+// classicBucket is a bucket of a classic histogram, with the cumulative count
+// of observations less than or equal to its upper bound.
+type classicBucket struct {
+	le    float64
+	count float64
+}
+
+// toNative converts the buckets, count and sum of a classic histogram to a
+// native histogram with an exponential schema. The count of each classic
+// bucket is added to the native bucket containing its upper bound. An integer
+// histogram is returned if all the counts are integers, and a float histogram
+// otherwise.
+//
+// The count of the native histogram is the one of the +Inf bucket. Without a
+// +Inf bucket, it's count if hasCount is true, and the count of the highest
+// bucket otherwise.
+func toNative(buckets []classicBucket, count float64, hasCount bool, sum float64, schema int32, zeroThreshold float64) (*histogram.Histogram, *histogram.FloatHistogram, error) {
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+	var (
+		positive  = make(map[int32]float64)
+		negative  = make(map[int32]float64)
+		zeroCount float64
+
+		prev     float64
+		lastLe   = math.Inf(-1)
+		integers = true
+	)
+	for i, b := range buckets {
+		switch {
+		case math.IsNaN(b.le) || math.IsInf(b.le, -1):
+			return nil, nil, fmt.Errorf("invalid bucket upper bound %g", b.le)
+		case math.IsNaN(b.count) || b.count < prev:
+			return nil, nil, fmt.Errorf("bucket counts aren't increasing")
+		case i > 0 && b.le == buckets[i-1].le:
+			return nil, nil, fmt.Errorf("duplicate bucket with upper bound %g", b.le)
+		}
+		integers = integers && isInteger(b.count)
+
+		if math.IsInf(b.le, 1) {
+			// The +Inf bucket has the count of the histogram, even when the
+			// _count series is missing.
+			count, hasCount = b.count, true
+			break
+		}
+
+		delta := b.count - prev
+		prev, lastLe = b.count, b.le
+		if delta == 0 {
+			continue
+		}
+		switch {
+		case b.le > zeroThreshold:
+			positive[bucketIndex(b.le, schema)] += delta
+		case b.le >= -zeroThreshold:
+			zeroCount += delta
+		default:
+			negative[bucketIndex(-b.le, schema)] += delta
+		}
+	}
+
+	if !hasCount {
+		count = prev
+	}
+	if math.IsNaN(count) || count < prev {
+		return nil, nil, fmt.Errorf("count is lower than the count of the buckets")
+	}
+	integers = integers && isInteger(count)
+
+	// Observations above the highest finite bucket are counted in the bucket
+	// following it.
+	if overflow := count - prev; overflow > 0 {
+		base := 1.0
+		if lastLe > zeroThreshold {
+			base = lastLe
+		} else if zeroThreshold > 0 {
+			base = zeroThreshold
+		}
+		positive[bucketIndex(base, schema)+1] += overflow
+	}
+
+	positiveSpans, positiveCounts := spansAndCounts(positive)
+	negativeSpans, negativeCounts := spansAndCounts(negative)
+
+	fh := &histogram.FloatHistogram{
+		Schema:          schema,
+		ZeroThreshold:   zeroThreshold,
+		ZeroCount:       zeroCount,
+		Count:           count,
+		Sum:             sum,
+		PositiveSpans:   positiveSpans,
+		PositiveBuckets: positiveCounts,
+		NegativeSpans:   negativeSpans,
+		NegativeBuckets: negativeCounts,
+	}
+	if !integers {
+		return nil, fh, nil
+	}
+
+	return &histogram.Histogram{
+		Schema:          schema,
+		ZeroThreshold:   zeroThreshold,
+		ZeroCount:       uint64(zeroCount),
+		Count:           uint64(count),
+		Sum:             sum,
+		PositiveSpans:   positiveSpans,
+		PositiveBuckets: deltas(positiveCounts),
+		NegativeSpans:   negativeSpans,
+		NegativeBuckets: deltas(negativeCounts),
+	}, nil, nil
+}
+
+// toClassic returns the cumulative counts of the observations of fh less than
+// or equal to each of bounds, which must be sorted. The observations of a
+// native bucket are counted in the classic bucket containing its upper bound.
+func toClassic(fh *histogram.FloatHistogram, bounds []float64) []float64 {
+	counts := make([]float64, len(bounds))
+
+	it := fh.AllBucketIterator()
+	for it.Next() {
+		b := it.At()
+		if b.Count == 0 {
+			continue
+		}
+		if i := sort.SearchFloat64s(bounds, b.Upper); i < len(bounds) {
+			counts[i] += b.Count
+		}
+	}
+
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	return counts
+}
+
+// bucketIndex returns the index of the native bucket containing v, which
+// must be positive, with the given schema. The bucket with index idx contains
+// the values in (bucketBound(idx-1), bucketBound(idx)].
+func bucketIndex(v float64, schema int32) int32 {
+	idx := int32(math.Ceil(math.Log2(v) * math.Ldexp(1, int(schema))))
+
+	// Fix the rounding errors of the logarithm.
+	for bucketBound(idx-1, schema) >= v {
+		idx--
+	}
+	for bucketBound(idx, schema) < v {
+		idx++
+	}
+	return idx
+}
+
+// bucketBound returns the upper bound of the native bucket with index idx.
+func bucketBound(idx, schema int32) float64 {
+	if schema < 0 {
+		return math.Ldexp(1, int(idx)<<-schema)
+	}
+	return math.Exp2(float64(idx) / float64(int32(1)<<schema))
+}
+
+// spansAndCounts returns the spans and counts of the native buckets with the
+// counts in buckets, by increasing index.
+func spansAndCounts(buckets map[int32]float64) ([]histogram.Span, []float64) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	indexes := make([]int32, 0, len(buckets))
+	for idx := range buckets {
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var (
+		spans  []histogram.Span
+		counts = make([]float64, 0, len(indexes))
+	)
+	for i, idx := range indexes {
+		switch {
+		case i == 0:
+			spans = append(spans, histogram.Span{Offset: idx, Length: 1})
+		case idx == indexes[i-1]+1:
+			spans[len(spans)-1].Length++
+		default:
+			spans = append(spans, histogram.Span{Offset: idx - indexes[i-1] - 1, Length: 1})
+		}
+		counts = append(counts, buckets[idx])
+	}
+	return spans, counts
+}
+
+// deltas returns the delta encoding of the bucket counts of integer
+// histograms.
+func deltas(counts []float64) []int64 {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	res := make([]int64, len(counts))
+	var prev int64
+	for i, c := range counts {
+		res[i] = int64(c) - prev
+		prev = int64(c)
+	}
+	return res
+}
+
+// isInteger returns true if v is an integer which can be stored in a bucket
+// of an integer histogram.
+func isInteger(v float64) bool {
+	return v == math.Trunc(v) && v >= 0 && v < 1<<53
+}
@@ -0,0 +1,220 @@
+package histogram_convert
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	flow_relabel "github.com/grafana/agent/component/common/relabel"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/service/labelstore"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/storage"
+	"go.uber.org/atomic"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.histogram_convert",
+		Args:          Arguments{},
+		Exports:       Exports{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// Directions of the conversion.
+const (
+	DirectionClassicToNative = "classic_to_native"
+	DirectionNativeToClassic = "native_to_classic"
+)
+
+// Supported range of the schema of converted native histograms.
+const (
+	minSchema = -4
+	maxSchema = 8
+)
+
+// Arguments holds values which are used to configure the
+// prometheus.histogram_convert component.
+type Arguments struct {
+	// Where the converted metrics should be forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	// Whether classic histograms are converted to native ones, or the other
+	// way around.
+	Direction string `river:"direction,attr,optional"`
+
+	// Regular expression matching the names of the histograms to convert.
+	Match flow_relabel.Regexp `river:"match,attr,optional"`
+
+	// Schema and zero threshold of native histograms converted from classic
+	// ones.
+	Schema        int     `river:"schema,attr,optional"`
+	ZeroThreshold float64 `river:"zero_threshold,attr,optional"`
+
+	// Upper bounds of the buckets of classic histograms converted from native
+	// ones.
+	Buckets []float64 `river:"buckets,attr,optional"`
+}
+
+// DefaultArguments holds the default settings of
+// prometheus.histogram_convert. The default zero threshold matches the one of
+// native histograms exposed by the Prometheus client libraries.
+var DefaultArguments = Arguments{
+	Direction:     DirectionClassicToNative,
+	Match:         flow_relabel.DefaultRelabelConfig.Regex,
+	Schema:        3,
+	ZeroThreshold: math.Ldexp(1, -128),
+	Buckets:       prometheus_client.DefBuckets,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	switch args.Direction {
+	case DirectionClassicToNative, DirectionNativeToClassic:
+	default:
+		return fmt.Errorf("unsupported direction %q", args.Direction)
+	}
+	if args.Schema < minSchema || args.Schema > maxSchema {
+		return fmt.Errorf("schema must be between %d and %d", minSchema, maxSchema)
+	}
+	if args.ZeroThreshold < 0 {
+		return fmt.Errorf("zero_threshold can't be negative")
+	}
+	if len(args.Buckets) == 0 {
+		return fmt.Errorf("buckets can't be empty")
+	}
+	for i, b := range args.Buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("buckets must be finite numbers")
+		}
+		if i > 0 && b <= args.Buckets[i-1] {
+			return fmt.Errorf("buckets must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the prometheus.histogram_convert
+// component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.histogram_convert component.
+type Component struct {
+	opts   component.Options
+	ls     labelstore.LabelStore
+	fanout *prometheus.Fanout
+	exited atomic.Bool
+
+	metrics *metrics
+
+	mut  sync.RWMutex
+	args Arguments
+}
+
+var (
+	_ component.Component = (*Component)(nil)
+	_ storage.Appendable  = (*Component)(nil)
+)
+
+// New creates a new prometheus.histogram_convert component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ls := data.(labelstore.LabelStore)
+
+	m, err := newMetrics(o.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Component{
+		opts:    o,
+		ls:      ls,
+		fanout:  prometheus.NewFanout(args.ForwardTo, o.ID, o.Registerer, ls),
+		metrics: m,
+	}
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime. Classic histograms are converted once all the series of a
+	// scrape are appended, so the component is its own appendable instead of
+	// using the hooks of an Interceptor.
+	o.OnStateChange(Exports{Receiver: c})
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer c.exited.Store(true)
+
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.args = newArgs
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+	return nil
+}
+
+// Appender implements storage.Appendable.
+func (c *Component) Appender(ctx context.Context) storage.Appender {
+	c.mut.RLock()
+	args := c.args
+	c.mut.RUnlock()
+
+	return &appender{
+		c:    c,
+		args: args,
+		next: c.fanout.Appender(ctx),
+	}
+}
+
+// metrics are the debug metrics of the component.
+type metrics struct {
+	converted prometheus_client.Counter
+	invalid   prometheus_client.Counter
+}
+
+func newMetrics(reg prometheus_client.Registerer) (*metrics, error) {
+	m := &metrics{
+		converted: prometheus_client.NewCounter(prometheus_client.CounterOpts{
+			Name: "agent_prometheus_histogram_convert_converted_total",
+			Help: "Total number of histogram samples which were converted.",
+		}),
+		invalid: prometheus_client.NewCounter(prometheus_client.CounterOpts{
+			Name: "agent_prometheus_histogram_convert_invalid_total",
+			Help: "Total number of classic histogram samples which couldn't be converted and were forwarded unchanged.",
+		}),
+	}
+
+	for _, metric := range []prometheus_client.Collector{m.converted, m.invalid} {
+		if err := reg.Register(metric); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
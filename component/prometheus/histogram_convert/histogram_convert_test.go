@@ -0,0 +1,302 @@
+package histogram_convert
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToNative(t *testing.T) {
+	buckets := []classicBucket{
+		{le: math.Inf(1), count: 10},
+		{le: 1, count: 3},
+		{le: 0.5, count: 1},
+		{le: 4, count: 8},
+	}
+	h, fh, err := toNative(buckets, 10, true, 20, 0, 0)
+	require.NoError(t, err)
+	require.Nil(t, fh)
+
+	// With schema 0, the buckets are delimited by powers of two: 0.5 is the
+	// upper bound of the bucket with index -1, and 4 the one of index 2. The
+	// observations above 4 are in the following bucket.
+	require.Equal(t, &histogram.Histogram{
+		Schema:          0,
+		Count:           10,
+		Sum:             20,
+		PositiveSpans:   []histogram.Span{{Offset: -1, Length: 2}, {Offset: 1, Length: 2}},
+		PositiveBuckets: []int64{1, 1, 3, -3},
+	}, h)
+
+	// Histograms with float counts are converted to float histograms.
+	h, fh, err = toNative([]classicBucket{{le: 1, count: 0.5}, {le: math.Inf(1), count: 1.5}}, 0, false, 1, 3, 0.001)
+	require.NoError(t, err)
+	require.Nil(t, h)
+	require.Equal(t, 1.5, fh.Count)
+	require.Equal(t, []float64{0.5, 1}, fh.PositiveBuckets)
+	require.Equal(t, []histogram.Span{{Offset: 0, Length: 2}}, fh.PositiveSpans)
+
+	// Buckets below the zero threshold are added to the zero bucket.
+	h, _, err = toNative([]classicBucket{{le: 0, count: 2}, {le: 1, count: 5}}, 5, true, 5, 0, 0.001)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), h.ZeroCount)
+	require.Equal(t, []int64{3}, h.PositiveBuckets)
+
+	_, _, err = toNative([]classicBucket{{le: 1, count: 5}, {le: 2, count: 3}}, 5, true, 5, 0, 0)
+	require.ErrorContains(t, err, "bucket counts aren't increasing")
+
+	_, _, err = toNative([]classicBucket{{le: 1, count: 5}}, 3, true, 5, 0, 0)
+	require.ErrorContains(t, err, "count is lower than the count of the buckets")
+}
+
+func TestBucketIndex(t *testing.T) {
+	for schema := int32(minSchema); schema <= maxSchema; schema++ {
+		for _, v := range []float64{0.001, 0.1, 0.25, 1, 2.5, 10, 1000} {
+			idx := bucketIndex(v, schema)
+			require.Less(t, bucketBound(idx-1, schema), v, "schema %d, value %g", schema, v)
+			require.GreaterOrEqual(t, bucketBound(idx, schema), v, "schema %d, value %g", schema, v)
+		}
+	}
+}
+
+func TestToClassic(t *testing.T) {
+	h := &histogram.Histogram{
+		Schema:          0,
+		ZeroThreshold:   0.001,
+		ZeroCount:       1,
+		Count:           10,
+		Sum:             20,
+		PositiveSpans:   []histogram.Span{{Offset: -1, Length: 2}, {Offset: 1, Length: 2}},
+		PositiveBuckets: []int64{1, 1, 3, -3},
+	}
+	counts := toClassic(h.ToFloat(), []float64{0.1, 1, 5})
+	require.Equal(t, []float64{1, 4, 9}, counts)
+}
+
+func TestComponent_ClassicToNative(t *testing.T) {
+	c, received := newTestComponent(t, `
+		forward_to = []
+		match      = "http_request_duration_seconds"
+		schema     = 0
+	`)
+
+	app := c.Appender(context.Background())
+	appendClassic(t, app, "http_request_duration_seconds", 1000, map[string]float64{"1": 3, "4": 8, "+Inf": 10}, 10, 20)
+	_, err := app.AppendExemplar(0, labels.FromStrings("__name__", "http_request_duration_seconds_bucket", "job", "app", "le", "1"), exemplar.Exemplar{Value: 0.5, Ts: 1000, HasTs: true})
+	require.NoError(t, err)
+	// Histograms not matching are forwarded unchanged.
+	appendClassic(t, app, "rpc_duration_seconds", 1000, map[string]float64{"+Inf": 1}, 1, 1)
+	_, err = app.Append(0, labels.FromStrings("__name__", "up", "job", "app"), 1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	h := received.Histograms()[`{__name__="http_request_duration_seconds", job="app"}`]
+	require.NotNil(t, h)
+	require.Equal(t, uint64(10), h.Count)
+	require.Equal(t, float64(20), h.Sum)
+	require.Equal(t, []int64{3, 2, -3}, h.PositiveBuckets)
+	require.Len(t, received.Exemplars(), 1)
+
+	samples := received.Samples()
+	require.Len(t, samples, 4)
+	require.Equal(t, float64(1), samples[`{__name__="up", job="app"}`])
+	require.Equal(t, float64(1), samples[`{__name__="rpc_duration_seconds_bucket", job="app", le="+Inf"}`])
+
+	// Invalid histograms are forwarded unchanged.
+	app = c.Appender(context.Background())
+	appendClassic(t, app, "http_request_duration_seconds", 2000, map[string]float64{"1": 5, "+Inf": 4}, 4, 20)
+	require.NoError(t, app.Commit())
+	require.Equal(t, float64(5), received.Samples()[`{__name__="http_request_duration_seconds_bucket", job="app", le="1"}`])
+
+	// Staleness markers are forwarded as stale native histograms.
+	app = c.Appender(context.Background())
+	stale := math.Float64frombits(value.StaleNaN)
+	appendClassic(t, app, "http_request_duration_seconds", 3000, map[string]float64{"1": stale, "4": stale, "+Inf": stale}, stale, stale)
+	require.NoError(t, app.Commit())
+	h = received.Histograms()[`{__name__="http_request_duration_seconds", job="app"}`]
+	require.True(t, value.IsStaleNaN(h.Sum))
+}
+
+func TestComponent_NativeToClassic(t *testing.T) {
+	c, received := newTestComponent(t, `
+		forward_to = []
+		direction  = "native_to_classic"
+		buckets    = [0.1, 1, 5]
+	`)
+
+	l := labels.FromStrings("__name__", "http_request_duration_seconds", "job", "app")
+	app := c.Appender(context.Background())
+	_, err := app.AppendHistogram(0, l, 1000, &histogram.Histogram{
+		Schema:          0,
+		Count:           10,
+		Sum:             20,
+		PositiveSpans:   []histogram.Span{{Offset: -1, Length: 2}, {Offset: 1, Length: 2}},
+		PositiveBuckets: []int64{1, 1, 3, -3},
+	}, nil)
+	require.NoError(t, err)
+	_, err = app.AppendExemplar(0, l, exemplar.Exemplar{Value: 3, Ts: 1000, HasTs: true})
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	require.Empty(t, received.Histograms())
+	require.Equal(t, map[string]float64{
+		`{__name__="http_request_duration_seconds_bucket", job="app", le="0.1"}`:  0,
+		`{__name__="http_request_duration_seconds_bucket", job="app", le="1"}`:    3,
+		`{__name__="http_request_duration_seconds_bucket", job="app", le="5"}`:    8,
+		`{__name__="http_request_duration_seconds_bucket", job="app", le="+Inf"}`: 10,
+		`{__name__="http_request_duration_seconds_sum", job="app"}`:               20,
+		`{__name__="http_request_duration_seconds_count", job="app"}`:             10,
+	}, received.Samples())
+	require.Equal(t, []string{`{__name__="http_request_duration_seconds_bucket", job="app", le="5"}`}, received.Exemplars())
+}
+
+func TestArguments_Validate(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		forward_to = []
+		direction  = "both"
+	`), &args)
+	require.ErrorContains(t, err, `unsupported direction "both"`)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		schema     = 9
+	`), &args)
+	require.ErrorContains(t, err, "schema must be between -4 and 8")
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		buckets    = [1, 0.5]
+	`), &args)
+	require.ErrorContains(t, err, "buckets must be in increasing order")
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, DirectionClassicToNative, args.Direction)
+	require.Equal(t, 3, args.Schema)
+	require.True(t, args.Match.MatchString("any_metric"))
+}
+
+func newTestComponent(t *testing.T, config string) (*Component, *recorder) {
+	var (
+		ls       = labelstore.New(nil)
+		received = newRecorder(ls)
+	)
+
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(config), &args))
+	args.ForwardTo = []storage.Appendable{received.appendable}
+
+	c, err := New(component.Options{
+		ID:            "prometheus.histogram_convert.test",
+		Logger:        util.TestFlowLogger(t),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, args)
+	require.NoError(t, err)
+	return c, received
+}
+
+// appendClassic appends the series of a classic histogram of the job "app"
+// with the cumulative counts of buckets.
+func appendClassic(t *testing.T, app storage.Appender, name string, ts int64, buckets map[string]float64, count, sum float64) {
+	t.Helper()
+
+	for le, v := range buckets {
+		_, err := app.Append(0, labels.FromStrings("__name__", name+"_bucket", "job", "app", "le", le), ts, v)
+		require.NoError(t, err)
+	}
+	_, err := app.Append(0, labels.FromStrings("__name__", name+"_count", "job", "app"), ts, count)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings("__name__", name+"_sum", "job", "app"), ts, sum)
+	require.NoError(t, err)
+}
+
+// recorder records the most recent value of each series appended to its
+// appendable, and the series of exemplars.
+type recorder struct {
+	appendable storage.Appendable
+
+	mut        sync.Mutex
+	samples    map[string]float64
+	histograms map[string]*histogram.Histogram
+	exemplars  []string
+}
+
+func newRecorder(ls labelstore.LabelStore) *recorder {
+	r := &recorder{
+		samples:    make(map[string]float64),
+		histograms: make(map[string]*histogram.Histogram),
+	}
+	r.appendable = prometheus.NewInterceptor(nil, ls,
+		prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+			r.mut.Lock()
+			defer r.mut.Unlock()
+			r.samples[l.String()] = v
+			return ref, nil
+		}),
+		prometheus.WithHistogramHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, h *histogram.Histogram, fh *histogram.FloatHistogram, _ storage.Appender) (storage.SeriesRef, error) {
+			r.mut.Lock()
+			defer r.mut.Unlock()
+			r.histograms[l.String()] = h
+			return ref, nil
+		}),
+		prometheus.WithExemplarHook(func(ref storage.SeriesRef, l labels.Labels, _ exemplar.Exemplar, _ storage.Appender) (storage.SeriesRef, error) {
+			r.mut.Lock()
+			defer r.mut.Unlock()
+			r.exemplars = append(r.exemplars, l.String())
+			return ref, nil
+		}),
+	)
+	return r
+}
+
+// Samples returns a copy of the recorded float samples.
+func (r *recorder) Samples() map[string]float64 {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	res := make(map[string]float64, len(r.samples))
+	for k, v := range r.samples {
+		res[k] = v
+	}
+	return res
+}
+
+// Histograms returns a copy of the recorded integer native histograms.
+func (r *recorder) Histograms() map[string]*histogram.Histogram {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	res := make(map[string]*histogram.Histogram, len(r.histograms))
+	for k, v := range r.histograms {
+		res[k] = v
+	}
+	return res
+}
+
+// Exemplars returns the series of the recorded exemplars.
+func (r *recorder) Exemplars() []string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]string(nil), r.exemplars...)
+}
@@ -16,7 +16,6 @@ import (
 	"github.com/grafana/agent/service/cluster"
 	"github.com/grafana/agent/service/http"
 	"github.com/grafana/agent/service/labelstore"
-	"github.com/grafana/ckit/shard"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery"
@@ -135,13 +134,13 @@ func (c *crdManager) Run(ctx context.Context) error {
 		case m := <-c.discoveryManager.SyncCh():
 			cachedTargets = m
 			if c.args.Clustering.Enabled {
-				m = filterTargets(m, c.cluster)
+				m = filterTargets(m, c.cluster, c.args.Clustering)
 			}
 			targetSetsChan <- m
 		case <-c.clusteringUpdated:
 			// if clustering updates while running, just re-filter the targets and pass them
 			// into scrape manager again, instead of reloading everything
-			targetSetsChan <- filterTargets(cachedTargets, c.cluster)
+			targetSetsChan <- filterTargets(cachedTargets, c.cluster, c.args.Clustering)
 		}
 	}
 }
@@ -155,7 +154,7 @@ func (c *crdManager) ClusteringUpdated() {
 
 // TODO: merge this code with the code in prometheus.scrape. This is a copy of that code, mostly because
 // we operate on slightly different data structures.
-func filterTargets(m map[string][]*targetgroup.Group, c cluster.Cluster) map[string][]*targetgroup.Group {
+func filterTargets(m map[string][]*targetgroup.Group, c cluster.Cluster, clustering cluster.ComponentBlock) map[string][]*targetgroup.Group {
 	// the key in the map is the job name.
 	// the targetGroups have zero or more targets inside them.
 	// we should keep the same structure even when there are no targets in a group for this node to scrape,
@@ -173,15 +172,19 @@ func filterTargets(m map[string][]*targetgroup.Group, c cluster.Cluster) map[str
 			// We should not need to include the group's common labels, as long
 			// as each node does this consistently.
 			for _, t := range group.Targets {
-				peers, err := c.Lookup(shard.StringKey(nonMetaLabelString(t)), 1, shard.OpReadWrite)
+				peers, err := clustering.Owners(c, nonMetaLabelString(t))
 				if err != nil {
 					// This can only fail in case we ask for more owners than the
 					// available peers. This should never happen, but in any case we fall
 					// back to owning the target ourselves.
 					g2.Targets = append(g2.Targets, t)
+					continue
 				}
-				if peers[0].Self {
-					g2.Targets = append(g2.Targets, t)
+				for _, p := range peers {
+					if p.Self {
+						g2.Targets = append(g2.Targets, t)
+						break
+					}
 				}
 			}
 			m2[k][i] = g2
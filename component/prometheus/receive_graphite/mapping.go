@@ -0,0 +1,102 @@
+package receive_graphite
+
+import (
+	"fmt"
+
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"gopkg.in/yaml.v2"
+)
+
+// Match types and actions of mapping rules.
+const (
+	MatchTypeGlob  = "glob"
+	MatchTypeRegex = "regex"
+
+	ActionMap  = "map"
+	ActionDrop = "drop"
+)
+
+// MappingRule turns the dotted paths of Graphite metrics into metric names
+// and labels. MappingRule is intended to be exposed as a block called
+// "mapping".
+type MappingRule struct {
+	Match     string            `river:"match,attr"`
+	MatchType string            `river:"match_type,attr,optional"`
+	Name      string            `river:"name,attr,optional"`
+	Labels    map[string]string `river:"labels,attr,optional"`
+	Action    string            `river:"action,attr,optional"`
+}
+
+// DefaultMappingRule holds default values for MappingRule.
+var DefaultMappingRule = MappingRule{
+	MatchType: MatchTypeGlob,
+	Action:    ActionMap,
+}
+
+// SetToDefault implements river.Defaulter.
+func (r *MappingRule) SetToDefault() {
+	*r = DefaultMappingRule
+}
+
+// Validate implements river.Validator.
+func (r *MappingRule) Validate() error {
+	switch r.MatchType {
+	case MatchTypeGlob, MatchTypeRegex:
+	default:
+		return fmt.Errorf("unsupported match_type %q, must be %q or %q", r.MatchType, MatchTypeGlob, MatchTypeRegex)
+	}
+
+	switch r.Action {
+	case ActionMap:
+		if r.Name == "" {
+			return fmt.Errorf("name must be set for mapping rules with the %q action", ActionMap)
+		}
+	case ActionDrop:
+	default:
+		return fmt.Errorf("unsupported action %q, must be %q or %q", r.Action, ActionMap, ActionDrop)
+	}
+	return nil
+}
+
+// yamlMapping is a mapping rule in the configuration format of the mapper
+// of the StatsD exporter, which also implements the mapping rules of the
+// Graphite exporter.
+type yamlMapping struct {
+	Match     string            `yaml:"match"`
+	MatchType string            `yaml:"match_type"`
+	Name      string            `yaml:"name"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Action    string            `yaml:"action"`
+}
+
+// newMapper creates a mapper applying rules in order.
+func newMapper(rules []MappingRule) (*mapper.MetricMapper, error) {
+	cfg := struct {
+		Mappings []yamlMapping `yaml:"mappings"`
+	}{}
+	for _, r := range rules {
+		name := r.Name
+		if r.Action == ActionDrop && name == "" {
+			// The mapper requires names even for dropped metrics.
+			name = "dropped"
+		}
+		cfg.Mappings = append(cfg.Mappings, yamlMapping{
+			Match:     r.Match,
+			MatchType: r.MatchType,
+			Name:      name,
+			Labels:    r.Labels,
+			Action:    r.Action,
+		})
+	}
+
+	bb, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var m mapper.MetricMapper
+	if err := m.InitFromYAMLString(string(bb)); err != nil {
+		return nil, fmt.Errorf("invalid mapping rules: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,64 @@
+package receive_graphite
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteSample is a sample of the Graphite plaintext protocol.
+type graphiteSample struct {
+	path      string
+	tags      map[string]string
+	value     float64
+	timestamp int64 // In milliseconds.
+}
+
+// parseLine parses a line of the Graphite plaintext protocol:
+//
+//	path[;tag=value...] value [timestamp]
+//
+// Samples without a timestamp, or with a timestamp of -1, get the timestamp
+// now.
+func parseLine(line string, now time.Time) (graphiteSample, error) {
+	var s graphiteSample
+
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return s, fmt.Errorf("expected path, value and timestamp, got %d fields", len(fields))
+	}
+
+	parts := strings.Split(fields[0], ";")
+	s.path = parts[0]
+	if s.path == "" {
+		return s, fmt.Errorf("missing path")
+	}
+	if len(parts) > 1 {
+		s.tags = make(map[string]string, len(parts)-1)
+		for _, tag := range parts[1:] {
+			name, value, ok := strings.Cut(tag, "=")
+			if !ok || name == "" || value == "" {
+				return s, fmt.Errorf("invalid tag %q", tag)
+			}
+			s.tags[name] = value
+		}
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q", fields[1])
+	}
+	s.value = value
+
+	s.timestamp = now.UnixMilli()
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) {
+			return s, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+		s.timestamp = int64(ts * 1000)
+	}
+	return s, nil
+}
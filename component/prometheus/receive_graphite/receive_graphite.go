@@ -0,0 +1,429 @@
+package receive_graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	fnet "github.com/grafana/agent/component/common/net"
+	agentprom "github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/strutil"
+	"github.com/prometheus/statsd_exporter/pkg/mapper"
+	"golang.org/x/net/netutil"
+)
+
+const (
+	// maxBatchSize is the maximum number of samples appended before they're
+	// committed.
+	maxBatchSize = 1000
+	// maxPacketSize is the maximum size of UDP packets.
+	maxPacketSize = 65535
+	// maxLineSize is the maximum size of a Graphite line.
+	maxLineSize = 64 << 10
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.receive_graphite",
+		Args:          Arguments{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// DefaultListenPort is the default port to listen on for Graphite lines.
+const DefaultListenPort = 2003
+
+// Arguments holds values which are used to configure the
+// prometheus.receive_graphite component. The http block of the server
+// configures the TCP and UDP listener of Graphite lines.
+type Arguments struct {
+	Server      *fnet.ServerConfig   `river:",squash"`
+	StrictMatch bool                 `river:"strict_match,attr,optional"`
+	Mappings    []MappingRule        `river:"mapping,block,optional"`
+	ForwardTo   []storage.Appendable `river:"forward_to,attr"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	server := fnet.DefaultServerConfig()
+	server.HTTP.ListenPort = DefaultListenPort
+	// Graphite lines are only received by the listener configured by the http
+	// block.
+	server.GRPC = nil
+
+	*args = Arguments{Server: server}
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	switch {
+	case args.Server == nil || args.Server.HTTP == nil:
+		return fmt.Errorf("http block must be set")
+	case args.Server.GRPC != nil:
+		return fmt.Errorf("grpc block is not supported")
+	}
+	_, err := newMapper(args.Mappings)
+	return err
+}
+
+// Component implements the prometheus.receive_graphite component.
+type Component struct {
+	opts   component.Options
+	fanout *agentprom.Fanout
+
+	samplesTotal        prometheus.Counter
+	droppedSamplesTotal prometheus.Counter
+	invalidLinesTotal   prometheus.Counter
+
+	mut         sync.RWMutex
+	mapper      *mapper.MetricMapper
+	strictMatch bool
+
+	updateMut sync.Mutex
+	args      Arguments
+	listener  *listener
+}
+
+func New(opts component.Options, args Arguments) (*Component, error) {
+	service, err := opts.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ls := service.(labelstore.LabelStore)
+
+	c := &Component{
+		opts:   opts,
+		fanout: agentprom.NewFanout(args.ForwardTo, opts.ID, opts.Registerer, ls),
+		samplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_receive_graphite_samples_total",
+			Help: "Total number of samples received from Graphite lines.",
+		}),
+		droppedSamplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_receive_graphite_dropped_samples_total",
+			Help: "Total number of samples dropped by mapping rules.",
+		}),
+		invalidLinesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_receive_graphite_invalid_lines_total",
+			Help: "Total number of lines which failed to parse.",
+		}),
+	}
+	for _, m := range []prometheus.Collector{c.samplesTotal, c.droppedSamplesTotal, c.invalidLinesTotal} {
+		if err := opts.Registerer.Register(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run satisfies the Component interface.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		c.updateMut.Lock()
+		defer c.updateMut.Unlock()
+		if c.listener != nil {
+			c.listener.Stop()
+			c.listener = nil
+		}
+	}()
+
+	<-ctx.Done()
+	level.Info(c.opts.Logger).Log("msg", "terminating due to context done")
+	return nil
+}
+
+// Update satisfies the Component interface.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+
+	m, err := newMapper(newArgs.Mappings)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	c.mapper, c.strictMatch = m, newArgs.StrictMatch
+	c.mut.Unlock()
+
+	c.updateMut.Lock()
+	defer c.updateMut.Unlock()
+
+	if c.listener != nil && reflect.DeepEqual(c.args.Server, newArgs.Server) {
+		c.args = newArgs
+		return nil
+	}
+	if c.listener != nil {
+		c.listener.Stop()
+		c.listener = nil
+	}
+
+	l, err := startListener(c.opts.Logger, newArgs.Server, c.handle)
+	if err != nil {
+		return err
+	}
+	c.listener = l
+	c.args = newArgs
+	return nil
+}
+
+// handle appends the samples of the lines read from r, and commits them
+// when no more lines are buffered. Lines longer than maxLineSize stop the
+// handling of r.
+func (c *Component) handle(r *bufio.Reader) error {
+	var (
+		app   = c.fanout.Appender(context.Background())
+		batch = 0
+
+		// pending reports whether the scanner buffered data after the last
+		// line.
+		pending bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		pending = advance < len(data)
+		return advance, token, err
+	})
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			if err := c.appendLine(app, line, time.Now()); err != nil {
+				_ = app.Rollback()
+				return err
+			}
+			batch++
+		}
+
+		if batch > 0 && ((!pending && r.Buffered() == 0) || batch >= maxBatchSize) {
+			if err := app.Commit(); err != nil {
+				return err
+			}
+			app = c.fanout.Appender(context.Background())
+			batch = 0
+		}
+	}
+
+	// Lines read before an error are still committed.
+	if batch > 0 {
+		if err := app.Commit(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// appendLine appends the sample of a Graphite line. Invalid lines are
+// counted and skipped.
+func (c *Component) appendLine(app storage.Appender, line string, now time.Time) error {
+	s, err := parseLine(line, now)
+	if err != nil {
+		c.invalidLinesTotal.Inc()
+		level.Debug(c.opts.Logger).Log("msg", "failed to parse line", "line", line, "err", err)
+		return nil
+	}
+
+	c.mut.RLock()
+	m, strictMatch := c.mapper, c.strictMatch
+	c.mut.RUnlock()
+
+	lbls := make(map[string]string, len(s.tags)+1)
+	for name, value := range s.tags {
+		lbls[sanitizeName(name)] = value
+	}
+
+	name := s.path
+	mapping, mappingLabels, matched := m.GetMapping(s.path, mapper.MetricTypeGauge)
+	switch {
+	case matched && mapping.Action == mapper.ActionTypeDrop, !matched && strictMatch:
+		c.droppedSamplesTotal.Inc()
+		return nil
+	case matched:
+		name = mapping.Name
+		for k, v := range mappingLabels {
+			lbls[k] = v
+		}
+	}
+	lbls[model.MetricNameLabel] = sanitizeName(name)
+
+	if _, err := app.Append(0, labels.FromMap(lbls), s.timestamp, s.value); err != nil {
+		return err
+	}
+	c.samplesTotal.Inc()
+	return nil
+}
+
+// sanitizeName replaces the characters which aren't valid in label names,
+// such as the dots of Graphite paths.
+func sanitizeName(name string) string {
+	name = strutil.SanitizeLabelName(name)
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// listener receives Graphite lines over TCP and UDP on the same address.
+type listener struct {
+	log                     log.Logger
+	handle                  func(r *bufio.Reader) error
+	tcp                     net.Listener
+	udp                     net.PacketConn
+	idleTimeout             time.Duration
+	gracefulShutdownTimeout time.Duration
+	wg                      sync.WaitGroup
+
+	connsMut sync.Mutex
+	conns    map[net.Conn]struct{}
+}
+
+func startListener(l log.Logger, cfg *fnet.ServerConfig, handle func(r *bufio.Reader) error) (*listener, error) {
+	addr := net.JoinHostPort(cfg.HTTP.ListenAddress, strconv.Itoa(cfg.HTTP.ListenPort))
+
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on TCP address %s: %w", addr, err)
+	}
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("failed to listen on UDP address %s: %w", addr, err)
+	}
+	if cfg.HTTP.ConnLimit > 0 {
+		tcp = netutil.LimitListener(tcp, cfg.HTTP.ConnLimit)
+	}
+
+	lis := &listener{
+		log:                     l,
+		handle:                  handle,
+		tcp:                     tcp,
+		udp:                     udp,
+		idleTimeout:             cfg.HTTP.ServerIdleTimeout,
+		gracefulShutdownTimeout: cfg.GracefulShutdownTimeout,
+		conns:                   make(map[net.Conn]struct{}),
+	}
+	level.Info(l).Log("msg", "listening for Graphite lines", "address", addr)
+
+	lis.wg.Add(2)
+	go lis.acceptTCP()
+	go lis.readUDP()
+	return lis, nil
+}
+
+func (l *listener) acceptTCP() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				level.Error(l.log).Log("msg", "failed to accept TCP connection", "err", err)
+			}
+			return
+		}
+
+		l.connsMut.Lock()
+		l.conns[conn] = struct{}{}
+		l.connsMut.Unlock()
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			defer func() {
+				l.connsMut.Lock()
+				delete(l.conns, conn)
+				l.connsMut.Unlock()
+				conn.Close()
+			}()
+
+			r := bufio.NewReader(&idleTimeoutReader{conn: conn, timeout: l.idleTimeout})
+			if err := l.handle(r); err != nil && !errors.Is(err, net.ErrClosed) {
+				level.Warn(l.log).Log("msg", "failed to handle TCP connection", "remote", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+func (l *listener) readUDP() {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				level.Error(l.log).Log("msg", "failed to read UDP packet", "err", err)
+			}
+			return
+		}
+
+		r := bufio.NewReaderSize(strings.NewReader(string(buf[:n])), n+1)
+		if err := l.handle(r); err != nil {
+			level.Warn(l.log).Log("msg", "failed to handle UDP packet", "err", err)
+		}
+	}
+}
+
+// Stop closes the listeners and the open connections, and waits for up to
+// the graceful shutdown timeout for the lines already read to be handled.
+func (l *listener) Stop() {
+	l.tcp.Close()
+	l.udp.Close()
+
+	l.connsMut.Lock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.connsMut.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(l.gracefulShutdownTimeout):
+		level.Warn(l.log).Log("msg", "timed out waiting for Graphite lines to be handled", "timeout", l.gracefulShutdownTimeout)
+	}
+}
+
+// idleTimeoutReader reads from a connection, failing reads which wait for
+// more than timeout. A zero timeout disables it.
+type idleTimeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if r.timeout > 0 {
+		if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+			return 0, err
+		}
+	}
+	return r.conn.Read(p)
+}
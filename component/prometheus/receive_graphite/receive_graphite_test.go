@@ -0,0 +1,219 @@
+package receive_graphite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	fnet "github.com/grafana/agent/component/common/net"
+	agentprom "github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	"github.com/phayes/freeport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.UnixMilli(1700000000500)
+
+	s, err := parseLine("servers.a.cpu.load 1.5 1700000000", now)
+	require.NoError(t, err)
+	require.Equal(t, graphiteSample{path: "servers.a.cpu.load", value: 1.5, timestamp: 1700000000000}, s)
+
+	s, err = parseLine("disk.used;host=a;dc=eu 42 -1", now)
+	require.NoError(t, err)
+	require.Equal(t, graphiteSample{path: "disk.used", tags: map[string]string{"host": "a", "dc": "eu"}, value: 42, timestamp: now.UnixMilli()}, s)
+
+	_, err = parseLine("disk.used 42 1 2", now)
+	require.ErrorContains(t, err, "got 4 fields")
+	_, err = parseLine("disk.used;host 42", now)
+	require.ErrorContains(t, err, `invalid tag "host"`)
+	_, err = parseLine("disk.used abc", now)
+	require.ErrorContains(t, err, `invalid value "abc"`)
+}
+
+func TestArguments(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		forward_to = []
+
+		mapping {
+			match = "test.*.*"
+			name  = "test_total"
+		}
+		mapping {
+			match  = "debug.*"
+			action = "drop"
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, DefaultListenPort, args.Server.HTTP.ListenPort)
+	require.Nil(t, args.Server.GRPC)
+	require.Len(t, args.Mappings, 2)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+
+		grpc {
+			listen_port = 9095
+		}
+	`), &args)
+	require.ErrorContains(t, err, "grpc block is not supported")
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+
+		mapping {
+			match = "test.*"
+		}
+	`), &args)
+	require.ErrorContains(t, err, `name must be set for mapping rules with the "map" action`)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+
+		mapping {
+			match = "test.*"
+			name  = "test"
+			labels = { "1invalid" = "$1" }
+		}
+	`), &args)
+	require.ErrorContains(t, err, "invalid label key")
+}
+
+func TestForwardsSamples(t *testing.T) {
+	actualSamples := make(chan testSample, 100)
+
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	args := Arguments{
+		Server:      testServerConfig(port),
+		StrictMatch: true,
+		Mappings: []MappingRule{
+			{Match: "servers.*.cpu.*", MatchType: MatchTypeGlob, Name: "cpu_${2}", Labels: map[string]string{"server": "$1"}, Action: ActionMap},
+			{Match: `^app\.(\w+)\.requests$`, MatchType: MatchTypeRegex, Name: "app_requests_total", Labels: map[string]string{"app": "$1"}, Action: ActionMap},
+			{Match: "app.debug.*", MatchType: MatchTypeGlob, Action: ActionDrop},
+		},
+		ForwardTo: testAppendable(actualSamples),
+	}
+	comp, err := New(testOptions(t), args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		require.NoError(t, comp.Run(ctx))
+	}()
+
+	tcp, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = fmt.Fprint(tcp, "servers.a.cpu.load 1.5 1700000000\ninvalid\napp.debug.x 1 1700000000\n")
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	udp, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	_, err = fmt.Fprint(udp, "app.web.requests;env=prod 10 1700000001\nunmapped.metric 3 1700000001\n")
+	require.NoError(t, err)
+	require.NoError(t, udp.Close())
+
+	expected := []testSample{
+		{ts: 1700000000000, val: 1.5, l: labels.FromStrings("__name__", "cpu_load", "server", "a")},
+		{ts: 1700000001000, val: 10, l: labels.FromStrings("__name__", "app_requests_total", "app", "web", "env", "prod")},
+	}
+
+	var actual []testSample
+	for range expected {
+		select {
+		case s := <-actualSamples:
+			actual = append(actual, s)
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for samples")
+		}
+	}
+	require.ElementsMatch(t, expected, actual)
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(comp.droppedSamplesTotal) == 2 && testutil.ToFloat64(comp.invalidLinesTotal) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+type testSample struct {
+	ts  int64
+	val float64
+	l   labels.Labels
+}
+
+func testAppendable(actualSamples chan testSample) []storage.Appendable {
+	hookFn := func(
+		ref storage.SeriesRef,
+		l labels.Labels,
+		ts int64,
+		val float64,
+		next storage.Appender,
+	) (storage.SeriesRef, error) {
+
+		actualSamples <- testSample{ts: ts, val: val, l: l}
+		return ref, nil
+	}
+
+	ls := labelstore.New(nil)
+	return []storage.Appendable{agentprom.NewInterceptor(
+		nil,
+		ls,
+		agentprom.WithAppendHook(
+			hookFn))}
+}
+
+func testServerConfig(port int) *fnet.ServerConfig {
+	return &fnet.ServerConfig{
+		HTTP: &fnet.HTTPConfig{
+			ListenAddress: "127.0.0.1",
+			ListenPort:    port,
+		},
+		GracefulShutdownTimeout: time.Second,
+	}
+}
+
+func testOptions(t *testing.T) component.Options {
+	return component.Options{
+		ID:         "prometheus.receive_graphite.test",
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return labelstore.New(nil), nil
+		},
+	}
+}
+
+func TestHandle_MaxLineSize(t *testing.T) {
+	actualSamples := make(chan testSample, 100)
+
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+
+	comp, err := New(testOptions(t), Arguments{
+		Server:    testServerConfig(port),
+		ForwardTo: testAppendable(actualSamples),
+	})
+	require.NoError(t, err)
+	defer comp.listener.Stop()
+
+	// Lines before the line which is too long are still forwarded.
+	input := "valid.metric 1 1700000000\n" + strings.Repeat("a", maxLineSize+1) + " 1\n"
+	err = comp.handle(bufio.NewReader(strings.NewReader(input)))
+	require.ErrorIs(t, err, bufio.ErrTooLong)
+	require.Len(t, actualSamples, 1)
+}
@@ -0,0 +1,196 @@
+package receive_influx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// point is a point of the InfluxDB line protocol. Fields which aren't
+// numbers or booleans are ignored.
+type point struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+	// timestamp is the timestamp of the point in the precision of the
+	// request, or nil if the point has no timestamp.
+	timestamp *int64
+}
+
+// parseLine parses a line of the InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+func parseLine(line string) (point, error) {
+	var p point
+
+	keyEnd := indexUnescaped(line, ' ', false)
+	if keyEnd < 0 {
+		return p, fmt.Errorf("missing fields")
+	}
+	key, rest := line[:keyEnd], strings.TrimLeft(line[keyEnd+1:], " ")
+
+	parts := splitUnescaped(key, ',', false)
+	p.measurement = unescape(parts[0])
+	if p.measurement == "" {
+		return p, fmt.Errorf("missing measurement")
+	}
+
+	p.tags = make(map[string]string, len(parts)-1)
+	for _, tag := range parts[1:] {
+		name, value, err := splitPair(tag, false)
+		if err != nil {
+			return p, fmt.Errorf("invalid tag %q: %w", tag, err)
+		}
+		p.tags[name] = value
+	}
+
+	fieldsEnd := indexUnescaped(rest, ' ', true)
+	fields, ts := rest, ""
+	if fieldsEnd >= 0 {
+		fields, ts = rest[:fieldsEnd], strings.TrimSpace(rest[fieldsEnd+1:])
+	}
+	if fields == "" {
+		return p, fmt.Errorf("missing fields")
+	}
+
+	p.fields = make(map[string]float64)
+	for _, field := range splitUnescaped(fields, ',', true) {
+		name, raw, err := splitPair(field, true)
+		if err != nil {
+			return p, fmt.Errorf("invalid field %q: %w", field, err)
+		}
+		value, ok, err := parseFieldValue(raw)
+		if err != nil {
+			return p, fmt.Errorf("invalid value of field %q: %w", name, err)
+		} else if ok {
+			p.fields[name] = value
+		}
+	}
+
+	if ts != "" {
+		t, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		p.timestamp = &t
+	}
+	return p, nil
+}
+
+// parseFieldValue parses the value of a field. It returns false for string
+// values, which can't be converted to samples.
+func parseFieldValue(raw string) (float64, bool, error) {
+	if raw == "" {
+		return 0, false, fmt.Errorf("missing value")
+	}
+
+	switch {
+	case raw[0] == '"':
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return 0, false, fmt.Errorf("unterminated string")
+		}
+		return 0, false, nil
+	case raw[len(raw)-1] == 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	case raw[len(raw)-1] == 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	return v, err == nil, err
+}
+
+// splitPair splits a key=value pair and unescapes both sides. The value is
+// kept as is when it belongs to a field.
+func splitPair(s string, field bool) (string, string, error) {
+	i := indexUnescaped(s, '=', false)
+	if i <= 0 {
+		return "", "", fmt.Errorf("missing key or value")
+	}
+	key, value := unescape(s[:i]), s[i+1:]
+	if !field {
+		value = unescape(value)
+		if value == "" {
+			return "", "", fmt.Errorf("missing value")
+		}
+	}
+	return key, value, nil
+}
+
+// indexUnescaped returns the index of the first unescaped sep in s, or -1.
+// Separators within double quotes are ignored when quoted is true.
+func indexUnescaped(s string, sep byte, quoted bool) int {
+	var inQuotes bool
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped splits s around unescaped occurrences of sep.
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep, quoted)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// unescape removes the backslashes escaping special characters of the line
+// protocol.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`,= "\`, s[i+1]) >= 0 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// precisionUnit returns the duration of a timestamp unit for the precision
+// query parameter of the v1 and v2 write APIs.
+func precisionUnit(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unsupported precision %q", precision)
+	}
+}
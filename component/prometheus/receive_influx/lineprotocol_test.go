@@ -0,0 +1,73 @@
+package receive_influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	ts := int64(1465839830100400200)
+
+	tt := []struct {
+		name   string
+		line   string
+		expect point
+		err    string
+	}{
+		{
+			name: "full point",
+			line: `cpu,host=server01,region=us-west usage_idle=0.64,usage_user=2i,up=t 1465839830100400200`,
+			expect: point{
+				measurement: "cpu",
+				tags:        map[string]string{"host": "server01", "region": "us-west"},
+				fields:      map[string]float64{"usage_idle": 0.64, "usage_user": 2, "up": 1},
+				timestamp:   &ts,
+			},
+		},
+		{
+			name: "no tags and no timestamp",
+			line: `temperature value=21.5`,
+			expect: point{
+				measurement: "temperature",
+				tags:        map[string]string{},
+				fields:      map[string]float64{"value": 21.5},
+			},
+		},
+		{
+			name: "escaped characters",
+			line: `disk\ io,path=/var\,lib,mount\=point=a\ b read\ bytes=12u`,
+			expect: point{
+				measurement: "disk io",
+				tags:        map[string]string{"path": "/var,lib", "mount=point": "a b"},
+				fields:      map[string]float64{"read bytes": 12},
+			},
+		},
+		{
+			name: "string fields are ignored",
+			line: `app,env=prod msg="hello, world \"x\" y",count=3i 1465839830100400200`,
+			expect: point{
+				measurement: "app",
+				tags:        map[string]string{"env": "prod"},
+				fields:      map[string]float64{"count": 3},
+				timestamp:   &ts,
+			},
+		},
+		{name: "missing fields", line: `cpu,host=a`, err: "missing fields"},
+		{name: "invalid tag", line: `cpu,host value=1`, err: `invalid tag "host"`},
+		{name: "invalid value", line: `cpu value=abc`, err: `invalid value of field "value"`},
+		{name: "invalid timestamp", line: `cpu value=1 now`, err: `invalid timestamp "now"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := parseLine(tc.line)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, p)
+		})
+	}
+}
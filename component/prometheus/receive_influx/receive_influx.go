@@ -0,0 +1,285 @@
+package receive_influx
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"github.com/grafana/agent/component"
+	fnet "github.com/grafana/agent/component/common/net"
+	agentprom "github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/strutil"
+)
+
+// maxLineSize is the maximum size of a line of the line protocol.
+const maxLineSize = 1 << 20
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.receive_influx",
+		Args:          Arguments{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+type Arguments struct {
+	Server    *fnet.ServerConfig   `river:",squash"`
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = Arguments{
+		Server: fnet.DefaultServerConfig(),
+	}
+}
+
+type Component struct {
+	opts               component.Options
+	fanout             *agentprom.Fanout
+	uncheckedCollector *util.UncheckedCollector
+
+	samplesTotal      prometheus.Counter
+	invalidLinesTotal prometheus.Counter
+
+	updateMut sync.RWMutex
+	args      Arguments
+	server    *fnet.TargetServer
+}
+
+func New(opts component.Options, args Arguments) (*Component, error) {
+	service, err := opts.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ls := service.(labelstore.LabelStore)
+	fanout := agentprom.NewFanout(args.ForwardTo, opts.ID, opts.Registerer, ls)
+
+	uncheckedCollector := util.NewUncheckedCollector(nil)
+	opts.Registerer.MustRegister(uncheckedCollector)
+
+	c := &Component{
+		opts:               opts,
+		fanout:             fanout,
+		uncheckedCollector: uncheckedCollector,
+		samplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_receive_influx_samples_total",
+			Help: "Total number of samples received from InfluxDB line protocol points.",
+		}),
+		invalidLinesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "prometheus_receive_influx_invalid_lines_total",
+			Help: "Total number of lines which failed to parse.",
+		}),
+	}
+	for _, m := range []prometheus.Collector{c.samplesTotal, c.invalidLinesTotal} {
+		if err := opts.Registerer.Register(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run satisfies the Component interface.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		c.updateMut.Lock()
+		defer c.updateMut.Unlock()
+		c.shutdownServer()
+	}()
+
+	<-ctx.Done()
+	level.Info(c.opts.Logger).Log("msg", "terminating due to context done")
+	return nil
+}
+
+// Update satisfies the Component interface.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+	c.fanout.UpdateChildren(newArgs.ForwardTo)
+
+	c.updateMut.Lock()
+	defer c.updateMut.Unlock()
+
+	serverNeedsUpdate := !reflect.DeepEqual(c.args.Server, newArgs.Server)
+	if !serverNeedsUpdate {
+		c.args = newArgs
+		return nil
+	}
+	c.shutdownServer()
+
+	// [server.Server] registers new metrics every time it is created. To
+	// avoid issues with re-registering metrics with the same name, we create a
+	// new registry for the server every time we create one, and pass it to an
+	// unchecked collector to bypass uniqueness checking.
+	serverRegistry := prometheus.NewRegistry()
+	c.uncheckedCollector.SetCollector(serverRegistry)
+
+	s, err := fnet.NewTargetServer(c.opts.Logger, "prometheus_receive_influx", serverRegistry, newArgs.Server)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %v", err)
+	}
+	c.server = s
+
+	err = c.server.MountAndRun(func(router *mux.Router) {
+		router.Path("/write").Methods("POST").HandlerFunc(c.handleWrite)
+		router.Path("/api/v2/write").Methods("POST").HandlerFunc(c.handleWrite)
+		router.Path("/ping").Methods("GET", "HEAD").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	c.args = newArgs
+	return nil
+}
+
+// shutdownServer will shut down the currently used server.
+// It is not goroutine-safe and an updateMut write lock must be held when it's called.
+func (c *Component) shutdownServer() {
+	if c.server != nil {
+		c.server.StopAndShutdown()
+		c.server = nil
+	}
+}
+
+// handleWrite handles requests of the v1 and v2 write APIs of InfluxDB. Valid
+// points are appended even when some lines fail to parse, as InfluxDB does.
+func (c *Component) handleWrite(w http.ResponseWriter, r *http.Request) {
+	unit, err := precisionUnit(r.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	var (
+		now     = time.Now()
+		app     = c.fanout.Appender(r.Context())
+		invalid int
+		lastErr error
+	)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		p, err := parseLine(line)
+		if err != nil {
+			invalid++
+			lastErr = err
+			continue
+		}
+		if err := c.appendPoint(app, p, unit, now); err != nil {
+			_ = app.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = app.Rollback()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if invalid > 0 {
+		c.invalidLinesTotal.Add(float64(invalid))
+		level.Debug(c.opts.Logger).Log("msg", "failed to parse lines", "lines", invalid, "err", lastErr)
+		http.Error(w, fmt.Sprintf("partial write: %d lines failed to parse: %v", invalid, lastErr), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// appendPoint appends a sample for each field of p. The metric name of a
+// sample is the measurement followed by the field name, or the measurement
+// alone for fields called "value".
+func (c *Component) appendPoint(app storage.Appender, p point, unit time.Duration, now time.Time) error {
+	ts := now.UnixMilli()
+	if p.timestamp != nil {
+		ts = toMillis(*p.timestamp, unit)
+	}
+
+	lbls := make(map[string]string, len(p.tags)+1)
+	for name, value := range p.tags {
+		name = sanitizeName(name)
+		if name == model.MetricNameLabel {
+			continue
+		}
+		lbls[name] = value
+	}
+
+	for field, value := range p.fields {
+		name := p.measurement
+		if field != "value" {
+			name += "_" + field
+		}
+		lbls[model.MetricNameLabel] = sanitizeName(name)
+
+		if _, err := app.Append(0, labels.FromMap(lbls), ts, value); err != nil {
+			return err
+		}
+		c.samplesTotal.Inc()
+	}
+	return nil
+}
+
+// toMillis converts a timestamp in the given unit to milliseconds.
+func toMillis(ts int64, unit time.Duration) int64 {
+	if unit >= time.Millisecond {
+		return ts * int64(unit/time.Millisecond)
+	}
+	return ts / int64(time.Millisecond/unit)
+}
+
+// sanitizeName replaces the characters which aren't valid in label names.
+func sanitizeName(name string) string {
+	name = strutil.SanitizeLabelName(name)
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,130 @@
+package receive_influx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	fnet "github.com/grafana/agent/component/common/net"
+	agentprom "github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/phayes/freeport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardsPoints(t *testing.T) {
+	actualSamples := make(chan testSample, 100)
+
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+	grpcPort, err := freeport.GetFreePort()
+	require.NoError(t, err)
+
+	args := Arguments{
+		Server: &fnet.ServerConfig{
+			HTTP: &fnet.HTTPConfig{ListenAddress: "localhost", ListenPort: port},
+			GRPC: &fnet.GRPCConfig{ListenAddress: "127.0.0.1", ListenPort: grpcPort},
+		},
+		ForwardTo: testAppendable(actualSamples),
+	}
+	comp, err := New(testOptions(t), args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		require.NoError(t, comp.Run(ctx))
+	}()
+
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + "/ping")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// v1 API with a precision in seconds.
+	resp, err := http.Post(baseURL+"/write?db=telegraf&precision=s", "text/plain", strings.NewReader(
+		"cpu,host=a usage_idle=99.5,usage_user=1i 1700000000\n"+
+			"mem,host=a value=42 1700000000\n",
+	))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// v2 API with a default precision in nanoseconds, and an invalid line.
+	resp, err = http.Post(baseURL+"/api/v2/write?org=o&bucket=b", "text/plain", strings.NewReader(
+		"disk,1path=/ free=3 1700000000000000000\n"+
+			"invalid\n",
+	))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	expected := []testSample{
+		{ts: 1700000000000, val: 99.5, l: labels.FromStrings("__name__", "cpu_usage_idle", "host", "a")},
+		{ts: 1700000000000, val: 1, l: labels.FromStrings("__name__", "cpu_usage_user", "host", "a")},
+		{ts: 1700000000000, val: 42, l: labels.FromStrings("__name__", "mem", "host", "a")},
+		{ts: 1700000000000, val: 3, l: labels.FromStrings("__name__", "disk_free", "_1path", "/")},
+	}
+
+	var actual []testSample
+	for range expected {
+		select {
+		case s := <-actualSamples:
+			actual = append(actual, s)
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for samples")
+		}
+	}
+	require.ElementsMatch(t, expected, actual)
+}
+
+type testSample struct {
+	ts  int64
+	val float64
+	l   labels.Labels
+}
+
+func testAppendable(actualSamples chan testSample) []storage.Appendable {
+	hookFn := func(
+		ref storage.SeriesRef,
+		l labels.Labels,
+		ts int64,
+		val float64,
+		next storage.Appender,
+	) (storage.SeriesRef, error) {
+
+		actualSamples <- testSample{ts: ts, val: val, l: l}
+		return ref, nil
+	}
+
+	ls := labelstore.New(nil)
+	return []storage.Appendable{agentprom.NewInterceptor(
+		nil,
+		ls,
+		agentprom.WithAppendHook(
+			hookFn))}
+}
+
+func testOptions(t *testing.T) component.Options {
+	return component.Options{
+		ID:         "prometheus.receive_influx.test",
+		Logger:     util.TestFlowLogger(t),
+		Registerer: prometheus.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return labelstore.New(nil), nil
+		},
+	}
+}
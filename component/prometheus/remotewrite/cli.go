@@ -1,11 +1,15 @@
 package remotewrite
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/grafana/agent/pkg/agentctl/waltools"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
@@ -18,6 +22,8 @@ func InstallTools(cmd *cobra.Command) {
 		samplesCmd(),
 		targetStatsCmd(),
 		walStatsCmd(),
+		walExportCmd(),
+		walReplayCmd(),
 	)
 }
 
@@ -203,6 +209,203 @@ deletion but then comes back at some point).`,
 	}
 }
 
+func walExportCmd() *cobra.Command {
+	var (
+		selector      string
+		from, to      string
+		format        string
+		output        string
+		blockDuration time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "wal-export [WAL directory]",
+		Short: "Export series and samples from the WAL",
+		Long: `wal-export reads a WAL directory and exports the samples of the series
+matching a label selector within a time range, to recover data which couldn't
+be sent to the remote endpoint.
+
+Samples can be exported in the OpenMetrics text format, which can be
+backfilled with "promtool tsdb create-blocks-from openmetrics", or directly as
+Prometheus TSDB blocks. Native histograms are only exported to TSDB blocks.
+
+Examples:
+
+Export all samples to OpenMetrics on stdout:
+
+wal-export /tmp/wal
+
+
+Export the samples of 'job=a' in a time range to TSDB blocks:
+
+wal-export -s '{job="a"}' --from 2023-11-20T08:00:00Z --to 2023-11-20T12:00:00Z \
+  --format tsdb -o /tmp/blocks /tmp/wal
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			directory, err := walDirectory(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			mint, maxt, err := waltools.ParseTimeRange(from, to)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			series, err := waltools.ReadSeries(directory, selector, mint, maxt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read series: %v\n", err)
+				os.Exit(1)
+			}
+
+			switch format {
+			case "openmetrics":
+				out := os.Stdout
+				if output != "" && output != "-" {
+					out, err = os.Create(output)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "failed to create output file: %v\n", err)
+						os.Exit(1)
+					}
+					defer out.Close()
+				}
+				if err := waltools.WriteOpenMetrics(out, series); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to write OpenMetrics: %v\n", err)
+					os.Exit(1)
+				}
+			case "tsdb":
+				if output == "" || output == "-" {
+					fmt.Fprintln(os.Stderr, "an output directory must be set with --output for the tsdb format")
+					os.Exit(1)
+				}
+				if err := os.MkdirAll(output, 0o755); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to create output directory: %v\n", err)
+					os.Exit(1)
+				}
+
+				logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+				ids, err := waltools.WriteBlocks(context.Background(), logger, output, series, blockDuration)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to write blocks: %v\n", err)
+					os.Exit(1)
+				}
+				for _, id := range ids {
+					fmt.Println(filepath.Join(output, id))
+				}
+			default:
+				fmt.Fprintf(os.Stderr, "unsupported format %q, must be openmetrics or tsdb\n", format)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "s", "{}", "label selector of the series to export")
+	cmd.Flags().StringVar(&from, "from", "", "start of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVar(&to, "to", "", "end of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVarP(&format, "format", "f", "openmetrics", "output format, openmetrics or tsdb")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file for openmetrics (default stdout), or output directory for tsdb")
+	cmd.Flags().DurationVar(&blockDuration, "block-duration", 2*time.Hour, "duration of the exported TSDB blocks")
+	return cmd
+}
+
+func walReplayCmd() *cobra.Command {
+	var (
+		selector string
+		from, to string
+		headers  map[string]string
+		opts     = waltools.ReplayOptions{}
+	)
+
+	cmd := &cobra.Command{
+		Use:   "wal-replay [WAL directory] [remote-write URL]",
+		Short: "Push the samples of the WAL to a remote-write endpoint",
+		Long: `wal-replay reads a WAL directory and pushes the samples of the series
+matching a label selector within a time range to a remote-write endpoint, to
+recover data which the remote endpoint rejected.
+
+The samples of a series are always sent in order by the same worker. Requests
+failing with recoverable errors are retried; other rejected requests are
+reported at the end of the replay.
+
+Examples:
+
+Push the samples of 'job=a' in a time range to Mimir:
+
+wal-replay -s '{job="a"}' --from 2023-11-20T08:00:00Z --to 2023-11-20T12:00:00Z \
+  -H X-Scope-OrgID=tenant /tmp/wal http://mimir:9009/api/v1/push
+`,
+		Args: cobra.ExactArgs(2),
+		Run: func(_ *cobra.Command, args []string) {
+			directory, err := walDirectory(args[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			mint, maxt, err := waltools.ParseTimeRange(from, to)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			series, err := waltools.ReadSeries(directory, selector, mint, maxt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read series: %v\n", err)
+				os.Exit(1)
+			}
+
+			opts.URL = args[1]
+			opts.Headers = headers
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			stats, err := waltools.Replay(ctx, series, opts)
+			fmt.Printf("Series:          %d\n", stats.Series)
+			fmt.Printf("Samples:         %d\n", stats.Samples)
+			fmt.Printf("Requests:        %d\n", stats.Requests)
+			fmt.Printf("Failed Samples:  %d\n", stats.FailedSamples)
+			fmt.Printf("Failed Requests: %d\n", stats.FailedRequests)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to replay WAL: %v\n", err)
+				os.Exit(1)
+			}
+			if stats.LastError != nil {
+				fmt.Fprintf(os.Stderr, "last error: %v\n", stats.LastError)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&selector, "selector", "s", "{}", "label selector of the series to replay")
+	cmd.Flags().StringVar(&from, "from", "", "start of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringVar(&to, "to", "", "end of the time range, as an RFC 3339 time or Unix timestamp")
+	cmd.Flags().StringToStringVarP(&headers, "header", "H", nil, "header to add to requests, as name=value")
+	cmd.Flags().IntVarP(&opts.Concurrency, "concurrency", "c", 4, "number of concurrent requests")
+	cmd.Flags().IntVar(&opts.BatchSize, "batch-size", 2000, "maximum number of samples per request")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 30*time.Second, "timeout of requests")
+	cmd.Flags().IntVar(&opts.MaxRetries, "max-retries", 10, "maximum number of retries of requests failing with recoverable errors")
+	return cmd
+}
+
+// walDirectory checks that directory exists, and returns its wal
+// subdirectory if it has one.
+func walDirectory(directory string) (string, error) {
+	if _, err := os.Stat(directory); os.IsNotExist(err) {
+		return "", fmt.Errorf("%s does not exist", directory)
+	} else if err != nil {
+		return "", fmt.Errorf("error getting wal: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(directory, "wal")); err == nil {
+		directory = filepath.Join(directory, "wal")
+	}
+	return directory, nil
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
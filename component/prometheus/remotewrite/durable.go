@@ -0,0 +1,544 @@
+package remotewrite
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/agentctl/waltools"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// positionsFile is the file of the pipeline directory holding the
+	// timestamp up to which each endpoint acknowledged the data of the WAL.
+	positionsFile = "positions.json"
+
+	// savePositionsFrequency is how often positions are persisted.
+	savePositionsFrequency = time.Minute
+
+	// catchUpBatchSamples is the number of samples read at once from the WAL
+	// when resending the data which wasn't acknowledged before a restart.
+	catchUpBatchSamples = 200_000
+	// catchUpConcurrency is the number of concurrent requests resending data.
+	catchUpConcurrency = 4
+	// catchUpRetryInterval is the time to wait before retrying to read the WAL.
+	catchUpRetryInterval = 10 * time.Second
+
+	// allSeriesSelector matches all the series of the WAL.
+	allSeriesSelector = `{__name__=~".+"}`
+
+	// highestInMetric is the metric of the remote storage holding the highest
+	// timestamp appended to it.
+	highestInMetric = "prometheus_remote_storage_highest_timestamp_in_seconds"
+)
+
+// queueName returns the name of the queue of rw in the remote storage, which
+// is the remote_name label of its metrics.
+func queueName(rw *config.RemoteWriteConfig) (string, error) {
+	if rw.Name != "" {
+		return rw.Name, nil
+	}
+
+	// Like the remote storage, use the hash of the config when endpoints
+	// don't have a name.
+	buf, err := yaml.Marshal(rw)
+	if err != nil {
+		return "", err
+	}
+	hash := md5.Sum(buf)
+	return hex.EncodeToString(hash[:])[:6], nil
+}
+
+// loadPositions reads the positions persisted in dir.
+func loadPositions(dir string) (map[string]int64, error) {
+	positions := make(map[string]int64)
+
+	buf, err := os.ReadFile(filepath.Join(dir, positionsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return positions, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &positions); err != nil {
+		return nil, fmt.Errorf("invalid positions file: %w", err)
+	}
+	return positions, nil
+}
+
+// savePositions atomically persists positions in dir.
+func savePositions(dir string, positions map[string]int64) error {
+	buf, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, positionsFile+".tmp")
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, positionsFile))
+}
+
+// removePositions deletes the positions persisted in dir.
+func removePositions(dir string) error {
+	err := os.Remove(filepath.Join(dir, positionsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// highestIn returns the highest timestamp appended to the remote storage, in
+// milliseconds.
+func (p *pipeline) highestIn() int64 {
+	var highestIn int64
+
+	mfs, err := p.registry.Gather()
+	if err != nil {
+		level.Debug(p.logger).Log("msg", "failed to gather remote storage metrics", "err", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != highestInMetric {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			highestIn = int64(m.GetGauge().GetValue() * 1000)
+		}
+	}
+	return highestIn
+}
+
+// ackedPositions updates and returns the timestamp up to which each endpoint
+// acknowledged data, from the samples which the relay saw stored.
+//
+// Queues only send the data appended after they started, so the position of
+// endpoints which are resending older data is only updated by their
+// catch-up.
+func (p *pipeline) ackedPositions() map[string]int64 {
+	p.posMut.Lock()
+	defer p.posMut.Unlock()
+
+	var stored map[string]int64
+	if p.relay != nil {
+		stored = p.relay.positions()
+	}
+
+	for name := range p.positions {
+		if _, ok := p.queues[name]; !ok {
+			delete(p.positions, name)
+		}
+	}
+
+	res := make(map[string]int64, len(p.queues))
+	for name := range p.queues {
+		pos := p.positions[name]
+		if s, ok := stored[name]; ok && p.catchUps[name] == nil {
+			pos = max(pos, s)
+		}
+		p.positions[name] = pos
+		res[name] = pos
+	}
+	return res
+}
+
+// savePositions persists the positions of endpoints in durable mode.
+func (p *pipeline) savePositions() {
+	p.posMut.Lock()
+	durable := p.durable
+	p.posMut.Unlock()
+	if !durable {
+		return
+	}
+
+	if err := savePositions(p.dir, p.ackedPositions()); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to save positions of endpoints", "err", err)
+	}
+}
+
+// catchUp is an endpoint resending the data of the WAL which its queue
+// doesn't send.
+type catchUp struct {
+	cancel context.CancelFunc
+}
+
+// startCatchUps resends the data of the WAL which the queues started by the
+// remote storage don't send, because it was appended before they started, to
+// the endpoints of names which have a position. p.posMut must be held.
+func (p *pipeline) startCatchUps(names map[string]bool, externalLabels labels.Labels) {
+	var (
+		until       = timestamp.FromTime(time.Now())
+		lastSegment = -1
+	)
+	for name, started := range names {
+		from, ok := p.positions[name]
+		if !started || !ok || from >= until {
+			continue
+		}
+
+		if lastSegment < 0 {
+			// The data appended from now on is sent by the queues, so the
+			// catch-ups only read the segments written until now.
+			var err error
+			if lastSegment, err = p.walStore.NextSegment(); err != nil {
+				level.Error(p.logger).Log("msg", "failed to resend data which queues don't send", "err", err)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithCancel(p.ctx)
+		cu := &catchUp{cancel: cancel}
+		p.catchUps[name] = cu
+		p.wg.Add(1)
+		go p.catchUp(ctx, cu, name, p.queues[name], externalLabels, from, until, lastSegment)
+	}
+}
+
+// catchUp resends the data of the WAL after from, up to until and to the
+// segment lastSegment, to the endpoint rw. The WAL is read once, in batches
+// which are sent as they're read, and the position of the endpoint is updated
+// after each batch is sent.
+func (p *pipeline) catchUp(ctx context.Context, cu *catchUp, name string, rw *config.RemoteWriteConfig, externalLabels labels.Labels, from, until int64, lastSegment int) {
+	defer p.wg.Done()
+	l := log.With(p.logger, "remote_name", name)
+
+	client, err := remote.NewWriteClient(name, &remote.ClientConfig{
+		URL:              rw.URL,
+		Timeout:          rw.RemoteTimeout,
+		HTTPClientConfig: rw.HTTPClientConfig,
+		SigV4Config:      rw.SigV4Config,
+		AzureADConfig:    rw.AzureADConfig,
+		Headers:          rw.Headers,
+		RetryOnRateLimit: rw.QueueConfig.RetryOnRateLimit,
+	})
+	if err != nil {
+		level.Error(l).Log("msg", "failed to create client to resend data", "err", err)
+		return
+	}
+
+	reader, err := waltools.NewSeriesReader(wal.SubDirectory(p.dir), allSeriesSelector, lastSegment)
+	if err != nil {
+		level.Error(l).Log("msg", "failed to read WAL to resend data", "err", err)
+		return
+	}
+	defer reader.Close()
+
+	level.Info(l).Log("msg", "resending data which the queue doesn't send", "from", timestamp.Time(from), "until", timestamp.Time(until))
+	// sent is the highest timestamp of the previous batch. Samples are
+	// appended to the WAL roughly in timestamp order, so once a batch is sent
+	// the data up to the previous batch is assumed to be sent.
+	sent := from
+	for {
+		series, err := reader.Read(from+1, until, catchUpBatchSamples)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			level.Warn(l).Log("msg", "failed to read WAL to resend data, retrying", "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(catchUpRetryInterval):
+			}
+			continue
+		}
+
+		var maxt int64
+		for _, s := range series {
+			for _, sample := range s.Samples {
+				maxt = max(maxt, sample.T)
+			}
+		}
+
+		series = prepareSeries(series, rw, externalLabels)
+		for {
+			stats, err := waltools.Replay(ctx, series, waltools.ReplayOptions{
+				Client:      client,
+				Concurrency: catchUpConcurrency,
+				BatchSize:   rw.QueueConfig.MaxSamplesPerSend,
+				MaxRetries:  -1,
+			})
+			if err == nil {
+				if stats.FailedSamples > 0 {
+					level.Warn(l).Log("msg", "endpoint rejected resent samples", "samples", stats.FailedSamples, "err", stats.LastError)
+				}
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			level.Warn(l).Log("msg", "failed to resend data, retrying", "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(catchUpRetryInterval):
+			}
+		}
+
+		p.posMut.Lock()
+		if p.catchUps[name] == cu {
+			p.positions[name] = max(p.positions[name], sent)
+		}
+		p.posMut.Unlock()
+		sent = max(sent, maxt)
+	}
+
+	p.posMut.Lock()
+	defer p.posMut.Unlock()
+	if p.catchUps[name] != cu {
+		// The queue was recreated meanwhile, and another catch-up resends
+		// the data.
+		return
+	}
+	p.positions[name] = max(p.positions[name], until)
+	delete(p.catchUps, name)
+	level.Info(l).Log("msg", "finished resending data which the queue doesn't send")
+}
+
+// queueLabels returns the labels sent by a queue for the series with labels
+// lbls, with externalLabels and relabelConfigs applied like queues do, and
+// false if the queue drops the series.
+func queueLabels(lbls, externalLabels labels.Labels, relabelConfigs []*relabel.Config) (labels.Labels, bool) {
+	lb := labels.NewBuilder(lbls)
+	externalLabels.Range(func(l labels.Label) {
+		if lb.Get(l.Name) == "" {
+			lb.Set(l.Name, l.Value)
+		}
+	})
+	lbls, keep := relabel.Process(lb.Labels(), relabelConfigs...)
+	return lbls, keep && !lbls.IsEmpty()
+}
+
+// prepareSeries applies the external labels and write relabeling rules of rw
+// to series like queues do, and drops native histograms if rw doesn't send
+// them.
+func prepareSeries(series []*waltools.Series, rw *config.RemoteWriteConfig, externalLabels labels.Labels) []*waltools.Series {
+	res := series[:0]
+	for _, s := range series {
+		lbls, keep := queueLabels(s.Labels, externalLabels, rw.WriteRelabelConfigs)
+		if !keep {
+			continue
+		}
+		s.Labels = lbls
+
+		if !rw.SendNativeHistograms {
+			samples := s.Samples[:0]
+			for _, sample := range s.Samples {
+				if sample.H == nil && sample.FH == nil {
+					samples = append(samples, sample)
+				}
+			}
+			s.Samples = samples
+		}
+		if len(s.Samples) > 0 {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// trackingAppender tracks the samples appended to the WAL in the relay,
+// once they're committed.
+type trackingAppender struct {
+	storage.Appender
+	relay   *relay
+	samples []appendedSample
+}
+
+// Append implements storage.Appender.
+func (a *trackingAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	ref, err := a.Appender.Append(ref, l, t, v)
+	if err == nil && !l.IsEmpty() {
+		a.samples = append(a.samples, appendedSample{labels: l, t: t})
+	}
+	return ref, err
+}
+
+// AppendHistogram implements storage.Appender.
+func (a *trackingAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	ref, err := a.Appender.AppendHistogram(ref, l, t, h, fh)
+	if err == nil && !l.IsEmpty() {
+		a.samples = append(a.samples, appendedSample{labels: l, t: t, histogram: true})
+	}
+	return ref, err
+}
+
+// Commit implements storage.Appender. The samples are tracked before they're
+// written to the WAL, so that queues can't send them before.
+func (a *trackingAppender) Commit() error {
+	a.relay.appended(a.samples)
+	a.samples = nil
+	return a.Appender.Commit()
+}
+
+// Rollback implements storage.Appender.
+func (a *trackingAppender) Rollback() error {
+	a.samples = nil
+	return a.Appender.Rollback()
+}
+
+// truncateDurable deletes the segments of the WAL which every endpoint
+// acknowledged, or which exceed the max_age and max_size limits.
+//
+// Truncating the WAL deletes its oldest segments, and only keeps their
+// samples more recent than a timestamp in a checkpoint, which queues don't
+// read. So segments are only deleted when every endpoint acknowledged data
+// more recent than the time they were last written to.
+func (p *pipeline) truncateDurable(l log.Logger, opts WALOptions) {
+	now := time.Now()
+
+	// Everything is acknowledged when there's no endpoint.
+	acked := timestamp.FromTime(now)
+	for _, pos := range p.ackedPositions() {
+		acked = min(acked, pos)
+	}
+
+	segment, ok, err := p.walStore.TruncatedSegment()
+	if err != nil {
+		level.Warn(l).Log("msg", "could not truncate WAL", "err", err)
+		return
+	} else if !ok {
+		level.Debug(l).Log("msg", "not truncating the WAL, not enough segments")
+		return
+	}
+	walDir := wal.SubDirectory(p.dir)
+	fi, err := os.Stat(wlog.SegmentName(walDir, segment))
+	if err != nil {
+		level.Warn(l).Log("msg", "could not truncate WAL", "err", err)
+		return
+	}
+	segmentTs := timestamp.FromTime(fi.ModTime())
+
+	var (
+		mint   = acked - opts.MinKeepaliveTime.Milliseconds()
+		reason string
+	)
+	switch {
+	case acked >= segmentTs:
+	case opts.MaxAge > 0 && timestamp.FromTime(now.Add(-opts.MaxAge)) >= segmentTs:
+		mint, reason = timestamp.FromTime(now.Add(-opts.MaxAge)), "max_age"
+	case opts.MaxSize > 0 && walSize(l, walDir) > int64(opts.MaxSize):
+		mint, reason = segmentTs, "max_size"
+	default:
+		level.Debug(l).Log("msg", "not truncating the WAL, endpoints didn't acknowledge its oldest segments", "acked", acked, "segment_ts", segmentTs)
+		return
+	}
+
+	if reason != "" {
+		level.Warn(l).Log("msg", "truncating data of the WAL which endpoints didn't acknowledge", "reason", reason, "ts", mint)
+		p.truncations.WithLabelValues(reason).Inc()
+
+		// The truncated data won't be sent anymore.
+		p.posMut.Lock()
+		for name, pos := range p.positions {
+			p.positions[name] = max(pos, mint)
+		}
+		p.posMut.Unlock()
+	}
+
+	level.Debug(l).Log("msg", "truncating the WAL", "ts", mint, "segment", segment)
+	if err := p.walStore.TruncateUntil(max(mint, 0), segment); err != nil {
+		// The only issue here is larger disk usage and a greater replay time,
+		// so we'll only log this as a warning.
+		level.Warn(l).Log("msg", "could not truncate WAL", "err", err)
+	}
+	p.lastTruncateTs = mint
+}
+
+// walSize returns the size of the files in dir, or 0 if it can't be read.
+func walSize(l log.Logger, dir string) int64 {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		// Segments and checkpoints can be deleted concurrently.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		level.Debug(l).Log("msg", "failed to compute the size of the WAL", "err", err)
+	}
+	return size
+}
+
+// backlogCollector reports the data of the WAL which endpoints didn't
+// acknowledge yet.
+type backlogCollector struct {
+	p *pipeline
+
+	ageDesc   *prometheus_client.Desc
+	bytesDesc *prometheus_client.Desc
+}
+
+var _ prometheus_client.Collector = (*backlogCollector)(nil)
+
+func newBacklogCollector(p *pipeline) *backlogCollector {
+	return &backlogCollector{
+		p: p,
+		ageDesc: prometheus_client.NewDesc(
+			"prometheus_remote_write_backlog_age_seconds",
+			"Difference between the highest timestamp appended to the WAL and the timestamp up to which the endpoint acknowledged data.",
+			[]string{"remote_name"}, nil,
+		),
+		bytesDesc: prometheus_client.NewDesc(
+			"prometheus_remote_write_backlog_bytes",
+			"Size of the WAL on disk.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *backlogCollector) Describe(ch chan<- *prometheus_client.Desc) {
+	ch <- c.ageDesc
+	ch <- c.bytesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *backlogCollector) Collect(ch chan<- prometheus_client.Metric) {
+	highestIn := c.p.highestIn()
+	for name, pos := range c.p.ackedPositions() {
+		if pos == 0 {
+			// The endpoint didn't acknowledge anything since the WAL was
+			// opened.
+			pos = c.p.startTs
+		}
+		age := max(highestIn-pos, 0)
+		ch <- prometheus_client.MustNewConstMetric(c.ageDesc, prometheus_client.GaugeValue, float64(age)/1000, name)
+	}
+
+	size := walSize(c.p.logger, wal.SubDirectory(c.p.dir))
+	ch <- prometheus_client.MustNewConstMetric(c.bytesDesc, prometheus_client.GaugeValue, float64(size))
+}
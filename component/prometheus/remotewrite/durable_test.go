@@ -0,0 +1,199 @@
+package remotewrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	common "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestQueueName(t *testing.T) {
+	u, err := url.Parse("http://localhost:9009/api/v1/push")
+	require.NoError(t, err)
+
+	rw := config.DefaultRemoteWriteConfig
+	rw.URL = &common.URL{URL: u}
+
+	reg := prometheus_client.NewRegistry()
+	s := remote.NewStorage(log.NewNopLogger(), reg, startTime, t.TempDir(), time.Second, nil)
+	defer s.Close()
+	require.NoError(t, s.ApplyConfig(&config.Config{RemoteWriteConfigs: []*config.RemoteWriteConfig{&rw}}))
+
+	// The remote storage names queues without a name after the hash of their
+	// config.
+	expect, err := queueName(&rw)
+	require.NoError(t, err)
+	require.Len(t, expect, 6)
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, mf := range mfs {
+		if mf.GetName() != "prometheus_remote_storage_shards" {
+			continue
+		}
+		for _, lp := range mf.GetMetric()[0].GetLabel() {
+			if lp.GetName() == "remote_name" {
+				names = append(names, lp.GetValue())
+			}
+		}
+	}
+	require.Equal(t, []string{expect}, names)
+
+	rw.Name = "mimir"
+	name, err := queueName(&rw)
+	require.NoError(t, err)
+	require.Equal(t, "mimir", name)
+}
+
+func TestPositions(t *testing.T) {
+	dir := t.TempDir()
+
+	positions, err := loadPositions(dir)
+	require.NoError(t, err)
+	require.Empty(t, positions)
+
+	expect := map[string]int64{"a": 1000, "b": 2000}
+	require.NoError(t, savePositions(dir, expect))
+	positions, err = loadPositions(dir)
+	require.NoError(t, err)
+	require.Equal(t, expect, positions)
+
+	require.NoError(t, removePositions(dir))
+	require.NoError(t, removePositions(dir))
+	positions, err = loadPositions(dir)
+	require.NoError(t, err)
+	require.Empty(t, positions)
+}
+
+// TestDurable ensures that the data which wasn't acknowledged by an endpoint
+// before a restart is resent in durable mode.
+func TestDurable(t *testing.T) {
+	defer func(deadline time.Duration) { remoteFlushDeadline = deadline }(remoteFlushDeadline)
+	remoteFlushDeadline = 100 * time.Millisecond
+
+	var (
+		available   atomic.Bool
+		writeResult = make(chan *prompb.WriteRequest, 100)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		req, err := remote.DecodeWriteRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult <- req
+	}))
+	defer srv.Close()
+
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(fmt.Sprintf(`
+		external_labels = {
+			cluster = "local",
+		}
+		endpoint {
+			name           = "test"
+			url            = "%s/api/v1/write"
+			remote_timeout = "100ms"
+
+			queue_config {
+				batch_send_deadline = "100ms"
+				max_backoff         = "100ms"
+			}
+		}
+		wal {
+			durable = true
+		}
+	`, srv.URL)), &args))
+
+	var (
+		dataPath = t.TempDir()
+		ls       = labelstore.New(nil)
+	)
+	run := func(f func(c *Component)) {
+		c, err := New(component.Options{
+			ID:            "prometheus.remote_write.test",
+			Logger:        util.TestFlowLogger(t),
+			DataPath:      dataPath,
+			OnStateChange: func(component.Exports) {},
+			Registerer:    prometheus_client.NewRegistry(),
+			GetServiceData: func(name string) (interface{}, error) {
+				return ls, nil
+			},
+		}, args)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			require.NoError(t, c.Run(ctx))
+		}()
+
+		f(c)
+		cancel()
+		<-done
+	}
+
+	// The sample is older than the start of queues, so they don't send it.
+	// It's only resent by the catch-up after the restart, once the endpoint
+	// is available.
+	sampleTimestamp := time.Now().Add(-time.Minute).UnixMilli()
+	run(func(c *Component) {
+		app := c.receiver.Appender(context.Background())
+		_, err := app.Append(0, labels.FromStrings("__name__", "foo", "job", "app"), sampleTimestamp, 1)
+		require.NoError(t, err)
+		require.NoError(t, app.Commit())
+	})
+
+	positions, err := loadPositions(dataPath)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"test": 0}, positions)
+
+	available.Store(true)
+	run(func(c *Component) {
+		select {
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "timed out waiting for resent sample")
+		case req := <-writeResult:
+			require.Equal(t, []prompb.TimeSeries{{
+				Labels: []prompb.Label{
+					{Name: "__name__", Value: "foo"},
+					{Name: "cluster", Value: "local"},
+					{Name: "job", Value: "app"},
+				},
+				Samples: []prompb.Sample{{Timestamp: sampleTimestamp, Value: 1}},
+			}}, req.Timeseries)
+		}
+
+		p := c.pipelines[""]
+		require.Eventually(t, func() bool {
+			return p.ackedPositions()["test"] >= p.startTs
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	positions, err = loadPositions(dataPath)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, positions["test"], sampleTimestamp)
+}
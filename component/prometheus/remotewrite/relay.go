@@ -0,0 +1,663 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	common "github.com/prometheus/common/config"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"gopkg.in/yaml.v2"
+)
+
+// relayedHeaders are the headers set by queues which are forwarded to
+// endpoints.
+var relayedHeaders = []string{
+	"Content-Encoding",
+	"Content-Type",
+	"User-Agent",
+	"X-Prometheus-Remote-Write-Version",
+	"Retry-Attempt",
+}
+
+// failedMetrics are the metrics of queues counting the samples and
+// histograms which they didn't send, because the endpoint refused them or
+// because the queue dropped them.
+var failedMetrics = []string{
+	"prometheus_remote_storage_samples_failed_total",
+	"prometheus_remote_storage_histograms_failed_total",
+}
+
+// relay forwards the requests of the queues of a durable pipeline to their
+// endpoints, to track which data the endpoints stored.
+//
+// The remote storage only reports the highest timestamp sent by each queue,
+// across its shards and including failed requests, and doesn't allow
+// replacing the client of queues. So queues send their requests to a local
+// HTTP server, which forwards them to the endpoints with the client of the
+// endpoint configs. Queues authenticate with a random token, so that other
+// processes can't send data to the endpoints through the relay.
+//
+// Queues send the samples of a series in the order they were appended to the
+// WAL, one request at a time, since a series is always sent by the same
+// shard and shards retry requests until they succeed or are refused. So once
+// an endpoint stored a sample, the samples of the same series appended
+// before it were either stored or refused. The relay tracks the samples
+// appended to the WAL which each endpoint didn't store yet, by series, to
+// know the timestamp up to which it stored every sample.
+type relay struct {
+	srv   *http.Server
+	url   string
+	token string
+
+	mut sync.Mutex
+	// queues holds the queues by path. The path of a queue changes when it's
+	// recreated, so that the requests of the previous queue don't affect the
+	// tracking of the new one.
+	queues map[string]*relayQueue
+	// current holds the path of the current queue of each endpoint.
+	current map[string]string
+	// failures holds the metrics of queues counting the data they didn't
+	// send.
+	failures *queueFailures
+}
+
+// relayQueue tracks the samples of a queue which the endpoint didn't store
+// yet.
+type relayQueue struct {
+	name             string
+	url              string
+	client           *http.Client
+	retryOnRateLimit bool
+
+	// hash identifies the config of the queue, which is recreated by the
+	// remote storage when it changes.
+	hash           string
+	externalLabels labels.Labels
+	relabelConfigs []*relabel.Config
+	sendHistograms bool
+	// start is the time the queue was created. Queues only send the samples
+	// more recent than the time they started.
+	start int64
+
+	// series holds the series sent by the queue, by hash of their labels in
+	// the WAL, or nil for the series dropped by relabeling. sent holds the
+	// same series by hash of the labels sent to the endpoint.
+	series map[uint64]*relaySeries
+	sent   map[uint64]*relaySeries
+	// highest is the highest timestamp appended to the WAL which the queue
+	// sends, or math.MinInt64 if none was appended since it was created.
+	highest int64
+	// refused is the lowest timestamp of the data which the endpoint refused
+	// or which the queue dropped, and which is only resent after a restart.
+	refused int64
+	// failed is the number of samples and histograms of the requests which
+	// the endpoint refused, which the queue counts in failedMetrics.
+	failed float64
+}
+
+// relaySeries holds the samples of a series which the endpoint didn't store
+// yet, in the order they were appended, as runs of increasing timestamps.
+type relaySeries struct {
+	walHash, sentHash uint64
+	runs              []relayRun
+	// used tells whether samples were appended since positions was last
+	// called, to forget the series which aren't used anymore.
+	used bool
+}
+
+// relayRun is a range of timestamps of samples appended to the WAL, in
+// increasing order.
+type relayRun struct {
+	lo, hi int64
+}
+
+// appendedSample is a sample or histogram appended to the WAL.
+type appendedSample struct {
+	labels    labels.Labels
+	t         int64
+	histogram bool
+}
+
+// newRelay starts a relay listening on the loopback interface, for the
+// queues of the remote storage whose metrics are registered to failures.
+func newRelay(failures *queueFailures) (*relay, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate relay token: %w", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for queue requests: %w", err)
+	}
+
+	r := &relay{
+		url:      "http://" + ln.Addr().String(),
+		token:    hex.EncodeToString(token),
+		queues:   make(map[string]*relayQueue),
+		current:  make(map[string]string),
+		failures: failures,
+	}
+	r.srv = &http.Server{Handler: r}
+	go func() { _ = r.srv.Serve(ln) }()
+	return r, nil
+}
+
+// configure forwards the requests of the queue name to rw, and returns the
+// config of the queue, which sends its requests to the relay. It also
+// returns whether the remote storage recreates the queue, in which case the
+// samples of the queue more recent than start are tracked from now on.
+func (r *relay) configure(name string, rw *config.RemoteWriteConfig, externalLabels labels.Labels, start int64) (*config.RemoteWriteConfig, bool, error) {
+	client, err := remote.NewWriteClient(name, &remote.ClientConfig{
+		URL:              rw.URL,
+		Timeout:          rw.RemoteTimeout,
+		HTTPClientConfig: rw.HTTPClientConfig,
+		SigV4Config:      rw.SigV4Config,
+		AzureADConfig:    rw.AzureADConfig,
+		Headers:          rw.Headers,
+		RetryOnRateLimit: rw.QueueConfig.RetryOnRateLimit,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	hash, err := configHash(rw, externalLabels)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	path, ok := r.current[name]
+	q := r.queues[path]
+	recreated := !ok || q.hash != hash
+	if recreated {
+		// The path is part of the config of the queue, so it only changes
+		// when the queue is recreated anyway.
+		gen := 0
+		if ok {
+			gen, _ = strconv.Atoi(path[strings.LastIndexByte(path, '/')+1:])
+			gen++
+		}
+		path = url.PathEscape(name) + "/" + strconv.Itoa(gen)
+		q = &relayQueue{
+			name:           name,
+			hash:           hash,
+			externalLabels: externalLabels,
+			relabelConfigs: rw.WriteRelabelConfigs,
+			sendHistograms: rw.SendNativeHistograms,
+			start:          start,
+			series:         make(map[uint64]*relaySeries),
+			sent:           make(map[uint64]*relaySeries),
+			highest:        math.MinInt64,
+			refused:        math.MaxInt64,
+		}
+		r.queues[path] = q
+		r.current[name] = path
+	}
+	// The client is updated even if the queue isn't recreated, since the
+	// hash of the config doesn't include secrets.
+	q.url = rw.URL.String()
+	q.client = client.(*remote.Client).Client
+	q.retryOnRateLimit = rw.QueueConfig.RetryOnRateLimit
+
+	u, err := url.Parse(r.url + "/" + path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The name is set explicitly, since the name of queues without a name is
+	// a hash of their config.
+	relayed := *rw
+	relayed.Name = name
+	relayed.URL = &common.URL{URL: u}
+	relayed.HTTPClientConfig = common.DefaultHTTPClientConfig
+	relayed.HTTPClientConfig.Authorization = &common.Authorization{
+		Type:        "Bearer",
+		Credentials: common.Secret(r.token),
+	}
+	relayed.SigV4Config = nil
+	relayed.AzureADConfig = nil
+	relayed.Headers = nil
+	return &relayed, recreated, nil
+}
+
+// configHash returns a hash identifying the config of the queue of rw with
+// externalLabels, which the remote storage recreates when it changes.
+func configHash(rw *config.RemoteWriteConfig, externalLabels labels.Labels) (string, error) {
+	buf, err := yaml.Marshal(rw)
+	if err != nil {
+		return "", err
+	}
+	hash := md5.Sum(append(buf, externalLabels.String()...))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// retain stops tracking the queues which aren't the current queue of an
+// endpoint in queues. The requests of the queues which aren't tracked are
+// refused.
+func (r *relay) retain(queues map[string]*config.RemoteWriteConfig) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for name := range r.current {
+		if _, ok := queues[name]; !ok {
+			delete(r.current, name)
+		}
+	}
+	for path, q := range r.queues {
+		if r.current[q.name] != path {
+			delete(r.queues, path)
+		}
+	}
+}
+
+// appended tracks the samples appended to the WAL, which must be called
+// before they're written to it.
+func (r *relay) appended(samples []appendedSample) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for _, path := range r.current {
+		q := r.queues[path]
+		for _, s := range samples {
+			if s.t <= q.start || (s.histogram && !q.sendHistograms) {
+				continue
+			}
+			series := q.seriesOf(s.labels)
+			if series == nil {
+				continue
+			}
+
+			series.used = true
+			if n := len(series.runs); n > 0 && series.runs[n-1].hi < s.t {
+				series.runs[n-1].hi = s.t
+			} else {
+				series.runs = append(series.runs, relayRun{lo: s.t, hi: s.t})
+			}
+			q.highest = max(q.highest, s.t)
+		}
+	}
+}
+
+// seriesOf returns the series of the queue with the labels lbls in the WAL,
+// or nil if the queue doesn't send it.
+func (q *relayQueue) seriesOf(lbls labels.Labels) *relaySeries {
+	walHash := lbls.Hash()
+	if s, ok := q.series[walHash]; ok {
+		return s
+	}
+
+	var s *relaySeries
+	if sent, keep := queueLabels(lbls.WithoutEmpty(), q.externalLabels, q.relabelConfigs); keep {
+		s = &relaySeries{walHash: walHash, sentHash: sent.Hash()}
+		q.sent[s.sentHash] = s
+	}
+	q.series[walHash] = s
+	return s
+}
+
+// stored untracks the samples which the endpoint stored with the request
+// req, and the samples of the same series appended before them.
+func (q *relayQueue) stored(req *prompb.WriteRequest) {
+	var b labels.ScratchBuilder
+	for _, ts := range req.Timeseries {
+		b.Reset()
+		for _, l := range ts.Labels {
+			b.Add(l.Name, l.Value)
+		}
+		b.Sort()
+		s, ok := q.sent[b.Labels().Hash()]
+		if !ok {
+			continue
+		}
+
+		for _, sample := range ts.Samples {
+			s.stored(sample.Timestamp)
+		}
+		for _, h := range ts.Histograms {
+			s.stored(h.Timestamp)
+		}
+	}
+}
+
+// stored untracks the sample with timestamp t, and the samples appended
+// before it. Samples with the same timestamp can be appended more than once,
+// so t is assumed to be the first sample with this timestamp, which might
+// keep tracking samples which were stored, but never untracks samples which
+// weren't.
+func (s *relaySeries) stored(t int64) {
+	for i, run := range s.runs {
+		if run.lo <= t && t <= run.hi {
+			s.runs = s.runs[i:]
+			if t == run.hi {
+				s.runs = s.runs[1:]
+			} else {
+				s.runs[0].lo = t + 1
+			}
+			return
+		}
+	}
+}
+
+// position returns the timestamp up to which the endpoint stored every
+// sample, and false if no sample was appended since the queue was created.
+func (q *relayQueue) position() (int64, bool) {
+	if q.highest == math.MinInt64 {
+		return 0, false
+	}
+
+	pos := q.highest
+	for _, s := range q.sent {
+		for _, run := range s.runs {
+			pos = min(pos, run.lo-1)
+		}
+	}
+	return max(min(pos, q.refused-1), 0), true
+}
+
+// positions returns the timestamp up to which the current queue of each
+// endpoint stored every sample, for the queues which tracked samples.
+func (r *relay) positions() map[string]int64 {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	res := make(map[string]int64, len(r.current))
+	for name, path := range r.current {
+		q := r.queues[path]
+		if pos, ok := q.position(); ok {
+			res[name] = pos
+		}
+
+		// Forget the series which the endpoint stored and which aren't
+		// appended to anymore.
+		for hash, s := range q.series {
+			switch {
+			case s == nil:
+				delete(q.series, hash)
+			case len(s.runs) == 0 && !s.used:
+				delete(q.series, hash)
+				delete(q.sent, s.sentHash)
+			default:
+				s.used = false
+			}
+		}
+	}
+	return res
+}
+
+// close stops the relay.
+func (r *relay) close() error {
+	return r.srv.Close()
+}
+
+// ServeHTTP implements http.Handler.
+func (r *relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	auth := []byte(req.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(auth, []byte("Bearer "+r.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.EscapedPath(), "/")
+	r.mut.Lock()
+	q, ok := r.queues[path]
+	if !ok {
+		r.mut.Unlock()
+		http.Error(w, fmt.Sprintf("unknown queue %q", path), http.StatusNotFound)
+		return
+	}
+	target, client := q.url, q.client
+	r.mut.Unlock()
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Requests which aren't write requests are only forwarded.
+	wr, err := remote.DecodeWriteRequest(bytes.NewReader(body))
+	tracked := err == nil
+
+	forward(req.Context(), w, req.Header, client, target, body, func(status int) {
+		if !tracked {
+			return
+		}
+
+		r.mut.Lock()
+		defer r.mut.Unlock()
+		switch {
+		case status/100 == 2:
+		case status == http.StatusBadRequest:
+			// Samples rejected by the endpoint, for example because they're
+			// out of order, wouldn't be stored if they were resent. The queue
+			// still counts them as failed.
+			q.failed += float64(countSamples(wr))
+		case status/100 == 5 || (q.retryOnRateLimit && status == http.StatusTooManyRequests):
+			// Queues retry the request, unless they're stopped, in which
+			// case the data is resent after a restart.
+			return
+		default:
+			q.failed += float64(countSamples(wr))
+			if mint, ok := minTimestamp(wr); ok {
+				q.refused = min(q.refused, mint)
+			}
+			return
+		}
+
+		// The queue of the current path can drop data when it's resharded
+		// and fails to flush it in time, which is only told by the metrics
+		// counting failed data. The data is dropped before the next samples
+		// of the same series are sent, so it's checked before untracking
+		// samples.
+		if r.current[q.name] == path {
+			if failed := r.failures.count(q.name); failed > q.failed {
+				pos, _ := q.position()
+				q.refused = min(q.refused, pos+1)
+				q.failed = failed
+			}
+		}
+		q.stored(wr)
+	})
+}
+
+// forward sends the request body with header to target, calls done with the
+// status code of the response, or 0 if the request can't be sent, and then
+// writes the response to w.
+func forward(ctx context.Context, w http.ResponseWriter, header http.Header, client *http.Client, target string, body []byte, done func(status int)) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		done(0)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, name := range relayedHeaders {
+		if value := header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Network errors are retried by queues.
+		done(http.StatusBadGateway)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	// The request is accounted for before the queue gets the response, so
+	// that the failed data counted by the queue is never ahead of the relay.
+	done(resp.StatusCode)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// countSamples returns the number of samples and histograms of req.
+func countSamples(req *prompb.WriteRequest) int {
+	n := 0
+	for _, ts := range req.Timeseries {
+		n += len(ts.Samples) + len(ts.Histograms)
+	}
+	return n
+}
+
+// minTimestamp returns the lowest timestamp of the samples and histograms of
+// req, and false if it has none.
+func minTimestamp(req *prompb.WriteRequest) (int64, bool) {
+	mint := int64(math.MaxInt64)
+	for _, ts := range req.Timeseries {
+		for _, s := range ts.Samples {
+			mint = min(mint, s.Timestamp)
+		}
+		for _, h := range ts.Histograms {
+			mint = min(mint, h.Timestamp)
+		}
+	}
+	return mint, mint != math.MaxInt64
+}
+
+// queueFailures keeps the failedMetrics of the queues of a remote storage.
+type queueFailures struct {
+	mut        sync.Mutex
+	collectors map[string][]prometheus_client.Collector
+}
+
+func newQueueFailures() *queueFailures {
+	return &queueFailures{collectors: make(map[string][]prometheus_client.Collector)}
+}
+
+// count returns the number of samples and histograms which the queue name
+// counted as failed.
+func (f *queueFailures) count(name string) float64 {
+	f.mut.Lock()
+	cs := f.collectors[name]
+	f.mut.Unlock()
+
+	var total float64
+	for _, c := range cs {
+		ch := make(chan prometheus_client.Metric, 1)
+		c.Collect(ch)
+		close(ch)
+		for metric := range ch {
+			var m dto.Metric
+			if metric.Write(&m) == nil {
+				total += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+// registerer returns a prometheus.Registerer registering the metrics of a
+// remote storage to reg, which keeps the failedMetrics of its queues.
+func (f *queueFailures) registerer(reg prometheus_client.Registerer) prometheus_client.Registerer {
+	return &failuresRegisterer{Registerer: reg, f: f}
+}
+
+// failuresRegisterer keeps the failedMetrics of queues registered to it.
+type failuresRegisterer struct {
+	prometheus_client.Registerer
+	f *queueFailures
+}
+
+// Register implements prometheus.Registerer.
+func (fr *failuresRegisterer) Register(c prometheus_client.Collector) error {
+	if err := fr.Registerer.Register(c); err != nil {
+		return err
+	}
+	if name, ok := failedMetricQueue(c); ok {
+		fr.f.mut.Lock()
+		fr.f.collectors[name] = append(fr.f.collectors[name], c)
+		fr.f.mut.Unlock()
+	}
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (fr *failuresRegisterer) MustRegister(cs ...prometheus_client.Collector) {
+	for _, c := range cs {
+		if err := fr.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements prometheus.Registerer.
+func (fr *failuresRegisterer) Unregister(c prometheus_client.Collector) bool {
+	if name, ok := failedMetricQueue(c); ok {
+		fr.f.mut.Lock()
+		cs := fr.f.collectors[name]
+		for i := range cs {
+			if cs[i] == c {
+				fr.f.collectors[name] = append(cs[:i:i], cs[i+1:]...)
+				break
+			}
+		}
+		fr.f.mut.Unlock()
+	}
+	return fr.Registerer.Unregister(c)
+}
+
+// failedMetricQueue returns the name of the queue of c if it's one of the
+// failedMetrics.
+func failedMetricQueue(c prometheus_client.Collector) (string, bool) {
+	descs := make(chan *prometheus_client.Desc, 1)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	var isFailed bool
+	for d := range descs {
+		for _, name := range failedMetrics {
+			isFailed = isFailed || strings.HasPrefix(d.String(), fmt.Sprintf("Desc{fqName: %q,", name))
+		}
+	}
+	if !isFailed {
+		return "", false
+	}
+
+	ch := make(chan prometheus_client.Metric, 1)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var name string
+	for metric := range ch {
+		var m dto.Metric
+		if metric.Write(&m) != nil {
+			continue
+		}
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == "remote_name" {
+				name = lp.GetValue()
+			}
+		}
+	}
+	return name, name != ""
+}
@@ -0,0 +1,169 @@
+package remotewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	common "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// TestRelay ensures that the position of an endpoint is held back by the
+// samples it didn't store.
+func TestRelay(t *testing.T) {
+	var (
+		status  atomic.Int64
+		headers = make(chan http.Header, 100)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	failures := newQueueFailures()
+	failed := prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name:        "prometheus_remote_storage_samples_failed_total",
+		ConstLabels: prometheus_client.Labels{"remote_name": "test", "url": "local"},
+	})
+	failures.registerer(prometheus_client.NewRegistry()).MustRegister(failed)
+
+	r, err := newRelay(failures)
+	require.NoError(t, err)
+	defer r.close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	rw := config.DefaultRemoteWriteConfig
+	rw.URL = &common.URL{URL: u}
+	rw.Headers = map[string]string{"X-Scope-OrgID": "tenant"}
+	drop := relabel.DefaultRelabelConfig
+	drop.SourceLabels = model.LabelNames{"__name__"}
+	drop.Regex = relabel.MustNewRegexp("dropped")
+	drop.Action = relabel.Drop
+	rw.WriteRelabelConfigs = []*relabel.Config{&drop}
+	externalLabels := labels.FromStrings("cluster", "local")
+
+	relayed, recreated, err := r.configure("test", &rw, externalLabels, 0)
+	require.NoError(t, err)
+	require.True(t, recreated)
+	require.Equal(t, "test", relayed.Name)
+	require.Empty(t, relayed.Headers)
+
+	// Requests without the token of the relay are refused.
+	resp, err := http.Post(relayed.URL.String(), "application/x-protobuf", strings.NewReader(""))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	client, err := remote.NewWriteClient("test", &remote.ClientConfig{
+		URL:              relayed.URL,
+		Timeout:          model.Duration(time.Second),
+		HTTPClientConfig: relayed.HTTPClientConfig,
+	})
+	require.NoError(t, err)
+
+	appended := func(name string, ts ...int64) {
+		var samples []appendedSample
+		for _, t := range ts {
+			samples = append(samples, appendedSample{labels: labels.FromStrings("__name__", name), t: t})
+		}
+		r.appended(samples)
+	}
+	batch := func(name string, ts ...int64) []byte {
+		series := prompb.TimeSeries{Labels: []prompb.Label{
+			{Name: "__name__", Value: name},
+			{Name: "cluster", Value: "local"},
+		}}
+		for _, t := range ts {
+			series.Samples = append(series.Samples, prompb.Sample{Timestamp: t, Value: 1})
+		}
+		buf, err := (&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{series}}).Marshal()
+		require.NoError(t, err)
+		return snappy.Encode(nil, buf)
+	}
+	store := func(code int, req []byte, attempt int) error {
+		status.Store(int64(code))
+		err := client.Store(context.Background(), req, attempt)
+		h := <-headers
+		require.Equal(t, "tenant", h.Get("X-Scope-OrgID"))
+		require.Empty(t, h.Get("Authorization"))
+		return err
+	}
+	position := func() int64 {
+		return r.positions()["test"]
+	}
+
+	// The position is only known once samples are appended.
+	require.Empty(t, r.positions())
+	appended("foo", 1000, 2000)
+	require.Equal(t, int64(999), position())
+	require.NoError(t, store(http.StatusNoContent, batch("foo", 1000, 2000), 0))
+	require.Equal(t, int64(2000), position())
+
+	// Samples being retried hold back the position, while the samples of
+	// other series are stored.
+	appended("foo", 3000)
+	appended("bar", 3500)
+	appended("foo", 4000)
+	retried := batch("foo", 3000, 4000)
+	require.Error(t, store(http.StatusServiceUnavailable, retried, 0))
+	require.NoError(t, store(http.StatusNoContent, batch("bar", 3500), 0))
+	require.Equal(t, int64(2999), position())
+	require.NoError(t, store(http.StatusNoContent, retried, 1))
+	require.Equal(t, int64(4000), position())
+
+	// Series dropped by relabeling aren't tracked.
+	appended("dropped", 4500)
+	require.Equal(t, int64(4000), position())
+
+	// Storing a sample means that the samples appended before it were
+	// handled, even if they're more recent.
+	appended("foo", 6000, 5000)
+	require.Equal(t, int64(4999), position())
+	require.NoError(t, store(http.StatusNoContent, batch("foo", 6000, 5000), 0))
+	require.Equal(t, int64(6000), position())
+
+	// Rejected samples count as acknowledged.
+	appended("foo", 7000)
+	require.Error(t, store(http.StatusBadRequest, batch("foo", 7000), 0))
+	require.Equal(t, int64(7000), position())
+	failed.Inc()
+
+	// Samples dropped by the queue hold back the position until a restart.
+	appended("foo", 8000, 9000)
+	failed.Inc()
+	require.NoError(t, store(http.StatusNoContent, batch("foo", 9000), 0))
+	require.Equal(t, int64(7999), position())
+
+	// Recreating the queue tracks its samples from scratch.
+	relayed2, recreated, err := r.configure("test", &rw, externalLabels, 0)
+	require.NoError(t, err)
+	require.False(t, recreated)
+	require.Equal(t, relayed.URL.String(), relayed2.URL.String())
+	rw.RemoteTimeout = model.Duration(time.Minute)
+	relayed2, recreated, err = r.configure("test", &rw, externalLabels, 10000)
+	require.NoError(t, err)
+	require.True(t, recreated)
+	require.NotEqual(t, relayed.URL.String(), relayed2.URL.String())
+	require.Empty(t, r.positions())
+	appended("foo", 10000, 11000)
+	require.Equal(t, int64(10999), position())
+
+	r.retain(nil)
+	require.Empty(t, r.positions())
+}
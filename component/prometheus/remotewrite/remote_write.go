@@ -3,7 +3,6 @@ package remotewrite
 import (
 	"context"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -23,8 +22,8 @@ import (
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/internal/useragent"
 	"github.com/grafana/agent/pkg/flow/logging/level"
-	"github.com/grafana/agent/pkg/metrics/wal"
-	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/grafana/agent/pkg/util"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/storage/remote"
 )
@@ -34,6 +33,10 @@ import (
 // TODO(rfratto): This should be exposed. How do we want to expose this?
 var remoteFlushDeadline = 1 * time.Minute
 
+// idleTenantsCheckFrequency is how often the pipelines of idle tenants are
+// looked for.
+var idleTenantsCheckFrequency = 1 * time.Minute
+
 func init() {
 	remote.UserAgent = useragent.Get()
 
@@ -52,14 +55,32 @@ func init() {
 type Component struct {
 	log  log.Logger
 	opts component.Options
+	ls   labelstore.LabelStore
 
-	walStore    *wal.Storage
-	remoteStore *remote.Storage
-	storage     storage.Storage
-	exited      atomic.Bool
+	exited atomic.Bool
 
 	mut sync.RWMutex
 	cfg Arguments
+	// pipelines holds the pipeline of each tenant. The pipeline of series
+	// without a tenant has an empty key.
+	pipelines map[string]*pipeline
+	// pending holds the tenants whose pipeline is being created or closed,
+	// with a channel closed once it's done. Pipelines are created and closed
+	// without holding mut, since it takes a while.
+	pending map[string]chan struct{}
+	// cfgVersion is incremented by each Update, to tell whether pipelines
+	// created concurrently used the latest config.
+	cfgVersion int
+	// pipelineSeq is incremented for each pipeline of a tenant, so that the
+	// pipeline of a tenant which is recreated after being idle doesn't use
+	// the ref IDs of the previous one in the label store.
+	pipelineSeq int
+
+	// tenantRegistry holds the metrics of the pipelines of tenants, which have
+	// a tenant label unlike the metrics of the pipeline of series without a
+	// tenant.
+	tenantRegistry *prometheus_client.Registry
+	metrics        *tenantMetrics
 
 	receiver *prometheus.Interceptor
 }
@@ -75,85 +96,79 @@ func New(o component.Options, c Arguments) (*Component, error) {
 	oldDataPath := filepath.Join(o.DataPath, "wal", o.ID)
 	_ = os.RemoveAll(oldDataPath)
 
-	walLogger := log.With(o.Logger, "subcomponent", "wal")
-	walStorage, err := wal.NewStorage(walLogger, o.Registerer, o.DataPath)
+	service, err := o.GetServiceData(labelstore.ServiceName)
 	if err != nil {
 		return nil, err
 	}
+	ls := service.(labelstore.LabelStore)
 
-	remoteLogger := log.With(o.Logger, "subcomponent", "rw")
-	remoteStore := remote.NewStorage(remoteLogger, o.Registerer, startTime, o.DataPath, remoteFlushDeadline, nil)
-
-	service, err := o.GetServiceData(labelstore.ServiceName)
+	metrics, err := newTenantMetrics(o.Registerer)
 	if err != nil {
 		return nil, err
 	}
-	ls := service.(labelstore.LabelStore)
+	tenantRegistry := prometheus_client.NewRegistry()
+	if err := o.Registerer.Register(util.NewUncheckedCollector(tenantRegistry)); err != nil {
+		return nil, err
+	}
 
 	res := &Component{
-		log:         o.Logger,
-		opts:        o,
-		walStore:    walStorage,
-		remoteStore: remoteStore,
-		storage:     storage.NewFanout(o.Logger, walStorage, remoteStore),
+		log:            o.Logger,
+		opts:           o,
+		ls:             ls,
+		pipelines:      make(map[string]*pipeline),
+		pending:        make(map[string]chan struct{}),
+		tenantRegistry: tenantRegistry,
+		metrics:        metrics,
 	}
+
+	res.pipelines[""], err = newPipeline(o.Logger, o.Registerer, o.DataPath, "", o.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reopen the WAL of tenants seen before a restart, so that their unsent
+	// data is replayed.
+	tenants, err := existingTenants(o.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, tenant := range tenants {
+		res.pipelines[tenant], err = res.newTenantPipeline(tenant, res.nextRefKey(tenant))
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.metrics.tenants.Set(float64(res.tenantsCount()))
+
+	// Series are appended through tenantAppendable, which routes them to the
+	// pipeline of their tenant and translates their global ref IDs.
 	res.receiver = prometheus.NewInterceptor(
-		res.storage,
+		tenantAppendable{c: res},
 		ls,
 
-		// In the methods below, conversion is needed because remote_writes assume
-		// they are responsible for generating ref IDs. This means two
-		// remote_writes may return the same ref ID for two different series. We
-		// treat the remote_write ID as a "local ID" and translate it to a "global
-		// ID" to ensure Flow compatibility.
-
 		prometheus.WithAppendHook(func(globalRef storage.SeriesRef, l labels.Labels, t int64, v float64, next storage.Appender) (storage.SeriesRef, error) {
 			if res.exited.Load() {
 				return 0, fmt.Errorf("%s has exited", o.ID)
 			}
-
-			localID := ls.GetLocalRefID(res.opts.ID, uint64(globalRef))
-			newRef, nextErr := next.Append(storage.SeriesRef(localID), l, t, v)
-			if localID == 0 {
-				ls.GetOrAddLink(res.opts.ID, uint64(newRef), l)
-			}
-			return globalRef, nextErr
+			return next.Append(globalRef, l, t, v)
 		}),
 		prometheus.WithHistogramHook(func(globalRef storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram, next storage.Appender) (storage.SeriesRef, error) {
 			if res.exited.Load() {
 				return 0, fmt.Errorf("%s has exited", o.ID)
 			}
-
-			localID := ls.GetLocalRefID(res.opts.ID, uint64(globalRef))
-			newRef, nextErr := next.AppendHistogram(storage.SeriesRef(localID), l, t, h, fh)
-			if localID == 0 {
-				ls.GetOrAddLink(res.opts.ID, uint64(newRef), l)
-			}
-			return globalRef, nextErr
+			return next.AppendHistogram(globalRef, l, t, h, fh)
 		}),
 		prometheus.WithMetadataHook(func(globalRef storage.SeriesRef, l labels.Labels, m metadata.Metadata, next storage.Appender) (storage.SeriesRef, error) {
 			if res.exited.Load() {
 				return 0, fmt.Errorf("%s has exited", o.ID)
 			}
-
-			localID := ls.GetLocalRefID(res.opts.ID, uint64(globalRef))
-			newRef, nextErr := next.UpdateMetadata(storage.SeriesRef(localID), l, m)
-			if localID == 0 {
-				ls.GetOrAddLink(res.opts.ID, uint64(newRef), l)
-			}
-			return globalRef, nextErr
+			return next.UpdateMetadata(globalRef, l, m)
 		}),
 		prometheus.WithExemplarHook(func(globalRef storage.SeriesRef, l labels.Labels, e exemplar.Exemplar, next storage.Appender) (storage.SeriesRef, error) {
 			if res.exited.Load() {
 				return 0, fmt.Errorf("%s has exited", o.ID)
 			}
-
-			localID := ls.GetLocalRefID(res.opts.ID, uint64(globalRef))
-			newRef, nextErr := next.AppendExemplar(storage.SeriesRef(localID), l, e)
-			if localID == 0 {
-				ls.GetOrAddLink(res.opts.ID, uint64(newRef), l)
-			}
-			return globalRef, nextErr
+			return next.AppendExemplar(globalRef, l, e)
 		}),
 	)
 
@@ -167,77 +182,289 @@ func New(o component.Options, c Arguments) (*Component, error) {
 	return res, nil
 }
 
+// newTenantPipeline creates the pipeline of tenant, with its own WAL and
+// metrics. refKey must be returned by nextRefKey.
+func (c *Component) newTenantPipeline(tenant, refKey string) (*pipeline, error) {
+	reg := prometheus_client.WrapRegistererWith(prometheus_client.Labels{"tenant": tenant}, c.tenantRegistry)
+	return newPipeline(c.log, reg, tenantDir(c.opts.DataPath, tenant), tenant, refKey)
+}
+
+// nextRefKey returns the key identifying a new pipeline of tenant in the
+// label store. It must be called with mut held.
+func (c *Component) nextRefKey(tenant string) string {
+	c.pipelineSeq++
+	return fmt.Sprintf("%s/%s/%d", c.opts.ID, tenant, c.pipelineSeq)
+}
+
+// tenantsCount returns the number of tenants with a pipeline, including the
+// ones being created or closed. It must be called with mut held.
+func (c *Component) tenantsCount() int {
+	n := len(c.pipelines) + len(c.pending)
+	if _, ok := c.pipelines[""]; ok {
+		n--
+	}
+	return n
+}
+
+// pipelineFor returns the pipeline of the series with labels l, creating the
+// pipeline of its tenant if needed. It returns nil if the series must be
+// dropped, because its tenant is invalid or max_tenants is reached.
+func (c *Component) pipelineFor(l labels.Labels) (*pipeline, error) {
+	c.mut.RLock()
+	tenant := c.cfg.DefaultTenant
+	if c.cfg.TenantLabel != "" {
+		if value := l.Get(c.cfg.TenantLabel); value != "" {
+			tenant = value
+		}
+	}
+	p, ok := c.pipelines[tenant]
+	if ok {
+		// Idle pipelines are removed while holding the write lock, so the
+		// pipeline can't be removed once it's marked as used.
+		p.touch()
+	}
+	c.mut.RUnlock()
+
+	if ok {
+		return p, nil
+	}
+	if err := validateTenant(tenant); err != nil {
+		level.Debug(c.log).Log("msg", "dropping series with invalid tenant", "series", l, "err", err)
+		c.metrics.invalidTenantSamples.Inc()
+		return nil, nil
+	}
+	return c.createPipeline(tenant)
+}
+
+// createPipeline returns the pipeline of tenant, creating it if it doesn't
+// exist. Opening the WAL of a tenant and starting its queues is slow, so it's
+// done without holding mut; series of the same tenant wait for it, while
+// other tenants aren't blocked.
+func (c *Component) createPipeline(tenant string) (*pipeline, error) {
+	c.mut.Lock()
+	for {
+		if p, ok := c.pipelines[tenant]; ok {
+			p.touch()
+			c.mut.Unlock()
+			return p, nil
+		}
+		done, ok := c.pending[tenant]
+		if !ok {
+			break
+		}
+		c.mut.Unlock()
+		<-done
+		c.mut.Lock()
+	}
+
+	if c.exited.Load() {
+		c.mut.Unlock()
+		return nil, fmt.Errorf("%s has exited", c.opts.ID)
+	}
+	if max := c.cfg.MaxTenants; max > 0 && c.tenantsCount() >= max {
+		c.mut.Unlock()
+		level.Debug(c.log).Log("msg", "dropping series of new tenant, max_tenants reached", "tenant", tenant, "max_tenants", max)
+		c.metrics.tenantLimitSamples.Inc()
+		return nil, nil
+	}
+
+	done := make(chan struct{})
+	c.pending[tenant] = done
+	cfg, cfgVersion, refKey := c.cfg, c.cfgVersion, c.nextRefKey(tenant)
+	c.mut.Unlock()
+
+	level.Info(c.log).Log("msg", "creating WAL and queues for new tenant", "tenant", tenant)
+	p, err := c.newTenantPipeline(tenant, refKey)
+	if err != nil {
+		err = fmt.Errorf("failed to create WAL of tenant %q: %w", tenant, err)
+	} else if err = p.applyConfig(cfg); err != nil {
+		_ = p.close()
+		err = fmt.Errorf("failed to create queues of tenant %q: %w", tenant, err)
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	delete(c.pending, tenant)
+	close(done)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run closes the pipelines once it exited, and Update applies the config
+	// to the pipelines which exist, so catch up with both.
+	if c.exited.Load() {
+		_ = p.close()
+		return nil, fmt.Errorf("%s has exited", c.opts.ID)
+	}
+	if c.cfgVersion != cfgVersion {
+		if err := p.applyConfig(c.cfg); err != nil {
+			_ = p.close()
+			return nil, fmt.Errorf("failed to create queues of tenant %q: %w", tenant, err)
+		}
+	}
+
+	c.pipelines[tenant] = p
+	c.metrics.tenants.Set(float64(c.tenantsCount()))
+	return p, nil
+}
+
+// removeIdleTenants closes the pipelines of the tenants which didn't receive
+// any series for tenant_idle_timeout. Their WAL is deleted, unless in durable
+// mode where it's kept for the unacknowledged data to be resent once the
+// tenant is back or on restart.
+func (c *Component) removeIdleTenants() {
+	c.mut.Lock()
+	timeout := c.cfg.TenantIdleTimeout
+	durable := c.cfg.WALOptions.Durable
+	if timeout == 0 {
+		c.mut.Unlock()
+		return
+	}
+
+	var (
+		idleSince = time.Now().Add(-timeout).UnixNano()
+		idle      []*pipeline
+	)
+	for tenant, p := range c.pipelines {
+		if tenant == "" || p.lastAppend.Load() > idleSince {
+			continue
+		}
+		// The tenant stays pending while its pipeline is closed, so that it
+		// isn't recreated in the same directory meanwhile.
+		delete(c.pipelines, tenant)
+		c.pending[tenant] = make(chan struct{})
+		idle = append(idle, p)
+	}
+	c.mut.Unlock()
+
+	for _, p := range idle {
+		level.Info(c.log).Log("msg", "closing WAL and queues of idle tenant", "tenant", p.tenant)
+		if err := p.close(); err != nil {
+			level.Error(c.log).Log("msg", "error when closing storage", "tenant", p.tenant, "err", err)
+		}
+		if !durable {
+			if err := os.RemoveAll(p.dir); err != nil {
+				level.Warn(c.log).Log("msg", "failed to delete WAL of idle tenant", "tenant", p.tenant, "err", err)
+			}
+		}
+
+		c.mut.Lock()
+		close(c.pending[p.tenant])
+		delete(c.pending, p.tenant)
+		c.metrics.tenants.Set(float64(c.tenantsCount()))
+		c.mut.Unlock()
+	}
+}
+
 func startTime() (int64, error) { return 0, nil }
 
-var _ component.Component = (*Component)(nil)
+var (
+	_ component.Component = (*Component)(nil)
+	_ component.Drainer   = (*Component)(nil)
+)
 
 // Run implements Component.
 func (c *Component) Run(ctx context.Context) error {
-	defer func() {
-		c.exited.Store(true)
+	defer c.closePipelines()
 
-		level.Debug(c.log).Log("msg", "closing storage")
-		err := c.storage.Close()
-		level.Debug(c.log).Log("msg", "storage closed")
-		if err != nil {
-			level.Error(c.log).Log("msg", "error when closing storage", "err", err)
-		}
-	}()
-
-	// Track the last timestamp we truncated for to prevent segments from getting
-	// deleted until at least some new data has been sent.
-	var lastTs = int64(math.MinInt64)
+	truncateTimer := time.NewTimer(c.truncateFrequency())
+	defer truncateTimer.Stop()
+	savePositionsTicker := time.NewTicker(savePositionsFrequency)
+	defer savePositionsTicker.Stop()
+	idleTenantsTicker := time.NewTicker(idleTenantsCheckFrequency)
+	defer idleTenantsTicker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.After(c.truncateFrequency()):
-			// We retrieve the current min/max keepalive time at once, since
-			// retrieving them separately could lead to issues where we have an older
-			// value for min which is now larger than max.
+		case <-savePositionsTicker.C:
+			for _, p := range c.currentPipelines() {
+				p.savePositions()
+			}
+		case <-idleTenantsTicker.C:
+			c.removeIdleTenants()
+		case <-truncateTimer.C:
+			// We retrieve the current WAL options at once, since retrieving
+			// them separately could lead to issues where we have an older value
+			// for min which is now larger than max.
 			c.mut.RLock()
-			var (
-				minWALTime = c.cfg.WALOptions.MinKeepaliveTime
-				maxWALTime = c.cfg.WALOptions.MaxKeepaliveTime
-			)
+			opts := c.cfg.WALOptions
 			c.mut.RUnlock()
 
-			// The timestamp ts is used to determine which series are not receiving
-			// samples and may be deleted from the WAL. Their most recent append
-			// timestamp is compared to ts, and if that timestamp is older than ts,
-			// they are considered inactive and may be deleted.
-			//
-			// Subtracting a duration from ts will delay when it will be considered
-			// inactive and scheduled for deletion.
-			ts := c.remoteStore.LowestSentTimestamp() - minWALTime.Milliseconds()
-			if ts < 0 {
-				ts = 0
+			for _, p := range c.currentPipelines() {
+				l := c.log
+				if p.tenant != "" {
+					l = log.With(l, "tenant", p.tenant)
+				}
+				p.truncate(l, opts)
 			}
+			truncateTimer.Reset(c.truncateFrequency())
+		}
+	}
+}
 
-			// Network issues can prevent the result of LowestSentTimestamp from
-			// changing. We don't want data in the WAL to grow forever, so we set a cap
-			// on the maximum age data can be. If our ts is older than this cutoff point,
-			// we'll shift it forward to start deleting very stale data.
-			if maxTS := timestamp.FromTime(time.Now().Add(-maxWALTime)); ts < maxTS {
-				ts = maxTS
-			}
+// Drain implements component.Drainer. It closes the WAL and queues of every
+// tenant, which sends the samples held by queues for up to the flush
+// deadline. Samples received after Drain was called are rejected.
+//
+// If ctx is canceled first, Drain returns while the queues keep sending in
+// the background until the flush deadline.
+func (c *Component) Drain(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		c.closePipelines()
+	}()
 
-			if ts == lastTs {
-				level.Debug(c.log).Log("msg", "not truncating the WAL, remote_write timestamp is unchanged", "ts", ts)
-				continue
-			}
-			lastTs = ts
-
-			level.Debug(c.log).Log("msg", "truncating the WAL", "ts", ts)
-			err := c.walStore.Truncate(ts)
-			if err != nil {
-				// The only issue here is larger disk usage and a greater replay time,
-				// so we'll only log this as a warning.
-				level.Warn(c.log).Log("msg", "could not truncate WAL", "err", err)
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closePipelines rejects new samples and closes the pipelines of the
+// component. Pipelines are closed in parallel and without holding mut, since
+// each of them waits for its queues to flush. Calling it more than once is a
+// no-op.
+func (c *Component) closePipelines() {
+	c.exited.Store(true)
+
+	c.mut.Lock()
+	pipelines := c.pipelines
+	c.pipelines = make(map[string]*pipeline)
+	c.mut.Unlock()
+	if len(pipelines) == 0 {
+		return
+	}
+
+	level.Debug(c.log).Log("msg", "closing storage")
+	var wg sync.WaitGroup
+	for tenant, p := range pipelines {
+		wg.Add(1)
+		go func(tenant string, p *pipeline) {
+			defer wg.Done()
+			if err := p.close(); err != nil {
+				level.Error(c.log).Log("msg", "error when closing storage", "tenant", tenant, "err", err)
 			}
-		}
+		}(tenant, p)
+	}
+	wg.Wait()
+	level.Debug(c.log).Log("msg", "storage closed")
+}
+
+// currentPipelines returns the pipelines of the component.
+func (c *Component) currentPipelines() []*pipeline {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	pipelines := make([]*pipeline, 0, len(c.pipelines))
+	for _, p := range c.pipelines {
+		pipelines = append(pipelines, p)
 	}
+	return pipelines
 }
 
 func (c *Component) truncateFrequency() time.Duration {
@@ -253,15 +480,13 @@ func (c *Component) Update(newConfig component.Arguments) error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	convertedConfig, err := convertConfigs(cfg)
-	if err != nil {
-		return err
-	}
-	err = c.remoteStore.ApplyConfig(convertedConfig)
-	if err != nil {
-		return err
+	for _, p := range c.pipelines {
+		if err := p.applyConfig(cfg); err != nil {
+			return err
+		}
 	}
 
 	c.cfg = cfg
+	c.cfgVersion++
 	return nil
 }
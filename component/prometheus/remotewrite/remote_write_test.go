@@ -181,6 +181,71 @@ func TestUpdate(t *testing.T) {
 	}})
 }
 
+func TestTenantLabel(t *testing.T) {
+	type tenantRequest struct {
+		tenant string
+		req    *prompb.WriteRequest
+	}
+	writeResult := make(chan tenantRequest, 10)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := remote.DecodeWriteRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult <- tenantRequest{tenant: r.Header.Get("X-Scope-OrgID"), req: req}
+	}))
+	defer srv.Close()
+
+	args := testArgsForConfig(t, fmt.Sprintf(`
+		tenant_label = "team"
+
+		endpoint {
+			url            = "%s/api/v1/write"
+			remote_timeout = "100ms"
+			headers        = {
+				"X-Scope-OrgID" = "static",
+			}
+
+			queue_config {
+				batch_send_deadline = "100ms"
+			}
+		}
+	`, srv.URL))
+	tc, err := componenttest.NewControllerFromID(util.TestLogger(t), "prometheus.remote_write")
+	require.NoError(t, err)
+	go func() {
+		err = tc.Run(componenttest.TestContext(t), args)
+		require.NoError(t, err)
+	}()
+	require.NoError(t, tc.WaitRunning(5*time.Second))
+
+	sampleTimestamp := time.Now().Add(time.Minute).UnixMilli()
+	sendMetric(t, tc, labels.FromStrings("__name__", "a", "team", "team-a"), sampleTimestamp, 1)
+	sendMetric(t, tc, labels.FromStrings("__name__", "b", "team", "team-b"), sampleTimestamp, 2)
+	sendMetric(t, tc, labels.FromStrings("__name__", "c"), sampleTimestamp, 3)
+	// Series with an invalid tenant are dropped.
+	sendMetric(t, tc, labels.FromStrings("__name__", "d", "team", "team/d"), sampleTimestamp, 4)
+
+	received := make(map[string][]string)
+	for len(received) < 3 {
+		select {
+		case <-time.After(time.Minute):
+			require.FailNow(t, "timed out waiting for metrics")
+		case res := <-writeResult:
+			for _, ts := range res.req.Timeseries {
+				received[res.tenant] = append(received[res.tenant], ts.Labels[0].Value)
+			}
+		}
+	}
+	require.Equal(t, map[string][]string{
+		"team-a": {"a"},
+		"team-b": {"b"},
+		"static": {"c"},
+	}, received)
+}
+
 func assertReceived(t *testing.T, writeResult chan *prompb.WriteRequest, expect []prompb.TimeSeries) {
 	select {
 	case <-time.After(time.Minute):
@@ -0,0 +1,530 @@
+package remotewrite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/pkg/metrics/wal"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/hashicorp/go-multierror"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+	"go.uber.org/atomic"
+)
+
+const (
+	// tenantHeader is the header setting the tenant of remote_write requests.
+	tenantHeader = "X-Scope-OrgID"
+
+	// tenantsDirectory is the subdirectory of the data path holding the WAL of
+	// each tenant.
+	tenantsDirectory = "tenants"
+
+	// maxTenantLength is the maximum length of tenant IDs accepted by Mimir
+	// and Cortex.
+	maxTenantLength = 150
+)
+
+// pipeline is a WAL and the remote storage sending its samples to the
+// endpoints. The component has a pipeline for series without a tenant, and
+// one pipeline per tenant when tenant_label is set, so that each tenant has
+// its own queues.
+type pipeline struct {
+	// tenant sent in the X-Scope-OrgID header of requests. It's empty for the
+	// pipeline of series without a tenant, which only use the static headers
+	// of endpoints.
+	tenant string
+	// refKey identifies the pipeline in the label store, which maps global ref
+	// IDs to the ref IDs of its WAL.
+	refKey string
+	logger log.Logger
+	dir    string
+
+	walStore    *wal.Storage
+	remoteStore *remote.Storage
+	storage     storage.Storage
+
+	// registry holds the metrics of the WAL, of the remote storage, which
+	// tell the highest timestamp appended to it, and the durable mode
+	// metrics.
+	registry    *prometheus_client.Registry
+	collector   *util.UncheckedCollector
+	reg         prometheus_client.Registerer
+	backlog     *backlogCollector
+	truncations *prometheus_client.CounterVec
+
+	// lastAppend is the time, in nanoseconds, the pipeline was last used to
+	// append series.
+	lastAppend atomic.Int64
+
+	// Track the last timestamp we truncated for to prevent segments from
+	// getting deleted until at least some new data has been sent.
+	lastTruncateTs int64
+
+	// startTs is the time the WAL was opened.
+	startTs int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// positions holds the timestamp up to which each endpoint, identified by
+	// the name of its queue, acknowledged data. catchUps holds the endpoints
+	// which are resending data their queue didn't send, because it was
+	// appended before the queue started. In durable mode, queues send their
+	// requests through relay, which tracks the samples endpoints stored, and
+	// failures holds the metrics of queues counting the data they didn't
+	// send.
+	posMut    sync.Mutex
+	durable   bool
+	relay     *relay
+	failures  *queueFailures
+	queues    map[string]*config.RemoteWriteConfig
+	positions map[string]int64
+	catchUps  map[string]*catchUp
+}
+
+func newPipeline(l log.Logger, reg prometheus_client.Registerer, dir, tenant, refKey string) (*pipeline, error) {
+	if tenant != "" {
+		l = log.With(l, "tenant", tenant)
+	}
+
+	positions, err := loadPositions(dir)
+	if err != nil {
+		level.Warn(l).Log("msg", "ignoring positions of endpoints", "err", err)
+		positions = make(map[string]int64)
+	}
+
+	// The metrics of the pipeline are hidden once it's closed, so that the
+	// pipeline of a tenant can be recreated with the same metrics.
+	registry := prometheus_client.NewRegistry()
+	collector := util.NewUncheckedCollector(registry)
+	if err := reg.Register(collector); err != nil {
+		return nil, err
+	}
+
+	walLogger := log.With(l, "subcomponent", "wal")
+	walStorage, err := wal.NewStorage(walLogger, registry, dir)
+	if err != nil {
+		collector.SetCollector(nil)
+		return nil, err
+	}
+	truncations := prometheus_client.NewCounterVec(prometheus_client.CounterOpts{
+		Name: "prometheus_remote_write_durable_truncations_total",
+		Help: "Total number of WAL truncations deleting data which endpoints didn't acknowledge, by limit.",
+	}, []string{"reason"})
+	registry.MustRegister(truncations)
+
+	remoteLogger := log.With(l, "subcomponent", "rw")
+	failures := newQueueFailures()
+	remoteStore := remote.NewStorage(remoteLogger, failures.registerer(registry), startTime, dir, remoteFlushDeadline, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pipeline{
+		tenant:         tenant,
+		refKey:         refKey,
+		logger:         l,
+		dir:            dir,
+		walStore:       walStorage,
+		remoteStore:    remoteStore,
+		storage:        storage.NewFanout(l, walStorage, remoteStore),
+		registry:       registry,
+		collector:      collector,
+		reg:            reg,
+		truncations:    truncations,
+		lastTruncateTs: math.MinInt64,
+		startTs:        timestamp.FromTime(time.Now()),
+		ctx:            ctx,
+		cancel:         cancel,
+		failures:       failures,
+		positions:      positions,
+		catchUps:       make(map[string]*catchUp),
+	}
+	p.touch()
+
+	p.backlog = newBacklogCollector(p)
+	if err := reg.Register(p.backlog); err != nil {
+		_ = p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// applyConfig applies the endpoints of cfg to the remote storage, setting the
+// tenant header of requests. In durable mode, the data which the queues
+// started by the remote storage don't send, because it was appended before
+// they started, is resent from the position of their endpoint.
+func (p *pipeline) applyConfig(cfg Arguments) error {
+	convertedConfig, err := convertConfigs(cfg)
+	if err != nil {
+		return err
+	}
+	externalLabels := convertedConfig.GlobalConfig.ExternalLabels
+
+	if p.tenant != "" {
+		for _, rw := range convertedConfig.RemoteWriteConfigs {
+			headers := make(map[string]string, len(rw.Headers)+1)
+			for name, value := range rw.Headers {
+				if !strings.EqualFold(name, tenantHeader) {
+					headers[name] = value
+				}
+			}
+			headers[tenantHeader] = p.tenant
+			rw.Headers = headers
+		}
+	}
+
+	p.posMut.Lock()
+	r, started := p.relay, p.queues != nil
+	p.posMut.Unlock()
+	if cfg.WALOptions.Durable && r == nil {
+		if r, err = newRelay(p.failures); err != nil {
+			return err
+		}
+		p.posMut.Lock()
+		p.relay = r
+		p.posMut.Unlock()
+	}
+	if started {
+		// Update the positions of endpoints with the data stored by their
+		// queues, before the queues which are recreated stop.
+		p.ackedPositions()
+	}
+
+	var (
+		start     = timestamp.FromTime(time.Now())
+		queues    = make(map[string]*config.RemoteWriteConfig, len(convertedConfig.RemoteWriteConfigs))
+		recreated = make(map[string]bool)
+	)
+	for i, rw := range convertedConfig.RemoteWriteConfigs {
+		name, err := queueName(rw)
+		if err != nil {
+			return err
+		}
+		queues[name] = rw
+
+		if cfg.WALOptions.Durable {
+			var ok bool
+			if convertedConfig.RemoteWriteConfigs[i], ok, err = r.configure(name, rw, externalLabels, start); err != nil {
+				return err
+			}
+			recreated[name] = ok
+		}
+	}
+
+	if err := p.remoteStore.ApplyConfig(convertedConfig); err != nil {
+		return err
+	}
+
+	p.posMut.Lock()
+	defer p.posMut.Unlock()
+
+	p.queues = queues
+	p.durable = cfg.WALOptions.Durable
+	for name, cu := range p.catchUps {
+		if !p.durable || recreated[name] || queues[name] == nil {
+			cu.cancel()
+			delete(p.catchUps, name)
+		}
+	}
+	if !p.durable {
+		// Queues don't use the relay anymore.
+		if p.relay != nil {
+			_ = p.relay.close()
+			p.relay = nil
+		}
+		// Positions are only persisted in durable mode, so drop the stale ones.
+		p.positions = make(map[string]int64)
+		return removePositions(p.dir)
+	}
+	p.relay.retain(queues)
+	p.startCatchUps(recreated, externalLabels)
+	return nil
+}
+
+// truncate deletes the data of the WAL which has been sent or is older than
+// max_keepalive_time. In durable mode, it deletes the data which every
+// endpoint acknowledged instead.
+func (p *pipeline) truncate(l log.Logger, opts WALOptions) {
+	if opts.Durable {
+		p.truncateDurable(l, opts)
+		return
+	}
+
+	// The timestamp ts is used to determine which series are not receiving
+	// samples and may be deleted from the WAL. Their most recent append
+	// timestamp is compared to ts, and if that timestamp is older than ts,
+	// they are considered inactive and may be deleted.
+	//
+	// Subtracting a duration from ts will delay when it will be considered
+	// inactive and scheduled for deletion.
+	ts := p.remoteStore.LowestSentTimestamp() - opts.MinKeepaliveTime.Milliseconds()
+	if ts < 0 {
+		ts = 0
+	}
+
+	// Network issues can prevent the result of LowestSentTimestamp from
+	// changing. We don't want data in the WAL to grow forever, so we set a cap
+	// on the maximum age data can be. If our ts is older than this cutoff point,
+	// we'll shift it forward to start deleting very stale data.
+	if maxTS := timestamp.FromTime(time.Now().Add(-opts.MaxKeepaliveTime)); ts < maxTS {
+		ts = maxTS
+	}
+
+	if ts == p.lastTruncateTs {
+		level.Debug(l).Log("msg", "not truncating the WAL, remote_write timestamp is unchanged", "ts", ts)
+		return
+	}
+	p.lastTruncateTs = ts
+
+	level.Debug(l).Log("msg", "truncating the WAL", "ts", ts)
+	err := p.walStore.Truncate(ts)
+	if err != nil {
+		// The only issue here is larger disk usage and a greater replay time,
+		// so we'll only log this as a warning.
+		level.Warn(l).Log("msg", "could not truncate WAL", "err", err)
+	}
+}
+
+// appender returns an appender of the storage of the pipeline, which tracks
+// the samples appended to the WAL in durable mode.
+func (p *pipeline) appender(ctx context.Context) storage.Appender {
+	app := p.storage.Appender(ctx)
+
+	p.posMut.Lock()
+	r := p.relay
+	p.posMut.Unlock()
+	if r == nil {
+		return app
+	}
+	return &trackingAppender{Appender: app, relay: r}
+}
+
+// touch marks the pipeline as used.
+func (p *pipeline) touch() {
+	p.lastAppend.Store(time.Now().UnixNano())
+}
+
+// close stops the catch-ups of the pipeline, closes its storage, and
+// persists the positions of endpoints in durable mode once queues flushed
+// their data.
+func (p *pipeline) close() error {
+	p.cancel()
+	p.wg.Wait()
+
+	p.reg.Unregister(p.backlog)
+	err := p.storage.Close()
+	p.savePositions()
+	if p.relay != nil {
+		_ = p.relay.close()
+	}
+	p.collector.SetCollector(nil)
+	return err
+}
+
+// validateTenant returns an error if tenant isn't a valid tenant ID, which
+// can also be used as a directory name.
+func validateTenant(tenant string) error {
+	switch {
+	case tenant == "":
+		return fmt.Errorf("tenant ID is empty")
+	case len(tenant) > maxTenantLength:
+		return fmt.Errorf("tenant ID %q is longer than %d characters", tenant, maxTenantLength)
+	case tenant == "." || tenant == "..":
+		return fmt.Errorf("tenant ID %q is not allowed", tenant)
+	}
+
+	for _, r := range tenant {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!-_.*'()", r):
+		default:
+			return fmt.Errorf("tenant ID %q contains unsupported character %q", tenant, r)
+		}
+	}
+	return nil
+}
+
+// tenantDir returns the directory of the WAL of tenant.
+func tenantDir(dataPath, tenant string) string {
+	return filepath.Join(dataPath, tenantsDirectory, tenant)
+}
+
+// existingTenants returns the tenants which have a WAL in dataPath, so that
+// their unsent data is replayed on startup.
+func existingTenants(dataPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataPath, tenantsDirectory))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tenants []string
+	for _, e := range entries {
+		if e.IsDir() && validateTenant(e.Name()) == nil {
+			tenants = append(tenants, e.Name())
+		}
+	}
+	return tenants, nil
+}
+
+// tenantAppendable is the storage.Appendable of the component, which routes
+// series to the pipeline of their tenant.
+type tenantAppendable struct {
+	c *Component
+}
+
+// Appender implements storage.Appendable.
+func (a tenantAppendable) Appender(ctx context.Context) storage.Appender {
+	return &tenantAppender{
+		ctx:       ctx,
+		c:         a.c,
+		appenders: make(map[*pipeline]storage.Appender),
+	}
+}
+
+// tenantAppender appends series to the pipeline of their tenant, opening an
+// appender per pipeline.
+//
+// Refs passed to and returned by tenantAppender are global ref IDs, which are
+// translated to the ref IDs of the WAL of each pipeline. Pipelines assign ref
+// IDs independently, so the label store tracks the mapping for each of them.
+type tenantAppender struct {
+	ctx       context.Context
+	c         *Component
+	appenders map[*pipeline]storage.Appender
+}
+
+var _ storage.Appender = (*tenantAppender)(nil)
+
+// appender returns the pipeline of the series with labels l, and its
+// appender. It returns a nil pipeline if the series must be dropped.
+func (a *tenantAppender) appender(l labels.Labels) (*pipeline, storage.Appender, error) {
+	p, err := a.c.pipelineFor(l)
+	if p == nil || err != nil {
+		return nil, nil, err
+	}
+
+	app, ok := a.appenders[p]
+	if !ok {
+		app = p.appender(a.ctx)
+		a.appenders[p] = app
+	}
+	return p, app, nil
+}
+
+// appendWith appends the series with labels l to its pipeline using f, and
+// links the ref ID of the series in its WAL to globalRef.
+func (a *tenantAppender) appendWith(globalRef storage.SeriesRef, l labels.Labels, f func(localRef storage.SeriesRef, app storage.Appender) (storage.SeriesRef, error)) (storage.SeriesRef, error) {
+	p, app, err := a.appender(l)
+	if err != nil {
+		return 0, err
+	} else if p == nil {
+		return globalRef, nil
+	}
+
+	ls := a.c.ls
+	localID := ls.GetLocalRefID(p.refKey, uint64(globalRef))
+	newRef, err := f(storage.SeriesRef(localID), app)
+	if localID == 0 {
+		ls.GetOrAddLink(p.refKey, uint64(newRef), l)
+	}
+	return globalRef, err
+}
+
+// Append implements storage.Appender.
+func (a *tenantAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	return a.appendWith(ref, l, func(localRef storage.SeriesRef, app storage.Appender) (storage.SeriesRef, error) {
+		return app.Append(localRef, l, t, v)
+	})
+}
+
+// AppendExemplar implements storage.Appender.
+func (a *tenantAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	return a.appendWith(ref, l, func(localRef storage.SeriesRef, app storage.Appender) (storage.SeriesRef, error) {
+		return app.AppendExemplar(localRef, l, e)
+	})
+}
+
+// AppendHistogram implements storage.Appender.
+func (a *tenantAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	return a.appendWith(ref, l, func(localRef storage.SeriesRef, app storage.Appender) (storage.SeriesRef, error) {
+		return app.AppendHistogram(localRef, l, t, h, fh)
+	})
+}
+
+// UpdateMetadata implements storage.Appender.
+func (a *tenantAppender) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
+	return a.appendWith(ref, l, func(localRef storage.SeriesRef, app storage.Appender) (storage.SeriesRef, error) {
+		return app.UpdateMetadata(localRef, l, m)
+	})
+}
+
+// Commit implements storage.Appender.
+func (a *tenantAppender) Commit() error {
+	var multiErr error
+	for _, app := range a.appenders {
+		if err := app.Commit(); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
+// Rollback implements storage.Appender.
+func (a *tenantAppender) Rollback() error {
+	var multiErr error
+	for _, app := range a.appenders {
+		if err := app.Rollback(); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+	return multiErr
+}
+
+// tenantMetrics are metrics on the routing of series to tenants.
+type tenantMetrics struct {
+	tenants              prometheus_client.Gauge
+	invalidTenantSamples prometheus_client.Counter
+	tenantLimitSamples   prometheus_client.Counter
+}
+
+func newTenantMetrics(reg prometheus_client.Registerer) (*tenantMetrics, error) {
+	m := &tenantMetrics{
+		tenants: prometheus_client.NewGauge(prometheus_client.GaugeOpts{
+			Name: "prometheus_remote_write_tenants",
+			Help: "Number of tenants with their own WAL and queues.",
+		}),
+		invalidTenantSamples: prometheus_client.NewCounter(prometheus_client.CounterOpts{
+			Name: "prometheus_remote_write_invalid_tenant_samples_total",
+			Help: "Total number of samples, exemplars and metadata dropped because the value of their tenant label isn't a valid tenant ID.",
+		}),
+		tenantLimitSamples: prometheus_client.NewCounter(prometheus_client.CounterOpts{
+			Name: "prometheus_remote_write_tenant_limit_samples_total",
+			Help: "Total number of samples, exemplars and metadata of new tenants dropped because max_tenants was reached.",
+		}),
+	}
+
+	for _, c := range []prometheus_client.Collector{m.tenants, m.invalidTenantSamples, m.tenantLimitSamples} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
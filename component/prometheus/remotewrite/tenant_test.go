@@ -0,0 +1,188 @@
+package remotewrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	writeResult := make(chan *prompb.WriteRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := remote.DecodeWriteRequest(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResult <- req
+	}))
+	defer srv.Close()
+
+	// The sample is only sent when the component is drained, since the batch
+	// is never full or old enough to be sent otherwise.
+	c := newTestComponent(t, fmt.Sprintf(`
+		endpoint {
+			url = "%s/api/v1/write"
+
+			queue_config {
+				batch_send_deadline = "1h"
+			}
+		}
+	`, srv.URL))
+
+	p := c.pipelines[""]
+	appendSample(t, c, labels.FromStrings("__name__", "a"))
+	require.Eventually(t, func() bool {
+		return gatherGauge(t, p.registry, "prometheus_remote_storage_samples_pending") == 1
+	}, 30*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, c.Drain(ctx))
+
+	select {
+	case req := <-writeResult:
+		require.Len(t, req.Timeseries, 1)
+	default:
+		require.FailNow(t, "pending sample wasn't sent when draining")
+	}
+
+	// Samples received after the component was drained are rejected.
+	app := c.receiver.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings("__name__", "b"), time.Now().UnixMilli(), 1)
+	require.Error(t, err)
+}
+
+func TestMaxTenants(t *testing.T) {
+	c := newTenantTestComponent(t, `
+		tenant_label = "team"
+		max_tenants  = 1
+	`)
+
+	appendSample(t, c, labels.FromStrings("__name__", "a", "team", "team-a"))
+	appendSample(t, c, labels.FromStrings("__name__", "b", "team", "team-b"))
+	// Series without a tenant don't count against the limit.
+	appendSample(t, c, labels.FromStrings("__name__", "c"))
+
+	c.mut.RLock()
+	require.Len(t, c.pipelines, 2)
+	require.Contains(t, c.pipelines, "team-a")
+	c.mut.RUnlock()
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.tenants))
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.tenantLimitSamples))
+}
+
+func TestIdleTenants(t *testing.T) {
+	defer func(frequency time.Duration) { idleTenantsCheckFrequency = frequency }(idleTenantsCheckFrequency)
+	idleTenantsCheckFrequency = 10 * time.Millisecond
+
+	c := newTenantTestComponent(t, `
+		tenant_label        = "team"
+		tenant_idle_timeout = "100ms"
+	`)
+
+	appendSample(t, c, labels.FromStrings("__name__", "a", "team", "team-a"))
+	dir := tenantDir(c.opts.DataPath, "team-a")
+	require.DirExists(t, dir)
+
+	require.Eventually(t, func() bool {
+		c.mut.RLock()
+		defer c.mut.RUnlock()
+		_, ok := c.pipelines["team-a"]
+		return !ok && len(c.pending) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err := os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+	require.Equal(t, 0.0, testutil.ToFloat64(c.metrics.tenants))
+
+	// The pipeline of the tenant is recreated once it's back.
+	appendSample(t, c, labels.FromStrings("__name__", "a", "team", "team-a"))
+	require.DirExists(t, dir)
+	require.Equal(t, 1.0, testutil.ToFloat64(c.metrics.tenants))
+}
+
+// newTenantTestComponent runs a prometheus.remote_write component with the
+// arguments cfg, sending to an endpoint which accepts every request.
+func newTenantTestComponent(t *testing.T, cfg string) *Component {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	return newTestComponent(t, fmt.Sprintf(`
+		%s
+		endpoint {
+			url = "%s/api/v1/write"
+		}
+	`, cfg, srv.URL))
+}
+
+// newTestComponent runs a prometheus.remote_write component with the
+// arguments cfg.
+func newTestComponent(t *testing.T, cfg string) *Component {
+	var args Arguments
+	require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+
+	ls := labelstore.New(nil)
+	c, err := New(component.Options{
+		ID:            "prometheus.remote_write.test",
+		Logger:        util.TestFlowLogger(t),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prometheus_client.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, args)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return c
+}
+
+func gatherGauge(t *testing.T, g prometheus_client.Gatherer, name string) float64 {
+	mfs, err := g.Gather()
+	require.NoError(t, err)
+
+	var sum float64
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			sum += m.GetGauge().GetValue()
+		}
+	}
+	return sum
+}
+
+// appendSample appends a sample of the series l. Queues only send samples
+// more recent than when they started, so the sample is in the future.
+func appendSample(t *testing.T, c *Component, l labels.Labels) {
+	app := c.receiver.Appender(context.Background())
+	_, err := app.Append(0, l, time.Now().Add(time.Minute).UnixMilli(), 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+}
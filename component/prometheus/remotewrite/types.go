@@ -6,6 +6,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/alecthomas/units"
 	types "github.com/grafana/agent/component/common/config"
 	flow_relabel "github.com/grafana/agent/component/common/relabel"
 	"github.com/grafana/river/rivertypes"
@@ -23,7 +24,9 @@ import (
 // Defaults for config blocks.
 var (
 	DefaultArguments = Arguments{
-		WALOptions: DefaultWALOptions,
+		WALOptions:        DefaultWALOptions,
+		MaxTenants:        100,
+		TenantIdleTimeout: time.Hour,
 	}
 
 	DefaultQueueOptions = QueueOptions{
@@ -56,6 +59,20 @@ type Arguments struct {
 	ExternalLabels map[string]string  `river:"external_labels,attr,optional"`
 	Endpoints      []*EndpointOptions `river:"endpoint,block,optional"`
 	WALOptions     WALOptions         `river:"wal,block,optional"`
+
+	// TenantLabel is the label holding the tenant of series. Each tenant has
+	// its own WAL and queues, sending requests with the X-Scope-OrgID header.
+	TenantLabel string `river:"tenant_label,attr,optional"`
+	// DefaultTenant is the tenant of series without a tenant label. Series
+	// without a tenant are sent with the headers of endpoints only.
+	DefaultTenant string `river:"default_tenant,attr,optional"`
+	// MaxTenants is the maximum number of tenants with their own WAL and
+	// queues. Series of new tenants over the limit are dropped. Zero means no
+	// limit.
+	MaxTenants int `river:"max_tenants,attr,optional"`
+	// TenantIdleTimeout is the time after which the WAL and queues of a tenant
+	// which didn't receive any series are closed. Zero means never.
+	TenantIdleTimeout time.Duration `river:"tenant_idle_timeout,attr,optional"`
 }
 
 // SetToDefault implements river.Defaulter.
@@ -63,6 +80,25 @@ func (rc *Arguments) SetToDefault() {
 	*rc = DefaultArguments
 }
 
+// Validate implements river.Validator.
+func (rc *Arguments) Validate() error {
+	if rc.TenantLabel != "" && !model.LabelName(rc.TenantLabel).IsValid() {
+		return fmt.Errorf("invalid tenant_label %q", rc.TenantLabel)
+	}
+	if rc.DefaultTenant != "" {
+		if err := validateTenant(rc.DefaultTenant); err != nil {
+			return fmt.Errorf("invalid default_tenant: %w", err)
+		}
+	}
+	if rc.MaxTenants < 0 {
+		return fmt.Errorf("max_tenants must not be negative")
+	}
+	if rc.TenantIdleTimeout < 0 {
+		return fmt.Errorf("tenant_idle_timeout must not be negative")
+	}
+	return nil
+}
+
 // EndpointOptions describes an individual location for where metrics in the WAL
 // should be delivered to using the remote_write protocol.
 type EndpointOptions struct {
@@ -199,6 +235,13 @@ type WALOptions struct {
 	TruncateFrequency time.Duration `river:"truncate_frequency,attr,optional"`
 	MinKeepaliveTime  time.Duration `river:"min_keepalive_time,attr,optional"`
 	MaxKeepaliveTime  time.Duration `river:"max_keepalive_time,attr,optional"`
+
+	// Durable keeps data in the WAL until every endpoint acknowledged it,
+	// within the limits of MaxSize and MaxAge, and resends data which wasn't
+	// acknowledged before a restart.
+	Durable bool             `river:"durable,attr,optional"`
+	MaxSize units.Base2Bytes `river:"max_size,attr,optional"`
+	MaxAge  time.Duration    `river:"max_age,attr,optional"`
 }
 
 // SetToDefault implements river.Defaulter.
@@ -213,6 +256,12 @@ func (o *WALOptions) Validate() error {
 		return fmt.Errorf("truncate_frequency must not be 0")
 	case o.MaxKeepaliveTime <= o.MinKeepaliveTime:
 		return fmt.Errorf("min_keepalive_time must be smaller than max_keepalive_time")
+	case o.MaxSize < 0:
+		return fmt.Errorf("max_size must not be negative")
+	case o.MaxAge < 0:
+		return fmt.Errorf("max_age must not be negative")
+	case !o.Durable && (o.MaxSize != 0 || o.MaxAge != 0):
+		return fmt.Errorf("max_size and max_age can only be set when durable is true")
 	}
 
 	return nil
@@ -278,3 +278,54 @@ func TestRiverConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestArguments_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         string
+		expectedErr string
+	}{{
+		name: "valid tenancy",
+		cfg: `
+			tenant_label   = "team"
+			default_tenant = "default"
+		`,
+	}, {
+		name:        "invalid tenant label",
+		cfg:         `tenant_label = "team-name"`,
+		expectedErr: `invalid tenant_label "team-name"`,
+	}, {
+		name:        "invalid default tenant",
+		cfg:         `default_tenant = "../tenant"`,
+		expectedErr: `invalid default_tenant: tenant ID "../tenant" contains unsupported character '/'`,
+	}, {
+		name: "valid durable WAL",
+		cfg: `
+			wal {
+				durable  = true
+				max_size = "10GiB"
+				max_age  = "24h"
+			}
+		`,
+	}, {
+		name: "limits without durable WAL",
+		cfg: `
+			wal {
+				max_size = "10GiB"
+			}
+		`,
+		expectedErr: `max_size and max_age can only be set when durable is true`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var args Arguments
+			err := river.Unmarshal([]byte(tc.cfg), &args)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/rules"
+)
+
+// DebugInfo holds the state of the rule groups of the component.
+type DebugInfo struct {
+	Groups []DebugGroup `river:"group,block,optional" json:"groups"`
+}
+
+// DebugGroup holds the state of a rule group.
+type DebugGroup struct {
+	Name           string        `river:"name,attr" json:"name"`
+	Interval       time.Duration `river:"interval,attr" json:"interval"`
+	LastEvaluation time.Time     `river:"last_evaluation,attr,optional" json:"lastEvaluation"`
+	EvaluationTime time.Duration `river:"evaluation_time,attr,optional" json:"evaluationTime"`
+	Rules          []DebugRule   `river:"rule,block,optional" json:"rules"`
+}
+
+// DebugRule holds the state of a recording or alerting rule.
+type DebugRule struct {
+	Name      string       `river:"name,attr" json:"name"`
+	Type      string       `river:"type,attr" json:"type"` // "recording" or "alerting".
+	Query     string       `river:"query,attr" json:"query"`
+	Health    string       `river:"health,attr" json:"health"`
+	LastError string       `river:"last_error,attr,optional" json:"lastError,omitempty"`
+	State     string       `river:"state,attr,optional" json:"state,omitempty"` // State of alerting rules.
+	Alerts    []DebugAlert `river:"alert,block,optional" json:"alerts,omitempty"`
+}
+
+// DebugAlert holds the state of an active alert.
+type DebugAlert struct {
+	Labels      map[string]string `river:"labels,attr" json:"labels"`
+	Annotations map[string]string `river:"annotations,attr,optional" json:"annotations,omitempty"`
+	State       string            `river:"state,attr" json:"state"`
+	ActiveAt    time.Time         `river:"active_at,attr" json:"activeAt"`
+	Value       float64           `river:"value,attr" json:"value"`
+}
+
+// DebugInfo implements component.DebugComponent.
+func (c *Component) DebugInfo() interface{} {
+	var info DebugInfo
+	for _, g := range c.manager.RuleGroups() {
+		group := DebugGroup{
+			Name:           g.Name(),
+			Interval:       g.Interval(),
+			LastEvaluation: g.GetLastEvaluation(),
+			EvaluationTime: g.GetEvaluationTime(),
+		}
+		for _, r := range g.Rules() {
+			group.Rules = append(group.Rules, debugRule(r))
+		}
+		info.Groups = append(info.Groups, group)
+	}
+	sort.Slice(info.Groups, func(i, j int) bool {
+		return info.Groups[i].Name < info.Groups[j].Name
+	})
+	return info
+}
+
+func debugRule(r rules.Rule) DebugRule {
+	rule := DebugRule{
+		Name:   r.Name(),
+		Type:   "recording",
+		Query:  r.Query().String(),
+		Health: string(r.Health()),
+	}
+	if err := r.LastError(); err != nil {
+		rule.LastError = err.Error()
+	}
+
+	if ar, ok := r.(*rules.AlertingRule); ok {
+		rule.Type = "alerting"
+		rule.State = ar.State().String()
+		for _, a := range ar.ActiveAlerts() {
+			rule.Alerts = append(rule.Alerts, DebugAlert{
+				Labels:      a.Labels.Map(),
+				Annotations: a.Annotations.Map(),
+				State:       a.State.String(),
+				ActiveAt:    a.ActiveAt,
+				Value:       a.Value,
+			})
+		}
+	}
+	return rule
+}
+
+// Handler implements http_service.Component. It serves the state of the rule
+// groups as JSON from /rules, and the active alerts from /alerts.
+func (c *Component) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := c.DebugInfo().(DebugInfo)
+
+		var resp any
+		switch strings.Trim(r.URL.Path, "/") {
+		case "rules":
+			resp = info
+		case "alerts":
+			alerts := []DebugAlert{}
+			for _, g := range info.Groups {
+				for _, rule := range g.Rules {
+					alerts = append(alerts, rule.Alerts...)
+				}
+			}
+			resp = struct {
+				Alerts []DebugAlert `json:"alerts"`
+			}{alerts}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,320 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	http_service "github.com/grafana/agent/service/http"
+	"github.com/grafana/agent/service/labelstore"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:          "prometheus.rules",
+		Args:          Arguments{},
+		Exports:       Exports{},
+		NeedsServices: []string{labelstore.ServiceName},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return New(opts, args.(Arguments))
+		},
+	})
+}
+
+// rulesIdentifier identifies the rules of the component in the rule manager,
+// which expects rule groups to be loaded from files.
+const rulesIdentifier = "rules"
+
+// truncateInterval is how often samples older than the retention are removed
+// from the storage.
+const truncateInterval = time.Minute
+
+// queryTimeout is the maximum duration of the evaluation of a rule.
+const queryTimeout = 2 * time.Minute
+
+// Arguments holds values which are used to configure the prometheus.rules
+// component.
+type Arguments struct {
+	// Where the results of rules are forwarded to.
+	ForwardTo []storage.Appendable `river:"forward_to,attr"`
+
+	// Rule groups in the Prometheus rule file format.
+	Rules string `river:"rules,attr"`
+
+	EvaluationInterval time.Duration     `river:"evaluation_interval,attr,optional"`
+	Retention          time.Duration     `river:"retention,attr,optional"`
+	MaxSeries          int               `river:"max_series,attr,optional"`
+	ExternalLabels     map[string]string `river:"external_labels,attr,optional"`
+}
+
+// DefaultArguments holds the default settings of prometheus.rules.
+var DefaultArguments = Arguments{
+	EvaluationInterval: time.Minute,
+	Retention:          time.Hour,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *Arguments) SetToDefault() {
+	*args = DefaultArguments
+}
+
+// Validate implements river.Validator.
+func (args *Arguments) Validate() error {
+	if args.EvaluationInterval <= 0 {
+		return fmt.Errorf("evaluation_interval must be greater than 0")
+	}
+	if args.Retention <= 0 {
+		return fmt.Errorf("retention must be greater than 0")
+	}
+	if args.MaxSeries < 0 {
+		return fmt.Errorf("max_series must not be negative")
+	}
+	if _, errs := rulefmt.Parse([]byte(args.Rules)); len(errs) > 0 {
+		return fmt.Errorf("invalid rules: %w", errs[0])
+	}
+	return nil
+}
+
+// Exports holds values which are exported by the prometheus.rules component.
+type Exports struct {
+	Receiver storage.Appendable `river:"receiver,attr"`
+}
+
+// Component implements the prometheus.rules component.
+type Component struct {
+	opts    component.Options
+	storage *headStorage
+	fanout  *prometheus.Fanout
+	manager *rules.Manager
+	loader  *groupLoader
+	cancel  context.CancelFunc
+
+	onUpdate chan struct{}
+
+	mut  sync.RWMutex
+	args Arguments
+}
+
+var (
+	_ component.Component      = (*Component)(nil)
+	_ component.DebugComponent = (*Component)(nil)
+	_ http_service.Component   = (*Component)(nil)
+)
+
+// New creates a new prometheus.rules component.
+func New(o component.Options, args Arguments) (*Component, error) {
+	data, err := o.GetServiceData(labelstore.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+	ls := data.(labelstore.LabelStore)
+
+	rejected := prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_rules_samples_rejected_total",
+		Help: "Total number of samples which couldn't be stored for rule evaluation, such as out-of-order samples.",
+	})
+	if err := o.Registerer.Register(rejected); err != nil {
+		return nil, err
+	}
+
+	limited := prometheus_client.NewCounter(prometheus_client.CounterOpts{
+		Name: "agent_prometheus_rules_series_limit_samples_total",
+		Help: "Total number of samples of new series which weren't stored for rule evaluation because max_series was reached.",
+	})
+	if err := o.Registerer.Register(limited); err != nil {
+		return nil, err
+	}
+
+	hs, err := newHeadStorage(filepath.Join(o.DataPath, "head"), rejected, limited, o.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("creating rule storage: %w", err)
+	}
+
+	series := prometheus_client.NewGaugeFunc(prometheus_client.GaugeOpts{
+		Name: "agent_prometheus_rules_storage_series",
+		Help: "Number of series stored for rule evaluation.",
+	}, func() float64 { return float64(hs.NumSeries()) })
+	if err := o.Registerer.Register(series); err != nil {
+		_ = hs.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Component{
+		opts:    o,
+		storage: hs,
+		loader:  &groupLoader{},
+		cancel:  cancel,
+
+		onUpdate: make(chan struct{}, 1),
+	}
+
+	// Rule results are stored so that other rules can query them, and
+	// forwarded.
+	c.fanout = prometheus.NewFanout(c.forwardTo(args), o.ID, o.Registerer, ls)
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:               log.With(o.Logger, "subcomponent", "engine"),
+		MaxSamples:           50_000_000,
+		Timeout:              queryTimeout,
+		LookbackDelta:        5 * time.Minute,
+		EnableAtModifier:     true,
+		EnableNegativeOffset: true,
+	})
+	c.manager = rules.NewManager(&rules.ManagerOptions{
+		Appendable:  c.fanout,
+		Queryable:   hs,
+		QueryFunc:   rules.EngineQueryFunc(engine, hs),
+		NotifyFunc:  func(context.Context, string, ...*rules.Alert) {},
+		Context:     ctx,
+		Logger:      log.With(o.Logger, "subcomponent", "rules"),
+		Registerer:  o.Registerer,
+		GroupLoader: c.loader,
+	})
+
+	// Immediately export the receiver which remains the same for the component
+	// lifetime.
+	o.OnStateChange(Exports{Receiver: hs})
+
+	if err := c.Update(args); err != nil {
+		cancel()
+		_ = hs.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *Component) Run(ctx context.Context) error {
+	defer func() {
+		c.manager.Stop()
+		c.cancel()
+		if err := c.storage.Close(); err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "failed to close rule storage", "err", err)
+		}
+	}()
+
+	// Rule groups are only loaded once the manager runs: updating the manager
+	// waits for replaced groups to stop, and groups only start running with
+	// the manager.
+	go c.manager.Run()
+	c.loadGroups()
+
+	ticker := time.NewTicker(truncateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.onUpdate:
+			c.loadGroups()
+		case <-ticker.C:
+			c.mut.RLock()
+			retention := c.args.Retention
+			c.mut.RUnlock()
+
+			mint := time.Now().Add(-retention).UnixMilli()
+			if err := c.storage.Truncate(mint); err != nil {
+				level.Warn(c.opts.Logger).Log("msg", "failed to truncate rule storage", "err", err)
+			}
+		}
+	}
+}
+
+// Update implements component.Component.
+func (c *Component) Update(args component.Arguments) error {
+	newArgs := args.(Arguments)
+
+	groups, errs := rulefmt.Parse([]byte(newArgs.Rules))
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid rules: %w", errs[0])
+	}
+
+	c.mut.Lock()
+	c.args = newArgs
+	c.storage.SetMaxSeries(newArgs.MaxSeries)
+	c.fanout.UpdateChildren(c.forwardTo(newArgs))
+	c.loader.Set(groups)
+	c.mut.Unlock()
+
+	select {
+	case c.onUpdate <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// loadGroups loads the most recent rule groups into the manager.
+func (c *Component) loadGroups() {
+	c.mut.RLock()
+	var (
+		interval       = c.args.EvaluationInterval
+		externalLabels = labels.FromMap(c.args.ExternalLabels)
+		files          = []string{rulesIdentifier}
+	)
+	if c.loader.Empty() {
+		files = nil
+	}
+	c.mut.RUnlock()
+
+	if err := c.manager.Update(interval, files, externalLabels, "", nil); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "failed to load rules", "err", err)
+	}
+}
+
+// forwardTo returns the appendables receiving the results of rules.
+func (c *Component) forwardTo(args Arguments) []storage.Appendable {
+	return append([]storage.Appendable{c.storage}, args.ForwardTo...)
+}
+
+// groupLoader implements rules.GroupLoader for rule groups held in memory.
+type groupLoader struct {
+	mut    sync.RWMutex
+	groups *rulefmt.RuleGroups
+}
+
+var _ rules.GroupLoader = (*groupLoader)(nil)
+
+// Set sets the rule groups returned by Load.
+func (l *groupLoader) Set(groups *rulefmt.RuleGroups) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.groups = groups
+}
+
+// Empty returns true if there are no rule groups.
+func (l *groupLoader) Empty() bool {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+	return l.groups == nil || len(l.groups.Groups) == 0
+}
+
+// Load implements rules.GroupLoader.
+func (l *groupLoader) Load(identifier string) (*rulefmt.RuleGroups, []error) {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	if identifier != rulesIdentifier || l.groups == nil {
+		return nil, []error{fmt.Errorf("unknown rules %q", identifier)}
+	}
+	return l.groups, nil
+}
+
+// Parse implements rules.GroupLoader.
+func (l *groupLoader) Parse(query string) (parser.Expr, error) {
+	return parser.ParseExpr(query)
+}
@@ -0,0 +1,203 @@
+package rules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/pkg/util"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/river"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+groups:
+  - name: example
+    interval: 100ms
+    rules:
+      - record: job:up:sum
+        expr: sum by (job) (up)
+      - record: job:up:double
+        expr: job:up:sum * 2
+      - alert: InstancesUp
+        expr: job:up:sum > 1
+        labels:
+          severity: info
+`
+
+func TestRules(t *testing.T) {
+	var (
+		ls       = labelstore.New(nil)
+		received = newSampleRecorder(ls)
+	)
+
+	c, err := New(component.Options{
+		ID:            "prometheus.rules.test",
+		Logger:        util.TestFlowLogger(t),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, Arguments{
+		ForwardTo:          []storage.Appendable{received.appendable},
+		Rules:              testRules,
+		EvaluationInterval: time.Minute,
+		Retention:          time.Hour,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, c.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	app := c.storage.Appender(context.Background())
+	now := time.Now().UnixMilli()
+	for _, instance := range []string{"a", "b"} {
+		_, err := app.Append(0, labels.FromStrings("__name__", "up", "job", "app", "instance", instance), now, 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	// Rules can query the results of previous rules of the group.
+	require.Eventually(t, func() bool {
+		return received.Get(`{__name__="job:up:double", job="app"}`) == 4
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, float64(2), received.Get(`{__name__="job:up:sum", job="app"}`))
+
+	require.Eventually(t, func() bool {
+		info := c.DebugInfo().(DebugInfo)
+		if len(info.Groups) != 1 || len(info.Groups[0].Rules) != 3 {
+			return false
+		}
+		return info.Groups[0].Rules[2].State == "firing"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"alertname":"InstancesUp"`)
+	require.Contains(t, rec.Body.String(), `"state":"firing"`)
+}
+
+func TestMaxSeries(t *testing.T) {
+	ls := labelstore.New(nil)
+	c, err := New(component.Options{
+		ID:            "prometheus.rules.test",
+		Logger:        util.TestFlowLogger(t),
+		DataPath:      t.TempDir(),
+		OnStateChange: func(component.Exports) {},
+		Registerer:    prom.NewRegistry(),
+		GetServiceData: func(name string) (interface{}, error) {
+			return ls, nil
+		},
+	}, Arguments{
+		EvaluationInterval: time.Minute,
+		Retention:          time.Hour,
+		MaxSeries:          2,
+	})
+	require.NoError(t, err)
+	defer c.storage.Close()
+
+	now := time.Now().UnixMilli()
+	app := c.storage.Appender(context.Background())
+	for _, instance := range []string{"a", "b", "c"} {
+		_, err := app.Append(0, labels.FromStrings("__name__", "up", "instance", instance), now, 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+	require.Equal(t, uint64(2), c.storage.NumSeries())
+	require.Equal(t, float64(1), testutil.ToFloat64(c.storage.limited))
+
+	// Existing series are still appended to once the limit is reached.
+	app = c.storage.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "up", "instance", "a"), now+1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+	require.Equal(t, float64(1), testutil.ToFloat64(c.storage.limited))
+
+	// Raising the limit allows new series.
+	require.NoError(t, c.Update(Arguments{
+		EvaluationInterval: time.Minute,
+		Retention:          time.Hour,
+	}))
+	app = c.storage.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("__name__", "up", "instance", "c"), now+1000, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+	require.Equal(t, uint64(3), c.storage.NumSeries())
+}
+
+func TestArguments_Validate(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		forward_to = []
+		rules      = "groups: [{name: example, rules: [{record: bad, expr: 'sum('}]}]"
+	`), &args)
+	require.ErrorContains(t, err, "invalid rules")
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		rules      = ""
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, args.EvaluationInterval)
+	require.Equal(t, time.Hour, args.Retention)
+
+	err = river.Unmarshal([]byte(`
+		forward_to = []
+		rules      = ""
+		max_series = -1
+	`), &args)
+	require.ErrorContains(t, err, "max_series must not be negative")
+}
+
+// sampleRecorder records the most recent value of each series appended to
+// its appendable.
+type sampleRecorder struct {
+	appendable storage.Appendable
+
+	mut     sync.Mutex
+	samples map[string]float64
+}
+
+func newSampleRecorder(ls labelstore.LabelStore) *sampleRecorder {
+	r := &sampleRecorder{samples: make(map[string]float64)}
+	r.appendable = prometheus.NewInterceptor(nil, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		r.mut.Lock()
+		defer r.mut.Unlock()
+		r.samples[l.String()] = v
+		return ref, nil
+	}))
+	return r
+}
+
+// Get returns the value of the series with the given labels, or -1 if it
+// wasn't appended.
+func (r *sampleRecorder) Get(series string) float64 {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if v, ok := r.samples[series]; ok {
+		return v
+	}
+	return -1
+}
@@ -0,0 +1,193 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kit/log"
+	prometheus_client "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"go.uber.org/atomic"
+)
+
+// headStorage stores recent samples in a TSDB head without a WAL, so rules
+// can query them. Samples older than the retention are truncated, and the
+// head is discarded when the component exits. Samples of new series are
+// dropped once the head holds maxSeries series, if it's greater than 0.
+type headStorage struct {
+	head      *tsdb.Head
+	rejected  prometheus_client.Counter
+	limited   prometheus_client.Counter
+	maxSeries atomic.Int64
+
+	mut    sync.RWMutex // Held for reading while using head.
+	closed bool
+}
+
+var (
+	_ storage.Appendable = (*headStorage)(nil)
+	_ storage.Queryable  = (*headStorage)(nil)
+)
+
+// newHeadStorage creates a headStorage keeping memory-mapped chunks in dir.
+// Samples rejected by the head are counted by rejected, and samples of series
+// dropped because of the series limit by limited.
+func newHeadStorage(dir string, rejected, limited prometheus_client.Counter, logger log.Logger) (*headStorage, error) {
+	// Chunks left over from a previous run can't be used without a WAL to
+	// rebuild the index.
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("removing previous head: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	opts := tsdb.DefaultHeadOptions()
+	opts.ChunkDirRoot = filepath.Clean(dir)
+	opts.EnableNativeHistograms.Store(true)
+
+	head, err := tsdb.NewHead(nil, logger, nil, nil, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := head.Init(math.MinInt64); err != nil {
+		_ = head.Close()
+		return nil, err
+	}
+	return &headStorage{head: head, rejected: rejected, limited: limited}, nil
+}
+
+// SetMaxSeries sets the maximum number of series of the head. There is no
+// limit if maxSeries is 0.
+func (s *headStorage) SetMaxSeries(maxSeries int) {
+	s.maxSeries.Store(int64(maxSeries))
+}
+
+// Appender implements storage.Appendable. Samples rejected by the head, such
+// as out-of-order samples, are counted and dropped without failing the
+// append, so they don't affect other components receiving the same samples.
+func (s *headStorage) Appender(ctx context.Context) storage.Appender {
+	return &headAppender{storage: s, next: s.head.Appender(ctx)}
+}
+
+// Querier implements storage.Queryable.
+func (s *headStorage) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	if s.closed {
+		return nil, errClosed
+	}
+	return tsdb.NewBlockQuerier(tsdb.NewRangeHead(s.head, mint, maxt), mint, maxt)
+}
+
+// Truncate removes the samples older than mint.
+func (s *headStorage) Truncate(mint int64) error {
+	return s.use(func() error {
+		if mint <= s.head.MinTime() {
+			return nil
+		}
+		return s.head.Truncate(mint)
+	})
+}
+
+// NumSeries returns the number of series in the head.
+func (s *headStorage) NumSeries() uint64 {
+	return s.head.NumSeries()
+}
+
+// Close closes the head. Appends fail after Close is called.
+func (s *headStorage) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.closed = true
+	return s.head.Close()
+}
+
+// use calls f if the head isn't closed yet, and returns errClosed otherwise.
+func (s *headStorage) use(f func() error) error {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	if s.closed {
+		return errClosed
+	}
+	return f()
+}
+
+var errClosed = errors.New("rule storage is closed")
+
+// headAppender forwards appends to a head appender. Series references passed
+// by the caller belong to other storages, so they're never passed to the head.
+type headAppender struct {
+	storage *headStorage
+	next    storage.Appender
+}
+
+var _ storage.Appender = (*headAppender)(nil)
+
+func (a *headAppender) Append(_ storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	return 0, a.storage.use(func() error {
+		if a.limited(l) {
+			return nil
+		}
+		if _, err := a.next.Append(0, l, t, v); err != nil {
+			a.storage.rejected.Inc()
+		}
+		return nil
+	})
+}
+
+func (a *headAppender) AppendExemplar(_ storage.SeriesRef, _ labels.Labels, _ exemplar.Exemplar) (storage.SeriesRef, error) {
+	// Exemplars can't be queried by rules.
+	return 0, nil
+}
+
+func (a *headAppender) AppendHistogram(_ storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	return 0, a.storage.use(func() error {
+		if a.limited(l) {
+			return nil
+		}
+		if _, err := a.next.AppendHistogram(0, l, t, h, fh); err != nil {
+			a.storage.rejected.Inc()
+		}
+		return nil
+	})
+}
+
+func (a *headAppender) UpdateMetadata(_ storage.SeriesRef, _ labels.Labels, _ metadata.Metadata) (storage.SeriesRef, error) {
+	// Metadata isn't used by rules.
+	return 0, nil
+}
+
+// limited returns true, and counts the sample, if l is a new series while the
+// head already holds the maximum number of series.
+func (a *headAppender) limited(l labels.Labels) bool {
+	maxSeries := a.storage.maxSeries.Load()
+	if maxSeries <= 0 || a.storage.head.NumSeries() < uint64(maxSeries) {
+		return false
+	}
+	if g, ok := a.next.(storage.GetRef); ok {
+		if ref, _ := g.GetRef(l, l.Hash()); ref != 0 {
+			return false
+		}
+	}
+	a.storage.limited.Inc()
+	return true
+}
+
+func (a *headAppender) Commit() error {
+	return a.storage.use(a.next.Commit)
+}
+
+func (a *headAppender) Rollback() error {
+	return a.storage.use(a.next.Rollback)
+}
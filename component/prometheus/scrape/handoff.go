@@ -0,0 +1,354 @@
+package scrape
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/service/cluster"
+	"github.com/grafana/ckit/peer"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/scrape"
+)
+
+const (
+	// handoffCheckInterval is how often the new owners of handed off targets
+	// are asked whether they scrape them successfully.
+	handoffCheckInterval = 5 * time.Second
+	// handoffRequestTimeout is the timeout of requests to new owners.
+	handoffRequestTimeout = 5 * time.Second
+)
+
+// handoffs tracks the targets owned by the component, and the targets which
+// the component keeps scraping after they moved to other peers until the new
+// owners of the targets scrape them successfully.
+type handoffs struct {
+	mut        sync.Mutex
+	owned      map[string]discovery.Target // Owned targets by shard key.
+	pending    map[string]*handoffTarget   // Handed off targets by shard key.
+	suppressed []suppressedTarget
+}
+
+// handoffTarget is a target which moved to other peers.
+type handoffTarget struct {
+	target   discovery.Target
+	owners   []peer.Peer
+	deadline time.Time
+}
+
+// suppressedTarget holds the labels of a target which was handed off to a
+// new owner. Stale markers for the series of the target are dropped until
+// the end of the handoff, so that they don't hide the samples of the new
+// owner.
+type suppressedTarget struct {
+	labels labels.Labels
+	until  time.Time
+}
+
+func newHandoffs() *handoffs {
+	return &handoffs{
+		owned:   make(map[string]discovery.Target),
+		pending: make(map[string]*handoffTarget),
+	}
+}
+
+// Update records the targets owned by the component, out of all the targets
+// it received, and starts handing off the targets it stopped owning. It
+// returns the targets to scrape: the owned targets and the targets which are
+// still being handed off.
+func (h *handoffs) Update(dt *discovery.DistributedTargets, all, owned []discovery.Target, window time.Duration, now time.Time) []discovery.Target {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	newOwned := make(map[string]discovery.Target, len(owned))
+	for _, tgt := range owned {
+		newOwned[tgt.ShardKey()] = tgt
+	}
+
+	allTargets := make(map[string]discovery.Target, len(all))
+	for _, tgt := range all {
+		allTargets[tgt.ShardKey()] = tgt
+	}
+
+	// Stop handing off targets which are owned again or which are gone.
+	for key := range h.pending {
+		if _, ok := newOwned[key]; ok {
+			delete(h.pending, key)
+		} else if _, ok := allTargets[key]; !ok || window <= 0 {
+			delete(h.pending, key)
+		}
+	}
+
+	if window > 0 {
+		for key := range h.owned {
+			tgt, ok := allTargets[key]
+			if _, owned := newOwned[key]; owned || !ok {
+				continue
+			}
+			if _, ok := h.pending[key]; ok {
+				continue
+			}
+
+			owners, err := dt.Owners(tgt)
+			if err != nil {
+				continue
+			}
+			h.pending[key] = &handoffTarget{owners: owners, deadline: now.Add(window)}
+		}
+	}
+	h.owned = newOwned
+
+	res := append([]discovery.Target(nil), owned...)
+	for key, ht := range h.pending {
+		// Scrape the most recent version of the target.
+		ht.target = allTargets[key]
+		res = append(res, ht.target)
+	}
+	return res
+}
+
+// Reset forgets the owned and handed off targets.
+func (h *handoffs) Reset() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	h.owned = make(map[string]discovery.Target)
+	h.pending = make(map[string]*handoffTarget)
+}
+
+// Expire stops handing off the targets past their deadline. It returns the
+// number of expired targets.
+func (h *handoffs) Expire(now time.Time) int {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	var expired int
+	for key, ht := range h.pending {
+		if !now.Before(ht.deadline) {
+			delete(h.pending, key)
+			expired++
+		}
+	}
+
+	n := 0
+	for _, s := range h.suppressed {
+		if now.Before(s.until) {
+			h.suppressed[n] = s
+			n++
+		}
+	}
+	h.suppressed = h.suppressed[:n]
+	return expired
+}
+
+// PendingByPeer returns the shard keys of the handed off targets, grouped by
+// the name of their owners.
+func (h *handoffs) PendingByPeer() (map[string][]string, map[string]peer.Peer) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	var (
+		keys  = make(map[string][]string)
+		peers = make(map[string]peer.Peer)
+	)
+	for key, ht := range h.pending {
+		for _, p := range ht.owners {
+			if p.Self {
+				continue
+			}
+			keys[p.Name] = append(keys[p.Name], key)
+			peers[p.Name] = p
+		}
+	}
+	return keys, peers
+}
+
+// Pending returns the handed off targets with the given shard keys.
+func (h *handoffs) Pending(keys []string) map[string]discovery.Target {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	res := make(map[string]discovery.Target, len(keys))
+	for _, key := range keys {
+		if ht, ok := h.pending[key]; ok {
+			res[key] = ht.target
+		}
+	}
+	return res
+}
+
+// Owned returns the owned targets with the given shard keys.
+func (h *handoffs) Owned(keys []string) map[string]discovery.Target {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	res := make(map[string]discovery.Target, len(keys))
+	for _, key := range keys {
+		if tgt, ok := h.owned[key]; ok {
+			res[key] = tgt
+		}
+	}
+	return res
+}
+
+// Complete stops handing off the targets with the given shard keys. Stale
+// markers for the series with the labels of the targets are suppressed
+// until the given time.
+func (h *handoffs) Complete(keys []string, targetLabels []labels.Labels, until time.Time) int {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	var completed int
+	for _, key := range keys {
+		if _, ok := h.pending[key]; ok {
+			delete(h.pending, key)
+			completed++
+		}
+	}
+	for _, l := range targetLabels {
+		h.suppressed = append(h.suppressed, suppressedTarget{labels: l, until: until})
+	}
+	return completed
+}
+
+// NumPending returns the number of handed off targets.
+func (h *handoffs) NumPending() int {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return len(h.pending)
+}
+
+// Suppressed returns true if stale markers for the series with labels l must
+// be dropped.
+func (h *handoffs) Suppressed(l labels.Labels, now time.Time) bool {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	for _, s := range h.suppressed {
+		if now.Before(s.until) && hasLabels(l, s.labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabels returns true if l has all the labels of sub.
+func hasLabels(l, sub labels.Labels) bool {
+	ok := true
+	sub.Range(func(lbl labels.Label) {
+		if ok && l.Get(lbl.Name) != lbl.Value {
+			ok = false
+		}
+	})
+	return ok
+}
+
+// checkHandoffs expires the handed off targets past their deadline, and asks
+// the new owners of the others whether they scrape them successfully. It
+// returns true if the targets to scrape changed.
+func (c *Component) checkHandoffs(ctx context.Context) bool {
+	now := time.Now()
+	expired := c.handoffs.Expire(now)
+	if expired > 0 {
+		level.Warn(c.opts.Logger).Log("msg", "handoff window expired before new owners scraped targets", "targets", expired)
+		c.handoffsTotal.WithLabelValues("expired").Add(float64(expired))
+	}
+
+	keysByPeer, peers := c.handoffs.PendingByPeer()
+	client, ok := c.cluster.(cluster.HandoffClient)
+	if !ok || len(keysByPeer) == 0 {
+		c.handoffTargets.Set(float64(c.handoffs.NumPending()))
+		return expired > 0
+	}
+
+	c.mut.RLock()
+	interval := c.args.ScrapeInterval
+	c.mut.RUnlock()
+
+	var completed int
+	for name, keys := range keysByPeer {
+		reqCtx, cancel := context.WithTimeout(ctx, handoffRequestTimeout)
+		ready, err := client.ReadyKeys(reqCtx, peers[name], c.opts.ID, keys)
+		cancel()
+		if err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "failed to check handoff of targets", "peer", name, "err", err)
+			continue
+		}
+		if len(ready) == 0 {
+			continue
+		}
+
+		// The series of the handed off targets get stale markers a few scrape
+		// intervals after the targets stop being scraped.
+		var targetLabels []labels.Labels
+		for _, st := range c.activeTargets(c.handoffs.Pending(ready)) {
+			targetLabels = append(targetLabels, st.Labels())
+		}
+		completed += c.handoffs.Complete(ready, targetLabels, time.Now().Add(3*interval))
+	}
+
+	if completed > 0 {
+		level.Debug(c.opts.Logger).Log("msg", "handed off targets to new owners", "targets", completed)
+		c.handoffsTotal.WithLabelValues("ready").Add(float64(completed))
+	}
+	c.handoffTargets.Set(float64(c.handoffs.NumPending()))
+	return expired > 0 || completed > 0
+}
+
+// ReadyKeys implements cluster.HandoffComponent. It returns the shard keys
+// of the targets owned by the component which were scraped successfully.
+func (c *Component) ReadyKeys(keys []string) []string {
+	var ready []string
+	for key, st := range c.activeTargets(c.handoffs.Owned(keys)) {
+		if st.Health() == scrape.HealthGood {
+			ready = append(ready, key)
+		}
+	}
+	return ready
+}
+
+// activeTargets returns the targets of the scrape manager for the given
+// targets, by shard key.
+func (c *Component) activeTargets(targets map[string]discovery.Target) map[string]*scrape.Target {
+	res := make(map[string]*scrape.Target, len(targets))
+	if len(targets) == 0 {
+		return res
+	}
+
+	byAddress := make(map[string][]*scrape.Target)
+	for _, sts := range c.scraper.TargetsActive() {
+		for _, st := range sts {
+			addr := st.DiscoveredLabels().Get(model.AddressLabel)
+			byAddress[addr] = append(byAddress[addr], st)
+		}
+	}
+
+	for key, tgt := range targets {
+		for _, st := range byAddress[tgt[model.AddressLabel]] {
+			if discoveredFrom(st.DiscoveredLabels(), tgt) {
+				res[key] = st
+				break
+			}
+		}
+	}
+	return res
+}
+
+// discoveredFrom returns true if the discovered labels of a scrape target
+// come from tgt. Query parameters may be overridden by the scrape
+// configuration, so they're ignored.
+func discoveredFrom(discovered labels.Labels, tgt discovery.Target) bool {
+	for name, value := range tgt {
+		if strings.HasPrefix(name, model.ParamLabelPrefix) {
+			continue
+		}
+		if discovered.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package scrape
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/service/cluster"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/ckit/shard"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandoffs(t *testing.T) {
+	var (
+		t1  = discovery.Target{"__address__": "a:80", "job": "app"}
+		t2  = discovery.Target{"__address__": "b:80", "job": "app"}
+		all = []discovery.Target{t1, t2}
+
+		self  = peer.Peer{Name: "self", Self: true, State: peer.StateParticipant}
+		other = peer.Peer{Name: "other", Addr: "other:12345", State: peer.StateParticipant}
+
+		clustering = cluster.ComponentBlock{Enabled: true, HandoffWindow: time.Minute}
+		now        = time.Now()
+	)
+
+	c := &ownerCluster{peers: []peer.Peer{self, other}, owners: map[string]peer.Peer{
+		t1.ShardKey(): self,
+		t2.ShardKey(): self,
+	}}
+	h := newHandoffs()
+
+	dt := discovery.NewDistributedTargets(clustering, c, all)
+	require.ElementsMatch(t, all, h.Update(&dt, all, dt.Get(), clustering.HandoffWindow, now))
+	require.Len(t, h.Owned([]string{t1.ShardKey(), t2.ShardKey()}), 2)
+
+	// t2 moves to another peer, but keeps being scraped until it's handed
+	// off.
+	c.owners[t2.ShardKey()] = other
+	dt = discovery.NewDistributedTargets(clustering, c, all)
+	require.ElementsMatch(t, all, h.Update(&dt, all, dt.Get(), clustering.HandoffWindow, now))
+	require.Equal(t, 1, h.NumPending())
+
+	keys, peers := h.PendingByPeer()
+	require.Equal(t, map[string][]string{"other": {t2.ShardKey()}}, keys)
+	require.Equal(t, other, peers["other"])
+	require.Len(t, h.Owned([]string{t2.ShardKey()}), 0)
+
+	// Once the new owner is ready, t2 stops being scraped and its stale
+	// markers are suppressed.
+	targetLabels := []labels.Labels{labels.FromStrings("instance", "b:80", "job", "app")}
+	require.Equal(t, 1, h.Complete([]string{t2.ShardKey()}, targetLabels, now.Add(3*time.Minute)))
+	require.Equal(t, []discovery.Target{t1}, h.Update(&dt, all, dt.Get(), clustering.HandoffWindow, now))
+
+	require.True(t, h.Suppressed(labels.FromStrings("__name__", "up", "instance", "b:80", "job", "app"), now))
+	require.False(t, h.Suppressed(labels.FromStrings("__name__", "up", "instance", "a:80", "job", "app"), now))
+	require.False(t, h.Suppressed(labels.FromStrings("__name__", "up", "instance", "b:80", "job", "app"), now.Add(4*time.Minute)))
+
+	// t1 moves too, but its new owner never gets ready.
+	c.owners[t1.ShardKey()] = other
+	dt = discovery.NewDistributedTargets(clustering, c, all)
+	require.Equal(t, []discovery.Target{t1}, h.Update(&dt, all, dt.Get(), clustering.HandoffWindow, now))
+	require.Equal(t, 0, h.Expire(now.Add(30*time.Second)))
+	require.Equal(t, 1, h.Expire(now.Add(time.Minute)))
+	require.Empty(t, h.Update(&dt, all, dt.Get(), clustering.HandoffWindow, now))
+}
+
+func TestHandoffs_Disabled(t *testing.T) {
+	var (
+		t1  = discovery.Target{"__address__": "a:80"}
+		all = []discovery.Target{t1}
+
+		self  = peer.Peer{Name: "self", Self: true, State: peer.StateParticipant}
+		other = peer.Peer{Name: "other", State: peer.StateParticipant}
+
+		clustering = cluster.ComponentBlock{Enabled: true}
+	)
+
+	c := &ownerCluster{peers: []peer.Peer{self, other}, owners: map[string]peer.Peer{t1.ShardKey(): self}}
+	h := newHandoffs()
+
+	dt := discovery.NewDistributedTargets(clustering, c, all)
+	require.Equal(t, all, h.Update(&dt, all, dt.Get(), 0, time.Now()))
+
+	c.owners[t1.ShardKey()] = other
+	dt = discovery.NewDistributedTargets(clustering, c, all)
+	require.Empty(t, h.Update(&dt, all, dt.Get(), 0, time.Now()))
+	require.Equal(t, 0, h.NumPending())
+}
+
+func TestDiscoveredFrom(t *testing.T) {
+	tgt := discovery.Target{"__address__": "a:80", "__param_module": "http", "team": "a"}
+
+	require.True(t, discoveredFrom(labels.FromStrings(
+		"__address__", "a:80",
+		"__param_module", "tcp",
+		"__scheme__", "http",
+		"job", "app",
+		"team", "a",
+	), tgt))
+	require.False(t, discoveredFrom(labels.FromStrings("__address__", "a:80", "team", "b"), tgt))
+}
+
+// ownerCluster is a cluster.Cluster where keys have a single, fixed owner.
+type ownerCluster struct {
+	peers  []peer.Peer
+	owners map[string]peer.Peer
+}
+
+func (c *ownerCluster) Lookup(key shard.Key, _ int, _ shard.Op) ([]peer.Peer, error) {
+	for k, p := range c.owners {
+		if shard.StringKey(k) == key {
+			return []peer.Peer{p}, nil
+		}
+	}
+	return c.peers[:1], nil
+}
+
+func (c *ownerCluster) Peers() []peer.Peer { return c.peers }
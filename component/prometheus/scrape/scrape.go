@@ -22,6 +22,8 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/prometheus/prometheus/storage"
 )
@@ -126,10 +128,15 @@ type Component struct {
 	scraper      *scrape.Manager
 	appendable   *prometheus.Fanout
 	targetsGauge client_prometheus.Gauge
+
+	handoffs       *handoffs
+	handoffTargets client_prometheus.Gauge
+	handoffsTotal  *client_prometheus.CounterVec
 }
 
 var (
-	_ component.Component = (*Component)(nil)
+	_ component.Component      = (*Component)(nil)
+	_ cluster.HandoffComponent = (*Component)(nil)
 )
 
 // New creates a new prometheus.scrape component.
@@ -153,6 +160,17 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	ls := service.(labelstore.LabelStore)
 
 	flowAppendable := prometheus.NewFanout(args.ForwardTo, o.ID, o.Registerer, ls)
+
+	// Stale markers of the targets handed off to other peers are dropped, so
+	// they don't hide the samples of the new owners.
+	handoffs := newHandoffs()
+	scrapeAppendable := prometheus.NewInterceptor(flowAppendable, ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, t int64, v float64, next storage.Appender) (storage.SeriesRef, error) {
+		if value.IsStaleNaN(v) && handoffs.Suppressed(l, time.Now()) {
+			return ref, nil
+		}
+		return next.Append(ref, l, t, v)
+	}))
+
 	scrapeOptions := &scrape.Options{
 		ExtraMetrics: args.ExtraMetrics,
 		HTTPClientOptions: []config_util.HTTPClientOption{
@@ -160,7 +178,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		},
 		EnableProtobufNegotiation: args.EnableProtobufNegotiation,
 	}
-	scraper := scrape.NewManager(scrapeOptions, o.Logger, flowAppendable)
+	scraper := scrape.NewManager(scrapeOptions, o.Logger, scrapeAppendable)
 
 	targetsGauge := client_prometheus.NewGauge(client_prometheus.GaugeOpts{
 		Name: "agent_prometheus_scrape_targets_gauge",
@@ -170,6 +188,19 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		return nil, err
 	}
 
+	handoffTargets := client_prometheus.NewGauge(client_prometheus.GaugeOpts{
+		Name: "agent_prometheus_scrape_handoff_targets",
+		Help: "Number of targets this component keeps scraping until their new owners in the cluster scrape them"})
+	if err := o.Registerer.Register(handoffTargets); err != nil {
+		return nil, err
+	}
+	handoffsTotal := client_prometheus.NewCounterVec(client_prometheus.CounterOpts{
+		Name: "agent_prometheus_scrape_handoffs_total",
+		Help: "Total number of targets handed off to new owners in the cluster, by result"}, []string{"result"})
+	if err := o.Registerer.Register(handoffsTotal); err != nil {
+		return nil, err
+	}
+
 	c := &Component{
 		opts:          o,
 		cluster:       clusterData,
@@ -177,6 +208,10 @@ func New(o component.Options, args Arguments) (*Component, error) {
 		scraper:       scraper,
 		appendable:    flowAppendable,
 		targetsGauge:  targetsGauge,
+
+		handoffs:       handoffs,
+		handoffTargets: handoffTargets,
+		handoffsTotal:  handoffsTotal,
 	}
 
 	// Call to Update() to set the receivers and targets once at the start.
@@ -201,23 +236,33 @@ func (c *Component) Run(ctx context.Context) error {
 		}
 	}()
 
+	handoffTicker := time.NewTicker(handoffCheckInterval)
+	defer handoffTicker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-handoffTicker.C:
+			if c.checkHandoffs(ctx) {
+				select {
+				case c.reloadTargets <- struct{}{}:
+				default:
+				}
+			}
 		case <-c.reloadTargets:
 			c.mut.RLock()
 			var (
-				targets           = c.args.Targets
-				jobName           = c.opts.ID
-				clusteringEnabled = c.args.Clustering.Enabled
+				targets    = c.args.Targets
+				jobName    = c.opts.ID
+				clustering = c.args.Clustering
 			)
 			if c.args.JobName != "" {
 				jobName = c.args.JobName
 			}
 			c.mut.RUnlock()
 
-			promTargets := c.distTargets(targets, jobName, clusteringEnabled)
+			promTargets := c.distTargets(targets, jobName, clustering)
 
 			select {
 			case targetSetsChan <- promTargets:
@@ -308,12 +353,18 @@ func getPromScrapeConfigs(jobName string, c Arguments) *config.ScrapeConfig {
 func (c *Component) distTargets(
 	targets []discovery.Target,
 	jobName string,
-	clustering bool,
+	clustering cluster.ComponentBlock,
 ) map[string][]*targetgroup.Group {
 	// NOTE(@tpaschalis) First approach, manually building the
 	// 'clustered' targets implementation every time.
 	dt := discovery.NewDistributedTargets(clustering, c.cluster, targets)
 	flowTargets := dt.Get()
+	if clustering.Enabled {
+		flowTargets = c.handoffs.Update(&dt, targets, flowTargets, clustering.HandoffWindow, time.Now())
+	} else {
+		c.handoffs.Reset()
+	}
+	c.handoffTargets.Set(float64(c.handoffs.NumPending()))
 	c.targetsGauge.Set(float64(len(flowTargets)))
 	promTargets := c.componentTargetsToProm(jobName, flowTargets)
 	return promTargets
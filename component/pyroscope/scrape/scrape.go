@@ -284,7 +284,7 @@ func (c *Component) Run(ctx context.Context) error {
 			var (
 				tgs        = c.args.Targets
 				jobName    = c.opts.ID
-				clustering = c.args.Clustering.Enabled
+				clustering = c.args.Clustering
 			)
 			if c.args.JobName != "" {
 				jobName = c.args.JobName
@@ -19,6 +19,7 @@ func (s *ScrapeConfigBuilder) AppendSyslogConfig() {
 		UseIncomingTimestamp: s.cfg.SyslogConfig.UseIncomingTimestamp,
 		UseRFC5424Message:    s.cfg.SyslogConfig.UseRFC5424Message,
 		MaxMessageLength:     s.cfg.SyslogConfig.MaxMessageLength,
+		SyslogFormat:         syslog.DefaultListenerConfig.SyslogFormat,
 		TLSConfig:            *common.ToTLSConfig(&s.cfg.SyslogConfig.TLSConfig),
 	}
 
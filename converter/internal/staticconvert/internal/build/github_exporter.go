@@ -4,6 +4,7 @@ import (
 	"github.com/grafana/agent/component/discovery"
 	"github.com/grafana/agent/component/prometheus/exporter/github"
 	"github.com/grafana/agent/pkg/integrations/github_exporter"
+	"github.com/grafana/agent/service/cluster"
 	"github.com/grafana/river/rivertypes"
 )
 
@@ -20,5 +21,6 @@ func toGithubExporter(config *github_exporter.Config) *github.Arguments {
 		Users:         config.Users,
 		APIToken:      rivertypes.Secret(config.APIToken),
 		APITokenFile:  config.APITokenFile,
+		Clustering:    cluster.DefaultSingletonBlock,
 	}
 }
@@ -0,0 +1,402 @@
+package waltools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// Series holds the samples of a series within the WAL, sorted by timestamp.
+type Series struct {
+	Labels  labels.Labels
+	Samples []Sample
+}
+
+// Sample is a float or native histogram sample of a series. H or FH is set
+// for histogram samples.
+type Sample struct {
+	T  int64
+	V  float64
+	H  *histogram.Histogram
+	FH *histogram.FloatHistogram
+}
+
+// ReadSeries reads the series matching the given label selector from the
+// WAL, with their samples between mint and maxt inclusive. Stale markers are
+// skipped. Series are sorted by metric name and labels.
+func ReadSeries(walDir string, selectorStr string, mint, maxt int64) ([]*Series, error) {
+	w, err := wlog.Open(nil, walDir)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	selector, err := parser.ParseMetricSelector(selectorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	labelsByRef := make(map[chunks.HeadSeriesRef]labels.Labels)
+	err = walIterate(w, func(r *wlog.Reader) error {
+		return collectSeries(r, selector, labelsByRef)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not collect series: %w", err)
+	}
+
+	// Several refs can be assigned to the same labels, so series are merged
+	// by labels.
+	var (
+		seriesByRef    = make(map[chunks.HeadSeriesRef]*Series, len(labelsByRef))
+		seriesByLabels = make(map[string]*Series, len(labelsByRef))
+	)
+	for ref, lbls := range labelsByRef {
+		key := lbls.String()
+		s, ok := seriesByLabels[key]
+		if !ok {
+			s = &Series{Labels: lbls}
+			seriesByLabels[key] = s
+		}
+		seriesByRef[ref] = s
+	}
+
+	err = walIterate(w, func(r *wlog.Reader) error {
+		return collectSeriesSamples(r, seriesByRef, mint, maxt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not collect samples: %w", err)
+	}
+
+	return sortedSeries(seriesByLabels), nil
+}
+
+// sortedSeries returns the series of seriesByLabels which have samples,
+// sorted by metric name and labels, with their samples sorted by timestamp.
+func sortedSeries(seriesByLabels map[string]*Series) []*Series {
+	res := make([]*Series, 0, len(seriesByLabels))
+	for _, s := range seriesByLabels {
+		if len(s.Samples) == 0 {
+			continue
+		}
+		s.Samples = sortSamples(s.Samples)
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		ni, nj := res[i].Labels.Get(model.MetricNameLabel), res[j].Labels.Get(model.MetricNameLabel)
+		if ni != nj {
+			return ni < nj
+		}
+		return labels.Compare(res[i].Labels, res[j].Labels) < 0
+	})
+	return res
+}
+
+func collectSeriesSamples(r *wlog.Reader, seriesByRef map[chunks.HeadSeriesRef]*Series, mint, maxt int64) error {
+	var dec sampleDecoder
+	add := func(ref chunks.HeadSeriesRef, s Sample) {
+		series, ok := seriesByRef[ref]
+		if !ok || s.T < mint || s.T > maxt {
+			return
+		}
+		series.Samples = append(series.Samples, s)
+	}
+
+	for r.Next() {
+		if err := dec.Decode(r.Record(), add); err != nil {
+			return err
+		}
+	}
+
+	return r.Err()
+}
+
+// sampleDecoder decodes the float and native histogram samples of WAL
+// records, reusing its buffers across records.
+type sampleDecoder struct {
+	dec             record.Decoder
+	samples         []record.RefSample
+	histograms      []record.RefHistogramSample
+	floatHistograms []record.RefFloatHistogramSample
+}
+
+// Decode calls add for each sample of rec which isn't a stale marker. Records
+// which don't hold samples are ignored.
+func (d *sampleDecoder) Decode(rec []byte, add func(ref chunks.HeadSeriesRef, s Sample)) error {
+	var err error
+
+	switch d.dec.Type(rec) {
+	case record.Samples:
+		d.samples, err = d.dec.Samples(rec, d.samples[:0])
+		if err != nil {
+			return err
+		}
+		for _, s := range d.samples {
+			if !value.IsStaleNaN(s.V) {
+				add(s.Ref, Sample{T: s.T, V: s.V})
+			}
+		}
+	case record.HistogramSamples:
+		d.histograms, err = d.dec.HistogramSamples(rec, d.histograms[:0])
+		if err != nil {
+			return err
+		}
+		for _, h := range d.histograms {
+			if !value.IsStaleNaN(h.H.Sum) {
+				add(h.Ref, Sample{T: h.T, H: h.H})
+			}
+		}
+	case record.FloatHistogramSamples:
+		d.floatHistograms, err = d.dec.FloatHistogramSamples(rec, d.floatHistograms[:0])
+		if err != nil {
+			return err
+		}
+		for _, fh := range d.floatHistograms {
+			if !value.IsStaleNaN(fh.FH.Sum) {
+				add(fh.Ref, Sample{T: fh.T, FH: fh.FH})
+			}
+		}
+	}
+	return nil
+}
+
+// sortSamples sorts samples by timestamp and drops the samples with
+// duplicate timestamps, keeping the most recently written ones.
+func sortSamples(samples []Sample) []Sample {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].T < samples[j].T })
+
+	n := 0
+	for i, s := range samples {
+		if i+1 < len(samples) && samples[i+1].T == s.T {
+			continue
+		}
+		samples[n] = s
+		n++
+	}
+	return samples[:n]
+}
+
+// ParseTimeRange parses the bounds of a time range given as RFC 3339 times
+// or Unix timestamps in seconds, and returns them in milliseconds. Empty
+// bounds are unbounded.
+func ParseTimeRange(from, to string) (mint, maxt int64, err error) {
+	mint, maxt = math.MinInt64, math.MaxInt64
+	if from != "" {
+		if mint, err = parseTime(from); err != nil {
+			return 0, 0, fmt.Errorf("invalid start of time range: %w", err)
+		}
+	}
+	if to != "" {
+		if maxt, err = parseTime(to); err != nil {
+			return 0, 0, fmt.Errorf("invalid end of time range: %w", err)
+		}
+	}
+	if mint > maxt {
+		return 0, 0, fmt.Errorf("start of time range is after its end")
+	}
+	return mint, maxt, nil
+}
+
+func parseTime(s string) (int64, error) {
+	if t, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(t * 1000), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither an RFC 3339 time nor a Unix timestamp", s)
+	}
+	return t.UnixMilli(), nil
+}
+
+// WriteOpenMetrics writes the float samples of series in the OpenMetrics
+// text format, which can be backfilled with promtool. Series must be sorted
+// by metric name, as returned by ReadSeries. Histogram samples and series
+// without a metric name are skipped.
+func WriteOpenMetrics(w io.Writer, series []*Series) error {
+	bw := bufio.NewWriter(w)
+
+	var lastName string
+	for _, s := range series {
+		name := s.Labels.Get(model.MetricNameLabel)
+		if name == "" {
+			continue
+		}
+
+		var (
+			prefix   = formatSeries(name, s.Labels)
+			wroteAny bool
+		)
+		for _, sample := range s.Samples {
+			if sample.H != nil || sample.FH != nil {
+				continue
+			}
+			if !wroteAny && name != lastName {
+				fmt.Fprintf(bw, "# TYPE %s unknown\n", name)
+				lastName = name
+			}
+			wroteAny = true
+
+			fmt.Fprintf(bw, "%s %s %s\n", prefix, formatFloat(sample.V), strconv.FormatFloat(float64(sample.T)/1000, 'f', -1, 64))
+		}
+	}
+
+	fmt.Fprint(bw, "# EOF\n")
+	return bw.Flush()
+}
+
+// formatSeries formats a metric name and its labels in the OpenMetrics text
+// format.
+func formatSeries(name string, lbls labels.Labels) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+
+	first := true
+	lbls.Range(func(l labels.Label) {
+		if l.Name == model.MetricNameLabel {
+			return
+		}
+		if first {
+			sb.WriteByte('{')
+			first = false
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l.Name)
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueReplacer.Replace(l.Value))
+		sb.WriteByte('"')
+	})
+	if !first {
+		sb.WriteByte('}')
+	}
+	return sb.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// WriteBlocks writes series to Prometheus TSDB blocks in dir, one block per
+// blockDuration aligned time range. It returns the IDs of the written blocks.
+func WriteBlocks(ctx context.Context, l log.Logger, dir string, series []*Series, blockDuration time.Duration) ([]string, error) {
+	blockSize := blockDuration.Milliseconds()
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("block duration must be at least 1ms")
+	}
+
+	mint, maxt := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, s := range series {
+		mint = min(mint, s.Samples[0].T)
+		maxt = max(maxt, s.Samples[len(s.Samples)-1].T)
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	var ids []string
+	for start := mint - mod(mint, blockSize); start <= maxt; start += blockSize {
+		id, ok, err := writeBlock(ctx, l, dir, series, blockSize, start, start+blockSize)
+		if err != nil {
+			return ids, err
+		}
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// writeBlock writes the samples of series in [mint, maxt) to a block. It
+// returns false if there are no such samples.
+func writeBlock(ctx context.Context, l log.Logger, dir string, series []*Series, blockSize, mint, maxt int64) (id string, ok bool, err error) {
+	// Commit samples in batches to limit the size of appenders.
+	const commitBatchSize = 10_000
+
+	w, err := tsdb.NewBlockWriter(l, dir, blockSize)
+	if err != nil {
+		return id, false, err
+	}
+	defer func() {
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	var (
+		app     = w.Appender(ctx)
+		pending int
+		total   int
+	)
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			if sample.T < mint || sample.T >= maxt {
+				continue
+			}
+
+			var appendErr error
+			if sample.H != nil || sample.FH != nil {
+				_, appendErr = app.AppendHistogram(0, s.Labels, sample.T, sample.H, sample.FH)
+			} else {
+				_, appendErr = app.Append(0, s.Labels, sample.T, sample.V)
+			}
+			if appendErr != nil {
+				_ = app.Rollback()
+				return id, false, fmt.Errorf("failed to append sample of %s: %w", s.Labels, appendErr)
+			}
+
+			pending++
+			total++
+			if pending >= commitBatchSize {
+				if err := app.Commit(); err != nil {
+					return id, false, err
+				}
+				app = w.Appender(ctx)
+				pending = 0
+			}
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return id, false, err
+	}
+	if total == 0 {
+		return id, false, nil
+	}
+
+	ulid, err := w.Flush(ctx)
+	if err != nil {
+		return id, false, err
+	}
+	return ulid.String(), true, nil
+}
+
+// mod returns the non-negative remainder of a divided by b.
+func mod(a, b int64) int64 {
+	return ((a % b) + b) % b
+}
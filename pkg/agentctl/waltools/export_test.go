@@ -0,0 +1,141 @@
+package waltools
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSeries(t *testing.T) {
+	walDir := setupTestWAL(t)
+
+	series, err := ReadSeries(walDir, `{__name__=~"metric_[01]"}`, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, []*Series{{
+		Labels:  labels.FromStrings("__name__", "metric_0", "initial", "no", "instance", "test-instance", "job", "test-job"),
+		Samples: []Sample{{T: 2, V: 1}},
+	}, {
+		Labels:  labels.FromStrings("__name__", "metric_1", "initial", "yes", "instance", "test-instance", "job", "test-job"),
+		Samples: []Sample{{T: 3, V: 1}},
+	}}, series)
+
+	_, _, err = ParseTimeRange("2023-01-02T00:00:00Z", "1672531200")
+	require.ErrorContains(t, err, "start of time range is after its end")
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	series := []*Series{{
+		Labels:  labels.FromStrings("__name__", "a", "path", `C:\dir "x"`),
+		Samples: []Sample{{T: 1000, V: 1.5}, {T: 1500, V: 2}},
+	}, {
+		Labels:  labels.FromStrings("__name__", "a", "path", "/"),
+		Samples: []Sample{{T: 1000, V: 3}},
+	}, {
+		Labels:  labels.FromStrings("__name__", "b"),
+		Samples: []Sample{{T: 2000, V: 4}},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOpenMetrics(&buf, series))
+	require.Equal(t, `# TYPE a unknown
+a{path="C:\\dir \"x\""} 1.5 1
+a{path="C:\\dir \"x\""} 2 1.5
+a{path="/"} 3 1
+# TYPE b unknown
+b 4 2
+# EOF
+`, buf.String())
+}
+
+func TestWriteBlocks(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		hour   = time.Hour.Milliseconds()
+		series = []*Series{{
+			Labels:  labels.FromStrings("__name__", "a"),
+			Samples: []Sample{{T: hour, V: 1}, {T: 3 * hour, V: 2}},
+		}, {
+			Labels:  labels.FromStrings("__name__", "b"),
+			Samples: []Sample{{T: hour, V: 3}},
+		}}
+	)
+
+	ids, err := WriteBlocks(context.Background(), log.NewNopLogger(), dir, series, 2*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+
+	first, err := tsdb.OpenBlock(nil, filepath.Join(dir, ids[0]), nil)
+	require.NoError(t, err)
+	defer first.Close()
+	require.Equal(t, uint64(2), first.Meta().Stats.NumSeries)
+	require.Equal(t, uint64(2), first.Meta().Stats.NumSamples)
+
+	second, err := tsdb.OpenBlock(nil, filepath.Join(dir, ids[1]), nil)
+	require.NoError(t, err)
+	defer second.Close()
+	require.Equal(t, uint64(1), second.Meta().Stats.NumSamples)
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		received = make(map[string][]prompb.Sample)
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := remote.DecodeWriteRequest(r.Body)
+		require.NoError(t, err)
+
+		mut.Lock()
+		defer mut.Unlock()
+		requests++
+		for _, ts := range req.Timeseries {
+			received[ts.Labels[0].Value] = append(received[ts.Labels[0].Value], ts.Samples...)
+		}
+		if r.Header.Get("X-Scope-OrgID") != "tenant" {
+			http.Error(w, "missing tenant", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	series := []*Series{{
+		Labels:  labels.FromStrings("__name__", "a"),
+		Samples: []Sample{{T: 1, V: 1}, {T: 2, V: 2}, {T: 3, V: 3}},
+	}, {
+		Labels:  labels.FromStrings("__name__", "b"),
+		Samples: []Sample{{T: 1, V: 4}},
+	}}
+	opts := ReplayOptions{
+		URL:         srv.URL,
+		Headers:     map[string]string{"X-Scope-OrgID": "tenant"},
+		Concurrency: 2,
+		BatchSize:   2,
+		Timeout:     time.Second,
+	}
+
+	stats, err := Replay(context.Background(), series, opts)
+	require.NoError(t, err)
+	require.Equal(t, ReplayStats{Series: 2, Samples: 4, Requests: 3}, stats)
+	require.Equal(t, []prompb.Sample{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}, {Timestamp: 3, Value: 3}}, received["a"])
+	require.Equal(t, []prompb.Sample{{Timestamp: 1, Value: 4}}, received["b"])
+
+	// Rejected requests are reported without aborting the replay.
+	opts.Headers = nil
+	stats, err = Replay(context.Background(), series, opts)
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.FailedRequests)
+	require.Equal(t, 4, stats.FailedSamples)
+	require.ErrorContains(t, stats.LastError, "missing tenant")
+}
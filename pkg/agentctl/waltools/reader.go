@@ -0,0 +1,205 @@
+package waltools
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+// SeriesReader reads the series of a WAL with their samples in batches, in
+// the order they were written. Unlike ReadSeries, which reads the whole WAL
+// on every call, a SeriesReader reads the checkpoint and every segment once:
+// it keeps the series it read and its position in the WAL across batches.
+type SeriesReader struct {
+	selector    labels.Selector
+	sources     []walSource
+	labelsByRef map[chunks.HeadSeriesRef]labels.Labels
+	dec         sampleDecoder
+
+	source  int       // Index of the source being read.
+	records int       // Number of records read from the source.
+	closer  io.Closer // Closes the source being read, if it's open.
+	r       *wlog.Reader
+}
+
+// walSource is the checkpoint or a segment of a WAL.
+type walSource struct {
+	path       string
+	checkpoint bool
+}
+
+// NewSeriesReader returns a SeriesReader reading the series matching the
+// given label selector from the WAL in walDir. Only the segments up to
+// lastSegment are read if it isn't negative, which allows reading the
+// segments of a WAL which aren't written to anymore while it's in use.
+func NewSeriesReader(walDir string, selectorStr string, lastSegment int) (*SeriesReader, error) {
+	selector, err := parser.ParseMetricSelector(selectorStr)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, checkpointIdx, err := wlog.LastCheckpoint(walDir)
+	if err != nil && err != record.ErrNotFound {
+		return nil, err
+	}
+	first, last, err := wlog.Segments(walDir)
+	if err != nil {
+		return nil, err
+	}
+	if lastSegment >= 0 && lastSegment < last {
+		last = lastSegment
+	}
+
+	var sources []walSource
+	if checkpoint != "" {
+		sources = append(sources, walSource{path: checkpoint, checkpoint: true})
+		first = checkpointIdx + 1
+	}
+	// Segments returns -1 for both bounds when there are no segments.
+	for i := max(first, 0); i <= last; i++ {
+		sources = append(sources, walSource{path: wlog.SegmentName(walDir, i)})
+	}
+
+	return &SeriesReader{
+		selector:    selector,
+		sources:     sources,
+		labelsByRef: make(map[chunks.HeadSeriesRef]labels.Labels),
+	}, nil
+}
+
+// Read reads the next records of the WAL until it read at least maxSamples
+// samples between mint and maxt inclusive, and returns the series with these
+// samples like ReadSeries. Samples outside of the time range are skipped. Read
+// returns io.EOF once the WAL was read entirely.
+//
+// If reading fails, the position of the reader is left unchanged, so that
+// calling Read again retries reading the same records.
+func (sr *SeriesReader) Read(mint, maxt int64, maxSamples int) ([]*Series, error) {
+	var (
+		startSource, startRecords = sr.source, sr.records
+		seriesByLabels            = make(map[string]*Series)
+		n                         int
+	)
+	add := func(ref chunks.HeadSeriesRef, s Sample) {
+		lbls, ok := sr.labelsByRef[ref]
+		if !ok || s.T < mint || s.T > maxt {
+			return
+		}
+
+		// Several refs can be assigned to the same labels, so series are
+		// merged by labels.
+		key := lbls.String()
+		series, ok := seriesByLabels[key]
+		if !ok {
+			series = &Series{Labels: lbls}
+			seriesByLabels[key] = series
+		}
+		series.Samples = append(series.Samples, s)
+		n++
+	}
+
+	for n < maxSamples && sr.source < len(sr.sources) {
+		err := sr.next(add)
+		if err == io.EOF {
+			sr.closeSource()
+			sr.source, sr.records = sr.source+1, 0
+			continue
+		} else if err != nil {
+			path := sr.sources[sr.source].path
+			sr.closeSource()
+			sr.source, sr.records = startSource, startRecords
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+	}
+
+	if n == 0 && sr.source >= len(sr.sources) {
+		return nil, io.EOF
+	}
+	return sortedSeries(seriesByLabels), nil
+}
+
+// next reads the next record of the current source. It returns io.EOF at the
+// end of the source.
+func (sr *SeriesReader) next(add func(chunks.HeadSeriesRef, Sample)) error {
+	if sr.r == nil {
+		if err := sr.openSource(); err != nil {
+			return err
+		}
+	}
+
+	if !sr.r.Next() {
+		if err := sr.r.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	sr.records++
+
+	rec := sr.r.Record()
+	if sr.dec.dec.Type(rec) != record.Series {
+		return sr.dec.Decode(rec, add)
+	}
+
+	series, err := sr.dec.dec.Series(rec, nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range series {
+		if sr.selector.Matches(s.Labels) {
+			sr.labelsByRef[s.Ref] = s.Labels.Copy()
+		}
+	}
+	return nil
+}
+
+// openSource opens the current source, and skips the records which were
+// already read from it.
+func (sr *SeriesReader) openSource() error {
+	src := sr.sources[sr.source]
+
+	var rc io.ReadCloser
+	if src.checkpoint {
+		var err error
+		if rc, err = wlog.NewSegmentsReader(src.path); err != nil {
+			return err
+		}
+	} else {
+		s, err := wlog.OpenReadSegment(src.path)
+		if err != nil {
+			return err
+		}
+		rc = wlog.NewSegmentBufReader(s)
+	}
+
+	sr.closer, sr.r = rc, wlog.NewReader(rc)
+	for i := 0; i < sr.records; i++ {
+		if !sr.r.Next() {
+			err := sr.r.Err()
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			sr.closeSource()
+			return err
+		}
+	}
+	return nil
+}
+
+// closeSource closes the current source if it's open.
+func (sr *SeriesReader) closeSource() {
+	if sr.closer != nil {
+		_ = sr.closer.Close()
+	}
+	sr.closer, sr.r = nil, nil
+}
+
+// Close closes the reader.
+func (sr *SeriesReader) Close() error {
+	sr.closeSource()
+	return nil
+}
@@ -0,0 +1,116 @@
+package waltools
+
+import (
+	"io"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesReader(t *testing.T) {
+	walDir := setupTestWAL(t)
+
+	sr, err := NewSeriesReader(walDir, `{__name__=~"metric_[01]"}`, -1)
+	require.NoError(t, err)
+	defer sr.Close()
+
+	series, err := sr.Read(2, 3, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*Series{{
+		Labels:  labels.FromStrings("__name__", "metric_0", "initial", "no", "instance", "test-instance", "job", "test-job"),
+		Samples: []Sample{{T: 2, V: 1}},
+	}, {
+		Labels:  labels.FromStrings("__name__", "metric_1", "initial", "yes", "instance", "test-instance", "job", "test-job"),
+		Samples: []Sample{{T: 3, V: 1}},
+	}}, series)
+
+	_, err = sr.Read(2, 3, 1)
+	require.ErrorIs(t, err, io.EOF)
+
+	// The samples are in the third segment.
+	sr, err = NewSeriesReader(walDir, `{__name__=~"metric_[01]"}`, 1)
+	require.NoError(t, err)
+	defer sr.Close()
+	_, err = sr.Read(2, 3, 1)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSeriesReader_Batches(t *testing.T) {
+	walDir := t.TempDir()
+	w, err := wlog.NewSize(log.NewNopLogger(), prometheus.NewRegistry(), walDir, wlog.DefaultSegmentSize, wlog.CompressionSnappy)
+	require.NoError(t, err)
+
+	var enc record.Encoder
+	require.NoError(t, w.Log(enc.Series([]record.RefSeries{
+		{Ref: 1, Labels: labels.FromStrings("__name__", "a")},
+		{Ref: 2, Labels: labels.FromStrings("__name__", "b")},
+	}, nil)))
+	require.NoError(t, w.Log(enc.Samples([]record.RefSample{{Ref: 1, T: 1, V: 1}, {Ref: 2, T: 1, V: 2}}, nil)))
+	_, err = w.NextSegment()
+	require.NoError(t, err)
+	require.NoError(t, w.Log(enc.Samples([]record.RefSample{{Ref: 1, T: 2, V: 3}}, nil)))
+	require.NoError(t, w.Log(enc.Samples([]record.RefSample{{Ref: 2, T: 3, V: 4}}, nil)))
+	require.NoError(t, w.Close())
+
+	sr, err := NewSeriesReader(walDir, `{__name__=~".+"}`, -1)
+	require.NoError(t, err)
+	defer sr.Close()
+
+	// Batches end with the record which makes them reach the number of
+	// samples, and series read in previous batches are kept.
+	series, err := sr.Read(0, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*Series{
+		{Labels: labels.FromStrings("__name__", "a"), Samples: []Sample{{T: 1, V: 1}}},
+		{Labels: labels.FromStrings("__name__", "b"), Samples: []Sample{{T: 1, V: 2}}},
+	}, series)
+
+	// Samples outside of the time range are skipped.
+	series, err = sr.Read(3, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, []*Series{
+		{Labels: labels.FromStrings("__name__", "b"), Samples: []Sample{{T: 3, V: 4}}},
+	}, series)
+
+	_, err = sr.Read(0, 10, 1)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSeriesReader_Retry(t *testing.T) {
+	walDir := t.TempDir()
+	w, err := wlog.NewSize(log.NewNopLogger(), prometheus.NewRegistry(), walDir, wlog.DefaultSegmentSize, wlog.CompressionNone)
+	require.NoError(t, err)
+
+	var enc record.Encoder
+	require.NoError(t, w.Log(enc.Series([]record.RefSeries{{Ref: chunks.HeadSeriesRef(1), Labels: labels.FromStrings("__name__", "a")}}, nil)))
+	require.NoError(t, w.Log(enc.Samples([]record.RefSample{{Ref: 1, T: 1, V: 1}}, nil)))
+	_, err = w.NextSegment()
+	require.NoError(t, err)
+	require.NoError(t, w.Log(enc.Samples([]record.RefSample{{Ref: 1, T: 2, V: 2}}, nil)))
+	require.NoError(t, w.Close())
+
+	sr, err := NewSeriesReader(walDir, `{__name__=~".+"}`, -1)
+	require.NoError(t, err)
+	defer sr.Close()
+
+	series, err := sr.Read(0, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, []Sample{{T: 1, V: 1}}, series[0].Samples)
+
+	// Failing to open the next segment leaves the position of the reader
+	// unchanged.
+	sr.sources[1].path += ".missing"
+	_, err = sr.Read(0, 10, 1)
+	require.Error(t, err)
+
+	sr.sources[1].path = wlog.SegmentName(walDir, 1)
+	series, err = sr.Read(0, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, []Sample{{T: 2, V: 2}}, series[0].Samples)
+}
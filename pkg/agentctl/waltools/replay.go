@@ -0,0 +1,211 @@
+package waltools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// ReplayOptions configures how series are pushed to a remote-write endpoint.
+type ReplayOptions struct {
+	// URL of the remote-write endpoint.
+	URL string
+	// Headers to add to requests, such as X-Scope-OrgID.
+	Headers map[string]string
+	// Concurrency is the number of concurrent requests. The samples of a
+	// series are always sent by the same worker, in order.
+	Concurrency int
+	// BatchSize is the maximum number of samples per request.
+	BatchSize int
+	// Timeout of requests.
+	Timeout time.Duration
+	// MaxRetries is the maximum number of retries of requests failing with
+	// recoverable errors. Requests are retried until they succeed if it's
+	// negative.
+	MaxRetries int
+
+	// Client sends the requests if set, in which case URL, Headers and Timeout
+	// are ignored. It allows to use the authentication and TLS settings of a
+	// remote-write endpoint.
+	Client remote.WriteClient
+}
+
+// ReplayStats are statistics on replayed samples.
+type ReplayStats struct {
+	Series         int
+	Samples        int
+	Requests       int
+	FailedSamples  int
+	FailedRequests int
+	// LastError is the last error of failed requests.
+	LastError error
+}
+
+// Replay pushes the samples of series to a remote-write endpoint. Requests
+// rejected by the endpoint are counted in the returned stats rather than
+// aborting the replay; an error is only returned when the replay can't
+// proceed.
+func Replay(ctx context.Context, series []*Series, opts ReplayOptions) (ReplayStats, error) {
+	var stats ReplayStats
+	if opts.Concurrency <= 0 || opts.BatchSize <= 0 {
+		return stats, fmt.Errorf("concurrency and batch size must be greater than 0")
+	}
+
+	client := opts.Client
+	if client == nil {
+		u, err := url.Parse(opts.URL)
+		if err != nil {
+			return stats, fmt.Errorf("invalid URL: %w", err)
+		}
+		client, err = remote.NewWriteClient("wal-replay", &remote.ClientConfig{
+			URL:              &config.URL{URL: u},
+			Timeout:          model.Duration(opts.Timeout),
+			HTTPClientConfig: config.DefaultHTTPClientConfig,
+			Headers:          opts.Headers,
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mut      sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			r := replayer{client: client, opts: opts}
+			err := r.run(ctx, series, worker)
+
+			mut.Lock()
+			defer mut.Unlock()
+			stats.Samples += r.stats.Samples
+			stats.Requests += r.stats.Requests
+			stats.FailedSamples += r.stats.FailedSamples
+			stats.FailedRequests += r.stats.FailedRequests
+			if r.stats.LastError != nil {
+				stats.LastError = r.stats.LastError
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats.Series = len(series)
+	return stats, firstErr
+}
+
+// replayer batches the samples of series into requests.
+type replayer struct {
+	client remote.WriteClient
+	opts   ReplayOptions
+
+	pending []prompb.TimeSeries
+	samples int
+	stats   ReplayStats
+}
+
+// run sends the series assigned to the given worker.
+func (r *replayer) run(ctx context.Context, series []*Series, worker int) error {
+	for i := worker; i < len(series); i += r.opts.Concurrency {
+		if err := r.add(ctx, series[i]); err != nil {
+			return err
+		}
+	}
+	return r.flush(ctx)
+}
+
+func (r *replayer) add(ctx context.Context, s *Series) error {
+	lbls := make([]prompb.Label, 0, s.Labels.Len())
+	s.Labels.Range(func(l labels.Label) {
+		lbls = append(lbls, prompb.Label{Name: l.Name, Value: l.Value})
+	})
+
+	ts := prompb.TimeSeries{Labels: lbls}
+	for _, sample := range s.Samples {
+		switch {
+		case sample.H != nil:
+			ts.Histograms = append(ts.Histograms, remote.HistogramToHistogramProto(sample.T, sample.H))
+		case sample.FH != nil:
+			ts.Histograms = append(ts.Histograms, remote.FloatHistogramToHistogramProto(sample.T, sample.FH))
+		default:
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: sample.T, Value: sample.V})
+		}
+		r.samples++
+
+		if r.samples >= r.opts.BatchSize {
+			r.pending = append(r.pending, ts)
+			if err := r.flush(ctx); err != nil {
+				return err
+			}
+			ts = prompb.TimeSeries{Labels: lbls}
+		}
+	}
+	if len(ts.Samples) > 0 || len(ts.Histograms) > 0 {
+		r.pending = append(r.pending, ts)
+	}
+	return nil
+}
+
+// flush sends the pending samples, retrying recoverable errors.
+func (r *replayer) flush(ctx context.Context) error {
+	if r.samples == 0 {
+		return nil
+	}
+	defer func() {
+		r.pending = r.pending[:0]
+		r.samples = 0
+	}()
+
+	req := prompb.WriteRequest{Timeseries: r.pending}
+	buf, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	compressed := snappy.Encode(nil, buf)
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err = r.client.Store(ctx, compressed, attempt)
+
+		var recoverable remote.RecoverableError
+		if err == nil || !errors.As(err, &recoverable) || (r.opts.MaxRetries >= 0 && attempt >= r.opts.MaxRetries) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+
+	r.stats.Requests++
+	r.stats.Samples += r.samples
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.stats.FailedRequests++
+		r.stats.FailedSamples += r.samples
+		r.stats.LastError = err
+	}
+	return nil
+}
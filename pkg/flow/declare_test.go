@@ -0,0 +1,318 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/pkg/flow/internal/testcomponents"
+	"github.com/stretchr/testify/require"
+)
+
+const declareConfig = `
+	declare "greeter" {
+		argument "name" {
+			type = "string"
+		}
+		argument "greeting" {
+			type     = "string"
+			optional = true
+			default  = "hello"
+		}
+
+		testcomponents.passthrough "greet" {
+			input = argument.greeting.value + ", " + argument.name.value
+		}
+
+		export "message" {
+			value = testcomponents.passthrough.greet.output
+		}
+	}
+
+	declare "shouter" {
+		argument "name" {}
+
+		greeter "inner" {
+			name     = argument.name.value
+			greeting = "HEY"
+		}
+
+		export "message" {
+			value = greeter.inner.message + "!"
+		}
+	}
+`
+
+func TestDeclare(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	config := declareConfig + `
+	greeter "default" {
+		name = "world"
+	}
+
+	shouter "default" {
+		name = "you"
+	}
+
+	testcomponents.passthrough "out" {
+		input = greeter.default.message
+	}
+	`
+
+	ctrl := newTestController(t)
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	_, out := getFields(t, ctrl.loader.Graph(), "greeter.default")
+	require.Equal(t, map[string]any{"message": "hello, world"}, out)
+
+	_, out = getFields(t, ctrl.loader.Graph(), "shouter.default")
+	require.Equal(t, map[string]any{"message": "HEY, you!"}, out)
+
+	_, out = getFields(t, ctrl.loader.Graph(), "testcomponents.passthrough.out")
+	require.Equal(t, "hello, world", out.(testcomponents.PassthroughExports).Output)
+
+	// Each instance runs as a module with its own components.
+	require.Eventually(t, func() bool {
+		_, found := ctrl.modules.Get("greeter.default")
+		return found
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changing the declaration updates existing instances even if their
+	// arguments didn't change, as well as the instances of declarations
+	// using it.
+	f, err = ParseSource(t.Name(), []byte(`
+	declare "greeter" {
+		argument "name" {}
+		argument "greeting" {
+			optional = true
+		}
+
+		export "message" {
+			value = "goodbye, " + argument.name.value
+		}
+	}
+
+	declare "shouter" {
+		argument "name" {}
+
+		greeter "inner" {
+			name     = argument.name.value
+			greeting = "HEY"
+		}
+
+		export "message" {
+			value = greeter.inner.message + "!"
+		}
+	}
+
+	greeter "default" {
+		name = "world"
+	}
+
+	shouter "default" {
+		name = "you"
+	}
+	`))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	_, out = getFields(t, ctrl.loader.Graph(), "greeter.default")
+	require.Equal(t, map[string]any{"message": "goodbye, world"}, out)
+
+	_, out = getFields(t, ctrl.loader.Graph(), "shouter.default")
+	require.Equal(t, map[string]any{"message": "goodbye, you!"}, out)
+}
+
+func TestDeclare_UntypedArgument(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	// The type of arguments isn't inferred from their default.
+	config := `
+	declare "a" {
+		argument "x" {
+			optional = true
+			default  = "one"
+		}
+
+		export "out" {
+			value = argument.x.value
+		}
+	}
+
+	a "default" {
+		x = 1
+	}
+	`
+
+	ctrl := newTestController(t)
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	_, out := getFields(t, ctrl.loader.Graph(), "a.default")
+	require.Equal(t, map[string]any{"out": 1}, out)
+}
+
+func TestDeclare_Errors(t *testing.T) {
+	tt := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name: "unknown argument",
+			config: declareConfig + `
+			greeter "default" {
+				name = "world"
+				nmae = "typo"
+			}`,
+			expectedErr: `unrecognized argument "nmae" for custom component "greeter"`,
+		},
+		{
+			name: "missing required argument",
+			config: declareConfig + `
+			greeter "default" {
+				greeting = "hi"
+			}`,
+			expectedErr: `missing required argument "name" for custom component "greeter"`,
+		},
+		{
+			name: "argument type",
+			config: declareConfig + `
+			greeter "default" {
+				name     = "world"
+				greeting = 42
+			}`,
+			expectedErr: `argument "greeting" of custom component "greeter" must be string, got number`,
+		},
+		{
+			name: "declared argument type",
+			config: declareConfig + `
+			greeter "default" {
+				name = 42
+			}`,
+			expectedErr: `argument "name" of custom component "greeter" must be string, got number`,
+		},
+		{
+			name: "evaluated argument type",
+			config: declareConfig + `
+			testcomponents.passthrough "name" {
+				input = "world"
+			}
+
+			greeter "default" {
+				name = [testcomponents.passthrough.name.output]
+			}`,
+			expectedErr: `argument "name" of custom component "greeter" must be string, got array`,
+		},
+		{
+			name: "invalid argument type",
+			config: `
+			declare "a" {
+				argument "x" {
+					type = "text"
+				}
+			}`,
+			expectedErr: `invalid type "text"`,
+		},
+		{
+			name: "default of another type",
+			config: `
+			declare "a" {
+				argument "x" {
+					type     = "number"
+					optional = true
+					default  = "one"
+				}
+			}`,
+			expectedErr: `default must be number, got string`,
+		},
+		{
+			name: "nested block",
+			config: declareConfig + `
+			greeter "default" {
+				name = "world"
+				extra {}
+			}`,
+			expectedErr: `unrecognized block "extra" for custom component "greeter"`,
+		},
+		{
+			name: "missing label",
+			config: declareConfig + `
+			greeter {
+				name = "world"
+			}`,
+			expectedErr: `Component "greeter" must have a label`,
+		},
+		{
+			name: "duplicate declaration",
+			config: declareConfig + `
+			declare "greeter" {}`,
+			expectedErr: `declare "greeter" already declared`,
+		},
+		{
+			name: "missing declare label",
+			config: `
+			declare {}`,
+			expectedErr: `declare block must have a label`,
+		},
+		{
+			name: "recursive declaration",
+			config: `
+			declare "a" {
+				b "inner" {}
+			}
+
+			declare "b" {
+				a "inner" {}
+			}`,
+			expectedErr: `instantiates itself through`,
+		},
+		{
+			name: "unknown declaration",
+			config: `
+			declare "a" {}
+
+			b "default" {}`,
+			expectedErr: `Unrecognized component name "b"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := New(testOptions(t))
+			defer cleanUpController(ctrl)
+
+			f, err := ParseSource(t.Name(), []byte(tc.config))
+			require.NoError(t, err)
+
+			err = ctrl.LoadSource(f, nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -49,6 +49,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/grafana/agent/pkg/flow/internal/controller"
 	"github.com/grafana/agent/pkg/flow/internal/worker"
@@ -100,8 +101,22 @@ type Options struct {
 	// Services are configured when LoadFile is invoked. Services are started
 	// when the Flow controller runs after LoadFile is invoked at least once.
 	Services []service.Service
+
+	// DrainTimeout is the maximum amount of time each component may spend
+	// flushing its in-flight data when the controller shuts down or when the
+	// component is removed. Components are stopped immediately if DrainTimeout
+	// is 0.
+	DrainTimeout time.Duration
+
+	// ComponentRegistry is where the components used by loaded sources are
+	// looked up, including within modules. Components registered to the
+	// component package are used if ComponentRegistry is nil.
+	ComponentRegistry ComponentRegistry
 }
 
+// ComponentRegistry looks up components by name.
+type ComponentRegistry = controller.ComponentRegistry
+
 // Flow is the Flow system.
 type Flow struct {
 	log    *logging.Logger
@@ -113,10 +128,17 @@ type Flow struct {
 	loader      *controller.Loader
 	modules     *moduleRegistry
 
-	loadFinished chan struct{}
+	loadFinished  chan struct{}
+	importUpdated chan struct{}
 
 	loadMut    sync.RWMutex
 	loadedOnce atomic.Bool
+	lastSource *Source                 // Source of the most recent load, reloaded when imports change.
+	lastApply  controller.ApplyOptions // Options of the most recent load.
+
+	lastGood      *Source                 // Most recent source loaded without errors.
+	lastGoodApply controller.ApplyOptions // Options used to load lastGood.
+	loadStatus    LoadStatus              // Result of the most recent load.
 }
 
 // New creates a new, unstarted Flow controller. Call Run to run the controller.
@@ -134,9 +156,9 @@ func New(o Options) *Flow {
 type controllerOptions struct {
 	Options
 
-	ComponentRegistry controller.ComponentRegistry // Custom component registry used in tests.
-	ModuleRegistry    *moduleRegistry              // Where to register created modules.
-	IsModule          bool                         // Whether this controller is for a module.
+	ModuleRegistry *moduleRegistry // Where to register created modules.
+	IsModule       bool            // Whether this controller is for a module.
+	ValidateOnly   bool            // Whether the controller only validates sources.
 	// A worker pool to evaluate components asynchronously. A default one will be created if this is nil.
 	WorkerPool worker.Pool
 }
@@ -171,13 +193,20 @@ func newController(o controllerOptions) *Flow {
 		opts:   o,
 
 		updateQueue: controller.NewQueue(),
-		sched:       controller.NewScheduler(),
 
 		modules: o.ModuleRegistry,
 
-		loadFinished: make(chan struct{}, 1),
+		loadFinished:  make(chan struct{}, 1),
+		importUpdated: make(chan struct{}, 1),
 	}
 
+	f.sched = controller.NewScheduler(controller.SchedulerOptions{
+		DrainTimeout: o.DrainTimeout,
+		OnDrain: func(id string, duration time.Duration, err error) {
+			f.loader.ObserveDrain(id, duration, err)
+		},
+	})
+
 	serviceMap := controller.NewServiceMap(o.Services)
 
 	f.loader = controller.NewLoader(controller.LoaderOptions{
@@ -203,6 +232,7 @@ func newController(o controllerOptions) *Flow {
 					ID:                id,
 					ServiceMap:        serviceMap.FilterByName(availableServices),
 					WorkerPool:        workerPool,
+					DrainTimeout:      o.DrainTimeout,
 				})
 			},
 			GetServiceData: func(name string) (interface{}, error) {
@@ -212,12 +242,20 @@ func newController(o controllerOptions) *Flow {
 				}
 				return svc.Data(), nil
 			},
+			OnImportUpdate: func(_ *controller.ImportConfigNode) {
+				select {
+				case f.importUpdated <- struct{}{}:
+				default:
+					// A reload is already scheduled
+				}
+			},
 		},
 
 		Services:          o.Services,
 		Host:              f,
 		ComponentRegistry: o.ComponentRegistry,
 		WorkerPool:        workerPool,
+		ValidateOnly:      o.ValidateOnly,
 	})
 
 	return f
@@ -225,14 +263,20 @@ func newController(o controllerOptions) *Flow {
 
 // Run starts the Flow controller, blocking until the provided context is
 // canceled. Run must only be called once.
+//
+// Once ctx is canceled, components are stopped in reverse dependency order:
+// components are only stopped after all the components which depend on them
+// have exited, so that sources stop before the components they send data to.
+// Components implementing component.Drainer are drained before being
+// stopped.
 func (f *Flow) Run(ctx context.Context) {
-	defer func() { _ = f.sched.Close() }()
 	defer f.loader.Cleanup(!f.opts.IsModule)
 	defer level.Debug(f.log).Log("msg", "flow controller exiting")
 
 	for {
 		select {
 		case <-ctx.Done():
+			f.shutdown()
 			return
 
 		case <-f.updateQueue.Chan():
@@ -241,18 +285,24 @@ func (f *Flow) Run(ctx context.Context) {
 			// it's picked up by the worker pool and the second time it's enqueued again, resulting in more evaluations.
 			all := f.updateQueue.DequeueAll()
 			f.loader.EvaluateDependencies(ctx, all)
+		case <-f.importUpdated:
+			f.reloadImports()
 		case <-f.loadFinished:
 			level.Info(f.log).Log("msg", "scheduling loaded components and services")
 
 			var (
 				components = f.loader.Components()
 				services   = f.loader.Services()
+				imports    = f.loader.Imports()
 
-				runnables = make([]controller.RunnableNode, 0, len(components)+len(services))
+				runnables = make([]controller.RunnableNode, 0, len(components)+len(services)+len(imports))
 			)
 			for _, c := range components {
 				runnables = append(runnables, c)
 			}
+			for _, in := range imports {
+				runnables = append(runnables, in)
+			}
 
 			// Only the root controller should run services, since modules share the
 			// same service instance as the root.
@@ -270,24 +320,95 @@ func (f *Flow) Run(ctx context.Context) {
 	}
 }
 
+// shutdown stops all running components and services in reverse dependency
+// order.
+func (f *Flow) shutdown() {
+	level.Info(f.log).Log("msg", "stopping components and services")
+
+	f.loadMut.RLock()
+	order := f.loader.ShutdownOrder()
+	f.loadMut.RUnlock()
+
+	_ = f.sched.Shutdown(order)
+}
+
 // LoadSource synchronizes the state of the controller with the current config
 // source. Components in the graph will be marked as unhealthy if there was an
 // error encountered during Load.
 //
 // The controller will only start running components after Load is called once
-// without any configuration errors.
+// without any configuration errors. Once a source was loaded without errors,
+// a source which fails to load in the root controller is rolled back: the
+// last good source is loaded again and the error is returned. Call LoadStatus
+// to get the differences between the sources and whether the load was rolled
+// back.
 func (f *Flow) LoadSource(source *Source, args map[string]any) error {
+	return f.loadSource(source, args, nil)
+}
+
+// loadSource implements LoadSource. declares holds the custom components
+// inherited by source, in addition to the ones declared within source.
+func (f *Flow) loadSource(source *Source, args map[string]any, declares map[string]*controller.Declare) error {
 	f.loadMut.Lock()
 	defer f.loadMut.Unlock()
 
-	diags := f.loader.Apply(args, source.components, source.configBlocks)
+	return f.apply(source, controller.ApplyOptions{
+		Args:            args,
+		ComponentBlocks: source.components,
+		ConfigBlocks:    source.configBlocks,
+		DeclareBlocks:   source.declareBlocks,
+		ImportBlocks:    source.importBlocks,
+		Declares:        declares,
+	})
+}
+
+// apply loads source with opts, records the result in the load status, and
+// rolls back to the last good source if loading it failed. f.loadMut must be
+// held.
+func (f *Flow) apply(source *Source, opts controller.ApplyOptions) error {
+	diff := DiffSources(f.lastGood, source)
+	if !diff.Empty() {
+		level.Info(f.log).Log(append([]interface{}{"msg", "applying source changes"}, diff.LogFields()...)...)
+	}
+
+	diags := f.loader.Apply(opts)
+	f.lastSource, f.lastApply = source, opts
+
+	status := LoadStatus{
+		Time:     time.Now(),
+		Diff:     diff,
+		Error:    diags.ErrorOrNil(),
+		LastGood: f.lastGood,
+	}
+	if !diags.HasErrors() {
+		f.lastGood, f.lastGoodApply = source, opts
+		status.LastGood = source
+	} else {
+		status.Failed = source
+	}
+
 	if !f.loadedOnce.Load() && diags.HasErrors() {
 		// The first call to Load should not run any components if there were
 		// errors in the configuration file.
+		f.loadStatus = status
 		return diags
 	}
 	f.loadedOnce.Store(true)
 
+	// Modules aren't rolled back: their sources and arguments are loaded by
+	// the components which own them, which report the error instead.
+	if diags.HasErrors() && f.lastGood != nil && !f.opts.IsModule {
+		level.Warn(f.log).Log("msg", "failed to load source, rolling back to the last good source", "err", diags.ErrorOrNil())
+
+		rollbackDiags := f.loader.Rollback(f.lastGoodApply)
+		if err := rollbackDiags.ErrorOrNil(); err != nil {
+			level.Error(f.log).Log("msg", "failed to roll back to the last good source", "err", err)
+		}
+		f.lastSource, f.lastApply = f.lastGood, f.lastGoodApply
+		status.RolledBack = !rollbackDiags.HasErrors()
+	}
+	f.loadStatus = status
+
 	select {
 	case f.loadFinished <- struct{}{}:
 	default:
@@ -296,6 +417,44 @@ func (f *Flow) LoadSource(source *Source, args map[string]any) error {
 	return diags.ErrorOrNil()
 }
 
+// LoadStatus describes the result of a call to LoadSource.
+type LoadStatus struct {
+	Time       time.Time  // When the source was loaded.
+	Diff       SourceDiff // Differences between the last good source and the loaded source.
+	Error      error      // Error encountered while loading the source, if any.
+	RolledBack bool       // Whether the last good source was loaded again without errors after Error.
+
+	LastGood *Source // Most recent source loaded without errors. May be nil.
+	Failed   *Source // Loaded source if loading it failed, otherwise nil.
+}
+
+// LoadStatus returns the result of the most recent call to LoadSource, or of
+// the most recent reload after the content of an import changed. The zero
+// value is returned if LoadSource was never called.
+func (f *Flow) LoadStatus() LoadStatus {
+	f.loadMut.RLock()
+	defer f.loadMut.RUnlock()
+	return f.loadStatus
+}
+
+// reloadImports reapplies the most recently loaded source after the content
+// of an import changed, so components using imported declarations are
+// reevaluated. Like LoadSource, a failed reload is recorded in the load status
+// and rolled back to the last good source.
+func (f *Flow) reloadImports() {
+	f.loadMut.Lock()
+	defer f.loadMut.Unlock()
+
+	if f.lastSource == nil {
+		return
+	}
+
+	level.Info(f.log).Log("msg", "reloading source after imported content changed")
+	if err := f.apply(f.lastSource, f.lastApply); err != nil {
+		level.Error(f.log).Log("msg", "failed to reload imported content", "err", err)
+	}
+}
+
 // Ready returns whether the Flow controller has finished its initial load.
 func (f *Flow) Ready() bool {
 	return f.loadedOnce.Load()
@@ -1,11 +1,13 @@
 package flow
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
 	"github.com/grafana/agent/pkg/flow/internal/dag"
+	"github.com/grafana/agent/pkg/flow/tap"
 )
 
 // GetComponent implements [component.Provider].
@@ -37,6 +39,33 @@ func (f *Flow) GetComponent(id component.ID, opts component.InfoOptions) (*compo
 	return f.getComponentDetail(cn, graph, opts), nil
 }
 
+// Tap implements [tap.Provider].
+func (f *Flow) Tap(ctx context.Context, id component.ID, opts tap.Options) (<-chan tap.Event, error) {
+	f.loadMut.RLock()
+	defer f.loadMut.RUnlock()
+
+	if id.ModuleID != "" {
+		mod, ok := f.modules.Get(id.ModuleID)
+		if !ok {
+			return nil, component.ErrComponentNotFound
+		}
+
+		return mod.f.Tap(ctx, component.ID{LocalID: id.LocalID}, opts)
+	}
+
+	node := f.loader.OriginalGraph().GetByID(id.LocalID)
+	if node == nil {
+		return nil, component.ErrComponentNotFound
+	}
+
+	cn, ok := node.(*controller.ComponentNode)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a component", id)
+	}
+
+	return cn.Tap(ctx, opts)
+}
+
 // ListComponents implements [component.Provider].
 func (f *Flow) ListComponents(moduleID string, opts component.InfoOptions) ([]*component.Info, error) {
 	f.loadMut.RLock()
@@ -91,6 +120,7 @@ func (f *Flow) getComponentDetail(cn *controller.ComponentNode, graph *dag.Graph
 		arguments component.Arguments
 		exports   component.Exports
 		debugInfo interface{}
+		stats     *component.Stats
 	)
 
 	if opts.GetHealth {
@@ -105,6 +135,10 @@ func (f *Flow) getComponentDetail(cn *controller.ComponentNode, graph *dag.Graph
 	if opts.GetDebugInfo {
 		debugInfo = cn.DebugInfo()
 	}
+	if opts.GetStats {
+		s := cn.Stats()
+		stats = &s
+	}
 
 	return &component.Info{
 		Component: cn.Component(),
@@ -125,5 +159,6 @@ func (f *Flow) getComponentDetail(cn *controller.ComponentNode, graph *dag.Graph
 		Arguments: arguments,
 		Exports:   exports,
 		DebugInfo: debugInfo,
+		Stats:     stats,
 	}
 }
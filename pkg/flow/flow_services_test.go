@@ -239,11 +239,11 @@ func TestFlow_GetServiceConsumers_Modules(t *testing.T) {
 
 	opts := testOptions(t)
 	opts.Services = append(opts.Services, svc)
+	opts.ComponentRegistry = registry
 
 	ctrl := newController(controllerOptions{
-		Options:           opts,
-		ComponentRegistry: registry,
-		ModuleRegistry:    newModuleRegistry(),
+		Options:        opts,
+		ModuleRegistry: newModuleRegistry(),
 	})
 	require.NoError(t, ctrl.LoadSource(f, nil))
 	go ctrl.Run(ctx)
@@ -325,11 +325,11 @@ func TestComponents_Using_Services(t *testing.T) {
 
 	opts := testOptions(t)
 	opts.Services = append(opts.Services, dependencySvc, nonDependencySvc)
+	opts.ComponentRegistry = registry
 
 	ctrl := newController(controllerOptions{
-		Options:           opts,
-		ComponentRegistry: registry,
-		ModuleRegistry:    newModuleRegistry(),
+		Options:        opts,
+		ModuleRegistry: newModuleRegistry(),
 	})
 	require.NoError(t, ctrl.LoadSource(f, nil))
 	go ctrl.Run(ctx)
@@ -406,11 +406,11 @@ func TestComponents_Using_Services_In_Modules(t *testing.T) {
 
 	opts := testOptions(t)
 	opts.Services = append(opts.Services, propagatedSvc, nonPropagatedSvc)
+	opts.ComponentRegistry = registry
 
 	ctrl := newController(controllerOptions{
-		Options:           opts,
-		ComponentRegistry: registry,
-		ModuleRegistry:    newModuleRegistry(),
+		Options:        opts,
+		ModuleRegistry: newModuleRegistry(),
 	})
 	require.NoError(t, ctrl.LoadSource(f, nil))
 	go ctrl.Run(ctx)
@@ -2,6 +2,7 @@ package flow
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 
@@ -96,3 +97,92 @@ func verifyNoGoroutineLeaks(t *testing.T) {
 		goleak.IgnoreTopFunction("go.opentelemetry.io/otel/sdk/trace.(*batchSpanProcessor).processQueue"),
 	)
 }
+
+func TestController_LoadSource_Rollback(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	good, err := ParseSource(t.Name(), []byte(testFile))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(good, nil))
+	forwarded := ctrl.loader.Graph().GetByID("testcomponents.passthrough.forwarded")
+
+	// Removes testcomponents.passthrough.forwarded and changes
+	// testcomponents.passthrough.static to reference an export which doesn't
+	// exist.
+	bad, err := ParseSource(t.Name(), []byte(`
+		testcomponents.tick "ticker" {
+			frequency = "1s"
+		}
+
+		testcomponents.passthrough "static" {
+			input = testcomponents.tick.ticker.missing
+		}
+
+		testcomponents.passthrough "ticker" {
+			input = testcomponents.tick.ticker.tick_time
+		}
+	`))
+	require.NoError(t, err)
+	require.Error(t, ctrl.LoadSource(bad, nil))
+
+	status := ctrl.LoadStatus()
+	require.Error(t, status.Error)
+	require.True(t, status.RolledBack)
+	require.Same(t, good, status.LastGood)
+	require.Same(t, bad, status.Failed)
+	require.Equal(t, []string{"testcomponents.passthrough.forwarded"}, status.Diff.Removed)
+	require.Equal(t, []string{"testcomponents.passthrough.static"}, status.Diff.Changed)
+
+	// The good source is loaded again, reusing the components the failed
+	// source removed.
+	require.Len(t, ctrl.loader.Components(), 4)
+	require.Same(t, forwarded, ctrl.loader.Graph().GetByID("testcomponents.passthrough.forwarded"))
+	in, _ := getFields(t, ctrl.loader.Graph(), "testcomponents.passthrough.static")
+	require.Equal(t, "hello, world!", in.(testcomponents.PassthroughConfig).Input)
+}
+
+func TestController_LoadSource_RollbackCustomComponent(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	const config = `
+		declare "greeter" {
+			argument "name" {}
+
+			testcomponents.passthrough "greet" {
+				input = %s
+			}
+			%s
+
+			export "message" {
+				value = testcomponents.passthrough.greet.output
+			}
+		}
+
+		greeter "default" {
+			name = "world"
+		}
+	`
+
+	good, err := ParseSource(t.Name(), []byte(fmt.Sprintf(config, `"hello, " + argument.name.value`, "")))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(good, nil))
+
+	// The body of the custom component fails to load after its first
+	// component was updated.
+	bad, err := ParseSource(t.Name(), []byte(fmt.Sprintf(config, `"bye"`, `
+			testcomponents.passthrough "invalid" {
+				input = testcomponents.passthrough.greet.missing
+			}`)))
+	require.NoError(t, err)
+	require.Error(t, ctrl.LoadSource(bad, nil))
+	require.True(t, ctrl.LoadStatus().RolledBack)
+
+	// The body is loaded again even though the arguments and declaration are
+	// the same as before the failed load.
+	_, out := getFields(t, ctrl.loader.Graph(), "greeter.default")
+	require.Equal(t, map[string]any{"message": "hello, world"}, out)
+}
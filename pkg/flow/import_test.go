@@ -0,0 +1,357 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/pkg/flow/internal/testcomponents"
+	"github.com/stretchr/testify/require"
+)
+
+const importLibrary = `
+	declare "greeter" {
+		argument "name" {}
+
+		testcomponents.passthrough "greet" {
+			input = "%s, " + argument.name.value
+		}
+
+		export "message" {
+			value = testcomponents.passthrough.greet.output
+		}
+	}
+
+	declare "shouter" {
+		argument "name" {}
+
+		greeter "inner" {
+			name = argument.name.value
+		}
+
+		export "message" {
+			value = greeter.inner.message + "!"
+		}
+	}
+`
+
+func TestImportFile(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	libPath := filepath.Join(t.TempDir(), "lib.river")
+	require.NoError(t, os.WriteFile(libPath, []byte(fmt.Sprintf(importLibrary, "hello")), 0664))
+
+	config := fmt.Sprintf(`
+	import.file "lib" {
+		filename       = %q
+		poll_frequency = "50ms"
+		detector       = "poll"
+	}
+
+	lib.greeter "default" {
+		name = "world"
+	}
+
+	lib.shouter "default" {
+		name = "you"
+	}
+
+	testcomponents.passthrough "out" {
+		input = lib.greeter.default.message
+	}
+	`, libPath)
+
+	ctrl := newTestController(t)
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	_, out := getFields(t, ctrl.loader.Graph(), "lib.greeter.default")
+	require.Equal(t, map[string]any{"message": "hello, world"}, out)
+
+	_, out = getFields(t, ctrl.loader.Graph(), "lib.shouter.default")
+	require.Equal(t, map[string]any{"message": "hello, you!"}, out)
+
+	_, out = getFields(t, ctrl.loader.Graph(), "testcomponents.passthrough.out")
+	require.Equal(t, "hello, world", out.(testcomponents.PassthroughExports).Output)
+
+	// Changing the imported file reloads the declarations and reevaluates the
+	// components using them.
+	require.NoError(t, os.WriteFile(libPath, []byte(fmt.Sprintf(importLibrary, "goodbye")), 0664))
+
+	require.Eventually(t, func() bool {
+		_, out := getFields(t, ctrl.loader.Graph(), "lib.greeter.default")
+		return out.(map[string]any)["message"] == "goodbye, world"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestImportHTTP(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, importLibrary, "hi")
+	}))
+	defer srv.Close()
+
+	config := fmt.Sprintf(`
+	import.http "lib" {
+		url = %q
+	}
+
+	lib.shouter "default" {
+		name = "there"
+	}
+	`, srv.URL)
+
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	_, out := getFields(t, ctrl.loader.Graph(), "lib.shouter.default")
+	require.Equal(t, map[string]any{"message": "hi, there!"}, out)
+}
+
+func TestImport_Errors(t *testing.T) {
+	// Libraries are served over HTTP so that no file watchers outlive the
+	// controllers which failed to load.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lib.river":
+			fmt.Fprintf(w, importLibrary, "hello")
+		case "/invalid.river":
+			fmt.Fprint(w, `testcomponents.passthrough "a" {}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		libURL     = srv.URL + "/lib.river"
+		invalidURL = srv.URL + "/invalid.river"
+	)
+
+	tt := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name: "missing file",
+			config: `
+			import.file "lib" {
+				filename = "/does/not/exist.river"
+			}`,
+			expectedErr: `Failed to evaluate import.file.lib`,
+		},
+		{
+			name: "missing label",
+			config: fmt.Sprintf(`
+			import.http {
+				url = %q
+			}`, libURL),
+			expectedErr: `import.http block must have a label`,
+		},
+		{
+			name: "duplicate namespace",
+			config: fmt.Sprintf(`
+			import.http "lib" {
+				url = %[1]q
+			}
+
+			import.git "lib" {
+				repository = "https://example.com/lib.git"
+				path       = "lib.river"
+			}`, libURL),
+			expectedErr: `import namespace "lib" already declared`,
+		},
+		{
+			name: "content other than declarations",
+			config: fmt.Sprintf(`
+			import.http "lib" {
+				url = %q
+			}`, invalidURL),
+			expectedErr: `content of import.http.lib may only contain declare blocks`,
+		},
+		{
+			name: "unqualified use",
+			config: fmt.Sprintf(`
+			import.http "lib" {
+				url = %q
+			}
+
+			greeter "default" {
+				name = "world"
+			}`, libURL),
+			expectedErr: `Unrecognized component name "greeter"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := New(testOptions(t))
+			defer cleanUpController(ctrl)
+
+			f, err := ParseSource(t.Name(), []byte(tc.config))
+			require.NoError(t, err)
+
+			err = ctrl.LoadSource(f, nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestImport_FailedSourceIsNotRun(t *testing.T) {
+	ctrl := New(testOptions(t))
+
+	f, err := ParseSource(t.Name(), []byte(`
+	import.file "lib" {
+		filename = "/does/not/exist.river"
+	}`))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctrl.LoadSource(f, nil), "Failed to evaluate import.file.lib")
+	require.Empty(t, ctrl.loader.Imports())
+
+	// Running the controller must not run the import source which failed.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctrl.Run(ctx)
+}
+
+func TestImport_FailedLoadKeepsImports(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, importLibrary, "hello")
+	}))
+	defer srv.Close()
+
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	// The import evaluates successfully, but the source fails to load, so
+	// the import isn't kept.
+	f, err := ParseSource(t.Name(), []byte(fmt.Sprintf(`
+	import.http "lib" {
+		url = %q
+	}
+
+	lib.greeter "default" {
+		unknown = "world"
+	}`, srv.URL)))
+	require.NoError(t, err)
+	require.Error(t, ctrl.LoadSource(f, nil))
+	require.Empty(t, ctrl.loader.Imports())
+}
+
+func TestImport_RetrievedWithoutLoaderLock(t *testing.T) {
+	var (
+		requested = make(chan struct{})
+		release   = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(requested)
+		<-release
+		fmt.Fprintf(w, importLibrary, "hello")
+	}))
+	defer srv.Close()
+
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	f, err := ParseSource(t.Name(), []byte(fmt.Sprintf(`
+	import.http "lib" {
+		url = %q
+	}`, srv.URL)))
+	require.NoError(t, err)
+
+	loaded := make(chan error)
+	go func() { loaded <- ctrl.LoadSource(f, nil) }()
+	<-requested
+
+	// The loader can be used while the content of the import is retrieved.
+	read := make(chan struct{})
+	go func() {
+		_ = ctrl.loader.Components()
+		close(read)
+	}()
+	select {
+	case <-read:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "loader is locked while retrieving imported content")
+	}
+
+	close(release)
+	require.NoError(t, <-loaded)
+	require.Len(t, ctrl.loader.Imports(), 1)
+}
+
+func TestImport_FailedReloadRollsBack(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	libPath := filepath.Join(t.TempDir(), "lib.river")
+	require.NoError(t, os.WriteFile(libPath, []byte(fmt.Sprintf(importLibrary, "hello")), 0664))
+
+	config := fmt.Sprintf(`
+	import.file "lib" {
+		filename       = %q
+		poll_frequency = "50ms"
+		detector       = "poll"
+	}
+
+	lib.greeter "default" {
+		name = "world"
+	}`, libPath)
+
+	ctrl := newTestController(t)
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Invalid imported content is reported in the load status, and the
+	// components keep using the last good declarations.
+	require.NoError(t, os.WriteFile(libPath, []byte(`testcomponents.passthrough "a" {}`), 0664))
+	require.Eventually(t, func() bool {
+		status := ctrl.LoadStatus()
+		return status.Error != nil && status.RolledBack
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorContains(t, ctrl.LoadStatus().Error, "may only contain declare blocks")
+
+	_, out := getFields(t, ctrl.loader.Graph(), "lib.greeter.default")
+	require.Equal(t, map[string]any{"message": "hello, world"}, out)
+
+	require.NoError(t, os.WriteFile(libPath, []byte(fmt.Sprintf(importLibrary, "goodbye")), 0664))
+	require.Eventually(t, func() bool {
+		_, out := getFields(t, ctrl.loader.Graph(), "lib.greeter.default")
+		return out.(map[string]any)["message"] == "goodbye, world"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, ctrl.LoadStatus().Error)
+}
@@ -163,3 +163,30 @@ func resolveTraversal(t Traversal, g *dag.Graph) (Reference, diag.Diagnostics) {
 	})
 	return Reference{}, diags
 }
+
+// BlockReferences returns the IDs of the blocks in ids which are referenced by
+// expressions in the body of b. Each ID is returned once, in the order it's
+// first referenced. References which don't resolve to any ID are ignored.
+func BlockReferences(b *ast.BlockStmt, ids map[string]struct{}) []string {
+	var (
+		refs []string
+		seen = make(map[string]struct{})
+	)
+
+	for _, t := range expressionsFromBody(b.Body) {
+		partial := ComponentID{}
+		for _, ident := range t {
+			partial = append(partial, ident.Name)
+			id := partial.String()
+			if _, ok := ids[id]; !ok {
+				continue
+			}
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				refs = append(refs, id)
+			}
+			break
+		}
+	}
+	return refs
+}
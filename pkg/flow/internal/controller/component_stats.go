@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Profiler labels set on the goroutines which run components. Goroutines
+// started by a component inherit the labels, so CPU and goroutine profiles
+// can be split per component, for example with `go tool pprof -tagfocus`.
+const (
+	ProfileLabelComponentID = "component_id"
+	ProfileLabelModuleID    = "module_id"
+)
+
+// goroutineSampleInterval is the minimum time between two goroutine profiles
+// taken to count the goroutines of components.
+const goroutineSampleInterval = 15 * time.Second
+
+// componentGoroutines counts goroutines per component for every controller
+// in the process.
+var componentGoroutines = &goroutineSampler{interval: goroutineSampleInterval}
+
+type goroutineKey struct {
+	moduleID, componentID string
+}
+
+// goroutineSampler counts goroutines by their component profiler labels.
+// Taking a goroutine profile briefly stops the world, so counts are cached
+// for interval.
+type goroutineSampler struct {
+	interval time.Duration
+
+	mut    sync.Mutex
+	last   time.Time
+	counts map[goroutineKey]int
+}
+
+// Count returns the number of goroutines labeled with the given module and
+// component ID, sampling a new goroutine profile if the previous one is
+// older than the sampling interval.
+func (s *goroutineSampler) Count(moduleID, componentID string) int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.counts == nil || time.Since(s.last) >= s.interval {
+		counts, err := sampleGoroutines()
+		if err != nil {
+			// Keep serving the previous counts; they're replaced on the next
+			// successful sample.
+			return s.counts[goroutineKey{moduleID, componentID}]
+		}
+		s.counts = counts
+		s.last = time.Now()
+	}
+	return s.counts[goroutineKey{moduleID, componentID}]
+}
+
+func sampleGoroutines() (map[goroutineKey]int, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[goroutineKey]int)
+	for _, sample := range p.Sample {
+		componentID := firstLabel(sample.Label, ProfileLabelComponentID)
+		if componentID == "" || len(sample.Value) == 0 {
+			continue
+		}
+		key := goroutineKey{
+			moduleID:    firstLabel(sample.Label, ProfileLabelModuleID),
+			componentID: componentID,
+		}
+		counts[key] += int(sample.Value[0])
+	}
+	return counts, nil
+}
+
+func firstLabel(labels map[string][]string, key string) string {
+	if values := labels[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutineSampler(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		stop    = make(chan struct{})
+		done    = make(chan struct{})
+	)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	labels := pprof.Labels(ProfileLabelComponentID, "test.component", ProfileLabelModuleID, "module.test")
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		// Goroutines inherit the labels of the goroutine which started them.
+		go func() {
+			defer close(done)
+			close(started)
+			<-stop
+		}()
+	})
+	<-started
+
+	s := &goroutineSampler{}
+	require.Equal(t, 1, s.Count("module.test", "test.component"))
+	require.Equal(t, 0, s.Count("", "test.component"))
+	require.Equal(t, 0, s.Count("module.test", "other.component"))
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/river/ast"
+)
+
+// DeclareModule is implemented by modules which can run the body of a declare
+// block. Custom components run their declaration within a DeclareModule.
+type DeclareModule interface {
+	component.Module
+
+	// LoadBody loads the body of a declare block into the module with the
+	// provided arguments. declares holds the custom components which can be
+	// used within body.
+	LoadBody(body ast.Body, args map[string]any, declares map[string]*Declare) error
+}
+
+// NewCustomComponentNode creates a new ComponentNode for a block which
+// instantiates the custom component declared by decl. Custom components may
+// use the services listed in services.
+func NewCustomComponentNode(globals ComponentGlobals, decl *Declare, services []string, b *ast.BlockStmt) *ComponentNode {
+	var cn *ComponentNode
+
+	reg := component.Registration{
+		Name:          decl.Name,
+		Args:          map[string]any(nil),
+		Exports:       map[string]any{},
+		NeedsServices: services,
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			// Build and Update are only invoked while cn.mut is held, so the
+			// current declaration can be read directly.
+			newArgs, ok := args.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("invalid arguments type %T for custom component", args)
+			}
+			return newCustomComponent(opts, func() *Declare { return cn.declare }, newArgs)
+		},
+	}
+
+	cn = NewComponentNode(globals, reg, b)
+	cn.declare = decl
+	return cn
+}
+
+// customComponent runs the body of a declare block as a module.
+type customComponent struct {
+	opts    component.Options
+	declare func() *Declare
+	mod     DeclareModule
+
+	mut         sync.RWMutex
+	health      component.Health
+	latestScope map[string]string // Content of the declarations in scope.
+	latestArgs  map[string]any
+
+	// failed is set when loading the body failed, leaving the module in an
+	// unknown state. The body is then reloaded by the next Update even if
+	// it's unchanged, such as when the last good source is rolled back to.
+	failed bool
+}
+
+var (
+	_ component.Component       = (*customComponent)(nil)
+	_ component.HealthComponent = (*customComponent)(nil)
+)
+
+func newCustomComponent(opts component.Options, declare func() *Declare, args map[string]any) (*customComponent, error) {
+	c := &customComponent{
+		opts:    opts,
+		declare: declare,
+	}
+
+	mod, err := opts.ModuleController.NewModule("", func(exports map[string]any) {
+		c.opts.OnStateChange(exports)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dm, ok := mod.(DeclareModule)
+	if !ok {
+		return nil, fmt.Errorf("module controller does not support custom components")
+	}
+	c.mod = dm
+
+	if err := c.Update(args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Run implements component.Component.
+func (c *customComponent) Run(ctx context.Context) error {
+	if err := c.mod.Run(ctx); err != nil {
+		level.Error(c.opts.Logger).Log("msg", "error running custom component", "id", c.opts.ID, "err", err)
+	}
+	return nil
+}
+
+// Update implements component.Component. The body of the declaration is only
+// reloaded if either the arguments or the declarations in its scope, which
+// include the declaration itself, changed, or if the last reload failed.
+func (c *customComponent) Update(args component.Arguments) error {
+	newArgs, ok := args.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid arguments type %T for custom component", args)
+	}
+
+	decl := c.declare()
+	scope := decl.ScopeContent()
+
+	c.mut.RLock()
+	unchanged := !c.failed && reflect.DeepEqual(newArgs, c.latestArgs) && reflect.DeepEqual(scope, c.latestScope)
+	c.mut.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	if err := c.mod.LoadBody(decl.Block.Body, newArgs, decl.Scope); err != nil {
+		c.mut.Lock()
+		c.failed = true
+		c.mut.Unlock()
+
+		c.setHealth(component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    fmt.Sprintf("failed to load custom component %q: %s", decl.Name, err),
+			UpdateTime: time.Now(),
+		})
+		return err
+	}
+
+	c.mut.Lock()
+	c.latestArgs = newArgs
+	c.latestScope = scope
+	c.failed = false
+	c.mut.Unlock()
+
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeHealthy,
+		Message:    "custom component loaded",
+		UpdateTime: time.Now(),
+	})
+	return nil
+}
+
+// CurrentHealth implements component.HealthComponent.
+func (c *customComponent) CurrentHealth() component.Health {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.health
+}
+
+func (c *customComponent) setHealth(h component.Health) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.health = h
+}
@@ -0,0 +1,412 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/diag"
+	"github.com/grafana/river/printer"
+	"github.com/grafana/river/vm"
+)
+
+const declareBlockID = "declare"
+
+// Declare is a custom component type defined by a declare block. Custom
+// components are instantiated like built-in components, using the label of
+// the declare block as the component name.
+type Declare struct {
+	// Name used to instantiate the custom component. Name is the label of the
+	// declare block, optionally prefixed with a namespace.
+	Name string
+
+	// Block is the declare block which defines the custom component.
+	Block *ast.BlockStmt
+
+	// Scope holds the declarations which can be used within the body of
+	// Block, including the declaration itself.
+	Scope map[string]*Declare
+
+	content   string            // Printed body of Block, used to detect changes.
+	arguments map[string]bool   // Declared arguments and whether they're optional.
+	types     map[string]string // Declared types of the arguments.
+	exports   []string          // Declared exports.
+}
+
+// NewDeclare creates a Declare named name from the declare block b. The
+// Scope of the returned Declare must be set by the caller.
+func NewDeclare(name string, b *ast.BlockStmt) (*Declare, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, b.Body); err != nil {
+		diags.Add(diag.Diagnostic{
+			Severity: diag.SeverityLevelError,
+			Message:  fmt.Sprintf("failed to read body of declare %q: %s", name, err),
+			StartPos: ast.StartPos(b).Position(),
+			EndPos:   ast.EndPos(b).Position(),
+		})
+	}
+
+	d := &Declare{
+		Name:      name,
+		Block:     b,
+		content:   buf.String(),
+		arguments: make(map[string]bool),
+		types:     make(map[string]string),
+	}
+
+	for _, stmt := range b.Body {
+		block, ok := stmt.(*ast.BlockStmt)
+		if !ok {
+			continue
+		}
+
+		switch block.GetBlockName() {
+		case exportBlockID:
+			d.exports = append(d.exports, block.Label)
+
+		case argumentBlockID:
+			optional, typ, err := argumentSettings(block)
+			if err != nil {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("invalid argument %q: %s", block.Label, err),
+					StartPos: ast.StartPos(block).Position(),
+					EndPos:   ast.EndPos(block).Position(),
+				})
+				continue
+			}
+			d.arguments[block.Label] = optional
+			if typ != "" {
+				d.types[block.Label] = typ
+			}
+		}
+	}
+
+	return d, diags
+}
+
+// Arguments returns the names of the arguments declared by d.
+func (d *Declare) Arguments() []string {
+	names := make([]string, 0, len(d.arguments))
+	for name := range d.arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// argumentSettings returns the value of the optional and type attributes of
+// an argument block, which must not reference other values. The type is
+// empty if values of any type are accepted, which is the default.
+func argumentSettings(b *ast.BlockStmt) (optional bool, typ string, err error) {
+	var (
+		declared     string
+		defaultValue any
+	)
+	for _, stmt := range b.Body {
+		attr, ok := stmt.(*ast.AttributeStmt)
+		if !ok {
+			continue
+		}
+
+		switch attr.Name.Name {
+		case "optional":
+			if err := vm.New(attr.Value).Evaluate(&vm.Scope{}, &optional); err != nil {
+				return false, "", fmt.Errorf("evaluating optional: %w", err)
+			}
+		case "type":
+			if err := vm.New(attr.Value).Evaluate(&vm.Scope{}, &declared); err != nil {
+				return false, "", fmt.Errorf("evaluating type: %w", err)
+			}
+			if err := validateArgumentType(declared); err != nil {
+				return false, "", err
+			}
+		case "default":
+			// Defaults which reference other values are type-checked once
+			// evaluated.
+			_ = vm.New(attr.Value).Evaluate(&vm.Scope{}, &defaultValue)
+		}
+	}
+
+	if declared == "" || declared == anyType {
+		return optional, "", nil
+	}
+	if err := checkType(declared, defaultValue); err != nil {
+		return false, "", fmt.Errorf("default %w", err)
+	}
+	return optional, declared, nil
+}
+
+// anyType is the type of arguments accepting values of any type.
+const anyType = "any"
+
+// argumentTypes are the types which can be declared by the type attribute of
+// argument blocks.
+var argumentTypes = []string{anyType, "string", "number", "bool", "array", "object"}
+
+// validateArgumentType returns an error if typ can't be declared by the type
+// attribute of argument blocks.
+func validateArgumentType(typ string) error {
+	for _, t := range argumentTypes {
+		if typ == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid type %q, must be one of %s", typ, strings.Join(argumentTypes, ", "))
+}
+
+// checkType returns an error if value doesn't have the type expect. Null
+// values, and values whose type can't be told, are accepted.
+func checkType(expect string, value any) error {
+	if expect == "" || expect == anyType {
+		return nil
+	}
+	if actual := valueType(value); actual != "" && actual != expect {
+		return fmt.Errorf("must be %s, got %s", expect, actual)
+	}
+	return nil
+}
+
+// valueType returns the River type of a value evaluated into an interface.
+// It returns an empty string for null values and for values whose River
+// type can't be told from their Go type, such as capsules.
+func valueType(v any) string {
+	if v == nil {
+		return ""
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "object"
+	default:
+		return ""
+	}
+}
+
+// CheckArguments type-checks the evaluated arguments of an instance of d
+// against the types of the declared arguments. Arguments without a type
+// accept values of any type.
+func (d *Declare) CheckArguments(args map[string]any) error {
+	for _, name := range d.Arguments() {
+		value, ok := args[name]
+		if !ok {
+			continue
+		}
+		if err := checkType(d.types[name], value); err != nil {
+			return fmt.Errorf("argument %q of custom component %q %w", name, d.Name, err)
+		}
+	}
+	return nil
+}
+
+// ScopeContent returns the printed body of every declaration in the scope
+// of d, by name. Instances of d are reloaded when it changes, as their body
+// may use any declaration of the scope.
+func (d *Declare) ScopeContent() map[string]string {
+	content := make(map[string]string, len(d.Scope))
+	for name, decl := range d.Scope {
+		content[name] = decl.content
+	}
+	return content
+}
+
+// ValidateInstance checks the block b, which instantiates the custom
+// component, against the arguments declared by d. Constant values are
+// type-checked here, and other values once evaluated, see CheckArguments.
+func (d *Declare) ValidateInstance(b *ast.BlockStmt) diag.Diagnostics {
+	var (
+		diags diag.Diagnostics
+		set   = make(map[string]struct{}, len(b.Body))
+	)
+
+	for _, stmt := range b.Body {
+		switch stmt := stmt.(type) {
+		case *ast.AttributeStmt:
+			name := stmt.Name.Name
+			if _, declared := d.arguments[name]; !declared {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("unrecognized argument %q for custom component %q", name, d.Name),
+					StartPos: ast.StartPos(stmt.Name).Position(),
+					EndPos:   ast.EndPos(stmt.Name).Position(),
+				})
+				continue
+			}
+			set[name] = struct{}{}
+
+			var value any
+			if err := vm.New(stmt.Value).Evaluate(&vm.Scope{}, &value); err != nil {
+				continue
+			}
+			if err := checkType(d.types[name], value); err != nil {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("argument %q of custom component %q %s", name, d.Name, err),
+					StartPos: ast.StartPos(stmt.Value).Position(),
+					EndPos:   ast.EndPos(stmt.Value).Position(),
+				})
+			}
+
+		case *ast.BlockStmt:
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("unrecognized block %q for custom component %q; custom components only accept attributes", strings.Join(stmt.Name, "."), d.Name),
+				StartPos: ast.StartPos(stmt).Position(),
+				EndPos:   ast.EndPos(stmt).Position(),
+			})
+		}
+	}
+
+	for name, optional := range d.arguments {
+		if _, ok := set[name]; ok || optional {
+			continue
+		}
+		diags.Add(diag.Diagnostic{
+			Severity: diag.SeverityLevelError,
+			Message:  fmt.Sprintf("missing required argument %q for custom component %q", name, d.Name),
+			StartPos: ast.StartPos(b).Position(),
+			EndPos:   ast.EndPos(b).Position(),
+		})
+	}
+
+	return diags
+}
+
+// loadDeclares builds the declarations available to components from the
+// declare blocks in blocks and the declarations inherited from a parent
+// scope. Declarations from blocks shadow inherited declarations with the
+// same name.
+func (l *Loader) loadDeclares(blocks []*ast.BlockStmt, inherited map[string]*Declare) (map[string]*Declare, diag.Diagnostics) {
+	var (
+		diags    diag.Diagnostics
+		declares = make(map[string]*Declare, len(blocks)+len(inherited))
+		local    = make(map[string]*ast.BlockStmt, len(blocks))
+		built    = make(map[string]*Declare, len(blocks))
+	)
+	for name, d := range inherited {
+		declares[name] = d
+	}
+
+	for _, block := range blocks {
+		name := block.Label
+
+		if name == "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  "declare block must have a label",
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		if orig, redefined := local[name]; redefined {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("declare %q already declared at %s", name, ast.StartPos(orig).Position()),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+		local[name] = block
+
+		if _, builtin := l.componentReg.Get(name); builtin {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("declare %q conflicts with the built-in component of the same name", name),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		d, declDiags := NewDeclare(name, block)
+		diags = append(diags, declDiags...)
+		if declDiags.HasErrors() {
+			continue
+		}
+
+		// Declarations in the same scope can use each other.
+		d.Scope = declares
+		declares[name] = d
+		built[name] = d
+	}
+
+	diags = append(diags, validateDeclareCycles(built)...)
+	return declares, diags
+}
+
+// validateDeclareCycles returns an error for every declaration in declares
+// which instantiates itself, either directly or through other custom
+// components used within its body.
+func validateDeclareCycles(declares map[string]*Declare) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for _, d := range declares {
+		if path := findDeclareCycle(d, d, nil); path != nil {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("declare %q instantiates itself through %s", d.Name, strings.Join(path, " -> ")),
+				StartPos: ast.StartPos(d.Block).Position(),
+				EndPos:   ast.EndPos(d.Block).Position(),
+			})
+		}
+	}
+	return diags
+}
+
+// findDeclareCycle searches the body of cur for instances of target. It
+// returns the names of the custom components leading to target, or nil if
+// target isn't instantiated.
+func findDeclareCycle(target, cur *Declare, path []string) []string {
+	path = append(path, cur.Name)
+	if len(path) > len(target.Scope)+1 {
+		// Cycles which don't include target are reported for the declarations
+		// they include.
+		return nil
+	}
+
+	// Declarations nested in the body shadow the ones from the scope.
+	nested := make(map[string]struct{})
+	for _, stmt := range cur.Block.Body {
+		if b, ok := stmt.(*ast.BlockStmt); ok && b.GetBlockName() == declareBlockID {
+			nested[b.Label] = struct{}{}
+		}
+	}
+
+	for _, stmt := range cur.Block.Body {
+		b, ok := stmt.(*ast.BlockStmt)
+		if !ok {
+			continue
+		}
+		if _, shadowed := nested[b.GetBlockName()]; shadowed {
+			continue
+		}
+		next, ok := cur.Scope[b.GetBlockName()]
+		if !ok {
+			continue
+		}
+		if next == target {
+			return append(path, next.Name)
+		}
+		if found := findDeclareCycle(target, next, path); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -31,6 +31,7 @@ type Loader struct {
 	host         service.Host
 	componentReg ComponentRegistry
 	workerPool   worker.Pool
+	validateOnly bool
 	// backoffConfig is used to backoff when an updated component's dependencies cannot be submitted to worker
 	// pool for evaluation in EvaluateDependencies, because the queue is full. This is an unlikely scenario, but when
 	// it happens we should avoid retrying too often to give other goroutines a chance to progress. Having a backoff
@@ -40,10 +41,13 @@ type Loader struct {
 	mut               sync.RWMutex
 	graph             *dag.Graph
 	originalGraph     *dag.Graph
+	goodGraph         *dag.Graph // Graph of the most recent Apply without errors, restored by Rollback.
 	componentNodes    []*ComponentNode
 	serviceNodes      []*ServiceNode
+	goodImports       loadedImports // Imports of the most recent Apply without errors, restored by Rollback.
 	cache             *valueCache
-	blocks            []*ast.BlockStmt // Most recently loaded blocks, used for writing
+	blocks            []*ast.BlockStmt    // Most recently loaded blocks, used for writing
+	declares          map[string]*Declare // Custom components available to the most recently loaded blocks
 	cm                *controllerMetrics
 	cc                *controllerCollector
 	moduleExportIndex int
@@ -58,6 +62,11 @@ type LoaderOptions struct {
 	Host              service.Host      // Service host (when running services).
 	ComponentRegistry ComponentRegistry // Registry to search for components.
 	WorkerPool        worker.Pool       // Worker pool to use for async tasks.
+
+	// ValidateOnly makes Apply check the loaded blocks without building
+	// components or updating services. The arguments of components and
+	// services are still decoded to type-check them.
+	ValidateOnly bool
 }
 
 // NewLoader creates a new Loader. Components built by the Loader will be built
@@ -82,6 +91,7 @@ func NewLoader(opts LoaderOptions) *Loader {
 		host:         host,
 		componentReg: reg,
 		workerPool:   opts.WorkerPool,
+		validateOnly: opts.ValidateOnly,
 
 		// This is a reasonable default which should work for most cases. If a component is completely stuck, we would
 		// retry and log an error every 10 seconds, at most.
@@ -92,6 +102,7 @@ func NewLoader(opts LoaderOptions) *Loader {
 
 		graph:         &dag.Graph{},
 		originalGraph: &dag.Graph{},
+		goodGraph:     &dag.Graph{},
 		cache:         newValueCache(),
 		cm:            newControllerMetrics(globals.ControllerID),
 	}
@@ -105,6 +116,27 @@ func NewLoader(opts LoaderOptions) *Loader {
 	return l
 }
 
+// ApplyOptions holds the set of blocks to load with Apply.
+type ApplyOptions struct {
+	Args map[string]any // Arguments passed to the argument blocks of a module.
+
+	ComponentBlocks []*ast.BlockStmt // Blocks for components and services.
+	ConfigBlocks    []*ast.BlockStmt // Blocks for logging, tracing, argument and export.
+	DeclareBlocks   []*ast.BlockStmt // Blocks declaring custom components.
+	ImportBlocks    []*ast.BlockStmt // Blocks importing custom components from other sources.
+
+	// Declares holds custom components inherited from a parent scope, such as
+	// the declarations available to the body of a custom component.
+	Declares map[string]*Declare
+
+	// ArgsUnknown reports that Args only hold placeholders for values which
+	// aren't known, such as when validating the body of a declare block. When
+	// the Loader only validates blocks, errors from evaluating attributes
+	// which reference arguments are then reported as warnings, since the
+	// placeholders may cause them.
+	ArgsUnknown bool
+}
+
 // Apply loads a new set of components into the Loader. Apply will drop any
 // previously loaded component which is not described in the set of River
 // blocks.
@@ -117,26 +149,66 @@ func NewLoader(opts LoaderOptions) *Loader {
 // The provided parentContext can be used to provide global variables and
 // functions to components. A child context will be constructed from the parent
 // to expose values of other components.
-func (l *Loader) Apply(args map[string]any, componentBlocks []*ast.BlockStmt, configBlocks []*ast.BlockStmt) diag.Diagnostics {
-	start := time.Now()
+func (l *Loader) Apply(opts ApplyOptions) diag.Diagnostics {
+	imports := l.loadImports(opts.ImportBlocks, opts.Declares)
+
 	l.mut.Lock()
 	defer l.mut.Unlock()
+	return l.apply(opts, imports)
+}
+
+// Rollback applies opts on top of the graph of the most recent Apply which
+// returned no errors, discarding the nodes of any failed Apply since then.
+// Nodes of the good graph are reused even if a failed Apply removed them, so
+// components which kept running aren't built again. opts should be the
+// options of that Apply.
+//
+// The arguments of the import nodes are restored, but the declarations
+// imported by that Apply are reused, since the failure may come from changed
+// imported content.
+func (l *Loader) Rollback(opts ApplyOptions) diag.Diagnostics {
+	_ = l.loadImports(opts.ImportBlocks, opts.Declares)
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.graph = l.goodGraph
+	return l.apply(opts, l.goodImports)
+}
+
+// apply implements Apply with the import nodes evaluated by loadImports.
+// l.mut must be held.
+func (l *Loader) apply(opts ApplyOptions, imports loadedImports) diag.Diagnostics {
+	start := time.Now()
 	l.cm.controllerEvaluation.Set(1)
 	defer l.cm.controllerEvaluation.Set(0)
 
+	args := opts.Args
 	for key, value := range args {
 		l.cache.CacheModuleArgument(key, value)
 	}
 	l.cache.SyncModuleArgs(args)
 
-	newGraph, diags := l.loadNewGraph(args, componentBlocks, configBlocks)
+	diags := imports.diags
+	if diags.HasErrors() {
+		return diags
+	}
+
+	declares, declareDiags := l.loadDeclares(opts.DeclareBlocks, imports.declares)
+	diags = append(diags, declareDiags...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	newGraph, graphDiags := l.loadNewGraph(args, declares, opts.ComponentBlocks, opts.ConfigBlocks)
+	diags = append(diags, graphDiags...)
 	if diags.HasErrors() {
 		return diags
 	}
 
 	var (
-		components   = make([]*ComponentNode, 0, len(componentBlocks))
-		componentIDs = make([]ComponentID, 0, len(componentBlocks))
+		components   = make([]*ComponentNode, 0, len(opts.ComponentBlocks))
+		componentIDs = make([]ComponentID, 0, len(opts.ComponentBlocks))
 		services     = make([]*ServiceNode, 0, len(l.services))
 	)
 
@@ -156,6 +228,9 @@ func (l *Loader) Apply(args map[string]any, componentBlocks []*ast.BlockStmt, co
 
 	l.cache.ClearModuleExports()
 
+	// Values which are only placeholders when validating blocks.
+	unknown := unknownValues{graph: &newGraph, argsUnknown: opts.ArgsUnknown}
+
 	// Evaluate all the components.
 	_ = dag.WalkTopological(&newGraph, newGraph.Leaves(), func(n dag.Node) error {
 		_, span := tracer.Start(spanCtx, "EvaluateNode", trace.WithSpanKind(trace.SpanKindInternal))
@@ -167,7 +242,10 @@ func (l *Loader) Apply(args map[string]any, componentBlocks []*ast.BlockStmt, co
 			level.Info(logger).Log("msg", "finished node evaluation", "node_id", n.NodeID(), "duration", time.Since(start))
 		}()
 
-		var err error
+		var (
+			err            error
+			nodeDiagsStart = len(diags)
+		)
 
 		switch n := n.(type) {
 		case *ComponentNode:
@@ -219,6 +297,13 @@ func (l *Loader) Apply(args map[string]any, componentBlocks []*ast.BlockStmt, co
 			}
 		}
 
+		// Errors which unknown values may cause are only warnings.
+		if bn, ok := n.(BlockNode); ok && l.validateOnly && unknown.causedBy(bn.Block(), err) {
+			for i := nodeDiagsStart; i < len(diags); i++ {
+				diags[i].Severity = diag.SeverityLevelWarn
+			}
+		}
+
 		// We only use the error for updating the span status; we don't return the
 		// error because we want to evaluate as many nodes as we can.
 		if err != nil {
@@ -232,8 +317,13 @@ func (l *Loader) Apply(args map[string]any, componentBlocks []*ast.BlockStmt, co
 	l.componentNodes = components
 	l.serviceNodes = services
 	l.graph = &newGraph
+	if !diags.HasErrors() {
+		l.goodGraph = l.graph
+		l.goodImports = imports
+	}
 	l.cache.SyncIDs(componentIDs)
-	l.blocks = componentBlocks
+	l.blocks = opts.ComponentBlocks
+	l.declares = declares
 	l.cm.componentEvaluationTime.Observe(time.Since(start).Seconds())
 	if l.globals.OnExportsChange != nil && l.cache.ExportChangeIndex() != l.moduleExportIndex {
 		l.moduleExportIndex = l.cache.ExportChangeIndex()
@@ -255,7 +345,7 @@ func (l *Loader) Cleanup(stopWorkerPool bool) {
 }
 
 // loadNewGraph creates a new graph from the provided blocks and validates it.
-func (l *Loader) loadNewGraph(args map[string]any, componentBlocks []*ast.BlockStmt, configBlocks []*ast.BlockStmt) (dag.Graph, diag.Diagnostics) {
+func (l *Loader) loadNewGraph(args map[string]any, declares map[string]*Declare, componentBlocks []*ast.BlockStmt, configBlocks []*ast.BlockStmt) (dag.Graph, diag.Diagnostics) {
 	var g dag.Graph
 
 	// Split component blocks into blocks for components and services.
@@ -270,7 +360,7 @@ func (l *Loader) loadNewGraph(args map[string]any, componentBlocks []*ast.BlockS
 	diags = append(diags, configBlockDiags...)
 
 	// Fill our graph with components.
-	componentNodeDiags := l.populateComponentNodes(&g, componentBlocks)
+	componentNodeDiags := l.populateComponentNodes(&g, declares, componentBlocks)
 	diags = append(diags, componentNodeDiags...)
 
 	// Write up the edges of the graph
@@ -419,8 +509,10 @@ func (l *Loader) populateConfigBlockNodes(args map[string]any, g *dag.Graph, con
 	return diags
 }
 
-// populateComponentNodes adds any components to the graph.
-func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.BlockStmt) diag.Diagnostics {
+// populateComponentNodes adds any components to the graph. Blocks which
+// don't refer to a built-in component may instantiate a custom component from
+// declares.
+func (l *Loader) populateComponentNodes(g *dag.Graph, declares map[string]*Declare, componentBlocks []*ast.BlockStmt) diag.Diagnostics {
 	var (
 		diags    diag.Diagnostics
 		blockMap = make(map[string]*ast.BlockStmt, len(componentBlocks))
@@ -440,34 +532,54 @@ func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.Blo
 		}
 		blockMap[id] = block
 
+		componentName := block.GetBlockName()
+		registration, exists := l.componentReg.Get(componentName)
+		decl, isCustom := declares[componentName]
+		if !exists && !isCustom {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("Unrecognized component name %q", componentName),
+				StartPos: block.NamePos.Position(),
+				EndPos:   block.NamePos.Add(len(componentName) - 1).Position(),
+			})
+			continue
+		}
+
+		if block.Label == "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("Component %q must have a label", componentName),
+				StartPos: block.NamePos.Position(),
+				EndPos:   block.NamePos.Add(len(componentName) - 1).Position(),
+			})
+			continue
+		}
+
+		if isCustom {
+			// Type-check the block against the declared arguments before
+			// building anything.
+			instanceDiags := decl.ValidateInstance(block)
+			diags = append(diags, instanceDiags...)
+			if instanceDiags.HasErrors() {
+				continue
+			}
+		}
+
 		// Check the graph from the previous call to Load to see we can copy an
 		// existing instance of ComponentNode.
+		//
+		// Declarations can't share the name of a built-in component, so existing
+		// nodes always manage the same kind of component as block.
 		if exist := l.graph.GetByID(id); exist != nil {
 			c = exist.(*ComponentNode)
 			c.UpdateBlock(block)
-		} else {
-			componentName := block.GetBlockName()
-			registration, exists := l.componentReg.Get(componentName)
-			if !exists {
-				diags.Add(diag.Diagnostic{
-					Severity: diag.SeverityLevelError,
-					Message:  fmt.Sprintf("Unrecognized component name %q", componentName),
-					StartPos: block.NamePos.Position(),
-					EndPos:   block.NamePos.Add(len(componentName) - 1).Position(),
-				})
-				continue
-			}
-
-			if block.Label == "" {
-				diags.Add(diag.Diagnostic{
-					Severity: diag.SeverityLevelError,
-					Message:  fmt.Sprintf("Component %q must have a label", componentName),
-					StartPos: block.NamePos.Position(),
-					EndPos:   block.NamePos.Add(len(componentName) - 1).Position(),
-				})
-				continue
+			if isCustom {
+				c.UpdateDeclare(decl)
 			}
-
+		} else if isCustom {
+			// Create a new custom component
+			c = NewCustomComponentNode(l.globals, decl, l.serviceNames(), block)
+		} else {
 			// Create a new component
 			c = NewComponentNode(l.globals, registration, block)
 		}
@@ -478,6 +590,15 @@ func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.Blo
 	return diags
 }
 
+// serviceNames returns the names of all services known to the Loader.
+func (l *Loader) serviceNames() []string {
+	names := make([]string, 0, len(l.services))
+	for _, svc := range l.services {
+		names = append(names, svc.Definition().Name)
+	}
+	return names
+}
+
 // Wire up all the related nodes
 func (l *Loader) wireGraphEdges(g *dag.Graph) diag.Diagnostics {
 	var diags diag.Diagnostics
@@ -547,6 +668,26 @@ func (l *Loader) Services() []*ServiceNode {
 	return l.serviceNodes
 }
 
+// Imports returns the current set of import nodes.
+func (l *Loader) Imports() []*ImportConfigNode {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	imports := make([]*ImportConfigNode, 0, len(l.goodImports.nodes))
+	for _, in := range l.goodImports.nodes {
+		imports = append(imports, in)
+	}
+	return imports
+}
+
+// Declares returns the custom components which were available to the most
+// recently loaded blocks.
+func (l *Loader) Declares() map[string]*Declare {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+	return l.declares
+}
+
 // Graph returns a copy of the DAG managed by the Loader.
 func (l *Loader) Graph() *dag.Graph {
 	l.mut.RLock()
@@ -562,6 +703,35 @@ func (l *Loader) OriginalGraph() *dag.Graph {
 	return l.originalGraph.Clone()
 }
 
+// ShutdownOrder returns the IDs of the nodes in the most recently loaded
+// graph in the order they should be stopped: nodes are grouped after all the
+// nodes which depend on them, so that components sending data are stopped
+// before the components they send data to.
+func (l *Loader) ShutdownOrder() [][]string {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	groups := dag.DependantsFirst(l.graph)
+	order := make([][]string, 0, len(groups))
+	for _, group := range groups {
+		ids := make([]string, 0, len(group))
+		for _, n := range group {
+			ids = append(ids, n.NodeID())
+		}
+		order = append(order, ids)
+	}
+	return order
+}
+
+// ObserveDrain records the result of draining the component with the given
+// node ID before it was stopped.
+func (l *Loader) ObserveDrain(id string, duration time.Duration, err error) {
+	l.cm.componentDrainTime.Observe(duration.Seconds())
+	if err != nil {
+		l.cm.componentDrainFailures.WithLabelValues(id).Inc()
+	}
+}
+
 // EvaluateDependencies sends components which depend directly on components in updatedNodes for evaluation to the
 // workerPool. It should be called whenever components update their exports.
 // It is beneficial to call EvaluateDependencies with a batch of components, as it will enqueue the entire batch before
@@ -696,9 +866,29 @@ func (l *Loader) concurrentEvalFn(n dag.Node, spanCtx context.Context, tracer tr
 
 // evaluate constructs the final context for the BlockNode and
 // evaluates it. mut must be held when calling evaluate.
+//
+// If the Loader only validates blocks, components and services are
+// validated instead of evaluated.
 func (l *Loader) evaluate(logger log.Logger, bn BlockNode) error {
 	ectx := l.cache.BuildContext()
-	err := bn.Evaluate(ectx)
+
+	var err error
+	switch n := bn.(type) {
+	case *ComponentNode:
+		if l.validateOnly {
+			err = n.Validate(ectx)
+		} else {
+			err = n.Evaluate(ectx)
+		}
+	case *ServiceNode:
+		if l.validateOnly {
+			err = n.Validate(ectx)
+		} else {
+			err = n.Evaluate(ectx)
+		}
+	default:
+		err = bn.Evaluate(ectx)
+	}
 	return l.postEvaluate(logger, bn, err)
 }
 
@@ -712,7 +902,7 @@ func (l *Loader) postEvaluate(logger log.Logger, bn BlockNode, err error) error
 		l.cache.CacheArguments(c.ID(), c.Arguments())
 		l.cache.CacheExports(c.ID(), c.Exports())
 	case *ArgumentConfigNode:
-		if _, found := l.cache.moduleArguments[c.Label()]; !found {
+		if value, found := l.cache.moduleArguments[c.Label()]; !found {
 			if c.Optional() {
 				l.cache.CacheModuleArgument(c.Label(), c.Default())
 			} else {
@@ -720,6 +910,10 @@ func (l *Loader) postEvaluate(logger log.Logger, bn BlockNode, err error) error
 				// a more important error to address.
 				err = fmt.Errorf("missing required argument %q to module", c.Label())
 			}
+		} else if err == nil {
+			if typeErr := checkType(c.Type(), value); typeErr != nil {
+				err = fmt.Errorf("argument %q to module %w", c.Label(), typeErr)
+			}
 		}
 	}
 
@@ -122,6 +122,19 @@ func TestLoader(t *testing.T) {
 		require.Nil(t, newGraph.GetByID("testcomponents.tick.remove_me")) // The new graph shouldn't have the old node
 	})
 
+	t.Run("Shutdown order", func(t *testing.T) {
+		l := controller.NewLoader(newLoaderOptions())
+		diags := applyFromContent(t, l, []byte(testFile), []byte(testConfig))
+		require.NoError(t, diags.ErrorOrNil())
+
+		// Components are stopped before the components they depend on.
+		require.Equal(t, [][]string{
+			{"logging", "testcomponents.passthrough.forwarded", "testcomponents.passthrough.static", "tracing"},
+			{"testcomponents.passthrough.ticker"},
+			{"testcomponents.tick.ticker"},
+		}, l.ShutdownOrder())
+	})
+
 	t.Run("Load with invalid components", func(t *testing.T) {
 		invalidFile := `
 			doesnotexist "bad_component" {
@@ -244,7 +257,10 @@ func applyFromContent(t *testing.T, l *controller.Loader, componentBytes []byte,
 		}
 	}
 
-	applyDiags := l.Apply(nil, componentBlocks, configBlocks)
+	applyDiags := l.Apply(controller.ApplyOptions{
+		ComponentBlocks: componentBlocks,
+		ConfigBlocks:    configBlocks,
+	})
 	diags = append(diags, applyDiags...)
 
 	return diags
@@ -10,6 +10,8 @@ type controllerMetrics struct {
 	componentEvaluationTime prometheus.Histogram
 	dependenciesWaitTime    prometheus.Histogram
 	evaluationQueueSize     prometheus.Gauge
+	componentDrainTime      prometheus.Histogram
+	componentDrainFailures  *prometheus.CounterVec
 }
 
 // newControllerMetrics inits the metrics for the components controller
@@ -43,6 +45,20 @@ func newControllerMetrics(id string) *controllerMetrics {
 		ConstLabels: map[string]string{"controller_id": id},
 	})
 
+	cm.componentDrainTime = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:        "agent_component_drain_seconds",
+			Help:        "Time spent by components flushing in-flight data before shutting down.",
+			ConstLabels: map[string]string{"controller_id": id},
+		},
+	)
+
+	cm.componentDrainFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "agent_component_drain_failures_total",
+		Help:        "Total number of times a component was stopped before it finished flushing its in-flight data.",
+		ConstLabels: map[string]string{"controller_id": id},
+	}, []string{"component_id"})
+
 	return cm
 }
 
@@ -51,6 +67,8 @@ func (cm *controllerMetrics) Collect(ch chan<- prometheus.Metric) {
 	cm.controllerEvaluation.Collect(ch)
 	cm.dependenciesWaitTime.Collect(ch)
 	cm.evaluationQueueSize.Collect(ch)
+	cm.componentDrainTime.Collect(ch)
+	cm.componentDrainFailures.Collect(ch)
 }
 
 func (cm *controllerMetrics) Describe(ch chan<- *prometheus.Desc) {
@@ -58,11 +76,16 @@ func (cm *controllerMetrics) Describe(ch chan<- *prometheus.Desc) {
 	cm.controllerEvaluation.Describe(ch)
 	cm.dependenciesWaitTime.Describe(ch)
 	cm.evaluationQueueSize.Describe(ch)
+	cm.componentDrainTime.Describe(ch)
+	cm.componentDrainFailures.Describe(ch)
 }
 
 type controllerCollector struct {
 	l                      *Loader
 	runningComponentsTotal *prometheus.Desc
+	componentGoroutines    *prometheus.Desc
+	componentReceivedItems *prometheus.Desc
+	componentSentItems     *prometheus.Desc
 }
 
 func newControllerCollector(l *Loader, id string) *controllerCollector {
@@ -74,6 +97,24 @@ func newControllerCollector(l *Loader, id string) *controllerCollector {
 			[]string{"health_type"},
 			map[string]string{"controller_id": id},
 		),
+		componentGoroutines: prometheus.NewDesc(
+			"agent_component_goroutines",
+			"Number of goroutines started on behalf of a component.",
+			[]string{"component_id"},
+			map[string]string{"controller_id": id},
+		),
+		componentReceivedItems: prometheus.NewDesc(
+			"agent_component_received_items_total",
+			"Total number of items received through the receivers exported by a component.",
+			[]string{"component_id"},
+			map[string]string{"controller_id": id},
+		),
+		componentSentItems: prometheus.NewDesc(
+			"agent_component_sent_items_total",
+			"Total number of items a component sent to the receivers of other components.",
+			[]string{"component_id"},
+			map[string]string{"controller_id": id},
+		),
 	}
 }
 
@@ -84,6 +125,11 @@ func (cc *controllerCollector) Collect(ch chan<- prometheus.Metric) {
 		health := component.CurrentHealth().Health.String()
 		componentsByHealth[health]++
 		component.registry.Collect(ch)
+
+		stats := component.Stats()
+		ch <- prometheus.MustNewConstMetric(cc.componentGoroutines, prometheus.GaugeValue, float64(stats.Goroutines), component.NodeID())
+		ch <- prometheus.MustNewConstMetric(cc.componentReceivedItems, prometheus.CounterValue, float64(stats.ItemsReceived), component.NodeID())
+		ch <- prometheus.MustNewConstMetric(cc.componentSentItems, prometheus.CounterValue, float64(stats.ItemsSent), component.NodeID())
 	}
 
 	for health, count := range componentsByHealth {
@@ -93,4 +139,7 @@ func (cc *controllerCollector) Collect(ch chan<- prometheus.Metric) {
 
 func (cc *controllerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.runningComponentsTotal
+	ch <- cc.componentGoroutines
+	ch <- cc.componentReceivedItems
+	ch <- cc.componentSentItems
 }
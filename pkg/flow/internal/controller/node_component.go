@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"runtime/pprof"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/pkg/flow/tap"
 	"github.com/grafana/agent/pkg/flow/tracing"
 	"github.com/grafana/river/ast"
 	"github.com/grafana/river/vm"
@@ -72,6 +74,7 @@ type ComponentGlobals struct {
 	ControllerID        string                                                       // ID of controller.
 	NewModuleController func(id string, availableServices []string) ModuleController // Func to generate a module controller.
 	GetServiceData      func(name string) (interface{}, error)                       // Get data for a service.
+	OnImportUpdate      func(in *ImportConfigNode)                                   // Informs controller that imported content changed
 }
 
 // ComponentNode is a controller node which manages a user-defined component.
@@ -82,6 +85,7 @@ type ComponentGlobals struct {
 type ComponentNode struct {
 	id                ComponentID
 	globalID          string
+	moduleID          string
 	label             string
 	componentName     string
 	nodeID            string // Cached from id.String() to avoid allocating new strings every time NodeID is called.
@@ -98,6 +102,7 @@ type ComponentNode struct {
 	eval    *vm.Evaluator
 	managed component.Component // Inner managed component
 	args    component.Arguments // Evaluated arguments for the managed component
+	declare *Declare            // Declaration of a custom component; nil for built-in components
 
 	// NOTE(rfratto): health and exports have their own mutex because they may be
 	// set asynchronously while mut is still being held (i.e., when calling Evaluate
@@ -109,9 +114,14 @@ type ComponentNode struct {
 
 	exportsMut sync.RWMutex
 	exports    component.Exports // Evaluated exports for the managed component
+
+	taps *tap.Hub // Taps into the receivers exported by the managed component
 }
 
-var _ BlockNode = (*ComponentNode)(nil)
+var (
+	_ BlockNode     = (*ComponentNode)(nil)
+	_ DrainableNode = (*ComponentNode)(nil)
+)
 
 // NewComponentNode creates a new ComponentNode from an initial ast.BlockStmt.
 // The underlying managed component isn't created until Evaluate is called.
@@ -140,6 +150,7 @@ func NewComponentNode(globals ComponentGlobals, reg component.Registration, b *a
 	cn := &ComponentNode{
 		id:                id,
 		globalID:          globalID,
+		moduleID:          globals.ControllerID,
 		label:             b.Label,
 		nodeID:            nodeID,
 		componentName:     strings.Join(b.Name, "."),
@@ -157,6 +168,8 @@ func NewComponentNode(globals ComponentGlobals, reg component.Registration, b *a
 
 		evalHealth: initHealth,
 		runHealth:  initHealth,
+
+		taps: tap.NewHub(),
 	}
 	cn.managedOpts = getManagedOptions(globals, cn)
 
@@ -241,6 +254,21 @@ func (cn *ComponentNode) UpdateBlock(b *ast.BlockStmt) {
 	cn.eval = vm.New(b.Body)
 }
 
+// UpdateDeclare updates the declaration of a custom component. The new
+// declaration isn't used until the next time Evaluate is invoked.
+//
+// UpdateDeclare will panic if the ComponentNode doesn't manage a custom
+// component.
+func (cn *ComponentNode) UpdateDeclare(decl *Declare) {
+	cn.mut.Lock()
+	defer cn.mut.Unlock()
+
+	if cn.declare == nil {
+		panic("UpdateDeclare called for a built-in component")
+	}
+	cn.declare = decl
+}
+
 // Evaluate implements BlockNode and updates the arguments for the managed component
 // by re-evaluating its River block with the provided scope. The managed component
 // will be built the first time Evaluate is called.
@@ -273,31 +301,95 @@ func (cn *ComponentNode) evaluate(scope *vm.Scope) error {
 	// components expect a non-pointer.
 	argsCopyValue := reflect.ValueOf(argsPointer).Elem().Interface()
 
+	// Instances of custom components are type-checked before being built or
+	// updated, so that invalid arguments fail the load.
+	if cn.declare != nil {
+		if err := cn.declare.CheckArguments(argsCopyValue.(map[string]any)); err != nil {
+			return err
+		}
+	}
+
+	if cn.declare == nil {
+		// Count the items the component sends to other components. Custom
+		// components are skipped, since the components they declare count
+		// their own items.
+		argsCopyValue = cn.taps.WrapArguments(argsCopyValue)
+	}
+
 	if cn.managed == nil {
-		// We haven't built the managed component successfully yet.
-		managed, err := cn.reg.Build(cn.managedOpts, argsCopyValue)
+		// We haven't built the managed component successfully yet. Goroutines
+		// started while building are labeled like the ones started by Run.
+		var (
+			managed component.Component
+			err     error
+		)
+		pprof.Do(context.Background(), cn.profileLabels(), func(context.Context) {
+			managed, err = cn.reg.Build(cn.managedOpts, argsCopyValue)
+		})
 		if err != nil {
 			return fmt.Errorf("building component: %w", err)
 		}
 		cn.managed = managed
 		cn.args = argsCopyValue
+		cn.taps.CommitArguments()
 
 		return nil
 	}
 
-	if reflect.DeepEqual(cn.args, argsCopyValue) {
+	if cn.declare == nil && reflect.DeepEqual(cn.args, argsCopyValue) {
 		// Ignore components which haven't changed. This reduces the cost of
 		// calling evaluate for components where evaluation is expensive (e.g., if
 		// re-evaluating requires re-starting some internal logic).
+		//
+		// Custom components are always updated, since their declaration may have
+		// changed even if their arguments didn't. They ignore updates which
+		// don't change either.
+		cn.taps.CommitArguments()
 		return nil
 	}
 
 	// Update the existing managed component
-	if err := cn.managed.Update(argsCopyValue); err != nil {
+	var err error
+	pprof.Do(context.Background(), cn.profileLabels(), func(context.Context) {
+		err = cn.managed.Update(argsCopyValue)
+	})
+	if err != nil {
 		return fmt.Errorf("updating component: %w", err)
 	}
 
 	cn.args = argsCopyValue
+	cn.taps.CommitArguments()
+	return nil
+}
+
+// Validate decodes the arguments of the component from its River block
+// without building or updating the managed component. Exports of custom
+// components are set to null for each declared export, so references to them
+// can be resolved.
+func (cn *ComponentNode) Validate(scope *vm.Scope) error {
+	cn.mut.Lock()
+	defer cn.mut.Unlock()
+
+	argsPointer := cn.reg.CloneArguments()
+	if err := cn.eval.Evaluate(scope, argsPointer); err != nil {
+		return fmt.Errorf("decoding River: %w", err)
+	}
+
+	if cn.declare != nil {
+		args := reflect.ValueOf(argsPointer).Elem().Interface().(map[string]any)
+		if err := cn.declare.CheckArguments(args); err != nil {
+			return err
+		}
+
+		exports := make(map[string]any, len(cn.declare.exports))
+		for _, name := range cn.declare.exports {
+			exports[name] = nil
+		}
+
+		cn.exportsMut.Lock()
+		cn.exports = exports
+		cn.exportsMut.Unlock()
+	}
 	return nil
 }
 
@@ -316,8 +408,19 @@ func (cn *ComponentNode) Run(ctx context.Context) error {
 		return ErrUnevaluated
 	}
 
+	// Subscribers to taps are disconnected once the component stops, and can
+	// subscribe again if it's restarted.
+	cn.taps.Open()
+	defer cn.taps.Close()
+
 	cn.setRunHealth(component.HealthTypeHealthy, "started component")
-	err := cn.managed.Run(ctx)
+
+	// Label the goroutines of the component so that profiles can be split
+	// per component.
+	var err error
+	pprof.Do(ctx, cn.profileLabels(), func(ctx context.Context) {
+		err = cn.managed.Run(ctx)
+	})
 
 	var exitMsg string
 	logger := cn.managedOpts.Logger
@@ -333,6 +436,57 @@ func (cn *ComponentNode) Run(ctx context.Context) error {
 	return err
 }
 
+// Drainable returns true if the managed component implements
+// component.Drainer.
+func (cn *ComponentNode) Drainable() bool {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+	_, ok := cn.managed.(component.Drainer)
+	return ok
+}
+
+// Drain flushes the in-flight data of the managed component if it implements
+// component.Drainer. Drain blocks until the data has been flushed or ctx is
+// canceled.
+func (cn *ComponentNode) Drain(ctx context.Context) error {
+	cn.mut.RLock()
+	drainer, ok := cn.managed.(component.Drainer)
+	cn.mut.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	var err error
+	pprof.Do(ctx, cn.profileLabels(), func(ctx context.Context) {
+		err = drainer.Drain(ctx)
+	})
+	if err != nil {
+		level.Warn(cn.managedOpts.Logger).Log("msg", "failed to drain component before shutdown", "err", err)
+	} else {
+		level.Debug(cn.managedOpts.Logger).Log("msg", "drained component before shutdown")
+	}
+	return err
+}
+
+// profileLabels returns the profiler labels of goroutines running on behalf
+// of the managed component.
+func (cn *ComponentNode) profileLabels() pprof.LabelSet {
+	return pprof.Labels(
+		ProfileLabelComponentID, cn.nodeID,
+		ProfileLabelModuleID, cn.moduleID,
+	)
+}
+
+// Stats returns the resource usage of the managed component.
+func (cn *ComponentNode) Stats() component.Stats {
+	return component.Stats{
+		Goroutines:    componentGoroutines.Count(cn.moduleID, cn.nodeID),
+		ItemsReceived: cn.taps.Received(),
+		ItemsSent:     cn.taps.Sent(),
+	}
+}
+
 // ErrUnevaluated is returned if ComponentNode.Run is called before a managed
 // component is built.
 var ErrUnevaluated = errors.New("managed component not built")
@@ -375,9 +529,12 @@ func (cn *ComponentNode) setExports(e component.Exports) {
 	// state to see if anything actually changed.
 	//
 	// To avoid needlessly reevaluating components we'll ignore unchanged
-	// exports.
+	// exports. Wrapped receivers are cached by the tap hub, so wrapping
+	// unchanged exports results in deeply equal exports.
 	var changed bool
 
+	e = cn.taps.WrapExports(e)
+
 	cn.exportsMut.Lock()
 	if !reflect.DeepEqual(cn.exports, e) {
 		changed = true
@@ -392,6 +549,12 @@ func (cn *ComponentNode) setExports(e component.Exports) {
 	}
 }
 
+// Tap subscribes to events from the receivers exported by the managed
+// component. See [tap.Hub.Subscribe] for details.
+func (cn *ComponentNode) Tap(ctx context.Context, opts tap.Options) (<-chan tap.Event, error) {
+	return cn.taps.Subscribe(ctx, opts)
+}
+
 // CurrentHealth returns the current health of the ComponentNode.
 //
 // The health of a ComponentNode is determined by combining:
@@ -1,10 +1,21 @@
 package controller
 
 import (
+	"context"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestGlobalID(t *testing.T) {
@@ -34,3 +45,68 @@ func TestLocalID(t *testing.T) {
 	})
 	require.Equal(t, "/data/local.id", filepath.ToSlash(mo.DataPath))
 }
+
+// TestComponentNode_Restart ensures that a component which is run again after
+// exiting can still send data.
+func TestComponentNode_Restart(t *testing.T) {
+	l, _ := logging.New(os.Stderr, logging.DefaultOptions)
+	reg := component.Registration{
+		Name: "testcomponents.sender",
+		Args: senderArguments{},
+		Build: func(_ component.Options, args component.Arguments) (component.Component, error) {
+			return &senderComponent{args: args.(senderArguments)}, nil
+		},
+	}
+	file, err := parser.ParseFile(t.Name(), []byte(`testcomponents.sender "a" { forward_to = [receiver] }`))
+	require.NoError(t, err)
+
+	cn := NewComponentNode(ComponentGlobals{
+		Logger:            l,
+		TraceProvider:     trace.NewNoopTracerProvider(),
+		DataPath:          t.TempDir(),
+		OnComponentUpdate: func(cn *ComponentNode) {},
+		Registerer:        prometheus.NewRegistry(),
+		NewModuleController: func(id string, availableServices []string) ModuleController {
+			return nil
+		},
+	}, reg, file.Body[0].(*ast.BlockStmt))
+
+	next := loki.NewLogsReceiver()
+	require.NoError(t, cn.Evaluate(&vm.Scope{Variables: map[string]any{"receiver": next}}))
+
+	// The component sends an entry and exits every time it runs, like a
+	// component which is restarted by the scheduler after failing.
+	for i := 0; i < 2; i++ {
+		done := make(chan error)
+		go func() { done <- cn.Run(context.Background()) }()
+
+		select {
+		case <-next.Chan():
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "entry was not forwarded", "run %d", i)
+		}
+		require.NoError(t, <-done)
+	}
+	require.Equal(t, uint64(2), cn.Stats().ItemsSent)
+}
+
+type senderArguments struct {
+	ForwardTo []loki.LogsReceiver `river:"forward_to,attr"`
+}
+
+type senderComponent struct {
+	args senderArguments
+}
+
+func (c *senderComponent) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case c.args.ForwardTo[0].Chan() <- loki.Entry{}:
+	}
+	return nil
+}
+
+func (c *senderComponent) Update(args component.Arguments) error {
+	c.args = args.(senderArguments)
+	return nil
+}
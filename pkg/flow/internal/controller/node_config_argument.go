@@ -18,6 +18,7 @@ type ArgumentConfigNode struct {
 	eval         *vm.Evaluator
 	defaultValue any
 	optional     bool
+	typ          string
 }
 
 var _ BlockNode = (*ArgumentConfigNode)(nil)
@@ -39,6 +40,7 @@ type argumentBlock struct {
 	Optional bool   `river:"optional,attr,optional"`
 	Default  any    `river:"default,attr,optional"`
 	Comment  string `river:"comment,attr,optional"`
+	Type     string `river:"type,attr,optional"`
 }
 
 // Evaluate implements BlockNode and updates the arguments for the managed config block
@@ -55,9 +57,18 @@ func (cn *ArgumentConfigNode) Evaluate(scope *vm.Scope) error {
 	if err := cn.eval.Evaluate(scope, &argument); err != nil {
 		return fmt.Errorf("decoding River: %w", err)
 	}
+	if argument.Type != "" {
+		if err := validateArgumentType(argument.Type); err != nil {
+			return err
+		}
+	}
+	if err := checkType(argument.Type, argument.Default); err != nil {
+		return fmt.Errorf("default of argument %q %w", cn.label, err)
+	}
 
 	cn.defaultValue = argument.Default
 	cn.optional = argument.Optional
+	cn.typ = argument.Type
 
 	return nil
 }
@@ -74,6 +85,14 @@ func (cn *ArgumentConfigNode) Default() any {
 	return cn.defaultValue
 }
 
+// Type returns the declared type of the argument, or an empty string if it
+// has none.
+func (cn *ArgumentConfigNode) Type() string {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+	return cn.typ
+}
+
 func (cn *ArgumentConfigNode) Label() string { return cn.label }
 
 // Block implements BlockNode and returns the current block of the managed config node.
@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/internal/importsource"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/pkg/flow/tracing"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/diag"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// ImportConfigNode is a controller node which retrieves River content from
+// an import source and exposes the custom components declared within it
+// under the namespace of the import block's label.
+//
+// Unlike other config blocks, import blocks are evaluated before the rest of
+// the graph is built and can't reference components.
+type ImportConfigNode struct {
+	nodeID         string
+	globalID       string
+	label          string
+	componentName  string
+	managedOpts    component.Options
+	onImportUpdate func(in *ImportConfigNode)
+
+	mut    sync.RWMutex
+	block  *ast.BlockStmt // Current River block to derive arguments from.
+	eval   *vm.Evaluator
+	source importsource.ImportSource
+	args   any // Most recently applied arguments for source.
+
+	contentMut sync.RWMutex
+	content    string // Most recently retrieved content of source.
+
+	healthMut  sync.RWMutex
+	evalHealth component.Health // Health of the last evaluation.
+
+	running atomic.Bool
+}
+
+var _ RunnableNode = (*ImportConfigNode)(nil)
+
+// NewImportConfigNode creates a new ImportConfigNode from an initial
+// ast.BlockStmt. The content of the import isn't retrieved until Evaluate is
+// called.
+func NewImportConfigNode(block *ast.BlockStmt, globals ComponentGlobals) *ImportConfigNode {
+	nodeID := BlockComponentID(block).String()
+
+	globalID := nodeID
+	if globals.ControllerID != "" {
+		globalID = path.Join(globals.ControllerID, nodeID)
+	}
+
+	in := &ImportConfigNode{
+		nodeID:         nodeID,
+		globalID:       globalID,
+		label:          block.Label,
+		componentName:  block.GetBlockName(),
+		onImportUpdate: globals.OnImportUpdate,
+
+		block: block,
+		eval:  vm.New(block.Body),
+
+		evalHealth: component.Health{
+			Health:     component.HealthTypeUnknown,
+			Message:    "import created",
+			UpdateTime: time.Now(),
+		},
+	}
+	in.managedOpts = component.Options{
+		ID:     globalID,
+		Logger: log.With(globals.Logger, "import", globalID),
+		Registerer: prometheus.WrapRegistererWith(prometheus.Labels{
+			"import_id": globalID,
+		}, prometheus.NewRegistry()),
+		Tracer:   tracing.WrapTracer(globals.TraceProvider, globalID),
+		DataPath: filepath.Join(globals.DataPath, globalID),
+		GetServiceData: func(name string) (interface{}, error) {
+			return nil, fmt.Errorf("import blocks can't access service data")
+		},
+	}
+	return in
+}
+
+// NodeID returns the unique ID for the node, such as import.file.LABEL.
+func (in *ImportConfigNode) NodeID() string { return in.nodeID }
+
+// Label returns the label of the import block, which is used as the
+// namespace of the imported declarations.
+func (in *ImportConfigNode) Label() string { return in.label }
+
+// Block returns the current block of the node.
+func (in *ImportConfigNode) Block() *ast.BlockStmt {
+	in.mut.RLock()
+	defer in.mut.RUnlock()
+	return in.block
+}
+
+// UpdateBlock updates the River block used to construct arguments for the
+// import source. The new block isn't used until the next time Evaluate is
+// invoked.
+//
+// UpdateBlock will panic if the block does not match the ID of the node.
+func (in *ImportConfigNode) UpdateBlock(b *ast.BlockStmt) {
+	if BlockComponentID(b).String() != in.nodeID {
+		panic("UpdateBlock called with an River block with a different ID")
+	}
+
+	in.mut.Lock()
+	defer in.mut.Unlock()
+	in.block = b
+	in.eval = vm.New(b.Body)
+}
+
+// Evaluate decodes the arguments of the import block and retrieves the
+// content of the import source. Import blocks may only use constant values
+// and the standard library, so they are evaluated with an empty scope.
+//
+// The source is only updated if its arguments changed since the last call to
+// Evaluate.
+func (in *ImportConfigNode) Evaluate() error {
+	err := in.evaluate()
+
+	in.healthMut.Lock()
+	defer in.healthMut.Unlock()
+	if err != nil {
+		in.evalHealth = component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    fmt.Sprintf("import evaluated with error: %s", err),
+			UpdateTime: time.Now(),
+		}
+	} else {
+		in.evalHealth = component.Health{
+			Health:     component.HealthTypeHealthy,
+			Message:    "import evaluated",
+			UpdateTime: time.Now(),
+		}
+	}
+	return err
+}
+
+func (in *ImportConfigNode) evaluate() error {
+	in.mut.Lock()
+	defer in.mut.Unlock()
+
+	if in.source == nil {
+		source, err := importsource.NewImportSource(in.componentName, importsource.Options{
+			Component:       in.managedOpts,
+			OnContentChange: in.setContent,
+		})
+		if err != nil {
+			return err
+		}
+		in.source = source
+	}
+
+	args := in.source.Arguments()
+	if err := in.eval.Evaluate(&vm.Scope{}, args); err != nil {
+		return fmt.Errorf("decoding River: %w", err)
+	}
+
+	if in.args != nil && reflect.DeepEqual(args, in.args) {
+		return nil
+	}
+	if err := in.source.Update(args); err != nil {
+		return fmt.Errorf("retrieving content: %w", err)
+	}
+	in.args = args
+	return nil
+}
+
+// setContent records new content from the import source. Once the node is
+// running, changes to the content are reported to the controller so the
+// declarations can be reloaded.
+func (in *ImportConfigNode) setContent(content string) {
+	in.contentMut.Lock()
+	changed := content != in.content
+	in.content = content
+	in.contentMut.Unlock()
+
+	if !changed || !in.running.Load() {
+		return
+	}
+	level.Info(in.managedOpts.Logger).Log("msg", "imported content changed")
+	if in.onImportUpdate != nil {
+		in.onImportUpdate(in)
+	}
+}
+
+// Content returns the most recently retrieved content of the import source.
+func (in *ImportConfigNode) Content() string {
+	in.contentMut.RLock()
+	defer in.contentMut.RUnlock()
+	return in.content
+}
+
+// Declares parses the imported content and returns the custom components
+// declared within it, keyed by their name qualified with the label of the
+// import block. Imported content may only contain declare blocks.
+//
+// Declarations within the imported content may use each other by their
+// unqualified name.
+func (in *ImportConfigNode) Declares() (map[string]*Declare, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	file, err := parser.ParseFile(in.nodeID, []byte(in.Content()))
+	if err != nil {
+		block := in.Block()
+		diags.Add(diag.Diagnostic{
+			Severity: diag.SeverityLevelError,
+			Message:  fmt.Sprintf("failed to parse content of %s: %s", in.nodeID, err),
+			StartPos: ast.StartPos(block).Position(),
+			EndPos:   ast.EndPos(block).Position(),
+		})
+		return nil, diags
+	}
+
+	var (
+		local     = make(map[string]*Declare)
+		qualified = make(map[string]*Declare)
+	)
+	for _, stmt := range file.Body {
+		block, ok := stmt.(*ast.BlockStmt)
+		if !ok || block.GetBlockName() != declareBlockID {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("content of %s may only contain declare blocks", in.nodeID),
+				StartPos: ast.StartPos(stmt).Position(),
+				EndPos:   ast.EndPos(stmt).Position(),
+			})
+			continue
+		}
+
+		if block.Label == "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  "declare block must have a label",
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+		if orig, redefined := local[block.Label]; redefined {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("declare %q already declared at %s", block.Label, ast.StartPos(orig.Block).Position()),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		name := in.label + "." + block.Label
+		d, declDiags := NewDeclare(name, block)
+		diags = append(diags, declDiags...)
+		if declDiags.HasErrors() {
+			continue
+		}
+		d.Scope = local
+		local[block.Label] = d
+		qualified[name] = d
+	}
+
+	diags = append(diags, validateDeclareCycles(local)...)
+	return qualified, diags
+}
+
+// Run runs the import source, watching it for changes until ctx is
+// canceled.
+func (in *ImportConfigNode) Run(ctx context.Context) error {
+	in.mut.RLock()
+	source := in.source
+	in.mut.RUnlock()
+
+	if source == nil {
+		return ErrUnevaluated
+	}
+
+	in.running.Store(true)
+	defer in.running.Store(false)
+
+	err := source.Run(ctx)
+	if err != nil {
+		level.Error(in.managedOpts.Logger).Log("msg", "import source exited with error", "err", err)
+	}
+	return err
+}
+
+// CurrentHealth returns the health of the import block, combining the health
+// of its last evaluation with the health of its source.
+func (in *ImportConfigNode) CurrentHealth() component.Health {
+	in.healthMut.RLock()
+	evalHealth := in.evalHealth
+	in.healthMut.RUnlock()
+
+	in.mut.RLock()
+	source := in.source
+	in.mut.RUnlock()
+
+	if source == nil {
+		return evalHealth
+	}
+	return component.LeastHealthy(evalHealth, source.CurrentHealth())
+}
+
+// loadedImports holds the import nodes evaluated by loadImports and the
+// declarations available to the loaded blocks.
+type loadedImports struct {
+	nodes    map[string]*ImportConfigNode
+	declares map[string]*Declare
+	diags    diag.Diagnostics
+}
+
+// loadImports evaluates the import blocks in blocks and returns the
+// declarations inherited from a parent scope merged with the imported
+// declarations. Import nodes of the most recent Apply without errors are
+// reused if their block is still present. Only import nodes which evaluated
+// successfully are returned; they replace the import nodes of the Loader once
+// the Apply succeeds.
+//
+// Evaluating import nodes retrieves their content, which may be slow for
+// remote sources, so loadImports must be called without holding l.mut.
+func (l *Loader) loadImports(blocks []*ast.BlockStmt, inherited map[string]*Declare) loadedImports {
+	l.mut.RLock()
+	existing := l.goodImports.nodes
+	l.mut.RUnlock()
+
+	var (
+		diags      diag.Diagnostics
+		declares   = make(map[string]*Declare, len(inherited))
+		namespaces = make(map[string]*ast.BlockStmt, len(blocks))
+		nodes      = make(map[string]*ImportConfigNode, len(blocks))
+	)
+	for name, d := range inherited {
+		declares[name] = d
+	}
+
+	for _, block := range blocks {
+		if block.Label == "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("%s block must have a label", block.GetBlockName()),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		if orig, redefined := namespaces[block.Label]; redefined {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("import namespace %q already declared at %s", block.Label, ast.StartPos(orig).Position()),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+		namespaces[block.Label] = block
+
+		id := BlockComponentID(block).String()
+		in, exist := existing[id]
+		if exist {
+			in.UpdateBlock(block)
+		} else {
+			in = NewImportConfigNode(block, l.globals)
+		}
+
+		// Nodes which failed to evaluate have no content to watch, they're
+		// neither recorded nor scheduled.
+		if err := in.Evaluate(); err != nil {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("Failed to evaluate %s: %s", id, err),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+		nodes[id] = in
+
+		imported, importDiags := in.Declares()
+		diags = append(diags, importDiags...)
+		for name, d := range imported {
+			if _, builtin := l.componentReg.Get(name); builtin {
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("imported declare %q conflicts with the built-in component of the same name", name),
+					StartPos: ast.StartPos(block).Position(),
+					EndPos:   ast.EndPos(block).Position(),
+				})
+				continue
+			}
+			declares[name] = d
+		}
+	}
+
+	return loadedImports{nodes: nodes, declares: declares, diags: diags}
+}
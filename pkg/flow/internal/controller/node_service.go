@@ -123,6 +123,27 @@ func (sn *ServiceNode) Evaluate(scope *vm.Scope) error {
 	return nil
 }
 
+// Validate decodes the configuration for a service without updating the
+// service.
+func (sn *ServiceNode) Validate(scope *vm.Scope) error {
+	sn.mut.RLock()
+	defer sn.mut.RUnlock()
+
+	switch {
+	case sn.block != nil && sn.def.ConfigType == nil:
+		return fmt.Errorf("service %q does not support being configured", sn.NodeID())
+
+	case sn.def.ConfigType == nil:
+		return nil // Do nothing; no configuration.
+	}
+
+	argsPointer := reflect.New(reflect.TypeOf(sn.def.ConfigType)).Interface()
+	if err := sn.eval.Evaluate(scope, argsPointer); err != nil {
+		return fmt.Errorf("decoding River: %w", err)
+	}
+	return nil
+}
+
 func (sn *ServiceNode) Run(ctx context.Context) error {
 	return sn.svc.Run(ctx, sn.host)
 }
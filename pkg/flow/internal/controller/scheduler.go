@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // RunnableNode is any dag.Node which can also be run.
@@ -12,8 +13,33 @@ type RunnableNode interface {
 	Run(ctx context.Context) error
 }
 
+// DrainableNode is a RunnableNode which may be able to flush in-flight data
+// before it's stopped.
+type DrainableNode interface {
+	RunnableNode
+
+	// Drainable returns true if the node currently supports draining.
+	Drainable() bool
+
+	// Drain flushes in-flight data, blocking until all data has been flushed or
+	// ctx is canceled.
+	Drain(ctx context.Context) error
+}
+
+// SchedulerOptions are options used to create a Scheduler.
+type SchedulerOptions struct {
+	// DrainTimeout is the maximum amount of time a DrainableNode may spend
+	// draining before it's stopped. Nodes aren't drained if DrainTimeout is 0.
+	DrainTimeout time.Duration
+
+	// OnDrain, if set, is invoked after a node finished draining with the time
+	// spent draining and the error returned by Drain.
+	OnDrain func(id string, duration time.Duration, err error)
+}
+
 // Scheduler runs components.
 type Scheduler struct {
+	opts    SchedulerOptions
 	ctx     context.Context
 	cancel  context.CancelFunc
 	running sync.WaitGroup
@@ -25,10 +51,11 @@ type Scheduler struct {
 // NewScheduler creates a new Scheduler. Call Synchronize to manage the set of
 // components which are running.
 //
-// Call Close to stop the Scheduler and all running components.
-func NewScheduler() *Scheduler {
+// Call Shutdown or Close to stop the Scheduler and all running components.
+func NewScheduler(opts SchedulerOptions) *Scheduler {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Scheduler{
+		opts:   opts,
 		ctx:    ctx,
 		cancel: cancel,
 
@@ -40,7 +67,7 @@ func NewScheduler() *Scheduler {
 //
 // New RunnableNodes will be launched as new goroutines. RunnableNodes already
 // managed by Scheduler will be kept running, while running RunnableNodes that
-// are not in rr will be shut down and removed.
+// are not in rr will be drained, shut down, and removed.
 //
 // Existing components will be restarted if they stopped since the previous
 // call to Synchronize.
@@ -67,7 +94,7 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 		stopping.Add(1)
 		go func(t *task) {
 			defer stopping.Done()
-			t.Stop()
+			s.stopTask(t)
 		}(t)
 	}
 
@@ -83,6 +110,7 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 		)
 
 		opts := taskOptions{
+			ID:       nodeID,
 			Context:  s.ctx,
 			Runnable: newRunnable,
 			OnDone: func() {
@@ -103,22 +131,84 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 	return nil
 }
 
+// Shutdown stops the Scheduler in order, returning after all running
+// goroutines have exited.
+//
+// order holds groups of node IDs. Groups are stopped one after the other:
+// the running nodes of a group are drained and stopped concurrently, and the
+// next group is only stopped once all nodes of the previous group exited.
+// Running nodes which aren't part of any group are stopped last, without
+// being drained.
+func (s *Scheduler) Shutdown(order [][]string) error {
+	for _, group := range order {
+		var stopping sync.WaitGroup
+
+		s.tasksMut.Lock()
+		for _, id := range group {
+			t, ok := s.tasks[id]
+			if !ok {
+				continue
+			}
+
+			stopping.Add(1)
+			go func(t *task) {
+				defer stopping.Done()
+				s.stopTask(t)
+			}(t)
+		}
+		s.tasksMut.Unlock()
+
+		stopping.Wait()
+	}
+
+	return s.Close()
+}
+
 // Close stops the Scheduler and returns after all running goroutines have
-// exited.
+// exited. Running nodes are stopped immediately, without draining them.
 func (s *Scheduler) Close() error {
 	s.cancel()
 	s.running.Wait()
 	return nil
 }
 
+// stopTask drains t if its runnable supports draining, and then stops it.
+func (s *Scheduler) stopTask(t *task) {
+	if d, ok := t.runnable.(DrainableNode); ok && s.opts.DrainTimeout > 0 && d.Drainable() {
+		s.drainTask(t, d)
+	}
+	t.Stop()
+}
+
+func (s *Scheduler) drainTask(t *task, d DrainableNode) {
+	select {
+	case <-t.exited:
+		// Nothing left to drain if the runnable already exited.
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(t.ctx, s.opts.DrainTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := d.Drain(ctx)
+	if s.opts.OnDrain != nil {
+		s.opts.OnDrain(t.id, time.Since(start), err)
+	}
+}
+
 // task is a scheduled runnable.
 type task struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	exited chan struct{}
+	id       string
+	runnable RunnableNode
+	ctx      context.Context
+	cancel   context.CancelFunc
+	exited   chan struct{}
 }
 
 type taskOptions struct {
+	ID       string
 	Context  context.Context
 	Runnable RunnableNode
 	OnDone   func()
@@ -129,9 +219,11 @@ func newTask(opts taskOptions) *task {
 	ctx, cancel := context.WithCancel(opts.Context)
 
 	t := &task{
-		ctx:    ctx,
-		cancel: cancel,
-		exited: make(chan struct{}),
+		id:       opts.ID,
+		runnable: opts.Runnable,
+		ctx:      ctx,
+		cancel:   cancel,
+		exited:   make(chan struct{}),
 	}
 
 	go func() {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
@@ -24,7 +25,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 		sched.Synchronize([]controller.RunnableNode{
 			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
 			fakeRunnable{ID: "component-b", Component: mockComponent{RunFunc: runFunc}},
@@ -46,7 +47,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 
 		for i := 0; i < 10; i++ {
 			// If a new runnable is created, runFunc will panic since the WaitGroup
@@ -72,7 +73,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 
 		sched.Synchronize([]controller.RunnableNode{
 			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
@@ -86,6 +87,100 @@ func TestScheduler_Synchronize(t *testing.T) {
 	})
 }
 
+func TestScheduler_Shutdown(t *testing.T) {
+	t.Run("Stops groups in order", func(t *testing.T) {
+		var (
+			mut     sync.Mutex
+			stopped []string
+		)
+		runFunc := func(id string) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				<-ctx.Done()
+				mut.Lock()
+				defer mut.Unlock()
+				stopped = append(stopped, id)
+				return nil
+			}
+		}
+
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "writer", Component: mockComponent{RunFunc: runFunc("writer")}},
+			fakeRunnable{ID: "processor", Component: mockComponent{RunFunc: runFunc("processor")}},
+			fakeRunnable{ID: "source", Component: mockComponent{RunFunc: runFunc("source")}},
+			fakeRunnable{ID: "unordered", Component: mockComponent{RunFunc: runFunc("unordered")}},
+		})
+
+		require.NoError(t, sched.Shutdown([][]string{{"source", "missing"}, {"processor"}, {"writer"}}))
+		require.Equal(t, []string{"source", "processor", "writer", "unordered"}, stopped)
+	})
+
+	t.Run("Drains nodes before stopping them", func(t *testing.T) {
+		var (
+			drained  = make(chan struct{})
+			observed []string
+		)
+
+		sched := controller.NewScheduler(controller.SchedulerOptions{
+			DrainTimeout: time.Minute,
+			OnDrain: func(id string, _ time.Duration, err error) {
+				require.NoError(t, err)
+				observed = append(observed, id)
+			},
+		})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeDrainableRunnable{
+				fakeRunnable: fakeRunnable{ID: "component-a", Component: mockComponent{
+					RunFunc: func(ctx context.Context) error {
+						<-ctx.Done()
+						select {
+						case <-drained:
+						default:
+							t.Error("component stopped before being drained")
+						}
+						return nil
+					},
+				}},
+				DrainFunc: func(ctx context.Context) error {
+					close(drained)
+					return nil
+				},
+			},
+		})
+
+		require.NoError(t, sched.Shutdown([][]string{{"component-a"}}))
+		require.Equal(t, []string{"component-a"}, observed)
+	})
+
+	t.Run("Stops nodes once drain timeout is reached", func(t *testing.T) {
+		var drainErr error
+
+		sched := controller.NewScheduler(controller.SchedulerOptions{
+			DrainTimeout: 10 * time.Millisecond,
+			OnDrain: func(_ string, _ time.Duration, err error) {
+				drainErr = err
+			},
+		})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeDrainableRunnable{
+				fakeRunnable: fakeRunnable{ID: "component-a", Component: mockComponent{
+					RunFunc: func(ctx context.Context) error {
+						<-ctx.Done()
+						return nil
+					},
+				}},
+				DrainFunc: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+		})
+
+		require.NoError(t, sched.Shutdown([][]string{{"component-a"}}))
+		require.ErrorIs(t, drainErr, context.DeadlineExceeded)
+	})
+}
+
 type fakeRunnable struct {
 	ID        string
 	Component component.Component
@@ -105,3 +200,13 @@ var _ component.Component = (*mockComponent)(nil)
 
 func (mc mockComponent) Run(ctx context.Context) error              { return mc.RunFunc(ctx) }
 func (mc mockComponent) Update(newConfig component.Arguments) error { return mc.UpdateFunc(newConfig) }
+
+type fakeDrainableRunnable struct {
+	fakeRunnable
+	DrainFunc func(ctx context.Context) error
+}
+
+var _ controller.DrainableNode = fakeDrainableRunnable{}
+
+func (fr fakeDrainableRunnable) Drainable() bool                 { return true }
+func (fr fakeDrainableRunnable) Drain(ctx context.Context) error { return fr.DrainFunc(ctx) }
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/grafana/agent/pkg/flow/internal/dag"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/diag"
+)
+
+// unknownValues reports which references evaluate to placeholders for
+// unknown values when the Loader only validates blocks: the values of
+// argument blocks if argsUnknown is true, and the exports of custom
+// components. Exports of built-in components are the zero values of their
+// types, which type-check like any other value.
+type unknownValues struct {
+	graph       *dag.Graph
+	argsUnknown bool
+}
+
+func (u unknownValues) unknown(t Traversal) bool {
+	if t[0].Name == argumentBlockID {
+		return u.argsUnknown
+	}
+	ref, diags := resolveTraversal(t, u.graph)
+	if diags.HasErrors() {
+		return false
+	}
+	cn, ok := ref.Target.(*ComponentNode)
+	return ok && cn.declare != nil
+}
+
+// causedBy returns true if err, returned by validating b, may be caused by
+// evaluating unknown values.
+//
+// Errors located in an attribute value referencing an unknown value may be,
+// while errors located elsewhere, such as unknown attributes or type errors
+// in other attributes, aren't. Errors without a location, such as the ones
+// returned by Validate methods, may be if b references an unknown value at
+// all.
+func (u unknownValues) causedBy(b *ast.BlockStmt, err error) bool {
+	if b == nil || err == nil {
+		return false
+	}
+	ranges := u.valueRanges(b)
+	if len(ranges) == 0 {
+		return false
+	}
+
+	var evalDiags diag.Diagnostics
+	if !errors.As(err, &evalDiags) {
+		return true
+	}
+	for _, d := range evalDiags {
+		if d.StartPos.Valid() && !ranges.contain(d) {
+			return false
+		}
+	}
+	return true
+}
+
+type valueRange struct{ start, end int }
+
+type valueRanges []valueRange
+
+// contain returns true if d is located within one of the ranges.
+func (r valueRanges) contain(d diag.Diagnostic) bool {
+	for _, rng := range r {
+		if d.StartPos.Offset >= rng.start && d.EndPos.Offset <= rng.end {
+			return true
+		}
+	}
+	return false
+}
+
+// valueRanges returns the offsets of the attribute values in b which
+// reference an unknown value.
+func (u unknownValues) valueRanges(b *ast.BlockStmt) valueRanges {
+	w := unknownValueWalker{unknown: u.unknown}
+	ast.Walk(&w, b.Body)
+	return w.ranges
+}
+
+type unknownValueWalker struct {
+	unknown func(Traversal) bool
+	ranges  valueRanges
+}
+
+func (uw *unknownValueWalker) Visit(node ast.Node) ast.Visitor {
+	attr, ok := node.(*ast.AttributeStmt)
+	if !ok {
+		return uw
+	}
+
+	var tw traversalWalker
+	ast.Walk(&tw, attr.Value)
+	tw.flush()
+	for _, t := range tw.traversals {
+		if uw.unknown(t) {
+			uw.ranges = append(uw.ranges, valueRange{
+				start: ast.StartPos(attr.Value).Position().Offset,
+				end:   ast.EndPos(attr.Value).Position().Offset,
+			})
+			break
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package dag
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
@@ -31,6 +32,64 @@ func Reduce(g *Graph) {
 	}
 }
 
+// DependantsFirst groups the nodes of g so that nodes are grouped after all
+// of their dependants: the first group holds the roots of g, and every other
+// group holds the nodes whose dependants are all in previous groups. Nodes
+// within a group don't depend on each other. Nodes in each group are sorted by
+// ID.
+//
+// Nodes which are part of a cycle, or which depend on nodes part of a cycle,
+// are returned as a final group.
+func DependantsFirst(g *Graph) [][]Node {
+	var (
+		res [][]Node
+
+		remaining     = make(map[Node]int, len(g.nodes))
+		current, next []Node
+	)
+
+	for n := range g.nodes {
+		remaining[n] = len(g.inEdges[n])
+		if remaining[n] == 0 {
+			current = append(current, n)
+		}
+	}
+
+	for len(current) > 0 {
+		sortNodes(current)
+		res = append(res, current)
+
+		for _, n := range current {
+			delete(remaining, n)
+
+			// Queue dependencies once all of their dependants have been grouped.
+			for dep := range g.outEdges[n] {
+				remaining[dep]--
+				if remaining[dep] == 0 {
+					next = append(next, dep)
+				}
+			}
+		}
+
+		current, next = next, nil
+	}
+
+	if len(remaining) > 0 {
+		cyclic := make([]Node, 0, len(remaining))
+		for n := range remaining {
+			cyclic = append(cyclic, n)
+		}
+		sortNodes(cyclic)
+		res = append(res, cyclic)
+	}
+
+	return res
+}
+
+func sortNodes(nn []Node) {
+	sort.Slice(nn, func(i, j int) bool { return nn[i].NodeID() < nn[j].NodeID() })
+}
+
 // Validate checks that the graph doesn't contain cycles
 func Validate(g *Graph) error {
 	var err error
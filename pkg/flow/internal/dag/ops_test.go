@@ -1,6 +1,9 @@
 package dag
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestValidateWithoutCycle(t *testing.T) {
 	var g Graph
@@ -52,3 +55,45 @@ func TestValidateSelfReference(t *testing.T) {
 		t.Fatal("graph with self reference")
 	}
 }
+
+func TestDependantsFirst(t *testing.T) {
+	var g Graph
+	var (
+		source    = stringNode("source")
+		processor = stringNode("processor")
+		writer    = stringNode("writer")
+		other     = stringNode("other")
+		cycleA    = stringNode("cycle_a")
+		cycleB    = stringNode("cycle_b")
+	)
+	g.Add(source)
+	g.Add(processor)
+	g.Add(writer)
+	g.Add(other)
+	g.Add(cycleA)
+	g.Add(cycleB)
+	g.AddEdge(Edge{source, processor})
+	g.AddEdge(Edge{source, writer})
+	g.AddEdge(Edge{processor, writer})
+	g.AddEdge(Edge{cycleA, cycleB})
+	g.AddEdge(Edge{cycleB, cycleA})
+
+	var actual [][]string
+	for _, group := range DependantsFirst(&g) {
+		var ids []string
+		for _, n := range group {
+			ids = append(ids, n.NodeID())
+		}
+		actual = append(actual, ids)
+	}
+
+	expect := [][]string{
+		{"other", "source"},
+		{"processor"},
+		{"writer"},
+		{"cycle_a", "cycle_b"},
+	}
+	if !reflect.DeepEqual(expect, actual) {
+		t.Fatalf("expected %v, got %v", expect, actual)
+	}
+}
@@ -0,0 +1,64 @@
+package importsource
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/local/file"
+)
+
+// importFile retrieves content from a file on disk using the local.file
+// component.
+type importFile struct {
+	opts    Options
+	managed *file.Component
+}
+
+var _ ImportSource = (*importFile)(nil)
+
+func newImportFile(opts Options) *importFile {
+	return &importFile{opts: opts}
+}
+
+// Arguments implements ImportSource.
+func (s *importFile) Arguments() any {
+	args := file.DefaultArguments
+	return &args
+}
+
+// Update implements ImportSource.
+func (s *importFile) Update(args any) error {
+	newArgs := *args.(*file.Arguments)
+
+	if s.managed == nil {
+		opts := s.opts.Component
+		opts.OnStateChange = func(e component.Exports) {
+			s.opts.OnContentChange(e.(file.Exports).Content.Value)
+		}
+
+		managed, err := file.New(opts, newArgs)
+		if err != nil {
+			return fmt.Errorf("reading file: %w", err)
+		}
+		s.managed = managed
+		return nil
+	}
+	return s.managed.Update(newArgs)
+}
+
+// Run implements ImportSource.
+func (s *importFile) Run(ctx context.Context) error {
+	if s.managed == nil {
+		return errNotUpdated
+	}
+	return s.managed.Run(ctx)
+}
+
+// CurrentHealth implements ImportSource.
+func (s *importFile) CurrentHealth() component.Health {
+	if s.managed == nil {
+		return notUpdatedHealth
+	}
+	return s.managed.CurrentHealth()
+}
@@ -0,0 +1,202 @@
+package importsource
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/internal/vcs"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+)
+
+// GitArguments holds the arguments for an import.git block.
+type GitArguments struct {
+	Repository    string            `river:"repository,attr"`
+	Revision      string            `river:"revision,attr,optional"`
+	Path          string            `river:"path,attr"`
+	PullFrequency time.Duration     `river:"pull_frequency,attr,optional"`
+	GitAuthConfig vcs.GitAuthConfig `river:",squash"`
+}
+
+// DefaultGitArguments holds default settings for GitArguments.
+var DefaultGitArguments = GitArguments{
+	Revision:      "HEAD",
+	PullFrequency: time.Minute,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *GitArguments) SetToDefault() {
+	*args = DefaultGitArguments
+}
+
+// importGit retrieves content from a file in a Git repository.
+type importGit struct {
+	opts Options
+
+	mut      sync.Mutex
+	repo     *vcs.GitRepo
+	repoOpts vcs.GitRepoOptions
+	args     GitArguments
+	content  string
+
+	argsChanged chan struct{}
+
+	healthMut sync.RWMutex
+	health    component.Health
+}
+
+var _ ImportSource = (*importGit)(nil)
+
+func newImportGit(opts Options) *importGit {
+	return &importGit{
+		opts:        opts,
+		argsChanged: make(chan struct{}, 1),
+	}
+}
+
+// Arguments implements ImportSource.
+func (s *importGit) Arguments() any {
+	args := DefaultGitArguments
+	return &args
+}
+
+// Update implements ImportSource.
+func (s *importGit) Update(args any) (err error) {
+	defer func() {
+		s.updateHealth(err)
+	}()
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	newArgs := *args.(*GitArguments)
+
+	repoPath := filepath.Join(s.opts.Component.DataPath, "repo")
+
+	repoOpts := vcs.GitRepoOptions{
+		Repository: newArgs.Repository,
+		Revision:   newArgs.Revision,
+		Auth:       newArgs.GitAuthConfig,
+	}
+
+	if s.repo == nil || !reflect.DeepEqual(repoOpts, s.repoOpts) {
+		r, err := vcs.NewGitRepo(context.Background(), repoPath, repoOpts)
+		if err != nil {
+			return err
+		}
+		s.repo = r
+		s.repoOpts = repoOpts
+	}
+
+	if err := s.pollFile(context.Background(), newArgs, true); err != nil {
+		return err
+	}
+
+	select {
+	case s.argsChanged <- struct{}{}:
+	default:
+	}
+
+	s.args = newArgs
+	return nil
+}
+
+// Run implements ImportSource.
+func (s *importGit) Run(ctx context.Context) error {
+	var (
+		ticker  *time.Ticker
+		tickerC <-chan time.Time
+	)
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-s.argsChanged:
+			s.mut.Lock()
+			frequency := s.args.PullFrequency
+			s.mut.Unlock()
+
+			if frequency > 0 {
+				if ticker == nil {
+					ticker = time.NewTicker(frequency)
+					tickerC = ticker.C
+				} else {
+					ticker.Reset(frequency)
+				}
+			} else {
+				if ticker != nil {
+					ticker.Stop()
+				}
+				ticker = nil
+				tickerC = nil
+			}
+
+		case <-tickerC:
+			s.mut.Lock()
+			err := s.pollFile(ctx, s.args, false)
+			s.mut.Unlock()
+			if err != nil {
+				level.Error(s.opts.Component.Logger).Log("msg", "failed to update repository", "err", err)
+			}
+			s.updateHealth(err)
+		}
+	}
+}
+
+// pollFile fetches the latest content from the repository and passes it to
+// OnContentChange if it changed or force is set. pollFile must only be
+// called with s.mut held.
+func (s *importGit) pollFile(ctx context.Context, args GitArguments, force bool) error {
+	if err := s.repo.Update(ctx); err != nil {
+		return err
+	}
+
+	bb, err := s.repo.ReadFile(args.Path)
+	if err != nil {
+		return err
+	}
+
+	content := string(bb)
+	if !force && content == s.content {
+		return nil
+	}
+	s.content = content
+	s.opts.OnContentChange(content)
+	return nil
+}
+
+func (s *importGit) updateHealth(err error) {
+	s.healthMut.Lock()
+	defer s.healthMut.Unlock()
+
+	if err != nil {
+		s.health = component.Health{
+			Health:     component.HealthTypeUnhealthy,
+			Message:    err.Error(),
+			UpdateTime: time.Now(),
+		}
+	} else {
+		s.health = component.Health{
+			Health:     component.HealthTypeHealthy,
+			Message:    "import updated",
+			UpdateTime: time.Now(),
+		}
+	}
+}
+
+// CurrentHealth implements ImportSource.
+func (s *importGit) CurrentHealth() component.Health {
+	s.healthMut.RLock()
+	defer s.healthMut.RUnlock()
+	return s.health
+}
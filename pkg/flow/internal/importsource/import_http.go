@@ -0,0 +1,64 @@
+package importsource
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/remote/http"
+)
+
+// importHTTP retrieves content from an HTTP endpoint using the remote.http
+// component.
+type importHTTP struct {
+	opts    Options
+	managed *http.Component
+}
+
+var _ ImportSource = (*importHTTP)(nil)
+
+func newImportHTTP(opts Options) *importHTTP {
+	return &importHTTP{opts: opts}
+}
+
+// Arguments implements ImportSource.
+func (s *importHTTP) Arguments() any {
+	args := http.DefaultArguments
+	return &args
+}
+
+// Update implements ImportSource.
+func (s *importHTTP) Update(args any) error {
+	newArgs := *args.(*http.Arguments)
+
+	if s.managed == nil {
+		opts := s.opts.Component
+		opts.OnStateChange = func(e component.Exports) {
+			s.opts.OnContentChange(e.(http.Exports).Content.Value)
+		}
+
+		managed, err := http.New(opts, newArgs)
+		if err != nil {
+			return fmt.Errorf("requesting content: %w", err)
+		}
+		s.managed = managed
+		return nil
+	}
+	return s.managed.Update(newArgs)
+}
+
+// Run implements ImportSource.
+func (s *importHTTP) Run(ctx context.Context) error {
+	if s.managed == nil {
+		return errNotUpdated
+	}
+	return s.managed.Run(ctx)
+}
+
+// CurrentHealth implements ImportSource.
+func (s *importHTTP) CurrentHealth() component.Health {
+	if s.managed == nil {
+		return notUpdatedHealth
+	}
+	return s.managed.CurrentHealth()
+}
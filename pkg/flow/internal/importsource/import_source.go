@@ -0,0 +1,84 @@
+// Package importsource implements the sources which import blocks retrieve
+// River content from.
+package importsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grafana/agent/component"
+)
+
+// Names of the blocks for the supported import sources.
+const (
+	BlockImportFile = "import.file"
+	BlockImportGit  = "import.git"
+	BlockImportHTTP = "import.http"
+)
+
+// errNotUpdated is returned when running a source whose content was never
+// retrieved by a successful call to Update.
+var errNotUpdated = errors.New("import source content was never retrieved")
+
+// notUpdatedHealth is the health of a source whose content was never
+// retrieved by a successful call to Update.
+var notUpdatedHealth = component.Health{
+	Health:  component.HealthTypeUnhealthy,
+	Message: errNotUpdated.Error(),
+}
+
+// ImportSource retrieves River content for an import block and notifies its
+// owner whenever the content changes.
+type ImportSource interface {
+	// Arguments returns a pointer to a new, defaulted set of arguments for the
+	// source, which the body of the import block is decoded into.
+	Arguments() any
+
+	// Update applies the decoded arguments and retrieves the content of the
+	// source. The content is passed to the OnContentChange function given to
+	// NewImportSource before Update returns.
+	Update(args any) error
+
+	// Run polls the source for changes until ctx is canceled.
+	Run(ctx context.Context) error
+
+	// CurrentHealth returns the health of the source.
+	CurrentHealth() component.Health
+}
+
+// Options holds the options for creating an ImportSource.
+type Options struct {
+	// Component options for the managed source. OnStateChange is set by the
+	// source and must be left empty.
+	Component component.Options
+
+	// OnContentChange is invoked with the new content of the source whenever
+	// it changes.
+	OnContentChange func(content string)
+}
+
+// NewImportSource creates the ImportSource for the block named blockName.
+func NewImportSource(blockName string, opts Options) (ImportSource, error) {
+	switch blockName {
+	case BlockImportFile:
+		return newImportFile(opts), nil
+	case BlockImportGit:
+		return newImportGit(opts), nil
+	case BlockImportHTTP:
+		return newImportHTTP(opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported import source %q", blockName)
+	}
+}
+
+// IsImportBlock returns true if blockName is the name of a supported import
+// block.
+func IsImportBlock(blockName string) bool {
+	switch blockName {
+	case BlockImportFile, BlockImportGit, BlockImportHTTP:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// RingBuffer is an [io.Writer] which retains the most recent lines written to
+// it. It is used to keep recent log lines in memory so they can be included
+// in support bundles.
+type RingBuffer struct {
+	mut   sync.Mutex
+	lines [][]byte
+	next  int  // Index to write the next line to.
+	full  bool // Whether lines has wrapped around at least once.
+
+	partial []byte // Trailing data not yet terminated by a newline.
+}
+
+var _ io.Writer = (*RingBuffer)(nil)
+
+// NewRingBuffer returns a RingBuffer which retains up to size lines. size
+// must be greater than zero.
+func NewRingBuffer(size int) *RingBuffer {
+	if size <= 0 {
+		panic("logging: RingBuffer size must be greater than zero")
+	}
+	return &RingBuffer{lines: make([][]byte, size)}
+}
+
+// Write implements [io.Writer]. p may contain any number of lines; a trailing
+// line without a newline is buffered until the rest of it is written.
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	rb.mut.Lock()
+	defer rb.mut.Unlock()
+
+	rem := p
+	for len(rem) > 0 {
+		idx := bytes.IndexByte(rem, '\n')
+		if idx == -1 {
+			rb.partial = append(rb.partial, rem...)
+			break
+		}
+
+		line := make([]byte, 0, len(rb.partial)+idx+1)
+		line = append(line, rb.partial...)
+		line = append(line, rem[:idx+1]...)
+		rb.partial = rb.partial[:0]
+		rem = rem[idx+1:]
+
+		rb.lines[rb.next] = line
+		rb.next = (rb.next + 1) % len(rb.lines)
+		if rb.next == 0 {
+			rb.full = true
+		}
+	}
+
+	return len(p), nil
+}
+
+// Bytes returns a copy of the retained lines, from oldest to newest.
+func (rb *RingBuffer) Bytes() []byte {
+	rb.mut.Lock()
+	defer rb.mut.Unlock()
+
+	var buf bytes.Buffer
+	if rb.full {
+		for _, line := range rb.lines[rb.next:] {
+			buf.Write(line)
+		}
+	}
+	for _, line := range rb.lines[:rb.next] {
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
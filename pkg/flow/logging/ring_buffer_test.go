@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingBuffer(t *testing.T) {
+	rb := NewRingBuffer(3)
+	require.Empty(t, rb.Bytes())
+
+	_, _ = rb.Write([]byte("one\ntwo\n"))
+	require.Equal(t, "one\ntwo\n", string(rb.Bytes()))
+
+	// Partial lines are only retained once they are terminated.
+	_, _ = rb.Write([]byte("thr"))
+	require.Equal(t, "one\ntwo\n", string(rb.Bytes()))
+	_, _ = rb.Write([]byte("ee\nfour\n"))
+	require.Equal(t, "two\nthree\nfour\n", string(rb.Bytes()))
+
+	_, _ = rb.Write([]byte("five\n"))
+	require.Equal(t, "three\nfour\nfive\n", string(rb.Bytes()))
+}
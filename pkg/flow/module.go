@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/grafana/agent/component"
 	"github.com/grafana/agent/pkg/flow/internal/controller"
@@ -12,6 +13,7 @@ import (
 	"github.com/grafana/agent/pkg/flow/logging"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/pkg/flow/tracing"
+	"github.com/grafana/river/ast"
 	"github.com/grafana/river/scanner"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/exp/maps"
@@ -98,7 +100,8 @@ type moduleOptions struct {
 }
 
 var (
-	_ component.Module = (*module)(nil)
+	_ component.Module         = (*module)(nil)
+	_ controller.DeclareModule = (*module)(nil)
 )
 
 // newModule creates a module instance for a specific component.
@@ -106,10 +109,9 @@ func newModule(o *moduleOptions) *module {
 	return &module{
 		o: o,
 		f: newController(controllerOptions{
-			IsModule:          true,
-			ModuleRegistry:    o.ModuleRegistry,
-			ComponentRegistry: o.ComponentRegistry,
-			WorkerPool:        o.WorkerPool,
+			IsModule:       true,
+			ModuleRegistry: o.ModuleRegistry,
+			WorkerPool:     o.WorkerPool,
 			Options: Options{
 				ControllerID: o.ID,
 				Tracer:       o.Tracer,
@@ -121,7 +123,9 @@ func newModule(o *moduleOptions) *module {
 						o.export(exports)
 					}
 				},
-				Services: o.ServiceMap.List(),
+				Services:          o.ServiceMap.List(),
+				DrainTimeout:      o.DrainTimeout,
+				ComponentRegistry: o.ComponentRegistry,
 			},
 		}),
 	}
@@ -136,6 +140,16 @@ func (c *module) LoadConfig(config []byte, args map[string]any) error {
 	return c.f.LoadSource(ff, args)
 }
 
+// LoadBody loads the body of a declare block. declares holds the custom
+// components which can be used within body.
+func (c *module) LoadBody(body ast.Body, args map[string]any, declares map[string]*controller.Declare) error {
+	ff, err := sourceFromBody(body)
+	if err != nil {
+		return err
+	}
+	return c.f.loadSource(ff, args, declares)
+}
+
 // Run starts the Module. No components within the Module
 // will be run until Run is called.
 //
@@ -187,4 +201,8 @@ type moduleControllerOptions struct {
 	// WorkerPool is a worker pool that can be used to run tasks asynchronously. A default pool will be created if this
 	// is nil.
 	WorkerPool worker.Pool
+
+	// DrainTimeout is the maximum amount of time components of the module may
+	// spend flushing in-flight data before being stopped.
+	DrainTimeout time.Duration
 }
@@ -0,0 +1,104 @@
+package pipelinetest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/prometheus"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// capture collects everything the tested component forwards to other
+// components.
+type capture struct {
+	ctx context.Context
+	ls  labelstore.LabelStore
+
+	mut     sync.Mutex
+	logs    []loki.Entry
+	samples []Sample
+	updated chan struct{}
+}
+
+func newCapture(ctx context.Context) *capture {
+	return &capture{
+		ctx:     ctx,
+		ls:      labelstore.New(nil),
+		updated: make(chan struct{}, 1),
+	}
+}
+
+// LogsReceiver returns a new loki.LogsReceiver which records the entries it
+// receives until the context of c is canceled.
+func (c *capture) LogsReceiver() loki.LogsReceiver {
+	recv := loki.NewLogsReceiver()
+	go func() {
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case entry := <-recv.Chan():
+				c.mut.Lock()
+				c.logs = append(c.logs, entry)
+				c.mut.Unlock()
+				c.notify()
+			}
+		}
+	}()
+	return recv
+}
+
+// Appendable returns a new storage.Appendable which records the samples
+// appended to it.
+func (c *capture) Appendable() storage.Appendable {
+	return prometheus.NewInterceptor(nil, c.ls, prometheus.WithAppendHook(func(ref storage.SeriesRef, l labels.Labels, _ int64, v float64, _ storage.Appender) (storage.SeriesRef, error) {
+		c.mut.Lock()
+		c.samples = append(c.samples, Sample{Labels: l.Map(), Value: v})
+		c.mut.Unlock()
+		c.notify()
+		return ref, nil
+	}))
+}
+
+func (c *capture) notify() {
+	select {
+	case c.updated <- struct{}{}:
+	default:
+	}
+}
+
+// Logs returns the log entries received so far.
+func (c *capture) Logs() []loki.Entry {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]loki.Entry(nil), c.logs...)
+}
+
+// Samples returns the samples received so far.
+func (c *capture) Samples() []Sample {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]Sample(nil), c.samples...)
+}
+
+// Wait blocks until at least logs entries and samples samples have been
+// received or until ctx is canceled.
+func (c *capture) Wait(ctx context.Context, logs, samples int) {
+	for {
+		c.mut.Lock()
+		done := len(c.logs) >= logs && len(c.samples) >= samples
+		c.mut.Unlock()
+		if done {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.updated:
+		}
+	}
+}
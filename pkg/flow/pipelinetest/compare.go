@@ -0,0 +1,219 @@
+package pipelinetest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/discovery"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func compareLogs(expect []LogEntry, actual []loki.Entry) []string {
+	var failures []string
+	if len(expect) != len(actual) {
+		failures = append(failures, fmt.Sprintf("expected %d log entries, got %d", len(expect), len(actual)))
+	}
+
+	for i := 0; i < len(expect) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			failures = append(failures, fmt.Sprintf("  missing log entry %d: %s", i, formatLogEntry(expect[i].Labels, expect[i].Line)))
+		case i >= len(expect):
+			failures = append(failures, fmt.Sprintf("  unexpected log entry %d: %s", i, formatLogEntry(labelSetMap(actual[i]), actual[i].Line)))
+		default:
+			e, a := expect[i], actual[i]
+			actualLabels := labelSetMap(a)
+			if e.Line != a.Line || !reflect.DeepEqual(nonNil(e.Labels), actualLabels) {
+				failures = append(failures, fmt.Sprintf("  log entry %d:\n    expected: %s\n    got:      %s", i, formatLogEntry(e.Labels, e.Line), formatLogEntry(actualLabels, a.Line)))
+			} else if !e.Timestamp.IsZero() && !e.Timestamp.Equal(a.Timestamp) {
+				failures = append(failures, fmt.Sprintf("  log entry %d: expected timestamp %s, got %s", i, e.Timestamp, a.Timestamp))
+			}
+		}
+	}
+	return failures
+}
+
+func compareSamples(expect, actual []Sample) []string {
+	var failures []string
+	if len(expect) != len(actual) {
+		failures = append(failures, fmt.Sprintf("expected %d samples, got %d", len(expect), len(actual)))
+	}
+
+	for i := 0; i < len(expect) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			failures = append(failures, fmt.Sprintf("  missing sample %d: %s", i, formatSample(expect[i])))
+		case i >= len(expect):
+			failures = append(failures, fmt.Sprintf("  unexpected sample %d: %s", i, formatSample(actual[i])))
+		default:
+			e, a := expect[i], actual[i]
+			if !reflect.DeepEqual(nonNil(e.Labels), nonNil(a.Labels)) || !floatEqual(e.Value, a.Value) {
+				failures = append(failures, fmt.Sprintf("  sample %d:\n    expected: %s\n    got:      %s", i, formatSample(e), formatSample(a)))
+			}
+		}
+	}
+	return failures
+}
+
+func compareTargets(expect []discovery.Target, exports component.Exports) []string {
+	actual, ok := exportedTargets(reflect.ValueOf(exports))
+	if !ok {
+		return []string{"component doesn't export targets"}
+	}
+
+	if len(expect) == 0 && len(actual) == 0 {
+		return nil
+	}
+	if reflect.DeepEqual(expect, actual) {
+		return nil
+	}
+	return []string{fmt.Sprintf("targets:\n    expected: %s\n    got:      %s", formatTargets(expect), formatTargets(actual))}
+}
+
+// exportedTargets returns the first targets export of v, which holds the
+// exports of either a builtin component or a custom component.
+func exportedTargets(v reflect.Value) ([]discovery.Target, bool) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).Type() == targetsType {
+				return v.Field(i).Interface().([]discovery.Target), true
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			if targets, ok := v.MapIndex(key).Interface().([]discovery.Target); ok {
+				return targets, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// compareMetrics compares expect against the metrics exposed by the component
+// with the given ID, including the components declared within it.
+func compareMetrics(expect []Metric, families []*dto.MetricFamily, componentID string) []string {
+	var failures []string
+
+Outer:
+	for _, e := range expect {
+		var family *dto.MetricFamily
+		for _, f := range families {
+			if f.GetName() == e.Name {
+				family = f
+				break
+			}
+		}
+		if family == nil {
+			failures = append(failures, fmt.Sprintf("metric %s: not found", formatMetric(e.Name, e.Labels)))
+			continue
+		}
+
+		var seen []string
+		for _, m := range family.GetMetric() {
+			actualLabels := make(map[string]string, len(m.GetLabel()))
+			for _, lp := range m.GetLabel() {
+				actualLabels[lp.GetName()] = lp.GetValue()
+			}
+			id := actualLabels["component_id"]
+			if id != componentID && !strings.HasPrefix(id, componentID+"/") {
+				continue
+			}
+			if !labelsSubset(e.Labels, actualLabels) {
+				continue
+			}
+
+			var value float64
+			switch {
+			case m.GetCounter() != nil:
+				value = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				value = m.GetGauge().GetValue()
+			case m.GetUntyped() != nil:
+				value = m.GetUntyped().GetValue()
+			default:
+				failures = append(failures, fmt.Sprintf("metric %s: only counters, gauges, and untyped metrics can be compared", e.Name))
+				continue Outer
+			}
+
+			if floatEqual(e.Value, value) {
+				continue Outer
+			}
+			seen = append(seen, fmt.Sprintf("%s %v", formatMetric(e.Name, actualLabels), value))
+		}
+
+		if len(seen) == 0 {
+			failures = append(failures, fmt.Sprintf("metric %s: no series with matching labels", formatMetric(e.Name, e.Labels)))
+		} else {
+			failures = append(failures, fmt.Sprintf("metric %s: expected value %v, got:\n    %s", formatMetric(e.Name, e.Labels), e.Value, strings.Join(seen, "\n    ")))
+		}
+	}
+
+	return failures
+}
+
+func labelsSubset(subset, set map[string]string) bool {
+	for k, v := range subset {
+		if set[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func floatEqual(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+func labelSetMap(e loki.Entry) map[string]string {
+	m := make(map[string]string, len(e.Labels))
+	for k, v := range e.Labels {
+		m[string(k)] = string(v)
+	}
+	return m
+}
+
+// nonNil returns an empty map if m is nil so that a missing labels attribute
+// compares equal to an empty label set.
+func nonNil(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+func formatLogEntry(lbls map[string]string, line string) string {
+	return fmt.Sprintf("%s %q", labels.FromMap(lbls).String(), line)
+}
+
+func formatSample(s Sample) string {
+	return fmt.Sprintf("%s %v", labels.FromMap(s.Labels).String(), s.Value)
+}
+
+func formatMetric(name string, lbls map[string]string) string {
+	if len(lbls) == 0 {
+		return name
+	}
+	return name + labels.FromMap(lbls).String()
+}
+
+func formatTargets(targets []discovery.Target) string {
+	if len(targets) == 0 {
+		return "[]"
+	}
+
+	ss := make([]string, 0, len(targets))
+	for _, t := range targets {
+		ss = append(ss, labels.FromMap(t).String())
+	}
+	sort.Strings(ss)
+	return "[" + strings.Join(ss, ", ") + "]"
+}
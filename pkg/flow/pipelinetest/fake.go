@@ -0,0 +1,285 @@
+package pipelinetest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// maxArgumentsDepth limits how deeply arguments are searched for receivers.
+const maxArgumentsDepth = 8
+
+// kind tells how a component is run by tests.
+type kind int
+
+const (
+	// kindPipeline components receive data from other components and forward
+	// it, such as loki.process or discovery.relabel. They're run as is.
+	kindPipeline kind = iota
+
+	// kindSink components receive data but don't forward it to other
+	// components, such as loki.write. They're replaced by fakes which record
+	// what they receive.
+	kindSink
+
+	// kindSource components don't receive data from other components, such as
+	// loki.source.file or discovery.kubernetes. They're replaced by fakes
+	// which don't collect anything, and which forward the inputs of tests
+	// using them as their component.
+	kindSource
+)
+
+// kindOf returns how the component registered by reg is run by tests.
+func kindOf(reg component.Registration) kind {
+	var (
+		argsType    = reflect.TypeOf(reg.Args)
+		exportsType = reflect.TypeOf(reg.Exports)
+	)
+
+	switch {
+	case hasField(exportsType, isReceiverType):
+		if containsReceiver(argsType, 0) {
+			return kindPipeline
+		}
+		return kindSink
+	case targetsField(argsType) >= 0 && hasField(exportsType, func(t reflect.Type) bool { return t == targetsType }):
+		return kindPipeline
+	default:
+		return kindSource
+	}
+}
+
+func isReceiverType(t reflect.Type) bool {
+	return t == logsReceiverType || t == appendableType
+}
+
+// hasField returns true if t is a struct with a field whose type matches.
+func hasField(t reflect.Type, match func(reflect.Type) bool) bool {
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() && match(t.Field(i).Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsReceiver returns true if values of t may hold a log receiver or an
+// appendable.
+func containsReceiver(t reflect.Type, depth int) bool {
+	if t == nil || depth > maxArgumentsDepth {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return isReceiverType(t)
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return containsReceiver(t.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && containsReceiver(t.Field(i).Type, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// targetsField returns the index of the targets argument of arguments of type
+// t, or -1 if there's none.
+func targetsField(t reflect.Type) int {
+	if t == nil || t.Kind() != reflect.Struct {
+		return -1
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("river"), ",")
+		if name == "targets" && t.Field(i).Type == targetsType {
+			return i
+		}
+	}
+	return -1
+}
+
+// registry looks up registered components, replacing sinks and sources with
+// fakes.
+type registry struct {
+	capture *capture
+
+	mut     sync.Mutex
+	sources map[string]*fakeSource // Fake sources by component ID.
+}
+
+func newRegistry(capture *capture) *registry {
+	return &registry{
+		capture: capture,
+		sources: make(map[string]*fakeSource),
+	}
+}
+
+// Get implements flow.ComponentRegistry.
+func (r *registry) Get(name string) (component.Registration, bool) {
+	reg, ok := component.Get(name)
+	if !ok {
+		return reg, false
+	}
+
+	switch kindOf(reg) {
+	case kindSink:
+		return r.fakeSink(reg), true
+	case kindSource:
+		return r.fakeSource(reg), true
+	default:
+		return reg, true
+	}
+}
+
+// Source returns the fake source with the given component ID, if any.
+func (r *registry) Source(id string) (*fakeSource, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	s, ok := r.sources[id]
+	return s, ok
+}
+
+// fakeSink returns a registration which decodes the arguments of reg, and
+// exports receivers which record what they receive in place of its
+// receivers. Other exports are left to their zero value.
+func (r *registry) fakeSink(reg component.Registration) component.Registration {
+	return component.Registration{
+		Name:    reg.Name,
+		Args:    reg.Args,
+		Exports: reg.Exports,
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			exports := reflect.New(reflect.TypeOf(reg.Exports)).Elem()
+			for i := 0; i < exports.NumField(); i++ {
+				field := exports.Field(i)
+				if !field.CanSet() {
+					continue
+				}
+				switch field.Type() {
+				case logsReceiverType:
+					field.Set(reflect.ValueOf(r.capture.LogsReceiver()))
+				case appendableType:
+					field.Set(reflect.ValueOf(r.capture.Appendable()))
+				}
+			}
+			opts.OnStateChange(exports.Interface())
+			return fakeComponent{}, nil
+		},
+	}
+}
+
+// fakeSource returns a registration which decodes the arguments of reg and
+// keeps its exports to their zero value.
+func (r *registry) fakeSource(reg component.Registration) component.Registration {
+	return component.Registration{
+		Name:    reg.Name,
+		Args:    reg.Args,
+		Exports: reg.Exports,
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			s := &fakeSource{args: args}
+
+			r.mut.Lock()
+			defer r.mut.Unlock()
+			r.sources[opts.ID] = s
+			return s, nil
+		},
+	}
+}
+
+// fakeComponent is a component which does nothing.
+type fakeComponent struct{}
+
+// Run implements component.Component.
+func (fakeComponent) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements component.Component.
+func (fakeComponent) Update(component.Arguments) error { return nil }
+
+// fakeSource replaces a component which doesn't receive data from other
+// components.
+type fakeSource struct {
+	fakeComponent
+
+	mut  sync.Mutex
+	args component.Arguments
+}
+
+// Update implements component.Component.
+func (s *fakeSource) Update(args component.Arguments) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.args = args
+	return nil
+}
+
+// Receivers returns the receivers in the arguments of the source, which the
+// inputs of tests are sent to.
+func (s *fakeSource) Receivers() *receivers {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	var recv receivers
+	recv.find(reflect.ValueOf(s.args), 0)
+	return &recv
+}
+
+// receivers holds the receivers which the inputs of a test are sent to.
+type receivers struct {
+	logs        []loki.LogsReceiver
+	appendables []storage.Appendable
+}
+
+// find adds the receivers held by v to r.
+func (r *receivers) find(v reflect.Value, depth int) {
+	if !v.IsValid() || depth > maxArgumentsDepth {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		switch val := v.Interface().(type) {
+		case loki.LogsReceiver:
+			r.logs = append(r.logs, val)
+		case storage.Appendable:
+			r.appendables = append(r.appendables, val)
+		default:
+			r.find(v.Elem(), depth+1)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			r.find(v.Elem(), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			r.find(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			r.find(iter.Value(), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				r.find(v.Field(i), depth+1)
+			}
+		}
+	}
+}
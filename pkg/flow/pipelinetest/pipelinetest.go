@@ -0,0 +1,386 @@
+// Package pipelinetest runs the pipelines of a Flow configuration against
+// fixture inputs and asserts on their outputs.
+//
+// Each test loads the whole configuration in its own Flow controller, so
+// that pipelines made of several components, modules, and custom components
+// declared with declare blocks run as they would in Grafana Agent Flow.
+// Components at the edges of pipelines are replaced by fakes:
+//
+//   - Sinks, which export a log receiver or an appendable but don't forward
+//     data to other components, such as loki.write, are replaced by receivers
+//     which record what they receive.
+//   - Sources, which don't receive data from other components, such as
+//     loki.source.file or discovery.kubernetes, are replaced by components
+//     which don't collect anything and whose exports are the zero value of
+//     their type.
+//
+// The inputs of a test are sent to the exported receivers of its component,
+// or to the receivers in the arguments of its component if it's a source.
+package pipelinetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/agent/pkg/flow"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/agent/service/labelstore"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/printer"
+	"github.com/grafana/river/token/builder"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// settleTime is how long a test waits for further outputs once the expected
+// number of outputs was received, so that unexpected outputs are reported.
+const settleTime = 100 * time.Millisecond
+
+var (
+	logsReceiverType = reflect.TypeOf((*loki.LogsReceiver)(nil)).Elem()
+	appendableType   = reflect.TypeOf((*storage.Appendable)(nil)).Elem()
+	targetsType      = reflect.TypeOf([]discovery.Target(nil))
+)
+
+// Options configures a Runner.
+type Options struct {
+	// Logger receives logs from the controllers running tests. Logs are
+	// discarded if Logger is nil.
+	Logger *logging.Logger
+
+	// Timeout is how long a test waits for its component to start and for the
+	// expected outputs. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Runner runs pipeline tests against a Flow configuration.
+type Runner struct {
+	opts    Options
+	sources map[string][]byte
+}
+
+// NewRunner returns a Runner for the Flow configuration made of sources,
+// which maps the names of files to their content.
+func NewRunner(sources map[string][]byte, opts Options) (*Runner, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Logger == nil {
+		var err error
+		if opts.Logger, err = logging.New(io.Discard, logging.DefaultOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// Report syntax errors once rather than for every test.
+	if _, err := flow.ParseSources(sources); err != nil {
+		return nil, err
+	}
+	return &Runner{opts: opts, sources: sources}, nil
+}
+
+// ReadSources reads the Flow configuration at path, which is either a file
+// or a directory. The .river files at the top level of a directory are read.
+func ReadSources(path string) (map[string][]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		bb, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{path: bb}, nil
+	}
+
+	sources := map[string][]byte{}
+	err = filepath.WalkDir(path, func(curPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Don't recurse into child directories.
+		if d.IsDir() {
+			if curPath != path {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(curPath, ".river") {
+			return nil
+		}
+
+		bb, err := os.ReadFile(curPath)
+		sources[curPath] = bb
+		return err
+	})
+	return sources, err
+}
+
+// Run runs a single test. An error is returned if the configuration can't be
+// loaded or if the outputs of the pipeline don't match the expectations of
+// the test.
+func (r *Runner) Run(ctx context.Context, test Test) error {
+	sources, err := r.testSources(test)
+	if err != nil {
+		return err
+	}
+	source, err := flow.ParseSources(sources)
+	if err != nil {
+		return err
+	}
+
+	dataPath, err := os.MkdirTemp("", "agent-pipelinetest-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dataPath)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		capture  = newCapture(ctx)
+		registry = newRegistry(capture)
+		metrics  = prometheus.NewRegistry()
+	)
+	ctrl := flow.New(flow.Options{
+		Logger:            r.opts.Logger,
+		DataPath:          dataPath,
+		Reg:               metrics,
+		Services:          []service.Service{labelstore.New(r.opts.Logger)},
+		ComponentRegistry: registry,
+	})
+	if err := ctrl.LoadSource(source, nil); err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctrl.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer waitCancel()
+
+	recv, err := waitReceivers(waitCtx, ctrl, registry, test)
+	if err != nil {
+		return err
+	}
+	if err := sendInputs(waitCtx, recv, test.Input); err != nil {
+		return err
+	}
+
+	capture.Wait(waitCtx, len(test.Expect.Logs), len(test.Expect.Samples))
+	time.Sleep(settleTime)
+
+	var failures []string
+	if len(test.Input.Logs) > 0 || len(test.Expect.Logs) > 0 {
+		failures = append(failures, compareLogs(test.Expect.Logs, capture.Logs())...)
+	}
+	if len(test.Input.Samples) > 0 || len(test.Expect.Samples) > 0 {
+		failures = append(failures, compareSamples(test.Expect.Samples, capture.Samples())...)
+	}
+	if test.Expect.Targets != nil {
+		info, err := ctrl.GetComponent(component.ID{LocalID: test.Component}, component.InfoOptions{GetExports: true})
+		if err != nil {
+			return err
+		}
+		failures = append(failures, compareTargets(test.Expect.Targets, info.Exports)...)
+	}
+	if len(test.Expect.Metrics) > 0 {
+		families, err := metrics.Gather()
+		if err != nil {
+			return fmt.Errorf("gathering metrics: %w", err)
+		}
+		failures = append(failures, compareMetrics(test.Expect.Metrics, families, test.Component)...)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// testSources returns the sources of the configuration, where the targets
+// argument of the component of test is replaced by its input targets.
+func (r *Runner) testSources(test Test) (map[string][]byte, error) {
+	if test.Input.Targets == nil {
+		return r.sources, nil
+	}
+
+	expr := builder.NewExpr()
+	expr.SetValue(test.Input.Targets)
+	targets, err := parser.ParseExpression(string(expr.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("encoding input targets: %w", err)
+	}
+
+	sources := make(map[string][]byte, len(r.sources))
+	for name, bb := range r.sources {
+		sources[name] = bb
+	}
+
+	for name, bb := range r.sources {
+		file, err := parser.ParseFile(name, bb)
+		if err != nil {
+			return nil, err
+		}
+		block := findBlock(file.Body, test.Component)
+		if block == nil {
+			continue
+		}
+
+		// Custom components are left to report a targets argument which they
+		// don't declare when the configuration is loaded.
+		reg, builtin := component.Get(block.GetBlockName())
+		if builtin && targetsField(reflect.TypeOf(reg.Args)) < 0 {
+			return nil, fmt.Errorf("component %q has no targets argument to send input targets to", test.Component)
+		}
+		setAttribute(block, "targets", targets)
+
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, file); err != nil {
+			return nil, err
+		}
+		sources[name] = buf.Bytes()
+		return sources, nil
+	}
+	return nil, fmt.Errorf("component %q does not exist in the configuration", test.Component)
+}
+
+// findBlock returns the block of the component with the given ID in body.
+func findBlock(body ast.Body, id string) *ast.BlockStmt {
+	for _, stmt := range body {
+		block, ok := stmt.(*ast.BlockStmt)
+		if ok && block.Label != "" && block.GetBlockName()+"."+block.Label == id {
+			return block
+		}
+	}
+	return nil
+}
+
+// setAttribute sets the attribute name of block to value.
+func setAttribute(block *ast.BlockStmt, name string, value ast.Expr) {
+	for _, stmt := range block.Body {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok && attr.Name.Name == name {
+			attr.Value = value
+			return
+		}
+	}
+	block.Body = append(block.Body, &ast.AttributeStmt{
+		Name:  &ast.Ident{Name: name},
+		Value: value,
+	})
+}
+
+// waitReceivers returns the receivers which the inputs of test are sent to,
+// waiting for the component of test to export them. Exports of custom
+// components are set once their body is loaded.
+func waitReceivers(ctx context.Context, ctrl *flow.Flow, registry *registry, test Test) (*receivers, error) {
+	id := component.ID{LocalID: test.Component}
+
+	for {
+		var recv *receivers
+		if source, ok := registry.Source(test.Component); ok {
+			recv = source.Receivers()
+		} else {
+			info, err := ctrl.GetComponent(id, component.InfoOptions{GetExports: true})
+			if errors.Is(err, component.ErrComponentNotFound) {
+				return nil, fmt.Errorf("component %q does not exist in the configuration", test.Component)
+			} else if err != nil {
+				return nil, err
+			}
+			recv = &receivers{}
+			recv.find(reflect.ValueOf(info.Exports), 0)
+		}
+
+		ready := (len(test.Input.Logs) == 0 || len(recv.logs) > 0) &&
+			(len(test.Input.Samples) == 0 || len(recv.appendables) > 0)
+		if ready {
+			return recv, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(test.Input.Logs) > 0 && len(recv.logs) == 0 {
+				return nil, fmt.Errorf("component %q has no log receiver to send input log entries to", test.Component)
+			}
+			return nil, fmt.Errorf("component %q has no appendable to send input samples to", test.Component)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// sendInputs sends the fixture inputs to recv.
+func sendInputs(ctx context.Context, recv *receivers, input Input) error {
+	for _, logs := range recv.logs {
+		for _, in := range input.Logs {
+			ts := in.Timestamp
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+			entry := loki.Entry{
+				Labels: toLabelSet(in.Labels),
+				Entry:  logproto.Entry{Timestamp: ts, Line: in.Line},
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("sending input log entries: %w", ctx.Err())
+			case logs.Chan() <- entry:
+			}
+		}
+	}
+
+	for _, appendable := range recv.appendables {
+		if len(input.Samples) == 0 {
+			continue
+		}
+
+		app := appendable.Appender(ctx)
+		ts := time.Now().UnixMilli()
+		for _, s := range input.Samples {
+			if _, err := app.Append(0, labels.FromMap(s.Labels), ts, s.Value); err != nil {
+				_ = app.Rollback()
+				return fmt.Errorf("appending input sample: %w", err)
+			}
+		}
+		if err := app.Commit(); err != nil {
+			return fmt.Errorf("committing input samples: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func toLabelSet(m map[string]string) model.LabelSet {
+	ls := make(model.LabelSet, len(m))
+	for k, v := range m {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return ls
+}
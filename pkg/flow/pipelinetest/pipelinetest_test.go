@@ -0,0 +1,451 @@
+package pipelinetest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/pkg/flow/pipelinetest"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/grafana/agent/component/discovery/relabel"
+	_ "github.com/grafana/agent/component/loki/process"
+	_ "github.com/grafana/agent/component/loki/source/file"
+	_ "github.com/grafana/agent/component/loki/write"
+	_ "github.com/grafana/agent/component/prometheus/relabel"
+	_ "github.com/grafana/agent/component/prometheus/remotewrite"
+)
+
+const testConfig = `
+loki.process "default" {
+	forward_to = [loki.write.default.receiver]
+
+	stage.drop {
+		expression = ".*debug.*"
+	}
+
+	stage.regex {
+		expression = "level=(?P<level>\\w+)"
+	}
+
+	stage.labels {
+		values = { level = "" }
+	}
+
+	stage.metrics {
+		metric.counter {
+			name   = "lines_total"
+			prefix = "test_"
+			match_all = true
+			action = "inc"
+		}
+	}
+}
+
+loki.write "default" {
+	endpoint {
+		url = "http://localhost:3100/loki/api/v1/push"
+	}
+}
+
+prometheus.relabel "default" {
+	forward_to = [prometheus.remote_write.default.receiver]
+
+	rule {
+		source_labels = ["__name__"]
+		regex         = "unwanted_.*"
+		action        = "drop"
+	}
+
+	rule {
+		target_label = "env"
+		replacement  = "prod"
+	}
+}
+
+prometheus.remote_write "default" {
+	endpoint {
+		url = "http://localhost:9090/api/v1/write"
+	}
+}
+
+loki.source.file "default" {
+	targets    = [{ __path__ = "/var/log/app.log" }]
+	forward_to = [loki.process.first.receiver]
+}
+
+loki.process "first" {
+	forward_to = [loki.process.second.receiver]
+
+	stage.static_labels {
+		values = { stage = "first" }
+	}
+}
+
+loki.process "second" {
+	forward_to = [loki.write.default.receiver]
+
+	stage.drop {
+		expression = ".*drop_me.*"
+	}
+}
+
+declare "add_env" {
+	argument "forward_to" { }
+
+	loki.process "inner" {
+		forward_to = argument.forward_to.value
+
+		stage.static_labels {
+			values = { env = "prod" }
+		}
+
+		stage.metrics {
+			metric.counter {
+				name      = "inner_lines_total"
+				prefix    = "test_"
+				match_all = true
+				action    = "inc"
+			}
+		}
+	}
+
+	export "receiver" {
+		value = loki.process.inner.receiver
+	}
+}
+
+add_env "default" {
+	forward_to = [loki.write.default.receiver]
+}
+
+discovery.relabel "default" {
+	targets = []
+
+	rule {
+		source_labels = ["__meta_role"]
+		regex         = "node"
+		action        = "keep"
+	}
+
+	rule {
+		source_labels = ["__meta_name"]
+		target_label  = "instance"
+	}
+}
+`
+
+func TestRunner(t *testing.T) {
+	tt := []struct {
+		name      string
+		spec      string
+		expectErr string
+	}{
+		{
+			name: "loki.process",
+			spec: `
+				test "extracts_level" {
+					component = "loki.process.default"
+
+					input {
+						log {
+							line   = "level=info msg=hello"
+							labels = { job = "app" }
+						}
+						log {
+							line   = "level=debug msg=noise"
+							labels = { job = "app" }
+						}
+					}
+
+					expect {
+						log {
+							line   = "level=info msg=hello"
+							labels = { job = "app", level = "info" }
+						}
+
+						metric {
+							name  = "test_lines_total"
+							value = 1
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "loki.process mismatch",
+			spec: `
+				test "wrong_label" {
+					component = "loki.process.default"
+
+					input {
+						log {
+							line   = "level=info msg=hello"
+							labels = { job = "app" }
+						}
+					}
+
+					expect {
+						log {
+							line   = "level=info msg=hello"
+							labels = { job = "app", level = "warn" }
+						}
+					}
+				}
+			`,
+			expectErr: `log entry 0:`,
+		},
+		{
+			name: "loki.process all dropped",
+			spec: `
+				test "drops_debug" {
+					component = "loki.process.default"
+
+					input {
+						log {
+							line = "level=debug msg=noise"
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "prometheus.relabel",
+			spec: `
+				test "adds_env" {
+					component = "prometheus.relabel.default"
+
+					input {
+						sample {
+							labels = { __name__ = "up", job = "a" }
+							value  = 1
+						}
+						sample {
+							labels = { __name__ = "unwanted_metric", job = "a" }
+							value  = 2
+						}
+					}
+
+					expect {
+						sample {
+							labels = { __name__ = "up", job = "a", env = "prod" }
+							value  = 1
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "prometheus.relabel unexpected sample",
+			spec: `
+				test "keeps_everything" {
+					component = "prometheus.relabel.default"
+
+					input {
+						sample {
+							labels = { __name__ = "up" }
+							value  = 1
+						}
+					}
+				}
+			`,
+			expectErr: `expected 0 samples, got 1`,
+		},
+		{
+			name: "discovery.relabel",
+			spec: `
+				test "keeps_nodes" {
+					component = "discovery.relabel.default"
+
+					input {
+						targets = [
+							{ __address__ = "a:80", __meta_role = "node", __meta_name = "a" },
+							{ __address__ = "b:80", __meta_role = "pod", __meta_name = "b" },
+						]
+					}
+
+					expect {
+						targets = [
+							{ __address__ = "a:80", __meta_name = "a", __meta_role = "node", instance = "a" },
+						]
+					}
+				}
+			`,
+		},
+		{
+			name: "pipeline",
+			spec: `
+				test "runs_both_stages" {
+					component = "loki.process.first"
+
+					input {
+						log {
+							line = "keep"
+						}
+						log {
+							line = "drop_me"
+						}
+					}
+
+					expect {
+						log {
+							line   = "keep"
+							labels = { stage = "first" }
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "source",
+			spec: `
+				test "forwards_to_pipeline" {
+					component = "loki.source.file.default"
+
+					input {
+						log {
+							line = "hello"
+						}
+					}
+
+					expect {
+						log {
+							line   = "hello"
+							labels = { stage = "first" }
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "custom component",
+			spec: `
+				test "adds_env" {
+					component = "add_env.default"
+
+					input {
+						log {
+							line = "hello"
+						}
+					}
+
+					expect {
+						log {
+							line   = "hello"
+							labels = { env = "prod" }
+						}
+
+						metric {
+							name  = "test_inner_lines_total"
+							value = 1
+						}
+					}
+				}
+			`,
+		},
+		{
+			name: "no targets argument",
+			spec: `
+				test "targets" {
+					component = "loki.process.default"
+
+					input {
+						targets = [{ __address__ = "a:80" }]
+					}
+				}
+			`,
+			expectErr: `component "loki.process.default" has no targets argument to send input targets to`,
+		},
+		{
+			name: "unknown component",
+			spec: `
+				test "missing" {
+					component = "loki.process.missing"
+				}
+			`,
+			expectErr: `component "loki.process.missing" does not exist in the configuration`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := pipelinetest.ParseFile("test.river", []byte(tc.spec))
+			require.NoError(t, err)
+			require.Len(t, f.Tests, 1)
+
+			r, err := pipelinetest.NewRunner(map[string][]byte{"config.river": []byte(testConfig)}, pipelinetest.Options{
+				Timeout: time.Second,
+			})
+			require.NoError(t, err)
+
+			err = r.Run(context.Background(), f.Tests[0])
+			if tc.expectErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.expectErr)
+			}
+		})
+	}
+}
+
+func TestReadSources(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	writeFile("process.river", `
+		loki.process "default" {
+			forward_to = [loki.write.default.receiver]
+
+			stage.static_labels {
+				values = { job = "app" }
+			}
+		}
+	`)
+	writeFile("write.river", `
+		loki.write "default" {
+			endpoint {
+				url = "http://localhost:3100/loki/api/v1/push"
+			}
+		}
+	`)
+	writeFile("README.md", "not a river file")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "ignored.river"), []byte("not valid river"), 0o644))
+
+	sources, err := pipelinetest.ReadSources(dir)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+
+	r, err := pipelinetest.NewRunner(sources, pipelinetest.Options{Timeout: time.Second})
+	require.NoError(t, err)
+
+	f, err := pipelinetest.ParseFile("test.river", []byte(`
+		test "adds_job" {
+			component = "loki.process.default"
+
+			input {
+				log { line = "hello" }
+			}
+
+			expect {
+				log {
+					line   = "hello"
+					labels = { job = "app" }
+				}
+			}
+		}
+	`))
+	require.NoError(t, err)
+	require.NoError(t, r.Run(context.Background(), f.Tests[0]))
+}
+
+func TestParseFile_DuplicateTest(t *testing.T) {
+	_, err := pipelinetest.ParseFile("test.river", []byte(`
+		test "a" { component = "loki.process.default" }
+		test "a" { component = "loki.process.default" }
+	`))
+	require.ErrorContains(t, err, `test "a" is defined more than once`)
+}
@@ -0,0 +1,105 @@
+package pipelinetest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/component/discovery"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/vm"
+)
+
+// File is a set of pipeline tests read from a test spec.
+type File struct {
+	Tests []Test `river:"test,block,optional"`
+}
+
+// Test is a single pipeline test. A test loads the configuration, sends the
+// inputs to one of its components, and asserts on the outputs recorded by the
+// fake sinks of the configuration.
+type Test struct {
+	Name      string `river:",label"`
+	Component string `river:"component,attr"`
+
+	Input  Input  `river:"input,block,optional"`
+	Expect Expect `river:"expect,block,optional"`
+}
+
+// Input holds the fixture inputs of a test.
+//
+// Log entries are sent to the exported log receivers of the component, and
+// samples are appended to its exported appendables. If the component is a
+// source, they're sent to the receivers in its arguments instead. Targets
+// replace the targets argument of the component.
+type Input struct {
+	Logs    []LogEntry         `river:"log,block,optional"`
+	Samples []Sample           `river:"sample,block,optional"`
+	Targets []discovery.Target `river:"targets,attr,optional"`
+}
+
+// Expect holds the assertions of a test.
+//
+// Log entries and samples are compared in order against everything the fake
+// sinks of the configuration received. They're always asserted when the test
+// has inputs of the same kind, so a test without expected log entries asserts
+// that every input log entry was dropped. Targets are compared against the
+// exported targets of the component. Metrics only need to match the metrics
+// exposed by the component, or by the components declared within it, which
+// they name.
+type Expect struct {
+	Logs    []LogEntry         `river:"log,block,optional"`
+	Samples []Sample           `river:"sample,block,optional"`
+	Targets []discovery.Target `river:"targets,attr,optional"`
+	Metrics []Metric           `river:"metric,block,optional"`
+}
+
+// LogEntry is a log line and its labels. An input entry without a timestamp
+// is given the current time. An expected entry without a timestamp matches
+// any timestamp.
+type LogEntry struct {
+	Line      string            `river:"line,attr"`
+	Labels    map[string]string `river:"labels,attr,optional"`
+	Timestamp time.Time         `river:"timestamp,attr,optional"`
+}
+
+// Sample is a single float sample. The metric name is set with the __name__
+// label.
+type Sample struct {
+	Labels map[string]string `river:"labels,attr"`
+	Value  float64           `river:"value,attr"`
+}
+
+// Metric is an expected value of a counter, gauge, or untyped metric exposed
+// by the component of a test. Labels only need to be a subset of the labels of
+// the series.
+type Metric struct {
+	Name   string            `river:"name,attr"`
+	Labels map[string]string `river:"labels,attr,optional"`
+	Value  float64           `river:"value,attr"`
+}
+
+// ParseFile parses and decodes a test spec. filename is used for reporting
+// errors.
+func ParseFile(filename string, bb []byte) (*File, error) {
+	node, err := parser.ParseFile(filename, bb)
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := vm.New(node).Evaluate(nil, &f); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(f.Tests))
+	for _, t := range f.Tests {
+		if t.Name == "" {
+			return nil, fmt.Errorf("%s: test block must have a label", filename)
+		}
+		if _, ok := seen[t.Name]; ok {
+			return nil, fmt.Errorf("%s: test %q is defined more than once", filename, t.Name)
+		}
+		seen[t.Name] = struct{}{}
+	}
+	return &f, nil
+}
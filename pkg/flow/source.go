@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/grafana/agent/pkg/config/encoder"
+	"github.com/grafana/agent/pkg/flow/internal/importsource"
 	"github.com/grafana/river/ast"
 	"github.com/grafana/river/diag"
 	"github.com/grafana/river/parser"
@@ -19,8 +20,10 @@ type Source struct {
 
 	// Components holds the list of raw River AST blocks describing components.
 	// The Flow controller can interpret them.
-	components   []*ast.BlockStmt
-	configBlocks []*ast.BlockStmt
+	components    []*ast.BlockStmt
+	configBlocks  []*ast.BlockStmt
+	declareBlocks []*ast.BlockStmt
+	importBlocks  []*ast.BlockStmt
 }
 
 // ParseSource parses the River file specified by bb into a File. name should be
@@ -37,6 +40,18 @@ func ParseSource(name string, bb []byte) (*Source, error) {
 		return nil, err
 	}
 
+	source, err := sourceFromBody(node.Body)
+	if err != nil {
+		return nil, err
+	}
+	source.sourceMap = map[string][]byte{name: bb}
+	source.hash = sha256.Sum256(bb)
+	return source, nil
+}
+
+// sourceFromBody creates a Source from the statements in body. The returned
+// Source has no raw content or hash.
+func sourceFromBody(body ast.Body) (*Source, error) {
 	// Look for predefined non-components blocks (i.e., logging), and store
 	// everything else into a list of components.
 	//
@@ -45,9 +60,11 @@ func ParseSource(name string, bb []byte) (*Source, error) {
 	var (
 		components []*ast.BlockStmt
 		configs    []*ast.BlockStmt
+		declares   []*ast.BlockStmt
+		imports    []*ast.BlockStmt
 	)
 
-	for _, stmt := range node.Body {
+	for _, stmt := range body {
 		switch stmt := stmt.(type) {
 		case *ast.AttributeStmt:
 			return nil, diag.Diagnostic{
@@ -62,6 +79,10 @@ func ParseSource(name string, bb []byte) (*Source, error) {
 			switch fullName {
 			case "logging", "tracing", "argument", "export":
 				configs = append(configs, stmt)
+			case "declare":
+				declares = append(declares, stmt)
+			case importsource.BlockImportFile, importsource.BlockImportGit, importsource.BlockImportHTTP:
+				imports = append(imports, stmt)
 			default:
 				components = append(components, stmt)
 			}
@@ -77,10 +98,10 @@ func ParseSource(name string, bb []byte) (*Source, error) {
 	}
 
 	return &Source{
-		components:   components,
-		configBlocks: configs,
-		sourceMap:    map[string][]byte{name: bb},
-		hash:         sha256.Sum256(bb),
+		components:    components,
+		configBlocks:  configs,
+		declareBlocks: declares,
+		importBlocks:  imports,
 	}, nil
 }
 
@@ -120,6 +141,8 @@ func ParseSources(sources map[string][]byte) (*Source, error) {
 
 		mergedSource.components = append(mergedSource.components, sourceFragment.components...)
 		mergedSource.configBlocks = append(mergedSource.configBlocks, sourceFragment.configBlocks...)
+		mergedSource.declareBlocks = append(mergedSource.declareBlocks, sourceFragment.declareBlocks...)
+		mergedSource.importBlocks = append(mergedSource.importBlocks, sourceFragment.importBlocks...)
 	}
 
 	mergedSource.hash = [32]byte(hash.Sum(nil))
@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/agent/pkg/flow/internal/controller"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/printer"
+)
+
+// SourceDiff describes how the blocks of a source differ from the blocks of
+// the source loaded before it. Blocks are identified by their ID, such as
+// "prometheus.scrape.default" or "logging".
+type SourceDiff struct {
+	Added   []string `json:"added"`   // Blocks only in the new source.
+	Removed []string `json:"removed"` // Blocks only in the old source.
+	Changed []string `json:"changed"` // Blocks in both sources whose arguments changed.
+
+	EdgesAdded   []Edge `json:"edgesAdded"`   // References only in the new source.
+	EdgesRemoved []Edge `json:"edgesRemoved"` // References only in the old source.
+}
+
+// Edge is a reference from the block From to the block To.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// String returns the edge as "from -> to".
+func (e Edge) String() string {
+	return e.From + " -> " + e.To
+}
+
+// Empty returns true if the diff doesn't hold any change.
+func (d SourceDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.EdgesAdded) == 0 && len(d.EdgesRemoved) == 0
+}
+
+// LogFields returns the diff as key/value pairs for a structured log line.
+func (d SourceDiff) LogFields() []interface{} {
+	return []interface{}{
+		"added", strings.Join(d.Added, ","),
+		"removed", strings.Join(d.Removed, ","),
+		"changed", strings.Join(d.Changed, ","),
+		"edges_added", joinEdges(d.EdgesAdded),
+		"edges_removed", joinEdges(d.EdgesRemoved),
+	}
+}
+
+func joinEdges(edges []Edge) string {
+	ss := make([]string, len(edges))
+	for i, e := range edges {
+		ss[i] = e.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+// DiffSources computes the differences between the blocks of the old and new
+// sources. Either source may be nil, in which case it's treated as empty.
+// Blocks are compared after formatting, so changes which only affect
+// whitespace or comments aren't reported.
+func DiffSources(old, new *Source) SourceDiff {
+	var (
+		oldBlocks = sourceBlocks(old)
+		newBlocks = sourceBlocks(new)
+		oldEdges  = sourceEdges(oldBlocks)
+		newEdges  = sourceEdges(newBlocks)
+
+		diff SourceDiff
+	)
+
+	for id, newBlock := range newBlocks {
+		oldBlock, ok := oldBlocks[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, id)
+		case printBlock(oldBlock) != printBlock(newBlock):
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range oldBlocks {
+		if _, ok := newBlocks[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	for e := range newEdges {
+		if _, ok := oldEdges[e]; !ok {
+			diff.EdgesAdded = append(diff.EdgesAdded, e)
+		}
+	}
+	for e := range oldEdges {
+		if _, ok := newEdges[e]; !ok {
+			diff.EdgesRemoved = append(diff.EdgesRemoved, e)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	sortEdges(diff.EdgesAdded)
+	sortEdges(diff.EdgesRemoved)
+	return diff
+}
+
+// sourceBlocks returns the top-level blocks of s by ID.
+func sourceBlocks(s *Source) map[string]*ast.BlockStmt {
+	blocks := make(map[string]*ast.BlockStmt)
+	if s == nil {
+		return blocks
+	}
+	for _, list := range [][]*ast.BlockStmt{s.components, s.configBlocks, s.declareBlocks, s.importBlocks} {
+		for _, b := range list {
+			blocks[controller.BlockComponentID(b).String()] = b
+		}
+	}
+	return blocks
+}
+
+// sourceEdges returns the references between blocks. The bodies of declare
+// blocks are skipped, since they reference blocks of their own scope.
+func sourceEdges(blocks map[string]*ast.BlockStmt) map[Edge]struct{} {
+	ids := make(map[string]struct{}, len(blocks))
+	for id := range blocks {
+		ids[id] = struct{}{}
+	}
+
+	edges := make(map[Edge]struct{})
+	for id, b := range blocks {
+		if b.GetBlockName() == "declare" {
+			continue
+		}
+		for _, ref := range controller.BlockReferences(b, ids) {
+			edges[Edge{From: id, To: ref}] = struct{}{}
+		}
+	}
+	return edges
+}
+
+func printBlock(b *ast.BlockStmt) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, b); err != nil {
+		// Blocks which can't be printed are always reported as changed.
+		return fmt.Sprintf("%p", b)
+	}
+	return buf.String()
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
@@ -0,0 +1,62 @@
+package flow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSources(t *testing.T) {
+	oldSource, err := ParseSource(t.Name(), []byte(`
+		logging {
+			level = "info"
+		}
+
+		testcomponents.tick "ticker" {
+			frequency = "1s"
+		}
+
+		testcomponents.passthrough "static" {
+			input = "hello, world!"
+		}
+
+		testcomponents.passthrough "ticker" {
+			input = testcomponents.tick.ticker.tick_time
+		}
+	`))
+	require.NoError(t, err)
+
+	newSource, err := ParseSource(t.Name(), []byte(`
+		// Formatting and comments changes aren't reported.
+		logging { level = "info" }
+
+		testcomponents.tick "ticker" {
+			frequency = "5s"
+		}
+
+		testcomponents.passthrough "ticker" {
+			input = testcomponents.passthrough.forwarded.output
+		}
+
+		testcomponents.passthrough "forwarded" {
+			input = testcomponents.tick.ticker.tick_time
+		}
+	`))
+	require.NoError(t, err)
+
+	require.Equal(t, SourceDiff{
+		Added:   []string{"testcomponents.passthrough.forwarded"},
+		Removed: []string{"testcomponents.passthrough.static"},
+		Changed: []string{"testcomponents.passthrough.ticker", "testcomponents.tick.ticker"},
+		EdgesAdded: []Edge{
+			{From: "testcomponents.passthrough.forwarded", To: "testcomponents.tick.ticker"},
+			{From: "testcomponents.passthrough.ticker", To: "testcomponents.passthrough.forwarded"},
+		},
+		EdgesRemoved: []Edge{
+			{From: "testcomponents.passthrough.ticker", To: "testcomponents.tick.ticker"},
+		},
+	}, DiffSources(oldSource, newSource))
+
+	require.True(t, DiffSources(newSource, newSource).Empty())
+	require.Equal(t, []string{"logging", "testcomponents.passthrough.static", "testcomponents.passthrough.ticker", "testcomponents.tick.ticker"}, DiffSources(nil, oldSource).Added)
+}
@@ -0,0 +1,267 @@
+package tap
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/component/pyroscope"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	otelconsumer "go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// maxArgumentsDepth limits how deeply WrapArguments searches arguments for
+// receivers.
+const maxArgumentsDepth = 8
+
+// WrapArguments returns a copy of args where every storage.Appendable,
+// loki.LogsReceiver, otelcol.Consumer, or pyroscope.Appendable is replaced
+// with a wrapper which counts the items the component sends to it. Receivers
+// are searched for in struct fields, pointers to structs, and slices. Structs
+// and slices containing receivers are copied rather than modified.
+//
+// Log entries are counted when the component retrieves the channel of a
+// receiver, without forwarding them through an intermediate channel.
+//
+// Like WrapExports, wrappers are cached for each original receiver, so
+// calling WrapArguments repeatedly with the same receivers returns arguments
+// which are deeply equal. See CommitArguments.
+func (h *Hub) WrapArguments(args component.Arguments) component.Arguments {
+	if args == nil {
+		return nil
+	}
+
+	h.sendMut.Lock()
+	defer h.sendMut.Unlock()
+
+	wrapped := make(map[any]any, len(h.sendWrapped))
+	out, _ := h.wrapValue(reflect.ValueOf(args), wrapped, 0)
+	h.sendPending = wrapped
+	return out.Interface()
+}
+
+// CommitArguments must be called once the component uses the arguments
+// returned by the last call to WrapArguments. The wrappers which the
+// component no longer uses are forgotten. Arguments which the component
+// rejected must not be committed, since it keeps using its previous
+// arguments.
+func (h *Hub) CommitArguments() {
+	h.sendMut.Lock()
+	defer h.sendMut.Unlock()
+
+	if h.sendPending == nil {
+		return
+	}
+	h.sendWrapped, h.sendPending = h.sendPending, nil
+}
+
+// wrapValue returns v with its receivers wrapped. The returned bool is true
+// if v was changed.
+func (h *Hub) wrapValue(v reflect.Value, wrapped map[any]any, depth int) (reflect.Value, bool) {
+	if depth > maxArgumentsDepth {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		inner := v.Interface()
+		if !reflect.TypeOf(inner).Comparable() {
+			return v, false
+		}
+
+		wrapper, ok := h.sendPending[inner]
+		if !ok {
+			wrapper, ok = h.sendWrapped[inner]
+		}
+		if !ok {
+			wrapper = h.newSendWrapper(v.Type(), inner)
+		}
+		if wrapper == nil {
+			return v, false
+		}
+		wrapped[inner] = wrapper
+
+		out := reflect.New(v.Type()).Elem()
+		out.Set(reflect.ValueOf(wrapper))
+		return out, true
+
+	case reflect.Pointer:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return v, false
+		}
+		elem, changed := h.wrapValue(v.Elem(), wrapped, depth+1)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Elem().Type())
+		out.Elem().Set(elem)
+		return out, true
+
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			field, changed := h.wrapValue(v.Field(i), wrapped, depth+1)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(field)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+
+	case reflect.Slice:
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := h.wrapValue(v.Index(i), wrapped, depth+1)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+
+	default:
+		return v, false
+	}
+}
+
+func (h *Hub) newSendWrapper(typ reflect.Type, inner any) any {
+	switch typ {
+	case appendableType:
+		return &sendAppendable{hub: h, next: inner.(storage.Appendable)}
+	case logsReceiverType:
+		return &sendLogsReceiver{hub: h, next: inner.(loki.LogsReceiver)}
+	case consumerType:
+		return &sendConsumer{hub: h, next: inner.(otelcol.Consumer)}
+	case pyroscopeType:
+		return &sendPyroscopeAppendable{hub: h, next: inner.(pyroscope.Appendable)}
+	default:
+		return nil
+	}
+}
+
+// sendAppendable wraps a storage.Appendable in the arguments of a component.
+type sendAppendable struct {
+	hub  *Hub
+	next storage.Appendable
+}
+
+var _ storage.Appendable = (*sendAppendable)(nil)
+
+// Appender implements storage.Appendable.
+func (a *sendAppendable) Appender(ctx context.Context) storage.Appender {
+	return &sendAppender{Appender: a.next.Appender(ctx), hub: a.hub}
+}
+
+type sendAppender struct {
+	storage.Appender
+	hub *Hub
+}
+
+func (a *sendAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.hub.sent.Inc()
+	return a.Appender.Append(ref, l, t, v)
+}
+
+func (a *sendAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	a.hub.sent.Inc()
+	return a.Appender.AppendHistogram(ref, l, t, h, fh)
+}
+
+// sendLogsReceiver wraps a loki.LogsReceiver in the arguments of a
+// component. Components retrieve the channel of a receiver for every entry
+// they send, so entries are counted when the channel is retrieved, and are
+// sent directly to the original receiver.
+type sendLogsReceiver struct {
+	hub  *Hub
+	next loki.LogsReceiver
+}
+
+var _ loki.LogsReceiver = (*sendLogsReceiver)(nil)
+
+// Chan implements loki.LogsReceiver.
+func (r *sendLogsReceiver) Chan() chan loki.Entry {
+	r.hub.sent.Inc()
+	return r.next.Chan()
+}
+
+// sendConsumer wraps an otelcol.Consumer in the arguments of a component.
+type sendConsumer struct {
+	hub  *Hub
+	next otelcol.Consumer
+}
+
+var _ otelcol.Consumer = (*sendConsumer)(nil)
+
+// Capabilities implements otelcol.Consumer.
+func (c *sendConsumer) Capabilities() otelconsumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+// ConsumeTraces implements otelcol.Consumer.
+func (c *sendConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	c.hub.sent.Add(uint64(td.SpanCount()))
+	return c.next.ConsumeTraces(ctx, td)
+}
+
+// ConsumeMetrics implements otelcol.Consumer.
+func (c *sendConsumer) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	c.hub.sent.Add(uint64(md.DataPointCount()))
+	return c.next.ConsumeMetrics(ctx, md)
+}
+
+// ConsumeLogs implements otelcol.Consumer.
+func (c *sendConsumer) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	c.hub.sent.Add(uint64(ld.LogRecordCount()))
+	return c.next.ConsumeLogs(ctx, ld)
+}
+
+// sendPyroscopeAppendable wraps a pyroscope.Appendable in the arguments of a
+// component.
+type sendPyroscopeAppendable struct {
+	hub  *Hub
+	next pyroscope.Appendable
+}
+
+var _ pyroscope.Appendable = (*sendPyroscopeAppendable)(nil)
+
+// Appender implements pyroscope.Appendable.
+func (a *sendPyroscopeAppendable) Appender() pyroscope.Appender {
+	return &sendPyroscopeAppender{hub: a.hub, next: a.next.Appender()}
+}
+
+type sendPyroscopeAppender struct {
+	hub  *Hub
+	next pyroscope.Appender
+}
+
+func (a *sendPyroscopeAppender) Append(ctx context.Context, l labels.Labels, samples []*pyroscope.RawSample) error {
+	a.hub.sent.Add(uint64(len(samples)))
+	return a.next.Append(ctx, l, samples)
+}
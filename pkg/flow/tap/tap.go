@@ -0,0 +1,287 @@
+// Package tap implements sampling of the data which passes through the
+// receivers exported by Flow components, such as the samples appended to a
+// storage.Appendable or the log entries sent to a loki.LogsReceiver.
+//
+// A Hub is created for each component. The Hub wraps the component's exports
+// so that tapped receivers publish sampled events to subscribers while at
+// least one subscriber exists. When nobody is subscribed, wrapped receivers
+// forward data to the original receivers without inspecting it.
+//
+// Hubs also count the items which pass through their wrappers, whether or not
+// anybody is subscribed: items received through the wrapped exports of the
+// component, and items the component sends to the receivers in its
+// arguments. See WrapArguments.
+package tap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"go.uber.org/atomic"
+	"golang.org/x/time/rate"
+)
+
+// ErrNotTappable is returned when subscribing to a component which doesn't
+// export any receivers which can be tapped.
+var ErrNotTappable = errors.New("component does not export any receivers which can be tapped")
+
+// Provider is implemented by systems which allow tapping into the receivers
+// of running components.
+type Provider interface {
+	// Tap subscribes to events from the exported receivers of the component
+	// identified by id. The returned channel is closed once ctx is canceled or
+	// the component stops running.
+	//
+	// Tap returns [component.ErrComponentNotFound] if the component doesn't
+	// exist, or ErrNotTappable if the component doesn't export any receivers
+	// which can be tapped.
+	Tap(ctx context.Context, id component.ID, opts Options) (<-chan Event, error)
+}
+
+// Options configures a subscription to a Hub.
+type Options struct {
+	// Rate is the maximum number of events per second sent to the subscriber.
+	// Events beyond the rate are dropped.
+	Rate float64
+}
+
+// DefaultOptions holds the default Options for a subscription.
+var DefaultOptions = Options{
+	Rate: 10,
+}
+
+// MaxRate is the highest value permitted for Options.Rate.
+const MaxRate = 1000
+
+// Kinds of events which can be published by tapped receivers.
+const (
+	KindSample    = "sample"    // A Prometheus sample.
+	KindHistogram = "histogram" // A Prometheus native histogram sample.
+	KindExemplar  = "exemplar"  // A Prometheus exemplar.
+	KindLog       = "log"       // A Loki log entry.
+	KindTraces    = "traces"    // A batch of OpenTelemetry traces.
+	KindMetrics   = "metrics"   // A batch of OpenTelemetry metrics.
+	KindLogs      = "logs"      // A batch of OpenTelemetry logs.
+	KindProfile   = "profile"   // A Pyroscope profile.
+)
+
+// Event is a single item sampled from a tapped receiver.
+type Event struct {
+	Time      time.Time `json:"time"`             // When the event was observed.
+	Receiver  string    `json:"receiver"`         // River name of the exported receiver.
+	Kind      string    `json:"kind"`             // Kind of event.
+	Labels    string    `json:"labels,omitempty"` // Labels associated with the data, if any.
+	Timestamp time.Time `json:"timestamp"`        // Timestamp of the data. Zero if the data has no timestamp.
+	Data      string    `json:"data"`             // Human-readable representation of the data.
+}
+
+// Hub publishes events from the tapped receivers of a single component to
+// its subscribers.
+//
+// The Hub is closed when the component stops running, disconnecting its
+// subscribers, and reopened when the component runs again. Wrapped receivers
+// forward data independently of the state of the Hub.
+type Hub struct {
+	active atomic.Int64 // Number of current subscribers.
+
+	received atomic.Uint64 // Items received through wrapped exports.
+	sent     atomic.Uint64 // Items sent through wrapped arguments.
+
+	mut    sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+	done   chan struct{} // Closed when the Hub is closed.
+
+	wrapMut sync.Mutex
+	wrapped map[any]any // Original receivers to their wrapped versions.
+
+	sendMut     sync.Mutex
+	sendWrapped map[any]any // Receivers in arguments to their wrapped versions.
+	sendPending map[any]any // Wrappers of arguments which aren't committed yet.
+}
+
+// retirer is implemented by wrappers which run goroutines, which are stopped
+// once the wrapper is no longer used.
+type retirer interface {
+	retire()
+}
+
+// isClosed returns true if ch is closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// retireUnused retires the wrappers of prev which aren't in next.
+func retireUnused(prev, next map[any]any) {
+	for inner, wrapper := range prev {
+		if r, ok := wrapper.(retirer); ok && next[inner] != wrapper {
+			r.retire()
+		}
+	}
+}
+
+type subscriber struct {
+	ch      chan Event
+	limiter *rate.Limiter
+}
+
+// NewHub creates a new Hub with no subscribers.
+func NewHub() *Hub {
+	return &Hub{
+		done:    make(chan struct{}),
+		subs:    make(map[*subscriber]struct{}),
+		wrapped: make(map[any]any),
+
+		sendWrapped: make(map[any]any),
+	}
+}
+
+// Active returns true if the Hub has at least one subscriber.
+func (h *Hub) Active() bool {
+	return h.active.Load() > 0
+}
+
+// Received returns the number of items received through the wrapped exports
+// of the component. Items are samples and native histogram samples, log
+// entries, OpenTelemetry spans, data points, and log records, or profiles.
+func (h *Hub) Received() uint64 {
+	return h.received.Load()
+}
+
+// Sent returns the number of items the component sent through the receivers
+// in its arguments. Items are counted the same way as for Received.
+func (h *Hub) Sent() uint64 {
+	return h.sent.Load()
+}
+
+// Tappable returns true if the last exports passed to WrapExports contained
+// at least one receiver which can be tapped.
+func (h *Hub) Tappable() bool {
+	h.wrapMut.Lock()
+	defer h.wrapMut.Unlock()
+	return len(h.wrapped) > 0
+}
+
+// Subscribe registers a new subscriber. The returned channel is closed once
+// ctx is canceled or h is closed. Subscribing to a closed Hub returns a
+// closed channel.
+func (h *Hub) Subscribe(ctx context.Context, opts Options) (<-chan Event, error) {
+	if !h.Tappable() {
+		return nil, ErrNotTappable
+	}
+
+	r := opts.Rate
+	if r <= 0 {
+		r = DefaultOptions.Rate
+	}
+	if r > MaxRate {
+		r = MaxRate
+	}
+	burst := int(r)
+	if burst < 1 {
+		burst = 1
+	}
+
+	sub := &subscriber{
+		ch:      make(chan Event, burst),
+		limiter: rate.NewLimiter(rate.Limit(r), burst),
+	}
+
+	h.mut.Lock()
+	if h.closed {
+		h.mut.Unlock()
+		close(sub.ch)
+		return sub.ch, nil
+	}
+	h.subs[sub] = struct{}{}
+	h.active.Inc()
+	done := h.done
+	h.mut.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		h.mut.Lock()
+		defer h.mut.Unlock()
+		if _, ok := h.subs[sub]; ok {
+			delete(h.subs, sub)
+			h.active.Dec()
+			close(sub.ch)
+		}
+	}()
+
+	return sub.ch, nil
+}
+
+// publish sends an event to all subscribers which haven't exceeded their
+// rate. build is only invoked if at least one subscriber accepts the event,
+// so callers can defer the cost of building events until they're needed.
+func (h *Hub) publish(build func() Event) {
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+
+	var (
+		ev    Event
+		built bool
+	)
+	for sub := range h.subs {
+		if !sub.limiter.Allow() {
+			continue
+		}
+		if !built {
+			ev = build()
+			ev.Time = time.Now()
+			built = true
+		}
+
+		// Never block the pipeline on a slow subscriber.
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// Open reopens a Hub closed by Close, so that it accepts subscribers again.
+// Open does nothing if the Hub isn't closed.
+func (h *Hub) Open() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if !h.closed {
+		return
+	}
+	h.closed = false
+	h.done = make(chan struct{})
+}
+
+// Close closes the Hub, closing the channels of all subscribers, until the
+// Hub is reopened by Open. Wrapped receivers continue to forward data to
+// their original receivers while the Hub is closed.
+func (h *Hub) Close() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		h.active.Dec()
+		close(sub.ch)
+	}
+}
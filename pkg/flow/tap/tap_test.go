@@ -0,0 +1,349 @@
+package tap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+type testExports struct {
+	Receiver   storage.Appendable `river:"receiver,attr"`
+	LogsInput  loki.LogsReceiver  `river:"logs_input,attr"`
+	Unrelated  string             `river:"unrelated,attr"`
+	unexported storage.Appendable
+}
+
+func TestHub_WrapExports(t *testing.T) {
+	hub := NewHub()
+	require.False(t, hub.Tappable())
+
+	in := testExports{
+		Receiver:  &fakeAppendable{},
+		LogsInput: loki.NewLogsReceiver(),
+		Unrelated: "value",
+	}
+
+	out := hub.WrapExports(in).(testExports)
+	require.True(t, hub.Tappable())
+	require.IsType(t, &tapAppendable{}, out.Receiver)
+	require.IsType(t, &tapLogsReceiver{}, out.LogsInput)
+	require.Equal(t, "value", out.Unrelated)
+
+	// Wrapping the same receivers again must produce equal exports so that
+	// dependants aren't re-evaluated.
+	again := hub.WrapExports(in).(testExports)
+	require.True(t, reflect.DeepEqual(out, again))
+
+	// Exports without receivers aren't tappable.
+	hub.WrapExports(testExports{Unrelated: "value"})
+	require.False(t, hub.Tappable())
+
+	_, err := hub.Subscribe(context.Background(), DefaultOptions)
+	require.ErrorIs(t, err, ErrNotTappable)
+}
+
+func TestHub_Appendable(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	next := &fakeAppendable{}
+	out := hub.WrapExports(testExports{Receiver: next}).(testExports)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := hub.Subscribe(ctx, Options{Rate: 1})
+	require.NoError(t, err)
+
+	app := out.Receiver.Appender(context.Background())
+	_, err = app.Append(0, labels.FromStrings("foo", "bar"), 1000, 42)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings("foo", "baz"), 2000, 43)
+	require.NoError(t, err)
+
+	// Data is always forwarded, even when it exceeds the rate of subscribers.
+	require.Equal(t, 2, next.samples)
+
+	ev := <-events
+	require.Equal(t, "receiver", ev.Receiver)
+	require.Equal(t, KindSample, ev.Kind)
+	require.Equal(t, `{foo="bar"}`, ev.Labels)
+	require.Equal(t, "42", ev.Data)
+	require.Equal(t, time.UnixMilli(1000), ev.Timestamp)
+
+	// The second sample exceeded the rate of the subscriber.
+	select {
+	case ev := <-events:
+		require.FailNow(t, "unexpected event", "%v", ev)
+	default:
+	}
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, hub.Active())
+}
+
+func TestHub_LogsReceiver(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	next := loki.NewLogsReceiver()
+	out := hub.WrapExports(testExports{LogsInput: next}).(testExports)
+
+	// Without subscribers, senders write to the original channel.
+	require.Equal(t, next.Chan(), out.LogsInput.Chan())
+
+	events, err := hub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+
+	entry := loki.Entry{Labels: model.LabelSet{"job": "test"}}
+	entry.Timestamp = time.Unix(10, 0)
+	entry.Line = "hello"
+	go func() { out.LogsInput.Chan() <- entry }()
+
+	select {
+	case got := <-next.Chan():
+		require.Equal(t, "hello", got.Line)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "entry was not forwarded")
+	}
+
+	ev := <-events
+	require.Equal(t, KindLog, ev.Kind)
+	require.Equal(t, "logs_input", ev.Receiver)
+	require.Equal(t, `{job="test"}`, ev.Labels)
+	require.Equal(t, "hello", ev.Data)
+}
+
+func TestHub_LogsReceiverAfterClose(t *testing.T) {
+	var (
+		receiverHub = NewHub()
+		senderHub   = NewHub()
+		next        = loki.NewLogsReceiver()
+	)
+	defer senderHub.Close()
+
+	out := receiverHub.WrapExports(testExports{LogsInput: next}).(testExports)
+	_, err := receiverHub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+
+	// Senders may still hold the intermediate channels after the Hub of the
+	// receiving component is closed.
+	var (
+		tapped = out.LogsInput.Chan()
+		sent   = senderHub.WrapArguments(testOutput{Logs: []loki.LogsReceiver{out.LogsInput}}).(testOutput).Logs[0].Chan()
+	)
+	require.NotEqual(t, next.Chan(), tapped)
+	receiverHub.Close()
+
+	for _, ch := range []chan loki.Entry{tapped, sent} {
+		go func(ch chan loki.Entry) { ch <- loki.Entry{} }(ch)
+
+		select {
+		case <-next.Chan():
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "entry was not forwarded")
+		}
+	}
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub()
+	hub.WrapExports(testExports{Receiver: &fakeAppendable{}})
+
+	events, err := hub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+	require.True(t, hub.Active())
+
+	hub.Close()
+	_, ok := <-events
+	require.False(t, ok)
+	require.False(t, hub.Active())
+
+	// Subscribing after close returns a closed channel.
+	events, err = hub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+	_, ok = <-events
+	require.False(t, ok)
+
+	// The Hub accepts subscribers again once reopened, such as when the
+	// component is restarted.
+	hub.Open()
+	_, err = hub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+	require.True(t, hub.Active())
+	hub.Close()
+	require.False(t, hub.Active())
+}
+
+func TestHub_Retire(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	var (
+		prevNext = loki.NewLogsReceiver()
+		next     = loki.NewLogsReceiver()
+	)
+	prev := hub.WrapExports(testExports{LogsInput: prevNext}).(testExports).LogsInput
+	_, err := hub.Subscribe(context.Background(), DefaultOptions)
+	require.NoError(t, err)
+
+	// Exported receivers which are replaced stop being tapped. Senders which
+	// retrieved the intermediate channel before are still served.
+	held := prev.Chan()
+	require.NotEqual(t, prevNext.Chan(), held)
+	hub.WrapExports(testExports{LogsInput: next})
+	require.Equal(t, prevNext.Chan(), prev.Chan())
+
+	go func() { held <- loki.Entry{} }()
+	select {
+	case <-prevNext.Chan():
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "entry was not forwarded")
+	}
+}
+
+func TestForwardLogs_Retired(t *testing.T) {
+	var (
+		ch       = make(chan loki.Entry)
+		retired  = make(chan struct{})
+		lastUsed atomic.Int64
+		received atomic.Int64
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		forwardLogs(ch, retired, &lastUsed, 100*time.Millisecond, func(loki.Entry) { received.Inc() })
+	}()
+
+	// A sender which retrieved the channel before it was retired is served.
+	lastUsed.Store(time.Now().UnixNano())
+	close(retired)
+	ch <- loki.Entry{}
+	require.Eventually(t, func() bool { return received.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Senders which retrieved the channel but never send to it, such as
+	// senders whose context was canceled, aren't waited for.
+	lastUsed.Store(time.Now().UnixNano())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "forwarding didn't stop once the channel was idle")
+	}
+}
+
+type testArguments struct {
+	ForwardTo  []storage.Appendable `river:"forward_to,attr"`
+	Output     *testOutput          `river:"output,block"`
+	Unrelated  string               `river:"unrelated,attr"`
+	unexported storage.Appendable
+}
+
+type testOutput struct {
+	Logs []loki.LogsReceiver `river:"logs,attr"`
+}
+
+func TestHub_WrapArguments(t *testing.T) {
+	hub := NewHub()
+	defer hub.Close()
+
+	var (
+		next   = &fakeAppendable{}
+		output = &testOutput{Logs: []loki.LogsReceiver{loki.NewLogsReceiver()}}
+		in     = testArguments{
+			ForwardTo: []storage.Appendable{next},
+			Output:    output,
+			Unrelated: "value",
+		}
+	)
+
+	out := hub.WrapArguments(in).(testArguments)
+	require.IsType(t, &sendAppendable{}, out.ForwardTo[0])
+	require.IsType(t, &sendLogsReceiver{}, out.Output.Logs[0])
+	require.Equal(t, "value", out.Unrelated)
+
+	// The original arguments must not be modified.
+	require.Same(t, next, in.ForwardTo[0])
+	require.Same(t, output, in.Output)
+	require.IsType(t, loki.NewLogsReceiver(), output.Logs[0])
+
+	// Wrapping the same receivers again must produce equal arguments so that
+	// unchanged components aren't updated.
+	again := hub.WrapArguments(in).(testArguments)
+	require.True(t, reflect.DeepEqual(out, again))
+
+	app := out.ForwardTo[0].Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings("foo", "bar"), 1000, 42)
+	require.NoError(t, err)
+	require.Equal(t, 1, next.samples)
+	require.Equal(t, uint64(1), hub.Sent())
+
+	// Log entries are sent directly to the original channel.
+	require.Equal(t, output.Logs[0].Chan(), out.Output.Logs[0].Chan())
+	require.Equal(t, uint64(2), hub.Sent())
+}
+
+func TestHub_Counts(t *testing.T) {
+	var (
+		sender   = NewHub()
+		receiver = NewHub()
+	)
+	defer sender.Close()
+	defer receiver.Close()
+
+	var (
+		nextLogs    = loki.NewLogsReceiver()
+		nextSamples = &fakeAppendable{}
+		exports     = receiver.WrapExports(testExports{Receiver: nextSamples, LogsInput: nextLogs}).(testExports)
+		args        = sender.WrapArguments(testArguments{
+			ForwardTo: []storage.Appendable{exports.Receiver},
+			Output:    &testOutput{Logs: []loki.LogsReceiver{exports.LogsInput}},
+		}).(testArguments)
+	)
+
+	app := args.ForwardTo[0].Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings("foo", "bar"), 1000, 42)
+	require.NoError(t, err)
+	require.Equal(t, 1, nextSamples.samples)
+
+	// Log entries sent to the exports of another hub are delivered to the
+	// original receiver and counted by both hubs.
+	go func() { args.Output.Logs[0].Chan() <- loki.Entry{} }()
+	select {
+	case <-nextLogs.Chan():
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "entry was not forwarded")
+	}
+
+	require.Equal(t, uint64(2), sender.Sent())
+	require.Eventually(t, func() bool {
+		return receiver.Received() == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+type fakeAppendable struct {
+	samples int
+}
+
+func (a *fakeAppendable) Appender(context.Context) storage.Appender {
+	return &fakeAppender{parent: a}
+}
+
+type fakeAppender struct {
+	storage.Appender
+	parent *fakeAppendable
+}
+
+func (a *fakeAppender) Append(storage.SeriesRef, labels.Labels, int64, float64) (storage.SeriesRef, error) {
+	a.parent.samples++
+	return 0, nil
+}
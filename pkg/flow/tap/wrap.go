@@ -0,0 +1,419 @@
+package tap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/component/common/loki"
+	"github.com/grafana/agent/component/otelcol"
+	"github.com/grafana/agent/component/pyroscope"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	otelconsumer "go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/atomic"
+)
+
+var (
+	appendableType   = reflect.TypeOf((*storage.Appendable)(nil)).Elem()
+	logsReceiverType = reflect.TypeOf((*loki.LogsReceiver)(nil)).Elem()
+	consumerType     = reflect.TypeOf((*otelcol.Consumer)(nil)).Elem()
+	pyroscopeType    = reflect.TypeOf((*pyroscope.Appendable)(nil)).Elem()
+)
+
+// WrapExports returns a copy of e where every top-level field holding a
+// storage.Appendable, loki.LogsReceiver, otelcol.Consumer, or
+// pyroscope.Appendable is replaced with a wrapper which publishes events to
+// h. Other fields are left unmodified.
+//
+// Wrappers are cached for each original receiver, so calling WrapExports
+// repeatedly with the same receivers returns exports which are deeply equal.
+func (h *Hub) WrapExports(e component.Exports) component.Exports {
+	if e == nil {
+		return nil
+	}
+
+	in := reflect.ValueOf(e)
+	if in.Kind() != reflect.Struct {
+		return e
+	}
+
+	h.wrapMut.Lock()
+	defer h.wrapMut.Unlock()
+
+	var (
+		out     = reflect.New(in.Type()).Elem()
+		wrapped = make(map[any]any, len(h.wrapped))
+	)
+	out.Set(in)
+
+	for i := 0; i < out.NumField(); i++ {
+		var (
+			field = out.Type().Field(i)
+			value = out.Field(i)
+		)
+		if !field.IsExported() || value.Kind() != reflect.Interface || value.IsNil() {
+			continue
+		}
+
+		inner := value.Interface()
+		if !reflect.TypeOf(inner).Comparable() {
+			// Wrappers can't be cached for receivers which can't be used as map
+			// keys; leave them untapped to keep exports stable.
+			continue
+		}
+
+		wrapper, ok := h.wrapped[inner]
+		if !ok {
+			wrapper = h.newWrapper(riverName(field), field.Type, inner)
+		}
+		if wrapper == nil {
+			continue
+		}
+
+		wrapped[inner] = wrapper
+		value.Set(reflect.ValueOf(wrapper))
+	}
+
+	retireUnused(h.wrapped, wrapped)
+	h.wrapped = wrapped
+	return out.Interface()
+}
+
+func (h *Hub) newWrapper(name string, typ reflect.Type, inner any) any {
+	switch typ {
+	case appendableType:
+		return &tapAppendable{hub: h, name: name, next: inner.(storage.Appendable)}
+	case logsReceiverType:
+		return newTapLogsReceiver(h, name, inner.(loki.LogsReceiver))
+	case consumerType:
+		return &tapConsumer{hub: h, name: name, next: inner.(otelcol.Consumer)}
+	case pyroscopeType:
+		return &tapPyroscopeAppendable{hub: h, name: name, next: inner.(pyroscope.Appendable)}
+	default:
+		return nil
+	}
+}
+
+// riverName returns the River name of a struct field from its river tag.
+func riverName(field reflect.StructField) string {
+	tag, ok := field.Tag.Lookup("river")
+	if !ok {
+		return field.Name
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+// tapAppendable wraps a storage.Appendable.
+type tapAppendable struct {
+	hub  *Hub
+	name string
+	next storage.Appendable
+}
+
+var _ storage.Appendable = (*tapAppendable)(nil)
+
+// Appender implements storage.Appendable.
+func (a *tapAppendable) Appender(ctx context.Context) storage.Appender {
+	return &tapAppender{Appender: a.next.Appender(ctx), parent: a}
+}
+
+type tapAppender struct {
+	storage.Appender
+	parent *tapAppendable
+}
+
+func (a *tapAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	hub := a.parent.hub
+	hub.received.Inc()
+	if hub.Active() {
+		hub.publish(func() Event {
+			return Event{
+				Receiver:  a.parent.name,
+				Kind:      KindSample,
+				Labels:    l.String(),
+				Timestamp: time.UnixMilli(t),
+				Data:      strconv.FormatFloat(v, 'g', -1, 64),
+			}
+		})
+	}
+	return a.Appender.Append(ref, l, t, v)
+}
+
+func (a *tapAppender) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
+	if hub := a.parent.hub; hub.Active() {
+		hub.publish(func() Event {
+			return Event{
+				Receiver:  a.parent.name,
+				Kind:      KindExemplar,
+				Labels:    l.String(),
+				Timestamp: time.UnixMilli(e.Ts),
+				Data:      fmt.Sprintf("%s %s", e.Labels.String(), strconv.FormatFloat(e.Value, 'g', -1, 64)),
+			}
+		})
+	}
+	return a.Appender.AppendExemplar(ref, l, e)
+}
+
+func (a *tapAppender) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram, fh *histogram.FloatHistogram) (storage.SeriesRef, error) {
+	hub := a.parent.hub
+	hub.received.Inc()
+	if hub.Active() {
+		hub.publish(func() Event {
+			var data string
+			if h != nil {
+				data = h.String()
+			} else if fh != nil {
+				data = fh.String()
+			}
+			return Event{
+				Receiver:  a.parent.name,
+				Kind:      KindHistogram,
+				Labels:    l.String(),
+				Timestamp: time.UnixMilli(t),
+				Data:      data,
+			}
+		})
+	}
+	return a.Appender.AppendHistogram(ref, l, t, h, fh)
+}
+
+// tapLogsReceiver wraps a loki.LogsReceiver. Senders call Chan for every
+// entry they send, so the wrapper hands out the original channel while the
+// Hub is inactive, and an intermediate channel which forwards to the original
+// one while the Hub is active.
+//
+// Entries sent to the original channel are counted when it's handed out, and
+// entries sent to the intermediate channel when they're forwarded.
+type tapLogsReceiver struct {
+	hub  *Hub
+	name string
+	next loki.LogsReceiver
+
+	once     sync.Once
+	tapped   chan loki.Entry
+	lastUsed atomic.Int64 // Unix time in nanoseconds tapped was last handed out.
+
+	// mut guards handing out tapped against retiring the wrapper, so that
+	// tapped isn't handed out once forwarding is about to stop.
+	mut     sync.RWMutex
+	retired chan struct{} // Closed once the wrapper is no longer exported.
+}
+
+var (
+	_ loki.LogsReceiver = (*tapLogsReceiver)(nil)
+	_ retirer           = (*tapLogsReceiver)(nil)
+)
+
+func newTapLogsReceiver(h *Hub, name string, next loki.LogsReceiver) *tapLogsReceiver {
+	return &tapLogsReceiver{
+		hub:     h,
+		name:    name,
+		next:    next,
+		retired: make(chan struct{}),
+	}
+}
+
+// Chan implements loki.LogsReceiver.
+func (r *tapLogsReceiver) Chan() chan loki.Entry {
+	if !r.hub.Active() {
+		r.hub.received.Inc()
+		return r.next.Chan()
+	}
+
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	if isClosed(r.retired) {
+		r.hub.received.Inc()
+		return r.next.Chan()
+	}
+
+	r.once.Do(func() {
+		r.tapped = make(chan loki.Entry)
+		go forwardLogs(r.tapped, r.retired, &r.lastUsed, retiredIdleTimeout, r.deliver)
+	})
+	r.lastUsed.Store(time.Now().UnixNano())
+	return r.tapped
+}
+
+// retire stops forwarding entries from the intermediate channel once the
+// wrapper is no longer exported and the senders which retrieved it had time
+// to send their entry.
+func (r *tapLogsReceiver) retire() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if !isClosed(r.retired) {
+		close(r.retired)
+	}
+}
+
+// deliver counts and publishes entry, then sends it to the original
+// receiver.
+func (r *tapLogsReceiver) deliver(entry loki.Entry) {
+	r.hub.received.Inc()
+	if r.hub.Active() {
+		r.hub.publish(func() Event {
+			return Event{
+				Receiver:  r.name,
+				Kind:      KindLog,
+				Labels:    entry.Labels.String(),
+				Timestamp: entry.Timestamp,
+				Data:      entry.Line,
+			}
+		})
+	}
+	r.next.Chan() <- entry
+}
+
+// retiredIdleTimeout is how long the intermediate channel of a retired
+// tapLogsReceiver keeps being served after it was last handed out.
+const retiredIdleTimeout = 5 * time.Second
+
+// forwardLogs delivers the entries sent to ch until retired is closed.
+//
+// Senders may retrieve ch without sending to it, such as when they select on
+// a canceled context, so they can't be waited for. Instead, once retired is
+// closed, forwardLogs keeps receiving until ch wasn't handed out for
+// idleTimeout, as reported by lastUsed: a sender which retrieved ch before it
+// was retired doesn't block forever. Entries are never dropped once received
+// from ch.
+func forwardLogs(ch chan loki.Entry, retired <-chan struct{}, lastUsed *atomic.Int64, idleTimeout time.Duration, deliver func(loki.Entry)) {
+	for {
+		select {
+		case entry := <-ch:
+			deliver(entry)
+		case <-retired:
+			drainLogs(ch, lastUsed, idleTimeout, deliver)
+			return
+		}
+	}
+}
+
+// drainLogs delivers the entries sent to ch until it wasn't handed out for
+// idleTimeout.
+func drainLogs(ch chan loki.Entry, lastUsed *atomic.Int64, idleTimeout time.Duration, deliver func(loki.Entry)) {
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case entry := <-ch:
+			deliver(entry)
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, lastUsed.Load()))
+			if idle >= idleTimeout {
+				return
+			}
+			timer.Reset(idleTimeout - idle)
+		}
+	}
+}
+
+// tapConsumer wraps an otelcol.Consumer.
+type tapConsumer struct {
+	hub  *Hub
+	name string
+	next otelcol.Consumer
+}
+
+var _ otelcol.Consumer = (*tapConsumer)(nil)
+
+// Capabilities implements otelcol.Consumer.
+func (c *tapConsumer) Capabilities() otelconsumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+// ConsumeTraces implements otelcol.Consumer.
+func (c *tapConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	c.hub.received.Add(uint64(td.SpanCount()))
+	if c.hub.Active() {
+		c.hub.publish(func() Event {
+			return Event{
+				Receiver: c.name,
+				Kind:     KindTraces,
+				Data:     fmt.Sprintf("%d spans in %d resources", td.SpanCount(), td.ResourceSpans().Len()),
+			}
+		})
+	}
+	return c.next.ConsumeTraces(ctx, td)
+}
+
+// ConsumeMetrics implements otelcol.Consumer.
+func (c *tapConsumer) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	c.hub.received.Add(uint64(md.DataPointCount()))
+	if c.hub.Active() {
+		c.hub.publish(func() Event {
+			return Event{
+				Receiver: c.name,
+				Kind:     KindMetrics,
+				Data:     fmt.Sprintf("%d data points in %d metrics", md.DataPointCount(), md.MetricCount()),
+			}
+		})
+	}
+	return c.next.ConsumeMetrics(ctx, md)
+}
+
+// ConsumeLogs implements otelcol.Consumer.
+func (c *tapConsumer) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	c.hub.received.Add(uint64(ld.LogRecordCount()))
+	if c.hub.Active() {
+		c.hub.publish(func() Event {
+			return Event{
+				Receiver: c.name,
+				Kind:     KindLogs,
+				Data:     fmt.Sprintf("%d log records in %d resources", ld.LogRecordCount(), ld.ResourceLogs().Len()),
+			}
+		})
+	}
+	return c.next.ConsumeLogs(ctx, ld)
+}
+
+// tapPyroscopeAppendable wraps a pyroscope.Appendable.
+type tapPyroscopeAppendable struct {
+	hub  *Hub
+	name string
+	next pyroscope.Appendable
+}
+
+var _ pyroscope.Appendable = (*tapPyroscopeAppendable)(nil)
+
+// Appender implements pyroscope.Appendable.
+func (a *tapPyroscopeAppendable) Appender() pyroscope.Appender {
+	return &tapPyroscopeAppender{next: a.next.Appender(), parent: a}
+}
+
+type tapPyroscopeAppender struct {
+	next   pyroscope.Appender
+	parent *tapPyroscopeAppendable
+}
+
+func (a *tapPyroscopeAppender) Append(ctx context.Context, l labels.Labels, samples []*pyroscope.RawSample) error {
+	hub := a.parent.hub
+	hub.received.Add(uint64(len(samples)))
+	if hub.Active() {
+		hub.publish(func() Event {
+			var size int
+			for _, s := range samples {
+				size += len(s.RawProfile)
+			}
+			return Event{
+				Receiver: a.parent.name,
+				Kind:     KindProfile,
+				Labels:   l.String(),
+				Data:     fmt.Sprintf("%d profiles, %d bytes", len(samples), size),
+			}
+		})
+	}
+	return a.next.Append(ctx, l, samples)
+}
@@ -0,0 +1,127 @@
+package flow
+
+import (
+	"sort"
+
+	"github.com/grafana/agent/pkg/flow/internal/controller"
+	"github.com/grafana/agent/pkg/flow/internal/worker"
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/river/diag"
+)
+
+// ValidateOptions holds options for Validate.
+type ValidateOptions struct {
+	// Logger to use for controller logs.
+	Logger *logging.Logger
+
+	// Directory where import blocks can store retrieved content.
+	DataPath string
+
+	// Services which components may depend on. Services are never updated or
+	// run by Validate.
+	Services []service.Service
+}
+
+// Validate checks source for errors without building or running any
+// component. Validate builds the component graph of source, reporting
+// unknown components, invalid references, reference cycles, and missing
+// services. The arguments of every component and service are decoded to
+// type-check them.
+//
+// Values exported by components aren't known during validation; references
+// to them evaluate to the zero value of their type, or to null for custom
+// components. The bodies of declare blocks are validated with unknown
+// argument values. Errors from evaluating attributes which reference
+// arguments or exports of custom components are reported as warnings.
+func Validate(source *Source, opts ValidateOptions) diag.Diagnostics {
+	f := newValidateController(opts, "", nil)
+	defer f.loader.Cleanup(true)
+
+	diags := f.loader.Apply(controller.ApplyOptions{
+		ComponentBlocks: source.components,
+		ConfigBlocks:    source.configBlocks,
+		DeclareBlocks:   source.declareBlocks,
+		ImportBlocks:    source.importBlocks,
+	})
+	return append(diags, validateDeclares(opts, f.loader.Declares(), nil)...)
+}
+
+// validateDeclares validates the bodies of declarations in declares which
+// aren't inherited from a parent scope.
+func validateDeclares(opts ValidateOptions, declares, inherited map[string]*controller.Declare) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	names := make([]string, 0, len(declares))
+	for name := range declares {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		d := declares[name]
+		if inherited[name] == d {
+			continue
+		}
+
+		body, err := sourceFromBody(d.Block.Body)
+		if err != nil {
+			diags = append(diags, diagsFromError(err)...)
+			continue
+		}
+
+		// Argument values of custom components are only known when they're
+		// instantiated, so every argument is given a placeholder value.
+		args := make(map[string]any)
+		for _, arg := range d.Arguments() {
+			args[arg] = nil
+		}
+
+		f := newValidateController(opts, d.Name, func(map[string]any) {})
+		diags = append(diags, f.loader.Apply(controller.ApplyOptions{
+			Args:            args,
+			ComponentBlocks: body.components,
+			ConfigBlocks:    body.configBlocks,
+			DeclareBlocks:   body.declareBlocks,
+			ImportBlocks:    body.importBlocks,
+			Declares:        d.Scope,
+			ArgsUnknown:     true,
+		})...)
+		diags = append(diags, validateDeclares(opts, f.loader.Declares(), d.Scope)...)
+		f.loader.Cleanup(true)
+	}
+	return diags
+}
+
+// newValidateController returns a controller which only validates sources.
+// Controllers for the bodies of declare blocks must set onExportsChange.
+func newValidateController(opts ValidateOptions, id string, onExportsChange func(map[string]any)) *Flow {
+	return newController(controllerOptions{
+		Options: Options{
+			ControllerID:    id,
+			Logger:          opts.Logger,
+			DataPath:        opts.DataPath,
+			OnExportsChange: onExportsChange,
+			Services:        opts.Services,
+		},
+		ModuleRegistry: newModuleRegistry(),
+		IsModule:       id != "",
+		ValidateOnly:   true,
+		WorkerPool:     worker.NewFixedWorkerPool(1, 1),
+	})
+}
+
+// diagsFromError converts err into diagnostics.
+func diagsFromError(err error) diag.Diagnostics {
+	switch err := err.(type) {
+	case diag.Diagnostics:
+		return err
+	case diag.Diagnostic:
+		return diag.Diagnostics{err}
+	default:
+		return diag.Diagnostics{{
+			Severity: diag.SeverityLevelError,
+			Message:  err.Error(),
+		}}
+	}
+}
@@ -0,0 +1,164 @@
+package flow
+
+import (
+	"os"
+	"testing"
+
+	"github.com/grafana/agent/pkg/flow/logging"
+	"github.com/grafana/river/diag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name        string
+		config      string
+		expectedErr string // Empty if the config is valid.
+	}{
+		{
+			name: "valid",
+			config: declareConfig + `
+			testcomponents.count "inc" {
+				frequency = "1h"
+				max       = 10
+			}
+
+			testcomponents.passthrough "a" {
+				input = format("count is %d", testcomponents.count.inc.count)
+			}
+
+			greeter "default" {
+				name = testcomponents.passthrough.a.output
+			}
+
+			testcomponents.passthrough "b" {
+				input = greeter.default.message
+			}`,
+		},
+		{
+			name: "unknown component",
+			config: `
+			testcomponents.passthru "a" {
+				input = "hello"
+			}`,
+			expectedErr: `Unrecognized component name "testcomponents.passthru"`,
+		},
+		{
+			name: "unknown argument",
+			config: `
+			testcomponents.passthrough "a" {
+				inptu = "hello"
+			}`,
+			expectedErr: `unrecognized attribute name "inptu"`,
+		},
+		{
+			name: "invalid argument type",
+			config: `
+			testcomponents.count "inc" {
+				frequency = "1h"
+				max       = "ten"
+			}`,
+			expectedErr: `"ten" should be number, got string`,
+		},
+		{
+			name: "unknown export",
+			config: `
+			testcomponents.passthrough "a" {
+				input = "hello"
+			}
+
+			testcomponents.passthrough "b" {
+				input = testcomponents.passthrough.a.outptu
+			}`,
+			expectedErr: `field "outptu" does not exist`,
+		},
+		{
+			name: "reference cycle",
+			config: `
+			testcomponents.passthrough "a" {
+				input = testcomponents.passthrough.b.output
+			}
+
+			testcomponents.passthrough "b" {
+				input = testcomponents.passthrough.a.output
+			}`,
+			expectedErr: `cycle`,
+		},
+		{
+			name: "invalid declare body",
+			config: `
+			declare "a" {
+				testcomponents.passthru "inner" {
+					input = "hello"
+				}
+			}`,
+			expectedErr: `Unrecognized component name "testcomponents.passthru"`,
+		},
+		{
+			name: "unknown argument in declare body",
+			config: `
+			declare "a" {
+				argument "in" {}
+
+				testcomponents.passthrough "inner" {
+					inptu = argument.in.value
+				}
+			}`,
+			expectedErr: `unrecognized attribute name "inptu"`,
+		},
+		{
+			name: "invalid argument type in declare body",
+			config: `
+			declare "a" {
+				argument "in" {}
+
+				testcomponents.count "inner" {
+					frequency = argument.in.value
+					max       = "ten"
+				}
+			}`,
+			expectedErr: `"ten" should be number, got string`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseSource(t.Name(), []byte(tc.config))
+			require.NoError(t, err)
+
+			diags := Validate(f, validateOptions(t))
+			if tc.expectedErr == "" {
+				require.False(t, diags.HasErrors(), "unexpected errors: %s", diags)
+				return
+			}
+			require.True(t, diags.HasErrors())
+			require.ErrorContains(t, diags, tc.expectedErr)
+		})
+	}
+}
+
+func TestValidate_DeclareWarnings(t *testing.T) {
+	// Arguments of declare bodies are unknown during validation, so errors
+	// caused by using them are only reported as warnings.
+	f, err := ParseSource(t.Name(), []byte(declareConfig))
+	require.NoError(t, err)
+
+	diags := Validate(f, validateOptions(t))
+	require.False(t, diags.HasErrors())
+	require.NotEmpty(t, diags)
+	for _, d := range diags {
+		require.Equal(t, diag.SeverityLevelWarn, d.Severity)
+	}
+}
+
+func validateOptions(t *testing.T) ValidateOptions {
+	t.Helper()
+
+	l, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	return ValidateOptions{
+		Logger:   l,
+		DataPath: t.TempDir(),
+	}
+}
@@ -473,9 +473,31 @@ func (*Storage) StartTime() (int64, error) {
 	return 0, nil
 }
 
+// NextSegment starts a new segment of the WAL, so that the previous segments
+// aren't written to anymore. It returns the last of the previous segments.
+func (w *Storage) NextSegment() (int, error) {
+	w.walMtx.RLock()
+	defer w.walMtx.RUnlock()
+
+	if w.walClosed {
+		return 0, ErrWALClosed
+	}
+	next, err := w.wal.NextSegment()
+	if err != nil {
+		return 0, fmt.Errorf("next segment: %w", err)
+	}
+	return next - 1, nil
+}
+
 // Truncate removes all data from the WAL prior to the timestamp specified by
 // mint.
 func (w *Storage) Truncate(mint int64) error {
+	return w.TruncateUntil(mint, math.MaxInt)
+}
+
+// TruncateUntil is like Truncate, but never deletes the segments after
+// lastSegment.
+func (w *Storage) TruncateUntil(mint int64, lastSegment int) error {
 	w.walMtx.RLock()
 	defer w.walMtx.RUnlock()
 
@@ -501,14 +523,13 @@ func (w *Storage) Truncate(mint int64) error {
 		return fmt.Errorf("next segment: %w", err)
 	}
 
-	last-- // Never consider last segment for checkpoint.
-	if last < 0 {
-		return nil // no segments yet.
+	last, ok := truncatedSegment(first, last)
+	if !ok {
+		return nil
+	}
+	if last > lastSegment {
+		last = lastSegment
 	}
-
-	// The lower two thirds of segments should contain mostly obsolete samples.
-	// If we have less than two segments, it's not worth checkpointing yet.
-	last = first + (last-first)*2/3
 	if last <= first {
 		return nil
 	}
@@ -553,6 +574,34 @@ func (w *Storage) Truncate(mint int64) error {
 	return nil
 }
 
+// TruncatedSegment returns the last segment deleted by the next call to
+// Truncate. It returns false if Truncate doesn't delete any segment.
+func (w *Storage) TruncatedSegment() (int, bool, error) {
+	first, last, err := wlog.Segments(w.wal.Dir())
+	if err != nil {
+		return 0, false, fmt.Errorf("get segment range: %w", err)
+	}
+	segment, ok := truncatedSegment(first, last)
+	return segment, ok, nil
+}
+
+// truncatedSegment returns the last segment to delete from a WAL with
+// segments first to last.
+func truncatedSegment(first, last int) (int, bool) {
+	last-- // Never consider last segment for checkpoint.
+	if last < 0 {
+		return 0, false // no segments yet.
+	}
+
+	// The lower two thirds of segments should contain mostly obsolete samples.
+	// If we have less than two segments, it's not worth checkpointing yet.
+	last = first + (last-first)*2/3
+	if last <= first {
+		return 0, false
+	}
+	return last, true
+}
+
 // gc removes data before the minimum timestamp from the head.
 func (w *Storage) gc(mint int64) {
 	deleted := w.series.gc(mint)
@@ -0,0 +1,478 @@
+package supportbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/build"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/printer"
+	"github.com/grafana/river/rivertypes"
+	"github.com/grafana/river/token"
+	"github.com/mackerelio/go-osstat/uptime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// FlowOptions holds the runtime state of Grafana Agent Flow used to build a
+// support bundle.
+type FlowOptions struct {
+	Components component.Provider  // Used to collect components, including nested modules.
+	Gatherer   prometheus.Gatherer // Where to collect metrics from.
+	Sources    map[string][]byte   // Currently loaded River source files by name.
+	Peers      []peer.Peer         // Cluster peers. May be empty when clustering is disabled.
+	Logs       []byte              // Recent log lines.
+}
+
+// FlowBundle collects all the data that is exposed as a Flow support bundle.
+type FlowBundle struct {
+	meta       []byte
+	components []byte
+	peers      []byte
+	metrics    []byte
+	logs       []byte
+	sources    map[string][]byte
+	profiles   *profiles
+}
+
+// redactedValue replaces secrets in the River sources included in a support
+// bundle.
+const redactedValue = `"(redacted)"`
+
+// ExportFlow gathers the information required for a Flow support bundle. The
+// CPU profile is collected until shortly before the deadline of ctx.
+func ExportFlow(ctx context.Context, opts FlowOptions) (*FlowBundle, error) {
+	mut.Lock()
+	defer mut.Unlock()
+	// The block profiler is disabled by default. Temporarily enable recording
+	// of all blocking events. Also, temporarily record all mutex contentions,
+	// and defer restoring of earlier mutex profiling fraction.
+	runtime.SetBlockProfileRate(1)
+	old := runtime.SetMutexProfileFraction(1)
+	defer func() {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(old)
+	}()
+
+	infos := component.GetAllComponents(opts.Components, component.InfoOptions{
+		GetHealth:    true,
+		GetArguments: true,
+		GetExports:   true,
+		GetDebugInfo: true,
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID.String() < infos[j].ID.String()
+	})
+
+	// Gather runtime metadata.
+	ut, err := uptime.Get()
+	if err != nil {
+		return nil, err
+	}
+	componentNames := map[string]struct{}{}
+	for _, info := range infos {
+		componentNames[info.Registration.Name] = struct{}{}
+	}
+	m := Metadata{
+		BuildVersion: build.Version,
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+		Uptime:       ut.Seconds(),
+		Payload:      map[string]interface{}{"enabled-components": sortedKeys(componentNames)},
+	}
+	meta, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal support bundle metadata: %s", err)
+	}
+
+	components, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal components: %s", err)
+	}
+
+	peers := opts.Peers
+	if peers == nil {
+		peers = []peer.Peer{}
+	}
+	peersJSON, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cluster peers: %s", err)
+	}
+
+	var metrics []byte
+	if opts.Gatherer != nil {
+		metrics, err = gatherMetrics(opts.Gatherer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to gather internal Agent metrics: %s", err)
+		}
+	}
+
+	sources := make(map[string][]byte, len(opts.Sources))
+	for name, content := range opts.Sources {
+		sources[name] = RedactSource(name, content)
+	}
+
+	profiles, err := exportProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlowBundle{
+		meta:       meta,
+		components: components,
+		peers:      peersJSON,
+		metrics:    metrics,
+		logs:       opts.Logs,
+		sources:    sources,
+		profiles:   profiles,
+	}, nil
+}
+
+// ServeFlow serves the collected Flow support bundle as a zip file over the
+// given http.ResponseWriter.
+func ServeFlow(rw http.ResponseWriter, b *FlowBundle) error {
+	zw := zip.NewWriter(rw)
+	rw.Header().Set("Content-Type", "application/zip")
+	rw.Header().Set("Content-Disposition", "attachment; filename=\"agent-support-bundle.zip\"")
+
+	zipStructure := map[string][]byte{
+		"agent-metadata.yaml":   b.meta,
+		"agent-components.json": b.components,
+		"agent-peers.json":      b.peers,
+		"agent-metrics.txt":     b.metrics,
+		"agent-logs.txt":        b.logs,
+		"pprof/cpu.pprof":       b.profiles.cpuBuf.Bytes(),
+		"pprof/heap.pprof":      b.profiles.heapBuf.Bytes(),
+		"pprof/goroutine.pprof": b.profiles.goroutineBuf.Bytes(),
+		"pprof/mutex.pprof":     b.profiles.mutexBuf.Bytes(),
+		"pprof/block.pprof":     b.profiles.blockBuf.Bytes(),
+	}
+	for name, content := range b.sources {
+		zipStructure["sources/"+sanitizeSourceName(name)] = content
+	}
+
+	for fn, b := range zipStructure {
+		if b != nil {
+			path := append([]string{"agent-support-bundle"}, strings.Split(fn, "/")...)
+			if err := writeByteSlice(zw, b, path...); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to flush the zip writer: %v", err)
+	}
+	return nil
+}
+
+// RedactSource returns a copy of the River source bb where secrets are
+// replaced with a placeholder. If bb can't be parsed, RedactSource returns a
+// placeholder comment instead of the raw content.
+//
+// The arguments of components are redacted based on their schema: the values
+// of attributes holding a rivertypes.Secret or rivertypes.OptionalSecret are
+// replaced. Maps of plain strings, like HTTP headers, and blocks without a
+// known schema, like the arguments of custom components, have no schema
+// telling which values are secrets, so the values of their attributes and
+// keys whose name is likely to hold a secret, such as password or token, are
+// replaced instead.
+func RedactSource(name string, bb []byte) []byte {
+	file, err := parser.ParseFile(name, bb)
+	if err != nil {
+		return []byte(fmt.Sprintf("// source omitted from support bundle: %s\n", err))
+	}
+
+	redactBody(file.Body)
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, file); err != nil {
+		return []byte(fmt.Sprintf("// source omitted from support bundle: %s\n", err))
+	}
+	_, _ = buf.Write([]byte{'\n'})
+	return buf.Bytes()
+}
+
+// redactBody redacts the statements of body, which holds components, like a
+// file or a declare block.
+func redactBody(body ast.Body) {
+	for _, stmt := range body {
+		block, ok := stmt.(*ast.BlockStmt)
+		if !ok {
+			ast.Walk(redactVisitor{}, stmt)
+			continue
+		}
+
+		name := strings.Join(block.Name, ".")
+		if reg, ok := component.Get(name); ok && reg.Args != nil {
+			redactBlock(block.Body, reflect.TypeOf(reg.Args))
+		} else if name == "declare" {
+			redactBody(block.Body)
+		} else {
+			ast.Walk(redactVisitor{}, block)
+		}
+	}
+}
+
+// redactBlock redacts the secrets of the body of a block decoded into t.
+func redactBlock(body ast.Body, t reflect.Type) {
+	fields := riverFields(t)
+	for _, stmt := range body {
+		switch stmt := stmt.(type) {
+		case *ast.AttributeStmt:
+			if f, ok := fields[stmt.Name.Name]; ok && !f.block {
+				redactValue(stmt.Value, f.typ)
+			} else if !ok {
+				ast.Walk(redactVisitor{}, stmt)
+			}
+		case *ast.BlockStmt:
+			f, ok := fields[strings.Join(stmt.Name, ".")]
+			if bt := blockType(f.typ); ok && f.block && bt != nil {
+				redactBlock(stmt.Body, bt)
+			} else {
+				ast.Walk(redactVisitor{}, stmt)
+			}
+		}
+	}
+}
+
+// redactValue redacts the secrets of the value of an attribute of type t.
+func redactValue(expr ast.Expr, t reflect.Type) {
+	t = indirect(t)
+	if !hasSecret(t, make(map[reflect.Type]bool)) {
+		// The keys of maps have no schema.
+		if obj, ok := expr.(*ast.ObjectExpr); ok && t.Kind() == reflect.Map {
+			for _, field := range obj.Fields {
+				if isSecretName(strings.Trim(field.Name.Name, `"`)) {
+					redactLiterals(field.Value)
+				}
+			}
+		}
+		return
+	}
+
+	switch expr := expr.(type) {
+	case *ast.ObjectExpr:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := riverFields(t)
+			for _, field := range expr.Fields {
+				if f, ok := fields[strings.Trim(field.Name.Name, `"`)]; ok {
+					redactValue(field.Value, f.typ)
+				}
+			}
+			return
+		case reflect.Map:
+			for _, field := range expr.Fields {
+				redactValue(field.Value, t.Elem())
+			}
+			return
+		}
+	case *ast.ArrayExpr:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, elem := range expr.Elements {
+				redactValue(elem, t.Elem())
+			}
+			return
+		}
+	}
+	redactLiterals(expr)
+}
+
+var (
+	secretType         = reflect.TypeOf(rivertypes.Secret(""))
+	optionalSecretType = reflect.TypeOf(rivertypes.OptionalSecret{})
+)
+
+// hasSecret reports whether values of type t can hold a secret. seen holds
+// the types already visited, for recursive types.
+func hasSecret(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t == secretType || t == optionalSecretType {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasSecret(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && hasSecret(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// riverField is an attribute or a block of a River schema.
+type riverField struct {
+	typ   reflect.Type
+	block bool
+}
+
+// riverFields returns the attributes and blocks of the struct type t by
+// name, including the ones of squashed structs and of enums of blocks.
+func riverFields(t reflect.Type) map[string]riverField {
+	fields := make(map[string]riverField)
+	t = indirect(t)
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("river")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		switch {
+		case strings.Contains(flags, "squash"):
+			for name, f := range riverFields(field.Type) {
+				fields[name] = f
+			}
+		case strings.Contains(flags, "enum"):
+			if bt := blockType(field.Type); bt != nil {
+				for name, f := range riverFields(bt) {
+					fields[name] = f
+				}
+			}
+		case strings.Contains(flags, "attr"):
+			fields[name] = riverField{typ: field.Type}
+		case strings.Contains(flags, "block"):
+			fields[name] = riverField{typ: field.Type, block: true}
+		}
+	}
+	return fields
+}
+
+// blockType returns the struct type of the body of the blocks decoded into
+// t, or nil if t isn't a struct, or a pointer or slice of structs.
+func blockType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	t = indirect(t)
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = indirect(t.Elem())
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// indirect returns the type pointed to by t, if t is a pointer.
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// redactVisitor redacts the values of attributes and object keys which are
+// likely to hold secrets, for blocks without a known schema.
+type redactVisitor struct{}
+
+func (v redactVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.AttributeStmt:
+		if isSecretName(node.Name.Name) {
+			redactLiterals(node.Value)
+			return nil
+		}
+	case *ast.ObjectExpr:
+		for _, field := range node.Fields {
+			if isSecretName(strings.Trim(field.Name.Name, `"`)) {
+				redactLiterals(field.Value)
+			}
+		}
+	}
+	return v
+}
+
+// redactLiterals replaces all string literals within expr. Arguments to
+// function calls are kept, since they usually refer to where a secret is
+// loaded from, like env("TOKEN"), rather than the secret itself.
+func redactLiterals(expr ast.Expr) {
+	ast.Walk(literalVisitor{}, expr)
+}
+
+type literalVisitor struct{}
+
+func (v literalVisitor) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.CallExpr:
+		return nil
+	case *ast.LiteralExpr:
+		if node.Kind == token.STRING {
+			node.Value = redactedValue
+		}
+	}
+	return v
+}
+
+// isSecretName reports whether an attribute or object key named name is
+// likely to hold a secret. Names referring to files on disk are not
+// considered secrets.
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	if strings.HasSuffix(name, "_file") || strings.HasSuffix(name, "_path") {
+		return false
+	}
+
+	for _, s := range []string{"password", "passwd", "secret", "token", "key", "credential", "authorization"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeSourceName converts the name of a source file into a file name
+// which can be placed in the bundle.
+func sanitizeSourceName(name string) string {
+	name = strings.TrimLeft(name, "/")
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(name)
+}
+
+func gatherMetrics(g prometheus.Gatherer) ([]byte, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
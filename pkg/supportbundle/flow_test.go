@@ -0,0 +1,84 @@
+package supportbundle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/grafana/agent/component/loki/write"
+	_ "github.com/grafana/agent/component/otelcol/auth/headers"
+	_ "github.com/grafana/agent/component/prometheus/remotewrite"
+)
+
+func TestRedactSource(t *testing.T) {
+	input := `
+prometheus.remote_write "default" {
+  endpoint {
+    url = "https://example.com/api/prom/push"
+    headers = {
+      "Authorization" = "Bearer abc",
+      "X-Scope-OrgID" = "tenant",
+    }
+
+    basic_auth {
+      username = "user"
+      password = "hunter2"
+    }
+
+    tls_config {
+      key_file = "/etc/tls/client.key"
+    }
+  }
+}
+
+otelcol.auth.headers "default" {
+  header {
+    key   = "X-Api-Key"
+    value = "secret"
+  }
+}
+
+loki.write "default" {
+  endpoint {
+    url          = "https://example.com/loki/api/v1/push"
+    bearer_token = env("TOKEN")
+  }
+}
+`
+
+	expect := `prometheus.remote_write "default" {
+	endpoint {
+		url     = "https://example.com/api/prom/push"
+		headers = {
+			"Authorization" = "(redacted)",
+			"X-Scope-OrgID" = "tenant",
+		}
+
+		basic_auth {
+			username = "user"
+			password = "(redacted)"
+		}
+
+		tls_config {
+			key_file = "/etc/tls/client.key"
+		}
+	}
+}
+
+otelcol.auth.headers "default" {
+	header {
+		key   = "X-Api-Key"
+		value = "(redacted)"
+	}
+}
+
+loki.write "default" {
+	endpoint {
+		url          = "https://example.com/loki/api/v1/push"
+		bearer_token = env("TOKEN")
+	}
+}
+`
+
+	require.Equal(t, expect, string(RedactSource("config.river", []byte(input))))
+}
@@ -129,6 +129,44 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 	}
 
 	// Export pprof data.
+	profiles, err := exportProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finally, bundle everything up to be served, either as a zip from
+	// memory, or exported to a directory.
+	bundle := &Bundle{
+		meta:                  meta,
+		config:                cfg,
+		agentMetrics:          agentMetrics,
+		agentMetricsInstances: agentMetricsInstances,
+		agentMetricsTargets:   agentMetricsTargets,
+		agentLogsInstances:    agentLogsInstances,
+		agentLogsTargets:      agentLogsTargets,
+		heapBuf:               profiles.heapBuf,
+		goroutineBuf:          profiles.goroutineBuf,
+		blockBuf:              profiles.blockBuf,
+		mutexBuf:              profiles.mutexBuf,
+		cpuBuf:                profiles.cpuBuf,
+	}
+
+	return bundle, nil
+}
+
+// profiles holds pprof data collected for a support bundle.
+type profiles struct {
+	heapBuf      *bytes.Buffer
+	goroutineBuf *bytes.Buffer
+	blockBuf     *bytes.Buffer
+	mutexBuf     *bytes.Buffer
+	cpuBuf       *bytes.Buffer
+}
+
+// exportProfiles collects a CPU profile for the remaining duration of ctx,
+// followed by heap, goroutine, block and mutex profiles. Callers should
+// temporarily enable block and mutex profiling beforehand.
+func exportProfiles(ctx context.Context) (*profiles, error) {
 	var (
 		cpuBuf       bytes.Buffer
 		heapBuf      bytes.Buffer
@@ -136,7 +174,7 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		blockBuf     bytes.Buffer
 		mutexBuf     bytes.Buffer
 	)
-	err = pprof.StartCPUProfile(&cpuBuf)
+	err := pprof.StartCPUProfile(&cpuBuf)
 	if err != nil {
 		return nil, err
 	}
@@ -163,24 +201,13 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		return nil, err
 	}
 
-	// Finally, bundle everything up to be served, either as a zip from
-	// memory, or exported to a directory.
-	bundle := &Bundle{
-		meta:                  meta,
-		config:                cfg,
-		agentMetrics:          agentMetrics,
-		agentMetricsInstances: agentMetricsInstances,
-		agentMetricsTargets:   agentMetricsTargets,
-		agentLogsInstances:    agentLogsInstances,
-		agentLogsTargets:      agentLogsTargets,
-		heapBuf:               &heapBuf,
-		goroutineBuf:          &goroutineBuf,
-		blockBuf:              &blockBuf,
-		mutexBuf:              &mutexBuf,
-		cpuBuf:                &cpuBuf,
-	}
-
-	return bundle, nil
+	return &profiles{
+		heapBuf:      &heapBuf,
+		goroutineBuf: &goroutineBuf,
+		blockBuf:     &blockBuf,
+		mutexBuf:     &mutexBuf,
+		cpuBuf:       &cpuBuf,
+	}, nil
 }
 
 // Serve the collected data and logs as a zip file over the given
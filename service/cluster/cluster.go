@@ -76,12 +76,14 @@ type Service struct {
 
 	sharder shard.Sharder
 	node    *ckit.Node
+	client  *http.Client
 	randGen *rand.Rand
 }
 
 var (
-	_ service.Service             = (*Service)(nil)
-	_ http_service.ServiceHandler = (*Service)(nil)
+	_ service.Service                   = (*Service)(nil)
+	_ http_service.ServiceHandler       = (*Service)(nil)
+	_ http_service.RoutesServiceHandler = (*Service)(nil)
 )
 
 // New returns a new, unstarted instance of the cluster service.
@@ -141,6 +143,7 @@ func New(opts Options) (*Service, error) {
 
 		sharder: ckitConfig.Sharder,
 		node:    node,
+		client:  httpClient,
 		randGen: rand.New(rand.NewSource(time.Now().UnixNano())),
 	}, nil
 }
@@ -164,18 +167,53 @@ func (s *Service) Definition() service.Definition {
 	}
 }
 
-// ServiceHandler returns the service handler for the clustering service. The
-// resulting handler always returns 404 when clustering is disabled.
+// ServiceHandler returns the service handler for the clustering service. It
+// serves the transport of the cluster node. The resulting handler always
+// returns 404 when clustering is disabled.
+//
+// The http service registers the routes returned by ServiceRoutes instead,
+// which include the other routes used by peers.
 func (s *Service) ServiceHandler(host service.Host) (base string, handler http.Handler) {
 	base, handler = s.node.Handler()
+	return base, s.peerHandler(handler)
+}
+
+// ServiceRoutes implements [http_service.RoutesServiceHandler]. It returns
+// the routes used by peers: the transport of the cluster node, and the
+// handoff and probe routes. Cluster peers communicate over the HTTP server
+// without presenting credentials, so these routes never require
+// authentication. They always return 404 when clustering is disabled.
+func (s *Service) ServiceRoutes(host service.Host) []http_service.ServiceRoute {
+	nodeBase, nodeHandler := s.node.Handler()
+
+	return []http_service.ServiceRoute{
+		{Base: nodeBase, Handler: s.peerHandler(nodeHandler), Role: http_service.RoleNone},
+		{Base: handoffPath, Handler: s.peerHandler(exactPath(handoffPath, handoffHandler(host))), Role: http_service.RoleNone},
+		{Base: probePath, Handler: s.peerHandler(exactPath(probePath, probeHandler(host))), Role: http_service.RoleNone},
+	}
+}
 
+// peerHandler returns next, or a handler returning 404 if clustering is
+// disabled.
+func (s *Service) peerHandler(next http.Handler) http.Handler {
 	if !s.opts.EnableClustering {
-		handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 			http.Error(w, "clustering is disabled", http.StatusNotFound)
 		})
 	}
+	return next
+}
 
-	return base, handler
+// exactPath returns a handler serving next for requests to path only. Routes
+// of services match path prefixes.
+func exactPath(path string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // ChangeState changes the state of the service. If clustering is enabled,
@@ -340,7 +378,7 @@ func (s *Service) Update(newConfig any) error {
 
 // Data returns an instance of [Cluster].
 func (s *Service) Data() any {
-	return &sharderCluster{sharder: s.sharder}
+	return &sharderCluster{sharder: s.sharder, client: s.client}
 }
 
 // Component is a Flow component which subscribes to clustering updates.
@@ -360,6 +398,32 @@ type Component interface {
 // "clustering".
 type ComponentBlock struct {
 	Enabled bool `river:"enabled,attr"`
+
+	// ReplicationFactor is the number of peers owning each key. Zero is
+	// treated as one.
+	ReplicationFactor int `river:"replication_factor,attr,optional"`
+	// Weights changes the share of keys owned by peers, by peer name. Peers
+	// missing from Weights have a weight of 1.
+	Weights map[string]float64 `river:"weights,attr,optional"`
+	// HandoffWindow is how long a previous owner of a key keeps handling it
+	// until a new owner reports being ready. Zero disables handoffs.
+	HandoffWindow time.Duration `river:"handoff_window,attr,optional"`
+}
+
+// Validate implements river.Validator.
+func (b *ComponentBlock) Validate() error {
+	if b.ReplicationFactor < 0 {
+		return fmt.Errorf("replication_factor must not be negative")
+	}
+	for name, w := range b.Weights {
+		if w <= 0 {
+			return fmt.Errorf("weight of peer %q must be greater than 0", name)
+		}
+	}
+	if b.HandoffWindow < 0 {
+		return fmt.Errorf("handoff_window must not be negative")
+	}
+	return nil
 }
 
 // Cluster is a read-only view of a cluster.
@@ -378,8 +442,12 @@ type Cluster interface {
 }
 
 // sharderCluster shims an implementation of [shard.Sharder] to [Cluster] which
-// removes the ability to change peers.
-type sharderCluster struct{ sharder shard.Sharder }
+// removes the ability to change peers. It uses client to communicate with
+// other peers.
+type sharderCluster struct {
+	sharder shard.Sharder
+	client  *http.Client
+}
 
 var _ Cluster = (*sharderCluster)(nil)
 
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/ckit/peer"
+)
+
+// handoffPath is the path of the route peers use to check whether they can
+// hand off keys to the local node.
+const handoffPath = "/api/v1/cluster/handoff"
+
+const (
+	// maxHandoffKeys is the maximum number of keys checked by a single handoff
+	// request. Clients split larger sets of keys across several requests.
+	maxHandoffKeys = 1000
+
+	// maxHandoffRequestSize is the maximum size in bytes of the body of a
+	// handoff request. The handoff route doesn't require authentication, so
+	// bodies are limited before being decoded.
+	maxHandoffRequestSize = 4 << 20
+)
+
+// HandoffComponent is a Flow component which takes over keys from their
+// previous owners gracefully. Previous owners keep handling keys until the
+// component reports them as ready.
+type HandoffComponent interface {
+	component.Component
+
+	// ReadyKeys returns the subset of keys which the component handles
+	// successfully.
+	ReadyKeys(keys []string) []string
+}
+
+// HandoffClient is implemented by a [Cluster] which can check whether keys
+// can be handed off to other peers.
+type HandoffClient interface {
+	// ReadyKeys asks the component with the given ID running on peer p which
+	// of keys it handles successfully.
+	ReadyKeys(ctx context.Context, p peer.Peer, componentID string, keys []string) ([]string, error)
+}
+
+type handoffRequest struct {
+	Component string   `json:"component"`
+	Keys      []string `json:"keys"`
+}
+
+type handoffResponse struct {
+	Ready []string `json:"ready"`
+}
+
+// handoffHandler returns the handler reporting which keys are ready to be
+// handed off to components of host.
+func handoffHandler(host service.Host) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var (
+			req     handoffRequest
+			tooLong *http.MaxBytesError
+		)
+		r.Body = http.MaxBytesReader(w, r.Body, maxHandoffRequestSize)
+		if err := json.NewDecoder(r.Body).Decode(&req); errors.As(err, &tooLong) {
+			http.Error(w, fmt.Sprintf("request body larger than %d bytes", tooLong.Limit), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Keys) > maxHandoffKeys {
+			http.Error(w, fmt.Sprintf("request has more than %d keys", maxHandoffKeys), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// A component which doesn't exist or doesn't support handoffs isn't
+		// ready for any key.
+		resp := handoffResponse{Ready: []string{}}
+		info, err := host.GetComponent(component.ParseID(req.Component), component.InfoOptions{})
+		if err == nil {
+			if hc, ok := info.Component.(HandoffComponent); ok {
+				if ready := hc.ReadyKeys(req.Keys); ready != nil {
+					resp.Ready = ready
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+var _ HandoffClient = (*sharderCluster)(nil)
+
+func (sc *sharderCluster) ReadyKeys(ctx context.Context, p peer.Peer, componentID string, keys []string) ([]string, error) {
+	if sc.client == nil {
+		return nil, fmt.Errorf("handoffs are not supported")
+	}
+
+	var ready []string
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > maxHandoffKeys {
+			batch = batch[:maxHandoffKeys]
+		}
+		keys = keys[len(batch):]
+
+		batchReady, err := sc.readyKeys(ctx, p, componentID, batch)
+		if err != nil {
+			return nil, err
+		}
+		ready = append(ready, batchReady...)
+	}
+	return ready, nil
+}
+
+// readyKeys checks a single batch of at most maxHandoffKeys keys.
+func (sc *sharderCluster) readyKeys(ctx context.Context, p peer.Peer, componentID string, keys []string) ([]string, error) {
+	body, err := json.Marshal(handoffRequest{Component: componentID, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+p.Addr+handoffPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status code %d from peer %s: %s", resp.StatusCode, p.Name, bytes.TrimSpace(msg))
+	}
+
+	var res handoffResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid response from peer %s: %w", p.Name, err)
+	}
+	return res.Ready, nil
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/ckit/shard"
+)
+
+// Owners returns the peers owning key with the settings of b. The number of
+// owners is the replication factor of b, capped to the number of peers which
+// can own keys.
+//
+// When b has no weights, owners are found with the Lookup method of c.
+// Otherwise, owners are found with weighted rendezvous hashing, so that each
+// peer owns a share of the keys proportional to its weight. All the peers
+// must use the same weights to agree on the owners of keys.
+func (b ComponentBlock) Owners(c Cluster, key string) ([]peer.Peer, error) {
+	var participants []peer.Peer
+	for _, p := range c.Peers() {
+		if p.State == peer.StateParticipant {
+			participants = append(participants, p)
+		}
+	}
+
+	rf := b.ReplicationFactor
+	if rf < 1 {
+		rf = 1
+	}
+	if len(participants) > 0 && rf > len(participants) {
+		rf = len(participants)
+	}
+
+	if len(b.Weights) == 0 || len(participants) == 0 {
+		return c.Lookup(shard.StringKey(key), rf, shard.OpReadWrite)
+	}
+	return weightedOwners(participants, b.Weights, key, rf), nil
+}
+
+// weightedOwners returns the n peers with the highest weighted rendezvous
+// score for key.
+func weightedOwners(peers []peer.Peer, weights map[string]float64, key string, n int) []peer.Peer {
+	type scoredPeer struct {
+		peer  peer.Peer
+		score float64
+	}
+
+	scored := make([]scoredPeer, 0, len(peers))
+	for _, p := range peers {
+		weight, ok := weights[p.Name]
+		if !ok {
+			weight = 1
+		}
+		scored = append(scored, scoredPeer{
+			peer:  p,
+			score: rendezvousScore(p.Name, key, weight),
+		})
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].peer.Name < scored[j].peer.Name
+	})
+
+	res := make([]peer.Peer, 0, n)
+	for _, sp := range scored[:n] {
+		res = append(res, sp.peer)
+	}
+	return res
+}
+
+// rendezvousScore returns the score of a peer with a weight for key. The
+// probability of a peer having the highest score of all peers is its share
+// of the total weight.
+func rendezvousScore(peerName, key string, weight float64) float64 {
+	h := xxhash.New()
+	_, _ = h.WriteString(peerName)
+	_, _ = h.Write([]byte{0})
+	_, _ = h.WriteString(key)
+
+	// Map the hash to a uniform number in (0, 1).
+	u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+	return -weight / math.Log(u)
+}
@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/ckit/shard"
+	"github.com/grafana/river"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponentBlock_Owners(t *testing.T) {
+	c := testCluster{peers: []peer.Peer{
+		{Name: "a", State: peer.StateParticipant, Self: true},
+		{Name: "b", State: peer.StateParticipant},
+		{Name: "c", State: peer.StateParticipant},
+		{Name: "d", State: peer.StateViewer},
+	}}
+
+	t.Run("lookup without weights", func(t *testing.T) {
+		b := ComponentBlock{Enabled: true}
+		owners, err := b.Owners(c, "key")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a"}, peerNames(owners))
+	})
+
+	t.Run("replication factor capped to participants", func(t *testing.T) {
+		b := ComponentBlock{Enabled: true, ReplicationFactor: 5, Weights: map[string]float64{"a": 1}}
+		owners, err := b.Owners(c, "key")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"a", "b", "c"}, peerNames(owners))
+	})
+
+	t.Run("weighted distribution", func(t *testing.T) {
+		b := ComponentBlock{Enabled: true, Weights: map[string]float64{"a": 2, "c": 0.5}}
+
+		counts := make(map[string]int)
+		for i := 0; i < 35_000; i++ {
+			owners, err := b.Owners(c, fmt.Sprintf("key-%d", i))
+			require.NoError(t, err)
+			require.Len(t, owners, 1)
+			counts[owners[0].Name]++
+		}
+
+		// Peers own keys proportionally to their weight: 20000, 10000 and
+		// 5000 keys.
+		require.InDelta(t, 20_000, counts["a"], 500)
+		require.InDelta(t, 10_000, counts["b"], 500)
+		require.InDelta(t, 5_000, counts["c"], 500)
+		require.Zero(t, counts["d"])
+	})
+
+	t.Run("owners are stable", func(t *testing.T) {
+		b := ComponentBlock{Enabled: true, ReplicationFactor: 2, Weights: map[string]float64{"b": 3}}
+		first, err := b.Owners(c, "key")
+		require.NoError(t, err)
+
+		// Removing a peer which doesn't own a key doesn't move it.
+		var other testCluster
+		for _, p := range c.peers {
+			if p.Name == first[0].Name || p.Name == first[1].Name {
+				other.peers = append(other.peers, p)
+			}
+		}
+		second, err := b.Owners(other, "key")
+		require.NoError(t, err)
+		require.Equal(t, peerNames(first), peerNames(second))
+	})
+}
+
+func TestComponentBlock_Validate(t *testing.T) {
+	var args struct {
+		Clustering ComponentBlock `river:"clustering,block"`
+	}
+
+	err := river.Unmarshal([]byte(`
+		clustering {
+			enabled = true
+			weights = { "a" = 0 }
+		}
+	`), &args)
+	require.ErrorContains(t, err, `weight of peer "a" must be greater than 0`)
+
+	err = river.Unmarshal([]byte(`
+		clustering {
+			enabled            = true
+			replication_factor = 2
+			weights            = { "a" = 2 }
+			handoff_window     = "2m"
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, 2, args.Clustering.ReplicationFactor)
+}
+
+func TestHandoffHandler(t *testing.T) {
+	host := handoffHost{components: map[string]component.Component{
+		"prometheus.scrape.default":         readyComponent{"a", "c"},
+		"module.file.x/prometheus.scrape.x": readyComponent{"b"},
+	}}
+	srv := httptest.NewServer(handoffHandler(host))
+	defer srv.Close()
+
+	client := &sharderCluster{client: srv.Client()}
+	p := peer.Peer{Name: "b", Addr: strings.TrimPrefix(srv.URL, "http://")}
+
+	ready, err := client.ReadyKeys(context.Background(), p, "prometheus.scrape.default", []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, ready)
+
+	ready, err = client.ReadyKeys(context.Background(), p, "module.file.x/prometheus.scrape.x", []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, ready)
+
+	// Unknown components aren't ready for any key.
+	ready, err = client.ReadyKeys(context.Background(), p, "prometheus.scrape.missing", []string{"a"})
+	require.NoError(t, err)
+	require.Empty(t, ready)
+
+	resp, err := srv.Client().Get(srv.URL + handoffPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// Keys are split across requests which the handler accepts.
+	keys := make([]string, 2*maxHandoffKeys+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	keys[len(keys)-1] = "c"
+	ready, err = client.ReadyKeys(context.Background(), p, "prometheus.scrape.default", keys)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, ready)
+
+	// Requests with too many keys or too large bodies are rejected.
+	body, err := json.Marshal(handoffRequest{Component: "prometheus.scrape.default", Keys: keys})
+	require.NoError(t, err)
+	resp, err = srv.Client().Post(srv.URL+handoffPath, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	body = []byte(`{"component": "prometheus.scrape.default", "keys": ["` + strings.Repeat("a", maxHandoffRequestSize) + `"]}`)
+	resp, err = srv.Client().Post(srv.URL+handoffPath, "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func peerNames(peers []peer.Peer) []string {
+	names := make([]string, 0, len(peers))
+	for _, p := range peers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// testCluster is a Cluster whose Lookup returns its first peers.
+type testCluster struct{ peers []peer.Peer }
+
+func (c testCluster) Lookup(_ shard.Key, replicationFactor int, _ shard.Op) ([]peer.Peer, error) {
+	return c.peers[:replicationFactor], nil
+}
+
+func (c testCluster) Peers() []peer.Peer { return c.peers }
+
+// readyComponent is a HandoffComponent which is ready for a set of keys.
+type readyComponent []string
+
+func (readyComponent) Run(context.Context) error        { return nil }
+func (readyComponent) Update(component.Arguments) error { return nil }
+
+func (rc readyComponent) ReadyKeys(keys []string) []string {
+	var res []string
+	for _, key := range keys {
+		for _, ready := range rc {
+			if key == ready {
+				res = append(res, key)
+			}
+		}
+	}
+	return res
+}
+
+type handoffHost struct {
+	components map[string]component.Component
+}
+
+var _ service.Host = handoffHost{}
+
+func (h handoffHost) GetComponent(id component.ID, _ component.InfoOptions) (*component.Info, error) {
+	c, ok := h.components[id.String()]
+	if !ok {
+		return nil, component.ErrComponentNotFound
+	}
+	return &component.Info{ID: id, Component: c}, nil
+}
+
+func (handoffHost) ListComponents(string, component.InfoOptions) ([]*component.Info, error) {
+	return nil, nil
+}
+
+func (handoffHost) GetServiceConsumers(string) []service.Consumer { return nil }
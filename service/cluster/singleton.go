@@ -0,0 +1,351 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow/logging/level"
+	"github.com/grafana/agent/service"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/ckit/shard"
+)
+
+// Clustering modes of a SingletonBlock.
+const (
+	ModeNone      = "none"      // Run the component on every peer.
+	ModeSingleton = "singleton" // Run the component on a single peer.
+)
+
+// probePath is the path of the route peers use to check whether a component
+// runs on the local node.
+const probePath = "/api/v1/cluster/probe"
+
+// SingletonBlock holds the clustering settings of components which can run
+// on a single peer of the cluster. SingletonBlock is intended to be exposed
+// as a block called "clustering".
+type SingletonBlock struct {
+	Mode string `river:"mode,attr,optional"`
+	// FailoverTimeout is how long a peer waits for an unreachable peer
+	// running the component before running it.
+	FailoverTimeout time.Duration `river:"failover_timeout,attr,optional"`
+}
+
+// DefaultSingletonBlock holds default settings for SingletonBlock.
+var DefaultSingletonBlock = SingletonBlock{
+	Mode:            ModeNone,
+	FailoverTimeout: 30 * time.Second,
+}
+
+// SetToDefault implements river.Defaulter.
+func (b *SingletonBlock) SetToDefault() {
+	*b = DefaultSingletonBlock
+}
+
+// Validate implements river.Validator.
+func (b *SingletonBlock) Validate() error {
+	switch b.Mode {
+	case ModeNone, ModeSingleton:
+	default:
+		return fmt.Errorf("unsupported clustering mode %q, must be %q or %q", b.Mode, ModeNone, ModeSingleton)
+	}
+	if b.FailoverTimeout <= 0 {
+		return fmt.Errorf("failover_timeout must be greater than 0")
+	}
+	return nil
+}
+
+// ProbeClient is implemented by a [Cluster] which can check whether
+// components run on other peers.
+type ProbeClient interface {
+	// Probe returns an error if the component with the given ID doesn't run
+	// on peer p, or if p can't be reached.
+	Probe(ctx context.Context, p peer.Peer, componentID string) error
+}
+
+// Singleton decides whether a component in the singleton clustering mode
+// runs on the local peer. The component runs on the peer owning its ID in the
+// hash ring of the cluster. When that peer can't be reached for longer than
+// the failover timeout, the component runs on the next peer owning its ID.
+//
+// Components call Notify when the state of the cluster changes, and run
+// their workload while Active returns true.
+type Singleton struct {
+	id      string
+	log     log.Logger
+	cluster Cluster
+	notify  chan struct{}
+	changes chan struct{}
+
+	mut        sync.Mutex
+	block      SingletonBlock
+	active     bool
+	activePeer string               // Name of the peer running the component.
+	since      time.Time            // When active last changed.
+	failing    map[string]time.Time // Unreachable peers, by name.
+}
+
+// NewSingleton creates a Singleton for the component with the given ID. The
+// Singleton is active until its block is set with the singleton mode.
+func NewSingleton(id string, l log.Logger, c Cluster) *Singleton {
+	return &Singleton{
+		id:      id,
+		log:     l,
+		cluster: c,
+		notify:  make(chan struct{}, 1),
+		changes: make(chan struct{}, 1),
+
+		block:   DefaultSingletonBlock,
+		active:  true,
+		since:   time.Now(),
+		failing: make(map[string]time.Time),
+	}
+}
+
+// SetBlock updates the clustering settings of the component.
+func (s *Singleton) SetBlock(b SingletonBlock) {
+	s.mut.Lock()
+	s.block = b
+	s.mut.Unlock()
+
+	s.evaluate(time.Now())
+	s.Notify()
+}
+
+// Notify schedules a new election, for example when the state of the cluster
+// changed.
+func (s *Singleton) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Changes returns a channel which receives a value when Active changes.
+func (s *Singleton) Changes() <-chan struct{} {
+	return s.changes
+}
+
+// Active returns true if the component runs on the local peer.
+func (s *Singleton) Active() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.active
+}
+
+// Health returns the standby health of the component when it doesn't run on
+// the local peer. It returns false when the component runs on the local
+// peer.
+func (s *Singleton) Health() (component.Health, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.active {
+		return component.Health{}, false
+	}
+	return component.Health{
+		Health:     component.HealthTypeStandby,
+		Message:    fmt.Sprintf("running on peer %s", s.activePeer),
+		UpdateTime: s.since,
+	}, true
+}
+
+// Run elects the peer running the component until ctx is canceled. Peers
+// which run the component before the local peer are probed regularly to
+// detect when they can't be reached.
+func (s *Singleton) Run(ctx context.Context) {
+	s.mut.Lock()
+	interval := probeInterval(s.block.FailoverTimeout)
+	s.mut.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+			s.evaluate(time.Now())
+
+			s.mut.Lock()
+			newInterval := probeInterval(s.block.FailoverTimeout)
+			s.mut.Unlock()
+			if newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
+			}
+		case <-ticker.C:
+			s.probe(ctx)
+			s.evaluate(time.Now())
+		}
+	}
+}
+
+// probeInterval returns how often peers are probed to fail over within
+// timeout.
+func probeInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// candidates returns the peers which can run the component, by order of
+// preference.
+func (s *Singleton) candidates() ([]peer.Peer, error) {
+	var participants int
+	for _, p := range s.cluster.Peers() {
+		if p.State == peer.StateParticipant {
+			participants++
+		}
+	}
+	if participants == 0 {
+		participants = 1
+	}
+	return s.cluster.Lookup(shard.StringKey(s.id), participants, shard.OpReadWrite)
+}
+
+// probe checks whether the peers preferred over the local peer run the
+// component.
+func (s *Singleton) probe(ctx context.Context) {
+	s.mut.Lock()
+	mode := s.block.Mode
+	timeout := s.block.FailoverTimeout
+	s.mut.Unlock()
+
+	client, ok := s.cluster.(ProbeClient)
+	if mode != ModeSingleton || !ok {
+		return
+	}
+
+	candidates, err := s.candidates()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, p := range candidates {
+		if p.Self {
+			break
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, probeInterval(timeout))
+		err := client.Probe(probeCtx, p, s.id)
+		cancel()
+
+		s.mut.Lock()
+		if err == nil {
+			delete(s.failing, p.Name)
+		} else if _, ok := s.failing[p.Name]; !ok {
+			level.Warn(s.log).Log("msg", "failed to probe peer running singleton component", "peer", p.Name, "err", err)
+			s.failing[p.Name] = now
+		}
+		s.mut.Unlock()
+	}
+}
+
+// evaluate updates whether the component runs on the local peer.
+func (s *Singleton) evaluate(now time.Time) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	active, activePeer := true, ""
+	if s.block.Mode == ModeSingleton {
+		active, activePeer = s.elect(now)
+	}
+
+	if active != s.active {
+		if active {
+			level.Info(s.log).Log("msg", "running singleton component on this peer")
+		} else {
+			level.Info(s.log).Log("msg", "singleton component runs on another peer", "peer", activePeer)
+		}
+		s.since = now
+
+		select {
+		case s.changes <- struct{}{}:
+		default:
+		}
+	}
+	s.active, s.activePeer = active, activePeer
+}
+
+// elect returns whether the local peer runs the component, and the name of
+// the peer running it. It must be called with s.mut held.
+func (s *Singleton) elect(now time.Time) (bool, string) {
+	candidates, err := s.candidates()
+	if err != nil || len(candidates) == 0 {
+		// There are no peers to run the component, such as when the local
+		// peer isn't a participant yet. Run it rather than losing data.
+		return true, ""
+	}
+
+	known := make(map[string]struct{}, len(candidates))
+	for _, p := range candidates {
+		known[p.Name] = struct{}{}
+	}
+	for name := range s.failing {
+		if _, ok := known[name]; !ok {
+			delete(s.failing, name)
+		}
+	}
+
+	for _, p := range candidates {
+		if p.Self {
+			return true, p.Name
+		}
+		if since, ok := s.failing[p.Name]; ok && now.Sub(since) >= s.block.FailoverTimeout {
+			continue
+		}
+		return false, p.Name
+	}
+	return true, ""
+}
+
+// probeHandler returns the handler reporting whether components of host
+// are running.
+func probeHandler(host service.Host) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("component")
+		info, err := host.GetComponent(component.ParseID(id), component.InfoOptions{})
+		if err != nil || info.Component == nil {
+			http.Error(w, "component not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+var _ ProbeClient = (*sharderCluster)(nil)
+
+func (sc *sharderCluster) Probe(ctx context.Context, p peer.Peer, componentID string) error {
+	if sc.client == nil {
+		return fmt.Errorf("probes are not supported")
+	}
+
+	u := "http://" + p.Addr + probePath + "?component=" + url.QueryEscape(componentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from peer %s", resp.StatusCode, p.Name)
+	}
+	return nil
+}
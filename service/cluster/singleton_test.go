@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/component"
+	"github.com/grafana/ckit/peer"
+	"github.com/grafana/river"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleton(t *testing.T) {
+	var (
+		self  = peer.Peer{Name: "self", State: peer.StateParticipant, Self: true}
+		other = peer.Peer{Name: "other", State: peer.StateParticipant}
+	)
+
+	c := &probeCluster{testCluster: testCluster{peers: []peer.Peer{other, self}}}
+	s := NewSingleton("prometheus.exporter.github.default", log.NewNopLogger(), c)
+
+	// Components run on every peer by default.
+	require.True(t, s.Active())
+	_, standby := s.Health()
+	require.False(t, standby)
+
+	// The preferred peer runs the component.
+	s.SetBlock(SingletonBlock{Mode: ModeSingleton, FailoverTimeout: time.Minute})
+	require.False(t, s.Active())
+	requireChange(t, s)
+
+	health, standby := s.Health()
+	require.True(t, standby)
+	require.Equal(t, component.HealthTypeStandby, health.Health)
+	require.Equal(t, "running on peer other", health.Message)
+
+	// The component fails over once the preferred peer can't be reached for
+	// the failover timeout.
+	c.err = fmt.Errorf("connection refused")
+	now := time.Now()
+	s.probe(context.Background())
+	s.evaluate(now.Add(30 * time.Second))
+	require.False(t, s.Active())
+
+	s.evaluate(now.Add(2 * time.Minute))
+	require.True(t, s.Active())
+	requireChange(t, s)
+
+	// The component goes back to standby once the preferred peer is back.
+	c.err = nil
+	s.probe(context.Background())
+	s.evaluate(time.Now())
+	require.False(t, s.Active())
+
+	// The component runs on the local peer when it is preferred.
+	c.peers = []peer.Peer{self, other}
+	s.evaluate(time.Now())
+	require.True(t, s.Active())
+}
+
+func TestSingletonBlock_Validate(t *testing.T) {
+	var args struct {
+		Clustering SingletonBlock `river:"clustering,block,optional"`
+	}
+
+	err := river.Unmarshal([]byte(`
+		clustering {
+			mode = "leader"
+		}
+	`), &args)
+	require.ErrorContains(t, err, `unsupported clustering mode "leader"`)
+
+	err = river.Unmarshal([]byte(`
+		clustering {
+			mode             = "singleton"
+			failover_timeout = "10s"
+		}
+	`), &args)
+	require.NoError(t, err)
+	require.Equal(t, SingletonBlock{Mode: ModeSingleton, FailoverTimeout: 10 * time.Second}, args.Clustering)
+}
+
+func TestProbeHandler(t *testing.T) {
+	host := handoffHost{components: map[string]component.Component{
+		"prometheus.exporter.github.default": readyComponent{},
+	}}
+	srv := httptest.NewServer(probeHandler(host))
+	defer srv.Close()
+
+	client := &sharderCluster{client: srv.Client()}
+	p := peer.Peer{Name: "b", Addr: strings.TrimPrefix(srv.URL, "http://")}
+
+	require.NoError(t, client.Probe(context.Background(), p, "prometheus.exporter.github.default"))
+	require.Error(t, client.Probe(context.Background(), p, "prometheus.exporter.github.missing"))
+}
+
+func requireChange(t *testing.T, s *Singleton) {
+	t.Helper()
+
+	select {
+	case <-s.Changes():
+	default:
+		require.FailNow(t, "expected singleton to change")
+	}
+}
+
+// probeCluster is a testCluster whose probes return err.
+type probeCluster struct {
+	testCluster
+	err error
+}
+
+func (c *probeCluster) Probe(context.Context, peer.Peer, string) error { return c.err }
@@ -0,0 +1,268 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/regexp"
+	"github.com/grafana/river"
+	"github.com/grafana/river/rivertypes"
+)
+
+// Role is the level of access granted to an authenticated HTTP request.
+// Roles are ordered: a request with a higher role may access every route
+// available to a lower role.
+type Role int
+
+const (
+	// RoleNone grants access only to routes which do not require
+	// authentication, such as /-/ready.
+	RoleNone Role = iota
+
+	// RoleViewer grants read-only access to the UI, the component API,
+	// component HTTP handlers, metrics, and pprof endpoints.
+	RoleViewer
+
+	// RoleAdmin grants access to every route, including /-/reload.
+	RoleAdmin
+)
+
+var (
+	_ encoding.TextUnmarshaler = (*Role)(nil)
+	_ encoding.TextMarshaler   = (Role)(0)
+)
+
+var roles = map[string]Role{
+	"none":   RoleNone,
+	"viewer": RoleViewer,
+	"admin":  RoleAdmin,
+}
+
+// UnmarshalText unmarshals the name of a role.
+func (r *Role) UnmarshalText(text []byte) error {
+	str := string(text)
+
+	role, ok := roles[str]
+	if !ok {
+		return fmt.Errorf("unknown role %q, must be one of none, viewer, or admin", str)
+	}
+
+	*r = role
+	return nil
+}
+
+// MarshalText marshals a role to its name.
+func (r Role) MarshalText() ([]byte, error) {
+	for name, role := range roles {
+		if role == r {
+			return []byte(name), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown role %d", r)
+}
+
+// String returns the name of the role.
+func (r Role) String() string {
+	text, err := r.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("Role(%d)", r)
+	}
+	return string(text)
+}
+
+// AuthArguments configures authentication and authorization for the HTTP
+// service. Each request is granted the highest role of every credential it
+// presents which matches a configured rule.
+type AuthArguments struct {
+	BasicAuth    []BasicAuthArguments   `river:"basic_auth,block,optional"`
+	BearerTokens []BearerTokenArguments `river:"bearer_token,block,optional"`
+	MTLSSubjects []MTLSSubjectArguments `river:"mtls_subject,block,optional"`
+
+	// UnauthenticatedRole is the role granted to requests which don't match
+	// any configured rule.
+	UnauthenticatedRole Role `river:"unauthenticated_role,attr,optional"`
+}
+
+// BasicAuthArguments grants a role to requests which present a matching
+// username and password.
+type BasicAuthArguments struct {
+	Username string            `river:"username,attr"`
+	Password rivertypes.Secret `river:"password,attr"`
+	Role     Role              `river:"role,attr,optional"`
+}
+
+// BearerTokenArguments grants a role to requests which present a matching
+// bearer token in the Authorization header.
+type BearerTokenArguments struct {
+	Token rivertypes.Secret `river:"token,attr"`
+	Role  Role              `river:"role,attr,optional"`
+}
+
+// MTLSSubjectArguments grants a role to requests which present a verified
+// client certificate with a subject matching SubjectRegex.
+type MTLSSubjectArguments struct {
+	SubjectRegex string `river:"subject_regex,attr"`
+	Role         Role   `river:"role,attr,optional"`
+}
+
+var (
+	_ river.Defaulter = (*BasicAuthArguments)(nil)
+	_ river.Defaulter = (*BearerTokenArguments)(nil)
+	_ river.Defaulter = (*MTLSSubjectArguments)(nil)
+	_ river.Validator = (*AuthArguments)(nil)
+	_ river.Validator = (*MTLSSubjectArguments)(nil)
+)
+
+// SetToDefault sets the default for BasicAuthArguments.
+func (args *BasicAuthArguments) SetToDefault() { args.Role = RoleViewer }
+
+// SetToDefault sets the default for BearerTokenArguments.
+func (args *BearerTokenArguments) SetToDefault() { args.Role = RoleViewer }
+
+// SetToDefault sets the default for MTLSSubjectArguments.
+func (args *MTLSSubjectArguments) SetToDefault() { args.Role = RoleViewer }
+
+// Validate returns whether args is valid.
+func (args *AuthArguments) Validate() error {
+	if len(args.BasicAuth) == 0 && len(args.BearerTokens) == 0 && len(args.MTLSSubjects) == 0 {
+		return fmt.Errorf("at least one of basic_auth, bearer_token, or mtls_subject must be specified")
+	}
+
+	usernames := make(map[string]struct{}, len(args.BasicAuth))
+	for _, user := range args.BasicAuth {
+		if user.Username == "" {
+			return fmt.Errorf("basic_auth username must not be empty")
+		}
+		if _, exist := usernames[user.Username]; exist {
+			return fmt.Errorf("basic_auth username %q specified more than once", user.Username)
+		}
+		usernames[user.Username] = struct{}{}
+	}
+	for _, token := range args.BearerTokens {
+		if len(token.Token) == 0 {
+			return fmt.Errorf("bearer_token token must not be empty")
+		}
+	}
+	return nil
+}
+
+// Validate returns whether args is valid.
+func (args *MTLSSubjectArguments) Validate() error {
+	if _, err := regexp.Compile(args.SubjectRegex); err != nil {
+		return fmt.Errorf("error compiling subject_regex: %w", err)
+	}
+	return nil
+}
+
+// authenticator determines the role of incoming requests. A nil
+// authenticator grants RoleAdmin to every request, which preserves the
+// behavior of the HTTP service when no auth block is configured.
+type authenticator struct {
+	args     AuthArguments
+	subjects []*regexp.Regexp
+}
+
+// newAuthenticator creates an authenticator from args. If args is nil,
+// newAuthenticator returns a nil authenticator.
+func newAuthenticator(args *AuthArguments) (*authenticator, error) {
+	if args == nil {
+		return nil, nil
+	}
+
+	a := &authenticator{args: *args}
+	for _, s := range args.MTLSSubjects {
+		re, err := regexp.Compile(s.SubjectRegex)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling subject_regex: %w", err)
+		}
+		a.subjects = append(a.subjects, re)
+	}
+	return a, nil
+}
+
+// Authenticate returns the role granted to r and whether r presented any
+// credentials at all.
+func (a *authenticator) Authenticate(r *http.Request) (role Role, presented bool) {
+	if a == nil {
+		return RoleAdmin, true
+	}
+
+	role = a.args.UnauthenticatedRole
+	grant := func(r Role) {
+		if r > role {
+			role = r
+		}
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		presented = true
+		for _, user := range a.args.BasicAuth {
+			if secureEqual(username, user.Username) && secureEqual(password, string(user.Password)) {
+				grant(user.Role)
+			}
+		}
+	} else if token, ok := bearerToken(r); ok {
+		presented = true
+		for _, t := range a.args.BearerTokens {
+			if secureEqual(token, string(t.Token)) {
+				grant(t.Role)
+			}
+		}
+	}
+
+	// Go's TLS server only populates VerifiedChains when the client
+	// certificate was validated against client_ca_pem or client_ca_file, so
+	// unverified certificates are never trusted here.
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		presented = true
+		subject := r.TLS.VerifiedChains[0][0].Subject.String()
+		for i, re := range a.subjects {
+			if re.MatchString(subject) {
+				grant(a.args.MTLSSubjects[i].Role)
+			}
+		}
+	}
+
+	return role, presented
+}
+
+// Wrap returns a handler which only invokes next if the request has at least
+// the required role.
+func (a *authenticator) Wrap(required Role, next http.Handler) http.Handler {
+	if a == nil || required == RoleNone {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, presented := a.Authenticate(r)
+		switch {
+		case role >= required:
+			next.ServeHTTP(w, r)
+		case !presented:
+			if len(a.args.BasicAuth) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Grafana Agent"`)
+			}
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+		default:
+			http.Error(w, fmt.Sprintf("role %s is not permitted to access this endpoint", role), http.StatusForbidden)
+		}
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/river"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth_Roles(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`
+		auth {
+			basic_auth {
+				username = "viewer"
+				password = "viewer-password"
+			}
+			basic_auth {
+				username = "admin"
+				password = "admin-password"
+				role     = "admin"
+			}
+			bearer_token {
+				token = "reload-token"
+				role  = "admin"
+			}
+			mtls_subject {
+				subject_regex = "CN=ops\\..*"
+				role          = "admin"
+			}
+		}
+	`), &args)
+	require.NoError(t, err)
+
+	auth, err := newAuthenticator(args.Auth)
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tt := []struct {
+		name     string
+		required Role
+		setup    func(r *http.Request)
+		expect   int
+	}{
+		{
+			name:     "no credentials",
+			required: RoleViewer,
+			setup:    func(r *http.Request) {},
+			expect:   http.StatusUnauthorized,
+		},
+		{
+			name:     "no credentials on public route",
+			required: RoleNone,
+			setup:    func(r *http.Request) {},
+			expect:   http.StatusOK,
+		},
+		{
+			name:     "viewer reads",
+			required: RoleViewer,
+			setup:    func(r *http.Request) { r.SetBasicAuth("viewer", "viewer-password") },
+			expect:   http.StatusOK,
+		},
+		{
+			name:     "viewer reloads",
+			required: RoleAdmin,
+			setup:    func(r *http.Request) { r.SetBasicAuth("viewer", "viewer-password") },
+			expect:   http.StatusForbidden,
+		},
+		{
+			name:     "wrong password",
+			required: RoleViewer,
+			setup:    func(r *http.Request) { r.SetBasicAuth("admin", "viewer-password") },
+			expect:   http.StatusForbidden,
+		},
+		{
+			name:     "admin reloads",
+			required: RoleAdmin,
+			setup:    func(r *http.Request) { r.SetBasicAuth("admin", "admin-password") },
+			expect:   http.StatusOK,
+		},
+		{
+			name:     "bearer token",
+			required: RoleAdmin,
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer reload-token") },
+			expect:   http.StatusOK,
+		},
+		{
+			name:     "matching client certificate",
+			required: RoleAdmin,
+			setup:    func(r *http.Request) { r.TLS = verifiedState("ops.example.com") },
+			expect:   http.StatusOK,
+		},
+		{
+			name:     "non-matching client certificate",
+			required: RoleViewer,
+			setup:    func(r *http.Request) { r.TLS = verifiedState("dev.example.com") },
+			expect:   http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tc.setup(req)
+
+			rec := httptest.NewRecorder()
+			auth.Wrap(tc.required, ok).ServeHTTP(rec, req)
+			require.Equal(t, tc.expect, rec.Code)
+		})
+	}
+}
+
+func TestAuth_Disabled(t *testing.T) {
+	auth, err := newAuthenticator(nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	auth.Wrap(RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuth_Validate(t *testing.T) {
+	var args Arguments
+	err := river.Unmarshal([]byte(`auth {}`), &args)
+	require.EqualError(t, err, "at least one of basic_auth, bearer_token, or mtls_subject must be specified")
+
+	err = river.Unmarshal([]byte(`
+		auth {
+			basic_auth {
+				username = "admin"
+				password = "a"
+			}
+			basic_auth {
+				username = "admin"
+				password = "b"
+			}
+		}
+	`), &args)
+	require.EqualError(t, err, `basic_auth username "admin" specified more than once`)
+
+	err = river.Unmarshal([]byte(`
+		auth {
+			bearer_token {
+				token = "t"
+				role  = "superuser"
+			}
+		}
+	`), &args)
+	require.ErrorContains(t, err, `unknown role "superuser"`)
+}
+
+func verifiedState(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
@@ -10,8 +10,10 @@ import (
 	_ "net/http/pprof" // Register pprof handlers
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/gorilla/mux"
@@ -19,6 +21,7 @@ import (
 	"github.com/grafana/agent/pkg/flow"
 	"github.com/grafana/agent/pkg/flow/logging/level"
 	"github.com/grafana/agent/pkg/server"
+	"github.com/grafana/agent/pkg/supportbundle"
 	"github.com/grafana/agent/service"
 	"github.com/grafana/ckit/memconn"
 	_ "github.com/grafana/pyroscope-go/godeltaprof/http/pprof" // Register godeltaprof handler
@@ -40,8 +43,15 @@ type Options struct {
 	Tracer   trace.TracerProvider // Where to send traces.
 	Gatherer prometheus.Gatherer  // Where to collect metrics from.
 
-	ReadyFunc  func() bool
-	ReloadFunc func() (*flow.Source, error)
+	ReadyFunc func() bool
+
+	// ReloadFunc reloads the source of the controller for the /-/reload
+	// endpoint. The returned status is nil if no source could be loaded.
+	ReloadFunc func() (*flow.LoadStatus, error)
+
+	// SupportBundleFunc gathers a support bundle for the /-/support endpoint.
+	// The endpoint is disabled when SupportBundleFunc is nil.
+	SupportBundleFunc func(ctx context.Context, host service.Host) (*supportbundle.FlowBundle, error)
 
 	HTTPListenAddr   string // Address to listen for HTTP traffic on.
 	MemoryListenAddr string // Address to accept in-memory traffic on.
@@ -50,7 +60,8 @@ type Options struct {
 
 // Arguments holds runtime settings for the HTTP service.
 type Arguments struct {
-	TLS *TLSArguments `river:"tls,block,optional"`
+	TLS  *TLSArguments  `river:"tls,block,optional"`
+	Auth *AuthArguments `river:"auth,block,optional"`
 }
 
 type Service struct {
@@ -62,6 +73,9 @@ type Service struct {
 	winMut sync.Mutex
 	win    *server.WinCertStoreHandler
 
+	authMut sync.RWMutex
+	auth    *authenticator
+
 	// publicLis and tcpLis are used to lazily enable TLS, since TLS is
 	// optionally configurable at runtime.
 	//
@@ -162,13 +176,13 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 
 	r.Handle(
 		"/metrics",
-		promhttp.HandlerFor(s.gatherer, promhttp.HandlerOpts{}),
+		s.requireRole(RoleViewer, promhttp.HandlerFor(s.gatherer, promhttp.HandlerOpts{})),
 	)
 	if s.opts.EnablePProf {
-		r.PathPrefix("/debug/pprof").Handler(http.DefaultServeMux)
+		r.PathPrefix("/debug/pprof").Handler(s.requireRole(RoleViewer, http.DefaultServeMux))
 	}
 
-	r.PathPrefix(s.componentHttpPathPrefix).Handler(s.componentHandler(host))
+	r.PathPrefix(s.componentHttpPathPrefix).Handler(s.requireRole(RoleViewer, s.componentHandler(host)))
 
 	if s.opts.ReadyFunc != nil {
 		r.HandleFunc("/-/ready", func(w http.ResponseWriter, _ *http.Request) {
@@ -183,17 +197,19 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 	}
 
 	if s.opts.ReloadFunc != nil {
-		r.HandleFunc("/-/reload", func(w http.ResponseWriter, _ *http.Request) {
+		r.Handle("/-/reload", s.requireRole(RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 			level.Info(s.log).Log("msg", "reload requested via /-/reload endpoint")
-			defer level.Info(s.log).Log("msg", "config reloaded")
 
-			_, err := s.opts.ReloadFunc()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
+			status, err := s.opts.ReloadFunc()
+			if err == nil {
+				level.Info(s.log).Log("msg", "config reloaded")
 			}
-			fmt.Fprintln(w, "config reloaded")
-		}).Methods(http.MethodGet, http.MethodPost)
+			writeReloadResponse(w, status, err)
+		}))).Methods(http.MethodGet, http.MethodPost)
+	}
+
+	if s.opts.SupportBundleFunc != nil {
+		r.Handle("/-/support", s.requireRole(RoleAdmin, s.supportHandler(host))).Methods(http.MethodGet)
 	}
 
 	// Wire custom service handlers for services which depend on the http
@@ -202,27 +218,45 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 	// NOTE(rfratto): keep this at the bottom of all other routes, otherwise a
 	// service with a colliding path takes precedence over a predefined route.
 	for _, route := range s.getServiceRoutes(host) {
-		r.PathPrefix(route.Base).Handler(route.Handler)
+		r.PathPrefix(route.Base).Handler(s.requireRole(route.Role, route.Handler))
 	}
 
-	srv := &http.Server{Handler: h2c.NewHandler(r, &http2.Server{})}
+	// Traffic over the in-memory listener never leaves the process (it is
+	// used by components such as prometheus.exporter.* scraping themselves),
+	// so it bypasses authentication by being served from a separate server
+	// marked as trusted.
+	var (
+		publicSrv = &http.Server{Handler: h2c.NewHandler(r, &http2.Server{})}
+		memSrv    = &http.Server{
+			Handler: h2c.NewHandler(r, &http2.Server{}),
+			ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+				return context.WithValue(ctx, trustedConnKey{}, true)
+			},
+		}
+	)
 
 	level.Info(s.log).Log("msg", "now listening for http traffic", "addr", s.opts.HTTPListenAddr)
 
-	listeners := []net.Listener{s.publicLis, s.memLis}
-	for _, lis := range listeners {
+	servers := map[net.Listener]*http.Server{
+		s.publicLis: publicSrv,
+		s.memLis:    memSrv,
+	}
+	for lis, srv := range servers {
 		wg.Add(1)
-		go func(lis net.Listener) {
+		go func(lis net.Listener, srv *http.Server) {
 			defer wg.Done()
 			defer cancel()
 
 			if err := srv.Serve(lis); err != nil {
 				level.Info(s.log).Log("msg", "http server closed", "addr", lis.Addr(), "err", err)
 			}
-		}(lis)
+		}(lis, srv)
 	}
 
-	defer func() { _ = srv.Shutdown(ctx) }()
+	defer func() {
+		_ = publicSrv.Shutdown(ctx)
+		_ = memSrv.Shutdown(ctx)
+	}()
 
 	<-ctx.Done()
 	return nil
@@ -233,7 +267,7 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 //
 // Longer paths are prioritized over shorter paths so that a service with a
 // more specific base route takes precedence.
-func (s *Service) getServiceRoutes(host service.Host) []serviceRoute {
+func (s *Service) getServiceRoutes(host service.Host) []ServiceRoute {
 	var routes serviceRoutes
 
 	for _, consumer := range host.GetServiceConsumers(ServiceName) {
@@ -241,15 +275,26 @@ func (s *Service) getServiceRoutes(host service.Host) []serviceRoute {
 			continue
 		}
 
+		if rs, ok := consumer.Value.(RoutesServiceHandler); ok {
+			routes = append(routes, rs.ServiceRoutes(host)...)
+			continue
+		}
+
 		sh, ok := consumer.Value.(ServiceHandler)
 		if !ok {
 			continue
 		}
 		base, handler := sh.ServiceHandler(host)
 
-		routes = append(routes, serviceRoute{
+		role := RoleViewer
+		if rs, ok := consumer.Value.(RoleServiceHandler); ok {
+			role = rs.ServiceHandlerRole()
+		}
+
+		routes = append(routes, ServiceRoute{
 			Base:    base,
 			Handler: handler,
+			Role:    role,
 		})
 	}
 
@@ -257,6 +302,27 @@ func (s *Service) getServiceRoutes(host service.Host) []serviceRoute {
 	return routes
 }
 
+// trustedConnKey is the context key set on requests received over the
+// in-memory listener.
+type trustedConnKey struct{}
+
+// requireRole wraps next so that it is only invoked for requests which have
+// at least the required role under the currently applied auth settings.
+func (s *Service) requireRole(required Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if trusted, _ := r.Context().Value(trustedConnKey{}).(bool); trusted {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.authMut.RLock()
+		auth := s.auth
+		s.authMut.RUnlock()
+
+		auth.Wrap(required, next).ServeHTTP(w, r)
+	})
+}
+
 func (s *Service) componentHandler(host service.Host) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Trim the path prefix to get our full path.
@@ -293,10 +359,54 @@ func (s *Service) componentHandler(host service.Host) http.HandlerFunc {
 	}
 }
 
+// defaultSupportBundleDuration is the default duration of the CPU profile
+// collected for a support bundle.
+const defaultSupportBundleDuration = 30 * time.Second
+
+func (s *Service) supportHandler(host service.Host) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		duration := defaultSupportBundleDuration
+		if r.URL.Query().Has("duration") {
+			d, err := strconv.Atoi(r.URL.Query().Get("duration"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("duration value (in seconds) should be a positive integer: %s", err), http.StatusBadRequest)
+				return
+			}
+			if d < 1 {
+				http.Error(w, "duration value (in seconds) should be larger than 1", http.StatusBadRequest)
+				return
+			}
+			duration = time.Duration(d) * time.Second
+		}
+
+		level.Info(s.log).Log("msg", "support bundle requested via /-/support endpoint", "duration", duration)
+
+		ctx, cancel := context.WithTimeout(r.Context(), duration)
+		defer cancel()
+
+		bundle, err := s.opts.SupportBundleFunc(ctx, host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := supportbundle.ServeFlow(w, bundle); err != nil {
+			level.Error(s.log).Log("msg", "failed to serve support bundle", "err", err)
+		}
+	}
+}
+
 // Update implements [service.Service] and applies settings.
 func (s *Service) Update(newConfig any) error {
 	newArgs := newConfig.(Arguments)
 
+	auth, err := newAuthenticator(newArgs.Auth)
+	if err != nil {
+		return err
+	}
+	s.authMut.Lock()
+	s.auth = auth
+	s.authMut.Unlock()
+
 	if newArgs.TLS != nil {
 		var tlsConfig *tls.Config
 		var err error
@@ -406,6 +516,32 @@ type ServiceHandler interface {
 	ServiceHandler(host service.Host) (base string, handler http.Handler)
 }
 
+// RoleServiceHandler is an optional interface which may be implemented by a
+// ServiceHandler to change the role required to access its routes when the
+// auth block is configured. ServiceHandlers which do not implement
+// RoleServiceHandler require RoleViewer.
+type RoleServiceHandler interface {
+	ServiceHandler
+
+	// ServiceHandlerRole returns the minimum role required to access the
+	// routes returned by ServiceHandler.
+	ServiceHandlerRole() Role
+}
+
+// RoutesServiceHandler is an optional interface which may be implemented by a
+// ServiceHandler whose routes don't share a base route, or require different
+// roles. The routes returned by ServiceRoutes are registered instead of the
+// route returned by ServiceHandler.
+type RoutesServiceHandler interface {
+	ServiceHandler
+
+	// ServiceRoutes returns the routes to register for the provided service.
+	//
+	// This method is only called for services that declare a dependency on
+	// the http service.
+	ServiceRoutes(host service.Host) []ServiceRoute
+}
+
 // lazyListener is a [net.Listener] which lazily initializes the underlying
 // listener.
 type lazyListener struct {
@@ -172,7 +172,7 @@ func newTestEnvironment(t *testing.T) (*testEnvironment, error) {
 		Gatherer: prometheus.NewRegistry(),
 
 		ReadyFunc:  func() bool { return true },
-		ReloadFunc: func() (*flow.Source, error) { return nil, nil },
+		ReloadFunc: func() (*flow.LoadStatus, error) { return nil, nil },
 
 		HTTPListenAddr:   fmt.Sprintf("127.0.0.1:%d", port),
 		MemoryListenAddr: "agent.internal:12345",
@@ -215,3 +215,69 @@ func (fakeHost) ListComponents(moduleID string, opts component.InfoOptions) ([]*
 }
 
 func (fakeHost) GetServiceConsumers(serviceName string) []service.Consumer { return nil }
+
+func TestServiceRoutes(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+
+	env, err := newTestEnvironment(t)
+	require.NoError(t, err)
+	require.NoError(t, env.ApplyConfig(`
+		auth {
+			basic_auth {
+				username = "viewer"
+				password = "viewer-password"
+			}
+		}
+	`))
+
+	go func() {
+		require.NoError(t, env.svc.Run(ctx, routesHost{}))
+	}()
+
+	cli, err := config.NewClientFromConfig(config.HTTPClientConfig{}, "test")
+	require.NoError(t, err)
+	get := func(t require.TestingT, path string) int {
+		resp, err := cli.Get(fmt.Sprintf("http://%s%s", env.ListenAddr(), path))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	util.Eventually(t, func(t require.TestingT) {
+		require.Equal(t, http.StatusOK, get(t, "/-/ready"))
+	})
+	require.Equal(t, http.StatusOK, get(t, "/api/v1/public"))
+	require.Equal(t, http.StatusUnauthorized, get(t, "/api/v1/private"))
+	// The route returned by ServiceHandler isn't registered.
+	require.Equal(t, http.StatusNotFound, get(t, "/api/v1/"))
+}
+
+// routesHost is a host with a service implementing RoutesServiceHandler.
+type routesHost struct{ fakeHost }
+
+func (routesHost) GetServiceConsumers(serviceName string) []service.Consumer {
+	return []service.Consumer{{
+		Type:  service.ConsumerTypeService,
+		ID:    "routes",
+		Value: routesService{},
+	}}
+}
+
+type routesService struct{ service.Service }
+
+var _ RoutesServiceHandler = routesService{}
+
+func (routesService) ServiceHandler(host service.Host) (string, http.Handler) {
+	return "/api/v1/", okHandler
+}
+
+func (routesService) ServiceRoutes(host service.Host) []ServiceRoute {
+	return []ServiceRoute{
+		{Base: "/api/v1/public", Handler: okHandler, Role: RoleNone},
+		{Base: "/api/v1/private", Handler: okHandler, Role: RoleViewer},
+	}
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
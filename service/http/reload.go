@@ -0,0 +1,38 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/grafana/agent/pkg/flow"
+)
+
+// reloadResponse is the body returned by the /-/reload endpoint.
+type reloadResponse struct {
+	Status     string           `json:"status"` // "success" or "error".
+	Error      string           `json:"error,omitempty"`
+	RolledBack bool             `json:"rolledBack"`
+	Diff       *flow.SourceDiff `json:"diff,omitempty"`
+}
+
+// writeReloadResponse writes the result of a reload as JSON. Reloads which
+// failed are reported with status code 400, even if the controller rolled back
+// to the last good source.
+func writeReloadResponse(w http.ResponseWriter, status *flow.LoadStatus, err error) {
+	resp := reloadResponse{Status: "success"}
+	if status != nil {
+		resp.RolledBack = status.RolledBack
+		resp.Diff = &status.Diff
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		resp.Status = "error"
+		resp.Error = err.Error()
+		code = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/agent/pkg/flow"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReloadResponse(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		writeReloadResponse(rec, &flow.LoadStatus{
+			Diff: flow.SourceDiff{
+				Added:      []string{"prometheus.relabel.new"},
+				EdgesAdded: []flow.Edge{{From: "prometheus.relabel.new", To: "prometheus.remote_write.default"}},
+			},
+		}, nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp reloadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, "success", resp.Status)
+		require.False(t, resp.RolledBack)
+		require.Equal(t, []string{"prometheus.relabel.new"}, resp.Diff.Added)
+		require.Equal(t, "prometheus.remote_write.default", resp.Diff.EdgesAdded[0].To)
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		writeReloadResponse(rec, &flow.LoadStatus{
+			Diff:       flow.SourceDiff{Changed: []string{"prometheus.relabel.default"}},
+			RolledBack: true,
+		}, errors.New("bad argument"))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var resp reloadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, "error", resp.Status)
+		require.Equal(t, "bad argument", resp.Error)
+		require.True(t, resp.RolledBack)
+		require.Equal(t, []string{"prometheus.relabel.default"}, resp.Diff.Changed)
+	})
+
+	t.Run("source not loaded", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		writeReloadResponse(rec, nil, errors.New("reading config path"))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		var resp reloadResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Nil(t, resp.Diff)
+	})
+}
@@ -6,13 +6,16 @@ import (
 	"strings"
 )
 
-type serviceRoute struct {
+// ServiceRoute is a route registered by a service. Requests whose path starts
+// with Base are served by Handler.
+type ServiceRoute struct {
 	Base    string
 	Handler http.Handler
+	Role    Role // Minimum role required to access the route.
 }
 
-// serviceRoutes is a sortable collection of serviceRoute.
-type serviceRoutes []serviceRoute
+// serviceRoutes is a sortable collection of ServiceRoute.
+type serviceRoutes []ServiceRoute
 
 var _ sort.Interface = (serviceRoutes)(nil)
 
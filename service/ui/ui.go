@@ -8,6 +8,7 @@ import (
 	"path"
 
 	"github.com/gorilla/mux"
+	"github.com/grafana/agent/pkg/flow"
 	"github.com/grafana/agent/service"
 	"github.com/grafana/agent/service/cluster"
 	http_service "github.com/grafana/agent/service/http"
@@ -23,6 +24,10 @@ const ServiceName = "ui"
 type Options struct {
 	Cluster  cluster.Cluster
 	UIPrefix string // Path prefix to host the UI at.
+
+	// LoadStatusFunc returns the result of the most recent reload, shown in
+	// the UI with the last good and failed sources. Optional.
+	LoadStatusFunc func() flow.LoadStatus
 }
 
 // Service implements the UI service.
@@ -77,7 +82,7 @@ func (s *Service) ServiceHandler(host service.Host) (base string, handler http.H
 
 	// TODO(rfratto): allow service.Host to return services so we don't have to
 	// pass the clustering service in Options.
-	fa := api.NewFlowAPI(host, s.opts.Cluster)
+	fa := api.NewFlowAPI(host, s.opts.Cluster, s.opts.LoadStatusFunc)
 	fa.RegisterRoutes(path.Join(s.opts.UIPrefix, "/api/v0/web"), r)
 	ui.RegisterRoutes(s.opts.UIPrefix, r)
 
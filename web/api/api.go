@@ -6,24 +6,32 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/grafana/agent/component"
+	"github.com/grafana/agent/pkg/flow"
+	"github.com/grafana/agent/pkg/flow/tap"
 	"github.com/grafana/agent/service/cluster"
 	"github.com/prometheus/prometheus/util/httputil"
 )
 
 // FlowAPI is a wrapper around the component API.
 type FlowAPI struct {
-	flow    component.Provider
-	cluster cluster.Cluster
+	flow       component.Provider
+	cluster    cluster.Cluster
+	loadStatus func() flow.LoadStatus
 }
 
-// NewFlowAPI instantiates a new Flow API.
-func NewFlowAPI(flow component.Provider, cluster cluster.Cluster) *FlowAPI {
-	return &FlowAPI{flow: flow, cluster: cluster}
+// NewFlowAPI instantiates a new Flow API. loadStatus returns the result of
+// the most recent reload; the reload route is disabled if it's nil.
+func NewFlowAPI(flow component.Provider, cluster cluster.Cluster, loadStatus func() flow.LoadStatus) *FlowAPI {
+	return &FlowAPI{flow: flow, cluster: cluster, loadStatus: loadStatus}
 }
 
 // RegisterRoutes registers all the API's routes.
@@ -34,8 +42,16 @@ func (f *FlowAPI) RegisterRoutes(urlPrefix string, r *mux.Router) {
 
 	r.Handle(path.Join(urlPrefix, "/modules/{moduleID:.+}/components"), httputil.CompressionHandler{Handler: f.listComponentsHandler()})
 	r.Handle(path.Join(urlPrefix, "/components"), httputil.CompressionHandler{Handler: f.listComponentsHandler()})
+
+	// The tap route must be registered before the route for individual
+	// components, which would otherwise match it. It isn't compressed so that
+	// events are streamed as soon as they're written.
+	r.Handle(path.Join(urlPrefix, "/components/{id:.+}/tap"), f.tapComponentHandler())
 	r.Handle(path.Join(urlPrefix, "/components/{id:.+}"), httputil.CompressionHandler{Handler: f.getComponentHandler()})
 	r.Handle(path.Join(urlPrefix, "/peers"), httputil.CompressionHandler{Handler: f.getClusteringPeersHandler()})
+	if f.loadStatus != nil {
+		r.Handle(path.Join(urlPrefix, "/reload"), httputil.CompressionHandler{Handler: f.getReloadStatusHandler()})
+	}
 }
 
 func (f *FlowAPI) listComponentsHandler() http.HandlerFunc {
@@ -74,6 +90,7 @@ func (f *FlowAPI) getComponentHandler() http.HandlerFunc {
 			GetArguments: true,
 			GetExports:   true,
 			GetDebugInfo: true,
+			GetStats:     true,
 		})
 		if err != nil {
 			http.NotFound(w, r)
@@ -89,6 +106,60 @@ func (f *FlowAPI) getComponentHandler() http.HandlerFunc {
 	}
 }
 
+// tapComponentHandler streams events sampled from the exported receivers of a
+// component as newline-delimited JSON until the client disconnects or the
+// component stops. The optional rate query parameter sets the maximum number
+// of events per second.
+func (f *FlowAPI) tapComponentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tapper, ok := f.flow.(tap.Provider)
+		if !ok {
+			http.Error(w, "tapping components is not supported", http.StatusNotImplemented)
+			return
+		}
+
+		opts := tap.DefaultOptions
+		if r.URL.Query().Has("rate") {
+			rate, err := strconv.ParseFloat(r.URL.Query().Get("rate"), 64)
+			if err != nil || rate <= 0 || rate > tap.MaxRate {
+				http.Error(w, fmt.Sprintf("rate must be a number between 0 and %d", tap.MaxRate), http.StatusBadRequest)
+				return
+			}
+			opts.Rate = rate
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		vars := mux.Vars(r)
+		events, err := tapper.Tap(r.Context(), component.ParseID(vars["id"]), opts)
+		switch {
+		case errors.Is(err, component.ErrComponentNotFound):
+			http.NotFound(w, r)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		enc := json.NewEncoder(w)
+		for ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 func (f *FlowAPI) getClusteringPeersHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		// TODO(@tpaschalis) Detect if clustering is disabled and propagate to
@@ -102,3 +173,46 @@ func (f *FlowAPI) getClusteringPeersHandler() http.HandlerFunc {
 		_, _ = w.Write(bb)
 	}
 }
+
+// reloadStatus is the JSON representation of a flow.LoadStatus. Sources are
+// returned as maps of file names to file contents.
+type reloadStatus struct {
+	Time       time.Time         `json:"time"`
+	Error      string            `json:"error,omitempty"`
+	RolledBack bool              `json:"rolledBack"`
+	Diff       flow.SourceDiff   `json:"diff"`
+	LastGood   map[string]string `json:"lastGood"`
+	Failed     map[string]string `json:"failed"`
+}
+
+func (f *FlowAPI) getReloadStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		status := f.loadStatus()
+
+		resp := reloadStatus{
+			Time:       status.Time,
+			RolledBack: status.RolledBack,
+			Diff:       status.Diff,
+			LastGood:   sourceFiles(status.LastGood),
+			Failed:     sourceFiles(status.Failed),
+		}
+		if status.Error != nil {
+			resp.Error = status.Error.Error()
+		}
+
+		bb, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(bb)
+	}
+}
+
+func sourceFiles(s *flow.Source) map[string]string {
+	files := make(map[string]string)
+	for name, content := range s.RawConfigs() {
+		files[name] = string(content)
+	}
+	return files
+}
@@ -6,6 +6,7 @@ import PageClusteringPeers from './pages/Clustering';
 import ComponentDetailPage from './pages/ComponentDetailPage';
 import Graph from './pages/Graph';
 import PageComponentList from './pages/PageComponentList';
+import PageReload from './pages/Reload';
 
 interface Props {
   basePath: string;
@@ -19,8 +20,9 @@ const Router = ({ basePath }: Props) => {
         <Routes>
           <Route path="/" element={<PageComponentList />} />
           <Route path="/component/*" element={<ComponentDetailPage />} />
-          <Route path="/graph" element={<Graph />} />
+          <Route path="/graph/*" element={<Graph />} />
           <Route path="/clustering" element={<PageClusteringPeers />} />
+          <Route path="/reload" element={<PageReload />} />
         </Routes>
       </main>
     </BrowserRouter>
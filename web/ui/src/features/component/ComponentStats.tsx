@@ -0,0 +1,33 @@
+import { FC } from 'react';
+
+import { ComponentStats as Stats } from './types';
+
+import styles from './ComponentStats.module.css';
+
+export interface ComponentStatsProps {
+  stats: Stats;
+}
+
+/**
+ * ComponentStats displays the resource usage of a component.
+ */
+export const ComponentStats: FC<ComponentStatsProps> = ({ stats }) => {
+  return (
+    <table className={styles.stats}>
+      <tbody>
+        <tr>
+          <th>Goroutines</th>
+          <td>{stats.goroutines}</td>
+        </tr>
+        <tr>
+          <th>Items received</th>
+          <td>{stats.itemsReceived}</td>
+        </tr>
+        <tr>
+          <th>Items sent</th>
+          <td>{stats.itemsSent}</td>
+        </tr>
+      </tbody>
+    </table>
+  );
+};
@@ -0,0 +1,135 @@
+import { FC, useEffect, useRef, useState } from 'react';
+
+import { TapEvent } from './types';
+
+import styles from './ComponentTap.module.css';
+
+/** maxEvents is the number of events retained in the view. */
+const maxEvents = 100;
+
+export interface ComponentTapProps {
+  /** The full ID of the component to tap, including its module ID. */
+  id: string;
+}
+
+/**
+ * ComponentTap streams events sampled from the exported receivers of a
+ * component while the user has the tap running.
+ */
+export const ComponentTap: FC<ComponentTapProps> = ({ id }) => {
+  const [running, setRunning] = useState(false);
+  const [rate, setRate] = useState(10);
+  const [events, setEvents] = useState<TapEvent[]>([]);
+  const [error, setError] = useState<string | undefined>(undefined);
+  const abort = useRef<AbortController | undefined>(undefined);
+
+  // Stop tapping when navigating away from the component.
+  useEffect(() => {
+    return () => abort.current?.abort();
+  }, [id]);
+
+  const stop = () => {
+    abort.current?.abort();
+    abort.current = undefined;
+    setRunning(false);
+  };
+
+  const start = () => {
+    const controller = new AbortController();
+    abort.current = controller;
+    setEvents([]);
+    setError(undefined);
+    setRunning(true);
+
+    const worker = async () => {
+      // Request is relative to the <base> tag inside of <head>.
+      const resp = await fetch(`./api/v0/web/components/${id}/tap?rate=${rate}`, {
+        cache: 'no-cache',
+        credentials: 'same-origin',
+        signal: controller.signal,
+      });
+      if (!resp.ok || !resp.body) {
+        throw new Error((await resp.text()).trim() || resp.statusText);
+      }
+
+      const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buf = '';
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) {
+          break;
+        }
+
+        buf += value;
+        const lines = buf.split('\n');
+        buf = lines.pop() || '';
+
+        const received = lines.filter((line) => line !== '').map((line) => JSON.parse(line) as TapEvent);
+        setEvents((prev) => received.reverse().concat(prev).slice(0, maxEvents));
+      }
+    };
+
+    worker()
+      .catch((err) => {
+        if (!controller.signal.aborted) {
+          setError(String(err.message || err));
+        }
+      })
+      .finally(() => {
+        if (abort.current === controller) {
+          abort.current = undefined;
+          setRunning(false);
+        }
+      });
+  };
+
+  return (
+    <div>
+      <div className={styles.controls}>
+        <label>
+          Events per second{' '}
+          <input
+            type="number"
+            min={1}
+            max={1000}
+            value={rate}
+            disabled={running}
+            onChange={(e) => setRate(Number(e.target.value))}
+          />
+        </label>
+        {running ? <button onClick={stop}>Stop</button> : <button onClick={start}>Start</button>}
+      </div>
+
+      {error && <p className={styles.error}>{error}</p>}
+
+      {events.length === 0 ? (
+        <em className={styles.informative}>
+          {running ? 'Waiting for data…' : 'Start the tap to sample data sent to this component.'}
+        </em>
+      ) : (
+        <table className={styles.events}>
+          <thead>
+            <tr>
+              <th>Time</th>
+              <th>Receiver</th>
+              <th>Kind</th>
+              <th>Labels</th>
+              <th>Data</th>
+            </tr>
+          </thead>
+          <tbody>
+            {events.map((ev, idx) => (
+              <tr key={idx.toString()}>
+                <td>{ev.time}</td>
+                <td>{ev.receiver}</td>
+                <td>{ev.kind}</td>
+                <td>{ev.labels}</td>
+                <td>{ev.data}</td>
+              </tr>
+            ))}
+          </tbody>
+        </table>
+      )}
+    </div>
+  );
+};
@@ -7,6 +7,8 @@ import { partitionBody } from '../../utils/partition';
 
 import ComponentBody from './ComponentBody';
 import ComponentList from './ComponentList';
+import { ComponentStats } from './ComponentStats';
+import { ComponentTap } from './ComponentTap';
 import { HealthLabel } from './HealthLabel';
 import { ComponentDetail, ComponentInfo, PartitionedBody } from './types';
 
@@ -58,6 +60,20 @@ export const ComponentView: FC<ComponentViewProps> = (props) => {
           {argsPartition && partitionTOC(argsPartition)}
           {exportsPartition && partitionTOC(exportsPartition)}
           {debugPartition && partitionTOC(debugPartition)}
+          {props.component.stats && (
+            <li>
+              <Link to="#resource-usage" target="_top">
+                Resource usage
+              </Link>
+            </li>
+          )}
+          {exportsPartition && (
+            <li>
+              <Link to="#live-data" target="_top">
+                Live data
+              </Link>
+            </li>
+          )}
           {props.component.referencesTo.length > 0 && (
             <li>
               <Link to="#dependencies" target="_top">
@@ -116,6 +132,24 @@ export const ComponentView: FC<ComponentViewProps> = (props) => {
         {exportsPartition && <ComponentBody partition={exportsPartition} />}
         {debugPartition && <ComponentBody partition={debugPartition} />}
 
+        {props.component.stats && (
+          <section id="resource-usage">
+            <h2>Resource usage</h2>
+            <div className={styles.sectionContent}>
+              <ComponentStats stats={props.component.stats} />
+            </div>
+          </section>
+        )}
+
+        {exportsPartition && (
+          <section id="live-data">
+            <h2>Live data</h2>
+            <div className={styles.sectionContent}>
+              <ComponentTap id={pathJoin([props.component.moduleID, props.component.localID])} />
+            </div>
+          </section>
+        )}
+
         {props.component.referencesTo.length > 0 && (
           <section id="dependencies">
             <h2>Dependencies</h2>
@@ -138,6 +172,9 @@ export const ComponentView: FC<ComponentViewProps> = (props) => {
           <section id="module">
             <h2>Module components</h2>
             <div className={styles.sectionContent}>
+              <p>
+                <Link to={'/graph/' + pathJoin([props.component.moduleID, props.component.localID])}>View graph</Link>
+              </p>
               <ComponentList
                 components={props.component.moduleInfo}
                 moduleID={pathJoin([props.component.moduleID, props.component.localID])}
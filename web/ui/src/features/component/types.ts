@@ -76,6 +76,7 @@ export enum ComponentHealthState {
   UNHEALTHY = 'unhealthy',
   UNKNOWN = 'unknown',
   EXITED = 'exited',
+  STANDBY = 'standby',
 }
 
 /*
@@ -110,6 +111,25 @@ export interface ComponentDetail extends ComponentInfo {
    * If a component is a module loader, the loaded components from the module are included here.
    */
   moduleInfo?: ComponentInfo[];
+
+  /**
+   * Resource usage of the component.
+   */
+  stats?: ComponentStats;
+}
+
+/**
+ * ComponentStats holds resource usage statistics of a running component.
+ */
+export interface ComponentStats {
+  /** Number of goroutines started on behalf of the component. */
+  goroutines: number;
+
+  /** Number of items received through the exported receivers of the component. */
+  itemsReceived: number;
+
+  /** Number of items the component sent to the receivers in its arguments. */
+  itemsSent: number;
 }
 
 export interface PartitionedBody {
@@ -129,3 +149,26 @@ export enum SortOrder {
   ASC = 'asc',
   DESC = 'desc',
 }
+
+/**
+ * TapEvent is a single item sampled from a receiver exported by a component.
+ */
+export interface TapEvent {
+  /** When the event was observed. */
+  time: string;
+
+  /** Name of the exported receiver which received the data. */
+  receiver: string;
+
+  /** Kind of data, such as "sample" or "log". */
+  kind: string;
+
+  /** Labels associated with the data, if any. */
+  labels?: string;
+
+  /** Timestamp of the data. */
+  timestamp: string;
+
+  /** Human-readable representation of the data. */
+  data: string;
+}
@@ -328,7 +328,9 @@ export const ComponentGraph: FC<ComponentGraphProps> = (props) => {
         return `translate(${x}, ${y})`;
       });
 
-    const linkedNodes = nodes.append('a').attr('href', (n) => `${baseComponentPath}/${n.data.localID}`);
+    const linkedNodes = nodes
+      .append('a')
+      .attr('href', (n) => `${baseComponentPath}/${n.data.moduleID ? n.data.moduleID + '/' : ''}${n.data.localID}`);
 
     // Plot nodes
     linkedNodes
@@ -386,6 +388,8 @@ export const ComponentGraph: FC<ComponentGraphProps> = (props) => {
             return '#d2476d';
           case ComponentHealthState.UNKNOWN:
             return '#f5d65b';
+          case ComponentHealthState.STANDBY:
+            return '#3274d9';
         }
       })
       .attr('rx', 1)
@@ -23,6 +23,11 @@ function Navbar() {
             Clustering
           </NavLink>
         </li>
+        <li>
+          <NavLink to="/reload" className="nav-link">
+            Reload
+          </NavLink>
+        </li>
         <li>
           <a href="https://grafana.com/docs/agent/latest">Help</a>
         </li>
@@ -0,0 +1,88 @@
+import { FC } from 'react';
+
+import { Edge, ReloadStatus } from './types';
+
+import styles from './ReloadView.module.css';
+
+export interface ReloadViewProps {
+  status: ReloadStatus;
+}
+
+const renderIDs = (title: string, ids: string[] | null) => {
+  if (ids === null || ids.length === 0) {
+    return null;
+  }
+  return (
+    <tr>
+      <th>{title}</th>
+      <td>{ids.join(', ')}</td>
+    </tr>
+  );
+};
+
+const renderEdges = (title: string, edges: Edge[] | null) => {
+  return renderIDs(title, edges === null ? null : edges.map((e) => `${e.from} → ${e.to}`));
+};
+
+const renderSource = (title: string, files: Record<string, string>) => {
+  const names = Object.keys(files).sort();
+  if (names.length === 0) {
+    return null;
+  }
+  return (
+    <section>
+      <h2>{title}</h2>
+      {names.map((name) => (
+        <div key={name}>
+          <h3>{name}</h3>
+          <pre className={styles.source}>{files[name]}</pre>
+        </div>
+      ))}
+    </section>
+  );
+};
+
+/**
+ * ReloadView displays the result of the most recent reload: the changes it
+ * made, its error, and the last good and failed sources.
+ */
+export const ReloadView: FC<ReloadViewProps> = ({ status }) => {
+  let result = 'Reloaded successfully';
+  if (status.error !== undefined) {
+    result = status.rolledBack ? 'Failed, rolled back to the last good source' : 'Failed';
+  }
+
+  return (
+    <div className={styles.reload}>
+      <section>
+        <h2>Most recent reload</h2>
+        <table className={styles.diff}>
+          <tbody>
+            <tr>
+              <th>Time</th>
+              <td>{status.time}</td>
+            </tr>
+            <tr>
+              <th>Result</th>
+              <td>{result}</td>
+            </tr>
+            {status.error !== undefined && (
+              <tr>
+                <th>Error</th>
+                <td className={styles.error}>{status.error}</td>
+              </tr>
+            )}
+            {renderIDs('Added', status.diff.added)}
+            {renderIDs('Removed', status.diff.removed)}
+            {renderIDs('Changed', status.diff.changed)}
+            {renderEdges('References added', status.diff.edgesAdded)}
+            {renderEdges('References removed', status.diff.edgesRemoved)}
+          </tbody>
+        </table>
+      </section>
+
+      {renderSource('Failed source', status.failed)}
+      {renderSource('Last good source', status.lastGood)}
+    </div>
+  );
+};
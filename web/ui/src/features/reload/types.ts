@@ -0,0 +1,42 @@
+/**
+ * Edge is a reference from one block to another.
+ */
+export interface Edge {
+  from: string;
+  to: string;
+}
+
+/**
+ * SourceDiff describes how the blocks of a reloaded source differ from the
+ * last good source.
+ */
+export interface SourceDiff {
+  added: string[] | null;
+  removed: string[] | null;
+  changed: string[] | null;
+
+  edgesAdded: Edge[] | null;
+  edgesRemoved: Edge[] | null;
+}
+
+/**
+ * ReloadStatus describes the result of the most recent reload.
+ */
+export interface ReloadStatus {
+  /** Time of the reload in RFC3339 format. */
+  time: string;
+
+  /** Error encountered during the reload, if any. */
+  error?: string;
+
+  /** Whether the last good source was loaded again after the error. */
+  rolledBack: boolean;
+
+  diff: SourceDiff;
+
+  /** Files of the last good source, by name. */
+  lastGood: Record<string, string>;
+
+  /** Files of the source which failed to load, by name. */
+  failed: Record<string, string>;
+}
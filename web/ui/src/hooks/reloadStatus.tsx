@@ -0,0 +1,28 @@
+import { useEffect, useState } from 'react';
+
+import { ReloadStatus } from '../features/reload/types';
+
+/**
+ * useReloadStatus retrieves the result of the most recent reload from the
+ * API.
+ */
+export const useReloadStatus = (): ReloadStatus | undefined => {
+  const [status, setStatus] = useState<ReloadStatus | undefined>(undefined);
+
+  useEffect(function () {
+    const worker = async () => {
+      const infoPath = './api/v0/web/reload';
+
+      // Request is relative to the <base> tag inside of <head>.
+      const resp = await fetch(infoPath, {
+        cache: 'no-cache',
+        credentials: 'same-origin',
+      });
+      setStatus(await resp.json());
+    };
+
+    worker().catch(console.error);
+  }, []);
+
+  return status;
+};
@@ -1,3 +1,4 @@
+import { useParams } from 'react-router-dom';
 import { faDiagramProject } from '@fortawesome/free-solid-svg-icons';
 
 import { ComponentGraph } from '../features/graph/ComponentGraph';
@@ -5,10 +6,17 @@ import Page from '../features/layout/Page';
 import { useComponentInfo } from '../hooks/componentInfo';
 
 function Graph() {
-  const [components] = useComponentInfo('');
+  // The optional module ID shows the graph of the components within a module,
+  // such as a custom component.
+  const { '*': moduleID } = useParams();
+  const [components] = useComponentInfo(moduleID || '');
+
+  const desc = moduleID
+    ? `Relationships between components defined in ${moduleID}`
+    : 'Relationships between defined components';
 
   return (
-    <Page name="Graph" desc="Relationships between defined components" icon={faDiagramProject}>
+    <Page name="Graph" desc={desc} icon={faDiagramProject}>
       {components.length > 0 && <ComponentGraph components={components} />}
     </Page>
   );
@@ -0,0 +1,17 @@
+import { faRotate } from '@fortawesome/free-solid-svg-icons';
+
+import Page from '../features/layout/Page';
+import { ReloadView } from '../features/reload/ReloadView';
+import { useReloadStatus } from '../hooks/reloadStatus';
+
+function PageReload() {
+  const status = useReloadStatus();
+
+  return (
+    <Page name="Reload" desc="Result of the most recent config reload" icon={faRotate}>
+      {status !== undefined && <ReloadView status={status} />}
+    </Page>
+  );
+}
+
+export default PageReload;